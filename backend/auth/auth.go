@@ -0,0 +1,192 @@
+// Package auth authenticates API clients and records who they are in the
+// request context.
+//
+// Authentication matters for idempotency because idempotency keys must be
+// scoped to the client that sent them. If two clients could share a key
+// namespace, a client guessing (or colliding with) another client's key would
+// receive that client's stored response as a "replay". After a successful
+// authentication the middleware scopes all store operations to the caller's
+// ID (see store.WithOwner), which closes that hole.
+//
+// Two credentials are accepted: API keys in the X-API-Key header, minted by
+// the server itself, and JWT bearer tokens in the Authorization header, issued
+// by an external identity provider.
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/arkantrust/idempotency-example/backend/models"
+	"github.com/arkantrust/idempotency-example/backend/store"
+)
+
+// HeaderAPIKey is the request header carrying the client's API key.
+const HeaderAPIKey = "X-API-Key"
+
+// Scopes understood by RequireScope. API keys carry those of their role.
+const (
+	ScopeRead  = "chargebacks:read"
+	ScopeWrite = "chargebacks:write"
+)
+
+// Sources of a Principal's credentials, which prefix its Owner.
+const (
+	SourceAPIKey = "key"
+	SourceJWT    = "jwt"
+)
+
+// Principal identifies an authenticated caller.
+type Principal struct {
+	// ID is the stable identifier of the caller: the API key ID, or the
+	// "sub" claim of a JWT.
+	ID string
+
+	// Source is where the caller's credentials come from: SourceAPIKey or
+	// SourceJWT.
+	Source string
+
+	// Scopes lists what the caller may do.
+	Scopes []string
+
+	// Tenant, when set, is the only tenant the caller may act on.
+	Tenant string
+}
+
+// Owner returns the identity p's records and rate limit are kept under: its
+// ID prefixed by its Source, e.g. "key:k1" or "jwt:alice". IDs of different
+// sources share no namespace, so a token whose sub claim is some API key's ID
+// does not act as that key.
+func (p Principal) Owner() string {
+	return p.Source + ":" + p.ID
+}
+
+// HasScope reports whether p was granted scope.
+func (p Principal) HasScope(scope string) bool {
+	return slices.Contains(p.Scopes, scope)
+}
+
+type principalKey struct{}
+
+// PrincipalFrom returns the authenticated caller stored in ctx.
+func PrincipalFrom(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(Principal)
+	return p, ok
+}
+
+// WithPrincipal returns a copy of ctx carrying p and scoping store operations
+// to p.Owner().
+func WithPrincipal(ctx context.Context, p Principal) context.Context {
+	ctx = context.WithValue(ctx, principalKey{}, p)
+	return store.WithOwner(ctx, p.Owner())
+}
+
+// KeyStore looks up API keys. *store.Store satisfies it.
+type KeyStore interface {
+	LookupAPIKey(ctx context.Context, plaintext string) (*models.APIKey, error)
+}
+
+// Authenticator is middleware that authenticates requests by API key or JWT
+// bearer token.
+//
+// When Required is false, requests without credentials pass through
+// anonymously, scoped to the records created anonymously; credentials that
+// are present but invalid are always rejected, so a typo never silently
+// downgrades a client to anonymous access.
+type Authenticator struct {
+	// Keys validates X-API-Key headers.
+	Keys KeyStore
+
+	// JWT validates bearer tokens. When nil, bearer tokens are not accepted.
+	JWT *JWTVerifier
+
+	// Required rejects requests that carry no credentials.
+	Required bool
+}
+
+// Middleware wraps next with authentication.
+func (a *Authenticator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, err := a.authenticate(r.Context(), r.Header.Get(HeaderAPIKey), r.Header.Get("Authorization"))
+		switch {
+		case errors.Is(err, errNoCredentials):
+			if a.Required {
+				unauthorized(w, "missing credentials")
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(store.WithOwner(r.Context(), "")))
+		case errors.Is(err, store.ErrInvalidKey):
+			unauthorized(w, "invalid API key")
+		case errors.Is(err, ErrInvalidToken):
+			unauthorized(w, "invalid bearer token")
+		case err != nil:
+			slog.ErrorContext(r.Context(), "authentication failed", "err", err)
+			writeError(w, http.StatusInternalServerError, "failed to authenticate")
+		default:
+			next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), p)))
+		}
+	})
+}
+
+var errNoCredentials = errors.New("no credentials")
+
+// authenticate checks the credentials from an API key header and an
+// Authorization header, whichever transport they arrived on.
+func (a *Authenticator) authenticate(ctx context.Context, apiKey, authorization string) (Principal, error) {
+	if apiKey != "" {
+		k, err := a.Keys.LookupAPIKey(ctx, apiKey)
+		if err != nil {
+			return Principal{}, err
+		}
+		return Principal{ID: k.ID, Source: SourceAPIKey, Tenant: k.Tenant, Scopes: RoleScopes(k.Role)}, nil
+	}
+
+	if a.JWT != nil {
+		if token, ok := strings.CutPrefix(authorization, "Bearer "); ok {
+			return a.JWT.Verify(ctx, token)
+		}
+	}
+	return Principal{}, errNoCredentials
+}
+
+// RequireScope returns middleware that rejects authenticated callers lacking
+// any of scopes with 403. Anonymous requests, only possible when
+// authentication is not required, pass through.
+func RequireScope(scopes ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if p, ok := PrincipalFrom(r.Context()); ok {
+				for _, scope := range scopes {
+					if !p.HasScope(scope) {
+						w.Header().Set("WWW-Authenticate", `Bearer error="insufficient_scope", scope="`+strings.Join(scopes, " ")+`"`)
+						writeError(w, http.StatusForbidden, "missing scope "+scope)
+						return
+					}
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func unauthorized(w http.ResponseWriter, msg string) {
+	w.Header().Add("WWW-Authenticate", `APIKey header="`+HeaderAPIKey+`"`)
+	w.Header().Add("WWW-Authenticate", "Bearer")
+	writeError(w, http.StatusUnauthorized, msg)
+}
+
+// writeError mirrors the JSON error shape used by the handlers package.
+func writeError(w http.ResponseWriter, status int, msg string) {
+	body := map[string]string{"error": msg}
+	if id := w.Header().Get("X-Request-ID"); id != "" {
+		body["requestId"] = id
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body) //nolint:errcheck
+}
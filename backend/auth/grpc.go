@@ -0,0 +1,61 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/arkantrust/idempotency-example/backend/store"
+)
+
+// UnaryInterceptor is Middleware, Tenant and RequireScope for gRPC. The
+// credentials and the tenant are read from the metadata keys matching the
+// HTTP headers (lower-cased, as gRPC requires); scopeFor maps a full method
+// name to the scope it needs.
+func (a *Authenticator) UnaryInterceptor(scopeFor func(fullMethod string) string) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		get := func(key string) string {
+			if v := md.Get(key); len(v) > 0 {
+				return v[0]
+			}
+			return ""
+		}
+
+		p, err := a.authenticate(ctx, get(strings.ToLower(HeaderAPIKey)), get("authorization"))
+		switch {
+		case errors.Is(err, errNoCredentials):
+			if a.Required {
+				return nil, status.Error(codes.Unauthenticated, "missing credentials")
+			}
+			ctx = store.WithOwner(ctx, "")
+		case errors.Is(err, store.ErrInvalidKey):
+			return nil, status.Error(codes.Unauthenticated, "invalid API key")
+		case errors.Is(err, ErrInvalidToken):
+			return nil, status.Error(codes.Unauthenticated, "invalid bearer token")
+		case err != nil:
+			slog.ErrorContext(ctx, "authentication failed", "err", err)
+			return nil, status.Error(codes.Internal, "failed to authenticate")
+		default:
+			if scope := scopeFor(info.FullMethod); !p.HasScope(scope) {
+				return nil, status.Error(codes.PermissionDenied, "missing scope "+scope)
+			}
+			ctx = WithPrincipal(ctx, p)
+		}
+
+		ctx, err = withTenant(ctx, get(strings.ToLower(HeaderTenant)))
+		switch {
+		case errors.Is(err, errInvalidTenant):
+			return nil, status.Error(codes.InvalidArgument, "invalid "+strings.ToLower(HeaderTenant)+" metadata")
+		case err != nil:
+			return nil, status.Error(codes.PermissionDenied, err.Error())
+		}
+		return handler(ctx, req)
+	}
+}
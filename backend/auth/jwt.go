@@ -0,0 +1,255 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ErrInvalidToken is returned by JWTVerifier.Verify for tokens that are
+// malformed, expired, wrongly signed or missing a subject.
+var ErrInvalidToken = errors.New("invalid bearer token")
+
+// JWTOptions configures a JWTVerifier. Exactly one of Secret and JWKSURL must
+// be set.
+type JWTOptions struct {
+	// Secret verifies HMAC-signed (HS256/384/512) tokens.
+	Secret string
+
+	// JWKSURL is fetched for the public keys of RSA- or ECDSA-signed tokens.
+	JWKSURL string
+
+	// Issuer and Audience, when set, must match the "iss" and "aud" claims.
+	Issuer   string
+	Audience string
+}
+
+// JWTVerifier validates bearer tokens and turns their claims into a
+// Principal.
+type JWTVerifier struct {
+	keyfunc jwt.Keyfunc
+	parser  *jwt.Parser
+}
+
+// NewJWTVerifier returns a verifier for opts. JWKS keys are fetched lazily,
+// on the first token that needs them.
+func NewJWTVerifier(opts JWTOptions) (*JWTVerifier, error) {
+	parserOpts := []jwt.ParserOption{jwt.WithExpirationRequired(), jwt.WithLeeway(30 * time.Second)}
+	if opts.Issuer != "" {
+		parserOpts = append(parserOpts, jwt.WithIssuer(opts.Issuer))
+	}
+	if opts.Audience != "" {
+		parserOpts = append(parserOpts, jwt.WithAudience(opts.Audience))
+	}
+
+	v := &JWTVerifier{}
+	switch {
+	case opts.Secret != "" && opts.JWKSURL != "":
+		return nil, errors.New("jwt secret and JWKS URL are mutually exclusive")
+	case opts.Secret != "":
+		secret := []byte(opts.Secret)
+		v.keyfunc = func(*jwt.Token) (any, error) { return secret, nil }
+		parserOpts = append(parserOpts, jwt.WithValidMethods([]string{"HS256", "HS384", "HS512"}))
+	case opts.JWKSURL != "":
+		v.keyfunc = (&jwks{url: opts.JWKSURL}).keyfunc
+		parserOpts = append(parserOpts, jwt.WithValidMethods([]string{
+			"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512",
+		}))
+	default:
+		return nil, errors.New("jwt secret or JWKS URL is required")
+	}
+	v.parser = jwt.NewParser(parserOpts...)
+	return v, nil
+}
+
+// claims are the registered claims plus the two common spellings of scopes:
+// a space-separated "scope" string (RFC 8693) and an "scp" array, roles
+// granting theirs as a "role" string or a "roles" array, and an optional
+// "tenant" binding the token to one tenant.
+type claims struct {
+	jwt.RegisteredClaims
+	Scope  string   `json:"scope"`
+	Scp    []string `json:"scp"`
+	Role   string   `json:"role"`
+	Roles  []string `json:"roles"`
+	Tenant string   `json:"tenant"`
+}
+
+// scopes returns the scopes c grants, its roles' included. A token names
+// its roles explicitly, so one without any gets none of theirs.
+func (c claims) scopes() []string {
+	scopes := append(strings.Fields(c.Scope), c.Scp...)
+	for _, role := range append(c.Roles, c.Role) {
+		if role != "" {
+			scopes = append(scopes, RoleScopes(role)...)
+		}
+	}
+	return scopes
+}
+
+// Verify validates token and returns the caller it identifies.
+func (v *JWTVerifier) Verify(ctx context.Context, token string) (Principal, error) {
+	var c claims
+	if _, err := v.parser.ParseWithClaims(token, &c, v.keyfunc); err != nil {
+		var fe fetchError
+		if errors.As(err, &fe) {
+			return Principal{}, fe.err
+		}
+		return Principal{}, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	if c.Subject == "" {
+		return Principal{}, fmt.Errorf("%w: missing sub claim", ErrInvalidToken)
+	}
+	return Principal{ID: c.Subject, Source: SourceJWT, Tenant: c.Tenant, Scopes: c.scopes()}, nil
+}
+
+// jwks caches the keys published at a JWKS URL. The set is refreshed when it
+// is older than jwksTTL, or when a token names a key ID the cache does not
+// know (the issuer has rotated keys), but at most once per jwksMinRefresh so
+// that tokens with made-up key IDs cannot turn the server into a JWKS
+// hammer.
+type jwks struct {
+	url string
+
+	mu      sync.Mutex
+	keys    map[string]crypto.PublicKey
+	fetched time.Time
+}
+
+const (
+	jwksTTL        = time.Hour
+	jwksMinRefresh = time.Minute
+)
+
+// fetchError marks failures to reach the JWKS endpoint, which are server
+// errors rather than bad tokens.
+type fetchError struct{ err error }
+
+func (e fetchError) Error() string { return e.err.Error() }
+
+func (k *jwks) keyfunc(t *jwt.Token) (any, error) {
+	kid, _ := t.Header["kid"].(string)
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	key, ok := k.keys[kid]
+	stale := time.Since(k.fetched) > jwksTTL
+	if (!ok || stale) && time.Since(k.fetched) > jwksMinRefresh {
+		if err := k.refresh(); err != nil {
+			return nil, fetchError{fmt.Errorf("fetch JWKS: %w", err)}
+		}
+		key, ok = k.keys[kid]
+	}
+	if !ok {
+		return nil, fmt.Errorf("unknown key ID %q", kid)
+	}
+	return key, nil
+}
+
+func (k *jwks) refresh() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, k.url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return err
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, j := range set.Keys {
+		// Keys of unsupported types or uses are skipped rather than failing
+		// the whole set.
+		if pub, err := j.publicKey(); err == nil && (j.Use == "" || j.Use == "sig") {
+			keys[j.Kid] = pub
+		}
+	}
+	k.keys = keys
+	k.fetched = time.Now()
+	return nil
+}
+
+// jwk is a single JSON Web Key (RFC 7517) of type RSA or EC.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (j jwk) publicKey() (crypto.PublicKey, error) {
+	switch j.Kty {
+	case "RSA":
+		n, err := b64Int(j.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := b64Int(j.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch j.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", j.Crv)
+		}
+		x, err := b64Int(j.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := b64Int(j.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", j.Kty)
+	}
+}
+
+func b64Int(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
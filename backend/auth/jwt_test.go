@@ -0,0 +1,165 @@
+package auth_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/arkantrust/idempotency-example/backend/auth"
+	"github.com/arkantrust/idempotency-example/backend/store"
+)
+
+var ctx = context.Background()
+
+func sign(t *testing.T, method jwt.SigningMethod, key any, kid string, c jwt.MapClaims) string {
+	t.Helper()
+	tok := jwt.NewWithClaims(method, c)
+	if kid != "" {
+		tok.Header["kid"] = kid
+	}
+	s, err := tok.SignedString(key)
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+	return s
+}
+
+func TestVerifySecret(t *testing.T) {
+	v, err := auth.NewJWTVerifier(auth.JWTOptions{Secret: "s3cret", Audience: "chargebacks"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	exp := time.Now().Add(time.Hour).Unix()
+
+	p, err := v.Verify(ctx, sign(t, jwt.SigningMethodHS256, []byte("s3cret"), "", jwt.MapClaims{
+		"sub": "alice", "aud": "chargebacks", "exp": exp, "scope": "chargebacks:read chargebacks:write",
+	}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if p.ID != "alice" || p.Owner() != "jwt:alice" || !p.HasScope(auth.ScopeWrite) {
+		t.Fatalf("unexpected principal: %+v", p)
+	}
+
+	for name, c := range map[string]jwt.MapClaims{
+		"expired":      {"sub": "alice", "aud": "chargebacks", "exp": time.Now().Add(-time.Hour).Unix()},
+		"no exp":       {"sub": "alice", "aud": "chargebacks"},
+		"no sub":       {"aud": "chargebacks", "exp": exp},
+		"wrong aud":    {"sub": "alice", "aud": "other", "exp": exp},
+		"wrong secret": nil,
+	} {
+		key := []byte("s3cret")
+		if c == nil {
+			c, key = jwt.MapClaims{"sub": "alice", "aud": "chargebacks", "exp": exp}, []byte("other")
+		}
+		if _, err := v.Verify(ctx, sign(t, jwt.SigningMethodHS256, key, "", c)); !errors.Is(err, auth.ErrInvalidToken) {
+			t.Fatalf("%s: expected ErrInvalidToken, got %v", name, err)
+		}
+	}
+}
+
+func TestVerifyJWKS(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "k1",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	}))
+	defer srv.Close()
+
+	v, err := auth.NewJWTVerifier(auth.JWTOptions{JWKSURL: srv.URL})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	claims := jwt.MapClaims{"sub": "bob", "exp": time.Now().Add(time.Hour).Unix(), "scp": []string{auth.ScopeRead}}
+
+	p, err := v.Verify(ctx, sign(t, jwt.SigningMethodRS256, key, "k1", claims))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if p.ID != "bob" || !p.HasScope(auth.ScopeRead) || p.HasScope(auth.ScopeWrite) {
+		t.Fatalf("unexpected principal: %+v", p)
+	}
+
+	// An HMAC token must not be accepted by a JWKS verifier, even when
+	// "signed" with the public key material.
+	if _, err := v.Verify(ctx, sign(t, jwt.SigningMethodHS256, key.N.Bytes(), "k1", claims)); !errors.Is(err, auth.ErrInvalidToken) {
+		t.Fatalf("expected ErrInvalidToken for algorithm confusion, got %v", err)
+	}
+}
+
+func TestRequireScope(t *testing.T) {
+	h := auth.RequireScope(auth.ScopeWrite)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	cases := []struct {
+		name string
+		ctx  context.Context
+		want int
+	}{
+		{"anonymous", ctx, http.StatusOK},
+		{"granted", auth.WithPrincipal(ctx, auth.Principal{ID: "a", Scopes: []string{auth.ScopeWrite}}), http.StatusOK},
+		{"missing", auth.WithPrincipal(ctx, auth.Principal{ID: "a", Scopes: []string{auth.ScopeRead}}), http.StatusForbidden},
+	}
+	for _, tc := range cases {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/chargebacks/x", nil).WithContext(tc.ctx))
+		if rec.Code != tc.want {
+			t.Fatalf("%s: expected %d, got %d", tc.name, tc.want, rec.Code)
+		}
+	}
+}
+
+func TestOwnerBySource(t *testing.T) {
+	s, err := store.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to open store: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	plaintext, k, err := s.CreateAPIKey(ctx, "client", "", auth.RoleOperator)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := auth.NewJWTVerifier(auth.JWTOptions{Secret: "s3cret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := &auth.Authenticator{Keys: s, JWT: v}
+
+	var owner string
+	h := a.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		owner = store.OwnerFrom(r.Context())
+	}))
+	serve := func(header, value string) string {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(header, value)
+		h.ServeHTTP(httptest.NewRecorder(), req)
+		return owner
+	}
+
+	// A token whose sub is the key's ID must not reach the key's records.
+	token := sign(t, jwt.SigningMethodHS256, []byte("s3cret"), "", jwt.MapClaims{"sub": k.ID, "exp": time.Now().Add(time.Hour).Unix()})
+	if got := serve(auth.HeaderAPIKey, plaintext); got != "key:"+k.ID {
+		t.Fatalf("expected the key's records owned by key:%s, got %q", k.ID, got)
+	}
+	if got := serve("Authorization", "Bearer "+token); got != "jwt:"+k.ID {
+		t.Fatalf("expected the token's records owned by jwt:%s, got %q", k.ID, got)
+	}
+}
@@ -0,0 +1,92 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"errors"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/arkantrust/idempotency-example/backend/store"
+)
+
+// ScopeAdmin grants the /admin routes: backups, compaction, key management
+// and the rest of the server's operation.
+const ScopeAdmin = "admin"
+
+// Roles bundle scopes, so that a credential can be given one name instead of
+// a list: viewers read chargebacks, operators also change them, and admins
+// also operate the server.
+const (
+	RoleViewer   = "viewer"
+	RoleOperator = "operator"
+	RoleAdmin    = "admin"
+)
+
+var roleScopes = map[string][]string{
+	RoleViewer:   {ScopeRead},
+	RoleOperator: {ScopeRead, ScopeWrite},
+	RoleAdmin:    {ScopeRead, ScopeWrite, ScopeAdmin},
+}
+
+// ValidRole reports whether role is one of the roles above.
+func ValidRole(role string) bool {
+	_, ok := roleScopes[role]
+	return ok
+}
+
+// RoleScopes returns the scopes role grants. An API key minted before keys
+// had roles has none and keeps what every key could do then: RoleOperator's.
+// Unknown roles grant nothing.
+func RoleScopes(role string) []string {
+	if role == "" {
+		role = RoleOperator
+	}
+	return slices.Clone(roleScopes[role])
+}
+
+// RequireAdmin returns middleware admitting to the admin routes requests
+// bearing token, when it is not empty, or credentials granted ScopeAdmin.
+// Credentials without it are refused with 403, and requests without any
+// with 401 – unless token is empty and authentication is not required, the
+// one configuration in which the admin routes are open.
+//
+// The caller is not recorded in the request context: admin routes act on
+// every owner's records, not on the caller's.
+func (a *Authenticator) RequireAdmin(token string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			authorization := r.Header.Get("Authorization")
+			if got, ok := strings.CutPrefix(authorization, "Bearer "); ok && token != "" &&
+				subtle.ConstantTimeCompare([]byte(got), []byte(token)) == 1 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			p, err := a.authenticate(r.Context(), r.Header.Get(HeaderAPIKey), authorization)
+			switch {
+			case errors.Is(err, errNoCredentials):
+				if token != "" || a.Required {
+					unauthorized(w, "missing credentials")
+					return
+				}
+			case errors.Is(err, store.ErrInvalidKey):
+				unauthorized(w, "invalid API key")
+				return
+			case errors.Is(err, ErrInvalidToken):
+				unauthorized(w, "invalid bearer token")
+				return
+			case err != nil:
+				slog.ErrorContext(r.Context(), "authentication failed", "err", err)
+				writeError(w, http.StatusInternalServerError, "failed to authenticate")
+				return
+			case !p.HasScope(ScopeAdmin):
+				w.Header().Set("WWW-Authenticate", `Bearer error="insufficient_scope", scope="`+ScopeAdmin+`"`)
+				writeError(w, http.StatusForbidden, "missing scope "+ScopeAdmin)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
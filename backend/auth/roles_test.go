@@ -0,0 +1,98 @@
+package auth_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/arkantrust/idempotency-example/backend/auth"
+	"github.com/arkantrust/idempotency-example/backend/store"
+)
+
+func TestRoleScopes(t *testing.T) {
+	v, err := auth.NewJWTVerifier(auth.JWTOptions{Secret: "s3cret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := time.Now().Add(time.Hour).Unix()
+
+	for name, tc := range map[string]struct {
+		claims             jwt.MapClaims
+		read, write, admin bool
+	}{
+		"viewer":         {jwt.MapClaims{"role": "viewer"}, true, false, false},
+		"operator":       {jwt.MapClaims{"roles": []string{"operator"}}, true, true, false},
+		"admin":          {jwt.MapClaims{"role": "admin"}, true, true, true},
+		"unknown role":   {jwt.MapClaims{"role": "root"}, false, false, false},
+		"no role":        {jwt.MapClaims{}, false, false, false},
+		"role and scope": {jwt.MapClaims{"role": "viewer", "scope": "chargebacks:write"}, true, true, false},
+	} {
+		tc.claims["sub"], tc.claims["exp"] = "alice", exp
+		p, err := v.Verify(ctx, sign(t, jwt.SigningMethodHS256, []byte("s3cret"), "", tc.claims))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if p.HasScope(auth.ScopeRead) != tc.read || p.HasScope(auth.ScopeWrite) != tc.write || p.HasScope(auth.ScopeAdmin) != tc.admin {
+			t.Errorf("%s: scopes = %v", name, p.Scopes)
+		}
+	}
+}
+
+func TestRequireAdmin(t *testing.T) {
+	s, err := store.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to open store: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	keys := map[string]string{}
+	for _, role := range []string{auth.RoleViewer, auth.RoleOperator, auth.RoleAdmin} {
+		plaintext, _, err := s.CreateAPIKey(ctx, role, "", role)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys[role] = plaintext
+	}
+
+	ok := http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})
+	serve := func(a *auth.Authenticator, token, header, value string) int {
+		req := httptest.NewRequest(http.MethodPost, "/admin/compact", nil)
+		if header != "" {
+			req.Header.Set(header, value)
+		}
+		rec := httptest.NewRecorder()
+		a.RequireAdmin(token)(ok).ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	a := &auth.Authenticator{Keys: s}
+	cases := []struct {
+		name          string
+		header, value string
+		want          int
+	}{
+		{"admin token", "Authorization", "Bearer t0ken", http.StatusOK},
+		{"wrong token", "Authorization", "Bearer nope", http.StatusUnauthorized},
+		{"no credentials", "", "", http.StatusUnauthorized},
+		{"admin key", auth.HeaderAPIKey, keys[auth.RoleAdmin], http.StatusOK},
+		{"operator key", auth.HeaderAPIKey, keys[auth.RoleOperator], http.StatusForbidden},
+		{"viewer key", auth.HeaderAPIKey, keys[auth.RoleViewer], http.StatusForbidden},
+	}
+	for _, tc := range cases {
+		if got := serve(a, "t0ken", tc.header, tc.value); got != tc.want {
+			t.Errorf("%s: status = %d, want %d", tc.name, got, tc.want)
+		}
+	}
+
+	// Without a token, the admin routes are only open when authentication
+	// is not required.
+	if got := serve(a, "", "", ""); got != http.StatusOK {
+		t.Errorf("open: status = %d, want 200", got)
+	}
+	if got := serve(&auth.Authenticator{Keys: s, Required: true}, "", "", ""); got != http.StatusUnauthorized {
+		t.Errorf("auth required: status = %d, want 401", got)
+	}
+}
@@ -0,0 +1,67 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/arkantrust/idempotency-example/backend/store"
+)
+
+// HeaderTenant is the request header selecting the tenant a request acts on.
+const HeaderTenant = "X-Tenant-ID"
+
+// Tenant is middleware that scopes store operations to the tenant of the
+// request. It must run after Authenticator.Middleware.
+//
+// Callers bound to a tenant (an API key minted with one, or a JWT with a
+// "tenant" claim) always act on that tenant; naming a different one in
+// X-Tenant-ID is rejected with 403 rather than silently ignored. Unbound
+// callers, anonymous ones included, act on the default tenant, and naming
+// any other is rejected with 403 too.
+//
+// In a SaaS system this is what keeps idempotency keys apart: the same key
+// sent to two tenants must never replay one tenant's response to the other.
+func Tenant(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, err := withTenant(r.Context(), r.Header.Get(HeaderTenant))
+		switch {
+		case errors.Is(err, errInvalidTenant):
+			writeError(w, http.StatusBadRequest, "invalid "+HeaderTenant+" header")
+		case err != nil:
+			writeError(w, http.StatusForbidden, err.Error())
+		default:
+			next.ServeHTTP(w, r.WithContext(ctx))
+		}
+	})
+}
+
+var errInvalidTenant = errors.New("invalid tenant")
+
+// withTenant scopes ctx to the tenant the caller asked for, or is bound to.
+// It returns errInvalidTenant for a malformed tenant ID, or an error
+// describing the mismatch when a caller names a tenant it may not act on.
+func withTenant(ctx context.Context, requested string) (context.Context, error) {
+	if requested != "" && !store.ValidTenant(requested) {
+		return nil, errInvalidTenant
+	}
+	tenant := requested
+	p, ok := PrincipalFrom(ctx)
+	switch {
+	case ok && p.Tenant != "":
+		if tenant != "" && tenant != p.Tenant {
+			return nil, fmt.Errorf("credentials are not valid for tenant %s", tenant)
+		}
+		tenant = p.Tenant
+	case tenant != "":
+		return nil, fmt.Errorf("credentials are not bound to tenant %s", tenant)
+	}
+	if tenant == "" {
+		return ctx, nil
+	}
+	if !store.ValidTenant(tenant) {
+		return nil, errInvalidTenant
+	}
+	return store.WithTenant(ctx, tenant), nil
+}
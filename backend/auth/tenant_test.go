@@ -0,0 +1,49 @@
+package auth_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/arkantrust/idempotency-example/backend/auth"
+	"github.com/arkantrust/idempotency-example/backend/store"
+)
+
+func TestTenant(t *testing.T) {
+	var got string
+	h := auth.Tenant(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = store.TenantFrom(r.Context())
+	}))
+	bound := auth.WithPrincipal(ctx, auth.Principal{ID: "a", Tenant: "acme"})
+	unbound := auth.WithPrincipal(ctx, auth.Principal{ID: "b", Scopes: []string{auth.ScopeRead, auth.ScopeWrite}})
+
+	cases := []struct {
+		name   string
+		ctx    context.Context
+		header string
+		want   int
+		tenant string
+	}{
+		{"default", ctx, "", http.StatusOK, ""},
+		{"anonymous header", ctx, "globex", http.StatusForbidden, ""},
+		{"invalid", ctx, "../acme", http.StatusBadRequest, ""},
+		{"bound", bound, "", http.StatusOK, "acme"},
+		{"bound same", bound, "acme", http.StatusOK, "acme"},
+		{"bound other", bound, "globex", http.StatusForbidden, ""},
+		{"unbound", unbound, "", http.StatusOK, ""},
+		{"unbound header", unbound, "globex", http.StatusForbidden, ""},
+	}
+	for _, tc := range cases {
+		got = ""
+		req := httptest.NewRequest(http.MethodGet, "/chargebacks", nil).WithContext(tc.ctx)
+		if tc.header != "" {
+			req.Header.Set(auth.HeaderTenant, tc.header)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != tc.want || got != tc.tenant {
+			t.Fatalf("%s: expected %d tenant %q, got %d tenant %q", tc.name, tc.want, tc.tenant, rec.Code, got)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package backup_test
+
+import (
+	"context"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/arkantrust/idempotency-example/backend/backup"
+)
+
+type fakeSource struct{ data string }
+
+func (f fakeSource) Backup(_ context.Context, w io.Writer) (int64, error) {
+	n, err := io.Copy(w, strings.NewReader(f.data))
+	return n, err
+}
+
+func TestRunOncePrunesOldSnapshots(t *testing.T) {
+	dir := t.TempDir()
+	s := &backup.Scheduler{Source: fakeSource{data: "snapshot"}, Dir: dir, Keep: 2}
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var written []string
+	for i := 0; i < 4; i++ {
+		p, err := s.RunOnce(context.Background(), start.Add(time.Duration(i)*time.Minute))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		written = append(written, p)
+	}
+
+	got, err := backup.List(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("expected 2 snapshots after pruning, got %d", len(got))
+	}
+	if filepath.Base(got[0]) != filepath.Base(written[2]) || filepath.Base(got[1]) != filepath.Base(written[3]) {
+		t.Fatalf("expected newest snapshots to survive, got %v", got)
+	}
+}
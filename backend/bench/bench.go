@@ -0,0 +1,203 @@
+// Package bench measures the storage strategies the API's idempotency rests
+// on, to put numbers on the claims in the package docs:
+//
+//   - update: skipping an update whose payload matches the stored record,
+//     as the API does, against writing it anyway;
+//   - codec: listing records stored as JSON, MessagePack and Protobuf, with
+//     the size of one record in each;
+//   - commit: committing every create in its own transaction, against
+//     coalescing concurrent creates into batches (Store.SetBatching).
+//
+// The cases run as Go benchmarks (go test -bench . ./bench) and, through
+// Run and Report, from the server's -bench-server flag, which measures them
+// on the machine and disk the server would use.
+package bench
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"text/tabwriter"
+	"time"
+
+	"github.com/arkantrust/idempotency-example/backend/models"
+	"github.com/arkantrust/idempotency-example/backend/store"
+)
+
+// Case is one strategy of a comparison.
+type Case struct {
+	// Group names the comparison; the cases of a group measure the same
+	// work done in different ways.
+	Group string
+	Name  string
+
+	// Bench runs the case with a fresh database in dir.
+	Bench func(b *testing.B, dir string)
+}
+
+// Cases returns the cases, grouped, the strategy the API uses first in each
+// group.
+func Cases() []Case {
+	cases := []Case{
+		{Group: "update", Name: "compare-and-skip", Bench: func(b *testing.B, dir string) { benchUpdate(b, dir, true) }},
+		{Group: "update", Name: "always-write", Bench: func(b *testing.B, dir string) { benchUpdate(b, dir, false) }},
+	}
+	for _, codec := range []store.Codec{store.JSON, store.MessagePack, store.Protobuf} {
+		cases = append(cases, Case{Group: "codec", Name: codec.Name(), Bench: func(b *testing.B, dir string) { benchCodec(b, dir, codec) }})
+	}
+	return append(cases,
+		Case{Group: "commit", Name: "per-transaction", Bench: func(b *testing.B, dir string) { benchCommit(b, dir, 0) }},
+		Case{Group: "commit", Name: "batched", Bench: func(b *testing.B, dir string) { benchCommit(b, dir, 256) }},
+	)
+}
+
+var ctx = context.Background()
+
+func open(b *testing.B, dir string) *store.Store {
+	s, err := store.New(filepath.Join(dir, "bench.db"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { s.Close() })
+	return s
+}
+
+// benchUpdate repeats the same update of one chargeback. With skip the
+// store compares it with the stored record and writes nothing, as
+// Store.Update does; without, a collection whose records never compare
+// equal writes, and fsyncs, every time.
+func benchUpdate(b *testing.B, dir string, skip bool) {
+	s := open(b, dir)
+	cb := &models.Chargeback{ID: "cb-1", Amount: 100, Currency: "USD", Reason: "fraud"}
+	if _, _, err := s.Create(ctx, cb); err != nil {
+		b.Fatal(err)
+	}
+	update := func() error {
+		_, _, err := s.Update(ctx, "cb-1", cb, nil)
+		return err
+	}
+	if !skip {
+		c := store.NewCollection[models.Chargeback](s, "chargebacks", "chargeback", func(a, b *models.Chargeback) bool { return false })
+		update = func() error {
+			_, _, err := c.Update(ctx, "cb-1", func(c *models.Chargeback) { c.Reason = cb.Reason })
+			return err
+		}
+	}
+
+	b.ResetTimer()
+	for range b.N {
+		if err := update(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// benchCodec lists 1000 chargebacks stored with codec.
+func benchCodec(b *testing.B, dir string, codec store.Codec) {
+	s := open(b, dir)
+	s.SetCodec(codec)
+	batch := make([]*models.Chargeback, 1000)
+	for i := range batch {
+		batch[i] = &models.Chargeback{ID: fmt.Sprintf("cb-%05d", i), Amount: int64(i), Currency: "USD", Reason: "Merchandise not received"}
+	}
+	if _, err := s.CreateMany(ctx, batch); err != nil {
+		b.Fatal(err)
+	}
+	data, err := codec.Marshal(batch[0])
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+	for range b.N {
+		if _, err := s.List(ctx); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(len(data)), "bytes/record")
+}
+
+// benchCommit creates chargebacks from 32 goroutines per CPU, batched into
+// transactions of up to size writes, or one per transaction if size is 0.
+func benchCommit(b *testing.B, dir string, size int) {
+	s := open(b, dir)
+	s.SetBatching(size, 2*time.Millisecond)
+
+	var n atomic.Int64
+	b.SetParallelism(32)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			cb := &models.Chargeback{ID: fmt.Sprintf("cb-%d", n.Add(1)), Amount: 100, Currency: "USD", Reason: "fraud"}
+			if _, _, err := s.Create(ctx, cb); err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+}
+
+// Result is the outcome of one case.
+type Result struct {
+	Case
+	testing.BenchmarkResult
+}
+
+// Run runs every case, each with a database in a directory of its own under
+// dir.
+func Run(dir string) ([]Result, error) {
+	var results []Result
+	for _, c := range Cases() {
+		caseDir, err := os.MkdirTemp(dir, c.Group+"-"+c.Name+"-")
+		if err != nil {
+			return nil, err
+		}
+		r := testing.Benchmark(func(b *testing.B) { c.Bench(b, caseDir) })
+		if err := os.RemoveAll(caseDir); err != nil {
+			return nil, err
+		}
+		results = append(results, Result{Case: c, BenchmarkResult: r})
+	}
+	return results, nil
+}
+
+// Report writes results as a table per group, with each case's time per
+// operation relative to the fastest of its group.
+func Report(w io.Writer, results []Result) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for i, r := range results {
+		if i == 0 || results[i-1].Group != r.Group {
+			if i > 0 {
+				fmt.Fprintln(tw, "\t\t\t\t\t")
+			}
+			fmt.Fprintf(tw, "%s\tns/op\trelative\tallocs/op\textra\t\n", r.Group)
+		}
+		if r.N == 0 {
+			fmt.Fprintf(tw, "%s\tfailed\t\t\t\t\n", r.Name)
+			continue
+		}
+		extra := ""
+		for unit, v := range r.Extra {
+			extra += fmt.Sprintf("%.0f %s", v, unit)
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%.1fx\t%d\t%s\t\n", r.Name, r.NsPerOp(), relative(results, r), r.AllocsPerOp(), extra)
+	}
+	return tw.Flush()
+}
+
+// relative returns r's time per operation divided by the fastest of its
+// group's.
+func relative(results []Result, r Result) float64 {
+	fastest := math.MaxFloat64
+	for _, o := range results {
+		if o.Group == r.Group && o.N > 0 {
+			fastest = min(fastest, float64(o.NsPerOp()))
+		}
+	}
+	return float64(r.NsPerOp()) / max(fastest, 1)
+}
@@ -0,0 +1,34 @@
+package bench_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/arkantrust/idempotency-example/backend/bench"
+)
+
+func BenchmarkStrategies(b *testing.B) {
+	for _, c := range bench.Cases() {
+		b.Run(c.Group+"/"+c.Name, func(b *testing.B) {
+			b.ReportAllocs()
+			c.Bench(b, b.TempDir())
+		})
+	}
+}
+
+func TestReport(t *testing.T) {
+	results := []bench.Result{
+		{Case: bench.Case{Group: "update", Name: "compare-and-skip"}, BenchmarkResult: testing.BenchmarkResult{N: 10, T: 1000}},
+		{Case: bench.Case{Group: "update", Name: "always-write"}, BenchmarkResult: testing.BenchmarkResult{N: 10, T: 40000}},
+		{Case: bench.Case{Group: "codec", Name: "json"}},
+	}
+	var out strings.Builder
+	if err := bench.Report(&out, results); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"compare-and-skip", "1.0x", "40.0x", "failed"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("expected %q in the report:\n%s", want, out.String())
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/arkantrust/idempotency-example/backend/bench"
+)
+
+// benchServer runs the storage benchmarks of package bench with databases in
+// a temporary directory under dir, the database's directory, so that they
+// measure the disk the server writes to, and prints the report to stdout.
+func benchServer(dir string) error {
+	tmp, err := os.MkdirTemp(dir, "bench-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	slog.Info("running storage benchmarks", "dir", tmp)
+	results, err := bench.Run(tmp)
+	if err != nil {
+		return err
+	}
+	fmt.Println("Storage strategies, relative to the fastest of each group:")
+	fmt.Println()
+	return bench.Report(os.Stdout, results)
+}
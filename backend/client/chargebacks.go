@@ -0,0 +1,321 @@
+// Package client is a Go client for the chargebacks HTTP API that retries
+// safely.
+//
+// Every write the API offers is idempotent, so the client retries all of
+// them – on network errors, per-attempt timeouts, 429 and 5xx responses –
+// with exponential backoff and full jitter. A create without an ID gets a
+// fresh Idempotency-Key that is reused by every retry, so a create whose
+// response was lost is never applied twice.
+//
+//	c := client.New("http://localhost:8080")
+//	c.APIKey = os.Getenv("API_KEY")
+//	res, err := c.Create(ctx, models.Chargeback{Amount: 500, Currency: "USD", Reason: "fraud"})
+//	if err != nil { ... }
+//	fmt.Println(res.Chargeback.ID, res.Replayed)
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/arkantrust/idempotency-example/backend/models"
+)
+
+// Client calls the chargebacks API. Its fields may be changed until the first
+// request.
+type Client struct {
+	// BaseURL is the server's address, e.g. "http://localhost:8080".
+	BaseURL string
+
+	// APIKey is sent as X-API-Key when set.
+	APIKey string
+
+	// Tenant is sent as X-Tenant-ID when set.
+	Tenant string
+
+	// HTTPClient sends the requests. Its Timeout, if any, bounds a single
+	// attempt.
+	HTTPClient *http.Client
+
+	// MaxRetries is how many times a failed attempt is retried.
+	MaxRetries int
+
+	// AttemptTimeout bounds each attempt, so a request that hangs is retried
+	// instead of waiting for the caller's deadline.
+	AttemptTimeout time.Duration
+
+	// MinBackoff and MaxBackoff bound the delay before a retry. The delay
+	// before retry n is uniformly random in [0, min(MaxBackoff,
+	// MinBackoff·2ⁿ)], or the server's Retry-After if that is longer.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	// NewKey generates idempotency keys for Create. The default generates
+	// ULIDs.
+	NewKey func() string
+}
+
+// New returns a client for the server at baseURL with the default retry
+// policy: 4 retries, 10s per attempt, backoff between 100ms and 5s.
+func New(baseURL string) *Client {
+	return &Client{
+		BaseURL:        baseURL,
+		HTTPClient:     http.DefaultClient,
+		MaxRetries:     4,
+		AttemptTimeout: 10 * time.Second,
+		MinBackoff:     100 * time.Millisecond,
+		MaxBackoff:     5 * time.Second,
+		NewKey:         models.NewID,
+	}
+}
+
+// Result is the outcome of a write.
+type Result struct {
+	Chargeback *models.Chargeback
+
+	// Replayed reports that the server did not write anything: a create
+	// found the record an earlier request made, or an update matched the
+	// stored data. The earlier request may have been an attempt of this
+	// same call whose response was lost.
+	Replayed bool
+
+	// Key is the idempotency key the create was sent with: the record ID
+	// for a create by ID, the generated or given Idempotency-Key otherwise.
+	// Keep it to retry a create that failed even after all attempts.
+	Key string
+
+	// Attempts is the number of requests sent.
+	Attempts int
+}
+
+// Error is a response the client did not retry, or the last response after
+// retries ran out.
+type Error struct {
+	StatusCode int
+	Message    string              `json:"error"`
+	Fields     []models.FieldError `json:"fields"`
+	RequestID  string              `json:"requestId"`
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("chargebacks API: %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	for _, f := range e.Fields {
+		msg += fmt.Sprintf("; %s: %s", f.Field, f.Message)
+	}
+	return msg
+}
+
+// IsNotFound reports whether err is a 404 from the API.
+func IsNotFound(err error) bool {
+	var e *Error
+	return errors.As(err, &e) && e.StatusCode == http.StatusNotFound
+}
+
+// Create creates a chargeback. With c.ID set the ID is the idempotency key,
+// as in POST /chargebacks/{id}; otherwise the server mints the ID and a
+// generated Idempotency-Key deduplicates the retries.
+func (c *Client) Create(ctx context.Context, cb models.Chargeback) (*Result, error) {
+	if cb.ID != "" {
+		return c.create(ctx, "/chargebacks/"+url.PathEscape(cb.ID), cb.ID, "", cb)
+	}
+	return c.CreateWithKey(ctx, c.NewKey(), cb)
+}
+
+// CreateWithKey creates a chargeback with a server-minted ID under the given
+// Idempotency-Key. Use it to resume a create with the Key of an earlier
+// Result, e.g. after a restart.
+func (c *Client) CreateWithKey(ctx context.Context, key string, cb models.Chargeback) (*Result, error) {
+	return c.create(ctx, "/chargebacks", key, key, cb)
+}
+
+func (c *Client) create(ctx context.Context, path, key, header string, cb models.Chargeback) (*Result, error) {
+	// Retries rely on getting the record back, whatever the server's
+	// duplicate policy.
+	h := http.Header{"Prefer": {"duplicate=replay"}}
+	if header != "" {
+		h.Set("Idempotency-Key", header)
+	}
+	res := &Result{Key: key, Chargeback: new(models.Chargeback)}
+	resp, err := c.do(ctx, http.MethodPost, path, h, body(cb), res.Chargeback, &res.Attempts)
+	if err != nil {
+		return nil, err
+	}
+	res.Replayed = resp.StatusCode == http.StatusOK
+	return res, nil
+}
+
+// Update replaces the chargeback id with cb, or only the given fields of it.
+// Updates are idempotent by nature: repeating one leaves the same state.
+func (c *Client) Update(ctx context.Context, id string, cb models.Chargeback, fields ...string) (*Result, error) {
+	h := http.Header{}
+	if len(fields) > 0 {
+		h.Set("X-Update-Mask", strings.Join(fields, ","))
+	}
+	res := &Result{Key: id, Chargeback: new(models.Chargeback)}
+	resp, err := c.do(ctx, http.MethodPut, "/chargebacks/"+url.PathEscape(id), h, body(cb), res.Chargeback, &res.Attempts)
+	if err != nil {
+		return nil, err
+	}
+	res.Replayed = resp.Header.Get("X-Idempotency-Write") == "false"
+	return res, nil
+}
+
+// Delete deletes the chargeback id. Deleting a missing record succeeds, so a
+// retried delete does too.
+func (c *Client) Delete(ctx context.Context, id string) error {
+	var attempts int
+	_, err := c.do(ctx, http.MethodDelete, "/chargebacks/"+url.PathEscape(id), nil, nil, nil, &attempts)
+	return err
+}
+
+// Get returns the chargeback id. IsNotFound reports a missing record.
+func (c *Client) Get(ctx context.Context, id string) (*models.Chargeback, error) {
+	var cb models.Chargeback
+	var attempts int
+	if _, err := c.do(ctx, http.MethodGet, "/chargebacks/"+url.PathEscape(id), nil, nil, &cb, &attempts); err != nil {
+		return nil, err
+	}
+	return &cb, nil
+}
+
+// List returns every chargeback visible to the caller.
+func (c *Client) List(ctx context.Context) ([]models.Chargeback, error) {
+	var items []models.Chargeback
+	var attempts int
+	_, err := c.do(ctx, http.MethodGet, "/chargebacks", nil, nil, &items, &attempts)
+	return items, err
+}
+
+// body is the writable part of a chargeback; the server owns the rest.
+func body(cb models.Chargeback) []byte {
+	data, _ := json.Marshal(struct {
+		Amount     int64  `json:"amount"`
+		Currency   string `json:"currency"`
+		Reason     string `json:"reason"`
+		ChargeID   string `json:"chargeId,omitempty"`
+		MerchantID string `json:"merchantId,omitempty"`
+	}{cb.Amount, cb.Currency, cb.Reason, cb.ChargeID, cb.MerchantID})
+	return data
+}
+
+// do sends the request, retrying until it gets a response that is neither
+// 429 nor 5xx, the retries run out, or ctx is done. A 2xx response is decoded
+// into out.
+func (c *Client) do(ctx context.Context, method, path string, header http.Header, data []byte, out any, attempts *int) (*http.Response, error) {
+	for {
+		*attempts++
+		resp, retryAfter, err := c.attempt(ctx, method, path, header, data, out)
+		if err == nil {
+			return resp, nil
+		}
+		if ctx.Err() != nil || !retryable(err) || *attempts > c.MaxRetries {
+			return nil, err
+		}
+
+		wait := c.backoff(*attempts - 1)
+		if retryAfter > wait {
+			wait = retryAfter
+		}
+		t := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return nil, err
+		case <-t.C:
+		}
+	}
+}
+
+// attempt sends the request once. It returns the server's Retry-After along
+// with a retryable error.
+func (c *Client) attempt(ctx context.Context, method, path string, header http.Header, data []byte, out any) (*http.Response, time.Duration, error) {
+	if c.AttemptTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.AttemptTimeout)
+		defer cancel()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimRight(c.BaseURL, "/")+path, bytes.NewReader(data))
+	if err != nil {
+		return nil, 0, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Accept", "application/json")
+	if data != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.APIKey != "" {
+		req.Header.Set("X-API-Key", c.APIKey)
+	}
+	if c.Tenant != "" {
+		req.Header.Set("X-Tenant-ID", c.Tenant)
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, 0, &transportError{err}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		e := &Error{StatusCode: resp.StatusCode}
+		json.NewDecoder(resp.Body).Decode(e) //nolint:errcheck // the status says enough
+		secs, _ := strconv.Atoi(resp.Header.Get("Retry-After"))
+		return nil, time.Duration(secs) * time.Second, e
+	}
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			// The body was cut off: the request may have been applied,
+			// which is exactly what retrying with the same key is for.
+			return nil, 0, &transportError{fmt.Errorf("reading response: %w", err)}
+		}
+	}
+	return resp, 0, nil
+}
+
+// transportError is a failure to get a complete response. The request may or
+// may not have reached the server.
+type transportError struct{ err error }
+
+func (e *transportError) Error() string { return e.err.Error() }
+func (e *transportError) Unwrap() error { return e.err }
+
+// retryable reports whether a failed attempt may succeed when repeated.
+func retryable(err error) bool {
+	var te *transportError
+	if errors.As(err, &te) {
+		return true
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+	}
+	return false
+}
+
+// backoff returns the full-jitter delay before retry n (counting from 0).
+func (c *Client) backoff(n int) time.Duration {
+	ceiling := c.MaxBackoff
+	if n < 32 {
+		if d := c.MinBackoff << n; d > 0 && d < ceiling {
+			ceiling = d
+		}
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+	return rand.N(ceiling + 1)
+}
@@ -0,0 +1,122 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/arkantrust/idempotency-example/backend/client"
+	"github.com/arkantrust/idempotency-example/backend/handlers"
+	"github.com/arkantrust/idempotency-example/backend/models"
+	"github.com/arkantrust/idempotency-example/backend/service"
+	"github.com/arkantrust/idempotency-example/backend/store"
+)
+
+// newTestServer serves the API and drops the responses of the first drops
+// requests after they were processed.
+func newTestServer(t *testing.T, drops int32) (*client.Client, *store.Store) {
+	t.Helper()
+	s, err := store.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to open test store: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+
+	h := handlers.New(s, service.NewChargebacks(s))
+	var n atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if n.Add(1) <= drops {
+			h.ServeHTTP(httptest.NewRecorder(), r)
+			panic(http.ErrAbortHandler)
+		}
+		h.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+
+	c := client.New(srv.URL)
+	c.MinBackoff, c.MaxBackoff = time.Millisecond, 5*time.Millisecond
+	return c, s
+}
+
+func TestCreateRetriesLostResponse(t *testing.T) {
+	c, s := newTestServer(t, 2)
+	ctx := context.Background()
+
+	res, err := c.Create(ctx, models.Chargeback{Amount: 500, Currency: "USD", Reason: "fraud"})
+	if err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+	if res.Attempts != 3 || !res.Replayed || res.Key == "" {
+		t.Fatalf("expected a replay on the third attempt with a key, got %+v", res)
+	}
+
+	// The first attempt created the record; the retries found it.
+	items, err := s.List(ctx)
+	if err != nil {
+		t.Fatalf("list failed: %v", err)
+	}
+	if len(items) != 1 || items[0].ID != res.Chargeback.ID {
+		t.Fatalf("expected exactly the returned record, got %+v", items)
+	}
+}
+
+func TestUpdateReportsSkippedWrite(t *testing.T) {
+	c, _ := newTestServer(t, 0)
+	ctx := context.Background()
+	cb := models.Chargeback{ID: "cb-1", Amount: 500, Currency: "USD", Reason: "fraud"}
+
+	if res, err := c.Create(ctx, cb); err != nil || res.Replayed || res.Key != "cb-1" {
+		t.Fatalf("expected a fresh create keyed by ID, got %+v %v", res, err)
+	}
+	cb.Reason = "not received"
+	if res, err := c.Update(ctx, "cb-1", cb); err != nil || res.Replayed {
+		t.Fatalf("expected the first update to write, got %+v %v", res, err)
+	}
+	if res, err := c.Update(ctx, "cb-1", cb); err != nil || !res.Replayed {
+		t.Fatalf("expected the repeated update to be skipped, got %+v %v", res, err)
+	}
+}
+
+func TestUpdateKeepsLinks(t *testing.T) {
+	c, s := newTestServer(t, 0)
+	ctx := context.Background()
+	if _, _, err := s.Charges().Create(ctx, &models.Charge{ID: "ch-1", Amount: 1000, Currency: "USD"}); err != nil {
+		t.Fatalf("create charge: %v", err)
+	}
+	if _, _, err := s.Merchants().Create(ctx, &models.Merchant{ID: "m-1", Name: "Shop"}); err != nil {
+		t.Fatalf("create merchant: %v", err)
+	}
+	cb := models.Chargeback{ID: "cb-1", Amount: 500, Currency: "USD", Reason: "fraud", ChargeID: "ch-1", MerchantID: "m-1"}
+	if _, err := c.Create(ctx, cb); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	cb.Reason = "not received"
+	res, err := c.Update(ctx, "cb-1", cb)
+	if err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if got := res.Chargeback; got.ChargeID != "ch-1" || got.MerchantID != "m-1" || got.Reason != "not received" {
+		t.Fatalf("links lost by the update: %+v", got)
+	}
+}
+
+func TestClientErrorsAreNotRetried(t *testing.T) {
+	c, _ := newTestServer(t, 0)
+	ctx := context.Background()
+
+	_, err := c.Create(ctx, models.Chargeback{Amount: -1, Currency: "USD", Reason: "fraud"})
+	var e *client.Error
+	if !errors.As(err, &e) || e.StatusCode != http.StatusUnprocessableEntity || len(e.Fields) == 0 {
+		t.Fatalf("expected a 422 with fields, got %v", err)
+	}
+
+	if _, err := c.Get(ctx, "missing"); !client.IsNotFound(err) {
+		t.Fatalf("expected not found, got %v", err)
+	}
+}
@@ -0,0 +1,281 @@
+// Command cbctl manages chargebacks from the command line.
+//
+// It talks to a running server over HTTP, or, with -db, opens the Bolt file
+// directly. Offline mode is for a stopped server: Bolt locks the file, so
+// cbctl cannot open the database while the server has it open.
+//
+// Usage:
+//
+//	cbctl [flags] <command> [args]
+//
+// Commands:
+//
+//	list                          list chargebacks
+//	get <id>                      show one chargeback
+//	create [-id ID | -key KEY] -amount N -currency C -reason R
+//	                              create a chargeback; see below
+//	delete <id>                   delete a chargeback
+//	stats                         count and amount per currency
+//	compact                       compact the database file
+//	verify                        check every record for corruption
+//	keys [prefix]                 inspect stored idempotency keys
+//	expire-key <key>              force-expire an idempotency key
+//	reconcile <file.csv>          reconcile a settlement file; see below
+//	replay                        replay recorded requests; see below
+//
+// create with -id uses the ID as the idempotency key, like POST
+// /chargebacks/{id}. Otherwise the server mints the ID and -key deduplicates
+// retries, like POST /chargebacks; without -key a fresh key is generated and
+// printed to stderr, so a create that failed ambiguously can be retried
+// safely with it.
+//
+// reconcile compares a processor's settlement CSV (columns id, amount,
+// currency) with the stored chargebacks and prints the missing, mismatched
+// and extra ones. Running the same file again prints the first report, with
+// the same ID; see package reconcile.
+//
+// replay re-sends the requests a server recorded with RECORD_REQUESTS to a
+// fresh database in a temporary directory, and prints the requests answered
+// differently and the records that differ from the recorded database's. It
+// needs -db, and exits non-zero when the states differ; see package replay.
+//
+// Flags fall back to environment variables: CBCTL_SERVER, CBCTL_API_KEY,
+// CBCTL_ADMIN_TOKEN, CBCTL_TENANT, CBCTL_DB and CBCTL_ENCRYPTION_KEYS, which
+// offline mode needs for a database written with field encryption. compact,
+// verify, keys, expire-key and reconcile are admin operations and need the
+// admin token online. verify exits non-zero when it finds damage. Output is
+// JSON.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/arkantrust/idempotency-example/backend/models"
+	"github.com/arkantrust/idempotency-example/backend/replay"
+	"github.com/arkantrust/idempotency-example/backend/store"
+)
+
+// backend is what the commands need, implemented over HTTP by remote and on
+// the Bolt file by offline.
+type backend interface {
+	List(ctx context.Context) ([]models.Chargeback, error)
+	Get(ctx context.Context, id string) (*models.Chargeback, error)
+
+	// Create creates c under its ID when it has one, and under a minted ID
+	// deduplicated by key otherwise.
+	Create(ctx context.Context, c *models.Chargeback, key string) (result *models.Chargeback, created bool, err error)
+	Delete(ctx context.Context, id string) error
+	Stats(ctx context.Context) (*models.Stats, error)
+	Compact(ctx context.Context) (store.CompactStats, error)
+	Verify(ctx context.Context) (store.VerifyReport, error)
+	Keys(ctx context.Context, prefix string) ([]store.KeyInfo, error)
+
+	// ExpireKey deletes key for every client of the tenant, returning how
+	// many entries it deleted.
+	ExpireKey(ctx context.Context, key string) (int, error)
+	Reconcile(ctx context.Context, file io.Reader) (report *models.Reconciliation, created bool, err error)
+	Close() error
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// errUsage reports a command line mistake; run prints the usage for it.
+var errUsage = errors.New("usage")
+
+func run(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("cbctl", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	server := fs.String("server", env("CBCTL_SERVER", "http://localhost:8080"), "server base URL")
+	apiKey := fs.String("api-key", os.Getenv("CBCTL_API_KEY"), "API key sent as X-API-Key")
+	adminToken := fs.String("admin-token", os.Getenv("CBCTL_ADMIN_TOKEN"), "admin bearer token, for compact, verify, keys, expire-key and reconcile")
+	tenant := fs.String("tenant", os.Getenv("CBCTL_TENANT"), "tenant to act on")
+	dbPath := fs.String("db", os.Getenv("CBCTL_DB"), "open this Bolt file instead of calling the server")
+	encryptionKeys := fs.String("encryption-keys", os.Getenv("CBCTL_ENCRYPTION_KEYS"), "the server's ENCRYPTION_KEYS, to read an encrypted Bolt file")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: cbctl [flags] list|get|create|delete|stats|compact|verify|keys|expire-key|reconcile|replay [args]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+	if *tenant != "" && !store.ValidTenant(*tenant) {
+		fmt.Fprintf(stderr, "cbctl: invalid tenant %q\n", *tenant)
+		return 2
+	}
+
+	var (
+		b   backend
+		err error
+	)
+	if *dbPath != "" {
+		b, err = openOffline(*dbPath, *encryptionKeys)
+	} else {
+		b = &remote{base: *server, apiKey: *apiKey, adminToken: *adminToken, tenant: *tenant}
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "cbctl: %v\n", err)
+		return 1
+	}
+	defer b.Close()
+
+	ctx := store.WithTenant(context.Background(), *tenant)
+	out, err := dispatch(ctx, b, fs.Arg(0), fs.Args()[1:], stderr)
+	switch {
+	case errors.Is(err, errUsage):
+		fs.Usage()
+		return 2
+	case err != nil:
+		fmt.Fprintf(stderr, "cbctl: %v\n", err)
+		return 1
+	}
+
+	enc := json.NewEncoder(stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(out); err != nil {
+		fmt.Fprintf(stderr, "cbctl: %v\n", err)
+		return 1
+	}
+	if report, ok := out.(store.VerifyReport); ok && !report.OK() {
+		return 1
+	}
+	if report, ok := out.(replay.Report); ok && !report.OK() {
+		return 1
+	}
+	return 0
+}
+
+// dispatch runs one command and returns what to print.
+func dispatch(ctx context.Context, b backend, cmd string, args []string, stderr io.Writer) (any, error) {
+	switch cmd {
+	case "list":
+		return b.List(ctx)
+	case "get":
+		if len(args) != 1 {
+			return nil, errUsage
+		}
+		return b.Get(ctx, args[0])
+	case "create":
+		return create(ctx, b, args, stderr)
+	case "delete":
+		if len(args) != 1 {
+			return nil, errUsage
+		}
+		if err := b.Delete(ctx, args[0]); err != nil {
+			return nil, err
+		}
+		return map[string]string{"deleted": args[0]}, nil
+	case "stats":
+		return b.Stats(ctx)
+	case "compact":
+		return b.Compact(ctx)
+	case "verify":
+		return b.Verify(ctx)
+	case "keys":
+		if len(args) > 1 {
+			return nil, errUsage
+		}
+		prefix := ""
+		if len(args) == 1 {
+			prefix = args[0]
+		}
+		return b.Keys(ctx, prefix)
+	case "expire-key":
+		if len(args) != 1 {
+			return nil, errUsage
+		}
+		n, err := b.ExpireKey(ctx, args[0])
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{"key": args[0], "expired": n}, nil
+	case "reconcile":
+		if len(args) != 1 {
+			return nil, errUsage
+		}
+		return reconcileFile(ctx, b, args[0], stderr)
+	case "replay":
+		if len(args) != 0 {
+			return nil, errUsage
+		}
+		return replayLog(ctx, b)
+	}
+	return nil, errUsage
+}
+
+func replayLog(ctx context.Context, b backend) (any, error) {
+	o, ok := b.(*offline)
+	if !ok {
+		return nil, errors.New("replay needs -db")
+	}
+	dir, err := os.MkdirTemp("", "cbctl-replay-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	return replay.Run(ctx, o.store, dir)
+}
+
+func reconcileFile(ctx context.Context, b backend, path string, stderr io.Writer) (any, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	report, created, err := b.Reconcile(ctx, f)
+	if err != nil {
+		return nil, err
+	}
+	if !created {
+		fmt.Fprintln(stderr, "replayed: this file was reconciled before; showing that report")
+	}
+	return report, nil
+}
+
+func create(ctx context.Context, b backend, args []string, stderr io.Writer) (any, error) {
+	fs := flag.NewFlagSet("create", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	id := fs.String("id", "", "client-chosen ID; it is the idempotency key")
+	key := fs.String("key", "", "idempotency key, when the server mints the ID")
+	amount := fs.Int64("amount", 0, "amount in minor currency units")
+	currency := fs.String("currency", "", "ISO 4217 currency code")
+	reason := fs.String("reason", "", "reason for the chargeback")
+	if err := fs.Parse(args); err != nil || fs.NArg() > 0 {
+		return nil, errUsage
+	}
+	if *id != "" && *key != "" {
+		return nil, errors.New("-id and -key are mutually exclusive")
+	}
+	if *id == "" && *key == "" {
+		*key = models.NewID()
+		fmt.Fprintf(stderr, "idempotency key: %s\n", *key)
+	}
+
+	c := &models.Chargeback{ID: *id, Amount: *amount, Currency: *currency, Reason: *reason}
+	result, created, err := b.Create(ctx, c, *key)
+	if err != nil {
+		return nil, err
+	}
+	if !created {
+		fmt.Fprintln(stderr, "replayed: the chargeback already existed and was not changed")
+	}
+	return result, nil
+}
+
+func env(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
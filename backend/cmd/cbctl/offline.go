@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"io"
+	"strings"
+
+	"github.com/arkantrust/idempotency-example/backend/models"
+	"github.com/arkantrust/idempotency-example/backend/reconcile"
+	"github.com/arkantrust/idempotency-example/backend/service"
+	"github.com/arkantrust/idempotency-example/backend/store"
+)
+
+// offline implements backend on the Bolt file. Writes go through the same
+// service as the server's, so validation and idempotency are unchanged;
+// there is no caller identity, so every owner's records are visible.
+type offline struct {
+	store *store.Store
+	svc   *service.Chargebacks
+}
+
+func openOffline(path, encryptionKeys string) (*offline, error) {
+	s, err := store.New(path)
+	if err != nil {
+		return nil, err
+	}
+	if encryptionKeys != "" {
+		keys, err := store.ParseKeys(strings.Split(encryptionKeys, ","))
+		if err != nil {
+			s.Close()
+			return nil, err
+		}
+		s.SetKeys(keys)
+	}
+	return &offline{store: s, svc: service.NewChargebacks(s)}, nil
+}
+
+func (o *offline) List(ctx context.Context) ([]models.Chargeback, error) {
+	return o.svc.List(ctx)
+}
+
+func (o *offline) Get(ctx context.Context, id string) (*models.Chargeback, error) {
+	return o.svc.Get(ctx, id)
+}
+
+func (o *offline) Create(ctx context.Context, c *models.Chargeback, key string) (*models.Chargeback, bool, error) {
+	if c.ID != "" {
+		return o.svc.Create(ctx, c)
+	}
+	return o.svc.CreateWithKey(ctx, key, c)
+}
+
+func (o *offline) Delete(ctx context.Context, id string) error {
+	_, err := o.svc.Delete(ctx, id)
+	return err
+}
+
+func (o *offline) Stats(ctx context.Context) (*models.Stats, error) {
+	return o.svc.Stats(ctx)
+}
+
+func (o *offline) Compact(ctx context.Context) (store.CompactStats, error) {
+	return o.store.Compact(ctx)
+}
+
+func (o *offline) Verify(ctx context.Context) (store.VerifyReport, error) {
+	return o.store.Verify(ctx)
+}
+
+func (o *offline) Keys(ctx context.Context, prefix string) ([]store.KeyInfo, error) {
+	keys, _, err := o.store.IdempotencyKeys(ctx, store.KeyQuery{Prefix: prefix})
+	return keys, err
+}
+
+func (o *offline) ExpireKey(ctx context.Context, key string) (int, error) {
+	return o.svc.ExpireKey(ctx, "", key, true)
+}
+
+func (o *offline) Reconcile(ctx context.Context, file io.Reader) (*models.Reconciliation, bool, error) {
+	return reconcile.Run(ctx, o.store, file)
+}
+
+func (o *offline) Close() error { return o.store.Close() }
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/arkantrust/idempotency-example/backend/models"
+	"github.com/arkantrust/idempotency-example/backend/store"
+)
+
+// remote implements backend with the server's HTTP API.
+type remote struct {
+	base       string
+	apiKey     string
+	adminToken string
+	tenant     string
+	client     http.Client
+}
+
+// apiError is a non-2xx response, with the server's error body.
+type apiError struct {
+	Status int                 `json:"-"`
+	Msg    string              `json:"error"`
+	Fields []models.FieldError `json:"fields"`
+}
+
+func (e *apiError) Error() string {
+	msg := fmt.Sprintf("%d %s", e.Status, http.StatusText(e.Status))
+	if e.Msg != "" {
+		msg += ": " + e.Msg
+	}
+	for _, f := range e.Fields {
+		msg += fmt.Sprintf("\n  %s: %s", f.Field, f.Message)
+	}
+	return msg
+}
+
+// do sends a request and decodes a JSON response into out, returning the
+// status code. body is sent as JSON, unless it is an io.Reader, which is sent
+// as is with the Content-Type in header. Admin requests carry the admin token
+// instead of the API key.
+func (r *remote) do(ctx context.Context, method, path string, header http.Header, body, out any) (int, error) {
+	resp, err := r.send(ctx, method, path, header, body, out)
+	if resp == nil {
+		return 0, err
+	}
+	return resp.StatusCode, err
+}
+
+// send is do returning the response, its body already read, for callers that
+// need its headers.
+func (r *remote) send(ctx context.Context, method, path string, header http.Header, body, out any) (*http.Response, error) {
+	var rd io.Reader
+	switch b := body.(type) {
+	case nil:
+	case io.Reader:
+		rd = b
+	default:
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		rd = bytes.NewReader(data)
+	}
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimRight(r.base, "/")+path, rd)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if body != nil && req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+	if strings.HasPrefix(path, "/admin/") {
+		if r.adminToken != "" {
+			req.Header.Set("Authorization", "Bearer "+r.adminToken)
+		}
+	} else {
+		if r.apiKey != "" {
+			req.Header.Set("X-API-Key", r.apiKey)
+		}
+		if r.tenant != "" {
+			req.Header.Set("X-Tenant-ID", r.tenant)
+		}
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		e := &apiError{Status: resp.StatusCode}
+		json.NewDecoder(resp.Body).Decode(e) //nolint:errcheck
+		return resp, e
+	}
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return resp, fmt.Errorf("invalid response: %w", err)
+		}
+	}
+	return resp, nil
+}
+
+func (r *remote) List(ctx context.Context) ([]models.Chargeback, error) {
+	var items []models.Chargeback
+	_, err := r.do(ctx, http.MethodGet, "/chargebacks", nil, nil, &items)
+	return items, err
+}
+
+func (r *remote) Get(ctx context.Context, id string) (*models.Chargeback, error) {
+	var c models.Chargeback
+	if _, err := r.do(ctx, http.MethodGet, "/chargebacks/"+url.PathEscape(id), nil, nil, &c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+func (r *remote) Create(ctx context.Context, c *models.Chargeback, key string) (*models.Chargeback, bool, error) {
+	path, header := "/chargebacks/"+url.PathEscape(c.ID), http.Header{"Prefer": {"duplicate=replay"}}
+	if c.ID == "" {
+		path = "/chargebacks"
+		header.Set("Idempotency-Key", key)
+	}
+	body := struct {
+		Amount   int64  `json:"amount"`
+		Currency string `json:"currency"`
+		Reason   string `json:"reason"`
+	}{c.Amount, c.Currency, c.Reason}
+	var result models.Chargeback
+	status, err := r.do(ctx, http.MethodPost, path, header, body, &result)
+	if err != nil {
+		return nil, false, err
+	}
+	return &result, status == http.StatusCreated, nil
+}
+
+func (r *remote) Delete(ctx context.Context, id string) error {
+	_, err := r.do(ctx, http.MethodDelete, "/chargebacks/"+url.PathEscape(id), nil, nil, nil)
+	return err
+}
+
+func (r *remote) Stats(ctx context.Context) (*models.Stats, error) {
+	var st models.Stats
+	if _, err := r.do(ctx, http.MethodGet, "/chargebacks/stats", nil, nil, &st); err != nil {
+		return nil, err
+	}
+	return &st, nil
+}
+
+func (r *remote) Compact(ctx context.Context) (store.CompactStats, error) {
+	var st store.CompactStats
+	_, err := r.do(ctx, http.MethodPost, "/admin/compact", nil, nil, &st)
+	return st, err
+}
+
+func (r *remote) Verify(ctx context.Context) (store.VerifyReport, error) {
+	var report store.VerifyReport
+	_, err := r.do(ctx, http.MethodGet, "/admin/verify", nil, nil, &report)
+	return report, err
+}
+
+// Keys asks the admin API, which is not tenant-scoped by header, for the
+// keys of r.tenant, a page at a time.
+func (r *remote) Keys(ctx context.Context, prefix string) ([]store.KeyInfo, error) {
+	q := url.Values{"limit": {"1000"}}
+	if r.tenant != "" {
+		q.Set("tenant", r.tenant)
+	}
+	if prefix != "" {
+		q.Set("prefix", prefix)
+	}
+	path := "/admin/idempotency-keys?" + q.Encode()
+	keys := []store.KeyInfo{}
+	for {
+		var page []store.KeyInfo
+		resp, err := r.send(ctx, http.MethodGet, path, nil, nil, &page)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, page...)
+		next := resp.Header.Get("X-Next-Cursor")
+		if next == "" {
+			return keys, nil
+		}
+		q.Set("cursor", next)
+		path = "/admin/idempotency-keys?" + q.Encode()
+	}
+}
+
+// ExpireKey deletes key, of every client, through the admin API.
+func (r *remote) ExpireKey(ctx context.Context, key string) (int, error) {
+	path := "/admin/idempotency-keys/" + url.PathEscape(key)
+	if r.tenant != "" {
+		path += "?tenant=" + url.QueryEscape(r.tenant)
+	}
+	var body struct {
+		Expired int `json:"expired"`
+	}
+	_, err := r.do(ctx, http.MethodDelete, path, nil, nil, &body)
+	return body.Expired, err
+}
+
+// Reconcile posts the settlement file to the admin API for r.tenant.
+func (r *remote) Reconcile(ctx context.Context, file io.Reader) (*models.Reconciliation, bool, error) {
+	path := "/admin/reconciliations"
+	if r.tenant != "" {
+		path += "?tenant=" + url.QueryEscape(r.tenant)
+	}
+	var report models.Reconciliation
+	status, err := r.do(ctx, http.MethodPost, path, http.Header{"Content-Type": {"text/csv"}}, file, &report)
+	if err != nil {
+		return nil, false, err
+	}
+	return &report, status == http.StatusCreated, nil
+}
+
+func (r *remote) Close() error { return nil }
@@ -0,0 +1,353 @@
+// Command loadtest hammers a running server with retried requests and then
+// checks that the data is exactly what an idempotent API promises.
+//
+// Usage:
+//
+//	go run ./cmd/loadtest -server http://localhost:8080 -records 500 -concurrency 32
+//
+// Every logical operation – a create by ID, a create with an Idempotency-Key,
+// or an update – is sent -duplicates times concurrently, and a -cancel
+// fraction of the requests are cancelled after a random delay of up to
+// -cancel-after, so some of them are abandoned after the server committed
+// and some before. Then each operation is retried once more until it
+// succeeds, as a client recovering from an ambiguous failure would.
+//
+// Finally the harness verifies that:
+//
+//   - exactly one record exists per logical create, however many times it
+//     was sent or abandoned;
+//   - every response to the same Idempotency-Key named the same record;
+//   - every record holds the content of its last update, or of its create
+//     if it had none.
+//
+// The run uses a fresh tenant (-tenant overrides it) so that existing data
+// does not affect the counts. Naming a tenant takes an API key bound to it,
+// in -api-key. The exit status is 1 if verification fails.
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/arkantrust/idempotency-example/backend/models"
+)
+
+type config struct {
+	server, apiKey, tenant string
+	records, concurrency   int
+	duplicates             int
+	cancel                 float64
+	cancelAfter            time.Duration
+}
+
+func main() {
+	var cfg config
+	flag.StringVar(&cfg.server, "server", "http://localhost:8080", "server base URL")
+	flag.StringVar(&cfg.apiKey, "api-key", os.Getenv("LOADTEST_API_KEY"), "API key sent as X-API-Key")
+	flag.StringVar(&cfg.tenant, "tenant", "", "tenant to use; default is a fresh one per run")
+	flag.IntVar(&cfg.records, "records", 200, "logical records to create")
+	flag.IntVar(&cfg.concurrency, "concurrency", 16, "concurrent requests")
+	flag.IntVar(&cfg.duplicates, "duplicates", 3, "times each operation is sent")
+	flag.Float64Var(&cfg.cancel, "cancel", 0.2, "fraction of requests cancelled mid-flight")
+	flag.DurationVar(&cfg.cancelAfter, "cancel-after", 5*time.Millisecond, "longest delay before cancelling a request")
+	flag.Parse()
+
+	if cfg.records < 1 || cfg.concurrency < 1 || cfg.duplicates < 1 || cfg.cancel < 0 || cfg.cancel > 1 {
+		fmt.Fprintln(os.Stderr, "loadtest: -records, -concurrency and -duplicates must be positive and -cancel between 0 and 1")
+		os.Exit(2)
+	}
+	if cfg.tenant == "" {
+		cfg.tenant = "loadtest-" + strings.ToLower(models.NewID())
+	}
+
+	if err := run(cfg); err != nil {
+		fmt.Fprintf(os.Stderr, "loadtest: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// op is one logical operation. Sending it any number of times must have the
+// effect of sending it once.
+type op struct {
+	kind string // "create", "create-key" or "update"
+	id   string // record ID; for create-key, filled in from the response
+	key  string // Idempotency-Key, for create-key
+	body models.Chargeback
+}
+
+// result is the outcome of one request.
+type result struct {
+	op        *op
+	status    int // 0 when the request failed or was cancelled
+	cancelled bool
+	id        string // ID of the record in the response
+}
+
+type client struct {
+	cfg  config
+	http *http.Client
+}
+
+// send sends o once. cancel, when positive, abandons the request after that
+// delay.
+func (c *client) send(o *op, cancel time.Duration) result {
+	ctx, stop := context.WithTimeout(context.Background(), 30*time.Second)
+	defer stop()
+	if cancel > 0 {
+		var stopCancel context.CancelFunc
+		ctx, stopCancel = context.WithTimeout(ctx, cancel)
+		defer stopCancel()
+	}
+
+	method, path := http.MethodPost, "/chargebacks/"+o.id
+	switch o.kind {
+	case "create-key":
+		path = "/chargebacks"
+	case "update":
+		method = http.MethodPut
+	}
+	data, _ := json.Marshal(map[string]any{"amount": o.body.Amount, "currency": o.body.Currency, "reason": o.body.Reason})
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimRight(c.cfg.server, "/")+path, bytes.NewReader(data))
+	if err != nil {
+		return result{op: o}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Tenant-ID", c.cfg.tenant)
+	if c.cfg.apiKey != "" {
+		req.Header.Set("X-API-Key", c.cfg.apiKey)
+	}
+	if o.key != "" {
+		req.Header.Set("Idempotency-Key", o.key)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return result{op: o, cancelled: errors.Is(err, context.DeadlineExceeded) && cancel > 0}
+	}
+	defer resp.Body.Close()
+	var got models.Chargeback
+	if err := json.NewDecoder(resp.Body).Decode(&got); err != nil && resp.StatusCode < 300 {
+		return result{op: o, cancelled: cancel > 0}
+	}
+	return result{op: o, status: resp.StatusCode, id: got.ID}
+}
+
+func run(cfg config) error {
+	c := &client{cfg: cfg, http: &http.Client{Transport: &http.Transport{MaxIdleConnsPerHost: cfg.concurrency}}}
+	creates, updates := plan(cfg.records)
+
+	fmt.Printf("tenant %s: %d creates and %d updates, each sent %d times by %d workers, %.0f%% cancelled\n",
+		cfg.tenant, len(creates), len(updates), cfg.duplicates, cfg.concurrency, cfg.cancel*100)
+	start := time.Now()
+
+	// Phase 1: every operation, duplicated and interleaved, some abandoned.
+	var jobs []*op
+	for _, o := range append(append([]*op{}, creates...), updates...) {
+		for range cfg.duplicates {
+			jobs = append(jobs, o)
+		}
+	}
+	rand.Shuffle(len(jobs), func(i, j int) { jobs[i], jobs[j] = jobs[j], jobs[i] })
+	results := c.fire(jobs, cfg.cancel)
+
+	// Phase 2: retry every operation until it succeeds, creates first so
+	// that updates have something to update.
+	results = append(results, c.settle(creates)...)
+	results = append(results, c.settle(updates)...)
+	elapsed := time.Since(start)
+
+	report(results, elapsed)
+	return verify(c, creates, updates, results)
+}
+
+// plan returns the creates, half by ID and half by Idempotency-Key, and an
+// update for every other create by ID.
+func plan(n int) (creates, updates []*op) {
+	reasons := []string{"fraud", "not received", "duplicate charge", "not as described"}
+	currencies := []string{"USD", "EUR", "GBP"}
+	for i := range n {
+		body := models.Chargeback{Amount: int64(100 + i), Currency: currencies[i%len(currencies)], Reason: reasons[i%len(reasons)]}
+		if i%2 == 1 {
+			creates = append(creates, &op{kind: "create-key", key: fmt.Sprintf("lt-key-%05d", i), body: body})
+			continue
+		}
+		o := &op{kind: "create", id: fmt.Sprintf("lt-%05d", i), body: body}
+		creates = append(creates, o)
+		if i%4 == 0 {
+			changed := body
+			changed.Reason += " (updated)"
+			updates = append(updates, &op{kind: "update", id: o.id, body: changed})
+		}
+	}
+	return creates, updates
+}
+
+// fire sends jobs with cfg.concurrency workers, cancelling a fraction of
+// them.
+func (c *client) fire(jobs []*op, cancelRate float64) []result {
+	var (
+		mu      sync.Mutex
+		results []result
+		next    atomic.Int64
+		wg      sync.WaitGroup
+	)
+	for range c.cfg.concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				i := int(next.Add(1)) - 1
+				if i >= len(jobs) {
+					return
+				}
+				var cancel time.Duration
+				if rand.Float64() < cancelRate {
+					cancel = time.Duration(rand.Int64N(int64(c.cfg.cancelAfter))) + 1
+				}
+				r := c.send(jobs[i], cancel)
+				mu.Lock()
+				results = append(results, r)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+// settle retries each operation until the server answers it with a 2xx
+// status, up to a few times.
+func (c *client) settle(ops []*op) []result {
+	var results []result
+	for _, o := range ops {
+		for attempt := 0; attempt < 5; attempt++ {
+			r := c.send(o, 0)
+			results = append(results, r)
+			if r.status >= 200 && r.status < 300 {
+				break
+			}
+			time.Sleep(time.Duration(attempt+1) * 50 * time.Millisecond)
+		}
+	}
+	return results
+}
+
+func report(results []result, elapsed time.Duration) {
+	byOutcome := map[string]int{}
+	for _, r := range results {
+		switch {
+		case r.cancelled:
+			byOutcome[r.op.kind+" cancelled"]++
+		case r.status == 0:
+			byOutcome[r.op.kind+" failed"]++
+		default:
+			byOutcome[fmt.Sprintf("%s %d", r.op.kind, r.status)]++
+		}
+	}
+	keys := make([]string, 0, len(byOutcome))
+	for k := range byOutcome {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	fmt.Printf("%d requests in %v (%.0f/s)\n", len(results), elapsed.Round(time.Millisecond), float64(len(results))/elapsed.Seconds())
+	for _, k := range keys {
+		fmt.Printf("  %-22s %d\n", k, byOutcome[k])
+	}
+}
+
+// verify checks the end state against the plan.
+func verify(c *client, creates, updates []*op, results []result) error {
+	var problems []string
+	fail := func(format string, args ...any) {
+		if len(problems) < 20 {
+			problems = append(problems, fmt.Sprintf(format, args...))
+		}
+	}
+
+	// Every answered request for one key must name the same record.
+	keyIDs := map[*op]string{}
+	for _, r := range results {
+		if r.op.kind != "create-key" || r.status < 200 || r.status >= 300 {
+			continue
+		}
+		if prev, ok := keyIDs[r.op]; ok && prev != r.id {
+			fail("key %s returned records %s and %s", r.op.key, prev, r.id)
+		}
+		keyIDs[r.op] = r.id
+	}
+
+	expected := map[string]models.Chargeback{}
+	for _, o := range creates {
+		id := o.id
+		if o.kind == "create-key" {
+			if id = keyIDs[o]; id == "" {
+				fail("key %s never succeeded", o.key)
+				continue
+			}
+		}
+		expected[id] = o.body
+	}
+	for _, o := range updates {
+		expected[o.id] = o.body
+	}
+
+	items, err := c.list()
+	if err != nil {
+		return err
+	}
+	if len(items) != len(creates) {
+		fail("expected %d records, found %d", len(creates), len(items))
+	}
+	for _, got := range items {
+		want, ok := expected[got.ID]
+		if !ok {
+			fail("unexpected record %s", got.ID)
+			continue
+		}
+		if got.Amount != want.Amount || got.Currency != want.Currency || got.Reason != want.Reason {
+			fail("record %s is {%d %s %q}, want {%d %s %q}", got.ID, got.Amount, got.Currency, got.Reason, want.Amount, want.Currency, want.Reason)
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("verification FAILED:\n  %s", strings.Join(problems, "\n  "))
+	}
+	fmt.Printf("verification passed: %d records, each created once with its final content\n", len(items))
+	return nil
+}
+
+func (c *client) list() ([]models.Chargeback, error) {
+	req, err := http.NewRequest(http.MethodGet, strings.TrimRight(c.cfg.server, "/")+"/chargebacks", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Tenant-ID", c.cfg.tenant)
+	if c.cfg.apiKey != "" {
+		req.Header.Set("X-API-Key", c.cfg.apiKey)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("listing records: %d %s", resp.StatusCode, body)
+	}
+	var items []models.Chargeback
+	return items, json.NewDecoder(resp.Body).Decode(&items)
+}
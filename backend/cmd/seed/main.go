@@ -0,0 +1,146 @@
+// Command seed fills a database with realistic demo chargebacks, for the
+// frontend and for benchmarks.
+//
+// Usage:
+//
+//	go run ./cmd/seed -db chargebacks.db -n 500
+//
+// Seeding is idempotent: records get the IDs seed-00001, seed-00002, … and
+// are inserted with Create semantics, so running the seeder again creates
+// nothing, and running it with a larger -n only adds the missing records.
+// The content of each record is derived from -seed and its index, so the
+// same flags always describe the same data; only the creation times move, as
+// they are spread over the days before now.
+//
+// The seeder opens the Bolt file directly; stop the server first, as Bolt
+// allows a single process to hold the file open.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"os"
+	"time"
+
+	"github.com/arkantrust/idempotency-example/backend/models"
+	"github.com/arkantrust/idempotency-example/backend/store"
+)
+
+// batchSize is the number of records committed per transaction.
+const batchSize = 500
+
+// currencies are weighted roughly by how often they appear in card disputes.
+var currencies = []struct {
+	code   string
+	weight int
+	scale  int64 // minor units per major unit
+}{
+	{"USD", 45, 100}, {"EUR", 20, 100}, {"GBP", 10, 100}, {"CAD", 6, 100},
+	{"AUD", 5, 100}, {"BRL", 5, 100}, {"MXN", 4, 100}, {"JPY", 5, 1},
+}
+
+var reasons = []string{
+	"Fraudulent transaction – card not present",
+	"Fraudulent transaction – card present",
+	"Merchandise not received",
+	"Product not as described",
+	"Duplicate charge",
+	"Subscription cancelled but still billed",
+	"Credit not processed",
+	"Incorrect amount charged",
+	"Unrecognised charge",
+	"Services not rendered",
+	"Defective merchandise",
+	"Paid by other means",
+}
+
+func main() {
+	db := flag.String("db", env("DB_PATH", "chargebacks.db"), "Bolt file to seed")
+	n := flag.Int("n", 200, "number of chargebacks")
+	seed := flag.Uint64("seed", 1, "random seed; the same seed generates the same records")
+	days := flag.Int("days", 180, "spread creation times over this many past days")
+	tenant := flag.String("tenant", "", "tenant to seed")
+	flag.Parse()
+
+	if *n < 0 || *days < 1 {
+		fmt.Fprintln(os.Stderr, "seed: -n must not be negative and -days must be at least 1")
+		os.Exit(2)
+	}
+	if *tenant != "" && !store.ValidTenant(*tenant) {
+		fmt.Fprintf(os.Stderr, "seed: invalid tenant %q\n", *tenant)
+		os.Exit(2)
+	}
+
+	s, err := store.New(*db)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "seed: %v\n", err)
+		os.Exit(1)
+	}
+	defer s.Close()
+
+	ctx := store.WithTenant(context.Background(), *tenant)
+	now := time.Now().UTC()
+	var created, skipped int
+	for start := 0; start < *n; start += batchSize {
+		batch := make([]*models.Chargeback, 0, batchSize)
+		for i := start; i < min(start+batchSize, *n); i++ {
+			batch = append(batch, generate(*seed, i, now, *days))
+		}
+		res, err := s.CreateMany(ctx, batch)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "seed: %v\n", err)
+			os.Exit(1)
+		}
+		for i, err := range res.Failed {
+			fmt.Fprintf(os.Stderr, "seed: %s: %v\n", batch[i].ID, err)
+			os.Exit(1)
+		}
+		created += len(res.Created)
+		skipped += res.Skipped
+	}
+	fmt.Printf("seeded %s: %d created, %d already present\n", *db, created, skipped)
+}
+
+// generate returns the i-th demo chargeback. Each record has its own random
+// source, so record i is the same whatever -n is.
+func generate(seed uint64, i int, now time.Time, days int) *models.Chargeback {
+	r := rand.New(rand.NewPCG(seed, uint64(i)))
+
+	total := 0
+	for _, c := range currencies {
+		total += c.weight
+	}
+	pick := r.IntN(total)
+	cur := currencies[0]
+	for _, c := range currencies {
+		if pick < c.weight {
+			cur = c
+			break
+		}
+		pick -= c.weight
+	}
+
+	// Most disputes are small; a few are large. A log-uniform amount between
+	// 5 and 5000 major units gives that shape.
+	major := 5 * math.Pow(1000, r.Float64())
+	amount := int64(major*float64(cur.scale)) + 1
+
+	age := time.Duration(r.Int64N(int64(days) * int64(24*time.Hour)))
+	return &models.Chargeback{
+		ID:        fmt.Sprintf("seed-%05d", i+1),
+		Amount:    amount,
+		Currency:  cur.code,
+		Reason:    reasons[r.IntN(len(reasons))],
+		CreatedAt: now.Add(-age).Truncate(time.Second),
+	}
+}
+
+func env(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
@@ -0,0 +1,1363 @@
+// Package config loads server settings from a YAML file, environment
+// variables and command-line flags.
+//
+// Precedence, lowest to highest:
+//
+//  1. built-in defaults (see Default)
+//  2. the YAML file named by -config or CONFIG_FILE
+//  3. environment variables
+//  4. command-line flags
+//
+// Every setting has a flag and an environment variable; the full list is
+// printed by -help. The YAML keys mirror the Config struct tags, see
+// config.example.yaml for an annotated file.
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/netip"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/arkantrust/idempotency-example/backend/cron"
+	"github.com/arkantrust/idempotency-example/backend/models"
+	"github.com/arkantrust/idempotency-example/backend/money"
+)
+
+// Config holds every tunable of the server.
+type Config struct {
+	// Port is the TCP port the HTTP server listens on.
+	Port string `yaml:"port"`
+
+	// GRPCPort, when set, starts the gRPC server on this TCP port alongside
+	// the HTTP server.
+	GRPCPort string `yaml:"grpcPort"`
+
+	// DBPath is the location of the BoltDB file.
+	DBPath string `yaml:"dbPath"`
+
+	// DBEncoding is how new and updated records are stored: "json",
+	// "msgpack" or "protobuf". Records written with another encoding stay
+	// readable; POST /admin/reencode converts them.
+	DBEncoding string `yaml:"dbEncoding"`
+
+	// Bolt tunes how the database file is written.
+	Bolt BoltConfig `yaml:"bolt"`
+
+	// DBTimeout bounds how long an operation waits for the database before
+	// it fails with 503; 0 waits as long as the request does.
+	DBTimeout time.Duration `yaml:"dbTimeout"`
+
+	// MigrateOnStart rewrites every record stored with an older schema
+	// version or another encoding before the server starts. Without it,
+	// records are upgraded as they are read and written.
+	MigrateOnStart bool `yaml:"migrateOnStart"`
+
+	// RecordRequests appends every API request, with the status it got, to
+	// the database's request log, for cbctl replay to re-send to a fresh
+	// database.
+	RecordRequests bool `yaml:"recordRequests"`
+
+	// Plugins names the compiled-in plugins to enable, in order; see
+	// service.RegisterPlugin.
+	Plugins []string `yaml:"plugins"`
+
+	// Restore, when set, names a snapshot that replaces the database before
+	// the server starts. It is only settable by flag: a restore is a one-off
+	// operation, not something to leave in a config file.
+	Restore string `yaml:"-"`
+
+	// BenchServer, when set, benchmarks the storage strategies next to
+	// DBPath, prints a report and exits instead of serving. Like Restore it
+	// is only settable by flag.
+	BenchServer bool `yaml:"-"`
+
+	Log         LogConfig         `yaml:"log"`
+	Server      ServerConfig      `yaml:"server"`
+	TLS         TLSConfig         `yaml:"tls"`
+	CORS        CORSConfig        `yaml:"cors"`
+	Security    SecurityConfig    `yaml:"security"`
+	Network     NetworkConfig     `yaml:"network"`
+	Signing     SigningConfig     `yaml:"signing"`
+	Auth        AuthConfig        `yaml:"auth"`
+	Idempotency IdempotencyConfig `yaml:"idempotency"`
+	RateLimit   RateLimitConfig   `yaml:"rateLimit"`
+	Quota       QuotaConfig       `yaml:"quota"`
+	Concurrency ConcurrencyConfig `yaml:"concurrency"`
+	LoadShed    LoadShedConfig    `yaml:"loadShed"`
+	Chaos       ChaosConfig       `yaml:"chaos"`
+	Tracing     TracingConfig     `yaml:"tracing"`
+	Debug       DebugConfig       `yaml:"debug"`
+	Backup      BackupConfig      `yaml:"backup"`
+	Compaction  CompactionConfig  `yaml:"compaction"`
+	Retention   RetentionConfig   `yaml:"retention"`
+	Encryption  EncryptionConfig  `yaml:"encryption"`
+	Batch       BatchConfig       `yaml:"batch"`
+	Retry       RetryConfig       `yaml:"retry"`
+	Breaker     BreakerConfig     `yaml:"breaker"`
+	Jobs        JobsConfig        `yaml:"jobs"`
+	Webhook     WebhookConfig     `yaml:"webhook"`
+	Rates       RatesConfig       `yaml:"rates"`
+	Policy      PolicyConfig      `yaml:"policy"`
+	Mode        ModeConfig        `yaml:"mode"`
+	Raft        RaftConfig        `yaml:"raft"`
+	Shadow      ShadowConfig      `yaml:"shadow"`
+}
+
+// LogConfig selects the log output format and minimum level.
+type LogConfig struct {
+	// Format is "text" or "json".
+	Format string `yaml:"format"`
+
+	// Level is one of "debug", "info", "warn" or "error".
+	Level string `yaml:"level"`
+}
+
+// ServerConfig holds HTTP server limits. The defaults are chosen so that a
+// client trickling bytes one at a time (slow-loris) cannot hold a connection
+// open indefinitely.
+type ServerConfig struct {
+	ReadHeaderTimeout time.Duration `yaml:"readHeaderTimeout"`
+	ReadTimeout       time.Duration `yaml:"readTimeout"`
+
+	// WriteTimeout bounds the whole response, including streamed exports and
+	// backups; raise it when exporting very large databases.
+	WriteTimeout time.Duration `yaml:"writeTimeout"`
+
+	IdleTimeout    time.Duration `yaml:"idleTimeout"`
+	MaxHeaderBytes int           `yaml:"maxHeaderBytes"`
+
+	// MaxBodyBytes limits JSON request bodies. Larger bodies are rejected
+	// with 413 before they are decoded.
+	MaxBodyBytes int `yaml:"maxBodyBytes"`
+
+	// MaxUploadBytes limits evidence documents uploaded to a chargeback.
+	MaxUploadBytes int `yaml:"maxUploadBytes"`
+
+	// StrictJSON rejects JSON bodies with unknown fields or duplicate keys.
+	// Clients can also opt in per request with "X-Strict-JSON: true".
+	StrictJSON bool `yaml:"strictJSON"`
+
+	// DeleteStatus is the status of a successful single-record DELETE: 200
+	// with a body naming the deleted ID, or 204 with none.
+	DeleteStatus int `yaml:"deleteStatus"`
+
+	// DuplicateStatus is the status of a POST that repeats a create that
+	// already succeeded: 200 replaying the record, or 409 pointing at it.
+	// Clients can choose per request with "Prefer: duplicate=...".
+	DuplicateStatus int `yaml:"duplicateStatus"`
+
+	// AsyncWorkers is the number of background workers running the creates
+	// of clients sending "Prefer: respond-async". Zero disables
+	// asynchronous creates: the preference is ignored.
+	AsyncWorkers int `yaml:"asyncWorkers"`
+
+	// ShutdownDrainDelay is how long the server keeps serving with readiness
+	// reporting 503 before it starts a graceful shutdown.
+	ShutdownDrainDelay time.Duration `yaml:"shutdownDrainDelay"`
+}
+
+// TLSConfig enables HTTPS. Setting CertFile and KeyFile serves a static
+// certificate; setting AutocertHost obtains one from Let's Encrypt instead.
+// With neither, the server speaks plain HTTP.
+type TLSConfig struct {
+	CertFile string `yaml:"certFile"`
+	KeyFile  string `yaml:"keyFile"`
+
+	// AutocertHost is the hostname to request a certificate for. The server
+	// must be reachable on port 443 under that name for the TLS-ALPN-01
+	// challenge to succeed.
+	AutocertHost string `yaml:"autocertHost"`
+
+	// AutocertDir caches obtained certificates across restarts, which keeps
+	// the server clear of Let's Encrypt rate limits.
+	AutocertDir string `yaml:"autocertDir"`
+
+	// ClientCAFile enables mTLS: clients must present a certificate signed
+	// by one of the CAs in this PEM file. With AutocertHost, Let's Encrypt's
+	// TLS-ALPN-01 handshakes are exempt; they serve no request.
+	ClientCAFile string `yaml:"clientCAFile"`
+}
+
+// Enabled reports whether the server should listen with TLS.
+func (c TLSConfig) Enabled() bool { return c.CertFile != "" || c.AutocertHost != "" }
+
+// CORSConfig controls cross-origin access from browsers.
+type CORSConfig struct {
+	// AllowedOrigins lists origins allowed to call the API. "*" allows any;
+	// "https://*.example.com" allows any subdomain. The default allows none:
+	// the bundled frontend is served from the API's own origin.
+	AllowedOrigins []string `yaml:"allowedOrigins"`
+
+	// AllowCredentials lets browsers send cookies and Authorization headers
+	// from the listed origins. It cannot be combined with "*".
+	AllowCredentials bool `yaml:"allowCredentials"`
+
+	// MaxAge is how long browsers may cache preflight responses.
+	MaxAge time.Duration `yaml:"maxAge"`
+}
+
+// SecurityConfig sets the security headers sent on every HTTP response.
+type SecurityConfig struct {
+	// HSTSMaxAge is the Strict-Transport-Security max-age, sent only over
+	// TLS. Zero omits the header.
+	HSTSMaxAge time.Duration `yaml:"hstsMaxAge"`
+
+	// ReferrerPolicy is the Referrer-Policy. Empty omits it.
+	ReferrerPolicy string `yaml:"referrerPolicy"`
+
+	// ContentSecurityPolicy is the Content-Security-Policy of the API, the
+	// docs included. Empty omits it.
+	ContentSecurityPolicy string `yaml:"contentSecurityPolicy"`
+
+	// FrontendContentSecurityPolicy replaces it on the frontend's routes,
+	// which load scripts, styles and images from the server's origin.
+	FrontendContentSecurityPolicy string `yaml:"frontendContentSecurityPolicy"`
+}
+
+// NetworkConfig controls which addresses may reach the HTTP server and how
+// the client's address is found behind proxies. Entries are CIDRs such as
+// "10.0.0.0/8" or single addresses.
+type NetworkConfig struct {
+	// TrustedProxies lists the proxies whose X-Forwarded-For names the
+	// client. Requests from anywhere else are their own client.
+	TrustedProxies []string `yaml:"trustedProxies"`
+
+	// Allow, when not empty, lists the only clients served.
+	Allow []string `yaml:"allow"`
+
+	// Deny lists clients refused even when Allow lists them.
+	Deny []string `yaml:"deny"`
+}
+
+// Prefixes returns TrustedProxies, Allow and Deny parsed.
+func (n NetworkConfig) Prefixes() (trusted, allow, deny []netip.Prefix, err error) {
+	if trusted, err = parsePrefixes("trusted proxy", n.TrustedProxies); err != nil {
+		return nil, nil, nil, err
+	}
+	if allow, err = parsePrefixes("allowed client", n.Allow); err != nil {
+		return nil, nil, nil, err
+	}
+	if deny, err = parsePrefixes("denied client", n.Deny); err != nil {
+		return nil, nil, nil, err
+	}
+	return trusted, allow, deny, nil
+}
+
+// parsePrefixes parses CIDRs, taking a single address as the prefix of just
+// that address.
+func parsePrefixes(what string, list []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(list))
+	for _, s := range list {
+		if addr, err := netip.ParseAddr(s); err == nil {
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		p, err := netip.ParsePrefix(s)
+		if err != nil {
+			return nil, fmt.Errorf("%s %q is not an address or CIDR", what, s)
+		}
+		prefixes = append(prefixes, p.Masked())
+	}
+	return prefixes, nil
+}
+
+// SigningConfig requires API requests to be signed with a shared secret
+// (see middleware.VerifySignature). An empty Secret disables it.
+type SigningConfig struct {
+	// Secret is the HMAC key requests are signed with.
+	Secret string `yaml:"secret"`
+
+	// MaxSkew is how far a request's signature timestamp may be from the
+	// server's clock. Nonces are remembered for as long.
+	MaxSkew time.Duration `yaml:"maxSkew"`
+}
+
+// Enabled reports whether requests must be signed.
+func (c SigningConfig) Enabled() bool { return c.Secret != "" }
+
+// AuthConfig controls client authentication.
+type AuthConfig struct {
+	// Required rejects API requests without a valid X-API-Key or bearer
+	// token. When false, credentials are still validated if sent, but
+	// anonymous access is allowed.
+	Required bool `yaml:"required"`
+
+	// AdminToken guards the /admin endpoints (key management, backup,
+	// compaction), which also admit credentials with the admin role. When
+	// it is empty and authentication is also disabled, they are open for
+	// local development.
+	AdminToken string `yaml:"adminToken"`
+
+	// JWT enables bearer token authentication when its Secret or JWKSURL is
+	// set.
+	JWT JWTConfig `yaml:"jwt"`
+}
+
+// JWTConfig controls validation of JWT bearer tokens.
+type JWTConfig struct {
+	// Secret verifies HMAC-signed tokens. Mutually exclusive with JWKSURL.
+	Secret string `yaml:"secret"`
+
+	// JWKSURL is where the identity provider publishes its signing keys.
+	JWKSURL string `yaml:"jwksURL"`
+
+	// Issuer and Audience, when set, must match the token's claims.
+	Issuer   string `yaml:"issuer"`
+	Audience string `yaml:"audience"`
+}
+
+// Enabled reports whether bearer tokens are accepted.
+func (c JWTConfig) Enabled() bool { return c.Secret != "" || c.JWKSURL != "" }
+
+// IdempotencyConfig controls which client-generated idempotency keys are
+// accepted when creating records, and how long they are honoured.
+type IdempotencyConfig struct {
+	// KeyFormat is "any", "uuid" (version 4) or "ulid".
+	KeyFormat string `yaml:"keyFormat"`
+
+	// KeyPattern is a regular expression keys must match. It overrides
+	// KeyFormat when set.
+	KeyPattern string `yaml:"keyPattern"`
+
+	// KeyTTL is how long an Idempotency-Key is honoured after its first
+	// use; a later request with it is new. Zero keeps keys forever. Keys
+	// used as record IDs never expire: the record is the key.
+	KeyTTL time.Duration `yaml:"keyTTL"`
+
+	// Strict requires an Idempotency-Key on every write route and replays
+	// the saved response to it, following the IETF Idempotency-Key header
+	// draft, instead of deriving idempotency from record IDs.
+	Strict bool `yaml:"strict"`
+
+	// SweepSchedule is the cron expression on which expired keys are
+	// deleted. See package cron.
+	SweepSchedule string `yaml:"sweepSchedule"`
+}
+
+// RateLimitConfig controls per-client rate limiting of the API routes. A zero
+// Rate disables it.
+type RateLimitConfig struct {
+	// Rate is the sustained number of requests per second per client.
+	Rate float64 `yaml:"rate"`
+
+	// Burst is how many requests a client may make at once.
+	Burst int `yaml:"burst"`
+
+	// Methods, when set, limits only requests with these methods, e.g.
+	// POST alone; the others are never throttled.
+	Methods []string `yaml:"methods"`
+}
+
+// QuotaConfig counts the requests of every authenticated client in the
+// store and bounds them per UTC day and month. Zero leaves a period
+// unbounded.
+type QuotaConfig struct {
+	// Track counts usage, for GET /admin/usage, even without quotas; it is
+	// counted whenever there is one.
+	Track bool `yaml:"track"`
+
+	// Daily and Monthly are how many requests a client may make per day
+	// and per month.
+	Daily   int `yaml:"daily"`
+	Monthly int `yaml:"monthly"`
+}
+
+// Enabled reports whether usage is counted.
+func (c QuotaConfig) Enabled() bool { return c.Track || c.Daily > 0 || c.Monthly > 0 }
+
+// ConcurrencyConfig caps the API writes served at once. Zero MaxWrites
+// leaves them uncapped.
+type ConcurrencyConfig struct {
+	// MaxWrites is how many writes are served at once.
+	MaxWrites int `yaml:"maxWrites"`
+
+	// QueueTimeout is how long a write over the cap waits for a slot before
+	// it is refused with 503.
+	QueueTimeout time.Duration `yaml:"queueTimeout"`
+}
+
+// LoadShedConfig controls the refusal of listings and exports while writes
+// are slow. A zero Threshold disables it.
+type LoadShedConfig struct {
+	// Threshold is the p99 write latency above which they are refused.
+	Threshold time.Duration `yaml:"threshold"`
+
+	// Window is how far back the latencies are taken from.
+	Window time.Duration `yaml:"window"`
+
+	// MinSamples is how many writes the window must hold to be judged.
+	MinSamples int `yaml:"minSamples"`
+}
+
+// ChaosConfig controls fault injection on the API routes, for demonstrating
+// client retries. A zero Rate and Simulate unset disable it; never enable it
+// in production.
+type ChaosConfig struct {
+	// Rate is the fraction of requests (0–1) that get a fault: a response
+	// dropped or replaced by a 500 after the handler committed, or a delay.
+	Rate float64 `yaml:"rate"`
+
+	// MaxDelay bounds the delay fault.
+	MaxDelay time.Duration `yaml:"maxDelay"`
+
+	// Simulate honours the X-Simulate header, which lets any client ask for
+	// its own request's response to be dropped.
+	Simulate bool `yaml:"simulate"`
+}
+
+// ModeConfig selects which writes the server accepts.
+type ModeConfig struct {
+	// Start is the mode at startup: "read-write", "maintenance" (writes to
+	// the data are refused, maintenance operations still run) or
+	// "read-only" (the database file is opened read-only). PUT /admin/mode
+	// changes it at runtime.
+	Start string `yaml:"start"`
+
+	// RetryAfter is sent with the 503 that refused writes get.
+	RetryAfter time.Duration `yaml:"retryAfter"`
+}
+
+// BoltConfig trades the durability of the database file for speed.
+// Durability picks a preset – "safe", "fast" or "demo", see
+// store.DurabilitySafe – and the other settings adjust it: the flags turn
+// on what the preset leaves off, and non-zero sizes replace its own.
+type BoltConfig struct {
+	Durability string `yaml:"durability"`
+
+	// NoSync skips the fsync of every commit, NoGrowSync the fsync after
+	// the file grows.
+	NoSync     bool `yaml:"noSync"`
+	NoGrowSync bool `yaml:"noGrowSync"`
+
+	// InitialMmapSize is how many bytes of the file to map when it is
+	// opened, and MmapFlags are passed to mmap.
+	InitialMmapSize int `yaml:"initialMmapSize"`
+	MmapFlags       int `yaml:"mmapFlags"`
+}
+
+// ShadowConfig mirrors chargeback writes onto a second database, comparing
+// its answers with the primary's, to migrate without downtime; see package
+// store/shadow. An empty DBPath disables it.
+type ShadowConfig struct {
+	// DBPath is the Bolt file writes are mirrored to. It must start as a
+	// copy of DBPath.
+	DBPath string `yaml:"dbPath"`
+
+	// Encoding is how the shadow stores records; empty means DBEncoding.
+	Encoding string `yaml:"encoding"`
+}
+
+// RaftConfig replicates chargeback writes across instances. An empty NodeID
+// disables it.
+type RaftConfig struct {
+	// NodeID names this instance in the cluster; it must be unique and
+	// stable across restarts.
+	NodeID string `yaml:"nodeID"`
+
+	// Addr is the host:port this instance serves Raft on, as the other
+	// instances reach it.
+	Addr string `yaml:"addr"`
+
+	// Dir holds the Raft log and snapshots.
+	Dir string `yaml:"dir"`
+
+	// Peers lists every instance of the cluster, this one included, as
+	// "id=host:port".
+	Peers []string `yaml:"peers"`
+}
+
+// PeerMap returns Peers keyed by instance ID.
+func (r RaftConfig) PeerMap() (map[string]string, error) {
+	peers := map[string]string{}
+	for _, p := range r.Peers {
+		id, addr, ok := strings.Cut(p, "=")
+		if !ok || id == "" || addr == "" {
+			return nil, fmt.Errorf("raft peer %q is not id=host:port", p)
+		}
+		if _, dup := peers[id]; dup {
+			return nil, fmt.Errorf("raft peer %q is listed twice", id)
+		}
+		peers[id] = addr
+	}
+	return peers, nil
+}
+
+// TracingConfig controls OpenTelemetry span export.
+type TracingConfig struct {
+	// Exporter is "none", "stdout" or "otlp".
+	Exporter string `yaml:"exporter"`
+
+	// Endpoint is the OTLP/HTTP collector host:port. Empty defers to the
+	// standard OTEL_EXPORTER_OTLP_* environment variables.
+	Endpoint string `yaml:"endpoint"`
+
+	// Insecure disables TLS towards the collector.
+	Insecure bool `yaml:"insecure"`
+
+	// SampleRatio is the fraction of new traces to sample (0–1).
+	SampleRatio float64 `yaml:"sampleRatio"`
+
+	ServiceName string `yaml:"serviceName"`
+}
+
+// DebugConfig controls the pprof and expvar endpoints under /debug.
+type DebugConfig struct {
+	// Enabled mounts the endpoints. They are off by default.
+	Enabled bool `yaml:"enabled"`
+
+	// Token, when set, must be sent as "Authorization: Bearer <token>".
+	Token string `yaml:"token"`
+}
+
+// BackupConfig controls scheduled backups. A zero Interval and no Schedule
+// disable them.
+type BackupConfig struct {
+	Interval time.Duration `yaml:"interval"`
+
+	// Schedule is a cron expression overriding Interval, e.g. "0 3 * * *"
+	// for 03:00 UTC daily.
+	Schedule string `yaml:"schedule"`
+
+	Dir  string `yaml:"dir"`
+	Keep int    `yaml:"keep"`
+}
+
+// Spec returns the cron expression backups run on, or "" when they are
+// disabled.
+func (c BackupConfig) Spec() string { return spec(c.Schedule, c.Interval) }
+
+// CompactionConfig controls automatic compaction. A zero Threshold disables
+// it.
+type CompactionConfig struct {
+	// Threshold is the free-page ratio (0–1) above which the database is
+	// compacted.
+	Threshold float64       `yaml:"threshold"`
+	Interval  time.Duration `yaml:"interval"`
+
+	// Schedule is a cron expression overriding Interval.
+	Schedule string `yaml:"schedule"`
+}
+
+// Spec returns the cron expression the free-page ratio is checked on.
+func (c CompactionConfig) Spec() string { return spec(c.Schedule, c.Interval) }
+
+// RetentionConfig controls archival of old chargebacks. A zero Days
+// disables it.
+type RetentionConfig struct {
+	// Days is the age, by creation time, at which chargebacks move from the
+	// active bucket into the archive.
+	Days int `yaml:"days"`
+
+	// Interval is how often the archival job runs.
+	Interval time.Duration `yaml:"interval"`
+
+	// Schedule is a cron expression overriding Interval.
+	Schedule string `yaml:"schedule"`
+}
+
+// Spec returns the cron expression the archival job runs on.
+func (c RetentionConfig) Spec() string { return spec(c.Schedule, c.Interval) }
+
+// spec returns schedule, or an "@every" expression for a positive interval.
+func spec(schedule string, interval time.Duration) string {
+	switch {
+	case schedule != "":
+		return schedule
+	case interval > 0:
+		return "@every " + interval.String()
+	}
+	return ""
+}
+
+// EncryptionConfig enables field encryption at rest. No Keys disables it.
+type EncryptionConfig struct {
+	// Keys are AES keys as "id=<base64 key>". The first encrypts new
+	// values; the others only decrypt, which is how keys are rotated.
+	Keys []string `yaml:"keys"`
+}
+
+// BatchConfig controls write coalescing: concurrent single-record writes
+// share one Bolt transaction and fsync. A zero MaxSize disables it.
+type BatchConfig struct {
+	// MaxSize is the most writes committed together.
+	MaxSize int `yaml:"maxSize"`
+
+	// Delay is how long a write waits for others to join its batch.
+	Delay time.Duration `yaml:"delay"`
+}
+
+// RetryConfig controls the retries of store operations that fail on a
+// transient error, such as DBTimeout. An Attempts of 1 disables them.
+type RetryConfig struct {
+	// Attempts bounds the tries of an operation, the first included.
+	Attempts int `yaml:"attempts"`
+
+	// MinBackoff and MaxBackoff bound the jittered delay before a retry,
+	// which doubles with each one.
+	MinBackoff time.Duration `yaml:"minBackoff"`
+	MaxBackoff time.Duration `yaml:"maxBackoff"`
+}
+
+// BreakerConfig controls the circuit breaker around the store (see package
+// store/breaker). Zero Failures disables it.
+type BreakerConfig struct {
+	// Failures is how many store operations must fail in a row to open
+	// the breaker.
+	Failures int `yaml:"failures"`
+
+	// Cooldown is how long it stays open before trying the store again.
+	Cooldown time.Duration `yaml:"cooldown"`
+}
+
+// JobsConfig controls the queue running background work: webhook
+// deliveries, scheduled backups and archival.
+type JobsConfig struct {
+	// Workers is the number of jobs run concurrently.
+	Workers int `yaml:"workers"`
+
+	// MaxAttempts bounds the runs of a failing job before it gives up.
+	MaxAttempts int `yaml:"maxAttempts"`
+
+	// RetryDelay is the wait before a failed job's first retry, doubled for
+	// every retry after.
+	RetryDelay time.Duration `yaml:"retryDelay"`
+}
+
+// WebhookConfig announces chargeback changes to HTTP endpoints. No URLs
+// disables it.
+type WebhookConfig struct {
+	// URLs receive a POST of every event.
+	URLs []string `yaml:"urls"`
+
+	// Timeout bounds a delivery attempt.
+	Timeout time.Duration `yaml:"timeout"`
+
+	// Source is the CloudEvents source of the events: a URI reference
+	// identifying this server to receivers.
+	Source string `yaml:"source"`
+}
+
+// RatesConfig selects where the exchange rates of GET
+// /chargebacks/stats?convertTo= come from. An empty Provider disables
+// conversion.
+type RatesConfig struct {
+	// Provider is "static", for the rates of Static, or "ecb", for the
+	// European Central Bank's daily reference rates.
+	Provider string `yaml:"provider"`
+
+	// Base and Static are the static rates: Static lists "CODE=rate", the
+	// units of CODE one unit of Base buys.
+	Base   string   `yaml:"base"`
+	Static []string `yaml:"static"`
+
+	// URL is the ECB feed; empty means the ECB's own.
+	URL string `yaml:"url"`
+
+	// Timeout bounds a fetch of the rates.
+	Timeout time.Duration `yaml:"timeout"`
+
+	// Interval is how often the rates are refreshed.
+	Interval time.Duration `yaml:"interval"`
+
+	// Schedule is a cron expression overriding Interval.
+	Schedule string `yaml:"schedule"`
+}
+
+// Spec returns the cron expression the rates are refreshed on.
+func (c RatesConfig) Spec() string { return spec(c.Schedule, c.Interval) }
+
+// PolicyConfig holds the risk rules every chargeback create and update is
+// checked against. The zero value has no rules.
+type PolicyConfig struct {
+	// MaxAmounts caps chargeback amounts per currency, as "CODE=amount" in
+	// minor units, e.g. "USD=1000000" for $10,000.
+	MaxAmounts []string `yaml:"maxAmounts"`
+
+	// DisallowedReasons are reasons chargebacks may not give, compared
+	// ignoring case.
+	DisallowedReasons []string `yaml:"disallowedReasons"`
+
+	// MerchantVelocity, when positive, is the most chargebacks a merchant
+	// may be given in any MerchantWindow.
+	MerchantVelocity int           `yaml:"merchantVelocity"`
+	MerchantWindow   time.Duration `yaml:"merchantWindow"`
+}
+
+// Rules returns the policy c describes, or nil if it has no rules.
+func (c PolicyConfig) Rules() (*models.Policy, error) {
+	if len(c.MaxAmounts) == 0 && len(c.DisallowedReasons) == 0 && c.MerchantVelocity == 0 {
+		return nil, nil
+	}
+	p := &models.Policy{MaxAmounts: []models.AmountLimit{}, DisallowedReasons: []string{}}
+	for _, pair := range c.MaxAmounts {
+		code, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("policy max amount %q is not CODE=amount", pair)
+		}
+		if _, ok := money.Lookup(code); !ok {
+			return nil, fmt.Errorf("policy max amount %q: unknown currency %q", pair, code)
+		}
+		max, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || max <= 0 {
+			return nil, fmt.Errorf("policy max amount %q: not a positive integer", pair)
+		}
+		p.MaxAmounts = append(p.MaxAmounts, models.AmountLimit{Currency: code, Max: max})
+	}
+	for _, r := range c.DisallowedReasons {
+		if strings.TrimSpace(r) == "" {
+			return nil, errors.New("policy disallowed reasons must not be empty")
+		}
+		p.DisallowedReasons = append(p.DisallowedReasons, r)
+	}
+	if c.MerchantVelocity > 0 {
+		if c.MerchantWindow < time.Second {
+			return nil, errors.New("policy merchant window must be at least 1s")
+		}
+		p.MerchantVelocity = &models.VelocityLimit{Max: c.MerchantVelocity, WindowSeconds: int64(c.MerchantWindow / time.Second)}
+	}
+	return p, nil
+}
+
+// Default returns the built-in configuration.
+func Default() *Config {
+	return &Config{
+		Port:       "8080",
+		DBPath:     "chargebacks.db",
+		DBEncoding: "json",
+		Bolt:       BoltConfig{Durability: "safe"},
+		DBTimeout:  10 * time.Second,
+		Log: LogConfig{
+			Format: "text",
+			Level:  "info",
+		},
+		Server: ServerConfig{
+			ReadHeaderTimeout: 5 * time.Second,
+			ReadTimeout:       30 * time.Second,
+			WriteTimeout:      60 * time.Second,
+			IdleTimeout:       120 * time.Second,
+			MaxHeaderBytes:    64 << 10,
+			MaxBodyBytes:      1 << 20,
+			MaxUploadBytes:    10 << 20,
+			DeleteStatus:      200,
+			DuplicateStatus:   200,
+			AsyncWorkers:      4,
+		},
+		TLS: TLSConfig{
+			AutocertDir: "autocert",
+		},
+		CORS: CORSConfig{
+			MaxAge: 10 * time.Minute,
+		},
+		Signing: SigningConfig{
+			MaxSkew: 5 * time.Minute,
+		},
+		Security: SecurityConfig{
+			HSTSMaxAge:                    365 * 24 * time.Hour,
+			ReferrerPolicy:                "no-referrer",
+			ContentSecurityPolicy:         "default-src 'none'; frame-ancestors 'none'",
+			FrontendContentSecurityPolicy: "default-src 'self'; img-src 'self' data:; object-src 'none'; base-uri 'self'; frame-ancestors 'none'",
+		},
+		Idempotency: IdempotencyConfig{
+			KeyFormat:     "any",
+			SweepSchedule: "@hourly",
+		},
+		RateLimit: RateLimitConfig{
+			Burst: 20,
+		},
+		Concurrency: ConcurrencyConfig{
+			QueueTimeout: 100 * time.Millisecond,
+		},
+		LoadShed: LoadShedConfig{
+			Window:     10 * time.Second,
+			MinSamples: 20,
+		},
+		Chaos: ChaosConfig{
+			MaxDelay: 2 * time.Second,
+		},
+		Mode: ModeConfig{
+			Start:      "read-write",
+			RetryAfter: 30 * time.Second,
+		},
+		Raft: RaftConfig{
+			Dir: "raft",
+		},
+		Tracing: TracingConfig{
+			Exporter:    "none",
+			SampleRatio: 1,
+			ServiceName: "idempotency-example",
+		},
+		Backup: BackupConfig{
+			Dir:  "backups",
+			Keep: 7,
+		},
+		Compaction: CompactionConfig{
+			Interval: 10 * time.Minute,
+		},
+		Retention: RetentionConfig{
+			Interval: time.Hour,
+		},
+		Batch: BatchConfig{
+			Delay: 10 * time.Millisecond,
+		},
+		Retry: RetryConfig{
+			Attempts:   3,
+			MinBackoff: 50 * time.Millisecond,
+			MaxBackoff: time.Second,
+		},
+		Breaker: BreakerConfig{
+			Failures: 5,
+			Cooldown: 30 * time.Second,
+		},
+		Jobs: JobsConfig{
+			Workers:     2,
+			MaxAttempts: 8,
+			RetryDelay:  time.Second,
+		},
+		Webhook: WebhookConfig{
+			Timeout: 10 * time.Second,
+			Source:  "/idempotency-example",
+		},
+		Policy: PolicyConfig{
+			MerchantWindow: 24 * time.Hour,
+		},
+		Rates: RatesConfig{
+			Base:     "EUR",
+			Timeout:  10 * time.Second,
+			Interval: 6 * time.Hour,
+		},
+	}
+}
+
+// setting binds one configuration value to its flag and environment
+// variable.
+type setting struct {
+	flag  string
+	env   string
+	usage string
+	value value
+}
+
+// value parses a string and stores it in the config.
+type value interface {
+	set(c *Config, v string) error
+}
+
+// setFunc is the value implementation for all non-boolean settings.
+type setFunc func(c *Config, v string) error
+
+func (f setFunc) set(c *Config, v string) error { return f(c, v) }
+
+// boolFunc is a value whose flag may be given without an argument
+// ("-debug" rather than "-debug=true").
+type boolFunc func(c *Config, v string) error
+
+func (f boolFunc) set(c *Config, v string) error { return f(c, v) }
+
+// settings is the single source of truth for flag and environment names.
+var settings = []setting{
+	{"port", "PORT", "TCP port to listen on", str(func(c *Config) *string { return &c.Port })},
+	{"grpc-port", "GRPC_PORT", "TCP port for the gRPC server (empty disables it)", str(func(c *Config) *string { return &c.GRPCPort })},
+	{"db", "DB_PATH", "BoltDB file location", str(func(c *Config) *string { return &c.DBPath })},
+	{"db-encoding", "DB_ENCODING", "record encoding for writes: json, msgpack or protobuf", str(func(c *Config) *string { return &c.DBEncoding })},
+	{"db-durability", "DB_DURABILITY", "durability of the database file: safe, fast (no fsync on growth) or demo (no fsync at all)", str(func(c *Config) *string { return &c.Bolt.Durability })},
+	{"db-no-sync", "DB_NO_SYNC", "skip the fsync of every commit, whatever -db-durability", boolean(func(c *Config) *bool { return &c.Bolt.NoSync })},
+	{"db-no-grow-sync", "DB_NO_GROW_SYNC", "skip the fsync after the file grows, whatever -db-durability", boolean(func(c *Config) *bool { return &c.Bolt.NoGrowSync })},
+	{"db-initial-mmap-size", "DB_INITIAL_MMAP_SIZE", "bytes of the database file to map when it is opened (0 keeps the durability's)", integer(func(c *Config) *int { return &c.Bolt.InitialMmapSize })},
+	{"db-mmap-flags", "DB_MMAP_FLAGS", "flags passed to mmap, e.g. 32768 for MAP_POPULATE on Linux", integer(func(c *Config) *int { return &c.Bolt.MmapFlags })},
+	{"db-timeout", "DB_TIMEOUT", "how long an operation waits for the database before failing (0 waits as long as the request)", dur(func(c *Config) *time.Duration { return &c.DBTimeout })},
+	{"migrate-on-start", "MIGRATE_ON_START", "upgrade and re-encode every stored record before serving", boolean(func(c *Config) *bool { return &c.MigrateOnStart })},
+	{"record-requests", "RECORD_REQUESTS", "record every API request in the database for cbctl replay", boolean(func(c *Config) *bool { return &c.RecordRequests })},
+	{"plugins", "PLUGINS", "comma-separated compiled-in plugins to enable, in order", list(func(c *Config) *[]string { return &c.Plugins })},
+	{"restore", "", "restore the database from this snapshot file before serving", str(func(c *Config) *string { return &c.Restore })},
+	{"bench-server", "", "benchmark the storage strategies next to the database, print a report and exit", boolean(func(c *Config) *bool { return &c.BenchServer })},
+
+	{"log-format", "LOG_FORMAT", "log output format: text or json", str(func(c *Config) *string { return &c.Log.Format })},
+	{"log-level", "LOG_LEVEL", "minimum log level: debug, info, warn or error", str(func(c *Config) *string { return &c.Log.Level })},
+
+	{"read-header-timeout", "READ_HEADER_TIMEOUT", "maximum time to read request headers", dur(func(c *Config) *time.Duration { return &c.Server.ReadHeaderTimeout })},
+	{"read-timeout", "READ_TIMEOUT", "maximum time to read the entire request", dur(func(c *Config) *time.Duration { return &c.Server.ReadTimeout })},
+	{"write-timeout", "WRITE_TIMEOUT", "maximum time to write the response", dur(func(c *Config) *time.Duration { return &c.Server.WriteTimeout })},
+	{"idle-timeout", "IDLE_TIMEOUT", "maximum keep-alive idle time", dur(func(c *Config) *time.Duration { return &c.Server.IdleTimeout })},
+	{"max-header-bytes", "MAX_HEADER_BYTES", "maximum size of request headers", integer(func(c *Config) *int { return &c.Server.MaxHeaderBytes })},
+	{"max-body-bytes", "MAX_BODY_BYTES", "maximum size of JSON request bodies", integer(func(c *Config) *int { return &c.Server.MaxBodyBytes })},
+	{"max-upload-bytes", "MAX_UPLOAD_BYTES", "maximum size of an evidence document", integer(func(c *Config) *int { return &c.Server.MaxUploadBytes })},
+	{"strict-json", "STRICT_JSON", "reject JSON bodies with unknown fields or duplicate keys", boolean(func(c *Config) *bool { return &c.Server.StrictJSON })},
+	{"delete-status", "DELETE_STATUS", "status of a successful single-record DELETE: 200 (with body) or 204", integer(func(c *Config) *int { return &c.Server.DeleteStatus })},
+	{"duplicate-status", "DUPLICATE_STATUS", "status of a repeated create: 200 (replay) or 409 (conflict)", integer(func(c *Config) *int { return &c.Server.DuplicateStatus })},
+	{"async-workers", "ASYNC_WORKERS", "workers running asynchronous creates (0 disables Prefer: respond-async)", integer(func(c *Config) *int { return &c.Server.AsyncWorkers })},
+	{"shutdown-drain-delay", "SHUTDOWN_DRAIN_DELAY", "time to report not-ready before shutting down", dur(func(c *Config) *time.Duration { return &c.Server.ShutdownDrainDelay })},
+
+	{"tls-cert", "TLS_CERT_FILE", "TLS certificate file (PEM)", str(func(c *Config) *string { return &c.TLS.CertFile })},
+	{"tls-key", "TLS_KEY_FILE", "TLS private key file (PEM)", str(func(c *Config) *string { return &c.TLS.KeyFile })},
+	{"autocert-host", "TLS_AUTOCERT_HOST", "obtain a Let's Encrypt certificate for this hostname", str(func(c *Config) *string { return &c.TLS.AutocertHost })},
+	{"autocert-dir", "TLS_AUTOCERT_DIR", "directory caching Let's Encrypt certificates", str(func(c *Config) *string { return &c.TLS.AutocertDir })},
+	{"tls-client-ca", "TLS_CLIENT_CA_FILE", "require client certificates signed by these CAs (mTLS)", str(func(c *Config) *string { return &c.TLS.ClientCAFile })},
+
+	{"cors-origins", "CORS_ORIGINS", "comma-separated origins allowed to call the API (* for any)", list(func(c *Config) *[]string { return &c.CORS.AllowedOrigins })},
+	{"cors-credentials", "CORS_CREDENTIALS", "allow credentialed cross-origin requests", boolean(func(c *Config) *bool { return &c.CORS.AllowCredentials })},
+	{"cors-max-age", "CORS_MAX_AGE", "how long browsers may cache preflight responses", dur(func(c *Config) *time.Duration { return &c.CORS.MaxAge })},
+	{"hsts-max-age", "HSTS_MAX_AGE", "Strict-Transport-Security max-age sent over TLS (0 to omit)", dur(func(c *Config) *time.Duration { return &c.Security.HSTSMaxAge })},
+	{"referrer-policy", "REFERRER_POLICY", "Referrer-Policy header (empty to omit)", str(func(c *Config) *string { return &c.Security.ReferrerPolicy })},
+	{"csp", "CSP", "Content-Security-Policy of the API (empty to omit)", str(func(c *Config) *string { return &c.Security.ContentSecurityPolicy })},
+	{"frontend-csp", "FRONTEND_CSP", "Content-Security-Policy of the frontend (empty to omit)", str(func(c *Config) *string { return &c.Security.FrontendContentSecurityPolicy })},
+	{"signing-secret", "SIGNING_SECRET", "HMAC secret API requests must be signed with (empty to not require signatures)", str(func(c *Config) *string { return &c.Signing.Secret })},
+	{"signing-max-skew", "SIGNING_MAX_SKEW", "how far a request's signature timestamp may be from the server's clock", dur(func(c *Config) *time.Duration { return &c.Signing.MaxSkew })},
+	{"trusted-proxies", "TRUSTED_PROXIES", "comma-separated CIDRs of proxies whose X-Forwarded-For names the client", list(func(c *Config) *[]string { return &c.Network.TrustedProxies })},
+	{"ip-allow", "IP_ALLOW", "comma-separated CIDRs of the only clients served (empty for any)", list(func(c *Config) *[]string { return &c.Network.Allow })},
+	{"ip-deny", "IP_DENY", "comma-separated CIDRs of clients refused", list(func(c *Config) *[]string { return &c.Network.Deny })},
+
+	{"auth-required", "AUTH_REQUIRED", "require a valid X-API-Key or bearer token on API routes", boolean(func(c *Config) *bool { return &c.Auth.Required })},
+	{"admin-token", "ADMIN_TOKEN", "bearer token for /admin endpoints", str(func(c *Config) *string { return &c.Auth.AdminToken })},
+	{"jwt-secret", "JWT_SECRET", "shared secret for HMAC-signed bearer tokens", str(func(c *Config) *string { return &c.Auth.JWT.Secret })},
+	{"jwks-url", "JWKS_URL", "JWKS URL for RSA/ECDSA-signed bearer tokens", str(func(c *Config) *string { return &c.Auth.JWT.JWKSURL })},
+	{"jwt-issuer", "JWT_ISSUER", "required iss claim of bearer tokens", str(func(c *Config) *string { return &c.Auth.JWT.Issuer })},
+	{"jwt-audience", "JWT_AUDIENCE", "required aud claim of bearer tokens", str(func(c *Config) *string { return &c.Auth.JWT.Audience })},
+
+	{"key-format", "IDEMPOTENCY_KEY_FORMAT", "required idempotency key format: any, uuid or ulid", str(func(c *Config) *string { return &c.Idempotency.KeyFormat })},
+	{"key-pattern", "IDEMPOTENCY_KEY_PATTERN", "regular expression idempotency keys must match (overrides -key-format)", str(func(c *Config) *string { return &c.Idempotency.KeyPattern })},
+	{"key-ttl", "IDEMPOTENCY_KEY_TTL", "how long idempotency keys are honoured (0 keeps them forever)", dur(func(c *Config) *time.Duration { return &c.Idempotency.KeyTTL })},
+	{"idempotency-strict", "IDEMPOTENCY_STRICT", "require an Idempotency-Key on every write and replay saved responses (IETF draft semantics)", boolean(func(c *Config) *bool { return &c.Idempotency.Strict })},
+	{"key-sweep-schedule", "KEY_SWEEP_SCHEDULE", "cron expression on which expired idempotency keys are deleted", str(func(c *Config) *string { return &c.Idempotency.SweepSchedule })},
+
+	{"rate-limit", "RATE_LIMIT_RPS", "requests per second per client (0 disables)", float(func(c *Config) *float64 { return &c.RateLimit.Rate })},
+	{"rate-limit-burst", "RATE_LIMIT_BURST", "requests a client may make at once", integer(func(c *Config) *int { return &c.RateLimit.Burst })},
+	{"rate-limit-methods", "RATE_LIMIT_METHODS", "comma-separated methods rate limiting applies to (empty means all)", list(func(c *Config) *[]string { return &c.RateLimit.Methods })},
+	{"usage-tracking", "USAGE_TRACKING", "count the requests of every authenticated client, for GET /admin/usage", boolean(func(c *Config) *bool { return &c.Quota.Track })},
+	{"quota-daily", "QUOTA_DAILY", "requests a client may make per UTC day (0 for no quota)", integer(func(c *Config) *int { return &c.Quota.Daily })},
+	{"quota-monthly", "QUOTA_MONTHLY", "requests a client may make per UTC month (0 for no quota)", integer(func(c *Config) *int { return &c.Quota.Monthly })},
+	{"max-concurrent-writes", "MAX_CONCURRENT_WRITES", "API writes served at once; others queue, then get 503 (0 for no cap)", integer(func(c *Config) *int { return &c.Concurrency.MaxWrites })},
+	{"write-queue-timeout", "WRITE_QUEUE_TIMEOUT", "how long a write over the concurrency cap waits for a slot", dur(func(c *Config) *time.Duration { return &c.Concurrency.QueueTimeout })},
+	{"shed-latency", "SHED_LATENCY", "p99 write latency above which listings and exports get 503 (0 disables load shedding)", dur(func(c *Config) *time.Duration { return &c.LoadShed.Threshold })},
+	{"shed-window", "SHED_WINDOW", "how far back write latencies are taken from for load shedding", dur(func(c *Config) *time.Duration { return &c.LoadShed.Window })},
+	{"shed-min-samples", "SHED_MIN_SAMPLES", "writes the load shedding window must hold to be judged", integer(func(c *Config) *int { return &c.LoadShed.MinSamples })},
+
+	{"chaos-rate", "CHAOS_RATE", "fraction of API requests given an injected fault (0 disables; demo only)", float(func(c *Config) *float64 { return &c.Chaos.Rate })},
+	{"chaos-max-delay", "CHAOS_MAX_DELAY", "longest delay injected by the chaos middleware", dur(func(c *Config) *time.Duration { return &c.Chaos.MaxDelay })},
+	{"chaos-simulate", "CHAOS_SIMULATE", "honour X-Simulate, letting clients drop their own responses (demo only)", boolean(func(c *Config) *bool { return &c.Chaos.Simulate })},
+
+	{"mode", "MODE", "write mode at startup: read-write, maintenance or read-only", str(func(c *Config) *string { return &c.Mode.Start })},
+	{"mode-retry-after", "MODE_RETRY_AFTER", "Retry-After sent with writes refused by the mode", dur(func(c *Config) *time.Duration { return &c.Mode.RetryAfter })},
+
+	{"raft-node-id", "RAFT_NODE_ID", "ID of this instance in a replicated cluster (empty disables replication)", str(func(c *Config) *string { return &c.Raft.NodeID })},
+	{"raft-addr", "RAFT_ADDR", "host:port this instance serves Raft on", str(func(c *Config) *string { return &c.Raft.Addr })},
+	{"raft-dir", "RAFT_DIR", "directory of the Raft log and snapshots", str(func(c *Config) *string { return &c.Raft.Dir })},
+	{"raft-peers", "RAFT_PEERS", "comma-separated id=host:port of every instance in the cluster", list(func(c *Config) *[]string { return &c.Raft.Peers })},
+
+	{"shadow-db", "SHADOW_DB_PATH", "BoltDB file chargeback writes are mirrored to and compared with (empty disables it)", str(func(c *Config) *string { return &c.Shadow.DBPath })},
+	{"shadow-db-encoding", "SHADOW_DB_ENCODING", "record encoding of the shadow database (empty means -db-encoding)", str(func(c *Config) *string { return &c.Shadow.Encoding })},
+
+	{"trace-exporter", "TRACE_EXPORTER", "span exporter: none, stdout or otlp", str(func(c *Config) *string { return &c.Tracing.Exporter })},
+	{"trace-endpoint", "TRACE_ENDPOINT", "OTLP/HTTP collector host:port", str(func(c *Config) *string { return &c.Tracing.Endpoint })},
+	{"trace-insecure", "TRACE_INSECURE", "disable TLS towards the OTLP collector", boolean(func(c *Config) *bool { return &c.Tracing.Insecure })},
+	{"trace-sample-ratio", "TRACE_SAMPLE_RATIO", "fraction of new traces to sample (0-1)", float(func(c *Config) *float64 { return &c.Tracing.SampleRatio })},
+	{"trace-service-name", "TRACE_SERVICE_NAME", "service.name reported with spans", str(func(c *Config) *string { return &c.Tracing.ServiceName })},
+
+	{"debug", "DEBUG_ENDPOINTS", "mount pprof and expvar under /debug", boolean(func(c *Config) *bool { return &c.Debug.Enabled })},
+	{"debug-token", "DEBUG_TOKEN", "bearer token required for /debug endpoints", str(func(c *Config) *string { return &c.Debug.Token })},
+
+	{"backup-interval", "BACKUP_INTERVAL", "interval between automatic backups (0 disables)", dur(func(c *Config) *time.Duration { return &c.Backup.Interval })},
+	{"backup-schedule", "BACKUP_SCHEDULE", "cron expression for automatic backups, overriding the interval", str(func(c *Config) *string { return &c.Backup.Schedule })},
+	{"backup-dir", "BACKUP_DIR", "directory for automatic backups", str(func(c *Config) *string { return &c.Backup.Dir })},
+	{"backup-keep", "BACKUP_KEEP", "number of automatic backups to keep", integer(func(c *Config) *int { return &c.Backup.Keep })},
+
+	{"compact-threshold", "COMPACT_THRESHOLD", "free-page ratio that triggers compaction (0 disables)", float(func(c *Config) *float64 { return &c.Compaction.Threshold })},
+	{"compact-interval", "COMPACT_INTERVAL", "interval between compaction checks", dur(func(c *Config) *time.Duration { return &c.Compaction.Interval })},
+	{"compact-schedule", "COMPACT_SCHEDULE", "cron expression for compaction checks, overriding the interval", str(func(c *Config) *string { return &c.Compaction.Schedule })},
+
+	{"retention-days", "RETENTION_DAYS", "archive chargebacks created more than this many days ago (0 disables)", integer(func(c *Config) *int { return &c.Retention.Days })},
+	{"retention-interval", "RETENTION_INTERVAL", "interval between archival runs", dur(func(c *Config) *time.Duration { return &c.Retention.Interval })},
+	{"retention-schedule", "RETENTION_SCHEDULE", "cron expression for archival runs, overriding the interval", str(func(c *Config) *string { return &c.Retention.Schedule })},
+
+	{"encryption-keys", "ENCRYPTION_KEYS", "comma-separated id=<base64 AES key> for field encryption; the first encrypts new values", list(func(c *Config) *[]string { return &c.Encryption.Keys })},
+
+	{"batch-max-size", "BATCH_MAX_SIZE", "most concurrent writes committed in one transaction (0 disables batching)", integer(func(c *Config) *int { return &c.Batch.MaxSize })},
+	{"batch-delay", "BATCH_DELAY", "how long a write waits for others to batch with", dur(func(c *Config) *time.Duration { return &c.Batch.Delay })},
+	{"retry-attempts", "RETRY_ATTEMPTS", "tries of a store operation failing on a transient error, the first included (1 disables retries)", integer(func(c *Config) *int { return &c.Retry.Attempts })},
+	{"retry-min-backoff", "RETRY_MIN_BACKOFF", "delay bound before the first retry of a store operation, doubled for each after", dur(func(c *Config) *time.Duration { return &c.Retry.MinBackoff })},
+	{"retry-max-backoff", "RETRY_MAX_BACKOFF", "largest delay bound before a retry of a store operation", dur(func(c *Config) *time.Duration { return &c.Retry.MaxBackoff })},
+	{"breaker-failures", "BREAKER_FAILURES", "store operations failing in a row that open the circuit breaker (0 disables it)", integer(func(c *Config) *int { return &c.Breaker.Failures })},
+	{"breaker-cooldown", "BREAKER_COOLDOWN", "how long the circuit breaker stays open before trying the store again", dur(func(c *Config) *time.Duration { return &c.Breaker.Cooldown })},
+
+	{"job-workers", "JOB_WORKERS", "background jobs run concurrently", integer(func(c *Config) *int { return &c.Jobs.Workers })},
+	{"job-max-attempts", "JOB_MAX_ATTEMPTS", "runs of a failing background job before it gives up", integer(func(c *Config) *int { return &c.Jobs.MaxAttempts })},
+	{"job-retry-delay", "JOB_RETRY_DELAY", "wait before a failed job's first retry, doubled for each after", dur(func(c *Config) *time.Duration { return &c.Jobs.RetryDelay })},
+
+	{"webhook-urls", "WEBHOOK_URLS", "comma-separated URLs receiving chargeback events (empty disables webhooks)", list(func(c *Config) *[]string { return &c.Webhook.URLs })},
+	{"webhook-timeout", "WEBHOOK_TIMEOUT", "maximum time of a webhook delivery attempt", dur(func(c *Config) *time.Duration { return &c.Webhook.Timeout })},
+	{"webhook-source", "WEBHOOK_SOURCE", "CloudEvents source of the events sent to webhooks", str(func(c *Config) *string { return &c.Webhook.Source })},
+
+	{"policy-max-amounts", "POLICY_MAX_AMOUNTS", "comma-separated CODE=amount caps on chargeback amounts, in minor units", list(func(c *Config) *[]string { return &c.Policy.MaxAmounts })},
+	{"policy-disallowed-reasons", "POLICY_DISALLOWED_REASONS", "comma-separated chargeback reasons to refuse", list(func(c *Config) *[]string { return &c.Policy.DisallowedReasons })},
+	{"policy-merchant-velocity", "POLICY_MERCHANT_VELOCITY", "most chargebacks a merchant may be given per window (0 disables)", integer(func(c *Config) *int { return &c.Policy.MerchantVelocity })},
+	{"policy-merchant-window", "POLICY_MERCHANT_WINDOW", "window of the merchant velocity limit", dur(func(c *Config) *time.Duration { return &c.Policy.MerchantWindow })},
+
+	{"rates-provider", "RATES_PROVIDER", "exchange rates for stats conversion: static or ecb (empty disables conversion)", str(func(c *Config) *string { return &c.Rates.Provider })},
+	{"rates-base", "RATES_BASE", "currency the static exchange rates are quoted against", str(func(c *Config) *string { return &c.Rates.Base })},
+	{"rates-static", "RATES_STATIC", "comma-separated CODE=rate static exchange rates", list(func(c *Config) *[]string { return &c.Rates.Static })},
+	{"rates-url", "RATES_URL", "ECB exchange rate feed URL (empty means the ECB's)", str(func(c *Config) *string { return &c.Rates.URL })},
+	{"rates-timeout", "RATES_TIMEOUT", "maximum time of an exchange rate fetch", dur(func(c *Config) *time.Duration { return &c.Rates.Timeout })},
+	{"rates-interval", "RATES_INTERVAL", "interval between exchange rate refreshes", dur(func(c *Config) *time.Duration { return &c.Rates.Interval })},
+	{"rates-schedule", "RATES_SCHEDULE", "cron expression for exchange rate refreshes, overriding the interval", str(func(c *Config) *string { return &c.Rates.Schedule })},
+}
+
+// Load builds the configuration from defaults, the config file, the process
+// environment and args (typically os.Args[1:]).
+func Load(args []string) (*Config, error) {
+	return load(args, os.Getenv, os.Stderr)
+}
+
+func load(args []string, getenv func(string) string, output io.Writer) (*Config, error) {
+	fs := flag.NewFlagSet("backend", flag.ContinueOnError)
+	fs.SetOutput(output)
+
+	configPath := fs.String("config", getenv("CONFIG_FILE"), "path to a YAML config file (env CONFIG_FILE)")
+
+	// Flags are collected first and applied last so they override the file
+	// and environment regardless of the order in which sources are read.
+	flagged := map[string]string{}
+	for _, st := range settings {
+		usage := st.usage
+		if st.env != "" {
+			usage += " (env " + st.env + ")"
+		}
+		collect := func(v string) error {
+			flagged[st.flag] = v
+			return nil
+		}
+		if _, ok := st.value.(boolFunc); ok {
+			fs.BoolFunc(st.flag, usage, collect)
+		} else {
+			fs.Func(st.flag, usage, collect)
+		}
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	cfg := Default()
+
+	if *configPath != "" {
+		if err := cfg.loadFile(*configPath); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, st := range settings {
+		if st.env == "" {
+			continue
+		}
+		if v := getenv(st.env); v != "" {
+			if err := st.value.set(cfg, v); err != nil {
+				return nil, fmt.Errorf("invalid %s: %w", st.env, err)
+			}
+		}
+	}
+
+	for _, st := range settings {
+		if v, ok := flagged[st.flag]; ok {
+			if err := st.value.set(cfg, v); err != nil {
+				return nil, fmt.Errorf("invalid -%s: %w", st.flag, err)
+			}
+		}
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// loadFile overlays the YAML file at path onto c. Keys absent from the file
+// keep their current values; unknown keys are rejected to catch typos.
+func (c *Config) loadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("config file: %w", err)
+	}
+	defer f.Close()
+
+	dec := yaml.NewDecoder(f)
+	dec.KnownFields(true)
+	if err := dec.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// Validate reports the first setting that is out of range.
+func (c *Config) Validate() error {
+	switch {
+	case c.Port == "":
+		return errors.New("port must not be empty")
+	case c.GRPCPort != "" && c.GRPCPort == c.Port:
+		return errors.New("grpc port must differ from the HTTP port")
+	case c.DBPath == "":
+		return errors.New("db path must not be empty")
+	case c.Bolt.Durability != "safe" && c.Bolt.Durability != "fast" && c.Bolt.Durability != "demo":
+		return fmt.Errorf("db durability must be safe, fast or demo, got %q", c.Bolt.Durability)
+	case c.Bolt.InitialMmapSize < 0:
+		return errors.New("db initial mmap size must not be negative")
+	case c.DBTimeout < 0:
+		return errors.New("db timeout must not be negative")
+	case c.DBEncoding != "json" && c.DBEncoding != "msgpack" && c.DBEncoding != "protobuf":
+		return fmt.Errorf("db encoding must be json, msgpack or protobuf, got %q", c.DBEncoding)
+	case c.Log.Format != "text" && c.Log.Format != "json":
+		return fmt.Errorf("log format must be text or json, got %q", c.Log.Format)
+	case c.RateLimit.Rate < 0:
+		return errors.New("rate limit must not be negative")
+	case c.Signing.Enabled() && c.Signing.MaxSkew <= 0:
+		return errors.New("signing max skew must be positive")
+	case c.Security.HSTSMaxAge < 0:
+		return errors.New("hsts max age must not be negative")
+	case c.CORS.AllowCredentials && slices.Contains(c.CORS.AllowedOrigins, "*"):
+		return errors.New(`cors credentials cannot be allowed to any origin ("*"); list the origins instead`)
+	case c.RateLimit.Rate > 0 && c.RateLimit.Burst < 1:
+		return errors.New("rate limit burst must be at least 1")
+	case c.Quota.Daily < 0 || c.Quota.Monthly < 0:
+		return errors.New("quotas must not be negative")
+	case c.Concurrency.MaxWrites < 0:
+		return errors.New("max concurrent writes must not be negative")
+	case c.Concurrency.MaxWrites > 0 && c.Concurrency.QueueTimeout < 0:
+		return errors.New("write queue timeout must not be negative")
+	case c.LoadShed.Threshold < 0:
+		return errors.New("shed latency must not be negative")
+	case c.LoadShed.Threshold > 0 && (c.LoadShed.Window <= 0 || c.LoadShed.MinSamples < 1):
+		return errors.New("shed window must be positive and shed min samples at least 1")
+	case slices.ContainsFunc(c.RateLimit.Methods, func(m string) bool { return m == "" || m != strings.ToUpper(m) }):
+		return fmt.Errorf("rate limit methods must be upper-case HTTP methods, got %q", c.RateLimit.Methods)
+	case c.Chaos.Rate < 0 || c.Chaos.Rate > 1:
+		return errors.New("chaos rate must be in [0, 1]")
+	case c.Chaos.MaxDelay < 0:
+		return errors.New("chaos max delay must not be negative")
+	case c.Mode.Start != "read-write" && c.Mode.Start != "maintenance" && c.Mode.Start != "read-only":
+		return fmt.Errorf("mode must be read-write, maintenance or read-only, got %q", c.Mode.Start)
+	case c.Mode.RetryAfter < 0:
+		return errors.New("mode retry-after must not be negative")
+	case c.Mode.Start == "read-only" && (c.Restore != "" || c.MigrateOnStart):
+		return errors.New("restore and migrate-on-start cannot run in read-only mode")
+	case c.Raft.NodeID != "" && c.Mode.Start != "read-write":
+		return errors.New("a replicated instance must start in read-write mode")
+	case c.Raft.NodeID != "" && (c.Raft.Addr == "" || c.Raft.Dir == ""):
+		return errors.New("raft addr and dir must not be empty")
+	case c.Shadow.DBPath != "" && c.Raft.NodeID != "":
+		return errors.New("a replicated instance cannot shadow its writes")
+	case c.Shadow.DBPath != "" && c.Shadow.DBPath == c.DBPath:
+		return errors.New("shadow db must not be the db itself")
+	case c.Shadow.Encoding != "" && c.Shadow.Encoding != "json" && c.Shadow.Encoding != "msgpack" && c.Shadow.Encoding != "protobuf":
+		return fmt.Errorf("shadow db encoding must be json, msgpack or protobuf, got %q", c.Shadow.Encoding)
+	case c.Tracing.Exporter != "none" && c.Tracing.Exporter != "stdout" && c.Tracing.Exporter != "otlp":
+		return fmt.Errorf("trace exporter must be none, stdout or otlp, got %q", c.Tracing.Exporter)
+	case c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1:
+		return errors.New("trace sample ratio must be in [0, 1]")
+	case c.Server.MaxHeaderBytes <= 0:
+		return errors.New("max header bytes must be positive")
+	case c.Server.MaxBodyBytes <= 0:
+		return errors.New("max body bytes must be positive")
+	case c.Server.MaxUploadBytes <= 0:
+		return errors.New("max upload bytes must be positive")
+	case c.Server.DeleteStatus != 200 && c.Server.DeleteStatus != 204:
+		return fmt.Errorf("delete status must be 200 or 204, got %d", c.Server.DeleteStatus)
+	case c.Server.DuplicateStatus != 200 && c.Server.DuplicateStatus != 409:
+		return fmt.Errorf("duplicate status must be 200 or 409, got %d", c.Server.DuplicateStatus)
+	case c.Server.AsyncWorkers < 0:
+		return fmt.Errorf("async workers must not be negative, got %d", c.Server.AsyncWorkers)
+	case c.Backup.Interval < 0:
+		return errors.New("backup interval must not be negative")
+	case !validSchedule(c.Backup.Schedule):
+		return fmt.Errorf("backup schedule %q is not a valid cron expression", c.Backup.Schedule)
+	case c.Backup.Spec() != "" && c.Backup.Dir == "":
+		return errors.New("backup dir must not be empty")
+	case c.Compaction.Threshold < 0 || c.Compaction.Threshold >= 1:
+		return errors.New("compaction threshold must be in [0, 1)")
+	case !validSchedule(c.Compaction.Schedule):
+		return fmt.Errorf("compaction schedule %q is not a valid cron expression", c.Compaction.Schedule)
+	case c.Compaction.Threshold > 0 && c.Compaction.Spec() == "":
+		return errors.New("compaction interval must be positive")
+	case c.Retention.Days < 0:
+		return errors.New("retention days must not be negative")
+	case !validSchedule(c.Retention.Schedule):
+		return fmt.Errorf("retention schedule %q is not a valid cron expression", c.Retention.Schedule)
+	case c.Retention.Days > 0 && c.Retention.Spec() == "":
+		return errors.New("retention interval must be positive")
+	case c.Batch.MaxSize < 0:
+		return errors.New("batch max size must not be negative")
+	case c.Batch.MaxSize > 0 && c.Batch.Delay <= 0:
+		return errors.New("batch delay must be positive")
+	case c.Retry.Attempts < 1:
+		return errors.New("retry attempts must be at least 1")
+	case c.Retry.MinBackoff < 0 || c.Retry.MaxBackoff < c.Retry.MinBackoff:
+		return errors.New("retry backoffs must not be negative, and the max must not be below the min")
+	case c.Breaker.Failures < 0:
+		return errors.New("breaker failures must not be negative")
+	case c.Breaker.Failures > 0 && c.Breaker.Cooldown <= 0:
+		return errors.New("breaker cooldown must be positive")
+	case c.Jobs.Workers < 1:
+		return errors.New("job workers must be at least 1")
+	case c.Jobs.MaxAttempts < 1:
+		return errors.New("job max attempts must be at least 1")
+	case c.Jobs.RetryDelay <= 0:
+		return errors.New("job retry delay must be positive")
+	case !validURLs(c.Webhook.URLs):
+		return errors.New("webhook urls must be absolute http or https URLs")
+	case len(c.Webhook.URLs) > 0 && c.Webhook.Timeout <= 0:
+		return errors.New("webhook timeout must be positive")
+	case len(c.Webhook.URLs) > 0 && c.Webhook.Source == "":
+		return errors.New("webhook source must not be empty")
+	case c.Rates.Provider != "" && c.Rates.Provider != "static" && c.Rates.Provider != "ecb":
+		return fmt.Errorf("rates provider must be static or ecb, got %q", c.Rates.Provider)
+	case c.Rates.Provider == "static" && len(c.Rates.Static) == 0:
+		return errors.New("static rates must not be empty")
+	case c.Rates.URL != "" && !validURLs([]string{c.Rates.URL}):
+		return errors.New("rates url must be an absolute http or https URL")
+	case !validSchedule(c.Rates.Schedule):
+		return fmt.Errorf("rates schedule %q is not a valid cron expression", c.Rates.Schedule)
+	case c.Rates.Provider != "" && c.Rates.Spec() == "":
+		return errors.New("rates interval must be positive")
+	case c.Rates.Provider != "" && c.Rates.Timeout <= 0:
+		return errors.New("rates timeout must be positive")
+	case c.Policy.MerchantVelocity < 0:
+		return errors.New("policy merchant velocity must not be negative")
+	case (c.TLS.CertFile == "") != (c.TLS.KeyFile == ""):
+		return errors.New("tls cert and key must be set together")
+	case c.TLS.CertFile != "" && c.TLS.AutocertHost != "":
+		return errors.New("tls cert and autocert host are mutually exclusive")
+	case c.TLS.AutocertHost != "" && c.TLS.AutocertDir == "":
+		return errors.New("autocert dir must not be empty")
+	case c.TLS.ClientCAFile != "" && !c.TLS.Enabled():
+		return errors.New("tls client CA requires a certificate or autocert host")
+	case c.Idempotency.KeyFormat != "any" && c.Idempotency.KeyFormat != "uuid" && c.Idempotency.KeyFormat != "ulid":
+		return fmt.Errorf("idempotency key format must be any, uuid or ulid, got %q", c.Idempotency.KeyFormat)
+	case !validPattern(c.Idempotency.KeyPattern):
+		return fmt.Errorf("idempotency key pattern %q is not a valid regular expression", c.Idempotency.KeyPattern)
+	case c.Idempotency.KeyTTL < 0:
+		return errors.New("idempotency key TTL must not be negative")
+	case c.Idempotency.SweepSchedule == "" || !validSchedule(c.Idempotency.SweepSchedule):
+		return fmt.Errorf("key sweep schedule %q is not a valid cron expression", c.Idempotency.SweepSchedule)
+	case c.Auth.JWT.Secret != "" && c.Auth.JWT.JWKSURL != "":
+		return errors.New("jwt secret and JWKS URL are mutually exclusive")
+	}
+	if _, err := c.Policy.Rules(); err != nil {
+		return err
+	}
+	if _, _, _, err := c.Network.Prefixes(); err != nil {
+		return err
+	}
+	return c.Raft.validatePeers()
+}
+
+// validatePeers checks that the peers parse and include this instance at
+// its address.
+func (r RaftConfig) validatePeers() error {
+	if r.NodeID == "" {
+		return nil
+	}
+	peers, err := r.PeerMap()
+	if err != nil {
+		return err
+	}
+	if peers[r.NodeID] != r.Addr {
+		return fmt.Errorf("raft peers must include %s=%s", r.NodeID, r.Addr)
+	}
+	return nil
+}
+
+func validURLs(urls []string) bool {
+	for _, u := range urls {
+		parsed, err := url.Parse(u)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return false
+		}
+	}
+	return true
+}
+
+// validSchedule reports whether s is empty or a valid cron expression.
+func validSchedule(s string) bool {
+	if s == "" {
+		return true
+	}
+	_, err := cron.Parse(s)
+	return err == nil
+}
+
+func validPattern(p string) bool {
+	_, err := regexp.Compile(p)
+	return err == nil
+}
+
+// Helpers that adapt a typed field accessor into a setting.set function.
+
+func str(field func(*Config) *string) setFunc {
+	return func(c *Config, v string) error {
+		*field(c) = v
+		return nil
+	}
+}
+
+func list(field func(*Config) *[]string) setFunc {
+	return func(c *Config, v string) error {
+		var out []string
+		for _, s := range strings.Split(v, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				out = append(out, s)
+			}
+		}
+		*field(c) = out
+		return nil
+	}
+}
+
+func boolean(field func(*Config) *bool) boolFunc {
+	return func(c *Config, v string) error {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return err
+		}
+		*field(c) = b
+		return nil
+	}
+}
+
+func dur(field func(*Config) *time.Duration) setFunc {
+	return func(c *Config, v string) error {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return err
+		}
+		*field(c) = d
+		return nil
+	}
+}
+
+func integer(field func(*Config) *int) setFunc {
+	return func(c *Config, v string) error {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return err
+		}
+		*field(c) = n
+		return nil
+	}
+}
+
+func float(field func(*Config) *float64) setFunc {
+	return func(c *Config, v string) error {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return err
+		}
+		*field(c) = f
+		return nil
+	}
+}
@@ -0,0 +1,123 @@
+package config_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/arkantrust/idempotency-example/backend/config"
+)
+
+func TestLoadDefaults(t *testing.T) {
+	cfg, err := config.Load(nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Port != "8080" || cfg.DBPath != "chargebacks.db" {
+		t.Fatalf("unexpected defaults: port=%q db=%q", cfg.Port, cfg.DBPath)
+	}
+	if cfg.Chaos.Rate != 0 || cfg.Chaos.Simulate {
+		t.Fatalf("expected fault injection off by default, got %+v", cfg.Chaos)
+	}
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	data := "port: \"7000\"\ndbPath: file.db\nserver:\n  readTimeout: 1s\n  writeTimeout: 2s\n"
+	if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+
+	// File < env < flag.
+	t.Setenv("CONFIG_FILE", path)
+	t.Setenv("DB_PATH", "env.db")
+	t.Setenv("PORT", "7001")
+	t.Setenv("READ_TIMEOUT", "3s")
+
+	cfg, err := config.Load([]string{"-port", "7002"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Port != "7002" {
+		t.Fatalf("expected flag to win for port, got %q", cfg.Port)
+	}
+	if cfg.DBPath != "env.db" {
+		t.Fatalf("expected env to win for db path, got %q", cfg.DBPath)
+	}
+	if cfg.Server.ReadTimeout != 3*time.Second {
+		t.Fatalf("expected env to win for read timeout, got %s", cfg.Server.ReadTimeout)
+	}
+	if cfg.Server.WriteTimeout != 2*time.Second {
+		t.Fatalf("expected file value for write timeout, got %s", cfg.Server.WriteTimeout)
+	}
+	if cfg.Server.IdleTimeout != 120*time.Second {
+		t.Fatalf("expected default idle timeout, got %s", cfg.Server.IdleTimeout)
+	}
+}
+
+func TestLoadRejectsUnknownFileKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("prot: \"9000\"\n"), 0600); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+	if _, err := config.Load([]string{"-config", path}); err == nil {
+		t.Fatal("expected error for unknown key")
+	}
+}
+
+func TestLoadValidates(t *testing.T) {
+	if _, err := config.Load([]string{"-compact-threshold", "1.5"}); err == nil {
+		t.Fatal("expected error for out-of-range threshold")
+	}
+	if _, err := config.Load([]string{"-tls-cert", "cert.pem"}); err == nil {
+		t.Fatal("expected error for TLS cert without key")
+	}
+	if _, err := config.Load([]string{"-chaos-rate", "2"}); err == nil {
+		t.Fatal("expected error for out-of-range chaos rate")
+	}
+	if _, err := config.Load([]string{"-mode", "read-only", "-migrate-on-start"}); err == nil {
+		t.Fatal("expected error for migrating in read-only mode")
+	}
+	raft := []string{"-raft-node-id", "n1", "-raft-addr", "10.0.0.1:7000"}
+	if _, err := config.Load(append(raft, "-raft-peers", "n2=10.0.0.2:7000,n3=10.0.0.3:7000")); err == nil {
+		t.Fatal("expected error for raft peers missing this instance")
+	}
+	if _, err := config.Load(append(raft, "-raft-peers", "n1=10.0.0.1:7000,n2=10.0.0.2:7000")); err != nil {
+		t.Fatalf("unexpected error for a valid raft cluster: %v", err)
+	}
+	if _, err := config.Load([]string{"-policy-max-amounts", "USD=ten"}); err == nil {
+		t.Fatal("expected error for a policy amount that is not a number")
+	}
+	if _, err := config.Load([]string{"-rate-limit-methods", "post"}); err == nil {
+		t.Fatal("expected error for a lower-case rate limit method")
+	}
+	if _, err := config.Load([]string{"-rates-provider", "static"}); err == nil {
+		t.Fatal("expected error for static rates without rates")
+	}
+	if _, err := config.Load([]string{"-db", "a.db", "-shadow-db", "a.db"}); err == nil {
+		t.Fatal("expected error for a database shadowing itself")
+	}
+	if _, err := config.Load([]string{"-db-durability", "reckless"}); err == nil {
+		t.Fatal("expected error for an unknown durability")
+	}
+	if _, err := config.Load([]string{"-cors-origins", "*", "-cors-credentials"}); err == nil {
+		t.Fatal("expected error for credentials allowed to any origin")
+	}
+	if _, err := config.Load([]string{"-trusted-proxies", "10.0.0.0/33"}); err == nil {
+		t.Fatal("expected error for an invalid trusted proxy CIDR")
+	}
+	if _, err := config.Load([]string{"-ip-allow", "10.0.0.0/8,192.0.2.1"}); err != nil {
+		t.Fatalf("unexpected error for a valid allowlist: %v", err)
+	}
+}
+
+func TestLoadBareBoolFlag(t *testing.T) {
+	cfg, err := config.Load([]string{"-debug", "-debug-token", "s3cret"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !cfg.Debug.Enabled || cfg.Debug.Token != "s3cret" {
+		t.Fatalf("expected debug enabled with token, got %+v", cfg.Debug)
+	}
+}
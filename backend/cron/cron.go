@@ -0,0 +1,206 @@
+// Package cron parses cron expressions and computes when they next fire.
+//
+// An expression has the five standard fields, in UTC:
+//
+//	minute (0-59)  hour (0-23)  day of month (1-31)  month (1-12)  day of week (0-6, Sunday = 0 or 7)
+//
+// Each field is "*", a value, a range "a-b", a list "a,b,c", or any of those
+// with a step: "*/15", "8-18/2". Months and days of the week may also be
+// named: "jan", "mon". As in Vixie cron, when both the day of the month and
+// the day of the week are restricted, a day matching either one fires.
+//
+// The descriptors @yearly (or @annually), @monthly, @weekly, @daily (or
+// @midnight) and @hourly stand for the usual expressions, and "@every 90m"
+// fires at a fixed interval, counted from the previous firing.
+package cron
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule says when a job fires.
+type Schedule interface {
+	// Next returns the first time after t the schedule fires.
+	Next(t time.Time) time.Time
+}
+
+// Parse parses a cron expression or descriptor.
+func Parse(spec string) (Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	if rest, ok := strings.CutPrefix(spec, "@every "); ok {
+		d, err := time.ParseDuration(strings.TrimSpace(rest))
+		if err != nil {
+			return nil, fmt.Errorf("cron %q: %w", spec, err)
+		}
+		if d < time.Second {
+			return nil, fmt.Errorf("cron %q: interval must be at least 1s", spec)
+		}
+		return every(d), nil
+	}
+	if expr, ok := descriptors[spec]; ok {
+		spec = expr
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != len(ranges) {
+		return nil, fmt.Errorf("cron %q: expected 5 fields, got %d", spec, len(fields))
+	}
+	var s fieldSchedule
+	sets := []*uint64{&s.minute, &s.hour, &s.dom, &s.month, &s.dow}
+	for i, f := range fields {
+		set, err := parseField(f, ranges[i])
+		if err != nil {
+			return nil, fmt.Errorf("cron %q: %s: %w", spec, ranges[i].name, err)
+		}
+		*sets[i] = set
+	}
+	// Sunday is 0 and 7.
+	if s.dow&(1<<7) != 0 {
+		s.dow = s.dow&^(1<<7) | 1
+	}
+	s.anyDOM = fields[2] == "*" || strings.HasPrefix(fields[2], "*/")
+	s.anyDOW = fields[4] == "*" || strings.HasPrefix(fields[4], "*/")
+	return &s, nil
+}
+
+// descriptors are the expressions the @ names stand for.
+var descriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// bounds describes the values a field takes.
+type bounds struct {
+	name     string
+	min, max int
+	names    []string // names[i] stands for min+i
+}
+
+var ranges = []bounds{
+	{name: "minute", min: 0, max: 59},
+	{name: "hour", min: 0, max: 23},
+	{name: "day of month", min: 1, max: 31},
+	{name: "month", min: 1, max: 12, names: []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}},
+	{name: "day of week", min: 0, max: 7, names: []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}},
+}
+
+// parseField returns the set of values field selects, as bits.
+func parseField(field string, b bounds) (uint64, error) {
+	var set uint64
+	for _, part := range strings.Split(field, ",") {
+		expr, stepText, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepText)
+			if err != nil || n < 1 {
+				return 0, fmt.Errorf("invalid step %q", stepText)
+			}
+			step = n
+		}
+
+		lo, hi := b.min, b.max
+		switch {
+		case expr == "*":
+		case strings.Contains(expr, "-"):
+			from, to, _ := strings.Cut(expr, "-")
+			var err error
+			if lo, err = b.value(from); err != nil {
+				return 0, err
+			}
+			if hi, err = b.value(to); err != nil {
+				return 0, err
+			}
+			if lo > hi {
+				return 0, fmt.Errorf("range %q runs backwards", expr)
+			}
+		default:
+			v, err := b.value(expr)
+			if err != nil {
+				return 0, err
+			}
+			lo = v
+			if !hasStep {
+				hi = v
+			}
+		}
+		for v := lo; v <= hi; v += step {
+			set |= 1 << v
+		}
+	}
+	return set, nil
+}
+
+// value parses a single value of the field, a number or a name.
+func (b bounds) value(s string) (int, error) {
+	for i, name := range b.names {
+		if strings.EqualFold(s, name) {
+			return b.min + i, nil
+		}
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < b.min || v > b.max {
+		return 0, fmt.Errorf("invalid value %q: expected %d to %d", s, b.min, b.max)
+	}
+	return v, nil
+}
+
+// fieldSchedule is a parsed five-field expression: the minutes, hours and so
+// on it fires at, as bit sets.
+type fieldSchedule struct {
+	minute, hour, dom, month, dow uint64
+
+	// anyDOM and anyDOW record a "*" day field, which does not restrict
+	// the other.
+	anyDOM, anyDOW bool
+}
+
+// maxSearch bounds the search for a time that matches, so that an
+// expression that never fires, like "0 0 31 2 *", does not loop forever.
+const maxSearch = 5
+
+// Next returns the first minute after t, in UTC, that matches s, or the
+// zero time if none does within five years.
+func (s *fieldSchedule) Next(t time.Time) time.Time {
+	t = t.UTC().Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(maxSearch, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case s.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+		case !s.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, time.UTC)
+		case s.hour&(1<<uint(t.Hour())) == 0:
+			t = t.Truncate(time.Hour).Add(time.Hour)
+		case s.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// dayMatches applies the Vixie cron rule: with both day fields restricted,
+// either may match.
+func (s *fieldSchedule) dayMatches(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.anyDOM || s.anyDOW {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// every fires at a fixed interval.
+type every time.Duration
+
+// Next returns t plus the interval.
+func (e every) Next(t time.Time) time.Time { return t.Add(time.Duration(e)) }
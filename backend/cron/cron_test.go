@@ -0,0 +1,70 @@
+package cron_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/arkantrust/idempotency-example/backend/cron"
+)
+
+func TestNext(t *testing.T) {
+	// A Monday.
+	from := time.Date(2024, 1, 1, 10, 7, 30, 0, time.UTC)
+	for spec, want := range map[string]string{
+		"* * * * *":          "2024-01-01T10:08:00Z",
+		"*/15 * * * *":       "2024-01-01T10:15:00Z",
+		"0 * * * *":          "2024-01-01T11:00:00Z",
+		"@hourly":            "2024-01-01T11:00:00Z",
+		"30 2 * * *":         "2024-01-02T02:30:00Z",
+		"@daily":             "2024-01-02T00:00:00Z",
+		"0 9-17/4 * * *":     "2024-01-01T13:00:00Z",
+		"0 0 * * sun":        "2024-01-07T00:00:00Z",
+		"0 0 * * 7":          "2024-01-07T00:00:00Z",
+		"0 0 1 * *":          "2024-02-01T00:00:00Z",
+		"0 0 29 feb *":       "2024-02-29T00:00:00Z",
+		"0 0 13 * fri":       "2024-01-05T00:00:00Z", // Vixie cron: either day field
+		"0 0 1,15 mar-apr *": "2024-03-01T00:00:00Z",
+		"@every 90m":         "2024-01-01T11:37:30Z",
+	} {
+		s, err := cron.Parse(spec)
+		if err != nil {
+			t.Errorf("%q: %v", spec, err)
+			continue
+		}
+		if got := s.Next(from).Format(time.RFC3339); got != want {
+			t.Errorf("%q: expected %s, got %s", spec, want, got)
+		}
+	}
+}
+
+func TestNextNeverFiring(t *testing.T) {
+	s, err := cron.Parse("0 0 31 2 *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := s.Next(time.Now()); !got.IsZero() {
+		t.Fatalf("expected no time, got %v", got)
+	}
+}
+
+func TestParseRejectsMalformedExpressions(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"* * * foo *",
+		"@every",
+		"@every 1ms",
+		"@sometimes",
+	} {
+		if _, err := cron.Parse(spec); err == nil {
+			t.Errorf("%q: expected an error", spec)
+		}
+	}
+}
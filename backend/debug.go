@@ -0,0 +1,34 @@
+package main
+
+import (
+	"expvar"
+	"net/http/pprof"
+
+	"github.com/arkantrust/idempotency-example/backend/middleware"
+)
+
+// mountDebug registers net/http/pprof and expvar under /debug on r. When
+// token is non-empty every debug route requires "Authorization: Bearer
+// <token>": profiles expose memory contents and command-line arguments, so
+// they should never be public.
+//
+// To profile the write path under concurrent retries, run a load test and
+// capture e.g.
+//
+//	go tool pprof http://localhost:8080/debug/pprof/profile?seconds=30
+//	go tool pprof http://localhost:8080/debug/pprof/mutex
+//
+// The handlers are registered explicitly rather than by importing
+// net/http/pprof for its side effects, which would attach them to
+// http.DefaultServeMux regardless of configuration.
+func mountDebug(r *middleware.Router, token string) {
+	r = r.With(middleware.BearerToken(token))
+
+	r.HandleFunc("GET /debug/pprof/", pprof.Index)
+	r.HandleFunc("GET /debug/pprof/cmdline", pprof.Cmdline)
+	r.HandleFunc("GET /debug/pprof/profile", pprof.Profile)
+	r.HandleFunc("GET /debug/pprof/symbol", pprof.Symbol)
+	r.HandleFunc("POST /debug/pprof/symbol", pprof.Symbol)
+	r.HandleFunc("GET /debug/pprof/trace", pprof.Trace)
+	r.Handle("GET /debug/vars", expvar.Handler())
+}
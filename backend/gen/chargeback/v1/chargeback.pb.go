@@ -0,0 +1,562 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.12
+// 	protoc        (unknown)
+// source: chargeback/v1/chargeback.proto
+
+// The gRPC face of the chargebacks API. It follows the same idempotency rules
+// as the HTTP routes:
+//
+//   - CreateChargeback with an id is idempotent on that id, like
+//     POST /chargebacks/{id}.
+//   - CreateChargeback without an id needs an "idempotency-key" metadata
+//     entry, like POST /chargebacks with an Idempotency-Key header.
+//   - UpdateChargeback skips the write when nothing changed and reports it
+//     in the "x-idempotency-write" response header.
+//   - DeleteChargeback succeeds whether or not the record existed.
+//
+// Any mutating call may carry "idempotency-key"; a retry with the same key
+// and request gets the first response back with "idempotency-replayed: true".
+
+package chargebackv1
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	fieldmaskpb "google.golang.org/protobuf/types/known/fieldmaskpb"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type Chargeback struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// The record ID, which is also its natural idempotency key.
+	Id string `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	// Amount in minor currency units, e.g. cents.
+	Amount int64 `protobuf:"varint,2,opt,name=amount,proto3" json:"amount,omitempty"`
+	// ISO 4217 currency code.
+	Currency string `protobuf:"bytes,3,opt,name=currency,proto3" json:"currency,omitempty"`
+	Reason   string `protobuf:"bytes,4,opt,name=reason,proto3" json:"reason,omitempty"`
+	// The API key or JWT subject that created the record.
+	Owner         string                 `protobuf:"bytes,5,opt,name=owner,proto3" json:"owner,omitempty"`
+	CreateTime    *timestamppb.Timestamp `protobuf:"bytes,6,opt,name=create_time,json=createTime,proto3" json:"create_time,omitempty"`
+	UpdateTime    *timestamppb.Timestamp `protobuf:"bytes,7,opt,name=update_time,json=updateTime,proto3" json:"update_time,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Chargeback) Reset() {
+	*x = Chargeback{}
+	mi := &file_chargeback_v1_chargeback_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Chargeback) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Chargeback) ProtoMessage() {}
+
+func (x *Chargeback) ProtoReflect() protoreflect.Message {
+	mi := &file_chargeback_v1_chargeback_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Chargeback.ProtoReflect.Descriptor instead.
+func (*Chargeback) Descriptor() ([]byte, []int) {
+	return file_chargeback_v1_chargeback_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Chargeback) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Chargeback) GetAmount() int64 {
+	if x != nil {
+		return x.Amount
+	}
+	return 0
+}
+
+func (x *Chargeback) GetCurrency() string {
+	if x != nil {
+		return x.Currency
+	}
+	return ""
+}
+
+func (x *Chargeback) GetReason() string {
+	if x != nil {
+		return x.Reason
+	}
+	return ""
+}
+
+func (x *Chargeback) GetOwner() string {
+	if x != nil {
+		return x.Owner
+	}
+	return ""
+}
+
+func (x *Chargeback) GetCreateTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.CreateTime
+	}
+	return nil
+}
+
+func (x *Chargeback) GetUpdateTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.UpdateTime
+	}
+	return nil
+}
+
+type ListChargebacksRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListChargebacksRequest) Reset() {
+	*x = ListChargebacksRequest{}
+	mi := &file_chargeback_v1_chargeback_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListChargebacksRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListChargebacksRequest) ProtoMessage() {}
+
+func (x *ListChargebacksRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_chargeback_v1_chargeback_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListChargebacksRequest.ProtoReflect.Descriptor instead.
+func (*ListChargebacksRequest) Descriptor() ([]byte, []int) {
+	return file_chargeback_v1_chargeback_proto_rawDescGZIP(), []int{1}
+}
+
+type ListChargebacksResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Chargebacks   []*Chargeback          `protobuf:"bytes,1,rep,name=chargebacks,proto3" json:"chargebacks,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListChargebacksResponse) Reset() {
+	*x = ListChargebacksResponse{}
+	mi := &file_chargeback_v1_chargeback_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListChargebacksResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListChargebacksResponse) ProtoMessage() {}
+
+func (x *ListChargebacksResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_chargeback_v1_chargeback_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListChargebacksResponse.ProtoReflect.Descriptor instead.
+func (*ListChargebacksResponse) Descriptor() ([]byte, []int) {
+	return file_chargeback_v1_chargeback_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *ListChargebacksResponse) GetChargebacks() []*Chargeback {
+	if x != nil {
+		return x.Chargebacks
+	}
+	return nil
+}
+
+type GetChargebackRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetChargebackRequest) Reset() {
+	*x = GetChargebackRequest{}
+	mi := &file_chargeback_v1_chargeback_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetChargebackRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetChargebackRequest) ProtoMessage() {}
+
+func (x *GetChargebackRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_chargeback_v1_chargeback_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetChargebackRequest.ProtoReflect.Descriptor instead.
+func (*GetChargebackRequest) Descriptor() ([]byte, []int) {
+	return file_chargeback_v1_chargeback_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *GetChargebackRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+type CreateChargebackRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// id, amount, currency and reason are read; an empty id asks the server to
+	// mint one.
+	Chargeback    *Chargeback `protobuf:"bytes,1,opt,name=chargeback,proto3" json:"chargeback,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CreateChargebackRequest) Reset() {
+	*x = CreateChargebackRequest{}
+	mi := &file_chargeback_v1_chargeback_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CreateChargebackRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CreateChargebackRequest) ProtoMessage() {}
+
+func (x *CreateChargebackRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_chargeback_v1_chargeback_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CreateChargebackRequest.ProtoReflect.Descriptor instead.
+func (*CreateChargebackRequest) Descriptor() ([]byte, []int) {
+	return file_chargeback_v1_chargeback_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *CreateChargebackRequest) GetChargeback() *Chargeback {
+	if x != nil {
+		return x.Chargeback
+	}
+	return nil
+}
+
+type UpdateChargebackRequest struct {
+	state      protoimpl.MessageState `protogen:"open.v1"`
+	Chargeback *Chargeback            `protobuf:"bytes,1,opt,name=chargeback,proto3" json:"chargeback,omitempty"`
+	// Limits the update to these fields ("amount", "currency", "reason"). An
+	// empty mask updates all of them.
+	UpdateMask    *fieldmaskpb.FieldMask `protobuf:"bytes,2,opt,name=update_mask,json=updateMask,proto3" json:"update_mask,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UpdateChargebackRequest) Reset() {
+	*x = UpdateChargebackRequest{}
+	mi := &file_chargeback_v1_chargeback_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UpdateChargebackRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UpdateChargebackRequest) ProtoMessage() {}
+
+func (x *UpdateChargebackRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_chargeback_v1_chargeback_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UpdateChargebackRequest.ProtoReflect.Descriptor instead.
+func (*UpdateChargebackRequest) Descriptor() ([]byte, []int) {
+	return file_chargeback_v1_chargeback_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *UpdateChargebackRequest) GetChargeback() *Chargeback {
+	if x != nil {
+		return x.Chargeback
+	}
+	return nil
+}
+
+func (x *UpdateChargebackRequest) GetUpdateMask() *fieldmaskpb.FieldMask {
+	if x != nil {
+		return x.UpdateMask
+	}
+	return nil
+}
+
+type DeleteChargebackRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteChargebackRequest) Reset() {
+	*x = DeleteChargebackRequest{}
+	mi := &file_chargeback_v1_chargeback_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteChargebackRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteChargebackRequest) ProtoMessage() {}
+
+func (x *DeleteChargebackRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_chargeback_v1_chargeback_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteChargebackRequest.ProtoReflect.Descriptor instead.
+func (*DeleteChargebackRequest) Descriptor() ([]byte, []int) {
+	return file_chargeback_v1_chargeback_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *DeleteChargebackRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+type DeleteChargebackResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Whether a record was removed. A retry reports false but still succeeds.
+	Existed       bool `protobuf:"varint,1,opt,name=existed,proto3" json:"existed,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteChargebackResponse) Reset() {
+	*x = DeleteChargebackResponse{}
+	mi := &file_chargeback_v1_chargeback_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteChargebackResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteChargebackResponse) ProtoMessage() {}
+
+func (x *DeleteChargebackResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_chargeback_v1_chargeback_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteChargebackResponse.ProtoReflect.Descriptor instead.
+func (*DeleteChargebackResponse) Descriptor() ([]byte, []int) {
+	return file_chargeback_v1_chargeback_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *DeleteChargebackResponse) GetExisted() bool {
+	if x != nil {
+		return x.Existed
+	}
+	return false
+}
+
+var File_chargeback_v1_chargeback_proto protoreflect.FileDescriptor
+
+const file_chargeback_v1_chargeback_proto_rawDesc = "" +
+	"\n" +
+	"\x1echargeback/v1/chargeback.proto\x12\rchargeback.v1\x1a google/protobuf/field_mask.proto\x1a\x1fgoogle/protobuf/timestamp.proto\"\xf8\x01\n" +
+	"\n" +
+	"Chargeback\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x16\n" +
+	"\x06amount\x18\x02 \x01(\x03R\x06amount\x12\x1a\n" +
+	"\bcurrency\x18\x03 \x01(\tR\bcurrency\x12\x16\n" +
+	"\x06reason\x18\x04 \x01(\tR\x06reason\x12\x14\n" +
+	"\x05owner\x18\x05 \x01(\tR\x05owner\x12;\n" +
+	"\vcreate_time\x18\x06 \x01(\v2\x1a.google.protobuf.TimestampR\n" +
+	"createTime\x12;\n" +
+	"\vupdate_time\x18\a \x01(\v2\x1a.google.protobuf.TimestampR\n" +
+	"updateTime\"\x18\n" +
+	"\x16ListChargebacksRequest\"V\n" +
+	"\x17ListChargebacksResponse\x12;\n" +
+	"\vchargebacks\x18\x01 \x03(\v2\x19.chargeback.v1.ChargebackR\vchargebacks\"&\n" +
+	"\x14GetChargebackRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\"T\n" +
+	"\x17CreateChargebackRequest\x129\n" +
+	"\n" +
+	"chargeback\x18\x01 \x01(\v2\x19.chargeback.v1.ChargebackR\n" +
+	"chargeback\"\x91\x01\n" +
+	"\x17UpdateChargebackRequest\x129\n" +
+	"\n" +
+	"chargeback\x18\x01 \x01(\v2\x19.chargeback.v1.ChargebackR\n" +
+	"chargeback\x12;\n" +
+	"\vupdate_mask\x18\x02 \x01(\v2\x1a.google.protobuf.FieldMaskR\n" +
+	"updateMask\")\n" +
+	"\x17DeleteChargebackRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\"4\n" +
+	"\x18DeleteChargebackResponse\x12\x18\n" +
+	"\aexisted\x18\x01 \x01(\bR\aexisted2\xd9\x03\n" +
+	"\x11ChargebackService\x12`\n" +
+	"\x0fListChargebacks\x12%.chargeback.v1.ListChargebacksRequest\x1a&.chargeback.v1.ListChargebacksResponse\x12O\n" +
+	"\rGetChargeback\x12#.chargeback.v1.GetChargebackRequest\x1a\x19.chargeback.v1.Chargeback\x12U\n" +
+	"\x10CreateChargeback\x12&.chargeback.v1.CreateChargebackRequest\x1a\x19.chargeback.v1.Chargeback\x12U\n" +
+	"\x10UpdateChargeback\x12&.chargeback.v1.UpdateChargebackRequest\x1a\x19.chargeback.v1.Chargeback\x12c\n" +
+	"\x10DeleteChargeback\x12&.chargeback.v1.DeleteChargebackRequest\x1a'.chargeback.v1.DeleteChargebackResponseBRZPgithub.com/arkantrust/idempotency-example/backend/gen/chargeback/v1;chargebackv1b\x06proto3"
+
+var (
+	file_chargeback_v1_chargeback_proto_rawDescOnce sync.Once
+	file_chargeback_v1_chargeback_proto_rawDescData []byte
+)
+
+func file_chargeback_v1_chargeback_proto_rawDescGZIP() []byte {
+	file_chargeback_v1_chargeback_proto_rawDescOnce.Do(func() {
+		file_chargeback_v1_chargeback_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_chargeback_v1_chargeback_proto_rawDesc), len(file_chargeback_v1_chargeback_proto_rawDesc)))
+	})
+	return file_chargeback_v1_chargeback_proto_rawDescData
+}
+
+var file_chargeback_v1_chargeback_proto_msgTypes = make([]protoimpl.MessageInfo, 8)
+var file_chargeback_v1_chargeback_proto_goTypes = []any{
+	(*Chargeback)(nil),               // 0: chargeback.v1.Chargeback
+	(*ListChargebacksRequest)(nil),   // 1: chargeback.v1.ListChargebacksRequest
+	(*ListChargebacksResponse)(nil),  // 2: chargeback.v1.ListChargebacksResponse
+	(*GetChargebackRequest)(nil),     // 3: chargeback.v1.GetChargebackRequest
+	(*CreateChargebackRequest)(nil),  // 4: chargeback.v1.CreateChargebackRequest
+	(*UpdateChargebackRequest)(nil),  // 5: chargeback.v1.UpdateChargebackRequest
+	(*DeleteChargebackRequest)(nil),  // 6: chargeback.v1.DeleteChargebackRequest
+	(*DeleteChargebackResponse)(nil), // 7: chargeback.v1.DeleteChargebackResponse
+	(*timestamppb.Timestamp)(nil),    // 8: google.protobuf.Timestamp
+	(*fieldmaskpb.FieldMask)(nil),    // 9: google.protobuf.FieldMask
+}
+var file_chargeback_v1_chargeback_proto_depIdxs = []int32{
+	8,  // 0: chargeback.v1.Chargeback.create_time:type_name -> google.protobuf.Timestamp
+	8,  // 1: chargeback.v1.Chargeback.update_time:type_name -> google.protobuf.Timestamp
+	0,  // 2: chargeback.v1.ListChargebacksResponse.chargebacks:type_name -> chargeback.v1.Chargeback
+	0,  // 3: chargeback.v1.CreateChargebackRequest.chargeback:type_name -> chargeback.v1.Chargeback
+	0,  // 4: chargeback.v1.UpdateChargebackRequest.chargeback:type_name -> chargeback.v1.Chargeback
+	9,  // 5: chargeback.v1.UpdateChargebackRequest.update_mask:type_name -> google.protobuf.FieldMask
+	1,  // 6: chargeback.v1.ChargebackService.ListChargebacks:input_type -> chargeback.v1.ListChargebacksRequest
+	3,  // 7: chargeback.v1.ChargebackService.GetChargeback:input_type -> chargeback.v1.GetChargebackRequest
+	4,  // 8: chargeback.v1.ChargebackService.CreateChargeback:input_type -> chargeback.v1.CreateChargebackRequest
+	5,  // 9: chargeback.v1.ChargebackService.UpdateChargeback:input_type -> chargeback.v1.UpdateChargebackRequest
+	6,  // 10: chargeback.v1.ChargebackService.DeleteChargeback:input_type -> chargeback.v1.DeleteChargebackRequest
+	2,  // 11: chargeback.v1.ChargebackService.ListChargebacks:output_type -> chargeback.v1.ListChargebacksResponse
+	0,  // 12: chargeback.v1.ChargebackService.GetChargeback:output_type -> chargeback.v1.Chargeback
+	0,  // 13: chargeback.v1.ChargebackService.CreateChargeback:output_type -> chargeback.v1.Chargeback
+	0,  // 14: chargeback.v1.ChargebackService.UpdateChargeback:output_type -> chargeback.v1.Chargeback
+	7,  // 15: chargeback.v1.ChargebackService.DeleteChargeback:output_type -> chargeback.v1.DeleteChargebackResponse
+	11, // [11:16] is the sub-list for method output_type
+	6,  // [6:11] is the sub-list for method input_type
+	6,  // [6:6] is the sub-list for extension type_name
+	6,  // [6:6] is the sub-list for extension extendee
+	0,  // [0:6] is the sub-list for field type_name
+}
+
+func init() { file_chargeback_v1_chargeback_proto_init() }
+func file_chargeback_v1_chargeback_proto_init() {
+	if File_chargeback_v1_chargeback_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_chargeback_v1_chargeback_proto_rawDesc), len(file_chargeback_v1_chargeback_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   8,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_chargeback_v1_chargeback_proto_goTypes,
+		DependencyIndexes: file_chargeback_v1_chargeback_proto_depIdxs,
+		MessageInfos:      file_chargeback_v1_chargeback_proto_msgTypes,
+	}.Build()
+	File_chargeback_v1_chargeback_proto = out.File
+	file_chargeback_v1_chargeback_proto_goTypes = nil
+	file_chargeback_v1_chargeback_proto_depIdxs = nil
+}
@@ -0,0 +1,287 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.6.2
+// - protoc             (unknown)
+// source: chargeback/v1/chargeback.proto
+
+// The gRPC face of the chargebacks API. It follows the same idempotency rules
+// as the HTTP routes:
+//
+//   - CreateChargeback with an id is idempotent on that id, like
+//     POST /chargebacks/{id}.
+//   - CreateChargeback without an id needs an "idempotency-key" metadata
+//     entry, like POST /chargebacks with an Idempotency-Key header.
+//   - UpdateChargeback skips the write when nothing changed and reports it
+//     in the "x-idempotency-write" response header.
+//   - DeleteChargeback succeeds whether or not the record existed.
+//
+// Any mutating call may carry "idempotency-key"; a retry with the same key
+// and request gets the first response back with "idempotency-replayed: true".
+
+package chargebackv1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	ChargebackService_ListChargebacks_FullMethodName  = "/chargeback.v1.ChargebackService/ListChargebacks"
+	ChargebackService_GetChargeback_FullMethodName    = "/chargeback.v1.ChargebackService/GetChargeback"
+	ChargebackService_CreateChargeback_FullMethodName = "/chargeback.v1.ChargebackService/CreateChargeback"
+	ChargebackService_UpdateChargeback_FullMethodName = "/chargeback.v1.ChargebackService/UpdateChargeback"
+	ChargebackService_DeleteChargeback_FullMethodName = "/chargeback.v1.ChargebackService/DeleteChargeback"
+)
+
+// ChargebackServiceClient is the client API for ChargebackService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type ChargebackServiceClient interface {
+	ListChargebacks(ctx context.Context, in *ListChargebacksRequest, opts ...grpc.CallOption) (*ListChargebacksResponse, error)
+	GetChargeback(ctx context.Context, in *GetChargebackRequest, opts ...grpc.CallOption) (*Chargeback, error)
+	CreateChargeback(ctx context.Context, in *CreateChargebackRequest, opts ...grpc.CallOption) (*Chargeback, error)
+	UpdateChargeback(ctx context.Context, in *UpdateChargebackRequest, opts ...grpc.CallOption) (*Chargeback, error)
+	DeleteChargeback(ctx context.Context, in *DeleteChargebackRequest, opts ...grpc.CallOption) (*DeleteChargebackResponse, error)
+}
+
+type chargebackServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewChargebackServiceClient(cc grpc.ClientConnInterface) ChargebackServiceClient {
+	return &chargebackServiceClient{cc}
+}
+
+func (c *chargebackServiceClient) ListChargebacks(ctx context.Context, in *ListChargebacksRequest, opts ...grpc.CallOption) (*ListChargebacksResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListChargebacksResponse)
+	err := c.cc.Invoke(ctx, ChargebackService_ListChargebacks_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chargebackServiceClient) GetChargeback(ctx context.Context, in *GetChargebackRequest, opts ...grpc.CallOption) (*Chargeback, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Chargeback)
+	err := c.cc.Invoke(ctx, ChargebackService_GetChargeback_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chargebackServiceClient) CreateChargeback(ctx context.Context, in *CreateChargebackRequest, opts ...grpc.CallOption) (*Chargeback, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Chargeback)
+	err := c.cc.Invoke(ctx, ChargebackService_CreateChargeback_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chargebackServiceClient) UpdateChargeback(ctx context.Context, in *UpdateChargebackRequest, opts ...grpc.CallOption) (*Chargeback, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Chargeback)
+	err := c.cc.Invoke(ctx, ChargebackService_UpdateChargeback_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chargebackServiceClient) DeleteChargeback(ctx context.Context, in *DeleteChargebackRequest, opts ...grpc.CallOption) (*DeleteChargebackResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(DeleteChargebackResponse)
+	err := c.cc.Invoke(ctx, ChargebackService_DeleteChargeback_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ChargebackServiceServer is the server API for ChargebackService service.
+// All implementations must embed UnimplementedChargebackServiceServer
+// for forward compatibility.
+type ChargebackServiceServer interface {
+	ListChargebacks(context.Context, *ListChargebacksRequest) (*ListChargebacksResponse, error)
+	GetChargeback(context.Context, *GetChargebackRequest) (*Chargeback, error)
+	CreateChargeback(context.Context, *CreateChargebackRequest) (*Chargeback, error)
+	UpdateChargeback(context.Context, *UpdateChargebackRequest) (*Chargeback, error)
+	DeleteChargeback(context.Context, *DeleteChargebackRequest) (*DeleteChargebackResponse, error)
+	mustEmbedUnimplementedChargebackServiceServer()
+}
+
+// UnimplementedChargebackServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedChargebackServiceServer struct{}
+
+func (UnimplementedChargebackServiceServer) ListChargebacks(context.Context, *ListChargebacksRequest) (*ListChargebacksResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method ListChargebacks not implemented")
+}
+func (UnimplementedChargebackServiceServer) GetChargeback(context.Context, *GetChargebackRequest) (*Chargeback, error) {
+	return nil, status.Error(codes.Unimplemented, "method GetChargeback not implemented")
+}
+func (UnimplementedChargebackServiceServer) CreateChargeback(context.Context, *CreateChargebackRequest) (*Chargeback, error) {
+	return nil, status.Error(codes.Unimplemented, "method CreateChargeback not implemented")
+}
+func (UnimplementedChargebackServiceServer) UpdateChargeback(context.Context, *UpdateChargebackRequest) (*Chargeback, error) {
+	return nil, status.Error(codes.Unimplemented, "method UpdateChargeback not implemented")
+}
+func (UnimplementedChargebackServiceServer) DeleteChargeback(context.Context, *DeleteChargebackRequest) (*DeleteChargebackResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method DeleteChargeback not implemented")
+}
+func (UnimplementedChargebackServiceServer) mustEmbedUnimplementedChargebackServiceServer() {}
+func (UnimplementedChargebackServiceServer) testEmbeddedByValue()                           {}
+
+// UnsafeChargebackServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to ChargebackServiceServer will
+// result in compilation errors.
+type UnsafeChargebackServiceServer interface {
+	mustEmbedUnimplementedChargebackServiceServer()
+}
+
+func RegisterChargebackServiceServer(s grpc.ServiceRegistrar, srv ChargebackServiceServer) {
+	// If the following call panics, it indicates UnimplementedChargebackServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&ChargebackService_ServiceDesc, srv)
+}
+
+func _ChargebackService_ListChargebacks_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListChargebacksRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChargebackServiceServer).ListChargebacks(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ChargebackService_ListChargebacks_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChargebackServiceServer).ListChargebacks(ctx, req.(*ListChargebacksRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChargebackService_GetChargeback_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetChargebackRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChargebackServiceServer).GetChargeback(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ChargebackService_GetChargeback_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChargebackServiceServer).GetChargeback(ctx, req.(*GetChargebackRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChargebackService_CreateChargeback_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateChargebackRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChargebackServiceServer).CreateChargeback(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ChargebackService_CreateChargeback_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChargebackServiceServer).CreateChargeback(ctx, req.(*CreateChargebackRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChargebackService_UpdateChargeback_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateChargebackRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChargebackServiceServer).UpdateChargeback(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ChargebackService_UpdateChargeback_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChargebackServiceServer).UpdateChargeback(ctx, req.(*UpdateChargebackRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChargebackService_DeleteChargeback_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteChargebackRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChargebackServiceServer).DeleteChargeback(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ChargebackService_DeleteChargeback_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChargebackServiceServer).DeleteChargeback(ctx, req.(*DeleteChargebackRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// ChargebackService_ServiceDesc is the grpc.ServiceDesc for ChargebackService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var ChargebackService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "chargeback.v1.ChargebackService",
+	HandlerType: (*ChargebackServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ListChargebacks",
+			Handler:    _ChargebackService_ListChargebacks_Handler,
+		},
+		{
+			MethodName: "GetChargeback",
+			Handler:    _ChargebackService_GetChargeback_Handler,
+		},
+		{
+			MethodName: "CreateChargeback",
+			Handler:    _ChargebackService_CreateChargeback_Handler,
+		},
+		{
+			MethodName: "UpdateChargeback",
+			Handler:    _ChargebackService_UpdateChargeback_Handler,
+		},
+		{
+			MethodName: "DeleteChargeback",
+			Handler:    _ChargebackService_DeleteChargeback_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "chargeback/v1/chargeback.proto",
+}
@@ -0,0 +1,106 @@
+// Package graphqlapi serves the chargebacks API over GraphQL at /graphql.
+//
+// The schema is in schema.graphql. Queries and mutations call the same
+// service.Chargebacks as the REST and gRPC APIs, so the idempotency rules are
+// theirs: creates are idempotent on the ID or, without one, on the
+// idempotency key, updates skip no-op writes and deletes of missing records
+// succeed. On top of that, every mutation takes an idempotencyKey argument
+// and is deduplicated by service.Dedup, the machinery behind the gRPC
+// interceptor: a retry gets the saved payload back instead of running again.
+// Keys are namespaced by mutation, so reusing one for another mutation runs
+// it.
+//
+// GraphQL answers 200 with an "errors" list for failures in a resolver. Each
+// error carries an extensions.code (see the constants below) and, for
+// invalid input, extensions.fields in the shape of the REST 422 body.
+package graphqlapi
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	graphql "github.com/graph-gophers/graphql-go"
+	gqlotel "github.com/graph-gophers/graphql-go/trace/otel"
+
+	"github.com/arkantrust/idempotency-example/backend/service"
+)
+
+//go:embed schema.graphql
+var schema string
+
+// DefaultMaxBodyBytes is the request size limit used when
+// Handler.MaxBodyBytes is zero.
+const DefaultMaxBodyBytes = 1 << 20
+
+// maxDepth bounds the nesting of a query. The schema is shallow; anything
+// deeper is a mistake or an attempt to make the server work hard.
+const maxDepth = 8
+
+// Handler serves GraphQL requests.
+type Handler struct {
+	schema *graphql.Schema
+
+	// MaxBodyBytes limits request bodies; larger bodies get 413. Zero means
+	// DefaultMaxBodyBytes.
+	MaxBodyBytes int64
+}
+
+// New returns a Handler resolving queries with svc and deduplicating
+// mutations with dedup.
+func New(svc *service.Chargebacks, dedup *service.Dedup) *Handler {
+	r := &resolver{svc: svc, dedup: dedup}
+	return &Handler{
+		schema: graphql.MustParseSchema(schema, r,
+			graphql.UseStringDescriptions(),
+			graphql.MaxDepth(maxDepth),
+			graphql.Tracer(gqlotel.DefaultTracer()),
+		),
+	}
+}
+
+// request is a GraphQL request in the standard JSON encoding.
+type request struct {
+	Query         string         `json:"query"`
+	OperationName string         `json:"operationName"`
+	Variables     map[string]any `json:"variables"`
+}
+
+// ServeHTTP handles POST /graphql.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	limit := h.MaxBodyBytes
+	if limit <= 0 {
+		limit = DefaultMaxBodyBytes
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, limit)
+
+	var req request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeError(w, http.StatusRequestEntityTooLarge, "request body too large")
+			return
+		}
+		writeError(w, http.StatusBadRequest, "invalid GraphQL request: "+err.Error())
+		return
+	}
+	if req.Query == "" {
+		writeError(w, http.StatusBadRequest, "missing query")
+		return
+	}
+
+	resp := h.schema.Exec(r.Context(), req.Query, req.OperationName, req.Variables)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp) //nolint:errcheck
+}
+
+// writeError writes a request-level failure as a GraphQL response with no
+// data, so that clients parse every answer the same way.
+func writeError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]any{ //nolint:errcheck
+		"errors": []map[string]string{{"message": msg}},
+	})
+}
@@ -0,0 +1,135 @@
+package graphqlapi_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/arkantrust/idempotency-example/backend/graphqlapi"
+	"github.com/arkantrust/idempotency-example/backend/service"
+	"github.com/arkantrust/idempotency-example/backend/store"
+)
+
+func newTestHandler(t *testing.T) *graphqlapi.Handler {
+	t.Helper()
+	s, err := store.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to open test store: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return graphqlapi.New(service.NewChargebacks(s), service.NewDedup(s))
+}
+
+type response struct {
+	Data   map[string]json.RawMessage `json:"data"`
+	Errors []struct {
+		Message    string         `json:"message"`
+		Extensions map[string]any `json:"extensions"`
+	} `json:"errors"`
+}
+
+func exec(t *testing.T, h http.Handler, query string, vars map[string]any) response {
+	t.Helper()
+	body, _ := json.Marshal(map[string]any{"query": query, "variables": vars})
+	req := httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(string(body)))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	var resp response
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid response %s: %v", rec.Body, err)
+	}
+	return resp
+}
+
+const create = `mutation($key: String, $amount: Amount!) {
+  createChargeback(input: {amount: $amount, currency: "USD", reason: "fraud"}, idempotencyKey: $key) {
+    chargeback { id amount }
+    replayed
+  }
+}`
+
+func TestCreateWithKey(t *testing.T) {
+	h := newTestHandler(t)
+
+	var payloads [2]struct {
+		Chargeback struct {
+			ID     string `json:"id"`
+			Amount int64  `json:"amount"`
+		} `json:"chargeback"`
+		Replayed bool `json:"replayed"`
+	}
+	for i := range payloads {
+		resp := exec(t, h, create, map[string]any{"key": "key-1", "amount": 5000000000})
+		if len(resp.Errors) > 0 {
+			t.Fatalf("call %d: unexpected errors: %+v", i, resp.Errors)
+		}
+		json.Unmarshal(resp.Data["createChargeback"], &payloads[i]) //nolint:errcheck
+	}
+	if payloads[0].Replayed || !payloads[1].Replayed {
+		t.Fatalf("expected only the retry to be replayed, got %+v", payloads)
+	}
+	if payloads[0].Chargeback.ID == "" || payloads[1].Chargeback.ID != payloads[0].Chargeback.ID {
+		t.Fatalf("expected the retry to return the same chargeback, got %+v", payloads)
+	}
+	if payloads[0].Chargeback.Amount != 5000000000 {
+		t.Fatalf("expected a 64-bit amount to round-trip, got %d", payloads[0].Chargeback.Amount)
+	}
+
+	resp := exec(t, h, `{ chargebacks { id } }`, nil)
+	if got := string(resp.Data["chargebacks"]); strings.Count(got, `"id"`) != 1 {
+		t.Fatalf("expected one chargeback, got %s", got)
+	}
+
+	resp = exec(t, h, create, map[string]any{"key": "key-1", "amount": 200})
+	if len(resp.Errors) != 1 || resp.Errors[0].Extensions["code"] != graphqlapi.CodeKeyReused {
+		t.Fatalf("expected %s for a reused key, got %+v", graphqlapi.CodeKeyReused, resp.Errors)
+	}
+
+	resp = exec(t, h, create, map[string]any{"amount": 200})
+	if len(resp.Errors) != 1 || resp.Errors[0].Extensions["code"] != graphqlapi.CodeBadUserInput {
+		t.Fatalf("expected %s without an id or key, got %+v", graphqlapi.CodeBadUserInput, resp.Errors)
+	}
+}
+
+func TestUpdateWriteAvoidance(t *testing.T) {
+	h := newTestHandler(t)
+	resp := exec(t, h, `mutation { createChargeback(id: "cb-1", input: {amount: 100, currency: "USD", reason: "fraud"}) { replayed } }`, nil)
+	if len(resp.Errors) > 0 {
+		t.Fatalf("unexpected errors: %+v", resp.Errors)
+	}
+
+	const update = `mutation($reason: String) {
+  updateChargeback(id: "cb-1", input: {reason: $reason}) { chargeback { amount reason } written }
+}`
+	for _, tc := range []struct {
+		reason  string
+		written bool
+	}{{"fraud", false}, {"duplicate", true}} {
+		resp := exec(t, h, update, map[string]any{"reason": tc.reason})
+		if len(resp.Errors) > 0 {
+			t.Fatalf("unexpected errors: %+v", resp.Errors)
+		}
+		var got struct {
+			Chargeback struct {
+				Amount int64  `json:"amount"`
+				Reason string `json:"reason"`
+			} `json:"chargeback"`
+			Written bool `json:"written"`
+		}
+		json.Unmarshal(resp.Data["updateChargeback"], &got) //nolint:errcheck
+		if got.Written != tc.written || got.Chargeback.Reason != tc.reason || got.Chargeback.Amount != 100 {
+			t.Fatalf("reason %q: got %+v, want written=%v with the amount kept", tc.reason, got, tc.written)
+		}
+	}
+
+	resp = exec(t, h, `mutation { updateChargeback(id: "cb-1", input: {currency: "XYZ"}) { written } }`, nil)
+	if len(resp.Errors) != 1 || resp.Errors[0].Extensions["code"] != graphqlapi.CodeBadUserInput {
+		t.Fatalf("expected %s for an invalid currency, got %+v", graphqlapi.CodeBadUserInput, resp.Errors)
+	}
+}
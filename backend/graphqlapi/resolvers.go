@@ -0,0 +1,416 @@
+package graphqlapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"strconv"
+
+	graphql "github.com/graph-gophers/graphql-go"
+
+	"github.com/arkantrust/idempotency-example/backend/auth"
+	"github.com/arkantrust/idempotency-example/backend/models"
+	"github.com/arkantrust/idempotency-example/backend/service"
+	"github.com/arkantrust/idempotency-example/backend/store"
+)
+
+// Error codes reported in extensions.code.
+const (
+	CodeBadUserInput    = "BAD_USER_INPUT"
+	CodePolicyViolation = "POLICY_VIOLATION"
+	CodeForbidden       = "FORBIDDEN"
+	CodeNotFound        = "NOT_FOUND"
+	CodeConflict        = "CONFLICT"
+	CodeKeyReused       = "IDEMPOTENCY_KEY_REUSED"
+	CodeUnavailable     = "UNAVAILABLE"
+	CodeInternal        = "INTERNAL"
+)
+
+// apiError is a resolver error with a code and, for invalid input, the
+// invalid fields or the policy rules broken. graphql-go copies Extensions
+// into the response.
+type apiError struct {
+	msg        string
+	code       string
+	fields     []models.FieldError
+	violations []models.PolicyViolation
+}
+
+func (e *apiError) Error() string { return e.msg }
+
+func (e *apiError) Extensions() map[string]any {
+	ext := map[string]any{"code": e.code}
+	if len(e.fields) > 0 {
+		ext["fields"] = e.fields
+	}
+	if len(e.violations) > 0 {
+		ext["violations"] = e.violations
+	}
+	return ext
+}
+
+// toAPIError maps a service error to an apiError. notFound is the message
+// for store.ErrNotFound, which means different things to different
+// operations.
+func toAPIError(ctx context.Context, err error, notFound, failed string) error {
+	var ve *models.ValidationError
+	var pe *models.PolicyError
+	var ie *service.InvalidError
+	switch {
+	case errors.As(err, &ve):
+		return &apiError{msg: "validation failed", code: CodeBadUserInput, fields: ve.Fields}
+	case errors.As(err, &pe):
+		return &apiError{msg: "refused by policy", code: CodePolicyViolation, violations: pe.Violations}
+	case errors.As(err, &ie):
+		return &apiError{msg: ie.Reason, code: CodeBadUserInput}
+	case errors.Is(err, store.ErrNotFound):
+		return &apiError{msg: notFound, code: CodeNotFound}
+	case errors.Is(err, store.ErrKeyConflict):
+		return &apiError{msg: "idempotency key is already in use by another client", code: CodeConflict}
+	case errors.Is(err, store.ErrKeyReused):
+		return &apiError{msg: "idempotency key was already used with a different request", code: CodeKeyReused}
+	case errors.Is(err, store.ErrTimeout):
+		return &apiError{msg: "the database is busy", code: CodeUnavailable}
+	case errors.Is(err, store.ErrCircuitOpen):
+		return &apiError{msg: "the database is failing", code: CodeUnavailable}
+	case errors.Is(err, store.ErrUnavailable):
+		return &apiError{msg: "writes are temporarily disabled", code: CodeUnavailable}
+	case errors.Is(err, store.ErrValidation), errors.Is(err, store.ErrTooLarge):
+		return &apiError{msg: err.Error(), code: CodeBadUserInput}
+	case errors.Is(err, store.ErrConflict):
+		return &apiError{msg: err.Error(), code: CodeConflict}
+	}
+	slog.ErrorContext(ctx, failed, "err", err)
+	return &apiError{msg: failed, code: CodeInternal}
+}
+
+// requireScope is RequireScope for one field: the /graphql route carries
+// both reads and writes, so the scope cannot be checked per route.
+func requireScope(ctx context.Context, scope string) error {
+	if p, ok := auth.PrincipalFrom(ctx); ok && !p.HasScope(scope) {
+		return &apiError{msg: "missing scope " + scope, code: CodeForbidden}
+	}
+	return nil
+}
+
+// amount is the Amount scalar. GraphQL's Int is 32 bits, too small for
+// amounts in minor units.
+type amount int64
+
+func (amount) ImplementsGraphQLType(name string) bool { return name == "Amount" }
+
+func (a *amount) UnmarshalGraphQL(input any) error {
+	switch v := input.(type) {
+	case int32:
+		*a = amount(v)
+	case int64:
+		*a = amount(v)
+	case int:
+		*a = amount(v)
+	case float64:
+		if v != math.Trunc(v) || math.Abs(v) > 1<<53 {
+			return fmt.Errorf("amount must be an integer, got %v", v)
+		}
+		*a = amount(v)
+	case string:
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return fmt.Errorf("amount must be an integer, got %q", v)
+		}
+		*a = amount(n)
+	default:
+		return fmt.Errorf("amount must be an integer, got %T", input)
+	}
+	return nil
+}
+
+func (a amount) MarshalJSON() ([]byte, error) {
+	return strconv.AppendInt(nil, int64(a), 10), nil
+}
+
+// resolver is the root resolver for both queries and mutations.
+type resolver struct {
+	svc   *service.Chargebacks
+	dedup *service.Dedup
+}
+
+func (r *resolver) Chargebacks(ctx context.Context) ([]chargeback, error) {
+	if err := requireScope(ctx, auth.ScopeRead); err != nil {
+		return nil, err
+	}
+	items, err := r.svc.List(ctx)
+	if err != nil {
+		return nil, toAPIError(ctx, err, "", "failed to list chargebacks")
+	}
+	out := make([]chargeback, len(items))
+	for i := range items {
+		out[i] = chargeback{&items[i]}
+	}
+	return out, nil
+}
+
+func (r *resolver) Chargeback(ctx context.Context, args struct{ ID graphql.ID }) (*chargeback, error) {
+	if err := requireScope(ctx, auth.ScopeRead); err != nil {
+		return nil, err
+	}
+	c, err := r.svc.Get(ctx, string(args.ID))
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, toAPIError(ctx, err, "", "failed to get chargeback")
+	}
+	return &chargeback{c}, nil
+}
+
+func (r *resolver) Stats(ctx context.Context) (*stats, error) {
+	if err := requireScope(ctx, auth.ScopeRead); err != nil {
+		return nil, err
+	}
+	s, err := r.svc.Stats(ctx)
+	if err != nil {
+		return nil, toAPIError(ctx, err, "", "failed to compute stats")
+	}
+	return &stats{s}, nil
+}
+
+type chargebackInput struct {
+	Amount   amount
+	Currency string
+	Reason   string
+}
+
+type createArgs struct {
+	ID             *graphql.ID
+	Input          chargebackInput
+	IdempotencyKey *string
+}
+
+// CreateChargeback creates with the ID as the key when there is one and
+// with the idempotency key otherwise, like the two REST create routes.
+func (r *resolver) CreateChargeback(ctx context.Context, args createArgs) (*createPayload, error) {
+	if err := requireScope(ctx, auth.ScopeWrite); err != nil {
+		return nil, err
+	}
+	if args.ID == nil && args.IdempotencyKey == nil {
+		return nil, &apiError{msg: "an id or idempotencyKey is required", code: CodeBadUserInput}
+	}
+	return withKey(ctx, r, "createChargeback", args.IdempotencyKey, args, func() (*createPayload, error) {
+		c := &models.Chargeback{Amount: int64(args.Input.Amount), Currency: args.Input.Currency, Reason: args.Input.Reason}
+		var (
+			result  *models.Chargeback
+			created bool
+			err     error
+		)
+		if args.ID != nil {
+			c.ID = string(*args.ID)
+			result, created, err = r.svc.Create(ctx, c)
+		} else {
+			result, created, err = r.svc.CreateWithKey(ctx, *args.IdempotencyKey, c)
+		}
+		if err != nil {
+			return nil, toAPIError(ctx, err, "the chargeback created with this idempotency key has been deleted", "failed to create chargeback")
+		}
+		return &createPayload{Record: result, IsReplayed: !created}, nil
+	})
+}
+
+type chargebackPatch struct {
+	Amount   *amount
+	Currency *string
+	Reason   *string
+}
+
+type updateArgs struct {
+	ID             graphql.ID
+	Input          chargebackPatch
+	IdempotencyKey *string
+}
+
+// UpdateChargeback updates the fields set in the input: the fields present
+// form the field mask, so there is no separate mask argument.
+func (r *resolver) UpdateChargeback(ctx context.Context, args updateArgs) (*updatePayload, error) {
+	if err := requireScope(ctx, auth.ScopeWrite); err != nil {
+		return nil, err
+	}
+	c := &models.Chargeback{}
+	var mask models.FieldMask
+	if args.Input.Amount != nil {
+		c.Amount = int64(*args.Input.Amount)
+		mask = append(mask, "amount")
+	}
+	if args.Input.Currency != nil {
+		c.Currency = *args.Input.Currency
+		mask = append(mask, "currency")
+	}
+	if args.Input.Reason != nil {
+		c.Reason = *args.Input.Reason
+		mask = append(mask, "reason")
+	}
+	if len(mask) == 0 {
+		return nil, &apiError{msg: "input must set at least one field", code: CodeBadUserInput}
+	}
+
+	return withKey(ctx, r, "updateChargeback", args.IdempotencyKey, args, func() (*updatePayload, error) {
+		result, written, err := r.svc.Update(ctx, string(args.ID), c, mask)
+		if err != nil {
+			return nil, toAPIError(ctx, err, "chargeback not found", "failed to update chargeback")
+		}
+		return &updatePayload{Record: result, IsWritten: written}, nil
+	})
+}
+
+type deleteArgs struct {
+	ID             graphql.ID
+	IdempotencyKey *string
+}
+
+func (r *resolver) DeleteChargeback(ctx context.Context, args deleteArgs) (*deletePayload, error) {
+	if err := requireScope(ctx, auth.ScopeWrite); err != nil {
+		return nil, err
+	}
+	return withKey(ctx, r, "deleteChargeback", args.IdempotencyKey, args, func() (*deletePayload, error) {
+		existed, err := r.svc.Delete(ctx, string(args.ID))
+		if err != nil {
+			return nil, toAPIError(ctx, err, "", "failed to delete chargeback")
+		}
+		return &deletePayload{Deleted: string(args.ID), HasExisted: existed}, nil
+	})
+}
+
+// payload is a mutation payload that can be marked as replayed.
+type payload interface {
+	setReplayed()
+}
+
+// withKey runs a mutation through the Dedup when the client sent a key,
+// saving the payload as JSON and replaying it to retries; without a key it
+// just runs it. op and args fingerprint the call.
+func withKey[P payload](ctx context.Context, r *resolver, op string, key *string, args any, run func() (P, error)) (P, error) {
+	var zero P
+	if key == nil {
+		return run()
+	}
+	if desc := r.svc.KeyFormat.Check(*key); desc != "" {
+		return zero, &apiError{
+			msg:    "validation failed",
+			code:   CodeBadUserInput,
+			fields: []models.FieldError{{Field: "idempotencyKey", Message: desc}},
+		}
+	}
+	body, err := json.Marshal(args)
+	if err != nil {
+		return zero, &apiError{msg: "failed to fingerprint request", code: CodeInternal}
+	}
+
+	var result P
+	saved, replayed, err := r.dedup.Do(ctx, "graphql:"+op, *key, service.Fingerprint("graphql:"+op, body), func() (*store.Response, error) {
+		var err error
+		if result, err = run(); err != nil {
+			return nil, err
+		}
+		data, err := json.Marshal(result)
+		if err != nil {
+			return nil, err
+		}
+		return &store.Response{Type: "graphql:" + op, Body: data}, nil
+	})
+	var ae *apiError
+	switch {
+	case errors.As(err, &ae):
+		return zero, err
+	case err != nil:
+		return zero, toAPIError(ctx, err, "", "failed to check idempotency key")
+	case !replayed:
+		return result, nil
+	}
+
+	if err := json.Unmarshal(saved.Body, &result); err != nil {
+		return zero, toAPIError(ctx, err, "", "failed to decode saved response")
+	}
+	result.setReplayed()
+	return result, nil
+}
+
+type createPayload struct {
+	Record     *models.Chargeback `json:"chargeback"`
+	IsReplayed bool               `json:"-"`
+}
+
+func (p *createPayload) Chargeback() chargeback { return chargeback{p.Record} }
+func (p *createPayload) Replayed() bool         { return p.IsReplayed }
+func (p *createPayload) setReplayed()           { p.IsReplayed = true }
+
+type updatePayload struct {
+	Record     *models.Chargeback `json:"chargeback"`
+	IsWritten  bool               `json:"written"`
+	IsReplayed bool               `json:"-"`
+}
+
+func (p *updatePayload) Chargeback() chargeback { return chargeback{p.Record} }
+func (p *updatePayload) Written() bool          { return p.IsWritten }
+func (p *updatePayload) Replayed() bool         { return p.IsReplayed }
+func (p *updatePayload) setReplayed()           { p.IsReplayed = true }
+
+type deletePayload struct {
+	Deleted    string `json:"id"`
+	HasExisted bool   `json:"existed"`
+	IsReplayed bool   `json:"-"`
+}
+
+func (p *deletePayload) ID() graphql.ID { return graphql.ID(p.Deleted) }
+func (p *deletePayload) Existed() bool  { return p.HasExisted }
+func (p *deletePayload) Replayed() bool { return p.IsReplayed }
+func (p *deletePayload) setReplayed()   { p.IsReplayed = true }
+
+// chargeback resolves the Chargeback type.
+type chargeback struct {
+	c *models.Chargeback
+}
+
+func (r chargeback) ID() graphql.ID          { return graphql.ID(r.c.ID) }
+func (r chargeback) Amount() amount          { return amount(r.c.Amount) }
+func (r chargeback) Currency() string        { return r.c.Currency }
+func (r chargeback) Reason() string          { return r.c.Reason }
+func (r chargeback) CreatedAt() graphql.Time { return graphql.Time{Time: r.c.CreatedAt} }
+func (r chargeback) UpdatedAt() graphql.Time { return graphql.Time{Time: r.c.UpdatedAt} }
+func (r chargeback) Version() int32          { return int32(r.c.Version) }
+func (r chargeback) Owner() *string {
+	if r.c.Owner == "" {
+		return nil
+	}
+	return &r.c.Owner
+}
+
+// stats resolves the Stats type.
+type stats struct {
+	s *models.Stats
+}
+
+func (r *stats) Tenant() *string {
+	if r.s.Tenant == "" {
+		return nil
+	}
+	return &r.s.Tenant
+}
+
+func (r *stats) Count() int32 { return int32(r.s.Count) }
+
+func (r *stats) ByCurrency() []currencyStats {
+	out := make([]currencyStats, len(r.s.ByCurrency))
+	for i, c := range r.s.ByCurrency {
+		out[i] = currencyStats{c}
+	}
+	return out
+}
+
+type currencyStats struct {
+	c models.CurrencyStats
+}
+
+func (r currencyStats) Currency() string { return r.c.Currency }
+func (r currencyStats) Count() int32     { return int32(r.c.Count) }
+func (r currencyStats) Amount() amount   { return amount(r.c.Amount) }
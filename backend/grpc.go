@@ -0,0 +1,43 @@
+package main
+
+import (
+	"crypto/tls"
+
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/reflection"
+
+	"github.com/arkantrust/idempotency-example/backend/auth"
+	chargebackv1 "github.com/arkantrust/idempotency-example/backend/gen/chargeback/v1"
+	"github.com/arkantrust/idempotency-example/backend/grpcapi"
+	"github.com/arkantrust/idempotency-example/backend/service"
+)
+
+// newGRPCServer builds the gRPC server. Interceptors run in the same order as
+// the HTTP middleware: authentication and tenant selection first, so that
+// idempotency keys are scoped to the caller, then deduplication.
+//
+// The server uses the HTTP server's TLS configuration, including client
+// certificate verification, when there is one. Reflection is registered so
+// that tools such as grpcurl work without the .proto file.
+//
+// svc and dedup are shared with the HTTP and GraphQL APIs, so all of them
+// have one implementation and configuration.
+func newGRPCServer(svc *service.Chargebacks, dedup *service.Dedup, authn *auth.Authenticator, tlsConfig *tls.Config) *grpc.Server {
+	idem := grpcapi.NewIdempotency(dedup)
+	idem.KeyFormat = svc.KeyFormat
+
+	opts := []grpc.ServerOption{
+		grpc.StatsHandler(otelgrpc.NewServerHandler()),
+		grpc.ChainUnaryInterceptor(authn.UnaryInterceptor(grpcapi.ScopeFor), idem.Unary),
+	}
+	if tlsConfig != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+
+	srv := grpc.NewServer(opts...)
+	chargebackv1.RegisterChargebackServiceServer(srv, grpcapi.New(svc))
+	reflection.Register(srv)
+	return srv
+}
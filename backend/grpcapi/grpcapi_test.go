@@ -0,0 +1,131 @@
+package grpcapi_test
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+
+	"github.com/arkantrust/idempotency-example/backend/auth"
+	chargebackv1 "github.com/arkantrust/idempotency-example/backend/gen/chargeback/v1"
+	"github.com/arkantrust/idempotency-example/backend/grpcapi"
+	"github.com/arkantrust/idempotency-example/backend/service"
+	"github.com/arkantrust/idempotency-example/backend/store"
+)
+
+func newTestClient(t *testing.T) chargebackv1.ChargebackServiceClient {
+	t.Helper()
+	s, err := store.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to open test store: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+
+	authn := &auth.Authenticator{Keys: s}
+	srv := grpc.NewServer(grpc.ChainUnaryInterceptor(authn.UnaryInterceptor(grpcapi.ScopeFor), grpcapi.NewIdempotency(service.NewDedup(s)).Unary))
+	chargebackv1.RegisterChargebackServiceServer(srv, grpcapi.New(service.NewChargebacks(s)))
+
+	lis := bufconn.Listen(1 << 20)
+	go srv.Serve(lis) //nolint:errcheck
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return chargebackv1.NewChargebackServiceClient(conn)
+}
+
+func withKey(key string) context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(), grpcapi.KeyMetadata, key)
+}
+
+func TestCreateWithKey(t *testing.T) {
+	c := newTestClient(t)
+	req := &chargebackv1.CreateChargebackRequest{Chargeback: &chargebackv1.Chargeback{Amount: 100, Currency: "USD", Reason: "fraud"}}
+
+	var header metadata.MD
+	first, err := c.CreateChargeback(withKey("key-1"), req, grpc.Header(&header))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := header.Get(grpcapi.ReplayedMetadata); len(got) != 1 || got[0] != "false" {
+		t.Fatalf("expected a fresh create, got %s=%v", grpcapi.ReplayedMetadata, got)
+	}
+
+	second, err := c.CreateChargeback(withKey("key-1"), req, grpc.Header(&header))
+	if err != nil {
+		t.Fatalf("unexpected error on retry: %v", err)
+	}
+	if second.GetId() != first.GetId() {
+		t.Fatalf("expected replay of %q, got %q", first.GetId(), second.GetId())
+	}
+	if got := header.Get(grpcapi.ReplayedMetadata); len(got) != 1 || got[0] != "true" {
+		t.Fatalf("expected a replay, got %s=%v", grpcapi.ReplayedMetadata, got)
+	}
+
+	req.Chargeback.Amount = 999
+	if _, err := c.CreateChargeback(withKey("key-1"), req); status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("expected FailedPrecondition for a reused key, got %v", err)
+	}
+	if _, err := c.CreateChargeback(context.Background(), req); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected InvalidArgument without id or key, got %v", err)
+	}
+
+	// Keys are namespaced by method: the create's key is new to an update.
+	updated, err := c.UpdateChargeback(withKey("key-1"), &chargebackv1.UpdateChargebackRequest{
+		Chargeback: &chargebackv1.Chargeback{Id: first.GetId(), Amount: 150},
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"amount"}},
+	})
+	if err != nil || updated.GetAmount() != 150 {
+		t.Fatalf("expected the update to run under the create's key, got %v %v", updated, err)
+	}
+}
+
+func TestUpdateWriteAvoidance(t *testing.T) {
+	c := newTestClient(t)
+	ctx := context.Background()
+	cb := &chargebackv1.Chargeback{Id: "cb-1", Amount: 100, Currency: "USD", Reason: "fraud"}
+	if _, err := c.CreateChargeback(ctx, &chargebackv1.CreateChargebackRequest{Chargeback: cb}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	update := func(amount int64) string {
+		t.Helper()
+		var header metadata.MD
+		_, err := c.UpdateChargeback(ctx, &chargebackv1.UpdateChargebackRequest{
+			Chargeback: &chargebackv1.Chargeback{Id: "cb-1", Amount: amount},
+			UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"amount"}},
+		}, grpc.Header(&header))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return header.Get(grpcapi.WriteMetadata)[0]
+	}
+	if got := update(250); got != "true" {
+		t.Fatalf("expected a write, got %q", got)
+	}
+	if got := update(250); got != "false" {
+		t.Fatalf("expected the repeated update to be skipped, got %q", got)
+	}
+
+	for range 2 {
+		if _, err := c.DeleteChargeback(ctx, &chargebackv1.DeleteChargebackRequest{Id: "cb-1"}); err != nil {
+			t.Fatalf("expected delete to succeed, got %v", err)
+		}
+	}
+	if _, err := c.GetChargeback(ctx, &chargebackv1.GetChargebackRequest{Id: "cb-1"}); status.Code(err) != codes.NotFound {
+		t.Fatalf("expected NotFound, got %v", err)
+	}
+}
@@ -0,0 +1,120 @@
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+
+	chargebackv1 "github.com/arkantrust/idempotency-example/backend/gen/chargeback/v1"
+	"github.com/arkantrust/idempotency-example/backend/models"
+	"github.com/arkantrust/idempotency-example/backend/service"
+	"github.com/arkantrust/idempotency-example/backend/store"
+)
+
+// Idempotency is a unary server interceptor that deduplicates mutating calls
+// by the idempotency-key metadata entry.
+//
+// The first successful call with a key has its response saved, together with
+// a fingerprint of the method and request. A retry with the same key and
+// request gets the saved response back, with ReplayedMetadata set, and the
+// handler is not run at all. The same key with a different request to the
+// same method fails with FailedPrecondition, for the same reason the HTTP API answers 422:
+// replaying would hide that the second request was never applied. Failed
+// calls are not saved, so a retry after an error runs again. The saving and
+// replaying is service.Dedup's, shared with the GraphQL mutations.
+//
+// Keys are scoped like every other store operation, by the tenant and owner
+// in the context, and by method: a key sent to CreateChargeback is a fresh
+// key to UpdateChargeback. The interceptor must run after authentication.
+type Idempotency struct {
+	dedup *service.Dedup
+
+	// KeyFormat, when set, restricts the keys accepted.
+	KeyFormat *service.KeyFormat
+}
+
+// NewIdempotency returns the interceptor, saving and replaying responses
+// with d.
+func NewIdempotency(d *service.Dedup) *Idempotency {
+	return &Idempotency{dedup: d}
+}
+
+// mutating lists the methods the interceptor applies to. Reads are
+// idempotent already and are passed straight through.
+var mutating = map[string]bool{
+	chargebackv1.ChargebackService_CreateChargeback_FullMethodName: true,
+	chargebackv1.ChargebackService_UpdateChargeback_FullMethodName: true,
+	chargebackv1.ChargebackService_DeleteChargeback_FullMethodName: true,
+}
+
+// Unary implements grpc.UnaryServerInterceptor.
+func (i *Idempotency) Unary(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	key := metadataValue(ctx, KeyMetadata)
+	msg, ok := req.(proto.Message)
+	if !mutating[info.FullMethod] || key == "" || !ok {
+		return handler(ctx, req)
+	}
+	if desc := i.KeyFormat.Check(key); desc != "" {
+		return nil, invalidFields([]models.FieldError{{Field: KeyMetadata, Message: desc}})
+	}
+
+	body, err := proto.MarshalOptions{Deterministic: true}.Marshal(msg)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to fingerprint request")
+	}
+
+	var (
+		resp any
+		ran  bool
+	)
+	saved, replayed, err := i.dedup.Do(ctx, info.FullMethod, key, service.Fingerprint(info.FullMethod, body), func() (*store.Response, error) {
+		var err error
+		ran = true
+		if resp, err = handler(ctx, req); err != nil {
+			return nil, err
+		}
+		out, ok := resp.(proto.Message)
+		if !ok {
+			return nil, status.Error(codes.Internal, "failed to save response")
+		}
+		data, err := proto.Marshal(out)
+		if err != nil {
+			return nil, status.Error(codes.Internal, "failed to save response")
+		}
+		return &store.Response{Type: string(out.ProtoReflect().Descriptor().FullName()), Body: data}, nil
+	})
+	switch {
+	case errors.Is(err, store.ErrKeyReused):
+		return nil, status.Error(codes.FailedPrecondition, "idempotency key was already used with a different request")
+	case err != nil && !ran:
+		slog.ErrorContext(ctx, "failed to check idempotency key", "err", err)
+		return nil, status.Error(codes.Internal, "failed to check idempotency key")
+	case err != nil:
+		return nil, err
+	case replayed:
+		return replay(ctx, saved)
+	}
+	return resp, nil
+}
+
+// replay decodes a saved response.
+func replay(ctx context.Context, saved *store.Response) (any, error) {
+	mt, err := protoregistry.GlobalTypes.FindMessageByName(protoreflect.FullName(saved.Type))
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to decode saved response")
+	}
+	resp := mt.New().Interface()
+	if err := proto.Unmarshal(saved.Body, resp); err != nil {
+		return nil, status.Error(codes.Internal, "failed to decode saved response")
+	}
+	grpc.SetHeader(ctx, metadata.Pairs(ReplayedMetadata, "true")) //nolint:errcheck
+	return resp, nil
+}
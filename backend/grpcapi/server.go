@@ -0,0 +1,296 @@
+// Package grpcapi serves the chargebacks API over gRPC.
+//
+// The service is defined in proto/chargeback/v1/chargeback.proto and keeps
+// the idempotency rules of the HTTP API: creates are idempotent on the record
+// ID or on an "idempotency-key" metadata entry, updates skip no-op writes and
+// say so in the "x-idempotency-write" response header, and deletes of missing
+// records succeed. Those rules are not reimplemented here: the Server calls
+// the same service.Chargebacks as the HTTP handlers and only maps its results
+// to messages and status codes. On top of that, Idempotency deduplicates any
+// mutating call that carries a key by replaying the saved response.
+package grpcapi
+
+//go:generate protoc -I ../proto --go_out=.. --go_opt=module=github.com/arkantrust/idempotency-example/backend --go-grpc_out=.. --go-grpc_opt=module=github.com/arkantrust/idempotency-example/backend chargeback/v1/chargeback.proto
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/arkantrust/idempotency-example/backend/auth"
+	chargebackv1 "github.com/arkantrust/idempotency-example/backend/gen/chargeback/v1"
+	"github.com/arkantrust/idempotency-example/backend/models"
+	"github.com/arkantrust/idempotency-example/backend/service"
+	"github.com/arkantrust/idempotency-example/backend/store"
+)
+
+// Metadata keys. gRPC metadata keys are lower-case.
+const (
+	// KeyMetadata carries the client's idempotency key.
+	KeyMetadata = "idempotency-key"
+
+	// ReplayedMetadata is set to "true" on responses that replay an earlier
+	// call instead of performing a new one.
+	ReplayedMetadata = "idempotency-replayed"
+
+	// WriteMetadata reports whether UpdateChargeback wrote anything.
+	WriteMetadata = "x-idempotency-write"
+)
+
+// Server implements chargebackv1.ChargebackServiceServer on top of the
+// chargeback service.
+type Server struct {
+	chargebackv1.UnimplementedChargebackServiceServer
+
+	svc *service.Chargebacks
+}
+
+// New creates a Server backed by svc.
+func New(svc *service.Chargebacks) *Server {
+	return &Server{svc: svc}
+}
+
+// ScopeFor returns the auth scope a ChargebackService method requires: reads
+// need chargebacks:read and everything else chargebacks:write.
+func ScopeFor(fullMethod string) string {
+	switch fullMethod {
+	case chargebackv1.ChargebackService_ListChargebacks_FullMethodName,
+		chargebackv1.ChargebackService_GetChargeback_FullMethodName:
+		return auth.ScopeRead
+	}
+	return auth.ScopeWrite
+}
+
+func (s *Server) ListChargebacks(ctx context.Context, _ *chargebackv1.ListChargebacksRequest) (*chargebackv1.ListChargebacksResponse, error) {
+	items, err := s.svc.List(ctx)
+	if st := unavailable(err); st != nil {
+		return nil, st
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to list chargebacks")
+	}
+	resp := &chargebackv1.ListChargebacksResponse{Chargebacks: make([]*chargebackv1.Chargeback, len(items))}
+	for i := range items {
+		resp.Chargebacks[i] = toProto(&items[i])
+	}
+	return resp, nil
+}
+
+func (s *Server) GetChargeback(ctx context.Context, req *chargebackv1.GetChargebackRequest) (*chargebackv1.Chargeback, error) {
+	c, err := s.svc.Get(ctx, req.GetId())
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, status.Error(codes.NotFound, "chargeback not found")
+	}
+	if st := unavailable(err); st != nil {
+		return nil, st
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to get chargeback")
+	}
+	return toProto(c), nil
+}
+
+// CreateChargeback creates the chargeback in the request. With an ID the ID
+// is the idempotency key, as in POST /chargebacks/{id}; without one the
+// server mints a ULID and deduplicates on the idempotency-key metadata, as in
+// POST /chargebacks. Either way, the ReplayedMetadata header tells the client
+// whether the record already existed.
+func (s *Server) CreateChargeback(ctx context.Context, req *chargebackv1.CreateChargebackRequest) (*chargebackv1.Chargeback, error) {
+	c := fromProto(req.GetChargeback())
+
+	var (
+		result  *models.Chargeback
+		created bool
+		err     error
+	)
+	if c.ID == "" {
+		key := metadataValue(ctx, KeyMetadata)
+		if key == "" {
+			return nil, status.Error(codes.InvalidArgument, "an id or "+KeyMetadata+" metadata is required")
+		}
+		if desc := s.svc.KeyFormat.Check(key); desc != "" {
+			return nil, invalidFields([]models.FieldError{{Field: KeyMetadata, Message: desc}})
+		}
+		result, created, err = s.svc.CreateWithKey(ctx, key, c)
+	} else {
+		result, created, err = s.svc.Create(ctx, c)
+	}
+	if st := invalidArgument(err); st != nil {
+		return nil, st
+	}
+	if st := unavailable(err); st != nil {
+		return nil, st
+	}
+	switch {
+	case errors.Is(err, store.ErrKeyConflict):
+		return nil, status.Error(codes.AlreadyExists, "idempotency key is already in use by another client")
+	case errors.Is(err, store.ErrKeyReused):
+		return nil, status.Error(codes.FailedPrecondition, "idempotency key was already used with a different payload")
+	case errors.Is(err, store.ErrNotFound):
+		return nil, status.Error(codes.NotFound, "the chargeback created with this idempotency key has been deleted")
+	case err != nil:
+		return nil, status.Error(codes.Internal, "failed to create chargeback")
+	}
+
+	grpc.SetHeader(ctx, metadata.Pairs(ReplayedMetadata, strconv.FormatBool(!created))) //nolint:errcheck
+	return toProto(result), nil
+}
+
+// UpdateChargeback applies the fields selected by update_mask (all of those
+// the message carries when the mask is empty) and skips the write when
+// nothing changed.
+func (s *Server) UpdateChargeback(ctx context.Context, req *chargebackv1.UpdateChargebackRequest) (*chargebackv1.Chargeback, error) {
+	mask, err := s.svc.ParseMask(strings.Join(req.GetUpdateMask().GetPaths(), ","))
+	if st := invalidArgument(err); st != nil {
+		return nil, st
+	}
+	if mask == nil {
+		// The message has no charge_id, which a full replacement would
+		// clear.
+		mask = protoFields
+	}
+	c := fromProto(req.GetChargeback())
+
+	result, written, err := s.svc.Update(ctx, c.ID, c, mask)
+	if st := invalidArgument(err); st != nil {
+		return nil, st
+	}
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, status.Error(codes.NotFound, "chargeback not found")
+	}
+	if st := unavailable(err); st != nil {
+		return nil, st
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to update chargeback")
+	}
+
+	grpc.SetHeader(ctx, metadata.Pairs(WriteMetadata, strconv.FormatBool(written))) //nolint:errcheck
+	return toProto(result), nil
+}
+
+// DeleteChargeback succeeds whether or not the record existed.
+func (s *Server) DeleteChargeback(ctx context.Context, req *chargebackv1.DeleteChargebackRequest) (*chargebackv1.DeleteChargebackResponse, error) {
+	existed, err := s.svc.Delete(ctx, req.GetId())
+	if st := unavailable(err); st != nil {
+		return nil, st
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to delete chargeback")
+	}
+	return &chargebackv1.DeleteChargebackResponse{Existed: existed}, nil
+}
+
+// errReadOnly answers a write the store's mode refused, and errBusy an
+// operation that timed out waiting for the database. Clients retry
+// Unavailable by default.
+var (
+	errReadOnly = status.Error(codes.Unavailable, "writes are temporarily disabled")
+	errBusy     = status.Error(codes.Unavailable, "the database is busy")
+	errFailing  = status.Error(codes.Unavailable, "the database is failing")
+)
+
+// unavailable maps an error of kind store.ErrUnavailable to errBusy,
+// errFailing or errReadOnly, or returns nil.
+func unavailable(err error) error {
+	switch {
+	case errors.Is(err, store.ErrTimeout):
+		return errBusy
+	case errors.Is(err, store.ErrCircuitOpen):
+		return errFailing
+	case errors.Is(err, store.ErrUnavailable):
+		return errReadOnly
+	}
+	return nil
+}
+
+// invalidArgument maps a service error rejecting the request's input to an
+// InvalidArgument status, or FailedPrecondition for one refused by policy,
+// or returns nil if err is not one.
+func invalidArgument(err error) error {
+	var ve *models.ValidationError
+	if errors.As(err, &ve) {
+		return invalidFields(ve.Fields)
+	}
+	var pe *models.PolicyError
+	if errors.As(err, &pe) {
+		return policyViolations(pe.Violations)
+	}
+	var ie *service.InvalidError
+	if errors.As(err, &ie) {
+		return status.Error(codes.InvalidArgument, ie.Reason)
+	}
+	return nil
+}
+
+// policyViolations is the gRPC counterpart of the HTTP 422 body of a write
+// refused by policy: a FailedPrecondition status with a PreconditionFailure
+// detail per rule broken.
+func policyViolations(violations []models.PolicyViolation) error {
+	pf := &errdetails.PreconditionFailure{}
+	for _, v := range violations {
+		pf.Violations = append(pf.Violations, &errdetails.PreconditionFailure_Violation{Type: v.Rule, Subject: v.Field, Description: v.Message})
+	}
+	st, err := status.New(codes.FailedPrecondition, "refused by policy").WithDetails(pf)
+	if err != nil {
+		return status.Error(codes.FailedPrecondition, "refused by policy")
+	}
+	return st.Err()
+}
+
+// invalidFields is the gRPC counterpart of the HTTP 422 body: an
+// InvalidArgument status with a BadRequest detail per field.
+func invalidFields(fields []models.FieldError) error {
+	br := &errdetails.BadRequest{}
+	for _, f := range fields {
+		br.FieldViolations = append(br.FieldViolations, &errdetails.BadRequest_FieldViolation{Field: f.Field, Description: f.Message})
+	}
+	st, err := status.New(codes.InvalidArgument, "validation failed").WithDetails(br)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, "validation failed")
+	}
+	return st.Err()
+}
+
+// metadataValue returns the first value of key in the incoming metadata.
+func metadataValue(ctx context.Context, key string) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if v := md.Get(key); len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+func toProto(c *models.Chargeback) *chargebackv1.Chargeback {
+	return &chargebackv1.Chargeback{
+		Id:         c.ID,
+		Amount:     c.Amount,
+		Currency:   c.Currency,
+		Reason:     c.Reason,
+		Owner:      c.Owner,
+		CreateTime: timestamppb.New(c.CreatedAt),
+		UpdateTime: timestamppb.New(c.UpdatedAt),
+	}
+}
+
+// fromProto copies the client-supplied fields of pc. Owner and timestamps
+// are maintained by the server and ignored.
+// protoFields are the updatable fields the Chargeback message carries.
+var protoFields = models.FieldMask{"amount", "currency", "reason"}
+
+func fromProto(pc *chargebackv1.Chargeback) *models.Chargeback {
+	return &models.Chargeback{
+		ID:       pc.GetId(),
+		Amount:   pc.GetAmount(),
+		Currency: pc.GetCurrency(),
+		Reason:   pc.GetReason(),
+	}
+}
@@ -0,0 +1,200 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/arkantrust/idempotency-example/backend/models"
+	"github.com/arkantrust/idempotency-example/backend/store"
+)
+
+// Backup handles GET /admin/backup.
+//
+// The response body is a consistent snapshot of the BoltDB file, taken inside
+// a read transaction so the server keeps accepting writes while the backup is
+// streamed. Save the body to disk and it can be used as DB_PATH directly.
+//
+// Like Export, errors after the first byte can only be logged; a truncated
+// download will fail to open as a Bolt database, so it cannot be mistaken for
+// a good backup.
+func (h *Handler) Backup(w http.ResponseWriter, r *http.Request) {
+	name := fmt.Sprintf("chargebacks-%s.db", time.Now().UTC().Format("20060102T150405Z"))
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+name+`"`)
+
+	if _, err := h.store.Backup(r.Context(), w); err != nil {
+		slog.ErrorContext(r.Context(), "backup failed", "err", err)
+	}
+}
+
+// Compact handles POST /admin/compact.
+//
+// Bolt files never shrink on their own: deleted records leave free pages that
+// are reused but never returned to the filesystem. Compaction rewrites the
+// live data into a fresh file and swaps it in, returning the file size before
+// and after. Requests block while compaction runs.
+//
+// Compaction is idempotent in the sense that matters: running it twice in a
+// row leaves the data unchanged and the second run reclaims (almost) nothing.
+func (h *Handler) Compact(w http.ResponseWriter, r *http.Request) {
+	st, err := h.store.Compact(r.Context())
+	if err != nil {
+		h.fail(w, r, err, "failed to compact database")
+		return
+	}
+	writeJSON(w, http.StatusOK, st)
+}
+
+// Reencode handles POST /admin/reencode: it rewrites every chargeback not
+// stored in the configured DB_ENCODING and the current schema version,
+// completing a switch of encodings or a schema migration. Running it again
+// finds nothing left to rewrite.
+func (h *Handler) Reencode(w http.ResponseWriter, r *http.Request) {
+	st, err := h.store.Reencode(r.Context())
+	if err != nil {
+		h.fail(w, r, err, "failed to re-encode records")
+		return
+	}
+	writeJSON(w, http.StatusOK, st)
+}
+
+// Verify handles GET /admin/verify: it checks every stored record against its
+// checksum and Bolt's page structure, and reports what is damaged. It only
+// reads, so it runs alongside traffic; a report listing corrupt records is
+// still a 200 – the check itself succeeded.
+func (h *Handler) Verify(w http.ResponseWriter, r *http.Request) {
+	report, err := h.store.Verify(r.Context())
+	if err != nil {
+		h.fail(w, r, err, "failed to verify database")
+		return
+	}
+	if !report.OK() {
+		slog.ErrorContext(r.Context(), "database verification found damage", "corrupt", len(report.Corrupt), "structural", len(report.Structural))
+	}
+	writeJSON(w, http.StatusOK, report)
+}
+
+// Rules handles GET /admin/rules: the policy chargeback writes are held to,
+// as loaded from the configuration. Without one, the lists are empty.
+func (h *Handler) Rules(w http.ResponseWriter, r *http.Request) {
+	p := h.store.Policy()
+	if p == nil {
+		p = &models.Policy{MaxAmounts: []models.AmountLimit{}, DisallowedReasons: []string{}}
+	}
+	writeJSON(w, http.StatusOK, p)
+}
+
+// Idempotency key listings are paginated: a page holds up to limit keys,
+// DefaultKeyPageSize unless the request asks for fewer or more (up to
+// MaxKeyPageSize), and when more follow, NextCursorHeader carries the cursor
+// to pass back for the next page.
+const (
+	DefaultKeyPageSize = 100
+	MaxKeyPageSize     = 1000
+	NextCursorHeader   = "X-Next-Cursor"
+)
+
+// IdempotencyKeys handles GET /admin/idempotency-keys?tenant=&prefix=
+// &operation=&createdAfter=&createdBefore=&limit=&cursor=.
+//
+// It lists the idempotency keys stored for one tenant, across every client,
+// with the record each create key maps to, the fingerprint of the request
+// that first used it and when it expires. When a client reports that a
+// request was "replayed" unexpectedly, this shows which earlier request the
+// key belonged to. The creation range filters by age: createdBefore=
+// yesterday lists the keys more than a day old.
+func (h *Handler) IdempotencyKeys(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	tenant := q.Get("tenant")
+	if tenant != "" && !store.ValidTenant(tenant) {
+		writeError(w, http.StatusBadRequest, "invalid tenant")
+		return
+	}
+	after, ok := timeParam(w, r, "createdAfter")
+	if !ok {
+		return
+	}
+	before, ok := timeParam(w, r, "createdBefore")
+	if !ok {
+		return
+	}
+	limit := DefaultKeyPageSize
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > MaxKeyPageSize {
+			writeError(w, http.StatusBadRequest, "invalid limit: expected 1 to "+strconv.Itoa(MaxKeyPageSize))
+			return
+		}
+		limit = n
+	}
+
+	keys, next, err := h.store.IdempotencyKeys(store.WithTenant(r.Context(), tenant), store.KeyQuery{
+		Prefix:        q.Get("prefix"),
+		Operation:     q.Get("operation"),
+		CreatedAfter:  after,
+		CreatedBefore: before,
+		Limit:         limit,
+		Cursor:        q.Get("cursor"),
+	})
+	if errors.Is(err, store.ErrInvalidCursor) {
+		writeError(w, http.StatusBadRequest, "invalid cursor")
+		return
+	}
+	if err != nil {
+		h.fail(w, r, err, "failed to list idempotency keys")
+		return
+	}
+	if next != "" {
+		w.Header().Set(NextCursorHeader, next)
+	}
+	writeJSON(w, http.StatusOK, keys)
+}
+
+// ExpireIdempotencyKey handles DELETE /admin/idempotency-keys/{key}?tenant=
+// &owner=&operation=.
+//
+// It force-expires a key so that the next request sent with it is processed
+// anew instead of replayed – after a client was found to have reused a key
+// for a genuinely different request, say. Only the key mapping goes; any
+// record it created stays. Without owner the key is expired for every client
+// of the tenant that used it, and without operation for every operation it
+// was sent to. 404 if nothing was stored under it.
+func (h *Handler) ExpireIdempotencyKey(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	tenant := q.Get("tenant")
+	if tenant != "" && !store.ValidTenant(tenant) {
+		writeError(w, http.StatusBadRequest, "invalid tenant")
+		return
+	}
+	ctx := store.WithTenant(r.Context(), tenant)
+	_, oneOwner := q["owner"]
+	if oneOwner {
+		ctx = store.WithOwner(ctx, q.Get("owner"))
+	}
+
+	key := r.PathValue("key")
+	n, err := h.svc.ExpireKey(ctx, q.Get("operation"), key, !oneOwner)
+	switch {
+	case err != nil:
+		h.fail(w, r, err, "failed to expire idempotency key")
+		return
+	case n == 0:
+		writeError(w, http.StatusNotFound, "idempotency key not found")
+		return
+	}
+	slog.InfoContext(r.Context(), "idempotency key expired", "tenant", tenant, "key", key, "entries", n)
+	writeJSON(w, http.StatusOK, expiredKeyBody{Key: key, Expired: n})
+}
+
+// expiredKeyBody is the response of ExpireIdempotencyKey.
+type expiredKeyBody struct {
+	Key string `json:"key"`
+
+	// Expired counts the entries deleted: one per client and operation
+	// that used the key.
+	Expired int `json:"expired"`
+}
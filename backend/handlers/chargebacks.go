@@ -2,12 +2,22 @@
 //
 // Every handler is designed to be idempotent:
 //
-//   - GET  /chargebacks      – pure read, trivially idempotent.
+//   - GET  /chargebacks, GET /chargebacks/{id} – pure reads, trivially
+//     idempotent.
 //   - POST /chargebacks/{id} – returns the existing record without writing if
 //     the ID already exists.
+//   - POST /chargebacks – the server mints the ID and deduplicates on the
+//     Idempotency-Key header instead.
 //   - PUT  /chargebacks/{id} – skips the write when the incoming payload is
 //     identical to the stored data (write-avoidance idempotency).
-//   - DELETE /chargebacks/{id} – succeeds even when the record does not exist.
+//   - DELETE /chargebacks/{id} – succeeds even when the record does not exist,
+//     including when If-Match makes it conditional on the record's ETag.
+//   - DELETE /chargebacks?currency=&before= – bulk delete; a retry finds
+//     nothing left to delete and still succeeds.
+//
+// The /chargebacks routes negotiate their representation: JSON by default, or
+// XML or MessagePack according to the Accept and Content-Type headers (see
+// codecs). Idempotency behaves identically whatever the media type.
 //
 // Why does idempotency matter?
 // In any networked system a request may fail *after* the server has processed
@@ -16,25 +26,94 @@
 // recovery strategy for the client is to retry. If the API is not idempotent
 // those retries can produce duplicate records, double charges, or corrupt state.
 // Making every mutating endpoint idempotent makes retries unconditionally safe.
+//
+// The single-record routes are not written per model: a Resource serves them
+// for any service.Resource (see NewResource), and chargebacks are served that
+// way. The handlers only translate between HTTP and the service package,
+// which holds the idempotency logic shared with the gRPC API.
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"encoding/xml"
 	"errors"
 	"net/http"
+	"strconv"
+	"sync"
+	"time"
 
+	"github.com/arkantrust/idempotency-example/backend/jobs"
 	"github.com/arkantrust/idempotency-example/backend/models"
+	"github.com/arkantrust/idempotency-example/backend/openapi"
+	"github.com/arkantrust/idempotency-example/backend/service"
 	"github.com/arkantrust/idempotency-example/backend/store"
 )
 
 // Handler holds the dependencies for all chargeback HTTP handlers.
 type Handler struct {
 	store *store.Store
+	svc   *service.Chargebacks
+
+	// chargebacks serves the routes every resource gets; the rest of
+	// Handler adds the ones only chargebacks have.
+	chargebacks *Resource[models.Chargeback, *models.Chargeback]
+
+	// charges and merchants serve the records chargebacks reference.
+	charges   *Resource[models.Charge, *models.Charge]
+	merchants *Resource[models.Merchant, *models.Merchant]
+
+	// MaxBodyBytes limits JSON request bodies; larger bodies get 413. Zero
+	// means DefaultMaxBodyBytes. POST /import is streamed and limited per
+	// line instead.
+	MaxBodyBytes int64
+
+	// MaxUploadBytes limits evidence documents; zero means
+	// DefaultMaxUploadBytes.
+	MaxUploadBytes int64
+
+	// StrictJSON rejects JSON bodies with unknown fields or duplicate keys
+	// for every request, not only those sending StrictHeader.
+	StrictJSON bool
+
+	// StrictKeys, when set, turns on strict idempotency: every write route
+	// requires an Idempotency-Key and replays the response it saves in
+	// StrictKeys for it. See idempotent.
+	StrictKeys *service.Dedup
+
+	// Async, when set, runs POST /chargebacks in the background for clients
+	// sending Prefer: respond-async; see createAsync.
+	Async *service.Operations
+
+	// Scheduler, when set, is reported by GET /admin/schedules.
+	Scheduler *jobs.Scheduler
+
+	// Policy selects the response style of the API routes.
+	Policy ResponsePolicy
+
+	// RetryAfter is sent with the 503 answering a write the store's mode
+	// refused.
+	RetryAfter time.Duration
+
+	// mux serves Routes for ServeHTTP. It is built on the first request, once
+	// the fields above are set.
+	muxOnce sync.Once
+	mux     *http.ServeMux
 }
 
-// New creates a new Handler with the given store.
-func New(s *store.Store) *Handler {
-	return &Handler{store: s}
+// New creates a new Handler serving svc. The store is used directly only by
+// the routes that have no service counterpart: import, export, the archive
+// and admin.
+func New(s *store.Store, svc *service.Chargebacks) *Handler {
+	h := &Handler{store: s, svc: svc}
+	h.chargebacks = NewResource(h, svc.Resource)
+	h.chargebacks.expand = h.expandChargeback
+	h.chargebacks.scopes = map[string]func(context.Context, string, func(models.Chargeback) error) error{
+		"merchantId": svc.ForEachOfMerchant,
+	}
+	h.charges = NewResource(h, svc.Charges)
+	h.merchants = NewResource(h, svc.Merchants)
+	return h
 }
 
 // writeJSON serialises v as JSON and writes it to w with the given status code.
@@ -44,144 +123,384 @@ func writeJSON(w http.ResponseWriter, status int, v any) {
 	json.NewEncoder(w).Encode(v) //nolint:errcheck
 }
 
-// writeError writes a JSON error response.
+// writeError writes a JSON error response. The request ID assigned by the
+// RequestID middleware is echoed in the body so a client can quote it when
+// reporting a failure; it is read back from the response header the
+// middleware already set, which avoids threading the request through every
+// call site.
 func writeError(w http.ResponseWriter, status int, msg string) {
-	writeJSON(w, status, map[string]string{"error": msg})
+	body := map[string]string{"error": msg}
+	if id := w.Header().Get("X-Request-ID"); id != "" {
+		body["requestId"] = id
+	}
+	writeJSON(w, status, body)
+}
+
+// validationErrorBody is the 422 response body: the usual error fields plus
+// one entry per invalid field.
+type validationErrorBody struct {
+	Error     string              `json:"error"`
+	Fields    []models.FieldError `json:"fields"`
+	RequestID string              `json:"requestId,omitempty"`
 }
 
-// ServeHTTP routes requests to the appropriate sub-handler based on the HTTP
-// method. The mux in main.go maps this handler to /chargebacks/{id} and
-// /chargebacks patterns.
+// writeFieldErrors writes a 422 response listing invalid fields.
+func writeFieldErrors(w http.ResponseWriter, fields []models.FieldError) {
+	writeJSON(w, http.StatusUnprocessableEntity, validationErrorBody{
+		Error:     "validation failed",
+		Fields:    fields,
+		RequestID: w.Header().Get("X-Request-ID"),
+	})
+}
+
+// policyErrorBody is the 422 response body of a write refused by policy:
+// the usual error fields plus one entry per rule broken.
+type policyErrorBody struct {
+	Error      string                   `json:"error"`
+	Violations []models.PolicyViolation `json:"violations"`
+	RequestID  string                   `json:"requestId,omitempty"`
+}
+
+// writeViolations writes a 422 response listing the policy rules broken.
+func writeViolations(w http.ResponseWriter, violations []models.PolicyViolation) {
+	writeJSON(w, http.StatusUnprocessableEntity, policyErrorBody{
+		Error:      "refused by policy",
+		Violations: violations,
+		RequestID:  w.Header().Get("X-Request-ID"),
+	})
+}
+
+// deletedOne and deletedMany are the response bodies of the delete routes.
+// They are structs rather than maps because encoding/xml cannot marshal maps.
+type deletedOne struct {
+	XMLName xml.Name `json:"-" xml:"result"`
+	Deleted string   `json:"deleted" xml:"deleted"`
+}
+
+type deletedMany struct {
+	XMLName xml.Name `json:"-" xml:"result"`
+	Deleted int      `json:"deleted" xml:"deleted"`
+}
+
+// ServeHTTP serves the routes of h, without the middleware main adds.
 func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	switch r.Method {
-	case http.MethodGet:
-		h.list(w, r)
-	case http.MethodPost:
-		h.create(w, r)
-	case http.MethodPut:
-		h.update(w, r)
-	case http.MethodDelete:
-		h.delete(w, r)
-	default:
-		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
-	}
-}
-
-// list handles GET /chargebacks.
-// Returns all chargebacks as a JSON array. Pure read – always safe to retry.
-func (h *Handler) list(w http.ResponseWriter, r *http.Request) {
-	items, err := h.store.List()
+	h.muxOnce.Do(func() {
+		h.mux = http.NewServeMux()
+		openapi.Mount(h.mux, h.Routes())
+	})
+	h.mux.ServeHTTP(w, r)
+}
+
+// acceptable wraps the handler of a route serving the negotiated media
+// types. It negotiates before doing any work, so that a POST the client
+// cannot read the response of does not create a record, and fences writes.
+func acceptable(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := negotiate(r); !ok {
+			writeError(w, http.StatusNotAcceptable, "supported media types: "+supportedTypes())
+			return
+		}
+		next(w, fenced(r))
+	}
+}
+
+// Stats handles GET /chargebacks/stats: the number of chargebacks and their
+// summed amounts per currency, for the caller's tenant only, or with
+// ?merchantId= for one merchant. ?convertTo= adds their total in one
+// currency.
+func (h *Handler) Stats(w http.ResponseWriter, r *http.Request) {
+	if _, ok := negotiate(r); !ok {
+		writeError(w, http.StatusNotAcceptable, "supported media types: "+supportedTypes())
+		return
+	}
+	var (
+		stats *models.Stats
+		err   error
+	)
+	if merchant := r.URL.Query().Get("merchantId"); merchant != "" {
+		stats, err = h.svc.MerchantStats(r.Context(), merchant)
+	} else {
+		stats, err = h.svc.Stats(r.Context())
+	}
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, "failed to list chargebacks")
+		h.fail(w, r, err, "failed to compute stats")
 		return
 	}
-	writeJSON(w, http.StatusOK, items)
+	if to := r.URL.Query().Get("convertTo"); to != "" {
+		err := h.svc.Convert(r.Context(), stats, to)
+		switch {
+		case writeInvalid(w, err):
+			return
+		case errors.Is(err, service.ErrNoRates):
+			writeError(w, http.StatusServiceUnavailable, err.Error())
+			return
+		case err != nil:
+			h.fail(w, r, err, "failed to convert stats")
+			return
+		}
+	}
+	respond(w, r, http.StatusOK, stats)
 }
 
-// create handles POST /chargebacks/{id}.
-//
-// The {id} path parameter is the idempotency key. The server uses it to detect
-// duplicate requests:
-//   - First call  → creates the record, returns 201 Created.
-//   - Retry calls → returns the SAME record, returns 200 OK (no write).
-//
-// This pattern is used by payment processors like Stripe and Adyen to make
-// charge operations safe to retry without risk of double-charging.
-func (h *Handler) create(w http.ResponseWriter, r *http.Request) {
-	id := r.PathValue("id")
-	if id == "" {
-		writeError(w, http.StatusBadRequest, "missing id in path")
+// Archive handles GET /chargebacks/archive: the archived chargebacks, in
+// order of creation, optionally limited to a range of creation times like the
+// list.
+func (h *Handler) Archive(w http.ResponseWriter, r *http.Request) {
+	after, ok := timeParam(w, r, "createdAfter")
+	if !ok {
 		return
 	}
+	before, ok := timeParam(w, r, "createdBefore")
+	if !ok {
+		return
+	}
+	forEach := func(fn func(models.Chargeback) error) error {
+		return h.store.ForEachArchived(r.Context(), after, before, fn)
+	}
 
-	var body models.Chargeback
-	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
-		writeError(w, http.StatusBadRequest, "invalid JSON body")
+	c, ok := negotiate(r)
+	if !ok || c.list == nil {
+		items := []models.Chargeback{}
+		err := forEach(func(c models.Chargeback) error {
+			items = append(items, c)
+			return nil
+		})
+		if err != nil {
+			h.fail(w, r, err, "failed to list archived chargebacks")
+			return
+		}
+		respond(w, r, http.StatusOK, items)
 		return
 	}
-	body.ID = id
 
-	result, created, err := h.store.Create(&body)
+	w.Header().Add("Vary", "Accept")
+	err := streamList(w, r, c, func(yield func(any) error) error {
+		return forEach(func(c models.Chargeback) error { return yield(c) })
+	})
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, "failed to create chargeback")
-		return
+		h.fail(w, r, err, "failed to list archived chargebacks")
 	}
+}
 
+// Erase handles POST /chargebacks/{id}/erase: the chargeback's personal
+// fields are cleared and the proof of erasure is returned with 201. Erasing
+// again returns the same proof with 200, even after the chargeback has been
+// deleted.
+func (h *Handler) Erase(w http.ResponseWriter, r *http.Request) {
+	if _, ok := negotiate(r); !ok {
+		writeError(w, http.StatusNotAcceptable, "supported media types: "+supportedTypes())
+		return
+	}
+	r = fenced(r)
+	proof, created, err := h.svc.Erase(r.Context(), r.PathValue("id"))
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		writeError(w, http.StatusNotFound, "chargeback not found")
+		return
+	case err != nil:
+		h.fail(w, r, err, "failed to erase chargeback")
+		return
+	}
+	setReplayed(w, !created, proof.ErasedAt)
 	if created {
-		// New record – return 201 Created.
-		writeJSON(w, http.StatusCreated, result)
-	} else {
-		// Duplicate request detected – return existing record with 200 OK.
-		// The client receives the same data it would have received on the first
-		// call, making the overall operation transparent to retry logic.
-		writeJSON(w, http.StatusOK, result)
+		respond(w, r, http.StatusCreated, proof)
+		return
+	}
+	respond(w, r, http.StatusOK, proof)
+}
+
+// expandedChargeback is a chargeback with the related records requested
+// with ?expand= on GET /chargebacks/{id}.
+type expandedChargeback struct {
+	XMLName xml.Name `json:"-" xml:"chargeback"`
+	*models.Chargeback
+	Charge  *models.Charge  `json:"charge,omitempty" xml:"charge,omitempty"`
+	Refunds []models.Refund `json:"refunds,omitempty" xml:"refunds>refund,omitempty"`
+}
+
+// expandChargeback adds the records named in expand to c: "charge", the
+// charge it references, and "refunds".
+func (h *Handler) expandChargeback(ctx context.Context, c *models.Chargeback, expand []string) (any, error) {
+	out := expandedChargeback{Chargeback: c}
+	for _, name := range expand {
+		switch name {
+		case "charge":
+			if c.ChargeID == "" {
+				continue
+			}
+			charge, err := h.svc.Charges.Get(ctx, c.ChargeID)
+			if err != nil && !errors.Is(err, store.ErrNotFound) {
+				return nil, err
+			}
+			out.Charge = charge
+		case "refunds":
+			refunds, err := h.svc.Refunds(ctx, c.ID)
+			if err != nil {
+				return nil, err
+			}
+			out.Refunds = refunds
+		default:
+			return nil, &service.InvalidError{Reason: "cannot expand " + strconv.Quote(name) + ": expected charge or refunds"}
+		}
 	}
+	return out, nil
 }
 
-// update handles PUT /chargebacks/{id}.
+// IdempotencyKeyHeader carries the client's idempotency key on POST
+// /chargebacks, where the record ID is chosen by the server.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// createWithKey handles POST /chargebacks.
+//
+// The two create routes illustrate the two common idempotency styles. With
+// POST /chargebacks/{id} the record's natural key is the idempotency key. Here
+// the server mints a ULID for the record – a surrogate key the client cannot
+// know in advance – so the client sends a separate Idempotency-Key header:
+//   - First call  → creates the record, returns 201 Created with Location.
+//   - Retry calls → returns the record the first call created, 200 OK.
+//   - Same key, different payload → 422, because replaying the first
+//     response would hide that the second request was never applied.
 //
-// Write-avoidance: the handler compares the incoming payload with the stored
-// record. If they are identical no write is performed and 200 OK is returned
-// with the existing record. This means:
-//   - Clients can retry a PUT without causing unnecessary database writes.
-//   - Downstream systems (audit logs, CDC streams) are not polluted with
-//     no-op changes.
-//   - The response is always deterministic for the same input.
-func (h *Handler) update(w http.ResponseWriter, r *http.Request) {
-	id := r.PathValue("id")
-	if id == "" {
-		writeError(w, http.StatusBadRequest, "missing id in path")
+// With Prefer: respond-async the create runs in the background instead; see
+// createAsync.
+func (h *Handler) createWithKey(w http.ResponseWriter, r *http.Request) {
+	key := r.Header.Get(IdempotencyKeyHeader)
+	if key == "" {
+		writeError(w, http.StatusBadRequest, "missing "+IdempotencyKeyHeader+" header")
+		return
+	}
+	if desc := h.svc.KeyFormat.Check(key); desc != "" {
+		writeFieldErrors(w, []models.FieldError{{Field: IdempotencyKeyHeader, Message: desc}})
 		return
 	}
 
 	var body models.Chargeback
-	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
-		writeError(w, http.StatusBadRequest, "invalid JSON body")
+	if !h.decodeBody(w, r, &body) {
+		return
+	}
+	if h.Async != nil && prefers(r, "respond-async") {
+		h.createAsync(w, r, key, &body)
 		return
 	}
 
-	result, written, err := h.store.Update(id, &body)
-	if err != nil {
-		if errors.Is(err, store.ErrNotFound) {
-			writeError(w, http.StatusNotFound, "chargeback not found")
-			return
-		}
-		writeError(w, http.StatusInternalServerError, "failed to update chargeback")
+	result, created, err := h.svc.CreateWithKey(r.Context(), key, &body)
+	switch {
+	case writeInvalid(w, err):
+		return
+	case errors.Is(err, store.ErrKeyReused):
+		writeError(w, http.StatusUnprocessableEntity, "idempotency key was already used with a different payload")
+		return
+	case errors.Is(err, store.ErrNotFound):
+		writeError(w, http.StatusNotFound, "the chargeback created with this idempotency key has been deleted")
+		return
+	case err != nil:
+		h.fail(w, r, err, "failed to create chargeback")
 		return
 	}
 
-	// Return a custom header so the caller can observe whether a write
-	// actually occurred. This is useful for debugging and demonstrates the
-	// write-avoidance optimisation in action.
-	if written {
-		w.Header().Set("X-Idempotency-Write", "true")
+	// The Location is sent on replays too: the client could not know the
+	// minted ID otherwise.
+	location := locate(r, "/chargebacks/"+result.ID)
+	setReplayed(w, !created, result.CreatedAt)
+	setETag(w, result)
+	if created {
+		h.Policy.created(w, r, location, result)
 	} else {
-		w.Header().Set("X-Idempotency-Write", "false")
+		w.Header().Set("Location", location)
+		h.Policy.duplicate(w, r, location, result)
 	}
+}
+
+// Headers reporting whether a POST or DELETE changed anything. PUT reports
+// the same with X-Idempotency-Write.
+const (
+	// ReplayedHeader is "true" when a create found the record an earlier
+	// request made, or a delete found nothing to delete, and "false" when
+	// the request wrote.
+	ReplayedHeader = "X-Idempotency-Replayed"
+
+	// OriginalCreatedAtHeader accompanies a replayed create with the time
+	// the record was first created, i.e. when the original request ran.
+	OriginalCreatedAtHeader = "X-Idempotency-Original-Created-At"
+)
+
+// FencingTokenHeader carries the fencing token of the write a request made:
+// a number larger than that of every earlier write, which a client passes to
+// the systems it triggers side effects in so that they can refuse commands
+// older than one they have already acted on (see store.AcceptFencingToken).
+// It is absent when the request wrote nothing, e.g. on a replay.
+const FencingTokenHeader = "X-Fencing-Token"
 
-	writeJSON(w, http.StatusOK, result)
+// fenced returns r with a context collecting the fencing token of the
+// request's write, if it makes one.
+func fenced(r *http.Request) *http.Request {
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		return r
+	}
+	return r.WithContext(store.WithFencing(r.Context()))
+}
+
+// setFencingToken sets FencingTokenHeader if the request made a write.
+func setFencingToken(w http.ResponseWriter, r *http.Request) {
+	if t := store.FencingTokenFrom(r.Context()); t != 0 {
+		w.Header().Set(FencingTokenHeader, strconv.FormatUint(t, 10))
+	}
 }
 
-// delete handles DELETE /chargebacks/{id}.
+// replayHeaders are the headers of a replayed create.
+var replayHeaders = []string{ReplayedHeader, OriginalCreatedAtHeader}
+
+// setReplayed sets ReplayedHeader and, for a replayed create, the original
+// creation time. A zero createdAt omits it.
+func setReplayed(w http.ResponseWriter, replayed bool, createdAt time.Time) {
+	w.Header().Set(ReplayedHeader, strconv.FormatBool(replayed))
+	if replayed && !createdAt.IsZero() {
+		w.Header().Set(OriginalCreatedAtHeader, createdAt.UTC().Format(time.RFC3339Nano))
+	}
+}
+
+// UpdateMaskHeader selects the fields a PUT updates.
+const UpdateMaskHeader = "X-Update-Mask"
+
+// deleteMany handles DELETE /chargebacks?currency=USD&before=2024-01-01.
 //
-// Idempotent delete: if the resource does not exist the handler still returns
-// 200 OK. This is intentional – the desired end state (record does not exist)
-// is already achieved regardless of whether a delete was actually performed.
+// All matching records are removed in a single transaction and the number
+// deleted is returned. Retrying is safe: once the matching records are gone
+// the end state is already achieved, so a retry returns 200 OK with a count
+// of zero instead of an error.
 //
-// Alternative design: some APIs return 204 No Content for both cases. We
-// return 200 OK with a small JSON body so the client can log a meaningful
-// message without special-casing status codes.
-func (h *Handler) delete(w http.ResponseWriter, r *http.Request) {
-	id := r.PathValue("id")
-	if id == "" {
-		writeError(w, http.StatusBadRequest, "missing id in path")
+// At least one filter is required so that a bare DELETE /chargebacks cannot
+// wipe the whole dataset by accident.
+func (h *Handler) deleteMany(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	f := store.Filter{Currency: q.Get("currency")}
+	if v := q.Get("before"); v != "" {
+		before, err := parseTime(v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid before: expected YYYY-MM-DD or RFC 3339")
+			return
+		}
+		f.Before = before
+	}
+	n, err := h.svc.DeleteMatching(r.Context(), f)
+	if writeInvalid(w, err) {
 		return
 	}
-
-	if err := h.store.Delete(id); err != nil {
-		writeError(w, http.StatusInternalServerError, "failed to delete chargeback")
+	if err != nil {
+		h.fail(w, r, err, "failed to delete chargebacks")
 		return
 	}
+	setReplayed(w, n == 0, time.Time{})
 
-	writeJSON(w, http.StatusOK, map[string]string{"deleted": id})
+	respond(w, r, http.StatusOK, deletedMany{Deleted: n})
+}
+
+// parseTime accepts either a calendar date (interpreted as midnight UTC) or a
+// full RFC 3339 timestamp.
+func parseTime(v string) (time.Time, error) {
+	if t, err := time.Parse(time.DateOnly, v); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, v)
 }
@@ -0,0 +1,46 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/arkantrust/idempotency-example/backend/models"
+)
+
+func TestChargebacksExpandTheirCharge(t *testing.T) {
+	h := newTestHandler(t)
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return rec
+	}
+
+	body := `{"amount":100,"currency":"USD","reason":"fraud","chargeId":"ch-1"}`
+	if rec := do(http.MethodPost, "/chargebacks/cb-1", body); rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422 without the charge, got %d: %s", rec.Code, rec.Body)
+	}
+	if rec := do(http.MethodPost, "/charges/ch-1", `{"amount":250,"currency":"USD","description":"order 42"}`); rec.Code != http.StatusCreated {
+		t.Fatalf("expected the charge created, got %d: %s", rec.Code, rec.Body)
+	}
+	if rec := do(http.MethodDelete, "/charges/ch-1", ""); rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected charges not to be deletable, got %d: %s", rec.Code, rec.Body)
+	}
+	if rec := do(http.MethodPost, "/chargebacks/cb-1", body); rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body)
+	}
+
+	rec := do(http.MethodGet, "/chargebacks/cb-1?expand=charge", "")
+	var got struct {
+		ChargeID string         `json:"chargeId"`
+		Charge   *models.Charge `json:"charge"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("expand: %d %v: %s", rec.Code, err, rec.Body)
+	}
+	if got.ChargeID != "ch-1" || got.Charge == nil || got.Charge.Amount != 250 {
+		t.Fatalf("unexpected expansion: %s", rec.Body)
+	}
+}
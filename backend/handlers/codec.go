@@ -0,0 +1,299 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// codec encodes response bodies and decodes request bodies in one media
+// type.
+type codec struct {
+	contentType string
+	encode      func(w io.Writer, v any) error
+	decode      func(data []byte, v any) error
+
+	// list, when set, starts a list written to w one item at a time; see
+	// respondList. Media types that need the length up front leave it nil.
+	list func(w io.Writer) (listWriter, error)
+}
+
+// listWriter writes the items of a list as they come, then the list's end.
+type listWriter interface {
+	Item(v any) error
+	Close() error
+}
+
+// codecs is the registry consulted for content negotiation, in order of
+// preference. JSON comes first so that it wins whenever the client has no
+// preference. To support another media type, append a codec here.
+var codecs = []codec{
+	{
+		contentType: "application/json",
+		encode:      func(w io.Writer, v any) error { return json.NewEncoder(w).Encode(v) },
+		decode: func(data []byte, v any) error {
+			// encoding/json has no depth limit of its own worth relying on.
+			if err := checkDepth(data); err != nil {
+				return err
+			}
+			return json.Unmarshal(data, v)
+		},
+		list: func(w io.Writer) (listWriter, error) { return &jsonList{w: w}, nil },
+	},
+	{
+		contentType: "application/xml",
+		encode:      encodeXML,
+		decode:      xml.Unmarshal,
+		list:        newXMLList,
+	},
+	{
+		contentType: "application/msgpack",
+		encode: func(w io.Writer, v any) error {
+			enc := msgpack.NewEncoder(w)
+			enc.SetCustomStructTag("json")
+			return enc.Encode(v)
+		},
+		decode: func(data []byte, v any) error {
+			dec := msgpack.NewDecoder(bytes.NewReader(data))
+			dec.SetCustomStructTag("json")
+			return dec.Decode(v)
+		},
+	},
+}
+
+// encodeXML writes v as an XML document. Slices have no natural root element,
+// so they are wrapped in <items>.
+func encodeXML(w io.Writer, v any) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice {
+		if _, err := io.WriteString(w, xml.Header); err != nil {
+			return err
+		}
+		return xml.NewEncoder(w).Encode(v)
+	}
+
+	list, err := newXMLList(w)
+	if err != nil {
+		return err
+	}
+	for i := range rv.Len() {
+		if err := list.Item(rv.Index(i).Interface()); err != nil {
+			return err
+		}
+	}
+	return list.Close()
+}
+
+// jsonList writes a JSON array, byte for byte what the codec's encode writes
+// for a slice.
+type jsonList struct {
+	w io.Writer
+	n int
+}
+
+func (l *jsonList) Item(v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	sep := ","
+	if l.n == 0 {
+		sep = "["
+	}
+	l.n++
+	if _, err := io.WriteString(l.w, sep); err != nil {
+		return err
+	}
+	_, err = l.w.Write(data)
+	return err
+}
+
+func (l *jsonList) Close() error {
+	end := "]\n"
+	if l.n == 0 {
+		end = "[]\n"
+	}
+	_, err := io.WriteString(l.w, end)
+	return err
+}
+
+// xmlList writes the <items> document encodeXML writes for a slice.
+type xmlList struct {
+	enc  *xml.Encoder
+	root xml.StartElement
+}
+
+func newXMLList(w io.Writer) (listWriter, error) {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return nil, err
+	}
+	l := &xmlList{enc: xml.NewEncoder(w), root: xml.StartElement{Name: xml.Name{Local: "items"}}}
+	return l, l.enc.EncodeToken(l.root)
+}
+
+func (l *xmlList) Item(v any) error { return l.enc.Encode(v) }
+
+func (l *xmlList) Close() error {
+	if err := l.enc.EncodeToken(l.root.End()); err != nil {
+		return err
+	}
+	return l.enc.Flush()
+}
+
+// negotiate picks the response codec for r's Accept header. A missing header
+// or a wildcard selects JSON. It returns false when the client accepts none
+// of the registered media types.
+func negotiate(r *http.Request) (codec, bool) {
+	accept := r.Header.Get("Accept")
+	if accept == "" {
+		return codecs[0], true
+	}
+
+	type ranged struct {
+		typ string
+		q   float64
+	}
+	var ranges []ranged
+	for _, part := range strings.Split(accept, ",") {
+		typ, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		if q > 0 {
+			ranges = append(ranges, ranged{typ, q})
+		}
+	}
+	// Stable, so that equally weighted ranges keep the client's order.
+	sort.SliceStable(ranges, func(i, j int) bool { return ranges[i].q > ranges[j].q })
+
+	for _, rg := range ranges {
+		for _, c := range codecs {
+			if rg.typ == c.contentType || rg.typ == "*/*" || rg.typ == "application/*" {
+				return c, true
+			}
+		}
+	}
+	return codec{}, false
+}
+
+// requestCodec picks the codec for r's Content-Type. A missing header is
+// treated as JSON, which is what every client sent before other media types
+// were supported.
+func requestCodec(r *http.Request) (codec, bool) {
+	ct := r.Header.Get("Content-Type")
+	if ct == "" {
+		return codecs[0], true
+	}
+	typ, _, err := mime.ParseMediaType(ct)
+	if err != nil {
+		return codec{}, false
+	}
+	for _, c := range codecs {
+		if typ == c.contentType {
+			return c, true
+		}
+	}
+	return codec{}, false
+}
+
+// respond writes v in the media type the client asked for. Clients that
+// accept none of the supported types get 406, though ServeHTTP normally
+// rejects them before this point. Error responses are always JSON – see
+// writeError – so clients have a single error shape to parse.
+func respond(w http.ResponseWriter, r *http.Request, status int, v any) {
+	w.Header().Add("Vary", "Accept")
+	c, ok := negotiate(r)
+	if !ok {
+		writeError(w, http.StatusNotAcceptable, "supported media types: "+supportedTypes())
+		return
+	}
+	setFencingToken(w, r)
+	w.Header().Set("Content-Type", c.contentType)
+	w.WriteHeader(status)
+	c.encode(w, v) //nolint:errcheck
+}
+
+// streamFlushEvery is how many items a stream writes between explicit
+// flushes. Flushing periodically keeps the client receiving data steadily
+// instead of waiting for the server-side buffer to fill.
+const streamFlushEvery = 100
+
+// streamList writes, with c.list, the items each passes to yield. Nothing is
+// written until the first item (or the end of an empty list), so an error
+// from each before that is returned for the caller to report with a status of
+// its own. After that the status is committed and an error can only be
+// logged: the truncated body is the client's signal that the list is
+// incomplete.
+func streamList(w http.ResponseWriter, r *http.Request, c codec, each func(yield func(any) error) error) error {
+	var (
+		list    listWriter
+		started bool
+	)
+	start := func() (err error) {
+		started = true
+		w.Header().Set("Content-Type", c.contentType)
+		w.WriteHeader(http.StatusOK)
+		list, err = c.list(w)
+		return err
+	}
+
+	flusher, _ := w.(http.Flusher)
+	n := 0
+	err := each(func(v any) error {
+		if !started {
+			if err := start(); err != nil {
+				return err
+			}
+		}
+		if err := list.Item(v); err != nil {
+			return err
+		}
+		n++
+		if n%streamFlushEvery == 0 && flusher != nil {
+			flusher.Flush()
+		}
+		return nil
+	})
+	if err == nil && !started {
+		err = start()
+	}
+	if err == nil {
+		err = list.Close()
+	}
+	if err != nil && !started {
+		return err
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "list stream aborted", "records", n, "err", err)
+	}
+	return nil
+}
+
+// mediaTypes lists the registered content types in order of preference.
+func mediaTypes() []string {
+	types := make([]string, len(codecs))
+	for i, c := range codecs {
+		types[i] = c.contentType
+	}
+	return types
+}
+
+func supportedTypes() string {
+	return strings.Join(mediaTypes(), ", ")
+}
@@ -0,0 +1,139 @@
+package handlers_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/vmihailenco/msgpack/v5"
+
+	"github.com/arkantrust/idempotency-example/backend/handlers"
+	"github.com/arkantrust/idempotency-example/backend/models"
+	"github.com/arkantrust/idempotency-example/backend/service"
+)
+
+func TestCreateXML(t *testing.T) {
+	h := newTestHandler(t)
+
+	body := `<chargeback><amount>100</amount><currency>EUR</currency><reason>fraud</reason></chargeback>`
+	req := httptest.NewRequest(http.MethodPost, "/chargebacks/cb-1", strings.NewReader(body))
+	req.SetPathValue("id", "cb-1")
+	req.Header.Set("Content-Type", "application/xml")
+	req.Header.Set("Accept", "application/xml")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/xml" {
+		t.Fatalf("expected application/xml, got %q", ct)
+	}
+	var got models.Chargeback
+	if err := xml.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if got.ID != "cb-1" || got.Amount != 100 || got.Currency != "EUR" {
+		t.Fatalf("unexpected record: %+v", got)
+	}
+}
+
+func TestListMsgpack(t *testing.T) {
+	h := newTestHandler(t)
+	if rec := post(h, `{"amount":100,"currency":"USD","reason":"fraud"}`); rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d", rec.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/chargebacks", nil)
+	req.Header.Set("Accept", "application/json;q=0.5, application/msgpack")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if ct := rec.Header().Get("Content-Type"); ct != "application/msgpack" {
+		t.Fatalf("expected application/msgpack, got %q", ct)
+	}
+	dec := msgpack.NewDecoder(bytes.NewReader(rec.Body.Bytes()))
+	dec.SetCustomStructTag("json")
+	var got []models.Chargeback
+	if err := dec.Decode(&got); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(got) != 1 || got[0].ID != "cb-1" {
+		t.Fatalf("unexpected records: %+v", got)
+	}
+}
+
+func TestUnsupportedMediaTypes(t *testing.T) {
+	h := newTestHandler(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/chargebacks", nil)
+	req.Header.Set("Accept", "text/csv")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotAcceptable {
+		t.Fatalf("expected 406, got %d", rec.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/chargebacks/cb-1", strings.NewReader("amount=100"))
+	req.SetPathValue("id", "cb-1")
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnsupportedMediaType {
+		t.Fatalf("expected 415, got %d", rec.Code)
+	}
+}
+
+// TestListStreamed checks that the streamed list is the same document the
+// codecs write for a slice, including when it is empty.
+func TestListStreamed(t *testing.T) {
+	s := newTestStore(t)
+	h := handlers.New(s, service.NewChargebacks(s))
+
+	list := func(accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/chargebacks", nil)
+		req.Header.Set("Accept", accept)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+		}
+		return rec
+	}
+
+	if body := list("application/json").Body.String(); body != "[]\n" {
+		t.Fatalf("expected an empty array, got %q", body)
+	}
+
+	for _, id := range []string{"cb-1", "cb-2", "cb-3"} {
+		if _, _, err := s.Create(context.Background(), &models.Chargeback{ID: id, Amount: 100, Currency: "USD", Reason: "fraud"}); err != nil {
+			t.Fatalf("create %s: %v", id, err)
+		}
+	}
+	items, err := s.List(context.Background())
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+
+	var want bytes.Buffer
+	json.NewEncoder(&want).Encode(items) //nolint:errcheck
+	if got := list("application/json").Body.String(); got != want.String() {
+		t.Fatalf("streamed JSON differs from encoded list:\n got %s\nwant %s", got, want.String())
+	}
+
+	rec := list("application/xml")
+	var doc struct {
+		Items []models.Chargeback `xml:"chargeback"`
+	}
+	if err := xml.Unmarshal(rec.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("failed to decode XML: %v", err)
+	}
+	if len(doc.Items) != 3 || doc.Items[2].ID != "cb-3" {
+		t.Fatalf("unexpected records: %+v", doc.Items)
+	}
+}
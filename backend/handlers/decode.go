@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+)
+
+const (
+	// DefaultMaxBodyBytes is the request body limit used when
+	// Handler.MaxBodyBytes is zero. A chargeback is a few hundred bytes, so
+	// this is generous.
+	DefaultMaxBodyBytes = 1 << 20
+
+	// maxJSONDepth bounds the nesting of arrays and objects in a request
+	// body. Chargebacks are flat; anything deeper than this is an attack on
+	// the decoder, not a real payload.
+	maxJSONDepth = 32
+)
+
+// errTooDeep is returned by checkDepth for bodies nested beyond maxJSONDepth.
+var errTooDeep = errors.New("JSON nested too deeply")
+
+// decodeBody reads the request body into v using the codec selected by its
+// Content-Type, enforcing the size limit and, for JSON, the nesting guard and
+// strict mode. On
+// failure it writes the error response – 413 for an oversized body, 415 for an
+// unsupported media type, 400 otherwise – and returns false.
+//
+// The body is read in full before decoding so that the limit applies to the
+// raw bytes and a malicious payload is rejected before the decoder builds any
+// values from it.
+func (h *Handler) decodeBody(w http.ResponseWriter, r *http.Request, v any) bool {
+	c, ok := requestCodec(r)
+	if !ok {
+		writeError(w, http.StatusUnsupportedMediaType, "supported media types: "+supportedTypes())
+		return false
+	}
+
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, h.bodyLimit()))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		writeError(w, http.StatusRequestEntityTooLarge, "request body too large")
+		return false
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "failed to read body")
+		return false
+	}
+
+	decode := c.decode
+	if c.contentType == codecs[0].contentType && h.strict(r) {
+		decode = decodeStrict
+	}
+	if err := decode(data, v); err != nil {
+		var se strictError
+		if errors.Is(err, errTooDeep) || errors.As(err, &se) {
+			writeError(w, http.StatusBadRequest, "invalid JSON body: "+err.Error())
+			return false
+		}
+		writeError(w, http.StatusBadRequest, "invalid "+c.contentType+" body")
+		return false
+	}
+	return true
+}
+
+// bodyLimit returns the limit on request bodies.
+func (h *Handler) bodyLimit() int64 {
+	if h.MaxBodyBytes <= 0 {
+		return DefaultMaxBodyBytes
+	}
+	return h.MaxBodyBytes
+}
+
+// strict reports whether r's JSON body must be decoded strictly.
+func (h *Handler) strict(r *http.Request) bool {
+	return h.StrictJSON || r.Header.Get(StrictHeader) == "true"
+}
+
+// checkDepth returns errTooDeep if data nests arrays or objects more than
+// maxJSONDepth levels deep. It only tracks brackets outside of strings and
+// leaves all other validation to the decoder.
+func checkDepth(data []byte) error {
+	depth := 0
+	inString, escaped := false, false
+	for _, b := range data {
+		switch {
+		case escaped:
+			escaped = false
+		case inString:
+			switch b {
+			case '\\':
+				escaped = true
+			case '"':
+				inString = false
+			}
+		case b == '"':
+			inString = true
+		case b == '{' || b == '[':
+			depth++
+			if depth > maxJSONDepth {
+				return errTooDeep
+			}
+		case b == '}' || b == ']':
+			depth--
+		}
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/arkantrust/idempotency-example/backend/handlers"
+	"github.com/arkantrust/idempotency-example/backend/service"
+	"github.com/arkantrust/idempotency-example/backend/store"
+)
+
+func newTestStore(t testing.TB) *store.Store {
+	t.Helper()
+	s, err := store.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to open test store: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func newTestHandler(t testing.TB) *handlers.Handler {
+	t.Helper()
+	s := newTestStore(t)
+	return handlers.New(s, service.NewChargebacks(s))
+}
+
+func post(h http.Handler, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/chargebacks/cb-1", strings.NewReader(body))
+	req.SetPathValue("id", "cb-1")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestCreateRejectsOversizedBody(t *testing.T) {
+	h := newTestHandler(t)
+	h.MaxBodyBytes = 64
+
+	body := `{"amount":100,"currency":"USD","reason":"` + strings.Repeat("x", 100) + `"}`
+	if rec := post(h, body); rec.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected 413, got %d: %s", rec.Code, rec.Body)
+	}
+	if rec := post(h, `{"amount":100,"currency":"USD","reason":"fraud"}`); rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201 for a body within the limit, got %d: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestCreateRejectsDeeplyNestedJSON(t *testing.T) {
+	h := newTestHandler(t)
+
+	deep := `{"amount":100,"extra":` + strings.Repeat("[", 1000) + strings.Repeat("]", 1000) + `}`
+	if rec := post(h, deep); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d: %s", rec.Code, rec.Body)
+	}
+
+	// Brackets inside strings do not count towards the depth.
+	quoted := `{"amount":100,"currency":"USD","reason":"` + strings.Repeat("[", 100) + `"}`
+	if rec := post(h, quoted); rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestStrictJSON(t *testing.T) {
+	h := newTestHandler(t)
+
+	typo := `{"ammount":100,"currency":"USD","reason":"fraud"}`
+	dup := `{"amount":100,"amount":5,"currency":"USD","reason":"fraud"}`
+
+	// Lenient by default: the typo is dropped and validation catches the
+	// missing amount, while the duplicate key silently wins.
+	if rec := post(h, dup); rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201 in lenient mode, got %d: %s", rec.Code, rec.Body)
+	}
+
+	for name, body := range map[string]string{"unknown field": typo, "duplicate key": dup} {
+		req := httptest.NewRequest(http.MethodPost, "/chargebacks/cb-2", strings.NewReader(body))
+		req.SetPathValue("id", "cb-2")
+		req.Header.Set(handlers.StrictHeader, "true")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusBadRequest {
+			t.Fatalf("%s: expected 400, got %d: %s", name, rec.Code, rec.Body)
+		}
+	}
+
+	h.StrictJSON = true
+	if rec := post(h, typo); rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "ammount") {
+		t.Fatalf("expected 400 naming the unknown field, got %d: %s", rec.Code, rec.Body)
+	}
+	replay := `{"amount":100,"currency":"USD","reason":"fraud","id":"cb-1"}`
+	if rec := post(h, replay); rec.Code != http.StatusOK {
+		t.Fatalf("expected a strict replay to succeed, got %d: %s", rec.Code, rec.Body)
+	}
+}
@@ -0,0 +1,48 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/arkantrust/idempotency-example/backend/handlers"
+)
+
+func del(h http.Handler, query, ifMatch string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodDelete, "/chargebacks/cb-1"+query, nil)
+	req.SetPathValue("id", "cb-1")
+	if ifMatch != "" {
+		req.Header.Set(handlers.IfMatchHeader, ifMatch)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestConditionalDelete(t *testing.T) {
+	h := newTestHandler(t)
+	created := post(h, `{"amount":100,"currency":"USD","reason":"fraud"}`)
+	etag := created.Header().Get(handlers.ETagHeader)
+	if etag == "" {
+		t.Fatalf("expected an ETag on create")
+	}
+
+	if rec := del(h, "", `"stale"`); rec.Code != http.StatusPreconditionFailed {
+		t.Fatalf("expected 412 for a stale ETag, got %d: %s", rec.Code, rec.Body)
+	}
+	if rec := del(h, "?return=everything", etag); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an unknown return, got %d", rec.Code)
+	}
+
+	rec := del(h, "?return=record", `"stale", `+etag)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"reason":"fraud"`) || rec.Header().Get(handlers.ReplayedHeader) != "false" {
+		t.Fatalf("expected the removed record, got %d %q: %s", rec.Code, rec.Header().Get(handlers.ReplayedHeader), rec.Body)
+	}
+
+	// The retry finds the record gone: that is not a failed precondition.
+	rec = del(h, "?return=record", etag)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"tombstone":true`) || rec.Header().Get(handlers.ReplayedHeader) != "true" {
+		t.Fatalf("expected a tombstone on retry, got %d %q: %s", rec.Code, rec.Header().Get(handlers.ReplayedHeader), rec.Body)
+	}
+}
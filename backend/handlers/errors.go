@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/arkantrust/idempotency-example/backend/store"
+)
+
+// fail answers err, the error an operation failed with, with the status its
+// kind calls for, so that handlers need not pick one for every error the
+// store may return:
+//
+//   - invalid input, as writeInvalid answers it, or store.ErrValidation: 400
+//     or 422;
+//   - store.ErrNotFound: 404;
+//   - store.ErrConflict: 409;
+//   - store.ErrTooLarge, or a request body over its limit: 413;
+//   - store.ErrUnavailable: 503 with Retry-After, as refused answers it.
+//
+// Errors of a kind carry their own message, which is sent. Any other error
+// is internal: it is logged, and answered with 500 and msg alone.
+//
+// Handlers answer the errors they expect first, with a message or status of
+// their own, and leave the rest to fail.
+func (h *Handler) fail(w http.ResponseWriter, r *http.Request, err error, msg string) {
+	var tooLarge *http.MaxBytesError
+	switch {
+	case writeInvalid(w, err), h.refused(w, err):
+	case errors.Is(err, store.ErrValidation):
+		writeError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, store.ErrNotFound):
+		writeError(w, http.StatusNotFound, "not found")
+	case errors.Is(err, store.ErrConflict):
+		writeError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, store.ErrTooLarge), errors.As(err, &tooLarge):
+		writeError(w, http.StatusRequestEntityTooLarge, err.Error())
+	default:
+		slog.ErrorContext(r.Context(), msg, "err", err)
+		writeError(w, http.StatusInternalServerError, msg)
+	}
+}
@@ -0,0 +1,37 @@
+package handlers_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/arkantrust/idempotency-example/backend/handlers"
+	"github.com/arkantrust/idempotency-example/backend/service"
+	"github.com/arkantrust/idempotency-example/backend/store"
+)
+
+func TestTimeoutAnsweredUnavailable(t *testing.T) {
+	s := newTestStore(t)
+	h := handlers.New(s, service.NewChargebacks(s))
+	s.SetTimeout(20 * time.Millisecond)
+
+	// A write waiting out the store's timeout behind a held transaction.
+	started, release, done := make(chan struct{}), make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(done)
+		s.WithTx(context.Background(), func(store.Tx) error {
+			close(started)
+			<-release
+			return nil
+		})
+	}()
+	<-started
+	rec := post(h, `{"amount":100,"currency":"USD","reason":"fraud"}`)
+	close(release)
+	<-done
+
+	if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") == "" {
+		t.Errorf("expected 503 with Retry-After for a timeout, got %d: %s", rec.Code, rec.Body)
+	}
+}
@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// ETagHeader and IfMatchHeader let a client make a DELETE conditional on the
+// record still being the one it last read: a GET, create or update returns
+// the record's ETag, and a DELETE sending it in If-Match only removes a
+// record that has not changed since.
+const (
+	ETagHeader    = "ETag"
+	IfMatchHeader = "If-Match"
+)
+
+// etagOf returns the strong ETag of a record. It hashes the JSON form, so it
+// is the same whichever media type the record was served in.
+func etagOf(v any) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// setETag sets the ETag of the record v.
+func setETag(w http.ResponseWriter, v any) {
+	if etag := etagOf(v); etag != "" {
+		w.Header().Set(ETagHeader, etag)
+	}
+}
+
+// matchesETag evaluates an If-Match header against etag. If-Match uses the
+// strong comparison, so weak tags never match; "*" matches any record.
+func matchesETag(header, etag string) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || (tag == etag && etag != "") {
+			return true
+		}
+	}
+	return false
+}
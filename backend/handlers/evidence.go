@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/arkantrust/idempotency-example/backend/models"
+	"github.com/arkantrust/idempotency-example/backend/store"
+)
+
+// DefaultMaxUploadBytes is the evidence document size limit used when
+// Handler.MaxUploadBytes is zero.
+const DefaultMaxUploadBytes = 10 << 20
+
+// evidenceField is the multipart form field carrying the document.
+const evidenceField = "file"
+
+// AddEvidence handles POST /chargebacks/{id}/evidence, a multipart/form-data
+// upload with the document in its "file" field.
+//
+// Documents are addressed by their SHA-256, so the upload needs no
+// idempotency key: uploading the same file again, under any name, finds the
+// evidence the first upload attached and answers 200 instead of 201.
+func (h *Handler) AddEvidence(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	limit := h.uploadLimit()
+	r.Body = http.MaxBytesReader(w, r.Body, limit+1<<20) // room for the multipart framing
+	mr, err := r.MultipartReader()
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "expected a multipart/form-data body")
+		return
+	}
+	var e models.Evidence
+	var data []byte
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			writeError(w, http.StatusBadRequest, `missing the "`+evidenceField+`" field`)
+			return
+		}
+		if err != nil {
+			writeUploadError(w, err)
+			return
+		}
+		if part.FormName() != evidenceField {
+			continue
+		}
+		data, err = io.ReadAll(io.LimitReader(part, limit+1))
+		if err != nil {
+			writeUploadError(w, err)
+			return
+		}
+		e.Filename, e.ContentType = part.FileName(), part.Header.Get("Content-Type")
+		break
+	}
+	if int64(len(data)) > limit {
+		writeError(w, http.StatusRequestEntityTooLarge, "document exceeds "+strconv.FormatInt(limit, 10)+" bytes")
+		return
+	}
+	if len(data) == 0 {
+		writeError(w, http.StatusBadRequest, "the document is empty")
+		return
+	}
+	if _, _, err := mime.ParseMediaType(e.ContentType); err != nil || e.ContentType == "application/octet-stream" {
+		e.ContentType = http.DetectContentType(data)
+	}
+
+	r = fenced(r)
+	evidence, created, err := h.store.AddEvidence(r.Context(), id, &e, data)
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		writeError(w, http.StatusNotFound, "chargeback not found")
+		return
+	case err != nil:
+		h.fail(w, r, err, "failed to add evidence")
+		return
+	}
+	w.Header().Set("Location", locate(r, "/chargebacks/"+id+"/evidence/"+evidence.SHA256))
+	setReplayed(w, !created, evidence.CreatedAt)
+	setFencingToken(w, r)
+	if created {
+		writeJSON(w, http.StatusCreated, evidence)
+		return
+	}
+	writeJSON(w, http.StatusOK, evidence)
+}
+
+// ListEvidence handles GET /chargebacks/{id}/evidence.
+func (h *Handler) ListEvidence(w http.ResponseWriter, r *http.Request) {
+	list, err := h.store.Evidence(r.Context(), r.PathValue("id"))
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		writeError(w, http.StatusNotFound, "chargeback not found")
+		return
+	case err != nil:
+		h.fail(w, r, err, "failed to list evidence")
+		return
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+// Evidence handles GET /chargebacks/{id}/evidence/{sha256}: the document,
+// with the content type it was uploaded with. Its ETag is its digest, which
+// never changes, and byte ranges are served.
+func (h *Handler) Evidence(w http.ResponseWriter, r *http.Request) {
+	e, data, err := h.store.EvidenceDocument(r.Context(), r.PathValue("id"), r.PathValue("sha256"))
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		writeError(w, http.StatusNotFound, "evidence not found")
+		return
+	case err != nil:
+		h.fail(w, r, err, "failed to load evidence")
+		return
+	}
+	w.Header().Set("Content-Type", e.ContentType)
+	w.Header().Set("ETag", `"`+e.SHA256+`"`)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if e.Filename != "" {
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": e.Filename}))
+	}
+	http.ServeContent(w, r, "", e.CreatedAt, bytes.NewReader(data))
+}
+
+// DeleteEvidence handles DELETE /chargebacks/{id}/evidence/{sha256}. Like
+// deleting a chargeback it succeeds whether or not the document was
+// attached, so a retry is harmless.
+func (h *Handler) DeleteEvidence(w http.ResponseWriter, r *http.Request) {
+	digest := r.PathValue("sha256")
+	r = fenced(r)
+	existed, err := h.store.DeleteEvidence(r.Context(), r.PathValue("id"), digest)
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		writeError(w, http.StatusNotFound, "chargeback not found")
+		return
+	case err != nil:
+		h.fail(w, r, err, "failed to delete evidence")
+		return
+	}
+	setReplayed(w, !existed, time.Time{})
+	h.Policy.deleted(w, r, deletedOne{Deleted: digest})
+}
+
+func (h *Handler) uploadLimit() int64 {
+	if h.MaxUploadBytes <= 0 {
+		return DefaultMaxUploadBytes
+	}
+	return h.MaxUploadBytes
+}
+
+// writeUploadError answers a failure to read an upload: 413 past the body
+// limit, 400 for a malformed body.
+func writeUploadError(w http.ResponseWriter, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		writeError(w, http.StatusRequestEntityTooLarge, "request body too large")
+		return
+	}
+	writeError(w, http.StatusBadRequest, "malformed multipart body: "+err.Error())
+}
@@ -0,0 +1,85 @@
+package handlers_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/arkantrust/idempotency-example/backend/handlers"
+)
+
+func upload(h *handlers.Handler, filename, content string) *httptest.ResponseRecorder {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, _ := mw.CreateFormFile("file", filename)
+	fw.Write([]byte(content)) //nolint:errcheck
+	mw.Close()
+	req := httptest.NewRequest(http.MethodPost, "/chargebacks/cb-1/evidence", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	req.SetPathValue("id", "cb-1")
+	rec := httptest.NewRecorder()
+	h.AddEvidence(rec, req)
+	return rec
+}
+
+func evidenceRequest(h *handlers.Handler, method, digest string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, "/chargebacks/cb-1/evidence/"+digest, nil)
+	req.SetPathValue("id", "cb-1")
+	req.SetPathValue("sha256", digest)
+	rec := httptest.NewRecorder()
+	switch method {
+	case http.MethodDelete:
+		h.DeleteEvidence(rec, req)
+	default:
+		h.Evidence(rec, req)
+	}
+	return rec
+}
+
+func TestEvidenceUploadsAreContentAddressed(t *testing.T) {
+	h := newTestHandler(t)
+	if rec := upload(h, "receipt.txt", "paid in full"); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 without the chargeback, got %d: %s", rec.Code, rec.Body)
+	}
+	post(h, `{"amount":100,"currency":"USD","reason":"fraud"}`)
+
+	sum := sha256.Sum256([]byte("paid in full"))
+	digest := hex.EncodeToString(sum[:])
+	rec := upload(h, "receipt.txt", "paid in full")
+	if rec.Code != http.StatusCreated || rec.Header().Get("Location") != "/chargebacks/cb-1/evidence/"+digest {
+		t.Fatalf("expected 201 at the digest, got %d %q: %s", rec.Code, rec.Header().Get("Location"), rec.Body)
+	}
+	// The same file under another name is the same document.
+	if rec := upload(h, "copy.txt", "paid in full"); rec.Code != http.StatusOK || rec.Header().Get(handlers.ReplayedHeader) != "true" {
+		t.Fatalf("expected a replay, got %d: %s", rec.Code, rec.Body)
+	}
+
+	rec = evidenceRequest(h, http.MethodGet, digest)
+	if rec.Code != http.StatusOK || rec.Body.String() != "paid in full" || rec.Header().Get("ETag") != `"`+digest+`"` ||
+		rec.Header().Get("Content-Disposition") != `attachment; filename=receipt.txt` {
+		t.Fatalf("unexpected download: %d %v %q", rec.Code, rec.Header(), rec.Body)
+	}
+
+	if rec := evidenceRequest(h, http.MethodDelete, digest); rec.Code != http.StatusOK || rec.Header().Get(handlers.ReplayedHeader) != "false" {
+		t.Fatalf("expected the delete, got %d: %s", rec.Code, rec.Body)
+	}
+	if rec := evidenceRequest(h, http.MethodDelete, digest); rec.Code != http.StatusOK || rec.Header().Get(handlers.ReplayedHeader) != "true" {
+		t.Fatalf("expected the retried delete to succeed, got %d: %s", rec.Code, rec.Body)
+	}
+	if rec := evidenceRequest(h, http.MethodGet, digest); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 after the delete, got %d", rec.Code)
+	}
+}
+
+func TestEvidenceUploadLimit(t *testing.T) {
+	h := newTestHandler(t)
+	h.MaxUploadBytes = 8
+	post(h, `{"amount":100,"currency":"USD","reason":"fraud"}`)
+	if rec := upload(h, "big.txt", "more than eight bytes"); rec.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected 413, got %d: %s", rec.Code, rec.Body)
+	}
+}
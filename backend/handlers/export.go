@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/arkantrust/idempotency-example/backend/models"
+)
+
+// csvHeader is the column order used by CSV exports.
+var csvHeader = []string{"id", "amount", "currency", "reason", "createdAt", "updatedAt", "chargeId", "merchantId", "version"}
+
+// Export handles GET /export?format=ndjson|csv.
+//
+// Records are streamed straight from a cursor over the bucket to the response
+// body. No Content-Length is set, so net/http uses chunked transfer encoding
+// and memory use stays flat regardless of the dataset size. The default format
+// is NDJSON, which pairs naturally with POST /import: an export can be
+// re-imported any number of times without creating duplicates.
+//
+// Once the first byte has been written the status code is committed, so an
+// error part-way through the stream can only be logged; the truncated body is
+// the client's signal that the export is incomplete.
+func (h *Handler) Export(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "ndjson"
+	}
+
+	var (
+		write func(models.Chargeback) error
+		done  func() error
+	)
+
+	switch format {
+	case "ndjson":
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		enc := json.NewEncoder(w)
+		write = func(c models.Chargeback) error { return enc.Encode(c) }
+		done = func() error { return nil }
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv")
+		cw := csv.NewWriter(w)
+		if err := cw.Write(csvHeader); err != nil {
+			return
+		}
+		write = func(c models.Chargeback) error {
+			return cw.Write([]string{
+				c.ID,
+				strconv.FormatInt(c.Amount, 10),
+				c.Currency,
+				c.Reason,
+				c.CreatedAt.Format(time.RFC3339Nano),
+				c.UpdatedAt.Format(time.RFC3339Nano),
+				c.ChargeID,
+				c.MerchantID,
+				strconv.FormatInt(c.Version, 10),
+			})
+		}
+		done = func() error {
+			cw.Flush()
+			return cw.Error()
+		}
+	default:
+		writeError(w, http.StatusBadRequest, "unsupported format: expected ndjson or csv")
+		return
+	}
+	w.Header().Set("Content-Disposition", `attachment; filename="chargebacks.`+format+`"`)
+
+	flusher, _ := w.(http.Flusher)
+	n := 0
+
+	err := h.store.ForEach(r.Context(), func(c models.Chargeback) error {
+		if err := write(c); err != nil {
+			return err
+		}
+		n++
+		if n%streamFlushEvery == 0 && flusher != nil {
+			if err := done(); err != nil {
+				return err
+			}
+			flusher.Flush()
+		}
+		return nil
+	})
+	if err == nil {
+		err = done()
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "export aborted", "format", format, "records", n, "err", err)
+	}
+}
@@ -0,0 +1,45 @@
+package handlers_test
+
+import (
+	"encoding/csv"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/arkantrust/idempotency-example/backend/handlers"
+	"github.com/arkantrust/idempotency-example/backend/models"
+	"github.com/arkantrust/idempotency-example/backend/service"
+)
+
+// TestExportCSV checks that a CSV export carries every field the NDJSON one
+// does, so that it loses nothing on the way back in.
+func TestExportCSV(t *testing.T) {
+	s := newTestStore(t)
+	h := handlers.New(s, service.NewChargebacks(s))
+	if _, _, err := s.Merchants().Create(t.Context(), &models.Merchant{ID: "m-1", Name: "Shop"}); err != nil {
+		t.Fatalf("create merchant: %v", err)
+	}
+	if _, _, err := s.Create(t.Context(), &models.Chargeback{ID: "cb-1", Amount: 100, Currency: "USD", Reason: "fraud", MerchantID: "m-1"}); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	h.Export(rec, httptest.NewRequest(http.MethodGet, "/export?format=csv", nil))
+	rows, err := csv.NewReader(rec.Body).ReadAll()
+	if err != nil || len(rows) != 2 {
+		t.Fatalf("export: %q, %v", rows, err)
+	}
+	row := map[string]string{}
+	for i, col := range rows[0] {
+		row[col] = rows[1][i]
+	}
+	for _, col := range []string{"chargeId", "merchantId", "version"} {
+		if !slices.Contains(rows[0], col) {
+			t.Errorf("no %s column in %q", col, rows[0])
+		}
+	}
+	if row["id"] != "cb-1" || row["merchantId"] != "m-1" || row["version"] != "1" {
+		t.Fatalf("row %v", row)
+	}
+}
@@ -0,0 +1,111 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"math/rand/v2"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/arkantrust/idempotency-example/backend/handlers"
+)
+
+// fuzzIDs numbers the records of fuzz iterations, which share a store.
+var fuzzIDs atomic.Int64
+
+func send(h http.Handler, method, path, body string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+	return rec
+}
+
+// FuzzCreateAndUpdate sends arbitrary bodies to create and update a
+// chargeback, each twice. Whatever the body, the server must not fail, a
+// retried create must answer like the first or replay it, and a retried
+// update must not write.
+func FuzzCreateAndUpdate(f *testing.F) {
+	for _, body := range []string{
+		`{"amount":100,"currency":"USD","reason":"fraud"}`,
+		`{"amount":1,"currency":"JPY","reason":"x","merchantId":"m-1"}`,
+		`{"amount":-5,"currency":"usd"}`,
+		`{"amount":1e3}`,
+		`{"amount":100,"amount":200}`,
+		`[{"amount":100}]`,
+		`{"reason":"` + strings.Repeat("x", 600) + `"}`,
+		`{`,
+		``,
+	} {
+		f.Add(body)
+	}
+	h := newTestHandler(f)
+
+	f.Fuzz(func(t *testing.T, body string) {
+		path := "/chargebacks/cb-" + strconv.FormatInt(fuzzIDs.Add(1), 10)
+
+		first := send(h, http.MethodPost, path, body)
+		if first.Code >= 500 {
+			t.Fatalf("create: %d: %s", first.Code, first.Body)
+		}
+		retry := send(h, http.MethodPost, path, body)
+		switch {
+		case first.Code == http.StatusCreated:
+			if retry.Code != http.StatusOK || retry.Header().Get(handlers.ReplayedHeader) != "true" {
+				t.Fatalf("expected the retried create replayed, got %d: %s", retry.Code, retry.Body)
+			}
+		case retry.Code != first.Code:
+			t.Fatalf("expected the retried create answered %d like the first, got %d", first.Code, retry.Code)
+		}
+		if first.Code != http.StatusCreated {
+			return
+		}
+
+		update := send(h, http.MethodPut, path, body)
+		if update.Code >= 500 {
+			t.Fatalf("update: %d: %s", update.Code, update.Body)
+		}
+		if update.Code != http.StatusOK {
+			return
+		}
+		if write := update.Header().Get("X-Idempotency-Write"); write != "false" {
+			t.Fatalf("expected updating with the create's body to write nothing, got %q", write)
+		}
+		if again := send(h, http.MethodPut, path, body); again.Header().Get("X-Idempotency-Write") != "false" {
+			t.Fatalf("expected a retried update to write nothing, got %d %q", again.Code, again.Header().Get("X-Idempotency-Write"))
+		}
+	})
+}
+
+// FuzzUpdateFieldOrder creates a chargeback and updates it with the same
+// fields in a random order, which must not write.
+func FuzzUpdateFieldOrder(f *testing.F) {
+	f.Add(int64(100), "USD", "fraud", uint64(1))
+	f.Add(int64(1), "JPY", "not received", uint64(7))
+	f.Add(int64(999), "BHD", "ünïcödé \"quoted\"", uint64(42))
+	h := newTestHandler(f)
+
+	f.Fuzz(func(t *testing.T, amount int64, currency, reason string, seed uint64) {
+		path := "/chargebacks/cb-" + strconv.FormatInt(fuzzIDs.Add(1), 10)
+		fields := []string{
+			`"amount":` + strconv.FormatInt(amount, 10),
+			`"currency":` + quote(currency),
+			`"reason":` + quote(reason),
+		}
+		if rec := send(h, http.MethodPost, path, "{"+strings.Join(fields, ",")+"}"); rec.Code != http.StatusCreated {
+			return // invalid fields; FuzzCreateAndUpdate covers those
+		}
+
+		rand.New(rand.NewPCG(seed, seed)).Shuffle(len(fields), func(i, j int) { fields[i], fields[j] = fields[j], fields[i] })
+		rec := send(h, http.MethodPut, path, "{"+strings.Join(fields, ",")+"}")
+		if rec.Code != http.StatusOK || rec.Header().Get("X-Idempotency-Write") != "false" {
+			t.Fatalf("expected the reordered update to write nothing, got %d %q: %s", rec.Code, rec.Header().Get("X-Idempotency-Write"), rec.Body)
+		}
+	})
+}
+
+func quote(s string) string {
+	data, _ := json.Marshal(s)
+	return string(data)
+}
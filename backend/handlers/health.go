@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"net/http"
+	"sync/atomic"
+
+	"github.com/arkantrust/idempotency-example/backend/store"
+	"github.com/arkantrust/idempotency-example/backend/store/breaker"
+)
+
+// Probes serves the liveness and readiness endpoints used by orchestrators
+// such as Kubernetes.
+type Probes struct {
+	store    *store.Store
+	draining atomic.Bool
+
+	// Breaker, when set, is the circuit breaker around the store, whose
+	// state Healthz reports.
+	Breaker *breaker.Breaker
+}
+
+// NewProbes creates probes that check the given store.
+func NewProbes(s *store.Store) *Probes {
+	return &Probes{store: s}
+}
+
+// Drain marks the server as shutting down. From then on Readyz reports 503
+// so load balancers stop routing new traffic while in-flight requests finish.
+func (p *Probes) Drain() {
+	p.draining.Store(true)
+}
+
+// probeStatus is the body of both probe responses.
+type probeStatus struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+
+	// Storage reports how the database file is written, so that the
+	// numbers of a performance experiment come with the durability they
+	// were measured at.
+	Storage *store.Options `json:"storage,omitempty"`
+
+	// Circuit is the state of the circuit breaker around the store, when
+	// there is one.
+	Circuit string `json:"circuit,omitempty"`
+}
+
+// Healthz handles GET /healthz. It reports that the process is up and
+// serving HTTP, with the store's options and circuit breaker; it
+// deliberately does not touch the store, so a slow disk cannot get a healthy
+// process restarted.
+func (p *Probes) Healthz(w http.ResponseWriter, r *http.Request) {
+	opts := p.store.Options()
+	status := probeStatus{Status: "ok", Storage: &opts}
+	if p.Breaker != nil {
+		status.Circuit = p.Breaker.State()
+	}
+	writeJSON(w, http.StatusOK, status)
+}
+
+// Readyz handles GET /readyz. It returns 200 when the store answers a cheap
+// read transaction and 503 when it does not or when the server is draining.
+func (p *Probes) Readyz(w http.ResponseWriter, r *http.Request) {
+	if p.draining.Load() {
+		writeJSON(w, http.StatusServiceUnavailable, probeStatus{Status: "draining"})
+		return
+	}
+	if err := p.store.Ping(r.Context()); err != nil {
+		writeJSON(w, http.StatusServiceUnavailable, probeStatus{Status: "unavailable", Error: err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, probeStatus{Status: "ready"})
+}
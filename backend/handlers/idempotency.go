@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/arkantrust/idempotency-example/backend/models"
+	"github.com/arkantrust/idempotency-example/backend/service"
+	"github.com/arkantrust/idempotency-example/backend/store"
+)
+
+// Strict idempotency implements the IETF Idempotency-Key header draft
+// (draft-ietf-httpapi-idempotency-key-header) on top of the write routes,
+// for comparison with the path-key design the API otherwise follows:
+//
+//   - every write route requires an Idempotency-Key, and answers 400 without
+//     one;
+//   - the first response to a key is saved with a fingerprint of the request
+//     – its method, route, URI and body – and a retry gets it back byte for
+//     byte, with X-Idempotency-Replayed: true, without the handler running
+//     again;
+//   - a key sent with another request answers 422, and a key whose first
+//     request is still being processed answers 409.
+//
+// Responses with a 5xx status are not saved, so a retry after a server error
+// runs again. The path-key semantics still apply underneath: a create that
+// misses the saved response – a new key for an existing ID – replays the
+// record as before.
+//
+// POST /import is left alone: its body is streamed, and it is idempotent by
+// the IDs of its records.
+
+// savedType is the store.Response type of saved HTTP responses.
+const savedType = "http"
+
+// savedResponse is a response saved under an Idempotency-Key.
+type savedResponse struct {
+	Status int         `json:"status"`
+	Header http.Header `json:"header"`
+	Body   []byte      `json:"body"`
+}
+
+// errServerError fails a call whose response is not to be saved.
+var errServerError = errors.New("response not saved: server error")
+
+// idempotent wraps next, the handler of the route op, with strict
+// idempotency.
+func (h *Handler) idempotent(op string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(IdempotencyKeyHeader)
+		if key == "" {
+			writeError(w, http.StatusBadRequest, "missing "+IdempotencyKeyHeader+" header")
+			return
+		}
+		if desc := h.svc.KeyFormat.Check(key); desc != "" {
+			writeFieldErrors(w, []models.FieldError{{Field: IdempotencyKeyHeader, Message: desc}})
+			return
+		}
+
+		// The body is part of the fingerprint, so it is read up front and
+		// handed on to next from memory.
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, h.bodyLimit()))
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeError(w, http.StatusRequestEntityTooLarge, "request body too large")
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "failed to read body")
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		fingerprint := service.Fingerprint(op, append([]byte(r.URL.RequestURI()+"\x00"), body...))
+
+		rec := newRecorder(w)
+		ran := false
+		saved, replayed, err := h.StrictKeys.TryDo(r.Context(), op, key, fingerprint, func() (*store.Response, error) {
+			ran = true
+			next(rec, r)
+			if rec.status >= http.StatusInternalServerError {
+				return nil, errServerError
+			}
+			data, err := json.Marshal(savedResponse{Status: rec.status, Header: rec.saved(), Body: rec.body.Bytes()})
+			return &store.Response{Type: savedType, Body: data}, err
+		})
+		switch {
+		case ran:
+			// Whether or not it was saved, the response is the client's.
+			rec.flush(w)
+		case errors.Is(err, service.ErrInFlight):
+			writeError(w, http.StatusConflict, "a request with this "+IdempotencyKeyHeader+" is still being processed")
+		case errors.Is(err, store.ErrKeyReused):
+			writeError(w, http.StatusUnprocessableEntity, "idempotency key was already used with a different request")
+		case err != nil:
+			h.fail(w, r, err, "failed to look up idempotency key")
+		case replayed:
+			replay(w, saved)
+		}
+	}
+}
+
+// replay writes a saved response.
+func replay(w http.ResponseWriter, saved *store.Response) {
+	var resp savedResponse
+	if saved.Type != savedType || json.Unmarshal(saved.Body, &resp) != nil {
+		writeError(w, http.StatusInternalServerError, "failed to replay the saved response")
+		return
+	}
+	for k, v := range resp.Header {
+		w.Header()[k] = v
+	}
+	w.Header().Set(ReplayedHeader, "true")
+	w.WriteHeader(resp.Status)
+	w.Write(resp.Body)
+}
+
+// recorder buffers a response so that it can be saved before it is sent.
+type recorder struct {
+	header http.Header
+	before http.Header // headers set before the handler ran
+	status int
+	body   bytes.Buffer
+	wrote  bool
+}
+
+// newRecorder returns a recorder starting from the headers already set on w,
+// such as the request ID error bodies repeat.
+func newRecorder(w http.ResponseWriter) *recorder {
+	return &recorder{header: w.Header().Clone(), before: w.Header(), status: http.StatusOK}
+}
+
+func (rec *recorder) Header() http.Header { return rec.header }
+
+func (rec *recorder) WriteHeader(status int) {
+	if !rec.wrote {
+		rec.status, rec.wrote = status, true
+	}
+}
+
+func (rec *recorder) Write(p []byte) (int, error) {
+	rec.WriteHeader(http.StatusOK)
+	return rec.body.Write(p)
+}
+
+// saved returns the headers the handler set, to be replayed with the body.
+// The fencing token is left out: a replay writes nothing.
+func (rec *recorder) saved() http.Header {
+	out := http.Header{}
+	for k, v := range rec.header {
+		if _, ok := rec.before[k]; !ok && k != FencingTokenHeader {
+			out[k] = v
+		}
+	}
+	return out
+}
+
+// flush sends the recorded response to w.
+func (rec *recorder) flush(w http.ResponseWriter) {
+	for k, v := range rec.header {
+		w.Header()[k] = v
+	}
+	w.WriteHeader(rec.status)
+	w.Write(rec.body.Bytes())
+}
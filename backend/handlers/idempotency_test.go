@@ -0,0 +1,56 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/arkantrust/idempotency-example/backend/handlers"
+	"github.com/arkantrust/idempotency-example/backend/service"
+)
+
+func TestStrictIdempotency(t *testing.T) {
+	s := newTestStore(t)
+	h := handlers.New(s, service.NewChargebacks(s))
+	h.StrictKeys = service.NewDedup(s)
+	do := func(method, path, key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if key != "" {
+			req.Header.Set(handlers.IdempotencyKeyHeader, key)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+	body := `{"amount":100,"currency":"USD","reason":"fraud"}`
+
+	if rec := do(http.MethodPost, "/chargebacks/cb-1", "", body); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 without a key, got %d: %s", rec.Code, rec.Body)
+	}
+	first := do(http.MethodPost, "/chargebacks/cb-1", "k-1", body)
+	if first.Code != http.StatusCreated || first.Header().Get(handlers.FencingTokenHeader) == "" {
+		t.Fatalf("expected 201 with a fencing token, got %d: %s", first.Code, first.Body)
+	}
+	again := do(http.MethodPost, "/chargebacks/cb-1", "k-1", body)
+	if again.Code != http.StatusCreated || again.Body.String() != first.Body.String() ||
+		again.Header().Get("Location") != "/chargebacks/cb-1" || again.Header().Get(handlers.ReplayedHeader) != "true" ||
+		again.Header().Get(handlers.FencingTokenHeader) != "" {
+		t.Fatalf("expected the first response replayed, got %d %v: %s", again.Code, again.Header(), again.Body)
+	}
+	if rec := do(http.MethodPost, "/chargebacks/cb-1", "k-1", `{"amount":200,"currency":"USD","reason":"fraud"}`); rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422 for another payload, got %d: %s", rec.Code, rec.Body)
+	}
+	// A new key for the same create falls through to the path-key replay.
+	if rec := do(http.MethodPost, "/chargebacks/cb-1", "k-2", body); rec.Code != http.StatusOK {
+		t.Fatalf("expected a 200 replay of the record, got %d: %s", rec.Code, rec.Body)
+	}
+
+	// Unsafe methods other than POST need a key too; reads do not.
+	if rec := do(http.MethodDelete, "/chargebacks/cb-1", "", ""); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a DELETE without a key, got %d: %s", rec.Code, rec.Body)
+	}
+	if rec := do(http.MethodGet, "/chargebacks/cb-1", "", ""); rec.Code != http.StatusOK {
+		t.Fatalf("expected reads to need no key, got %d: %s", rec.Code, rec.Body)
+	}
+}
@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/arkantrust/idempotency-example/backend/models"
+)
+
+const (
+	// importChunkSize is the number of records committed per transaction.
+	// Larger chunks mean fewer fsyncs; smaller chunks keep write locks short.
+	importChunkSize = 500
+
+	// maxImportLine bounds the size of a single NDJSON line.
+	maxImportLine = 1 << 20
+
+	// maxImportErrors caps the per-line errors echoed back in the summary.
+	maxImportErrors = 100
+)
+
+// importError describes a line that could not be imported.
+type importError struct {
+	Line  int    `json:"line"`
+	Error string `json:"error"`
+}
+
+// importSummary is the response body of POST /import.
+type importSummary struct {
+	Created int           `json:"created"`
+	Skipped int           `json:"skipped"`
+	Failed  int           `json:"failed"`
+	Errors  []importError `json:"errors,omitempty"`
+}
+
+// Import handles POST /import.
+//
+// The body is newline-delimited JSON, one chargeback per line, each carrying
+// its own "id". Lines are read as a stream and inserted in chunks with Create
+// semantics: records whose ID already exists are skipped, never overwritten.
+// Re-running the same import file is therefore a no-op – every record is
+// reported as skipped – which makes it safe to retry an import that was
+// interrupted half-way through.
+//
+// Records go through the service as creates do, its hooks included. Lines
+// that are not valid JSON, are refused by a hook, fail validation, name a
+// missing charge or merchant or break the policy, its merchant velocity
+// limits included, are counted as failed and do not abort the import.
+func (h *Handler) Import(w http.ResponseWriter, r *http.Request) {
+	r = fenced(r)
+	var sum importSummary
+	chunk := make([]*models.Chargeback, 0, importChunkSize)
+	lines := make([]int, 0, importChunkSize) // the line of each record in chunk
+
+	fail := func(line int, msg string) {
+		sum.Failed++
+		if len(sum.Errors) < maxImportErrors {
+			sum.Errors = append(sum.Errors, importError{Line: line, Error: msg})
+		}
+	}
+
+	flush := func() error {
+		if len(chunk) == 0 {
+			return nil
+		}
+		res, err := h.svc.Import(r.Context(), chunk)
+		if err != nil {
+			return err
+		}
+		sum.Created += len(res.Created)
+		sum.Skipped += res.Skipped
+		for _, i := range slices.Sorted(maps.Keys(res.Failed)) {
+			fail(lines[i], res.Failed[i].Error())
+		}
+		chunk, lines = chunk[:0], lines[:0]
+		return nil
+	}
+
+	sc := bufio.NewScanner(r.Body)
+	sc.Buffer(make([]byte, 0, 64*1024), maxImportLine)
+
+	line := 0
+	for sc.Scan() {
+		line++
+		raw := sc.Bytes()
+		if len(raw) == 0 {
+			continue
+		}
+
+		var c models.Chargeback
+		if err := checkDepth(raw); err != nil {
+			fail(line, err.Error())
+			continue
+		}
+		if err := json.Unmarshal(raw, &c); err != nil {
+			fail(line, fmt.Sprintf("invalid JSON: %v", err))
+			continue
+		}
+		// Timestamps and versions are the server's to set; a client cannot
+		// backdate records by importing them.
+		c.CreatedAt, c.UpdatedAt, c.Version = time.Time{}, time.Time{}, 0
+
+		chunk = append(chunk, &c)
+		lines = append(lines, line)
+		if len(chunk) == importChunkSize {
+			if err := flush(); err != nil {
+				h.fail(w, r, err, "failed to import chargebacks")
+				return
+			}
+		}
+	}
+	if err := sc.Err(); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("failed to read body at line %d: %v", line+1, err))
+		return
+	}
+	if err := flush(); err != nil {
+		h.fail(w, r, err, "failed to import chargebacks")
+		return
+	}
+
+	setFencingToken(w, r)
+	writeJSON(w, http.StatusOK, sum)
+}
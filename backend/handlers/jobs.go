@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/arkantrust/idempotency-example/backend/jobs"
+	"github.com/arkantrust/idempotency-example/backend/models"
+	"github.com/arkantrust/idempotency-example/backend/store"
+)
+
+// Jobs handles GET /admin/jobs?status=&kind=&limit=&cursor=.
+//
+// It lists the background jobs – webhook deliveries, backups, archival runs
+// – oldest first, with their attempts and last error, and is paginated like
+// IdempotencyKeys. status=failed lists the work that gave up.
+func (h *Handler) Jobs(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	status := models.JobStatus(q.Get("status"))
+	switch status {
+	case "", models.JobPending, models.JobRunning, models.JobSucceeded, models.JobFailed:
+	default:
+		writeError(w, http.StatusBadRequest, "invalid status: expected pending, running, succeeded or failed")
+		return
+	}
+	query, ok := jobQuery(w, r)
+	if !ok {
+		return
+	}
+	query.Status = status
+	list, next, err := h.store.Jobs(r.Context(), query)
+	if err != nil {
+		h.fail(w, r, err, "failed to list jobs")
+		return
+	}
+	if next != "" {
+		w.Header().Set(NextCursorHeader, next)
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+// Job handles GET /admin/jobs/{id}.
+func (h *Handler) Job(w http.ResponseWriter, r *http.Request) {
+	job, err := h.store.Job(r.Context(), r.PathValue("id"))
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		writeError(w, http.StatusNotFound, "job not found")
+		return
+	case err != nil:
+		h.fail(w, r, err, "failed to load job")
+		return
+	}
+	writeJSON(w, http.StatusOK, job)
+}
+
+// DeadLetters handles GET /admin/dead-letters?kind=&limit=&cursor=.
+//
+// It lists the jobs that gave up and were moved out of the queue – the
+// webhook deliveries whose URL kept failing – with their failure history,
+// paginated like Jobs.
+func (h *Handler) DeadLetters(w http.ResponseWriter, r *http.Request) {
+	query, ok := jobQuery(w, r)
+	if !ok {
+		return
+	}
+	list, next, err := h.store.DeadLetters(r.Context(), query)
+	if err != nil {
+		h.fail(w, r, err, "failed to list dead letters")
+		return
+	}
+	if next != "" {
+		w.Header().Set(NextCursorHeader, next)
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+// DeadLetter handles GET /admin/dead-letters/{id}.
+func (h *Handler) DeadLetter(w http.ResponseWriter, r *http.Request) {
+	job, err := h.store.DeadLetter(r.Context(), r.PathValue("id"))
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		writeError(w, http.StatusNotFound, "dead letter not found")
+		return
+	case err != nil:
+		h.fail(w, r, err, "failed to load dead letter")
+		return
+	}
+	writeJSON(w, http.StatusOK, job)
+}
+
+// RequeueDeadLetter handles POST /admin/dead-letters/{id}/requeue.
+//
+// The job goes back into the queue with its attempts reset and is run again
+// from scratch. A webhook delivery that did reach its URL after all is
+// delivered again with the same event ID, which the receiver deduplicates.
+// Requeueing twice is a 404: the first took the job out of the dead letters.
+func (h *Handler) RequeueDeadLetter(w http.ResponseWriter, r *http.Request) {
+	job, err := h.store.RequeueDeadLetter(r.Context(), r.PathValue("id"))
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		writeError(w, http.StatusNotFound, "dead letter not found")
+		return
+	case err != nil:
+		h.fail(w, r, err, "failed to requeue dead letter")
+		return
+	}
+	writeJSON(w, http.StatusOK, job)
+}
+
+// jobQuery parses the kind, limit and cursor of a job listing, answering
+// 400 when they are invalid.
+func jobQuery(w http.ResponseWriter, r *http.Request) (store.JobQuery, bool) {
+	q := r.URL.Query()
+	limit := DefaultKeyPageSize
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > MaxKeyPageSize {
+			writeError(w, http.StatusBadRequest, "invalid limit: expected 1 to "+strconv.Itoa(MaxKeyPageSize))
+			return store.JobQuery{}, false
+		}
+		limit = n
+	}
+	return store.JobQuery{Kind: q.Get("kind"), Limit: limit, Cursor: q.Get("cursor")}, true
+}
+
+// Schedules handles GET /admin/schedules: the periodic tasks of
+// h.Scheduler, with when each last ran and runs next.
+func (h *Handler) Schedules(w http.ResponseWriter, r *http.Request) {
+	statuses := []jobs.ScheduleStatus{}
+	if h.Scheduler != nil {
+		statuses = h.Scheduler.Status()
+	}
+	writeJSON(w, http.StatusOK, statuses)
+}
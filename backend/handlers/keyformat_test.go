@@ -0,0 +1,32 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/arkantrust/idempotency-example/backend/handlers"
+	"github.com/arkantrust/idempotency-example/backend/service"
+)
+
+func TestCreateRejectsWeakKey(t *testing.T) {
+	s := newTestStore(t)
+	svc := service.NewChargebacks(s)
+	svc.KeyFormat, _ = service.NewKeyFormat(service.KeyFormatUUID, "")
+	h := handlers.New(s, svc)
+
+	rec := post(h, `{"amount":100,"currency":"USD","reason":"fraud"}`)
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422 for key cb-1, got %d: %s", rec.Code, rec.Body)
+	}
+
+	// Records are still reachable by any ID; only creation is restricted.
+	req := httptest.NewRequest(http.MethodDelete, "/chargebacks/1", strings.NewReader(""))
+	req.SetPathValue("id", "1")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200 for delete, got %d", rec.Code)
+	}
+}
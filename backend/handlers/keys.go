@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/arkantrust/idempotency-example/backend/auth"
+	"github.com/arkantrust/idempotency-example/backend/store"
+)
+
+// createKeyRequest is the body of POST /admin/keys.
+type createKeyRequest struct {
+	Name string `json:"name"`
+
+	// Tenant optionally binds the key to one tenant.
+	Tenant string `json:"tenant,omitempty"`
+
+	// Role is "viewer", "operator" or "admin"; it defaults to "operator".
+	Role string `json:"role,omitempty"`
+}
+
+// createKeyResponse is returned once, when a key is minted. It is the only
+// time the plaintext key is ever shown.
+type createKeyResponse struct {
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	Tenant string `json:"tenant,omitempty"`
+	Role   string `json:"role"`
+	Key    string `json:"key"`
+}
+
+// CreateKey handles POST /admin/keys with a body of {"name": "..."} and an
+// optional "tenant" and "role".
+//
+// Minting is deliberately not idempotent: every call returns a fresh secret.
+// A retried request therefore leaves an extra, unused key behind, which is
+// harmless and can be revoked; replaying the first response would mean
+// storing the plaintext secret, which is not.
+func (h *Handler) CreateKey(w http.ResponseWriter, r *http.Request) {
+	var body createKeyRequest
+	if !h.decodeBody(w, r, &body) {
+		return
+	}
+	if body.Name == "" {
+		writeError(w, http.StatusBadRequest, "name is required")
+		return
+	}
+	if body.Tenant != "" && !store.ValidTenant(body.Tenant) {
+		writeError(w, http.StatusBadRequest, "invalid tenant")
+		return
+	}
+	if body.Role == "" {
+		body.Role = auth.RoleOperator
+	}
+	if !auth.ValidRole(body.Role) {
+		writeError(w, http.StatusBadRequest, "role must be viewer, operator or admin")
+		return
+	}
+
+	plaintext, k, err := h.store.CreateAPIKey(r.Context(), body.Name, body.Tenant, body.Role)
+	if err != nil {
+		h.fail(w, r, err, "failed to create API key")
+		return
+	}
+	writeJSON(w, http.StatusCreated, createKeyResponse{ID: k.ID, Name: k.Name, Tenant: k.Tenant, Role: k.Role, Key: plaintext})
+}
+
+// ListKeys handles GET /admin/keys. Only metadata is returned, never secrets.
+func (h *Handler) ListKeys(w http.ResponseWriter, r *http.Request) {
+	keys, err := h.store.ListAPIKeys(r.Context())
+	if err != nil {
+		h.fail(w, r, err, "failed to list API keys")
+		return
+	}
+	writeJSON(w, http.StatusOK, keys)
+}
+
+// RevokeKey handles DELETE /admin/keys/{id}.
+//
+// Revocation is idempotent: revoking a revoked key returns 200 with the
+// original revocation time. Unknown IDs return 404 because, unlike deleting a
+// chargeback, there is no way to reach the desired end state for a key that
+// never existed – the caller almost certainly has the wrong ID.
+func (h *Handler) RevokeKey(w http.ResponseWriter, r *http.Request) {
+	k, err := h.store.RevokeAPIKey(r.Context(), r.PathValue("id"))
+	if errors.Is(err, store.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "API key not found")
+		return
+	}
+	if err != nil {
+		h.fail(w, r, err, "failed to revoke API key")
+		return
+	}
+	writeJSON(w, http.StatusOK, k)
+}
+
+// Usage handles GET /admin/usage, reporting the usage of every client in the
+// day or month named by the "period" query parameter, by default the
+// current month.
+func (h *Handler) Usage(w http.ResponseWriter, r *http.Request) {
+	period := r.URL.Query().Get("period")
+	if period == "" {
+		period = time.Now().UTC().Format(store.MonthPeriod)
+	}
+	usage, err := h.store.Usage(r.Context(), period)
+	if err != nil {
+		h.fail(w, r, err, "failed to report usage")
+		return
+	}
+	writeJSON(w, http.StatusOK, usage)
+}
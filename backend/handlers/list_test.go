@@ -0,0 +1,66 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/arkantrust/idempotency-example/backend/handlers"
+	"github.com/arkantrust/idempotency-example/backend/models"
+	"github.com/arkantrust/idempotency-example/backend/service"
+	"github.com/arkantrust/idempotency-example/backend/store"
+)
+
+func TestListCreatedRange(t *testing.T) {
+	s := newTestStore(t)
+	h := handlers.New(s, service.NewChargebacks(s))
+	day := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	for i, id := range []string{"cb-3", "cb-2", "cb-1"} {
+		ctx := store.WithTime(t.Context(), day.AddDate(0, 0, i))
+		if _, _, err := s.Create(ctx, &models.Chargeback{ID: id, Amount: 100, Currency: "USD", Reason: "fraud"}); err != nil {
+			t.Fatalf("create %s: %v", id, err)
+		}
+	}
+
+	list := func(query string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/chargebacks?"+query, nil))
+		return rec
+	}
+
+	rec := list("createdAfter=2026-03-01&createdBefore=2026-03-03T00:00:00Z")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	var got []models.Chargeback
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if ids := idsOf(got); !slices.Equal(ids, []string{"cb-2"}) {
+		t.Fatalf("unexpected records: %v", ids)
+	}
+
+	rec = list("createdBefore=2026-03-03")
+	got = nil
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if ids := idsOf(got); !slices.Equal(ids, []string{"cb-3", "cb-2"}) {
+		t.Fatalf("expected creation order, got %v", ids)
+	}
+
+	if rec := list("createdAfter=yesterday"); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", rec.Code)
+	}
+}
+
+func idsOf(cs []models.Chargeback) []string {
+	ids := make([]string, len(cs))
+	for i, c := range cs {
+		ids[i] = c.ID
+	}
+	return ids
+}
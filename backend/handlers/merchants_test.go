@@ -0,0 +1,42 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/arkantrust/idempotency-example/backend/models"
+)
+
+func TestListsAndStatsScopedToAMerchant(t *testing.T) {
+	h := newTestHandler(t)
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return rec
+	}
+
+	if rec := do(http.MethodPost, "/merchants/m-1", `{"name":"Acme"}`); rec.Code != http.StatusCreated {
+		t.Fatalf("expected the merchant created, got %d: %s", rec.Code, rec.Body)
+	}
+	do(http.MethodPost, "/chargebacks/cb-1", `{"amount":100,"currency":"USD","reason":"fraud","merchantId":"m-1"}`)
+	do(http.MethodPost, "/chargebacks/cb-2", `{"amount":50,"currency":"USD","reason":"fraud"}`)
+
+	for _, accept := range []string{"application/json", "application/msgpack"} {
+		req := httptest.NewRequest(http.MethodGet, "/chargebacks?merchantId=m-1", nil)
+		req.Header.Set("Accept", accept)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "cb-1") || strings.Contains(rec.Body.String(), "cb-2") {
+			t.Fatalf("%s: expected only cb-1, got %d: %s", accept, rec.Code, rec.Body)
+		}
+	}
+
+	rec := do(http.MethodGet, "/chargebacks/stats?merchantId=m-1", "")
+	var stats models.Stats
+	if err := json.Unmarshal(rec.Body.Bytes(), &stats); err != nil || stats.Merchant != "m-1" || stats.Count != 1 {
+		t.Fatalf("stats: %d %v: %s", rec.Code, err, rec.Body)
+	}
+}
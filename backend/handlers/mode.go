@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/arkantrust/idempotency-example/backend/store"
+)
+
+// modeBody is the body of GET and PUT /admin/mode.
+type modeBody struct {
+	// Mode is "read-write", "maintenance" or "read-only".
+	Mode store.Mode `json:"mode"`
+}
+
+// Mode handles GET /admin/mode.
+func (h *Handler) Mode(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, modeBody{Mode: h.store.Mode()})
+}
+
+// SetMode handles PUT /admin/mode with a body of {"mode": "..."}. It returns
+// once the switch is complete: entering maintenance or read-only mode waits
+// for in-flight writes, so a backup started afterwards sees all of them.
+// Setting the current mode again changes nothing.
+func (h *Handler) SetMode(w http.ResponseWriter, r *http.Request) {
+	var body modeBody
+	if !h.decodeBody(w, r, &body) {
+		return
+	}
+	m, err := store.ParseMode(string(body.Mode))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := h.store.SetMode(m); err != nil {
+		slog.ErrorContext(r.Context(), "switching mode failed", "mode", m, "err", err)
+		writeError(w, http.StatusInternalServerError, "failed to switch mode")
+		return
+	}
+	slog.InfoContext(r.Context(), "mode switched", "mode", m)
+	writeJSON(w, http.StatusOK, modeBody{Mode: m})
+}
+
+// refused answers err with 503 and Retry-After if it is of kind
+// store.ErrUnavailable – a write the store's mode refused, one this instance
+// cannot take because it is a replica (see store/raft), or an operation that
+// timed out waiting for the database – and reports whether it did.
+func (h *Handler) refused(w http.ResponseWriter, err error) bool {
+	var msg string
+	switch {
+	case !errors.Is(err, store.ErrUnavailable):
+		return false
+	case errors.Is(err, store.ErrTimeout):
+		msg = "the database is busy"
+	case errors.Is(err, store.ErrCircuitOpen):
+		msg = "the database is failing"
+	case h.store.Mode() == store.ModeReadWrite:
+		msg = "this instance is not accepting writes"
+	default:
+		msg = "not available in " + string(h.store.Mode()) + " mode"
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(h.RetryAfter.Seconds()))))
+	writeError(w, http.StatusServiceUnavailable, msg)
+	return true
+}
@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+
+	"github.com/arkantrust/idempotency-example/backend/models"
+	"github.com/arkantrust/idempotency-example/backend/openapi"
+	"github.com/arkantrust/idempotency-example/backend/store"
+)
+
+// pollAfter is the Retry-After, in seconds, sent with a pending operation: a
+// create takes milliseconds, so a client polling once a second is not kept
+// waiting long.
+const pollAfter = "1"
+
+// createAsync handles POST /chargebacks with Prefer: respond-async.
+//
+// The create is recorded as an operation and run by a worker. The first call
+// answers 202 Accepted with the pending operation and a Location to poll at
+// /operations/{id}. A retry with the same key answers like the operation
+// does by then: 202 while it is pending, the created chargeback – exactly
+// like a synchronous retry – once it has succeeded, and the failed operation
+// once it has given up.
+func (h *Handler) createAsync(w http.ResponseWriter, r *http.Request, key string, body *models.Chargeback) {
+	op, _, err := h.Async.Start(r.Context(), key, body)
+	switch {
+	case errors.Is(err, store.ErrKeyReused):
+		writeError(w, http.StatusUnprocessableEntity, "idempotency key was already used with a different payload")
+		return
+	case err != nil:
+		h.fail(w, r, err, "failed to start the create")
+		return
+	}
+
+	if op.Status == models.OperationSucceeded {
+		op, err = h.Async.Get(r.Context(), op.ID)
+		switch {
+		case err != nil:
+			h.fail(w, r, err, "failed to load the operation")
+			return
+		case op.Result == nil:
+			writeError(w, http.StatusNotFound, "the chargeback created with this idempotency key has been deleted")
+			return
+		}
+		location := locate(r, "/chargebacks/"+op.Result.ID)
+		setReplayed(w, true, op.Result.CreatedAt)
+		setETag(w, op.Result)
+		w.Header().Set("Location", location)
+		h.Policy.duplicate(w, r, location, op.Result)
+		return
+	}
+
+	w.Header().Set("Location", locate(r, "/operations/"+op.ID))
+	w.Header().Add(PreferenceAppliedHeader, "respond-async")
+	if op.Status == models.OperationPending {
+		w.Header().Set("Retry-After", pollAfter)
+		respond(w, r, http.StatusAccepted, op)
+		return
+	}
+	respond(w, r, http.StatusOK, op)
+}
+
+// Operation handles GET /operations/{id}. A pending operation comes with a
+// Retry-After saying when to poll again; a succeeded one carries the
+// chargeback it created.
+func (h *Handler) Operation(w http.ResponseWriter, r *http.Request) {
+	op, err := h.Async.Get(r.Context(), r.PathValue("id"))
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		writeError(w, http.StatusNotFound, "operation not found")
+		return
+	case err != nil:
+		h.fail(w, r, err, "failed to load the operation")
+		return
+	}
+	if !op.Done() {
+		w.Header().Set("Retry-After", pollAfter)
+	}
+	respond(w, r, http.StatusOK, op)
+}
+
+// asyncRoutes documents the asynchronous answers of POST /chargebacks in
+// routes and adds the operations route.
+func (h *Handler) asyncRoutes(routes []openapi.Route) []openapi.Route {
+	for i, rt := range routes {
+		if rt.Method != http.MethodPost || rt.Pattern != "/chargebacks" {
+			continue
+		}
+		routes[i].Description += " With Prefer: respond-async the create runs in the background: the first " +
+			"request gets 202 and the operation to poll, and a retry gets the operation until it has finished."
+		routes[i].Responses = append(slices.Clip(rt.Responses), openapi.Response{
+			Status:      http.StatusAccepted,
+			Description: "Accepted for asynchronous processing; poll the operation at Location.",
+			Body:        models.Operation{},
+			Headers:     []string{"Location", "Retry-After", PreferenceAppliedHeader},
+		})
+	}
+	return append(routes, openapi.Route{
+		Method: "GET", Pattern: "/operations/{id}", Tag: "chargebacks", Access: openapi.Read,
+		Summary: "Poll an asynchronous create",
+		Description: "The operation a POST /chargebacks with Prefer: respond-async started. Once it has " +
+			"succeeded it carries the chargeback it created; a failed operation says why.",
+		Params:     []openapi.Param{{Name: "id", In: "path", Description: "Operation ID."}},
+		MediaTypes: mediaTypes(),
+		Responses: responses(
+			openapi.Response{Status: http.StatusOK, Description: "The operation. Retry-After is set while it is pending.", Body: models.Operation{}, Headers: []string{"Retry-After"}},
+			openapi.Response{Status: http.StatusNotFound, Description: "No operation with this ID."},
+			openapi.Response{Status: http.StatusNotAcceptable, Description: "No acceptable media type."},
+		),
+		Handler: h.Operation,
+	})
+}
@@ -0,0 +1,74 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/arkantrust/idempotency-example/backend/handlers"
+	"github.com/arkantrust/idempotency-example/backend/models"
+	"github.com/arkantrust/idempotency-example/backend/service"
+)
+
+func TestAsyncCreate(t *testing.T) {
+	s := newTestStore(t)
+	svc := service.NewChargebacks(s)
+	h := handlers.New(s, svc)
+	h.Async = service.NewOperations(svc, s)
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set(handlers.IdempotencyKeyHeader, "k-1")
+		req.Header.Set(handlers.PreferHeader, "respond-async")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+	body := `{"amount":100,"currency":"USD","reason":"fraud"}`
+
+	// No worker runs yet: the operation stays pending, and so does a retry.
+	rec := do(http.MethodPost, "/chargebacks", body)
+	var op models.Operation
+	if err := json.Unmarshal(rec.Body.Bytes(), &op); rec.Code != http.StatusAccepted || err != nil || op.Status != models.OperationPending {
+		t.Fatalf("expected 202 with a pending operation, got %d: %s", rec.Code, rec.Body)
+	}
+	if loc := rec.Header().Get("Location"); loc != "/operations/"+op.ID || rec.Header().Get(handlers.PreferenceAppliedHeader) != "respond-async" {
+		t.Fatalf("expected the operation's Location and the preference applied, got %v", rec.Header())
+	}
+	if again := do(http.MethodPost, "/chargebacks", body); again.Code != http.StatusAccepted || again.Header().Get("Location") != "/operations/"+op.ID {
+		t.Fatalf("expected the retry to return the same operation, got %d: %s", again.Code, again.Body)
+	}
+	if rec := do(http.MethodPost, "/chargebacks", `{"amount":200,"currency":"USD","reason":"fraud"}`); rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422 for another payload, got %d: %s", rec.Code, rec.Body)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go h.Async.Run(ctx)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for op.Status == models.OperationPending {
+		if time.Now().After(deadline) {
+			t.Fatal("the operation did not finish")
+		}
+		time.Sleep(10 * time.Millisecond)
+		rec := do(http.MethodGet, "/operations/"+op.ID, "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected 200 polling the operation, got %d: %s", rec.Code, rec.Body)
+		}
+		op = models.Operation{}
+		json.Unmarshal(rec.Body.Bytes(), &op)
+	}
+	if op.Status != models.OperationSucceeded || op.Result == nil || op.Result.ID != op.ChargebackID || op.Result.Reason != "fraud" {
+		t.Fatalf("expected the operation to carry the created chargeback, got %+v", op)
+	}
+
+	// Once done, retrying the POST returns the chargeback itself.
+	rec = do(http.MethodPost, "/chargebacks", body)
+	if rec.Code != http.StatusOK || rec.Header().Get("Location") != "/chargebacks/"+op.ChargebackID || rec.Header().Get(handlers.ReplayedHeader) != "true" {
+		t.Fatalf("expected a replay of the created chargeback, got %d %v: %s", rec.Code, rec.Header(), rec.Body)
+	}
+}
@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/arkantrust/idempotency-example/backend/openapi"
+)
+
+// ResponsePolicy holds the response conventions that are a matter of API
+// style rather than semantics, so a deployment can match what its clients
+// expect without the handlers changing. The zero value is the default style.
+type ResponsePolicy struct {
+	// DeleteStatus is the status of a successful single-record delete:
+	// http.StatusOK (the default, also used for 0) with a body naming the
+	// deleted ID, or http.StatusNoContent with no body. Bulk deletes always
+	// return 200 with the count, which a 204 would lose.
+	DeleteStatus int
+
+	// DuplicateStatus is how a create answers a retry of a create that
+	// already succeeded: http.StatusOK (the default, also used for 0)
+	// replays the stored record as the first response had it, and
+	// http.StatusConflict answers 409 with a Location pointing at the
+	// record instead. A request can choose with PreferHeader. Version 2 of
+	// the API always answers 409 unless the request prefers otherwise.
+	DuplicateStatus int
+}
+
+// PreferHeader lets a request choose the answer to a duplicate create
+// regardless of ResponsePolicy.DuplicateStatus: "Prefer: duplicate=replay"
+// or "Prefer: duplicate=conflict". A preference that was applied is echoed
+// in PreferenceAppliedHeader, as RFC 7240 has it.
+const (
+	PreferHeader            = "Prefer"
+	PreferenceAppliedHeader = "Preference-Applied"
+)
+
+// duplicateBody is the body of a 409 answering a duplicate create.
+type duplicateBody struct {
+	Error string `json:"error"`
+
+	// Location is the path of the record the first request created, as in
+	// the Location header.
+	Location  string `json:"location"`
+	RequestID string `json:"requestId,omitempty"`
+}
+
+// created answers a create that wrote a record with 201 and a Location
+// pointing at it.
+func (p ResponsePolicy) created(w http.ResponseWriter, r *http.Request, location string, v any) {
+	w.Header().Set("Location", location)
+	respond(w, r, http.StatusCreated, v)
+}
+
+// duplicate answers a create that found the record v an earlier request
+// made at location.
+func (p ResponsePolicy) duplicate(w http.ResponseWriter, r *http.Request, location string, v any) {
+	status := p.DuplicateStatus
+	if versionOf(r).n >= 2 {
+		status = http.StatusConflict
+	}
+	switch preference(r, "duplicate") {
+	case "replay":
+		status = http.StatusOK
+		w.Header().Add(PreferenceAppliedHeader, "duplicate=replay")
+	case "conflict":
+		status = http.StatusConflict
+		w.Header().Add(PreferenceAppliedHeader, "duplicate=conflict")
+	}
+	if status != http.StatusConflict {
+		respond(w, r, http.StatusOK, v)
+		return
+	}
+	w.Header().Set("Location", location)
+	writeJSON(w, http.StatusConflict, duplicateBody{
+		Error:     "already created by an earlier request",
+		Location:  location,
+		RequestID: w.Header().Get("X-Request-ID"),
+	})
+}
+
+// preference returns the value of the preference name in r's Prefer
+// headers, or "".
+func preference(r *http.Request, name string) string {
+	v, _ := lookupPreference(r, name)
+	return v
+}
+
+// prefers reports whether r's Prefer headers carry the preference name, which
+// takes no value, such as respond-async.
+func prefers(r *http.Request, name string) bool {
+	_, ok := lookupPreference(r, name)
+	return ok
+}
+
+func lookupPreference(r *http.Request, name string) (string, bool) {
+	for _, h := range r.Header.Values(PreferHeader) {
+		for _, pref := range strings.Split(h, ",") {
+			// Parameters after ';' qualify a preference; none are defined.
+			pref, _, _ = strings.Cut(pref, ";")
+			k, v, _ := strings.Cut(strings.TrimSpace(pref), "=")
+			if strings.EqualFold(strings.TrimSpace(k), name) {
+				return strings.Trim(strings.TrimSpace(v), `"`), true
+			}
+		}
+	}
+	return "", false
+}
+
+// deleted answers a successful single-record delete; v is the body of a 200.
+func (p ResponsePolicy) deleted(w http.ResponseWriter, r *http.Request, v any) {
+	if p.DeleteStatus == http.StatusNoContent {
+		setFencingToken(w, r)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	respond(w, r, http.StatusOK, v)
+}
+
+// deletedResponse documents the answer deleted gives.
+func (p ResponsePolicy) deletedResponse(body any) []openapi.Response {
+	if p.DeleteStatus == http.StatusNoContent {
+		return []openapi.Response{{Status: http.StatusNoContent, Description: "The record no longer exists.", Headers: []string{ReplayedHeader}}}
+	}
+	return []openapi.Response{{Status: http.StatusOK, Description: "The record no longer exists.", Body: body, Headers: []string{ReplayedHeader}}}
+}
@@ -0,0 +1,47 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/arkantrust/idempotency-example/backend/handlers"
+)
+
+func TestDuplicatePolicy(t *testing.T) {
+	h := newTestHandler(t)
+	body := `{"amount":100,"currency":"USD","reason":"fraud"}`
+	postPrefer := func(prefer string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/chargebacks/cb-1", strings.NewReader(body))
+		req.SetPathValue("id", "cb-1")
+		if prefer != "" {
+			req.Header.Set(handlers.PreferHeader, prefer)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := postPrefer(""); rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body)
+	}
+	if rec := postPrefer(""); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"reason":"fraud"`) {
+		t.Fatalf("expected a 200 replay by default, got %d: %s", rec.Code, rec.Body)
+	}
+
+	rec := postPrefer("respond-async, duplicate=conflict")
+	if rec.Code != http.StatusConflict || rec.Header().Get("Location") != "/chargebacks/cb-1" ||
+		rec.Header().Get(handlers.PreferenceAppliedHeader) != "duplicate=conflict" ||
+		!strings.Contains(rec.Body.String(), `"location":"/chargebacks/cb-1"`) {
+		t.Fatalf("expected 409 pointing at the record, got %d %v: %s", rec.Code, rec.Header(), rec.Body)
+	}
+
+	h.Policy.DuplicateStatus = http.StatusConflict
+	if rec := postPrefer(""); rec.Code != http.StatusConflict || rec.Header().Get(handlers.ReplayedHeader) != "true" {
+		t.Fatalf("expected 409 under the policy, got %d: %s", rec.Code, rec.Body)
+	}
+	if rec := postPrefer("duplicate=replay"); rec.Code != http.StatusOK {
+		t.Fatalf("expected the request's preference to win, got %d: %s", rec.Code, rec.Body)
+	}
+}
@@ -0,0 +1,61 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/arkantrust/idempotency-example/backend/handlers"
+	"github.com/arkantrust/idempotency-example/backend/models"
+	"github.com/arkantrust/idempotency-example/backend/rates"
+	"github.com/arkantrust/idempotency-example/backend/service"
+)
+
+func TestStatsConvertTo(t *testing.T) {
+	s := newTestStore(t)
+	svc := service.NewChargebacks(s)
+	svc.Rates = s
+	h := handlers.New(s, svc)
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return rec
+	}
+	do(http.MethodPost, "/chargebacks/cb-1", `{"amount":1000,"currency":"EUR","reason":"fraud"}`)
+	do(http.MethodPost, "/chargebacks/cb-2", `{"amount":1500,"currency":"JPY","reason":"fraud"}`)
+
+	if rec := do(http.MethodGet, "/chargebacks/stats?convertTo=USD", ""); rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 before rates are cached, got %d: %s", rec.Code, rec.Body)
+	}
+
+	p, err := rates.ParseStatic("EUR", []string{"USD=1.1", "JPY=150"})
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if _, err := rates.Refresh(t.Context(), p, s); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	rec := do(http.MethodGet, "/chargebacks/stats?convertTo=USD", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	var stats models.Stats
+	if err := json.Unmarshal(rec.Body.Bytes(), &stats); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	// €10.00 is $11.00, and ¥1500 is €10.00, so $11.00 again.
+	c := stats.Converted
+	if c == nil || c.Currency != "USD" || c.Amount != 2200 || c.DisplayAmount != "22.00" || c.RatesProvider != "static" {
+		t.Fatalf("expected $22.00 converted, got %+v", c)
+	}
+
+	if rec := do(http.MethodGet, "/chargebacks/stats?convertTo=GBP", ""); rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 without a GBP rate, got %d: %s", rec.Code, rec.Body)
+	}
+	if rec := do(http.MethodGet, "/chargebacks/stats?convertTo=dollars", ""); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an unknown currency, got %d: %s", rec.Code, rec.Body)
+	}
+}
@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+
+	"github.com/arkantrust/idempotency-example/backend/reconcile"
+	"github.com/arkantrust/idempotency-example/backend/store"
+)
+
+// maxSettlementBytes bounds the size of a settlement file.
+const maxSettlementBytes = 64 << 20
+
+// Reconcile handles POST /admin/reconciliations?tenant=, with a settlement
+// CSV as the body (see package reconcile). The first run of a file answers
+// 201 with the report and its Location; running the same file again answers
+// 200 with the same report, marked as a replay.
+func (h *Handler) Reconcile(w http.ResponseWriter, r *http.Request) {
+	tenant := r.URL.Query().Get("tenant")
+	if tenant != "" && !store.ValidTenant(tenant) {
+		writeError(w, http.StatusBadRequest, "invalid tenant")
+		return
+	}
+	body := http.MaxBytesReader(w, r.Body, maxSettlementBytes)
+
+	report, created, err := reconcile.Run(store.WithTenant(r.Context(), tenant), h.store, body)
+	if errors.Is(err, reconcile.ErrInvalidFile) {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		writeError(w, http.StatusRequestEntityTooLarge, "settlement file exceeds the size limit")
+		return
+	}
+	if err != nil {
+		h.fail(w, r, err, "failed to reconcile")
+		return
+	}
+
+	location := "/admin/reconciliations/" + url.PathEscape(report.ID)
+	if tenant != "" {
+		location += "?tenant=" + url.QueryEscape(tenant)
+	}
+	w.Header().Set("Location", location)
+	setReplayed(w, !created, report.CreatedAt)
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	writeJSON(w, status, report)
+}
+
+// Reconciliation handles GET /admin/reconciliations/{id}?tenant=.
+func (h *Handler) Reconciliation(w http.ResponseWriter, r *http.Request) {
+	tenant := r.URL.Query().Get("tenant")
+	if tenant != "" && !store.ValidTenant(tenant) {
+		writeError(w, http.StatusBadRequest, "invalid tenant")
+		return
+	}
+	report, err := h.store.Reconciliation(store.WithTenant(r.Context(), tenant), r.PathValue("id"))
+	if errors.Is(err, store.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "reconciliation not found")
+		return
+	}
+	if err != nil {
+		h.fail(w, r, err, "failed to load reconciliation")
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
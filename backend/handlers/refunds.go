@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+
+	"github.com/arkantrust/idempotency-example/backend/models"
+	"github.com/arkantrust/idempotency-example/backend/store"
+)
+
+// CreateRefund handles POST /chargebacks/{id}/refunds/{refundId}. The
+// refund ID is the idempotency key, as the chargeback ID is for POST
+// /chargebacks/{id}: the first request creates the refund and answers 201,
+// retries get the stored refund with 200. A retry with a different amount
+// gets 422, since replaying would hide that it was never applied, and a
+// refund taking the chargeback's refunds past its amount gets 409.
+func (h *Handler) CreateRefund(w http.ResponseWriter, r *http.Request) {
+	if _, ok := negotiate(r); !ok {
+		writeError(w, http.StatusNotAcceptable, "supported media types: "+supportedTypes())
+		return
+	}
+	var body models.Refund
+	if !h.decodeBody(w, r, &body) {
+		return
+	}
+	id, refundID := r.PathValue("id"), r.PathValue("refundId")
+	body.ID = refundID
+
+	r = fenced(r)
+	refund, created, err := h.svc.CreateRefund(r.Context(), id, &body)
+	switch {
+	case writeInvalid(w, err):
+		return
+	case errors.Is(err, store.ErrNotFound):
+		writeError(w, http.StatusNotFound, "chargeback not found")
+		return
+	case errors.Is(err, store.ErrKeyReused):
+		writeError(w, http.StatusUnprocessableEntity, "refund ID was already used with a different amount")
+		return
+	case errors.Is(err, store.ErrRefundExceedsAmount):
+		writeError(w, http.StatusConflict, "the refund would exceed the chargeback amount")
+		return
+	case err != nil:
+		h.fail(w, r, err, "failed to create refund")
+		return
+	}
+	setReplayed(w, !created, refund.CreatedAt)
+	setFencingToken(w, r)
+	location := locate(r, "/chargebacks/"+url.PathEscape(id)+"/refunds/"+url.PathEscape(refundID))
+	if created {
+		h.Policy.created(w, r, location, refund)
+		return
+	}
+	h.Policy.duplicate(w, r, location, refund)
+}
+
+// Refunds handles GET /chargebacks/{id}/refunds.
+func (h *Handler) Refunds(w http.ResponseWriter, r *http.Request) {
+	if _, ok := negotiate(r); !ok {
+		writeError(w, http.StatusNotAcceptable, "supported media types: "+supportedTypes())
+		return
+	}
+	list, err := h.svc.Refunds(r.Context(), r.PathValue("id"))
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		writeError(w, http.StatusNotFound, "chargeback not found")
+		return
+	case err != nil:
+		h.fail(w, r, err, "failed to list refunds")
+		return
+	}
+	respond(w, r, http.StatusOK, list)
+}
@@ -0,0 +1,69 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/arkantrust/idempotency-example/backend/handlers"
+	"github.com/arkantrust/idempotency-example/backend/models"
+)
+
+func refund(h *handlers.Handler, refundID, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/chargebacks/cb-1/refunds/"+refundID, strings.NewReader(body))
+	req.SetPathValue("id", "cb-1")
+	req.SetPathValue("refundId", refundID)
+	rec := httptest.NewRecorder()
+	h.CreateRefund(rec, req)
+	return rec
+}
+
+func TestRefundsAreCreatedOncePerID(t *testing.T) {
+	h := newTestHandler(t)
+	if rec := refund(h, "r-1", `{"amount":60}`); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 without the chargeback, got %d: %s", rec.Code, rec.Body)
+	}
+	post(h, `{"amount":100,"currency":"USD","reason":"fraud"}`)
+
+	rec := refund(h, "r-1", `{"amount":60}`)
+	if rec.Code != http.StatusCreated || rec.Header().Get("Location") != "/chargebacks/cb-1/refunds/r-1" {
+		t.Fatalf("expected 201, got %d %q: %s", rec.Code, rec.Header().Get("Location"), rec.Body)
+	}
+	if rec := refund(h, "r-1", `{"amount":60}`); rec.Code != http.StatusOK || rec.Header().Get(handlers.ReplayedHeader) != "true" {
+		t.Fatalf("expected a replay, got %d: %s", rec.Code, rec.Body)
+	}
+	if rec := refund(h, "r-1", `{"amount":70}`); rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422 for another amount, got %d: %s", rec.Code, rec.Body)
+	}
+	if rec := refund(h, "r-2", `{"amount":41}`); rec.Code != http.StatusConflict {
+		t.Fatalf("expected 409 past the amount, got %d: %s", rec.Code, rec.Body)
+	}
+	if rec := refund(h, "r-2", `{"amount":0}`); rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422 for a zero amount, got %d: %s", rec.Code, rec.Body)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/chargebacks/cb-1?expand=refunds", nil)
+	req.SetPathValue("id", "cb-1")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	var got struct {
+		models.Chargeback
+		Refunds []models.Refund `json:"refunds"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("expand: %d %v: %s", rec.Code, err, rec.Body)
+	}
+	if got.Amount != 100 || len(got.Refunds) != 1 || got.Refunds[0].Amount != 60 {
+		t.Fatalf("unexpected expansion: %s", rec.Body)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/chargebacks/cb-1?expand=owner", nil)
+	req.SetPathValue("id", "cb-1")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an unknown expansion, got %d: %s", rec.Code, rec.Body)
+	}
+}
@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/arkantrust/idempotency-example/backend/service"
+)
+
+// DailyReport handles GET /reports/daily?from=&to=: the count and summed
+// amounts per currency of the chargebacks created on each day, for the
+// caller's tenant only.
+func (h *Handler) DailyReport(w http.ResponseWriter, r *http.Request) {
+	h.report(w, r, service.Daily)
+}
+
+// WeeklyReport handles GET /reports/weekly?from=&to=, which is DailyReport
+// by ISO week.
+func (h *Handler) WeeklyReport(w http.ResponseWriter, r *http.Request) {
+	h.report(w, r, service.Weekly)
+}
+
+// report answers a report request for period. from and to are dates (or RFC
+// 3339 times, of which only the UTC date counts), both inclusive and both
+// optional.
+func (h *Handler) report(w http.ResponseWriter, r *http.Request, period string) {
+	if _, ok := negotiate(r); !ok {
+		writeError(w, http.StatusNotAcceptable, "supported media types: "+supportedTypes())
+		return
+	}
+	var from, to time.Time
+	var ok bool
+	if from, ok = timeParam(w, r, "from"); !ok {
+		return
+	}
+	if to, ok = timeParam(w, r, "to"); !ok {
+		return
+	}
+
+	report, err := h.svc.Report(r.Context(), period, from, to)
+	if writeInvalid(w, err) {
+		return
+	}
+	if err != nil {
+		h.fail(w, r, err, "failed to compute report")
+		return
+	}
+	respond(w, r, http.StatusOK, report)
+}
@@ -0,0 +1,509 @@
+package handlers
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/arkantrust/idempotency-example/backend/models"
+	"github.com/arkantrust/idempotency-example/backend/openapi"
+	"github.com/arkantrust/idempotency-example/backend/service"
+	"github.com/arkantrust/idempotency-example/backend/store"
+)
+
+// Resource serves a service.Resource over HTTP:
+//
+//   - GET    /{name}      – list, pure read.
+//   - GET    /{name}/{id} – read one, pure read.
+//   - POST   /{name}/{id} – create; the ID is the idempotency key, so a retry
+//     returns the stored record with 200 instead of creating another.
+//   - PUT    /{name}/{id} – update with write-avoidance; X-Idempotency-Write
+//     reports whether anything was written. With X-Strict-Version the body's
+//     version must match the stored one.
+//   - DELETE /{name}/{id} – delete; succeeds whether or not the record
+//     existed. If-Match makes it conditional on the record's ETag, and
+//     ?return=record returns what was removed.
+//
+// Body limits, strict JSON and content negotiation are shared with the
+// Handler the resource was created from; validation, key formats and metrics
+// belong to the service.
+type Resource[T any, PT store.RecordPtr[T]] struct {
+	svc *service.Resource[T, PT]
+	h   *Handler
+
+	// expand, when set, serves GET /{name}/{id}?expand=a,b: it returns the
+	// record with the related records named. It returns an
+	// *service.InvalidError for a name it does not know.
+	expand func(ctx context.Context, item PT, names []string) (any, error)
+
+	// scopes, when set, serve GET /{name}?<param>=v for each param: the
+	// function walks the records of the scope v, in ID order.
+	scopes map[string]func(ctx context.Context, v string, fn func(T) error) error
+}
+
+// NewResource serves svc with the settings of h.
+func NewResource[T any, PT store.RecordPtr[T]](h *Handler, svc *service.Resource[T, PT]) *Resource[T, PT] {
+	return &Resource[T, PT]{svc: svc, h: h}
+}
+
+// serve returns the handler of one of rs's routes, which calls fn with the
+// ID in the path, if any.
+func (rs *Resource[T, PT]) serve(fn func(w http.ResponseWriter, r *http.Request, id string)) http.HandlerFunc {
+	return acceptable(func(w http.ResponseWriter, r *http.Request) {
+		fn(w, r, r.PathValue("id"))
+	})
+}
+
+// list streams the records to the client as they are read from the store,
+// so that memory use stays flat regardless of how many there are. Media
+// types that cannot be streamed get the whole list at once.
+//
+// With createdAfter and/or createdBefore only the records created strictly
+// between them are listed, in order of creation rather than of ID. The range
+// is read from the store's creation time index, so it costs what the range
+// holds, not what the collection does. A scope (see Resource.scopes) is read
+// from its own index instead, in ID order, and the range filters it.
+func (rs *Resource[T, PT]) list(w http.ResponseWriter, r *http.Request) {
+	name := rs.svc.Spec().Name
+	after, ok := timeParam(w, r, "createdAfter")
+	if !ok {
+		return
+	}
+	before, ok := timeParam(w, r, "createdBefore")
+	if !ok {
+		return
+	}
+	ranged := !after.IsZero() || !before.IsZero()
+	forEach := func(fn func(T) error) error {
+		if ranged {
+			return rs.svc.ForEachCreated(r.Context(), after, before, fn)
+		}
+		return rs.svc.ForEach(r.Context(), fn)
+	}
+	whole := !ranged // List reads the whole collection at once
+	for param, walk := range rs.scopes {
+		v := r.URL.Query().Get(param)
+		if v == "" {
+			continue
+		}
+		// The scope's index decides what is read; a creation range only
+		// filters it.
+		whole = false
+		forEach = func(fn func(T) error) error {
+			return walk(r.Context(), v, func(item T) error {
+				created := PT(&item).RecordCreatedAt()
+				if (!after.IsZero() && !created.After(after)) || (!before.IsZero() && !created.Before(before)) {
+					return nil
+				}
+				return fn(item)
+			})
+		}
+		break
+	}
+
+	c, ok := negotiate(r)
+	if !ok || c.list == nil {
+		var (
+			items []T
+			err   error
+		)
+		if !whole {
+			items = []T{}
+			err = forEach(func(item T) error {
+				items = append(items, item)
+				return nil
+			})
+		} else {
+			items, err = rs.svc.List(r.Context())
+		}
+		if err != nil {
+			rs.h.fail(w, r, err, "failed to list "+name)
+			return
+		}
+		respond(w, r, http.StatusOK, items)
+		return
+	}
+
+	w.Header().Add("Vary", "Accept")
+	err := streamList(w, r, c, func(yield func(any) error) error {
+		return forEach(func(item T) error { return yield(item) })
+	})
+	if err != nil {
+		rs.h.fail(w, r, err, "failed to list "+name)
+	}
+}
+
+// timeParam parses the query parameter name as a date or RFC 3339 time,
+// answering 400 if it is neither. It returns the zero time when the
+// parameter is absent.
+func timeParam(w http.ResponseWriter, r *http.Request, name string) (time.Time, bool) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return time.Time{}, true
+	}
+	t, err := parseTime(v)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid "+name+": expected YYYY-MM-DD or RFC 3339")
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+func (rs *Resource[T, PT]) get(w http.ResponseWriter, r *http.Request, id string) {
+	kind := rs.svc.Spec().Kind
+	item, err := rs.svc.Get(r.Context(), id)
+	if errors.Is(err, store.ErrNotFound) {
+		writeError(w, http.StatusNotFound, kind+" not found")
+		return
+	}
+	if err != nil {
+		rs.h.fail(w, r, err, "failed to get "+kind)
+		return
+	}
+	if names := expandParam(r); len(names) > 0 {
+		if rs.expand == nil {
+			writeError(w, http.StatusBadRequest, kind+" records have nothing to expand")
+			return
+		}
+		expanded, err := rs.expand(r.Context(), item, names)
+		if writeInvalid(w, err) {
+			return
+		}
+		if err != nil {
+			rs.h.fail(w, r, err, "failed to get "+kind)
+			return
+		}
+		// No ETag: the record's would not change with the related records.
+		respond(w, r, http.StatusOK, expanded)
+		return
+	}
+	setETag(w, item)
+	respond(w, r, http.StatusOK, item)
+}
+
+// expandParam returns the names listed in the expand query parameter, which
+// may be repeated or comma-separated.
+func expandParam(r *http.Request) []string {
+	var names []string
+	for _, v := range r.URL.Query()["expand"] {
+		for name := range strings.SplitSeq(v, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+// create implements natural-key idempotency: the first call creates the
+// record and returns 201, retries return the same record with 200 and no
+// write.
+func (rs *Resource[T, PT]) create(w http.ResponseWriter, r *http.Request, id string) {
+	var body T
+	if !rs.h.decodeBody(w, r, &body) {
+		return
+	}
+	PT(&body).SetRecordID(id)
+
+	result, created, err := rs.svc.Create(r.Context(), &body)
+	if writeInvalid(w, err) {
+		return
+	}
+	if errors.Is(err, store.ErrKeyConflict) {
+		writeError(w, http.StatusConflict, "idempotency key is already in use by another client")
+		return
+	}
+	if err != nil {
+		rs.h.fail(w, r, err, "failed to create "+rs.svc.Spec().Kind)
+		return
+	}
+
+	setReplayed(w, !created, PT(result).RecordCreatedAt())
+	setETag(w, result)
+	location := locate(r, "/"+rs.svc.Spec().Name+"/"+url.PathEscape(id))
+	if created {
+		rs.h.Policy.created(w, r, location, result)
+	} else {
+		// Duplicate request detected – by default return the existing
+		// record with 200 OK, exactly what the first call returned apart
+		// from the status.
+		rs.h.Policy.duplicate(w, r, location, result)
+	}
+}
+
+// StrictVersionHeader lets a client opt in to optimistic concurrency control
+// for one update by sending "X-Strict-Version: true". The body must then
+// carry the version the client last read, and the update gets 409 instead of
+// writing if the record has been written since.
+const StrictVersionHeader = "X-Strict-Version"
+
+// update implements write-avoidance: the merged record is compared with the
+// stored one and only written if it differs.
+func (rs *Resource[T, PT]) update(w http.ResponseWriter, r *http.Request, id string) {
+	rawMask := r.Header.Get(UpdateMaskHeader)
+	if rawMask == "" {
+		rawMask = r.URL.Query().Get("fields")
+	}
+	mask, err := rs.svc.ParseMask(rawMask)
+	if writeInvalid(w, err) {
+		return
+	}
+
+	var body T
+	if !rs.h.decodeBody(w, r, &body) {
+		return
+	}
+
+	kind := rs.svc.Spec().Kind
+	var (
+		result  *T
+		written bool
+	)
+	if r.Header.Get(StrictVersionHeader) == "true" {
+		var version int64
+		if v, ok := any(PT(&body)).(models.Versioned); ok {
+			if version = v.RecordVersion(); version == 0 {
+				writeError(w, http.StatusPreconditionRequired, "version is required with "+StrictVersionHeader)
+				return
+			}
+		}
+		result, written, err = rs.svc.UpdateAt(r.Context(), id, &body, mask, version)
+	} else {
+		result, written, err = rs.svc.Update(r.Context(), id, &body, mask)
+	}
+	if writeInvalid(w, err) {
+		return
+	}
+	if errors.Is(err, store.ErrNotFound) {
+		writeError(w, http.StatusNotFound, kind+" not found")
+		return
+	}
+	if errors.Is(err, store.ErrPreconditionFailed) {
+		writeError(w, http.StatusConflict, kind+" has been written since the version sent")
+		return
+	}
+	if err != nil {
+		rs.h.fail(w, r, err, "failed to update "+kind)
+		return
+	}
+
+	// Report whether a write actually occurred. This is useful for debugging
+	// and demonstrates the write-avoidance optimisation in action.
+	w.Header().Set("X-Idempotency-Write", strconv.FormatBool(written))
+	setETag(w, result)
+	respond(w, r, http.StatusOK, result)
+}
+
+// tombstone is the ?return=record body of a delete that found nothing to
+// remove, typically a retry of one that did.
+type tombstone struct {
+	XMLName   xml.Name `json:"-" xml:"tombstone"`
+	ID        string   `json:"id" xml:"id"`
+	Tombstone bool     `json:"tombstone" xml:"tombstone"`
+}
+
+// delete returns 200 whether or not the record existed: the desired end
+// state, no such record, holds either way.
+//
+// With If-Match the record is only removed if its ETag matches, checked in
+// the same transaction as the delete; a changed record is kept and the
+// request gets 412. A record that is already gone is not a failed
+// precondition here, unlike in RFC 9110: it is what a retry of a successful
+// conditional delete finds, and the retry must succeed like the original.
+//
+// With ?return=record the response is the removed record, or a tombstone
+// when there was nothing to remove, so that a client can check what it
+// deleted even when only its retry got an answer.
+func (rs *Resource[T, PT]) delete(w http.ResponseWriter, r *http.Request, id string) {
+	kind := rs.svc.Spec().Kind
+	returnRecord := false
+	switch v := r.URL.Query().Get("return"); v {
+	case "":
+	case "record":
+		returnRecord = true
+	default:
+		writeError(w, http.StatusBadRequest, `invalid return: expected "record"`)
+		return
+	}
+	var check func(*T) bool
+	if match := r.Header.Get(IfMatchHeader); match != "" {
+		check = func(item *T) bool { return matchesETag(match, etagOf(item)) }
+	}
+
+	removed, err := rs.svc.Remove(r.Context(), id, check)
+	if errors.Is(err, store.ErrPreconditionFailed) {
+		writeError(w, http.StatusPreconditionFailed, kind+" does not match "+IfMatchHeader)
+		return
+	}
+	if err != nil {
+		rs.h.fail(w, r, err, "failed to delete "+kind)
+		return
+	}
+	setReplayed(w, removed == nil, time.Time{})
+	switch {
+	case !returnRecord:
+		rs.h.Policy.deleted(w, r, deletedOne{Deleted: id})
+	case removed == nil:
+		respond(w, r, http.StatusOK, tombstone{ID: id, Tombstone: true})
+	default:
+		setETag(w, removed)
+		respond(w, r, http.StatusOK, removed)
+	}
+}
+
+// writeInvalid writes the response for a service error rejecting the
+// request's input – 422 listing the invalid fields or the rules broken, or
+// 400 – and reports whether err was one.
+func writeInvalid(w http.ResponseWriter, err error) bool {
+	var ve *models.ValidationError
+	if errors.As(err, &ve) {
+		writeFieldErrors(w, ve.Fields)
+		return true
+	}
+	var pe *models.PolicyError
+	if errors.As(err, &pe) {
+		writeViolations(w, pe.Violations)
+		return true
+	}
+	var ie *service.InvalidError
+	if errors.As(err, &ie) {
+		writeError(w, http.StatusBadRequest, ie.Reason)
+		return true
+	}
+	return false
+}
+
+// Routes returns the documented routes of the resource.
+func (rs *Resource[T, PT]) Routes() []openapi.Route {
+	negotiated := mediaTypes()
+	var zero T
+	name, kind := rs.svc.Spec().Name, rs.svc.Spec().Kind
+	collection, item := "/"+name, "/"+name+"/{id}"
+	id := openapi.Param{
+		Name: "id",
+		In:   "path",
+		Description: "Client-generated " + kind + " ID. It is the idempotency key: " +
+			"every request with the same ID refers to the same record.",
+	}
+	maskParams := []openapi.Param{
+		{Name: UpdateMaskHeader, In: "header", Description: `Comma-separated fields to update. Other fields keep their stored values.`},
+		{Name: "fields", In: "query", Description: "Alternative to " + UpdateMaskHeader + "; the header wins when both are sent."},
+	}
+	var scopeParams []openapi.Param
+	for _, param := range slices.Sorted(maps.Keys(rs.scopes)) {
+		scopeParams = append(scopeParams, openapi.Param{Name: param, In: "query", Description: "Only the " + name + " of this " + strings.TrimSuffix(param, "Id") + ", in ID order."})
+	}
+	getParams := []openapi.Param{id}
+	if rs.expand != nil {
+		getParams = append(getParams, openapi.Param{Name: "expand", In: "query", Description: "Comma-separated related records to include in the " + kind + ". The expanded response has no ETag."})
+	}
+	notFound := openapi.Response{Status: http.StatusNotFound, Description: "No " + kind + " with this ID."}
+	tooLarge := openapi.Response{Status: http.StatusRequestEntityTooLarge, Description: "Body exceeds the size limit."}
+	unsupported := openapi.Response{Status: http.StatusUnsupportedMediaType, Description: "Unsupported Content-Type."}
+	notAcceptable := openapi.Response{Status: http.StatusNotAcceptable, Description: "No acceptable media type."}
+
+	return []openapi.Route{
+		{
+			Method: "GET", Pattern: collection, Tag: name, Access: openapi.Read,
+			Summary:   "List " + name,
+			Sheddable: true,
+			Params: append([]openapi.Param{
+				{Name: "createdAfter", In: "query", Description: "Only " + name + " created strictly after this date or RFC 3339 time, listed in order of creation."},
+				{Name: "createdBefore", In: "query", Description: "Only " + name + " created strictly before this date or RFC 3339 time, listed in order of creation."},
+			}, scopeParams...),
+			MediaTypes: negotiated,
+			Responses: responses(
+				openapi.Response{Status: http.StatusOK, Description: "The " + name + " visible to the caller, in ID order unless a creation range is given.", Body: []T{}},
+				openapi.Response{Status: http.StatusBadRequest, Description: "Invalid createdAfter or createdBefore."},
+				notAcceptable,
+			),
+			Handler: rs.serve(func(w http.ResponseWriter, r *http.Request, _ string) { rs.list(w, r) }),
+		},
+		{
+			Method: "GET", Pattern: item, Tag: name, Access: openapi.Read,
+			Summary:    "Get a " + kind,
+			Params:     getParams,
+			MediaTypes: negotiated,
+			Responses: responses(
+				openapi.Response{Status: http.StatusOK, Description: "The stored record.", Body: zero, Headers: []string{ETagHeader}},
+				openapi.Response{Status: http.StatusBadRequest, Description: "Unknown expand name."},
+				notFound,
+				notAcceptable,
+			),
+			Handler: rs.serve(rs.get),
+		},
+		{
+			Method: "POST", Pattern: item, Tag: name, Access: openapi.Write,
+			Idempotency: openapi.KeyedByID,
+			Summary:     "Create a " + kind,
+			Description: "Idempotent create. The first request creates the record and returns 201; " +
+				"retries with the same ID return the stored record unchanged with 200, or 409 under the " +
+				"conflict duplicate policy.",
+			Params:     []openapi.Param{id, strictParam, preferParam},
+			Body:       zero,
+			MediaTypes: negotiated,
+			Responses: responses(
+				openapi.Response{Status: http.StatusCreated, Description: "Created.", Body: zero, Headers: []string{"Location", ETagHeader, ReplayedHeader}},
+				openapi.Response{Status: http.StatusOK, Description: "Replay: the record already existed and is returned unchanged.", Body: zero, Headers: append([]string{ETagHeader}, replayHeaders...)},
+				badRequest,
+				unprocessable,
+				openapi.Response{Status: http.StatusConflict, Description: "The ID is in use by another client, or, under the conflict duplicate policy, a retry: Location names the record.", Body: duplicateBody{}, Headers: append([]string{"Location", PreferenceAppliedHeader}, replayHeaders...)},
+				tooLarge,
+				unsupported,
+			),
+			Handler: rs.serve(rs.create),
+		},
+		{
+			Method: "PUT", Pattern: item, Tag: name, Access: openapi.Write,
+			Summary: "Update a " + kind,
+			Description: "Write-avoiding update. When the payload matches the stored record " +
+				"nothing is written and X-Idempotency-Write is false. A field mask limits the update to some fields. " +
+				"With " + StrictVersionHeader + " the body's version must match the stored record's, unless " +
+				"the update changes nothing.",
+			Params: append([]openapi.Param{id, strictParam, {
+				Name: StrictVersionHeader, In: "header",
+				Description: `"true" requires the body's version to match the stored record's; otherwise the update gets 409.`,
+			}}, maskParams...),
+			Body:       zero,
+			MediaTypes: negotiated,
+			Responses: responses(
+				openapi.Response{Status: http.StatusOK, Description: "The stored record.", Body: zero, Headers: []string{"X-Idempotency-Write", ETagHeader}},
+				badRequest,
+				unprocessable,
+				notFound,
+				openapi.Response{Status: http.StatusConflict, Description: "The record has been written since the version sent."},
+				openapi.Response{Status: http.StatusPreconditionRequired, Description: StrictVersionHeader + " was sent without a version."},
+				tooLarge,
+				unsupported,
+			),
+			Handler: rs.serve(rs.update),
+		},
+		{
+			Method: "DELETE", Pattern: item, Tag: name, Access: openapi.Write,
+			Summary: "Delete a " + kind,
+			Description: "Idempotent delete: succeeds whether or not the record existed. " +
+				ReplayedHeader + " is true when there was nothing to delete. With " + IfMatchHeader +
+				" a record whose ETag has changed is kept and the request gets 412; a record that is " +
+				"already gone still succeeds, so retries do. With return=record the response is the " +
+				"removed record, or {\"id\", \"tombstone\": true} when there was nothing to remove.",
+			Params: []openapi.Param{
+				id,
+				{Name: IfMatchHeader, In: "header", Description: "ETags the record must match to be deleted, or *."},
+				{Name: "return", In: "query", Description: `"record" returns the removed record instead of the default body.`},
+			},
+			MediaTypes: negotiated,
+			Responses: responses(append(rs.h.Policy.deletedResponse(deletedOne{}),
+				badRequest,
+				openapi.Response{Status: http.StatusPreconditionFailed, Description: "The record does not match " + IfMatchHeader + " and was kept."},
+			)...),
+			Handler: rs.serve(rs.delete),
+		},
+	}
+}
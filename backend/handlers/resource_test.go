@@ -0,0 +1,110 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/arkantrust/idempotency-example/backend/handlers"
+	"github.com/arkantrust/idempotency-example/backend/models"
+	"github.com/arkantrust/idempotency-example/backend/openapi"
+	"github.com/arkantrust/idempotency-example/backend/service"
+)
+
+// note is a minimal model registered through the resource framework, to show
+// that nothing in it is specific to chargebacks.
+type note struct {
+	ID        string    `json:"id"`
+	Text      string    `json:"text"`
+	Owner     string    `json:"owner,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+func (n *note) RecordID() string      { return n.ID }
+func (n *note) SetRecordID(id string) { n.ID = id }
+func (n *note) RecordOwner() string   { return n.Owner }
+func (n *note) Touch(now time.Time)   { n.UpdatedAt = now }
+
+func (n *note) RecordCreatedAt() time.Time { return n.CreatedAt }
+func (n *note) Stamp(owner string, now time.Time) {
+	n.Owner, n.CreatedAt, n.UpdatedAt = owner, now, now
+}
+
+func TestResource(t *testing.T) {
+	s := newTestStore(t)
+	h := handlers.New(s, service.NewChargebacks(s))
+	rs := handlers.NewResource(h, service.NewResource[note](s, service.Spec[note]{
+		Name: "notes",
+		Kind: "note",
+		Validate: func(n *note) error {
+			if n.Text == "" {
+				return &models.ValidationError{Fields: []models.FieldError{{Field: "text", Message: "must not be empty"}}}
+			}
+			return nil
+		},
+		Equal:  func(a, b *note) bool { return a.Text == b.Text },
+		Fields: []string{"text"},
+		Merge: func(mask models.FieldMask, dst, src *note) {
+			if mask.Has("text") {
+				dst.Text = src.Text
+			}
+		},
+	}))
+	if routes := rs.Routes(); len(routes) != 5 || routes[0].Pattern != "/notes" {
+		t.Fatalf("unexpected routes: %+v", routes)
+	}
+
+	mux := http.NewServeMux()
+	openapi.Mount(mux, rs.Routes())
+	do := func(method, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/notes/n-1", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := do(http.MethodGet, ""); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 before create, got %d", rec.Code)
+	}
+	if rec := do(http.MethodPost, `{"text":""}`); rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422 for an invalid note, got %d", rec.Code)
+	}
+	if rec := do(http.MethodPost, `{"text":"hi"}`); rec.Code != http.StatusCreated || rec.Header().Get(handlers.ReplayedHeader) != "false" {
+		t.Fatalf("expected 201, got %d %q: %s", rec.Code, rec.Header().Get(handlers.ReplayedHeader), rec.Body)
+	} else if loc := rec.Header().Get("Location"); loc != "/notes/n-1" {
+		t.Fatalf("expected Location /notes/n-1, got %q", loc)
+	} else if rec.Header().Get(handlers.FencingTokenHeader) == "" {
+		t.Fatalf("expected a fencing token for the write")
+	}
+	rec := do(http.MethodPost, `{"text":"hi"}`)
+	if rec.Code != http.StatusOK || rec.Header().Get(handlers.ReplayedHeader) != "true" || rec.Header().Get(handlers.FencingTokenHeader) != "" {
+		t.Fatalf("expected 200 without a fencing token on replay, got %d %q %q", rec.Code, rec.Header().Get(handlers.ReplayedHeader), rec.Header().Get(handlers.FencingTokenHeader))
+	}
+	if created := rec.Header().Get(handlers.OriginalCreatedAtHeader); !strings.Contains(rec.Body.String(), `"createdAt":"`+created+`"`) {
+		t.Fatalf("expected the replay to carry the original creation time, got %q: %s", created, rec.Body)
+	}
+	if rec := do(http.MethodPut, `{"text":"hi"}`); rec.Header().Get("X-Idempotency-Write") != "false" {
+		t.Fatalf("expected a skipped write, got %q", rec.Header().Get("X-Idempotency-Write"))
+	}
+	if rec := do(http.MethodPut, `{"text":"bye"}`); rec.Header().Get("X-Idempotency-Write") != "true" {
+		t.Fatalf("expected a write, got %q", rec.Header().Get("X-Idempotency-Write"))
+	}
+	if rec := do(http.MethodGet, ""); !strings.Contains(rec.Body.String(), `"text":"bye"`) {
+		t.Fatalf("expected the updated note, got %s", rec.Body)
+	}
+	for _, replayed := range []string{"false", "true"} {
+		if rec := do(http.MethodDelete, ""); rec.Code != http.StatusOK || rec.Header().Get(handlers.ReplayedHeader) != replayed {
+			t.Fatalf("expected 200 for delete with replayed %s, got %d %q", replayed, rec.Code, rec.Header().Get(handlers.ReplayedHeader))
+		}
+	}
+
+	h.Policy.DeleteStatus = http.StatusNoContent
+	do(http.MethodPost, `{"text":"hi"}`)
+	if rec := do(http.MethodDelete, ""); rec.Code != http.StatusNoContent || rec.Body.Len() != 0 || rec.Header().Get(handlers.ReplayedHeader) != "false" {
+		t.Fatalf("expected an empty 204 under the policy, got %d %q: %s", rec.Code, rec.Header().Get(handlers.ReplayedHeader), rec.Body)
+	}
+}
@@ -0,0 +1,697 @@
+package handlers
+
+import (
+	"net/http"
+	"slices"
+
+	"github.com/arkantrust/idempotency-example/backend/auth"
+	"github.com/arkantrust/idempotency-example/backend/jobs"
+	"github.com/arkantrust/idempotency-example/backend/models"
+	"github.com/arkantrust/idempotency-example/backend/openapi"
+	"github.com/arkantrust/idempotency-example/backend/store"
+)
+
+// Common responses shared by several routes.
+var (
+	badRequest = openapi.Response{Status: http.StatusBadRequest, Description: "Malformed request."}
+	serverErr  = openapi.Response{Status: http.StatusInternalServerError, Description: "Store failure."}
+	throttled  = openapi.Response{
+		Status:      http.StatusTooManyRequests,
+		Description: "Rate limit exceeded.",
+		Headers:     []string{"Retry-After", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset"},
+	}
+	unavailable = openapi.Response{
+		Status:      http.StatusServiceUnavailable,
+		Description: "Writes are disabled by the server's mode; retry later.",
+		Headers:     []string{"Retry-After"},
+	}
+	unauthorized  = openapi.Response{Status: http.StatusUnauthorized, Description: "Missing or invalid credentials."}
+	forbidden     = openapi.Response{Status: http.StatusForbidden, Description: "Credentials lack the required scope or are bound to another tenant."}
+	unprocessable = openapi.Response{
+		Status:      http.StatusUnprocessableEntity,
+		Description: "One or more fields are invalid, or a chargeback breaks the policy of GET /admin/rules, in which case the body lists violations rather than fields.",
+		Body:        validationErrorBody{},
+	}
+)
+
+// apiErrors are the error responses every authenticated API route can return.
+var apiErrors = []openapi.Response{unauthorized, forbidden, throttled, serverErr}
+
+func responses(rs ...openapi.Response) []openapi.Response {
+	return append(rs, apiErrors...)
+}
+
+var strictParam = openapi.Param{
+	Name:        StrictHeader,
+	In:          "header",
+	Description: `"true" rejects JSON bodies with unknown fields or duplicate keys.`,
+}
+
+var preferParam = openapi.Param{
+	Name:        PreferHeader,
+	In:          "header",
+	Description: `"duplicate=replay" or "duplicate=conflict" chooses 200 or 409 for a retry, overriding the server's policy.`,
+}
+
+var keyParam = openapi.Param{
+	Name:        IdempotencyKeyHeader,
+	In:          "header",
+	Description: "Client-generated key identifying this create operation. Retries must reuse it.",
+	Required:    true,
+}
+
+var reportParams = []openapi.Param{
+	{Name: "from", In: "query", Description: "First day to report, YYYY-MM-DD (UTC). Omitted means from the first chargeback."},
+	{Name: "to", In: "query", Description: "Last day to report, inclusive. Omitted means up to the last chargeback."},
+}
+
+var tenantParam = openapi.Param{
+	Name:        auth.HeaderTenant,
+	In:          "header",
+	Description: "Tenant to act on. IDs and idempotency keys are namespaced per tenant; omitted means the default tenant. Only callers whose credentials are bound to a tenant may name one, and only that one.",
+}
+
+// Routes returns the chargeback, bulk and admin routes served by h. main
+// registers exactly these routes and generates the OpenAPI document from
+// them, so the two cannot drift apart.
+func (h *Handler) Routes() []openapi.Route {
+	negotiated := mediaTypes()
+
+	routes := append(h.chargebacks.Routes(), []openapi.Route{
+		{
+			Method: "GET", Pattern: "/chargebacks/stats", Tag: "chargebacks", Access: openapi.Read,
+			Summary: "Summarise chargebacks",
+			Params: []openapi.Param{
+				{Name: "merchantId", In: "query", Description: "Only the chargebacks of this merchant."},
+				{Name: "convertTo", In: "query", Description: "Also total every currency in this one, at the latest cached exchange rates."},
+			},
+			MediaTypes: negotiated,
+			Responses: responses(
+				openapi.Response{Status: http.StatusOK, Description: "Count and summed amount per currency for the caller's tenant.", Body: models.Stats{}},
+				openapi.Response{Status: http.StatusBadRequest, Description: "convertTo is not a currency code."},
+				openapi.Response{Status: http.StatusNotAcceptable, Description: "No acceptable media type."},
+				openapi.Response{Status: http.StatusServiceUnavailable, Description: "No exchange rate is cached for a currency to convert."},
+			),
+			Handler: h.Stats,
+		},
+		{
+			Method: "GET", Pattern: "/chargebacks/archive", Tag: "chargebacks", Access: openapi.Read,
+			Summary:   "List archived chargebacks",
+			Sheddable: true,
+			Description: "Chargebacks the retention job moved out of the active list, in order of creation. " +
+				"They are read only; their IDs and idempotency keys still replay them.",
+			Params: []openapi.Param{
+				{Name: "createdAfter", In: "query", Description: "Only chargebacks created strictly after this date or RFC 3339 time."},
+				{Name: "createdBefore", In: "query", Description: "Only chargebacks created strictly before this date or RFC 3339 time."},
+			},
+			MediaTypes: negotiated,
+			Responses: responses(
+				openapi.Response{Status: http.StatusOK, Description: "The archived chargebacks visible to the caller.", Body: []models.Chargeback{}},
+				openapi.Response{Status: http.StatusBadRequest, Description: "Invalid createdAfter or createdBefore."},
+				openapi.Response{Status: http.StatusNotAcceptable, Description: "No acceptable media type."},
+			),
+			Handler: h.Archive,
+		},
+		{
+			Method: "POST", Pattern: "/chargebacks/{id}/erase", Tag: "chargebacks", Access: openapi.Write,
+			Idempotency: openapi.Idempotent,
+			Summary:     "Erase a chargeback's personal data",
+			Description: "Clears the fields that may hold personal data (the reason) and saves a proof: " +
+				"the SHA-256 of the ID and the erased values, and the time. Repeating the erase returns the first proof.",
+			Params:     []openapi.Param{{Name: "id", In: "path", Description: "Chargeback ID."}},
+			MediaTypes: negotiated,
+			Responses: responses(
+				openapi.Response{Status: http.StatusCreated, Description: "Erased.", Body: models.Erasure{}, Headers: []string{ReplayedHeader}},
+				openapi.Response{Status: http.StatusOK, Description: "Replay: the proof of the first erase.", Body: models.Erasure{}, Headers: replayHeaders},
+				openapi.Response{Status: http.StatusNotFound, Description: "No chargeback with this ID, and no proof of erasing one."},
+				openapi.Response{Status: http.StatusNotAcceptable, Description: "No acceptable media type."},
+			),
+			Handler: h.Erase,
+		},
+		{
+			Method: "POST", Pattern: "/chargebacks/{id}/evidence", Tag: "chargebacks", Access: openapi.Write,
+			Idempotency: openapi.Idempotent,
+			Summary:     "Attach an evidence document",
+			Description: "A multipart/form-data upload with the document in its \"file\" field. Documents are " +
+				"addressed by their SHA-256, so uploading the same file again attaches nothing new and answers 200.",
+			Params:     []openapi.Param{{Name: "id", In: "path", Description: "Chargeback ID."}},
+			MediaTypes: []string{"multipart/form-data"},
+			Responses: responses(
+				openapi.Response{Status: http.StatusCreated, Description: "Attached.", Body: models.Evidence{}, MediaTypes: []string{"application/json"}, Headers: []string{ReplayedHeader}},
+				openapi.Response{Status: http.StatusOK, Description: "Replay: the document was already attached.", Body: models.Evidence{}, MediaTypes: []string{"application/json"}, Headers: replayHeaders},
+				badRequest,
+				openapi.Response{Status: http.StatusNotFound, Description: "No chargeback with this ID."},
+				openapi.Response{Status: http.StatusRequestEntityTooLarge, Description: "The document exceeds the upload limit."},
+			),
+			Handler: h.AddEvidence,
+		},
+		{
+			Method: "GET", Pattern: "/chargebacks/{id}/evidence", Tag: "chargebacks", Access: openapi.Read,
+			Summary: "List evidence documents",
+			Params:  []openapi.Param{{Name: "id", In: "path", Description: "Chargeback ID."}},
+			Responses: responses(
+				openapi.Response{Status: http.StatusOK, Description: "The documents attached to the chargeback.", Body: []models.Evidence{}},
+				openapi.Response{Status: http.StatusNotFound, Description: "No chargeback with this ID."},
+			),
+			Handler: h.ListEvidence,
+		},
+		{
+			Method: "GET", Pattern: "/chargebacks/{id}/evidence/{sha256}", Tag: "chargebacks", Access: openapi.Read,
+			Summary:     "Download an evidence document",
+			Description: "The document as uploaded. Its ETag is its SHA-256; byte ranges are supported.",
+			Params: []openapi.Param{
+				{Name: "id", In: "path", Description: "Chargeback ID."},
+				{Name: "sha256", In: "path", Description: "Hex SHA-256 of the document."},
+			},
+			MediaTypes: []string{"application/octet-stream"},
+			Responses: responses(
+				openapi.Response{Status: http.StatusOK, Description: "The document, with the content type it was uploaded with."},
+				openapi.Response{Status: http.StatusNotFound, Description: "No such chargeback or document."},
+			),
+			Handler: h.Evidence,
+		},
+		{
+			Method: "DELETE", Pattern: "/chargebacks/{id}/evidence/{sha256}", Tag: "chargebacks", Access: openapi.Write,
+			Summary: "Detach an evidence document",
+			Description: "Succeeds whether or not the document was attached. Its contents are dropped with the " +
+				"last chargeback holding them.",
+			Params: []openapi.Param{
+				{Name: "id", In: "path", Description: "Chargeback ID."},
+				{Name: "sha256", In: "path", Description: "Hex SHA-256 of the document."},
+			},
+			Responses: responses(append(h.Policy.deletedResponse(deletedOne{}),
+				openapi.Response{Status: http.StatusNotFound, Description: "No chargeback with this ID."},
+			)...),
+			Handler: h.DeleteEvidence,
+		},
+		{
+			Method: "POST", Pattern: "/chargebacks/{id}/refunds/{refundId}", Tag: "chargebacks", Access: openapi.Write,
+			Idempotency: openapi.KeyedByID,
+			Summary:     "Refund a chargeback",
+			Description: "Idempotent create: the refund ID is the idempotency key. The first request creates the refund " +
+				"and returns 201; retries return the stored refund with 200, or 422 if the amount differs. The refunds " +
+				"of a chargeback add up to at most its amount. GET /chargebacks/{id}?expand=refunds includes them.",
+			Params: []openapi.Param{
+				{Name: "id", In: "path", Description: "Chargeback ID."},
+				{Name: "refundId", In: "path", Description: "Client-generated refund ID, unique within the chargeback."},
+				preferParam,
+			},
+			Body:       models.Refund{},
+			MediaTypes: negotiated,
+			Responses: responses(
+				openapi.Response{Status: http.StatusCreated, Description: "Created.", Body: models.Refund{}, Headers: []string{"Location", ReplayedHeader}},
+				openapi.Response{Status: http.StatusOK, Description: "Replay: the refund already existed and is returned unchanged.", Body: models.Refund{}, Headers: replayHeaders},
+				badRequest,
+				unprocessable,
+				openapi.Response{Status: http.StatusNotFound, Description: "No chargeback with this ID."},
+				openapi.Response{Status: http.StatusConflict, Description: "The refund would exceed the chargeback amount, or, under the conflict duplicate policy, a retry: Location names the refund.", Body: duplicateBody{}},
+			),
+			Handler: h.CreateRefund,
+		},
+		{
+			Method: "GET", Pattern: "/chargebacks/{id}/refunds", Tag: "chargebacks", Access: openapi.Read,
+			Summary:    "List a chargeback's refunds",
+			Params:     []openapi.Param{{Name: "id", In: "path", Description: "Chargeback ID."}},
+			MediaTypes: negotiated,
+			Responses: responses(
+				openapi.Response{Status: http.StatusOK, Description: "The refunds of the chargeback, in order of their IDs.", Body: []models.Refund{}},
+				openapi.Response{Status: http.StatusNotFound, Description: "No chargeback with this ID."},
+				openapi.Response{Status: http.StatusNotAcceptable, Description: "No acceptable media type."},
+			),
+			Handler: h.Refunds,
+		},
+		{
+			Method: "GET", Pattern: "/reports/daily", Tag: "reports", Access: openapi.Read,
+			Summary: "Report chargebacks per day",
+			Description: "Count and summed amount per currency of the chargebacks created on each UTC day, " +
+				"for the caller's tenant. Days without chargebacks are left out.",
+			Params:     reportParams,
+			MediaTypes: negotiated,
+			Responses: responses(
+				openapi.Response{Status: http.StatusOK, Description: "One entry per day, in order.", Body: models.Report{}},
+				badRequest,
+				openapi.Response{Status: http.StatusNotAcceptable, Description: "No acceptable media type."},
+			),
+			Handler: h.DailyReport,
+		},
+		{
+			Method: "GET", Pattern: "/reports/weekly", Tag: "reports", Access: openapi.Read,
+			Summary:     "Report chargebacks per week",
+			Description: "The daily report merged into ISO weeks, Monday to Sunday.",
+			Params:      reportParams,
+			MediaTypes:  negotiated,
+			Responses: responses(
+				openapi.Response{Status: http.StatusOK, Description: "One entry per week, starting on its Monday, in order.", Body: models.Report{}},
+				badRequest,
+				openapi.Response{Status: http.StatusNotAcceptable, Description: "No acceptable media type."},
+			),
+			Handler: h.WeeklyReport,
+		},
+		{
+			Method: "POST", Pattern: "/chargebacks", Tag: "chargebacks", Access: openapi.Write,
+			Idempotency: openapi.KeyedByHeader,
+			Summary:     "Create a chargeback with a server-generated ID",
+			Description: "Idempotent create keyed on the Idempotency-Key header. The server mints a ULID for " +
+				"the record; retries with the same key and payload return that record with 200, or 409 " +
+				"under the conflict duplicate policy.",
+			Params:     []openapi.Param{keyParam, strictParam, preferParam},
+			Body:       models.Chargeback{},
+			MediaTypes: negotiated,
+			Responses: responses(
+				openapi.Response{Status: http.StatusCreated, Description: "Created.", Body: models.Chargeback{}, Headers: []string{"Location", ETagHeader, ReplayedHeader}},
+				openapi.Response{Status: http.StatusOK, Description: "Replay: the record created by the first request with this key.", Body: models.Chargeback{}, Headers: append([]string{"Location", ETagHeader}, replayHeaders...)},
+				badRequest,
+				unprocessable,
+				openapi.Response{Status: http.StatusConflict, Description: "Under the conflict duplicate policy, a retry: Location names the record.", Body: duplicateBody{}, Headers: append([]string{"Location", PreferenceAppliedHeader}, replayHeaders...)},
+				openapi.Response{Status: http.StatusNotFound, Description: "The record created with this key has been deleted."},
+				openapi.Response{Status: http.StatusRequestEntityTooLarge, Description: "Body exceeds the size limit."},
+				openapi.Response{Status: http.StatusUnsupportedMediaType, Description: "Unsupported Content-Type."},
+			),
+			Handler: acceptable(h.createWithKey),
+		},
+		{
+			Method: "DELETE", Pattern: "/chargebacks", Tag: "chargebacks", Access: openapi.Write,
+			Summary:     "Delete chargebacks matching a filter",
+			Description: "At least one filter is required. A retry finds nothing left to delete and returns a count of zero.",
+			Params: []openapi.Param{
+				{Name: "currency", In: "query", Description: "ISO 4217 currency code."},
+				{Name: "before", In: "query", Description: "Delete records created before this date (YYYY-MM-DD) or RFC 3339 time."},
+			},
+			MediaTypes: negotiated,
+			Responses: responses(
+				openapi.Response{Status: http.StatusOK, Description: "Number of records deleted.", Body: deletedMany{}, Headers: []string{ReplayedHeader}},
+				badRequest,
+			),
+			Handler: acceptable(h.deleteMany),
+		},
+		{
+			Method: "POST", Pattern: "/import", Tag: "bulk", Access: openapi.Write,
+			Idempotency: openapi.Idempotent,
+			Summary:     "Import chargebacks from NDJSON",
+			Description: "One chargeback per line, each with its own id. Existing IDs are skipped, " +
+				"so re-running an import is a no-op.",
+			Body:       models.Chargeback{},
+			MediaTypes: []string{"application/x-ndjson"},
+			Responses: responses(
+				openapi.Response{Status: http.StatusOK, Description: "Import summary.", Body: importSummary{}, MediaTypes: []string{"application/json"}},
+				badRequest,
+			),
+			Handler: h.Import,
+		},
+		{
+			Method: "GET", Pattern: "/export", Tag: "bulk", Access: openapi.Read,
+			Summary:   "Export chargebacks as NDJSON or CSV",
+			Sheddable: true,
+			Params: []openapi.Param{
+				{Name: "format", In: "query", Description: `"ndjson" (default) or "csv".`},
+			},
+			MediaTypes: []string{"application/x-ndjson", "text/csv"},
+			Responses: responses(
+				openapi.Response{Status: http.StatusOK, Description: "One chargeback per line.", Body: models.Chargeback{}},
+				badRequest,
+			),
+			Handler: h.Export,
+		},
+		{
+			Method: "GET", Pattern: "/webhooks/{id}/deliveries", Tag: "webhooks", Access: openapi.Read,
+			Summary: "List the delivery attempts of an event",
+			Description: "Every attempt at delivering the webhook event to every URL, oldest first, with the " +
+				"receiver's status code, the start of its answer and how long it took, for finding out why an " +
+				"event did not arrive. Empty until the first attempt.",
+			Params: []openapi.Param{{Name: "id", In: "path", Description: "Event ID, the Webhook-Id of its deliveries."}},
+			Responses: responses(
+				openapi.Response{Status: http.StatusOK, Description: "The attempts.", Body: []models.WebhookDelivery{}},
+			),
+			Handler: h.WebhookDeliveries,
+		},
+		{
+			Method: "GET", Pattern: "/admin/backup", Tag: "admin", Access: openapi.Admin,
+			Summary: "Download a consistent database snapshot",
+			Responses: []openapi.Response{
+				{Status: http.StatusOK, Description: "BoltDB file.", Body: []byte{}, MediaTypes: []string{"application/octet-stream"}},
+				unauthorized,
+			},
+			Handler: h.Backup,
+		},
+		{
+			Method: "POST", Pattern: "/admin/compact", Tag: "admin", Access: openapi.Admin,
+			Idempotency: openapi.Idempotent,
+			Summary:     "Compact the database file",
+			Responses: []openapi.Response{
+				{Status: http.StatusOK, Description: "File size before and after, in bytes.", Body: store.CompactStats{}},
+				unauthorized, serverErr,
+			},
+			Handler: h.Compact,
+		},
+		{
+			Method: "POST", Pattern: "/admin/reencode", Tag: "admin", Access: openapi.Admin,
+			Idempotency: openapi.Idempotent,
+			Summary:     "Rewrite records in the configured encoding and schema version",
+			Responses: []openapi.Response{
+				{Status: http.StatusOK, Description: "Records scanned and rewritten.", Body: store.ReencodeStats{}},
+				unauthorized, serverErr,
+			},
+			Handler: h.Reencode,
+		},
+		{
+			Method: "GET", Pattern: "/admin/rules", Tag: "admin", Access: openapi.Admin,
+			Summary: "Show the rules chargebacks are held to",
+			Description: "The amount caps per currency, disallowed reasons and merchant velocity limit loaded from the " +
+				"configuration. Creates and updates breaking a rule are refused with 422 listing the violations.",
+			Responses: []openapi.Response{
+				{Status: http.StatusOK, Description: "The active rules.", Body: models.Policy{}},
+				unauthorized,
+			},
+			Handler: h.Rules,
+		},
+		{
+			Method: "GET", Pattern: "/admin/verify", Tag: "admin", Access: openapi.Admin,
+			Summary: "Check every stored record for corruption",
+			Responses: []openapi.Response{
+				{Status: http.StatusOK, Description: "Records checked and the damage found, if any.", Body: store.VerifyReport{}},
+				unauthorized, serverErr,
+			},
+			Handler: h.Verify,
+		},
+		{
+			Method: "GET", Pattern: "/admin/mode", Tag: "admin", Access: openapi.Admin,
+			Summary: "Show which writes the server accepts",
+			Responses: []openapi.Response{
+				{Status: http.StatusOK, Description: "The current mode.", Body: modeBody{}},
+				unauthorized,
+			},
+			Handler: h.Mode,
+		},
+		{
+			Method: "PUT", Pattern: "/admin/mode", Tag: "admin", Access: openapi.Admin,
+			Summary: "Switch between read-write, maintenance and read-only mode",
+			Description: "Maintenance mode refuses writes to the data with 503 but still serves reads, " +
+				"compaction and re-encoding; read-only mode also reopens the database file read-only. " +
+				"Returns once in-flight writes have finished.",
+			Body: modeBody{},
+			Responses: []openapi.Response{
+				{Status: http.StatusOK, Description: "The new mode.", Body: modeBody{}},
+				badRequest, unauthorized, serverErr,
+			},
+			Handler: h.SetMode,
+		},
+		{
+			Method: "GET", Pattern: "/admin/idempotency-keys", Tag: "admin", Access: openapi.Admin,
+			Summary: "Inspect stored idempotency keys",
+			Description: "Lists the keys of one tenant for every client: keys sent with POST /chargebacks " +
+				"map to the record they created, keys of gRPC and GraphQL calls to a saved response.",
+			Params: []openapi.Param{
+				{Name: "tenant", In: "query", Description: "Tenant to inspect; omitted means the default tenant."},
+				{Name: "prefix", In: "query", Description: "Only list keys starting with this prefix."},
+				{Name: "operation", In: "query", Description: "Only list keys of this operation: create, a gRPC method or graphql:<mutation>."},
+				{Name: "createdAfter", In: "query", Description: "Only keys first used strictly after this date or RFC 3339 time."},
+				{Name: "createdBefore", In: "query", Description: "Only keys first used strictly before this date or RFC 3339 time."},
+				{Name: "limit", In: "query", Description: "Page size, 1 to 1000; default 100."},
+				{Name: "cursor", In: "query", Description: "The X-Next-Cursor of the previous page."},
+			},
+			Responses: []openapi.Response{
+				{Status: http.StatusOK, Description: "Key metadata. X-Next-Cursor is set when more keys follow.", Body: []store.KeyInfo{}},
+				badRequest, unauthorized, serverErr,
+			},
+			Handler: h.IdempotencyKeys,
+		},
+		{
+			Method: "DELETE", Pattern: "/admin/idempotency-keys/{key}", Tag: "admin", Access: openapi.Admin,
+			Summary: "Force-expire an idempotency key",
+			Description: "Deletes the key so that the next request sent with it is processed anew instead of " +
+				"replayed. Records the key created are kept.",
+			Params: []openapi.Param{
+				{Name: "key", In: "path", Description: "The idempotency key."},
+				{Name: "tenant", In: "query", Description: "Tenant of the key; omitted means the default tenant."},
+				{Name: "owner", In: "query", Description: "Client that used the key; omitted expires it for every client."},
+				{Name: "operation", In: "query", Description: "Operation the key was sent to; omitted expires it for every operation."},
+			},
+			Responses: []openapi.Response{
+				{Status: http.StatusOK, Description: "The number of entries deleted.", Body: expiredKeyBody{}},
+				badRequest, unauthorized,
+				{Status: http.StatusNotFound, Description: "Nothing is stored under this key."},
+				unavailable, serverErr,
+			},
+			Handler: h.ExpireIdempotencyKey,
+		},
+		{
+			Method: "GET", Pattern: "/admin/jobs", Tag: "admin", Access: openapi.Admin,
+			Summary: "List background jobs",
+			Description: "Webhook deliveries, backups and archival runs, oldest first, with their attempts " +
+				"and the error of the last failed one.",
+			Params: []openapi.Param{
+				{Name: "status", In: "query", Description: "Only jobs in this status: pending, running, succeeded or failed."},
+				{Name: "kind", In: "query", Description: "Only jobs of this kind, e.g. webhook, backup or archive."},
+				{Name: "limit", In: "query", Description: "Page size, 1 to 1000; default 100."},
+				{Name: "cursor", In: "query", Description: "The X-Next-Cursor of the previous page."},
+			},
+			Responses: []openapi.Response{
+				{Status: http.StatusOK, Description: "The jobs. X-Next-Cursor is set when more follow.", Body: []models.Job{}},
+				badRequest, unauthorized, serverErr,
+			},
+			Handler: h.Jobs,
+		},
+		{
+			Method: "GET", Pattern: "/admin/jobs/{id}", Tag: "admin", Access: openapi.Admin,
+			Summary: "Get a background job",
+			Params:  []openapi.Param{{Name: "id", In: "path", Description: "Job ID."}},
+			Responses: []openapi.Response{
+				{Status: http.StatusOK, Description: "The job.", Body: models.Job{}},
+				{Status: http.StatusNotFound, Description: "No job with this ID."},
+				unauthorized, serverErr,
+			},
+			Handler: h.Job,
+		},
+		{
+			Method: "GET", Pattern: "/admin/dead-letters", Tag: "admin", Access: openapi.Admin,
+			Summary: "List dead letters",
+			Description: "Jobs that gave up and left the queue – webhook deliveries whose URL kept failing – " +
+				"oldest first, with the history of their failures.",
+			Params: []openapi.Param{
+				{Name: "kind", In: "query", Description: "Only jobs of this kind, e.g. webhook."},
+				{Name: "limit", In: "query", Description: "Page size, 1 to 1000; default 100."},
+				{Name: "cursor", In: "query", Description: "The X-Next-Cursor of the previous page."},
+			},
+			Responses: []openapi.Response{
+				{Status: http.StatusOK, Description: "The dead letters. X-Next-Cursor is set when more follow.", Body: []models.Job{}},
+				badRequest, unauthorized, serverErr,
+			},
+			Handler: h.DeadLetters,
+		},
+		{
+			Method: "GET", Pattern: "/admin/dead-letters/{id}", Tag: "admin", Access: openapi.Admin,
+			Summary: "Get a dead letter",
+			Params:  []openapi.Param{{Name: "id", In: "path", Description: "ID of the job."}},
+			Responses: []openapi.Response{
+				{Status: http.StatusOK, Description: "The dead letter.", Body: models.Job{}},
+				{Status: http.StatusNotFound, Description: "No dead letter with this ID."},
+				unauthorized, serverErr,
+			},
+			Handler: h.DeadLetter,
+		},
+		{
+			Method: "POST", Pattern: "/admin/dead-letters/{id}/requeue", Tag: "admin", Access: openapi.Admin,
+			Idempotency: openapi.Idempotent,
+			Summary:     "Requeue a dead letter",
+			Description: "Moves the job back into the queue with its attempts reset. A webhook delivery is " +
+				"sent again with the same Webhook-Id, so requeueing one that did arrive is harmless.",
+			Params: []openapi.Param{{Name: "id", In: "path", Description: "ID of the job."}},
+			Responses: []openapi.Response{
+				{Status: http.StatusOK, Description: "The requeued job.", Body: models.Job{}},
+				{Status: http.StatusNotFound, Description: "No dead letter with this ID, or it was already requeued."},
+				unauthorized, unavailable, serverErr,
+			},
+			Handler: h.RequeueDeadLetter,
+		},
+		{
+			Method: "GET", Pattern: "/admin/schedules", Tag: "admin", Access: openapi.Admin,
+			Summary: "List scheduled tasks",
+			Description: "The periodic tasks – key sweeps, compaction checks, backups, archival – with their " +
+				"cron expression, when each last enqueued a job, that job, and when it runs next.",
+			Responses: []openapi.Response{
+				{Status: http.StatusOK, Description: "The scheduled tasks, by name.", Body: []jobs.ScheduleStatus{}},
+				unauthorized, serverErr,
+			},
+			Handler: h.Schedules,
+		},
+		{
+			Method: "POST", Pattern: "/admin/reconciliations", Tag: "admin", Access: openapi.Admin,
+			Idempotency: openapi.Idempotent,
+			Summary:     "Reconcile a settlement file",
+			Description: "Compares a processor's settlement CSV (columns id, amount, currency) with the stored " +
+				"chargebacks of one tenant. Idempotent: the report ID is derived from the tenant and the file, " +
+				"and running the same file again returns the first report.",
+			Params: []openapi.Param{
+				{Name: "tenant", In: "query", Description: "Tenant to reconcile; omitted means the default tenant."},
+			},
+			Body:       "",
+			MediaTypes: []string{"text/csv"},
+			Responses: []openapi.Response{
+				{Status: http.StatusCreated, Description: "The report.", Body: models.Reconciliation{}, MediaTypes: []string{"application/json"}, Headers: []string{"Location", ReplayedHeader}},
+				{Status: http.StatusOK, Description: "Replay: the report of the first run of this file.", Body: models.Reconciliation{}, MediaTypes: []string{"application/json"}, Headers: append([]string{"Location"}, replayHeaders...)},
+				{Status: http.StatusBadRequest, Description: "Malformed settlement file or tenant."},
+				{Status: http.StatusRequestEntityTooLarge, Description: "Settlement file exceeds the size limit."},
+				unauthorized, serverErr, unavailable,
+			},
+			Handler: h.Reconcile,
+		},
+		{
+			Method: "GET", Pattern: "/admin/reconciliations/{id}", Tag: "admin", Access: openapi.Admin,
+			Summary: "Get a reconciliation report",
+			Params: []openapi.Param{
+				{Name: "id", In: "path", Description: "Report ID."},
+				{Name: "tenant", In: "query", Description: "Tenant reconciled; omitted means the default tenant."},
+			},
+			Responses: []openapi.Response{
+				{Status: http.StatusOK, Description: "The report.", Body: models.Reconciliation{}},
+				{Status: http.StatusNotFound, Description: "No report with this ID."},
+				badRequest, unauthorized, serverErr,
+			},
+			Handler: h.Reconciliation,
+		},
+		{
+			Method: "GET", Pattern: "/admin/keys", Tag: "admin", Access: openapi.Admin,
+			Summary: "List API keys",
+			Responses: []openapi.Response{
+				{Status: http.StatusOK, Description: "Key metadata; secrets are never returned.", Body: []models.APIKey{}},
+				unauthorized, serverErr,
+			},
+			Handler: h.ListKeys,
+		},
+		{
+			Method: "POST", Pattern: "/admin/keys", Tag: "admin", Access: openapi.Admin,
+			Summary:     "Mint an API key",
+			Description: "The plaintext key is returned once and cannot be retrieved later.",
+			Body:        createKeyRequest{},
+			Responses: []openapi.Response{
+				{Status: http.StatusCreated, Description: "The new key.", Body: createKeyResponse{}},
+				badRequest, unauthorized, serverErr,
+			},
+			Handler: h.CreateKey,
+		},
+		{
+			Method: "DELETE", Pattern: "/admin/keys/{id}", Tag: "admin", Access: openapi.Admin,
+			Summary:     "Revoke an API key",
+			Description: "Idempotent: revoking a revoked key returns the original revocation.",
+			Params:      []openapi.Param{{Name: "id", In: "path", Description: "API key ID."}},
+			Responses: []openapi.Response{
+				{Status: http.StatusOK, Description: "The revoked key.", Body: models.APIKey{}},
+				{Status: http.StatusNotFound, Description: "No key with this ID."},
+				unauthorized, serverErr,
+			},
+			Handler: h.RevokeKey,
+		},
+		{
+			Method: "GET", Pattern: "/admin/usage", Tag: "admin", Access: openapi.Admin,
+			Summary: "Report usage per client",
+			Description: "The requests and writes of every authenticated client, API keys and JWT subjects alike, " +
+				"in one UTC day or month, counted while usage tracking or quotas are enabled. Days are kept for 90 days.",
+			Params: []openapi.Param{
+				{Name: "period", In: "query", Description: "A day (YYYY-MM-DD) or month (YYYY-MM); omitted means the current month."},
+			},
+			Responses: []openapi.Response{
+				{Status: http.StatusOK, Description: "Usage, by client.", Body: []models.Usage{}},
+				badRequest, unauthorized, serverErr,
+			},
+			Handler: h.Usage,
+		},
+	}...)
+	// Charges and merchants never change, so only their create and reads
+	// are served.
+	for _, rt := range append(h.charges.Routes(), h.merchants.Routes()...) {
+		if rt.Method == http.MethodGet || rt.Method == http.MethodPost {
+			routes = append(routes, rt)
+		}
+	}
+	if h.Async != nil {
+		routes = h.asyncRoutes(routes)
+	}
+	routes = versioned(routes)
+
+	// Every API route acts on a tenant and needs the scope of its access,
+	// writes can be refused by the server's mode, and those that succeed
+	// report their fencing token. Admin routes refuse credentials without
+	// the admin role.
+	for i, rt := range routes {
+		if rt.Access == openapi.Read || rt.Access == openapi.Write {
+			routes[i].Params = append(rt.Params, tenantParam)
+		}
+		if rt.Access == openapi.Admin {
+			routes[i].Responses = append(rt.Responses, forbidden)
+		}
+		if rt.Scopes == nil {
+			switch rt.Access {
+			case openapi.Read:
+				routes[i].Scopes = []string{auth.ScopeRead}
+			case openapi.Write:
+				routes[i].Scopes = []string{auth.ScopeWrite}
+			}
+		}
+		if rt.Access == openapi.Write {
+			for j, resp := range rt.Responses {
+				if resp.Status < http.StatusMultipleChoices {
+					rt.Responses[j].Headers = append(slices.Clip(resp.Headers), FencingTokenHeader)
+				}
+			}
+			routes[i].Responses = append(rt.Responses, unavailable)
+		}
+		if rt.Access == openapi.Write && h.StrictKeys != nil && !streamed(rt) {
+			routes[i] = strictRoute(h, routes[i])
+		}
+	}
+	return routes
+}
+
+// streamed reports whether rt takes a request body too large to buffer,
+// which strict idempotency would: an NDJSON import or a file upload. Both are
+// idempotent without a key.
+func streamed(rt openapi.Route) bool {
+	return slices.Contains(rt.MediaTypes, "application/x-ndjson") || slices.Contains(rt.MediaTypes, "multipart/form-data")
+}
+
+// strictRoute wraps rt, a write route, with strict idempotency and documents
+// what that adds.
+func strictRoute(h *Handler, rt openapi.Route) openapi.Route {
+	rt.Handler = h.idempotent("http:"+rt.Method+" "+rt.Pattern, rt.Handler)
+	rt.Idempotency = openapi.KeyedByHeader
+	if !slices.ContainsFunc(rt.Params, func(p openapi.Param) bool { return p.Name == IdempotencyKeyHeader }) {
+		rt.Params = append(rt.Params, openapi.Param{
+			Name:        IdempotencyKeyHeader,
+			In:          "header",
+			Description: "Client-generated key identifying this request. Retries must reuse it and get the first response back.",
+			Required:    true,
+		})
+	}
+	for _, resp := range []openapi.Response{
+		{Status: http.StatusBadRequest, Description: "Missing " + IdempotencyKeyHeader + " header."},
+		{Status: http.StatusConflict, Description: "A request with this " + IdempotencyKeyHeader + " is still being processed; retry later."},
+		{Status: http.StatusUnprocessableEntity, Description: "The " + IdempotencyKeyHeader + " was already used with a different request."},
+	} {
+		// Keep the route's own description of a status it already returns.
+		if !slices.ContainsFunc(rt.Responses, func(r openapi.Response) bool { return r.Status == resp.Status }) {
+			rt.Responses = append(slices.Clip(rt.Responses), resp)
+		}
+	}
+	return rt
+}
+
+// Routes returns the liveness and readiness routes.
+func (p *Probes) Routes() []openapi.Route {
+	return []openapi.Route{
+		{
+			Method: "GET", Pattern: "/healthz", Tag: "health",
+			Summary:   "Liveness probe",
+			Responses: []openapi.Response{{Status: http.StatusOK, Description: "The process is serving HTTP.", Body: probeStatus{}}},
+			Handler:   p.Healthz,
+		},
+		{
+			Method: "GET", Pattern: "/readyz", Tag: "health",
+			Summary: "Readiness probe",
+			Responses: []openapi.Response{
+				{Status: http.StatusOK, Description: "The store is reachable.", Body: probeStatus{}},
+				{Status: http.StatusServiceUnavailable, Description: "The store is unreachable or the server is draining.", Body: probeStatus{}},
+			},
+			Handler: p.Readyz,
+		},
+	}
+}
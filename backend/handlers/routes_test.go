@@ -0,0 +1,37 @@
+package handlers_test
+
+import (
+	"testing"
+
+	"github.com/arkantrust/idempotency-example/backend/auth"
+	"github.com/arkantrust/idempotency-example/backend/openapi"
+	"github.com/arkantrust/idempotency-example/backend/service"
+)
+
+func TestRouteMetadata(t *testing.T) {
+	h := newTestHandler(t)
+	for _, rt := range h.Routes() {
+		name := rt.Method + " " + rt.Pattern
+		switch rt.Access {
+		case openapi.Read:
+			if len(rt.Scopes) != 1 || rt.Scopes[0] != auth.ScopeRead {
+				t.Errorf("%s: expected the read scope, got %v", name, rt.Scopes)
+			}
+		case openapi.Write:
+			if len(rt.Scopes) != 1 || rt.Scopes[0] != auth.ScopeWrite {
+				t.Errorf("%s: expected the write scope, got %v", name, rt.Scopes)
+			}
+			// Every API write is safe to retry; see the package comment.
+			if rt.Semantics() == openapi.NotIdempotent {
+				t.Errorf("%s: expected an idempotent write", name)
+			}
+		}
+	}
+
+	h.StrictKeys = service.NewDedup(newTestStore(t))
+	for _, rt := range h.Routes() {
+		if rt.Method+" "+rt.Pattern == "PUT /chargebacks/{id}" && rt.Semantics() != openapi.KeyedByHeader {
+			t.Errorf("expected strict idempotency to key updates by header, got %q", rt.Semantics())
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/arkantrust/idempotency-example/backend/handlers"
+	"github.com/arkantrust/idempotency-example/backend/models"
+	"github.com/arkantrust/idempotency-example/backend/service"
+)
+
+func TestPolicyViolationsAnswer422(t *testing.T) {
+	s := newTestStore(t)
+	s.SetPolicy(&models.Policy{
+		MaxAmounts:        []models.AmountLimit{{Currency: "USD", Max: 1000}},
+		DisallowedReasons: []string{},
+	})
+	h := handlers.New(s, service.NewChargebacks(s))
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return rec
+	}
+
+	rec := do(http.MethodPost, "/chargebacks/cb-1", `{"amount":1500,"currency":"USD","reason":"fraud"}`)
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422, got %d: %s", rec.Code, rec.Body)
+	}
+	var body struct {
+		Error      string                   `json:"error"`
+		Violations []models.PolicyViolation `json:"violations"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(body.Violations) != 1 || body.Violations[0].Rule != models.RuleMaxAmount || body.Violations[0].Field != "amount" {
+		t.Fatalf("expected the amount cap broken, got %+v", body)
+	}
+
+	rec = do(http.MethodGet, "/admin/rules", "")
+	var p models.Policy
+	if err := json.Unmarshal(rec.Body.Bytes(), &p); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("rules: %d %s", rec.Code, rec.Body)
+	}
+	if len(p.MaxAmounts) != 1 || p.MaxAmounts[0].Max != 1000 {
+		t.Fatalf("expected the active rules, got %+v", p)
+	}
+}
@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// StrictHeader lets a client opt in to strict decoding for one request by
+// sending "X-Strict-JSON: true". Operators can make it the default with
+// Handler.StrictJSON.
+const StrictHeader = "X-Strict-JSON"
+
+// strictError reports why a body was rejected by strict decoding. Unlike
+// ordinary syntax errors its message is returned to the client, because the
+// whole point of strict mode is to tell the client which field it got wrong.
+type strictError struct{ msg string }
+
+func (e strictError) Error() string { return e.msg }
+
+// decodeStrict decodes a JSON body like json.Unmarshal but rejects unknown
+// fields and duplicate keys. Lenient decoding silently drops a misspelt
+// "ammount" and persists a zero amount, and keeps only the last of two
+// "amount" keys, which other parsers may resolve differently.
+func decodeStrict(data []byte, v any) error {
+	if err := checkDepth(data); err != nil {
+		return err
+	}
+	if err := checkDuplicateKeys(data); err != nil {
+		return err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		if msg, ok := unknownField(err); ok {
+			return strictError{msg}
+		}
+		return err
+	}
+	if _, err := dec.Token(); !errors.Is(err, io.EOF) {
+		return strictError{"unexpected data after the JSON value"}
+	}
+	return nil
+}
+
+// unknownField extracts the message of the error DisallowUnknownFields
+// produces. encoding/json does not export a type for it.
+func unknownField(err error) (string, bool) {
+	if rest, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+		return "unknown field " + rest, true
+	}
+	return "", false
+}
+
+// checkDuplicateKeys walks data token by token and returns a strictError for
+// the first object that repeats a key.
+func checkDuplicateKeys(data []byte) error {
+	type frame struct {
+		keys      map[string]bool // nil for arrays
+		expectKey bool
+	}
+	var stack []*frame
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	for {
+		tok, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			// Leave syntax errors to the real decode.
+			return nil
+		}
+
+		var top *frame
+		if len(stack) > 0 {
+			top = stack[len(stack)-1]
+		}
+
+		if d, ok := tok.(json.Delim); ok {
+			switch d {
+			case '{':
+				stack = append(stack, &frame{keys: map[string]bool{}, expectKey: true})
+			case '[':
+				stack = append(stack, &frame{})
+			case '}', ']':
+				// A closed container completes a value in its parent.
+				stack = stack[:len(stack)-1]
+				if len(stack) > 0 && stack[len(stack)-1].keys != nil {
+					stack[len(stack)-1].expectKey = true
+				}
+			}
+			continue
+		}
+
+		if top == nil || top.keys == nil {
+			continue
+		}
+		if top.expectKey {
+			key := tok.(string)
+			if top.keys[key] {
+				return strictError{fmt.Sprintf("duplicate key %q", key)}
+			}
+			top.keys[key] = true
+			top.expectKey = false
+		} else {
+			top.expectKey = true
+		}
+	}
+}
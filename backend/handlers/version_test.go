@@ -0,0 +1,43 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/arkantrust/idempotency-example/backend/handlers"
+)
+
+func putStrict(h http.Handler, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPut, "/chargebacks/cb-1", strings.NewReader(body))
+	req.SetPathValue("id", "cb-1")
+	req.Header.Set(handlers.StrictVersionHeader, "true")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestStrictVersion(t *testing.T) {
+	h := newTestHandler(t)
+	if rec := post(h, `{"amount":100,"currency":"USD","reason":"fraud"}`); !strings.Contains(rec.Body.String(), `"version":1`) {
+		t.Fatalf("expected version 1 on create, got %s", rec.Body)
+	}
+
+	if rec := putStrict(h, `{"amount":200,"currency":"USD","reason":"fraud"}`); rec.Code != http.StatusPreconditionRequired {
+		t.Fatalf("expected 428 without a version, got %d: %s", rec.Code, rec.Body)
+	}
+	rec := putStrict(h, `{"amount":200,"currency":"USD","reason":"fraud","version":1}`)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"version":2`) {
+		t.Fatalf("expected the write at version 2, got %d: %s", rec.Code, rec.Body)
+	}
+
+	// A retry of that update changes nothing, so its stale version is fine...
+	if rec := putStrict(h, `{"amount":200,"currency":"USD","reason":"fraud","version":1}`); rec.Code != http.StatusOK || rec.Header().Get("X-Idempotency-Write") != "false" {
+		t.Fatalf("expected the retry skipped, got %d %q: %s", rec.Code, rec.Header().Get("X-Idempotency-Write"), rec.Body)
+	}
+	// ...but a different update from version 1 would overwrite version 2.
+	if rec := putStrict(h, `{"amount":300,"currency":"USD","reason":"fraud","version":1}`); rec.Code != http.StatusConflict {
+		t.Fatalf("expected 409 for a stale version, got %d: %s", rec.Code, rec.Body)
+	}
+}
@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/arkantrust/idempotency-example/backend/openapi"
+)
+
+// The API routes are versioned, so that the API can change what a retry
+// gets without breaking clients written against the old answer. Every API
+// route is served three times:
+//
+//   - under /v1, as it always behaved;
+//   - under /v2, where a duplicate create answers 409 with a Location
+//     instead of replaying the record with 200, whatever the server's
+//     ResponsePolicy.DuplicateStatus; Prefer: duplicate=replay still gets
+//     the replay;
+//   - unprefixed, for clients predating versions, in the version their
+//     APIVersionHeader names, or version 1 without one.
+//
+// Responses of the API routes carry the version that served them in
+// APIVersionHeader, and Locations they return point into that version
+// when the request named it in its path.
+//
+// Admin routes and probes are not versioned.
+
+// APIVersionHeader selects the version of an unprefixed route, e.g.
+// "API-Version: 2", and reports the version of a response.
+const APIVersionHeader = "API-Version"
+
+// apiVersions are the versions served, oldest first.
+var apiVersions = []int{1, 2}
+
+// latestVersion is the newest version.
+var latestVersion = apiVersions[len(apiVersions)-1]
+
+// apiVersion is the version a request is served in.
+type apiVersion struct {
+	n int
+
+	// prefixed is set when the request named the version in its path,
+	// rather than in a header or not at all.
+	prefixed bool
+}
+
+type versionKey struct{}
+
+// versionOf returns the version r is served in; requests that did not go
+// through a versioned route get version 1.
+func versionOf(r *http.Request) apiVersion {
+	if v, ok := r.Context().Value(versionKey{}).(apiVersion); ok {
+		return v
+	}
+	return apiVersion{n: 1}
+}
+
+// locate returns path, a path of the API, as seen from the version r is
+// served in.
+func locate(r *http.Request, path string) string {
+	if v := versionOf(r); v.prefixed {
+		return "/v" + strconv.Itoa(v.n) + path
+	}
+	return path
+}
+
+// atVersion wraps the handler of a route served in version v.
+func atVersion(v apiVersion, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(APIVersionHeader, strconv.Itoa(v.n))
+		next(w, r.WithContext(context.WithValue(r.Context(), versionKey{}, v)))
+	}
+}
+
+// negotiateVersion wraps the handler of an unprefixed route, which serves
+// the version APIVersionHeader names.
+func negotiateVersion(next http.HandlerFunc) http.HandlerFunc {
+	handlers := map[string]http.HandlerFunc{"": atVersion(apiVersion{n: 1}, next)}
+	for _, n := range apiVersions {
+		handlers[strconv.Itoa(n)] = atVersion(apiVersion{n: n}, next)
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		h, ok := handlers[strings.TrimSpace(r.Header.Get(APIVersionHeader))]
+		if !ok {
+			writeError(w, http.StatusBadRequest, "unsupported "+APIVersionHeader+"; supported versions: "+supportedVersions())
+			return
+		}
+		h(w, r)
+	}
+}
+
+func supportedVersions() string {
+	names := make([]string, len(apiVersions))
+	for i, n := range apiVersions {
+		names[i] = strconv.Itoa(n)
+	}
+	return strings.Join(names, ", ")
+}
+
+var versionParam = openapi.Param{
+	Name:        APIVersionHeader,
+	In:          "header",
+	Description: "API version to serve the request in: 1 (the default) to " + strconv.Itoa(latestVersion) + ".",
+}
+
+// versioned returns routes with every API route served under each version
+// prefix and unprefixed; see APIVersionHeader.
+func versioned(routes []openapi.Route) []openapi.Route {
+	var out []openapi.Route
+	for _, rt := range routes {
+		if rt.Access != openapi.Read && rt.Access != openapi.Write {
+			out = append(out, rt)
+			continue
+		}
+		for _, n := range apiVersions {
+			vrt := rt
+			vrt.Pattern = "/v" + strconv.Itoa(n) + rt.Pattern
+			vrt.Handler = atVersion(apiVersion{n: n, prefixed: true}, rt.Handler)
+			if n >= 2 && (rt.Semantics() == openapi.KeyedByID || rt.Semantics() == openapi.KeyedByHeader) {
+				vrt.Description += " In version 2 a retry gets 409 unless it prefers duplicate=replay."
+			}
+			out = append(out, vrt)
+		}
+
+		rt.Handler = negotiateVersion(rt.Handler)
+		rt.Deprecated = true
+		rt.Description = strings.TrimSpace(rt.Description + " Unprefixed routes are kept for clients predating " +
+			"versions; they serve the version " + APIVersionHeader + " names, or version 1.")
+		rt.Params = append(slices.Clip(rt.Params), versionParam)
+		if !slices.ContainsFunc(rt.Responses, func(r openapi.Response) bool { return r.Status == http.StatusBadRequest }) {
+			rt.Responses = append(slices.Clip(rt.Responses), openapi.Response{Status: http.StatusBadRequest, Description: "Unsupported " + APIVersionHeader + "."})
+		}
+		out = append(out, rt)
+	}
+	return out
+}
@@ -0,0 +1,60 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/arkantrust/idempotency-example/backend/handlers"
+)
+
+func TestAPIVersions(t *testing.T) {
+	h := newTestHandler(t)
+	do := func(method, path, version, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if version != "" {
+			req.Header.Set(handlers.APIVersionHeader, version)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+	body := `{"amount":100,"currency":"USD","reason":"fraud"}`
+
+	rec := do(http.MethodPost, "/v1/chargebacks/cb-1", "", body)
+	if rec.Code != http.StatusCreated || rec.Header().Get("Location") != "/v1/chargebacks/cb-1" || rec.Header().Get(handlers.APIVersionHeader) != "1" {
+		t.Fatalf("expected 201 in version 1, got %d %q: %s", rec.Code, rec.Header().Get("Location"), rec.Body)
+	}
+
+	// The same retry gets the replay in version 1 and 409 in version 2,
+	// whether the version is in the path or the header.
+	for _, tc := range []struct {
+		path, version string
+		status        int
+		location      string
+	}{
+		{"/v1/chargebacks/cb-1", "", http.StatusOK, ""},
+		{"/chargebacks/cb-1", "", http.StatusOK, ""},
+		{"/v2/chargebacks/cb-1", "", http.StatusConflict, "/v2/chargebacks/cb-1"},
+		{"/chargebacks/cb-1", "2", http.StatusConflict, "/chargebacks/cb-1"},
+	} {
+		rec := do(http.MethodPost, tc.path, tc.version, body)
+		if rec.Code != tc.status || rec.Header().Get("Location") != tc.location {
+			t.Errorf("%s (version %q): expected %d %q, got %d %q", tc.path, tc.version, tc.status, tc.location, rec.Code, rec.Header().Get("Location"))
+		}
+	}
+
+	// A retry may still prefer the replay in version 2.
+	req := httptest.NewRequest(http.MethodPost, "/v2/chargebacks/cb-1", strings.NewReader(body))
+	req.Header.Set(handlers.PreferHeader, "duplicate=replay")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected the preferred replay, got %d", rec.Code)
+	}
+
+	if rec := do(http.MethodGet, "/chargebacks/cb-1", "3", ""); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an unknown version, got %d", rec.Code)
+	}
+}
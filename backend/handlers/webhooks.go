@@ -0,0 +1,17 @@
+package handlers
+
+import (
+	"net/http"
+)
+
+// WebhookDeliveries handles GET /webhooks/{id}/deliveries: the attempts at
+// delivering the event id of the caller's tenant, so that a receiver can see
+// what its endpoint answered. An event of another tenant has none.
+func (h *Handler) WebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	deliveries, err := h.store.WebhookDeliveries(r.Context(), r.PathValue("id"))
+	if err != nil {
+		h.fail(w, r, err, "failed to list webhook deliveries")
+		return
+	}
+	writeJSON(w, http.StatusOK, deliveries)
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/arkantrust/idempotency-example/backend/backup"
+	"github.com/arkantrust/idempotency-example/backend/config"
+	"github.com/arkantrust/idempotency-example/backend/jobs"
+	"github.com/arkantrust/idempotency-example/backend/metrics"
+	"github.com/arkantrust/idempotency-example/backend/models"
+	"github.com/arkantrust/idempotency-example/backend/rates"
+	"github.com/arkantrust/idempotency-example/backend/store"
+)
+
+// Kinds of the scheduled jobs; webhook deliveries are webhook.JobKind.
+const (
+	backupJob      = "backup"
+	archiveJob     = "archive"
+	compactJob     = "compact"
+	sweepKeysJob   = "sweep-keys"
+	sweepNoncesJob = "sweep-nonces"
+	sweepUsageJob  = "sweep-usage"
+	ratesJob       = "refresh-rates"
+)
+
+// backupPayload is the payload of a backup job: the time the snapshot is
+// named after.
+type backupPayload struct {
+	At time.Time `json:"at"`
+}
+
+// archivePayload is the payload of an archival job: chargebacks created
+// before Before are archived.
+type archivePayload struct {
+	Before time.Time `json:"before"`
+}
+
+// compactPayload is the payload of a compaction check: the database is
+// compacted when its free-page ratio exceeds Threshold.
+type compactPayload struct {
+	Threshold float64 `json:"threshold"`
+}
+
+// sweepPayload is the payload of a key sweep: keys expired at At are
+// deleted.
+type sweepPayload struct {
+	At time.Time `json:"at"`
+}
+
+// ratesPayload is the payload of an exchange rate refresh: the time it was
+// scheduled for.
+type ratesPayload struct {
+	At time.Time `json:"at"`
+}
+
+// backupHandler runs backup jobs with sched. The snapshot is named after the
+// job's time, not the run's, so a retry replaces the file of a failed
+// attempt rather than adding another.
+func backupHandler(sched *backup.Scheduler) jobs.Handler {
+	return func(ctx context.Context, job *models.Job) error {
+		var p backupPayload
+		if err := json.Unmarshal(job.Payload, &p); err != nil {
+			return jobs.Permanent(fmt.Errorf("malformed backup job: %w", err))
+		}
+		path, err := sched.RunOnce(ctx, p.At)
+		if err != nil {
+			metrics.Backups.WithLabelValues("failure").Inc()
+			return err
+		}
+		slog.Info("scheduled backup written", "path", path)
+		return nil
+	}
+}
+
+// archiveHandler runs archival jobs on s. Archiving is idempotent: a retry
+// moves whatever the failed attempt left.
+func archiveHandler(s *store.Store) jobs.Handler {
+	return func(ctx context.Context, job *models.Job) error {
+		var p archivePayload
+		if err := json.Unmarshal(job.Payload, &p); err != nil {
+			return jobs.Permanent(fmt.Errorf("malformed archive job: %w", err))
+		}
+		n, err := s.Archive(ctx, p.Before)
+		if n > 0 {
+			slog.Info("archived chargebacks", "count", n)
+		}
+		return err
+	}
+}
+
+// compactHandler runs compaction checks on s.
+func compactHandler(s *store.Store) jobs.Handler {
+	return func(ctx context.Context, job *models.Job) error {
+		var p compactPayload
+		if err := json.Unmarshal(job.Payload, &p); err != nil {
+			return jobs.Permanent(fmt.Errorf("malformed compact job: %w", err))
+		}
+		ratio, err := s.FreeRatio(ctx)
+		if err != nil {
+			return err
+		}
+		if ratio <= p.Threshold || s.Mode() == store.ModeReadOnly {
+			return nil
+		}
+		st, err := s.Compact(ctx)
+		if err != nil {
+			return err
+		}
+		slog.Info("compacted database", "freeRatio", ratio, "before", st.Before, "after", st.After)
+		return nil
+	}
+}
+
+// sweepHandler runs key sweeps on s. The store already ignores expired keys;
+// this reclaims their space. Each instance of a Raft cluster sweeps its own
+// copy, like it archives its own.
+func sweepHandler(s *store.Store) jobs.Handler {
+	return func(ctx context.Context, job *models.Job) error {
+		var p sweepPayload
+		if err := json.Unmarshal(job.Payload, &p); err != nil {
+			return jobs.Permanent(fmt.Errorf("malformed sweep job: %w", err))
+		}
+		n, err := s.SweepKeys(ctx, p.At)
+		if n > 0 {
+			slog.Info("swept expired idempotency keys", "count", n)
+		}
+		return err
+	}
+}
+
+// sweepNoncesHandler runs nonce sweeps on s, reclaiming the space of the
+// signature nonces that have expired. It takes sweepPayloads.
+func sweepNoncesHandler(s *store.Store) jobs.Handler {
+	return func(ctx context.Context, job *models.Job) error {
+		var p sweepPayload
+		if err := json.Unmarshal(job.Payload, &p); err != nil {
+			return jobs.Permanent(fmt.Errorf("malformed sweep job: %w", err))
+		}
+		n, err := s.SweepNonces(ctx, p.At)
+		if n > 0 {
+			slog.Info("swept expired signature nonces", "count", n)
+		}
+		return err
+	}
+}
+
+// sweepUsageHandler runs usage sweeps on s, deleting the daily counts older
+// than store.UsageDays. It takes sweepPayloads.
+func sweepUsageHandler(s *store.Store) jobs.Handler {
+	return func(ctx context.Context, job *models.Job) error {
+		var p sweepPayload
+		if err := json.Unmarshal(job.Payload, &p); err != nil {
+			return jobs.Permanent(fmt.Errorf("malformed sweep job: %w", err))
+		}
+		n, err := s.SweepUsage(ctx, p.At)
+		if n > 0 {
+			slog.Info("swept old daily usage", "count", n)
+		}
+		return err
+	}
+}
+
+// ratesHandler runs exchange rate refreshes, fetching the rates from p into
+// c. A failed fetch is retried, and conversions use the rates cached before
+// it until one succeeds.
+func ratesHandler(p rates.Provider, c rates.Cache) jobs.Handler {
+	return func(ctx context.Context, job *models.Job) error {
+		r, err := rates.Refresh(ctx, p, c)
+		if err != nil {
+			return err
+		}
+		slog.Info("exchange rates refreshed", "provider", r.Provider, "date", r.Date, "currencies", len(r.Rates))
+		return nil
+	}
+}
+
+// ratesProvider returns the exchange rate provider cfg selects.
+func ratesProvider(cfg config.RatesConfig) (rates.Provider, error) {
+	if cfg.Provider == "static" {
+		return rates.ParseStatic(cfg.Base, cfg.Static)
+	}
+	return &rates.ECB{URL: cfg.URL, Client: &http.Client{Timeout: cfg.Timeout}}, nil
+}
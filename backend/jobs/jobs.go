@@ -0,0 +1,275 @@
+// Package jobs runs the server's background work – webhook deliveries,
+// backups, archival – from one persistent queue.
+//
+// A job is stored before it runs and until it has finished, so work enqueued
+// survives a restart: jobs a crashed process left running are resumed by the
+// next one. That makes every job run at least once, and possibly more than
+// once, so handlers must be idempotent. The ones the server registers are:
+// a backup writes the snapshot named after its scheduled time, so running it
+// again rewrites the same file; archival moves what is still left to move;
+// and a webhook delivery carries its event's ID, which receivers deduplicate
+// on.
+//
+// A failed run is retried with exponential backoff until the job's
+// MaxAttempts, unless the handler reports the failure as Permanent. Jobs
+// enqueued with a key are enqueued once, however often Enqueue is called.
+//
+// A job that gives up stays in the queue as failed, unless its kind was
+// registered with DeadLetter: then it moves to the dead-letter queue, with
+// the history of its failures, until it is requeued. Requeueing a job that
+// did its work after all is harmless for the same reason retries are.
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/arkantrust/idempotency-example/backend/metrics"
+	"github.com/arkantrust/idempotency-example/backend/models"
+	"github.com/arkantrust/idempotency-example/backend/store"
+)
+
+// Handler runs a job of the kind it was registered for. A nil error
+// completes the job; any other is retried, unless it is Permanent.
+type Handler func(ctx context.Context, job *models.Job) error
+
+// Defaults of the Queue settings.
+const (
+	DefaultWorkers      = 2
+	DefaultMaxAttempts  = 8
+	DefaultRetryDelay   = time.Second
+	DefaultPollInterval = time.Second
+)
+
+// maxRetryDelay caps the backoff between retries.
+const maxRetryDelay = time.Hour
+
+// Queue stores jobs and runs them with a pool of workers.
+type Queue struct {
+	store *store.Store
+
+	// Workers is the number of jobs run concurrently; zero means
+	// DefaultWorkers.
+	Workers int
+
+	// MaxAttempts bounds the runs of a job enqueued from now on, and
+	// RetryDelay is the wait before its first retry, doubled for each one
+	// after; zero means DefaultMaxAttempts and DefaultRetryDelay.
+	MaxAttempts int
+	RetryDelay  time.Duration
+
+	// PollInterval is how often Run looks for due jobs when it has not been
+	// woken by Enqueue; zero means DefaultPollInterval. Retries become due
+	// between polls, so it bounds how late they run.
+	PollInterval time.Duration
+
+	mu          sync.RWMutex
+	handlers    map[string]Handler
+	deadLetters map[string]bool
+
+	// wake tells Run that a job was enqueued or a worker freed.
+	wake chan struct{}
+}
+
+// New returns a queue keeping its jobs in s.
+func New(s *store.Store) *Queue {
+	return &Queue{store: s, handlers: map[string]Handler{}, deadLetters: map[string]bool{}, wake: make(chan struct{}, 1)}
+}
+
+// DeadLetter moves the jobs of kind that give up into the dead-letter queue
+// instead of keeping them in the queue as failed; see
+// store.Store.DeadLetterJob.
+func (q *Queue) DeadLetter(kind string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.deadLetters[kind] = true
+}
+
+// Handle registers h to run the jobs of kind.
+func (q *Queue) Handle(kind string, h Handler) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.handlers[kind] = h
+}
+
+// Enqueue stores a job of kind running with payload, encoded as JSON, and
+// returns it with created true. With a key, a job already enqueued with it
+// is returned instead, with created false; see store.Store.EnqueueJob.
+func (q *Queue) Enqueue(ctx context.Context, kind, key string, payload any) (job *models.Job, created bool, err error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, false, err
+	}
+	job, created, err = q.store.EnqueueJob(ctx, &models.Job{
+		Kind:        kind,
+		Key:         key,
+		Payload:     data,
+		MaxAttempts: orDefault(q.MaxAttempts, DefaultMaxAttempts),
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	if created {
+		metrics.Jobs.WithLabelValues(kind, "enqueued").Inc()
+		q.signal()
+	}
+	return job, created, nil
+}
+
+// Run runs due jobs until ctx is cancelled, starting with those an earlier
+// process left running. Jobs running when ctx is cancelled are left running,
+// to be resumed by the next process.
+func (q *Queue) Run(ctx context.Context) {
+	if n, err := q.store.ResumeJobs(ctx); err != nil {
+		slog.Error("resuming interrupted jobs failed", "err", err)
+	} else if n > 0 {
+		slog.Info("resuming interrupted jobs", "count", n)
+	}
+
+	t := time.NewTicker(orDefault(q.PollInterval, DefaultPollInterval))
+	defer t.Stop()
+
+	// free holds a token per busy worker: a job is only claimed when a
+	// worker is idle to run it, so the others stay pending meanwhile.
+	free := make(chan struct{}, orDefault(q.Workers, DefaultWorkers))
+	var wg sync.WaitGroup
+	for {
+		for q.claim(ctx, free, &wg) {
+		}
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+			return
+		case <-t.C:
+		case <-q.wake:
+		}
+	}
+}
+
+// claim takes a free worker and hands it the next due job, reporting whether
+// there was both.
+func (q *Queue) claim(ctx context.Context, free chan struct{}, wg *sync.WaitGroup) bool {
+	select {
+	case free <- struct{}{}:
+	default:
+		return false
+	}
+	job, err := q.store.ClaimJob(ctx)
+	if err != nil || job == nil {
+		<-free
+		if err != nil && !errors.Is(err, store.ErrReadOnly) {
+			slog.Error("claiming a job failed", "err", err)
+		}
+		return false
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer q.signal()
+		defer func() { <-free }()
+		q.run(ctx, job)
+	}()
+	return true
+}
+
+// run runs job with its handler and records the outcome: done, failed for
+// good, or pending again until its next retry is due.
+func (q *Queue) run(ctx context.Context, job *models.Job) {
+	q.mu.RLock()
+	h, deadLetter := q.handlers[job.Kind], q.deadLetters[job.Kind]
+	q.mu.RUnlock()
+
+	var err error
+	if h == nil {
+		err = Permanent(fmt.Errorf("no handler for jobs of kind %q", job.Kind))
+	} else {
+		err = h(ctx, job)
+	}
+	if ctx.Err() != nil {
+		// Shutting down: the job stays running and is resumed by the next
+		// process.
+		return
+	}
+
+	outcome := "succeeded"
+	gaveUp := err != nil && (IsPermanent(err) || job.Attempts >= job.MaxAttempts)
+	record := func(j *models.Job) {
+		if err != nil {
+			j.LastError = err.Error()
+			j.Failures = append(j.Failures, models.JobFailure{Attempt: j.Attempts, Error: err.Error(), At: time.Now()})
+		}
+		switch {
+		case err == nil:
+			j.Status, j.LastError = models.JobSucceeded, ""
+		case gaveUp:
+			j.Status = models.JobFailed
+			outcome = "failed"
+		default:
+			j.Status = models.JobPending
+			j.RunAt = time.Now().Add(q.backoff(j.Attempts))
+			outcome = "retried"
+		}
+	}
+	update := q.store.UpdateJob
+	if gaveUp && deadLetter {
+		update = q.store.DeadLetterJob
+	}
+	if err := update(ctx, job.ID, record); err != nil {
+		// The job stays running and is resumed, and run again, by the
+		// next process; handlers are idempotent.
+		slog.Error("recording the outcome of a job failed", "job", job.ID, "kind", job.Kind, "err", err)
+		return
+	}
+	metrics.Jobs.WithLabelValues(job.Kind, outcome).Inc()
+	if err != nil {
+		slog.Warn("job failed", "job", job.ID, "kind", job.Kind, "attempt", job.Attempts, "outcome", outcome, "err", err)
+	}
+}
+
+// backoff is the wait before the retry following attempt.
+func (q *Queue) backoff(attempt int) time.Duration {
+	d := orDefault(q.RetryDelay, DefaultRetryDelay)
+	for i := 1; i < attempt && d < maxRetryDelay; i++ {
+		d *= 2
+	}
+	return min(d, maxRetryDelay)
+}
+
+// signal wakes Run, unless it is already due to wake.
+func (q *Queue) signal() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// orDefault returns v, or def when v is not positive.
+func orDefault[T int | time.Duration](v, def T) T {
+	if v <= 0 {
+		return def
+	}
+	return v
+}
+
+// permanentError marks a failure that retrying would not fix.
+type permanentError struct{ err error }
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err as a failure retrying would not fix, such as a
+// malformed payload: the job fails at once.
+func Permanent(err error) error {
+	return &permanentError{err: err}
+}
+
+// IsPermanent reports whether err was marked by Permanent.
+func IsPermanent(err error) bool {
+	var p *permanentError
+	return errors.As(err, &p)
+}
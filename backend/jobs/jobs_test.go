@@ -0,0 +1,163 @@
+package jobs_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/arkantrust/idempotency-example/backend/jobs"
+	"github.com/arkantrust/idempotency-example/backend/models"
+	"github.com/arkantrust/idempotency-example/backend/store"
+)
+
+func newQueue(t *testing.T) (*jobs.Queue, *store.Store) {
+	t.Helper()
+	s, err := store.New(filepath.Join(t.TempDir(), "jobs.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	q := jobs.New(s)
+	q.RetryDelay = time.Millisecond
+	q.PollInterval = 5 * time.Millisecond
+	return q, s
+}
+
+// waitDone polls the job id until it has finished.
+func waitDone(t *testing.T, s *store.Store, id string) *models.Job {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		job, err := s.Job(context.Background(), id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if job.Done() {
+			return job
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job did not finish: %+v", job)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestQueueRetriesFailingJobs(t *testing.T) {
+	q, s := newQueue(t)
+	var runs atomic.Int32
+	q.Handle("flaky", func(ctx context.Context, job *models.Job) error {
+		if runs.Add(1) < 3 {
+			return errors.New("unavailable")
+		}
+		return nil
+	})
+	q.Handle("broken", func(ctx context.Context, job *models.Job) error {
+		return jobs.Permanent(errors.New("malformed"))
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go q.Run(ctx)
+
+	flaky, _, err := q.Enqueue(ctx, "flaky", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	broken, _, err := q.Enqueue(ctx, "broken", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if job := waitDone(t, s, flaky.ID); job.Status != models.JobSucceeded || job.Attempts != 3 || job.LastError != "" {
+		t.Fatalf("expected success on the third attempt, got %+v", job)
+	}
+	if job := waitDone(t, s, broken.ID); job.Status != models.JobFailed || job.Attempts != 1 || job.LastError != "malformed" {
+		t.Fatalf("expected a permanent failure on the first attempt, got %+v", job)
+	}
+}
+
+func TestQueueGivesUpAfterMaxAttempts(t *testing.T) {
+	q, s := newQueue(t)
+	q.MaxAttempts = 2
+	q.Handle("down", func(ctx context.Context, job *models.Job) error { return errors.New("down") })
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go q.Run(ctx)
+
+	job, _, err := q.Enqueue(ctx, "down", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job := waitDone(t, s, job.ID); job.Status != models.JobFailed || job.Attempts != 2 {
+		t.Fatalf("expected to give up after 2 attempts, got %+v", job)
+	}
+}
+
+func TestQueueMovesDeadLettersOutOfTheQueue(t *testing.T) {
+	q, s := newQueue(t)
+	q.MaxAttempts = 2
+	q.Handle("webhook", func(ctx context.Context, job *models.Job) error { return errors.New("502 Bad Gateway") })
+	q.DeadLetter("webhook")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go q.Run(ctx)
+
+	job, _, err := q.Enqueue(ctx, "webhook", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		dead, err := s.DeadLetter(ctx, job.ID)
+		if err == nil {
+			if dead.Status != models.JobFailed || len(dead.Failures) != 2 || dead.Failures[1].Attempt != 2 {
+				t.Fatalf("expected two failures recorded, got %+v", dead)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job was not dead-lettered: %v", err)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if _, err := s.Job(ctx, job.ID); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("expected the job out of the queue, got %v", err)
+	}
+}
+
+func TestQueueResumesInterruptedJobs(t *testing.T) {
+	q, s := newQueue(t)
+	ctx := context.Background()
+
+	// A process claimed the job and stopped before finishing it.
+	job, _, err := q.Enqueue(ctx, "work", "work-1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claimed, err := s.ClaimJob(ctx); err != nil || claimed.ID != job.ID {
+		t.Fatalf("claim: %+v %v", claimed, err)
+	}
+
+	var runs atomic.Int32
+	q.Handle("work", func(ctx context.Context, job *models.Job) error {
+		runs.Add(1)
+		return nil
+	})
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go q.Run(runCtx)
+
+	if job := waitDone(t, s, job.ID); job.Status != models.JobSucceeded || job.Attempts != 2 {
+		t.Fatalf("expected the job resumed, got %+v", job)
+	}
+	// Enqueueing it again with its key is a no-op.
+	if _, created, err := q.Enqueue(ctx, "work", "work-1", nil); err != nil || created {
+		t.Fatalf("expected the key to deduplicate, got %v %v", created, err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if n := runs.Load(); n != 1 {
+		t.Fatalf("expected one run, got %d", n)
+	}
+}
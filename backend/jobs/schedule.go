@@ -0,0 +1,160 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/arkantrust/idempotency-example/backend/cron"
+	"github.com/arkantrust/idempotency-example/backend/store"
+)
+
+// Scheduler enqueues jobs on cron schedules: every entry added with Add
+// enqueues a job of its kind each time its schedule fires. The job is keyed
+// by the entry and the time it fired, so a firing is enqueued once however
+// often the enqueue is retried.
+type Scheduler struct {
+	queue *Queue
+
+	mu      sync.Mutex
+	entries []*entry
+
+	// now returns the current time; tests replace it.
+	now func() time.Time
+}
+
+// entry is a scheduled job and its status.
+type entry struct {
+	status   ScheduleStatus
+	schedule cron.Schedule
+	payload  func(at time.Time) any
+}
+
+// ScheduleStatus describes an entry of a Scheduler.
+type ScheduleStatus struct {
+	// Name identifies the entry, e.g. "backup".
+	Name string `json:"name"`
+
+	// Kind is the kind of the jobs it enqueues.
+	Kind string `json:"kind"`
+
+	// Schedule is the cron expression it runs on.
+	Schedule string `json:"schedule"`
+
+	// LastRun is when it last fired since the server started, and LastJob
+	// the job it enqueued then. LastError is set when enqueueing failed.
+	LastRun   *time.Time `json:"lastRun,omitempty"`
+	LastJob   string     `json:"lastJob,omitempty"`
+	LastError string     `json:"lastError,omitempty"`
+
+	// NextRun is when it fires next; absent for a schedule that never does.
+	NextRun *time.Time `json:"nextRun,omitempty"`
+}
+
+// NewScheduler returns a scheduler enqueueing its jobs in q.
+func NewScheduler(q *Queue) *Scheduler {
+	return &Scheduler{queue: q, now: time.Now}
+}
+
+// Add schedules a job of kind, with the payload returned for the time it
+// fires, on the cron expression spec; see package cron. name identifies the
+// entry in Status and in the jobs' keys.
+func (s *Scheduler) Add(name, spec, kind string, payload func(at time.Time) any) error {
+	schedule, err := cron.Parse(spec)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e := &entry{
+		status:   ScheduleStatus{Name: name, Kind: kind, Schedule: spec},
+		schedule: schedule,
+		payload:  payload,
+	}
+	e.plan(s.now())
+	s.entries = append(s.entries, e)
+	return nil
+}
+
+// Status returns the entries, by name.
+func (s *Scheduler) Status() []ScheduleStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	statuses := make([]ScheduleStatus, 0, len(s.entries))
+	for _, e := range s.entries {
+		statuses = append(statuses, e.status)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+	return statuses
+}
+
+// Run enqueues the jobs of the entries as they fall due, until ctx is
+// cancelled. Firings missed while the server was stopped are not caught up.
+func (s *Scheduler) Run(ctx context.Context) {
+	for {
+		wait, ok := s.fire(ctx)
+		if !ok {
+			return
+		}
+		t := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// fire enqueues the jobs of the entries due by now, and returns how long to
+// wait for the next one to fall due; false when none ever will.
+func (s *Scheduler) fire(ctx context.Context) (time.Duration, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	var next time.Time
+	for _, e := range s.entries {
+		if e.status.NextRun == nil {
+			continue
+		}
+		if !e.status.NextRun.After(now) {
+			s.enqueue(ctx, e, *e.status.NextRun)
+			e.plan(now)
+		}
+		if e.status.NextRun != nil && (next.IsZero() || e.status.NextRun.Before(next)) {
+			next = *e.status.NextRun
+		}
+	}
+	if next.IsZero() {
+		return 0, false
+	}
+	return next.Sub(now), true
+}
+
+// enqueue enqueues the job of e firing at at, and records the outcome.
+func (s *Scheduler) enqueue(ctx context.Context, e *entry, at time.Time) {
+	key := e.status.Name + ":" + at.UTC().Format(time.RFC3339Nano)
+	job, _, err := s.queue.Enqueue(ctx, e.status.Kind, key, e.payload(at))
+	e.status.LastRun = &at
+	switch {
+	case errors.Is(err, store.ErrReadOnly):
+		e.status.LastJob, e.status.LastError = "", err.Error()
+		slog.Warn("scheduled job skipped: the database is read-only", "schedule", e.status.Name)
+	case err != nil:
+		e.status.LastJob, e.status.LastError = "", err.Error()
+		slog.Error("enqueueing a scheduled job failed", "schedule", e.status.Name, "err", err)
+	default:
+		e.status.LastJob, e.status.LastError = job.ID, ""
+	}
+}
+
+// plan sets when e fires next after now.
+func (e *entry) plan(now time.Time) {
+	e.status.NextRun = nil
+	if next := e.schedule.Next(now); !next.IsZero() {
+		e.status.NextRun = &next
+	}
+}
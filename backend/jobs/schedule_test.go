@@ -0,0 +1,58 @@
+package jobs
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/arkantrust/idempotency-example/backend/store"
+)
+
+func TestSchedulerEnqueuesEachFiringOnce(t *testing.T) {
+	s, err := store.New(filepath.Join(t.TempDir(), "jobs.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	ctx := context.Background()
+
+	clock := time.Date(2024, 1, 1, 0, 30, 0, 0, time.UTC)
+	sched := NewScheduler(New(s))
+	sched.now = func() time.Time { return clock }
+	if err := sched.Add("sweep", "@hourly", "sweep", func(at time.Time) any { return at }); err != nil {
+		t.Fatal(err)
+	}
+	if err := sched.Add("bad", "61 * * * *", "sweep", nil); err == nil {
+		t.Fatal("expected an invalid expression to be rejected")
+	}
+
+	wait, ok := sched.fire(ctx)
+	if !ok || wait != 30*time.Minute {
+		t.Fatalf("expected to wait 30m, got %v %v", wait, ok)
+	}
+	if st := sched.Status()[0]; st.LastRun != nil || !st.NextRun.Equal(time.Date(2024, 1, 1, 1, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected status before firing: %+v", st)
+	}
+
+	clock = clock.Add(wait)
+	sched.fire(ctx)
+	st := sched.Status()[0]
+	if st.LastJob == "" || st.LastError != "" || !st.NextRun.Equal(time.Date(2024, 1, 1, 2, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected status after firing: %+v", st)
+	}
+	job, err := s.Job(ctx, st.LastJob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Kind != "sweep" || job.Key != "sweep:2024-01-01T01:00:00Z" || string(job.Payload) != `"2024-01-01T01:00:00Z"` {
+		t.Fatalf("unexpected job: %+v", job)
+	}
+
+	// The same firing, retried, enqueues nothing new.
+	e := sched.entries[0]
+	sched.enqueue(ctx, e, *st.LastRun)
+	if e.status.LastJob != job.ID {
+		t.Fatalf("expected the firing deduplicated, got %q", e.status.LastJob)
+	}
+}
@@ -5,80 +5,921 @@
 //
 //	go run ./main.go
 //
-// The server listens on :8080 by default. Set the PORT environment variable
-// to override. Set DB_PATH to change the BoltDB file location (default:
-// chargebacks.db).
+// Settings come from built-in defaults, an optional YAML file (-config or
+// CONFIG_FILE), environment variables and flags, in increasing order of
+// precedence. Run with -help for the full list; the most common ones are:
+//
+//	-port     PORT     8080
+//	-db       DB_PATH  chargebacks.db
+//
+// Automatic backups are enabled by setting BACKUP_INTERVAL to a Go duration
+// (e.g. "1h"), and automatic compaction by setting COMPACT_THRESHOLD to a
+// free-page ratio between 0 and 1 (e.g. "0.5"). POST /admin/compact compacts
+// on demand and GET /admin/backup streams a snapshot.
+//
+// RETENTION_DAYS moves chargebacks older than that many days out of the
+// active bucket into an archive, checking every RETENTION_INTERVAL (default
+// 1h), which keeps listing fast however much history accumulates. GET
+// /chargebacks/archive lists archived chargebacks; their IDs and idempotency
+// keys keep replaying them, and reports keep counting them.
+//
+// DB_ENCODING stores records as "msgpack" or "protobuf" instead of JSON,
+// which makes the file smaller and listing faster. Records are tagged with
+// their encoding, so an existing database keeps working after a switch; POST
+// /admin/reencode converts the remaining records in one go.
+//
+// ENCRYPTION_KEYS encrypts the fields of chargebacks that may hold personal
+// data (the reason) with AES-GCM before they are stored; the API never sees
+// the ciphertext. POST /admin/reencode encrypts the records written before,
+// and re-encrypts with a new first key after a rotation; POST /admin/compact
+// then drops the pages that held the old values.
+//
+// Stored records carry a schema version. Records written by an older schema
+// are upgraded when read; MIGRATE_ON_START rewrites them all at startup
+// instead, as POST /admin/reencode does on demand.
+//
+// MODE=maintenance starts the server refusing writes with 503 and
+// Retry-After while it keeps serving reads; MODE=read-only also opens the
+// database file read-only. PUT /admin/mode switches modes at runtime, e.g.
+// around a backup or a migration.
+//
+// RAFT_NODE_ID, RAFT_ADDR and RAFT_PEERS run the instance as one of a Raft
+// cluster (see store/raft): chargeback writes go through the elected leader
+// and are applied by every instance, so three instances keep serving writes
+// with one of them down. Followers serve reads from their own copy and answer
+// writes with 503, to be retried against the leader.
+//
+// SHADOW_DB_PATH mirrors chargeback writes to a second Bolt file, which must
+// start as a copy of the first (see store/shadow), and logs every read and
+// write it answers differently; SHADOW_DB_ENCODING stores it in another
+// encoding. Requests are still answered from DB_PATH alone, so a shadow can
+// be checked on live traffic before it replaces the database.
+//
+// DB_DURABILITY trades durability for speed: "safe" (the default) fsyncs
+// every commit, "fast" does not fsync the file's growth and maps it ahead,
+// and "demo" fsyncs nothing, so a machine crash can lose recent writes.
+// DB_NO_SYNC, DB_NO_GROW_SYNC, DB_INITIAL_MMAP_SIZE and DB_MMAP_FLAGS adjust
+// the preset, and GET /healthz reports the options in effect, so that a
+// benchmark says what it measured.
+//
+// DB_TIMEOUT (default 10s) bounds how long an operation waits for its
+// transaction to start, so that a slow disk, a compaction or a restore
+// answers requests with 503 and Retry-After rather than hanging them. A
+// transaction that has started runs to the end. Cancelled requests give up
+// waiting as well.
+//
+// Operations failing on a transient error, like DB_TIMEOUT passing, are
+// retried up to RETRY_ATTEMPTS (default 3) times in all, after a jittered
+// backoff between RETRY_MIN_BACKOFF (50ms) and RETRY_MAX_BACKOFF (1s). Such
+// an operation did nothing, so retrying a write cannot apply it twice.
+//
+// After BREAKER_FAILURES (default 5) operations fail in a row on the
+// database itself, a circuit breaker fails the following ones at once with
+// 503 for BREAKER_COOLDOWN (30s), then lets one through to try the database
+// again. Its state is in the store_circuit_state metric and GET /healthz.
+//
+// BATCH_MAX_SIZE enables write coalescing: concurrent creates, updates and
+// deletes wait up to BATCH_DELAY (default 10ms) to share one transaction and
+// fsync, which multiplies write throughput under load.
+//
+// POST /chargebacks/{id}/evidence attaches a document (multipart/form-data,
+// up to MAX_UPLOAD_BYTES) to a chargeback. Documents are stored once per
+// tenant under their SHA-256, so uploading a file again attaches nothing new;
+// GET and DELETE /chargebacks/{id}/evidence/{sha256} download and detach one.
+//
+// POST /charges/{id} creates a charge, idempotently like a chargeback;
+// charges never change. A chargeback sending "chargeId" must name one, in
+// its currency and of at least its amount, which the store checks in the
+// transaction writing the chargeback. GET /chargebacks/{id}?expand=charge
+// includes it.
+//
+// POST /merchants/{id} creates a merchant, which chargebacks name by
+// "merchantId" like a charge. GET /chargebacks?merchantId= and GET
+// /chargebacks/stats?merchantId= read one merchant's chargebacks from an
+// index rather than scanning the tenant's.
+//
+// POST /chargebacks/{id}/refunds/{refundId} refunds part of a chargeback,
+// once per refund ID, as long as its refunds add up to at most its amount.
+// GET /chargebacks/{id}/refunds lists them, and GET
+// /chargebacks/{id}?expand=refunds includes them in the chargeback.
+//
+// Amounts are integers in the currency's minor unit – cents for USD, yen for
+// JPY, fils for BHD – and responses add "displayAmount", the same amount as a
+// decimal with the currency's number of places. RATES_PROVIDER=ecb fetches
+// the European Central Bank's daily reference rates every RATES_INTERVAL
+// (default 6h) into the database, and GET /chargebacks/stats?convertTo=USD
+// then totals every currency in dollars at the latest of them;
+// RATES_PROVIDER=static uses the fixed RATES_STATIC instead.
+//
+// POLICY_MAX_AMOUNTS (e.g. "USD=1000000"), POLICY_DISALLOWED_REASONS and
+// POLICY_MERCHANT_VELOCITY with POLICY_MERCHANT_WINDOW hold chargebacks to
+// risk rules: a create or update breaking one is refused with 422 listing
+// the violations, checked in the transaction writing it. GET /admin/rules
+// shows the rules in force.
+//
+// PLUGINS enables plugins compiled into the binary, which hook into every
+// write, imports and bulk deletes included: before hooks see a create or
+// update before it is validated, and may change or refuse it, and after
+// hooks see it once committed – never a replay or a skipped update.
+// plugins/auditlog, enabled as "audit-log", logs every write; see
+// service.RegisterPlugin to add one.
+//
+// IDEMPOTENCY_KEY_TTL (e.g. "24h") lets Idempotency-Keys expire, after which
+// a request with one is processed anew; expired keys are swept hourly, or on
+// KEY_SWEEP_SCHEDULE. GET
+// /admin/idempotency-keys lists the stored keys with their expiry, and DELETE
+// /admin/idempotency-keys/{key} expires one at once.
+//
+// POST /chargebacks runs in the background for clients sending "Prefer:
+// respond-async": it answers 202 with an operation to poll at
+// /operations/{id}, and a retry with the same key answers like the operation
+// does by then. ASYNC_WORKERS (default 4) sets the number of workers; 0
+// turns the preference off.
+//
+// The API routes are versioned: /v1/chargebacks/{id} behaves as always,
+// while under /v2 a retried create answers 409 with a Location instead of
+// replaying the record. Unprefixed paths keep working for existing clients
+// and serve the version their API-Version header names, or version 1.
+//
+// IDEMPOTENCY_STRICT=true switches the write routes to the semantics of the
+// IETF Idempotency-Key header draft, for comparison with the path-key design:
+// every write needs an Idempotency-Key, retries get the saved first response
+// back, and a key reused for another request or sent again while its first
+// request is running is refused with 422 or 409.
+//
+// cmd/cbctl is a command-line client for the API and, when the server is
+// stopped, for the database file directly. Besides managing chargebacks it
+// compacts, lists and expires stored idempotency keys (GET and DELETE
+// /admin/idempotency-keys).
+// Go programs can use package client, which generates idempotency keys and
+// retries failed requests with backoff.
+//
+// -bench-server measures, on this machine and next to the database, what
+// the storage strategies cost – skipping unchanged updates or writing them,
+// the record codecs, and committing writes one by one or in batches – prints
+// a comparison and exits. The same cases run with go test -bench . ./bench.
+//
+// To recover from a snapshot, start the server with -restore:
+//
+//	go run ./main.go -restore backups/chargebacks-20240101T000000.000000000Z.db
+//
+// The snapshot is validated and atomically swapped in for the database before
+// the server starts accepting requests.
+//
+// Logs are written to stderr with log/slog; LOG_FORMAT selects "text"
+// (default) or "json" and LOG_LEVEL sets the minimum level. Every request is
+// logged with its method, path, status, latency, idempotency key and whether
+// it was a replay of an earlier request. Every request also gets an
+// X-Request-ID (propagated from the client when present) that appears in the
+// response headers, the log lines and error bodies. A handler that panics
+// gets the request a 500 application/problem+json body with the ID, logs the
+// stack and counts it in http_panics_total; the server keeps serving.
+//
+// GET /openapi.json serves an OpenAPI 3 description of every route, with
+// the scopes it needs and, in x-idempotency, what a retry of it does.
+//
+// GET /metrics exposes Prometheus metrics, including counters of replayed
+// creates, skipped updates and deletes of missing records.
+//
+// RATE_LIMIT_RPS and RATE_LIMIT_BURST enable per-client token-bucket rate
+// limiting; throttled requests get 429 with Retry-After and RateLimit-*
+// headers. RATE_LIMIT_METHODS=POST limits only creates.
+//
+// USAGE_TRACKING=true counts the requests and writes of every authenticated
+// client per UTC day and month, reported by GET /admin/usage; the days are
+// kept for 90 days, swept on KEY_SWEEP_SCHEDULE. QUOTA_DAILY and
+// QUOTA_MONTHLY, which imply it, bound those requests: a client over its
+// quota gets 429 with Retry-After until the period ends.
+//
+// MAX_CONCURRENT_WRITES caps the API writes served at once: Bolt commits
+// them one at a time anyway. A write over the cap waits up to
+// WRITE_QUEUE_TIMEOUT (100ms) for a slot, then gets 503 with Retry-After;
+// http_queued_requests and http_shed_requests_total track both.
+//
+// SHED_LATENCY enables load shedding: while the p99 latency of the API
+// writes of the last SHED_WINDOW (10s) is above it, listings and exports get
+// 503 with Retry-After, keeping the rest responsive under load. Windows with
+// fewer than SHED_MIN_SAMPLES (20) writes are not judged; http_load_shedding
+// is 1 while shedding.
+//
+// CHAOS_RATE (0–1) injects faults into that fraction of API requests: the
+// response is dropped or replaced by a 500 after the write committed, or is
+// delayed by up to CHAOS_MAX_DELAY. It is for demonstrating retrying clients,
+// such as cmd/loadtest, keeping the data correct; never set it in production.
+//
+// For scripted demonstrations CHAOS_SIMULATE=true lets a single request ask
+// for the worst case with "X-Simulate: drop-response": the server processes
+// it fully and then closes the connection without answering. Retrying it
+// shows the endpoint's idempotency at work:
+//
+//	curl -H 'X-Simulate: drop-response' -H 'Content-Type: application/json' \
+//	     -d '{"amount":500,"currency":"USD","reason":"fraud"}' localhost:8080/chargebacks/cb-1
+//	# curl: (52) Empty reply from server; retrying without the header
+//	# returns 200 with the record the first request created.
+//
+// Tracing is off by default. TRACE_EXPORTER=otlp sends OpenTelemetry spans
+// to a collector (TRACE_ENDPOINT, default localhost:4318) and
+// TRACE_EXPORTER=stdout prints them, which is handy for seeing a retried
+// request take the "replayed" path through the store.
+//
+// Clients authenticate with an X-API-Key header. Keys are minted, listed and
+// revoked under /admin/keys, which, like the rest of /admin, requires
+// "Authorization: Bearer $ADMIN_TOKEN" or credentials with the admin role.
+// Setting JWT_SECRET or JWKS_URL also accepts JWT bearer tokens from an
+// external identity provider; reads need the chargebacks:read scope and
+// writes chargebacks:write. Roles grant scopes: a key is minted with the
+// role "viewer" (reads), "operator" (reads and writes, the default) or
+// "admin" (everything, /admin included), and a JWT's "role" or "roles"
+// claim adds theirs to its scopes. With
+// AUTH_REQUIRED=true every API request must carry valid credentials. Each
+// client only sees, replays and modifies the chargebacks it created itself,
+// and clients without credentials those created without credentials.
+//
+// The X-Tenant-ID header selects a tenant. Each tenant has its own buckets,
+// so record IDs, idempotency keys, listings, GET /chargebacks/stats and the
+// reports under /reports are all namespaced per tenant; requests without the
+// header use the default tenant. API keys minted with a "tenant" and JWTs
+// with a "tenant" claim are bound to that tenant; other callers, anonymous
+// ones included, are refused one other than the default.
+//
+// DEBUG_ENDPOINTS=true mounts net/http/pprof and expvar under /debug, guarded
+// by DEBUG_TOKEN when it is set.
+//
+// HTTPS is enabled with TLS_CERT_FILE and TLS_KEY_FILE, or with
+// TLS_AUTOCERT_HOST to obtain a Let's Encrypt certificate for that hostname
+// (the server must then be reachable on port 443). TLS_CLIENT_CA_FILE
+// additionally requires clients to present a certificate signed by one of the
+// listed CAs – all but Let's Encrypt's, whose validation handshakes serve no
+// request.
+//
+// Background work runs from a job queue kept in the database, so it survives
+// restarts and is retried with backoff when it fails: scheduled backups,
+// archival and webhook deliveries. JOB_WORKERS, JOB_MAX_ATTEMPTS and
+// JOB_RETRY_DELAY tune it, and GET /admin/jobs lists the jobs. WEBHOOK_URLS
+// sends a POST of every chargeback created, updated or deleted to each URL –
+// imported, erased and bulk-deleted ones included, archived ones not; a
+// delivery may be repeated, always with the same Webhook-Id header, and is a
+// CloudEvents 1.0 envelope whose id is derived from the record's ID and
+// version, so a change published twice is one event. A
+// delivery that runs out of attempts moves to the dead-letter queue: GET
+// /admin/dead-letters lists them with their failures, and POST
+// /admin/dead-letters/{id}/requeue retries one once its URL is fixed. GET
+// /webhooks/{id}/deliveries shows a tenant every attempt at delivering one
+// of its events, with what the receiver answered.
+//
+// The periodic tasks – key sweeps, compaction checks, backups, archival – are
+// enqueued on cron schedules. Each interval setting has a *_SCHEDULE
+// counterpart taking a cron expression in UTC, e.g.
+// BACKUP_SCHEDULE="0 3 * * *" for a backup at 03:00 every day, and GET
+// /admin/schedules shows when each task last ran and runs next.
+//
+// GRPC_PORT starts a gRPC server for the same API on that port; see
+// proto/chargeback/v1/chargeback.proto. It shares authentication, tenants
+// and TLS with the HTTP server, and mutating calls carrying an
+// "idempotency-key" metadata entry are deduplicated.
+//
+// POST /graphql serves the same API as GraphQL (see
+// graphqlapi/schema.graphql). Every mutation takes an idempotencyKey argument
+// and is deduplicated the same way as gRPC calls.
+//
+// RECORD_REQUESTS=true records every request to the REST API, without its
+// credentials, in the database. "cbctl -db <file> replay" re-sends them to a
+// fresh database and checks that it ends up with the same records: a check
+// that the API, its retries included, is deterministic.
+//
+// The React frontend is served at / when it is built into the binary: run
+// "npm run build" in ../frontend, then build the server. It is served from the
+// same origin as the API, as it is by the Vite dev server's proxy, so neither
+// needs CORS; CORS_ORIGINS only matters for other browser clients.
+//
+// Every response carries X-Content-Type-Options: nosniff, Referrer-Policy
+// (REFERRER_POLICY), Content-Security-Policy (CSP) and, over TLS,
+// Strict-Transport-Security (HSTS_MAX_AGE). The frontend's routes get
+// FRONTEND_CSP instead, as they load scripts and styles the API's policy
+// refuses.
+//
+// SIGNING_SECRET requires API requests to be signed: X-Signature carries the
+// hex HMAC-SHA256 of "METHOD\nURI\nTIMESTAMP\nNONCE\n" and the body, with
+// the Unix time in X-Signature-Timestamp and a fresh nonce in
+// X-Signature-Nonce. Requests more than SIGNING_MAX_SKEW (default 5m) off the
+// server's clock, or reusing a nonce, are refused with 401: a captured
+// request cannot be sent again. Retries are signed anew, so idempotency keys
+// still make them safe.
+//
+// Behind a reverse proxy, set TRUSTED_PROXIES to its addresses (e.g.
+// "10.0.0.0/8"): requests from them are attributed to the client their
+// X-Forwarded-For names, for rate limiting, the request log and the IP
+// filter. IP_ALLOW, when set, serves only the clients it lists, probes
+// included, and IP_DENY refuses the ones it lists with 403.
+//
+// GET /healthz reports liveness and GET /readyz reports whether the store is
+// reachable. On SIGINT/SIGTERM readiness flips to 503 and, if
+// SHUTDOWN_DRAIN_DELAY is set (e.g. "5s"), the server keeps serving for that
+// long before shutting down gracefully.
 package main
 
 import (
-	"log"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"google.golang.org/grpc"
 
+	"github.com/arkantrust/idempotency-example/backend/auth"
+	"github.com/arkantrust/idempotency-example/backend/backup"
+	"github.com/arkantrust/idempotency-example/backend/config"
+	"github.com/arkantrust/idempotency-example/backend/graphqlapi"
 	"github.com/arkantrust/idempotency-example/backend/handlers"
+	"github.com/arkantrust/idempotency-example/backend/jobs"
+	"github.com/arkantrust/idempotency-example/backend/metrics"
+	"github.com/arkantrust/idempotency-example/backend/middleware"
+	"github.com/arkantrust/idempotency-example/backend/openapi"
+	_ "github.com/arkantrust/idempotency-example/backend/plugins/auditlog"
+	"github.com/arkantrust/idempotency-example/backend/service"
 	"github.com/arkantrust/idempotency-example/backend/store"
+	"github.com/arkantrust/idempotency-example/backend/store/breaker"
+	"github.com/arkantrust/idempotency-example/backend/store/raft"
+	"github.com/arkantrust/idempotency-example/backend/store/retry"
+	"github.com/arkantrust/idempotency-example/backend/store/shadow"
+	"github.com/arkantrust/idempotency-example/backend/tracing"
+	"github.com/arkantrust/idempotency-example/backend/web"
+	"github.com/arkantrust/idempotency-example/backend/webhook"
 )
 
 func main() {
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	cfg, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
 	}
+	if err != nil {
+		fatal("invalid configuration", "err", err)
+	}
+
+	logger, err := newLogger(cfg.Log)
+	if err != nil {
+		fatal("invalid log configuration", "err", err)
+	}
+	slog.SetDefault(logger)
 
-	dbPath := os.Getenv("DB_PATH")
-	if dbPath == "" {
-		dbPath = "chargebacks.db"
+	if cfg.BenchServer {
+		if err := benchServer(filepath.Dir(cfg.DBPath)); err != nil {
+			fatal("benchmark failed", "err", err)
+		}
+		return
 	}
 
-	s, err := store.New(dbPath)
+	openStore := store.New
+	if cfg.Mode.Start == string(store.ModeReadOnly) {
+		openStore = store.NewReadOnly
+	}
+	s, err := openStore(cfg.DBPath)
 	if err != nil {
-		log.Fatalf("failed to open database: %v", err)
+		fatal("failed to open database", "path", cfg.DBPath, "err", err)
 	}
 	defer s.Close()
 
-	h := handlers.New(s)
+	if opts := boltOptions(cfg.Bolt); opts != s.Options() {
+		if err := s.SetOptions(opts); err != nil {
+			fatal("failed to apply database options", "err", err)
+		}
+	}
+	if s.Options().NoSync {
+		slog.Warn("commits are not fsynced: a machine crash can lose the latest writes", "durability", cfg.Bolt.Durability)
+	}
+
+	s.SetTimeout(cfg.DBTimeout)
+
+	codec, err := store.CodecByName(cfg.DBEncoding)
+	if err != nil {
+		fatal("invalid configuration", "err", err)
+	}
+	s.SetCodec(codec)
+
+	if mode := store.Mode(cfg.Mode.Start); mode != s.Mode() {
+		if err := s.SetMode(mode); err != nil {
+			fatal("invalid configuration", "err", err)
+		}
+	}
+	if s.Mode() != store.ModeReadWrite {
+		slog.Warn("writes are disabled", "mode", s.Mode())
+	}
+
+	if len(cfg.Encryption.Keys) > 0 {
+		keys, err := store.ParseKeys(cfg.Encryption.Keys)
+		if err != nil {
+			fatal("invalid encryption configuration", "err", err)
+		}
+		s.SetKeys(keys)
+		slog.Info("field encryption enabled", "keys", len(cfg.Encryption.Keys))
+	}
+
+	if cfg.MigrateOnStart {
+		st, err := s.Reencode(context.Background())
+		if err != nil {
+			fatal("migration failed", "err", err)
+		}
+		slog.Info("records migrated", "schemaVersion", st.SchemaVersion, "codec", st.Codec, "scanned", st.Scanned, "rewritten", st.Rewritten)
+	}
+
+	if cfg.Idempotency.KeyTTL > 0 {
+		s.SetKeyTTL(cfg.Idempotency.KeyTTL)
+	}
+
+	if policy, _ := cfg.Policy.Rules(); policy != nil { // validated by config.Load
+		s.SetPolicy(policy)
+		slog.Info("chargeback policy enabled", "maxAmounts", len(policy.MaxAmounts), "disallowedReasons", len(policy.DisallowedReasons), "merchantVelocity", policy.MerchantVelocity != nil)
+	}
+
+	if cfg.Batch.MaxSize > 0 {
+		s.SetBatching(cfg.Batch.MaxSize, cfg.Batch.Delay)
+		slog.Info("write batching enabled", "maxSize", cfg.Batch.MaxSize, "delay", cfg.Batch.Delay)
+	}
+
+	if cfg.Restore != "" {
+		if err := s.Restore(context.Background(), cfg.Restore); err != nil {
+			fatal("restore failed", "snapshot", cfg.Restore, "err", err)
+		}
+		slog.Info("database restored", "path", cfg.DBPath, "snapshot", cfg.Restore)
+	}
+
+	// ctx is cancelled on SIGINT/SIGTERM, which starts a graceful shutdown.
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	shutdownTracing, err := tracing.Setup(ctx, tracing.Options{
+		Exporter:    cfg.Tracing.Exporter,
+		Endpoint:    cfg.Tracing.Endpoint,
+		Insecure:    cfg.Tracing.Insecure,
+		SampleRatio: cfg.Tracing.SampleRatio,
+		ServiceName: cfg.Tracing.ServiceName,
+	})
+	if err != nil {
+		fatal("failed to set up tracing", "err", err)
+	}
+
+	// Backups, archival and webhook deliveries run as jobs of one queue,
+	// which keeps them across restarts and retries them when they fail.
+	queue := jobs.New(s)
+	queue.Workers = cfg.Jobs.Workers
+	queue.MaxAttempts = cfg.Jobs.MaxAttempts
+	queue.RetryDelay = cfg.Jobs.RetryDelay
+	queue.Handle(archiveJob, archiveHandler(s))
+	queue.Handle(webhook.JobKind, webhook.Deliver(&http.Client{Timeout: cfg.Webhook.Timeout}, s))
+	queue.DeadLetter(webhook.JobKind)
+
+	// Periodic tasks are enqueued on cron schedules; GET /admin/schedules
+	// shows when each last ran and runs next.
+	schedules := jobs.NewScheduler(queue)
+	schedule := func(name, spec string, payload func(at time.Time) any) {
+		if err := schedules.Add(name, spec, name, payload); err != nil {
+			fatal("invalid schedule", "name", name, "err", err) // validated by config.Load
+		}
+		slog.Info("scheduled "+name, "schedule", spec)
+	}
+
+	if spec := cfg.Backup.Spec(); spec != "" {
+		sched := &backup.Scheduler{
+			Source: s,
+			Dir:    cfg.Backup.Dir,
+			Keep:   cfg.Backup.Keep,
+		}
+		queue.Handle(backupJob, backupHandler(sched))
+		schedule(backupJob, spec, func(at time.Time) any { return backupPayload{At: at} })
+		slog.Info("automatic backups enabled", "dir", sched.Dir, "keep", sched.Keep)
+	}
+
+	if cfg.Compaction.Threshold > 0 {
+		queue.Handle(compactJob, compactHandler(s))
+		schedule(compactJob, cfg.Compaction.Spec(), func(time.Time) any {
+			return compactPayload{Threshold: cfg.Compaction.Threshold}
+		})
+	}
+
+	if cfg.Retention.Days > 0 {
+		schedule(archiveJob, cfg.Retention.Spec(), func(at time.Time) any {
+			return archivePayload{Before: at.AddDate(0, 0, -cfg.Retention.Days)}
+		})
+		slog.Info("retention enabled", "days", cfg.Retention.Days)
+	}
+
+	if cfg.Idempotency.KeyTTL > 0 {
+		queue.Handle(sweepKeysJob, sweepHandler(s))
+		schedule(sweepKeysJob, cfg.Idempotency.SweepSchedule, func(at time.Time) any { return sweepPayload{At: at} })
+		slog.Info("idempotency keys expire", "ttl", cfg.Idempotency.KeyTTL)
+	}
+
+	if cfg.Signing.Enabled() {
+		queue.Handle(sweepNoncesJob, sweepNoncesHandler(s))
+		schedule(sweepNoncesJob, cfg.Idempotency.SweepSchedule, func(at time.Time) any { return sweepPayload{At: at} })
+	}
+
+	if cfg.Quota.Enabled() {
+		queue.Handle(sweepUsageJob, sweepUsageHandler(s))
+		schedule(sweepUsageJob, cfg.Idempotency.SweepSchedule, func(at time.Time) any { return sweepPayload{At: at} })
+	}
+
+	backend := service.Local(s)
+	if cfg.Shadow.DBPath != "" {
+		shadowStore, err := openShadow(cfg)
+		if err != nil {
+			fatal("failed to open shadow database", "path", cfg.Shadow.DBPath, "err", err)
+		}
+		defer shadowStore.Close()
+		backend = shadow.New(backend, service.Local(shadowStore))
+		slog.Warn("mirroring chargeback writes to a shadow database", "path", cfg.Shadow.DBPath)
+	}
+	if cfg.Raft.NodeID != "" {
+		peers, _ := cfg.Raft.PeerMap() // validated by config.Load
+		node, err := raft.Open(raft.Config{ID: cfg.Raft.NodeID, Addr: cfg.Raft.Addr, Dir: cfg.Raft.Dir, Peers: peers}, s)
+		if err != nil {
+			fatal("failed to start raft", "err", err)
+		}
+		defer node.Close()
+		backend = node
+		slog.Info("replicating chargeback writes", "node", cfg.Raft.NodeID, "addr", cfg.Raft.Addr, "peers", len(peers))
+	}
+	if cfg.Retry.Attempts > 1 {
+		backend = retry.New(backend, retry.Policy{Attempts: cfg.Retry.Attempts, MinBackoff: cfg.Retry.MinBackoff, MaxBackoff: cfg.Retry.MaxBackoff})
+	}
+	// The breaker sits outside retries, so an operation retried to no
+	// avail is one failure, and an open breaker is not retried.
+	var circuit *breaker.Breaker
+	if cfg.Breaker.Failures > 0 {
+		circuit = breaker.NewBreaker(breaker.Policy{Failures: cfg.Breaker.Failures, Cooldown: cfg.Breaker.Cooldown})
+		backend = breaker.New(backend, circuit)
+	}
+	svc := service.NewChargebacksOn(backend)
+	svc.KeyFormat, err = service.NewKeyFormat(cfg.Idempotency.KeyFormat, cfg.Idempotency.KeyPattern)
+	if err != nil {
+		fatal("invalid idempotency configuration", "err", err)
+	}
+	if err := svc.EnablePlugins(cfg.Plugins...); err != nil {
+		fatal("failed to enable plugins", "err", err)
+	}
+	if len(cfg.Plugins) > 0 {
+		slog.Info("plugins enabled", "plugins", cfg.Plugins)
+	}
+	if len(cfg.Webhook.URLs) > 0 {
+		svc.Events = &webhook.Publisher{Queue: queue, URLs: cfg.Webhook.URLs, Source: cfg.Webhook.Source}
+		slog.Info("webhooks enabled", "urls", len(cfg.Webhook.URLs))
+	}
+	if cfg.Rates.Provider != "" {
+		provider, err := ratesProvider(cfg.Rates)
+		if err != nil {
+			fatal("invalid exchange rates", "err", err)
+		}
+		queue.Handle(ratesJob, ratesHandler(provider, s))
+		schedule(ratesJob, cfg.Rates.Spec(), func(at time.Time) any { return ratesPayload{At: at} })
+		// Fetch the rates now rather than at the first scheduled refresh
+		// if none are cached yet.
+		if _, err := s.ExchangeRates(ctx); errors.Is(err, store.ErrNotFound) {
+			if _, _, err := queue.Enqueue(ctx, ratesJob, "", ratesPayload{At: time.Now()}); err != nil {
+				slog.Warn("failed to enqueue an exchange rate refresh", "err", err)
+			}
+		}
+		svc.Rates = s
+		slog.Info("stats conversion enabled", "provider", cfg.Rates.Provider)
+	}
+	go queue.Run(ctx)
+	go schedules.Run(ctx)
+	h := handlers.New(s, svc)
+	h.MaxBodyBytes = int64(cfg.Server.MaxBodyBytes)
+	h.MaxUploadBytes = int64(cfg.Server.MaxUploadBytes)
+	h.StrictJSON = cfg.Server.StrictJSON
+	h.Policy = handlers.ResponsePolicy{DeleteStatus: cfg.Server.DeleteStatus, DuplicateStatus: cfg.Server.DuplicateStatus}
+	h.RetryAfter = cfg.Mode.RetryAfter
+	h.Scheduler = schedules
+	dedup := service.NewDedup(s)
+	if cfg.Idempotency.Strict {
+		h.StrictKeys = dedup
+	}
+	if cfg.Server.AsyncWorkers > 0 {
+		h.Async = service.NewOperations(svc, s)
+		h.Async.Workers = cfg.Server.AsyncWorkers
+		go h.Async.Run(ctx)
+	}
+	gql := graphqlapi.New(svc, dedup)
+	gql.MaxBodyBytes = int64(cfg.Server.MaxBodyBytes)
+	probes := handlers.NewProbes(s)
+	probes.Breaker = circuit
+	cors := middleware.CORS(middleware.CORSOptions{
+		AllowedOrigins:   cfg.CORS.AllowedOrigins,
+		AllowCredentials: cfg.CORS.AllowCredentials,
+		MaxAge:           cfg.CORS.MaxAge,
+		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowedHeaders:   []string{"Content-Type", "Authorization", auth.HeaderAPIKey, auth.HeaderTenant, handlers.StrictHeader, handlers.StrictVersionHeader, handlers.IfMatchHeader, handlers.IdempotencyKeyHeader, handlers.PreferHeader, handlers.APIVersionHeader, handlers.UpdateMaskHeader, middleware.RequestIDHeader, middleware.SimulateHeader, "traceparent", "tracestate"},
+		ExposedHeaders: []string{
+			"X-Idempotency-Write", handlers.ReplayedHeader, handlers.OriginalCreatedAtHeader,
+			"Location", handlers.ETagHeader, handlers.FencingTokenHeader, handlers.PreferenceAppliedHeader, handlers.APIVersionHeader, middleware.RequestIDHeader, "Retry-After",
+			"RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "RateLimit-Policy",
+		},
+	})
+
+	// Security headers are set outside Recover, so a 500 answering a panic
+	// carries them too.
+	security := middleware.SecurityHeaders(middleware.SecurityOptions{
+		HSTSMaxAge:            cfg.Security.HSTSMaxAge,
+		ReferrerPolicy:        cfg.Security.ReferrerPolicy,
+		ContentSecurityPolicy: cfg.Security.ContentSecurityPolicy,
+	})
+
+	// The client's address is resolved before the request is logged, and
+	// refused clients are still logged and counted.
+	trusted, allow, deny, err := cfg.Network.Prefixes()
+	if err != nil {
+		fatal("invalid network configuration", "err", err)
+	}
+	clientIP := middleware.TrustProxies(trusted)
+	ipFilter := middleware.FilterIPs(allow, deny)
 
 	mux := http.NewServeMux()
 
-	// CORS middleware wraps every route so the React frontend (served on a
-	// different port during development) can reach the API.
-	mux.Handle("GET /chargebacks", corsMiddleware(http.HandlerFunc(h.ServeHTTP)))
-	mux.Handle("POST /chargebacks/{id}", corsMiddleware(http.HandlerFunc(h.ServeHTTP)))
-	mux.Handle("PUT /chargebacks/{id}", corsMiddleware(http.HandlerFunc(h.ServeHTTP)))
-	mux.Handle("DELETE /chargebacks/{id}", corsMiddleware(http.HandlerFunc(h.ServeHTTP)))
+	// Every route is registered through a router, which stacks the
+	// middleware of a group of routes once: root has none, browser adds
+	// CORS for browser clients on other origins, api authentication, tenant
+	// selection and rate limiting, and each API route its scope check and
+	// what runs closest to the handler.
+	root := middleware.NewRouter(mux)
+
+	root.Handle("GET /metrics", promhttp.HandlerFor(metrics.Registry, promhttp.HandlerOpts{}))
+
+	if cfg.Debug.Enabled {
+		mountDebug(root, cfg.Debug.Token)
+		if cfg.Debug.Token == "" {
+			slog.Warn("debug endpoints enabled without a token")
+		}
+	}
+
+	authn := &auth.Authenticator{Keys: s, Required: cfg.Auth.Required}
+	if cfg.Auth.JWT.Enabled() {
+		authn.JWT, err = auth.NewJWTVerifier(auth.JWTOptions{
+			Secret:   cfg.Auth.JWT.Secret,
+			JWKSURL:  cfg.Auth.JWT.JWKSURL,
+			Issuer:   cfg.Auth.JWT.Issuer,
+			Audience: cfg.Auth.JWT.Audience,
+		})
+		if err != nil {
+			fatal("invalid JWT configuration", "err", err)
+		}
+	}
+
+	browser := root.With(cors)
+	api := browser.With(authn.Middleware, auth.Tenant)
+
+	// Signatures are checked before anything else on the API routes, so an
+	// unsigned or replayed request never reaches authentication. Preflight
+	// requests, which browsers cannot sign, are answered by CORS first.
+	if cfg.Signing.Enabled() {
+		api = browser.With(middleware.VerifySignature(middleware.SignatureOptions{
+			Secret:  []byte(cfg.Signing.Secret),
+			Nonces:  s,
+			MaxSkew: cfg.Signing.MaxSkew,
+			MaxBody: int64(max(cfg.Server.MaxBodyBytes, cfg.Server.MaxUploadBytes)),
+		}), authn.Middleware, auth.Tenant)
+		slog.Info("request signatures required", "maxSkew", cfg.Signing.MaxSkew)
+	}
+
+	// Rate limiting is off unless configured, and limited to
+	// RATE_LIMIT_METHODS when that is set. It sits inside CORS so that
+	// preflight requests, answered by the CORS middleware, are never counted,
+	// and inside authentication so that clients are keyed by who they are
+	// rather than where they connect from.
+	if cfg.RateLimit.Rate > 0 {
+		rl := middleware.NewRateLimiter(cfg.RateLimit.Rate, cfg.RateLimit.Burst)
+		rl.KeyFunc = func(r *http.Request) string {
+			if p, ok := auth.PrincipalFrom(r.Context()); ok {
+				return p.Owner()
+			}
+			return middleware.ClientIP(r)
+		}
+		limit := rl.Middleware
+		if len(cfg.RateLimit.Methods) > 0 {
+			limit = middleware.ForMethods(limit, cfg.RateLimit.Methods...)
+		}
+		api.Use(limit)
+	}
+
+	// Quotas count the requests rate limiting let through, so a throttled
+	// client does not use up its quota as well.
+	if cfg.Quota.Enabled() {
+		api.Use(middleware.Quota(s, store.Quota{Daily: int64(cfg.Quota.Daily), Monthly: int64(cfg.Quota.Monthly)}, func(r *http.Request) string {
+			if p, ok := auth.PrincipalFrom(r.Context()); ok {
+				return p.Owner()
+			}
+			return ""
+		}))
+		slog.Info("counting usage", "dailyQuota", cfg.Quota.Daily, "monthlyQuota", cfg.Quota.Monthly)
+	}
+
+	// The bulkhead comes last, so a slot is only held by a write that will
+	// be served, not by one about to be throttled.
+	if cfg.Concurrency.MaxWrites > 0 {
+		bh := middleware.NewBulkhead(cfg.Concurrency.MaxWrites, cfg.Concurrency.QueueTimeout)
+		api.Use(middleware.ForMethods(bh.Middleware, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete))
+		slog.Info("capping concurrent writes", "max", cfg.Concurrency.MaxWrites, "queueTimeout", cfg.Concurrency.QueueTimeout)
+	}
+
+	// Load shedding times the writes inside the bulkhead, so that the
+	// writes the bulkhead refuses, answered at once, do not hide the slow
+	// ones. It refuses the sheddable routes registered below.
+	var shed middleware.Chain
+	if cfg.LoadShed.Threshold > 0 {
+		ls := middleware.NewLoadShedder(cfg.LoadShed.Threshold, cfg.LoadShed.Window, cfg.LoadShed.MinSamples)
+		api.Use(middleware.ForMethods(ls.Observe, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete))
+		shed = shed.Append(ls.Shed)
+		slog.Info("shedding load", "latency", cfg.LoadShed.Threshold, "window", cfg.LoadShed.Window)
+	}
+
+	// Fault injection sits just outside the handlers, so a dropped response
+	// follows a write that really happened.
+	var faults middleware.Chain
+	if cfg.Chaos.Simulate {
+		faults = faults.Append(middleware.Simulate)
+		slog.Warn("X-Simulate enabled: clients can have their responses dropped")
+	}
+	if cfg.Chaos.Rate > 0 {
+		faults = faults.Append(middleware.NewChaos(cfg.Chaos.Rate, cfg.Chaos.MaxDelay).Middleware)
+		slog.Warn("chaos enabled: injecting faults into API requests", "rate", cfg.Chaos.Rate, "maxDelay", cfg.Chaos.MaxDelay)
+	}
+
+	// Recording sits inside fault injection, so that it keeps the status the
+	// handler chose, and only on the REST routes, which replay re-sends.
+	var record middleware.Chain
+	if cfg.RecordRequests {
+		record = record.Append(middleware.Record(s, int64(cfg.Server.MaxBodyBytes)))
+		slog.Warn("recording API requests: the request log grows until the database is replaced")
+	}
+
+	// Writes the store's mode refuses are answered before the handler runs.
+	readOnly := middleware.RejectWrites(func() bool { return s.Mode() != store.ModeReadWrite }, cfg.Mode.RetryAfter)
+
+	// The /admin routes take the admin bearer token or credentials with the
+	// admin role instead. They are only open to anyone when there is no
+	// token and authentication is off, so enabling AUTH_REQUIRED never
+	// leaves key management open.
+	admin := browser.With(authn.RequireAdmin(cfg.Auth.AdminToken))
+
+	// Every documented route is registered from the route table, and only
+	// registered routes are documented. The API routes check that the
+	// caller was granted the route's scopes, then the write mode.
+	var routes []openapi.Route
+	for _, rt := range append(probes.Routes(), h.Routes()...) {
+		var group *middleware.Router
+		switch rt.Access {
+		case openapi.Public:
+			// Probes are not wrapped in CORS: they are for orchestrators,
+			// not browsers.
+			group = root
+		case openapi.Read, openapi.Write:
+			group = api.With(auth.RequireScope(rt.Scopes...), readOnly)
+			if rt.Sheddable {
+				group = group.With(shed...)
+			}
+			group = group.With(faults...).With(record...)
+		case openapi.Admin:
+			group = admin
+		}
+		group.Handle(rt.Method+" "+rt.Pattern, rt.Handler)
+		routes = append(routes, rt)
+	}
+
+	// GraphQL carries reads and writes on one route, so the resolvers check
+	// the scope of each field instead of RequireScope.
+	api.With(faults...).Handle("POST /graphql", gql)
+
+	spec := openapi.Document(openapi.Info{Title: "Idempotency example", Version: "1.0.0"}, routes)
+	browser.HandleFunc("GET /openapi.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(spec) //nolint:errcheck
+	})
+
+	// The frontend takes every GET no other route matches, so client-side
+	// routes can be reloaded.
+	if app, ok := web.Frontend(); ok {
+		root.With(middleware.ContentSecurityPolicy(cfg.Security.FrontendContentSecurityPolicy)).Handle("GET /", web.Handler(app))
+	} else {
+		slog.Info("frontend not built into this binary; run npm run build in frontend/ and rebuild to serve it")
+	}
 
 	// Handle pre-flight OPTIONS requests for all paths.
-	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == http.MethodOptions {
-			setCORSHeaders(w)
-			w.WriteHeader(http.StatusNoContent)
+	browser.HandleFunc("/", http.NotFound)
+
+	tlsConfig, err := newTLSConfig(cfg.TLS)
+	if err != nil {
+		fatal("invalid TLS configuration", "err", err)
+	}
+
+	srv := &http.Server{
+		Addr:              ":" + cfg.Port,
+		Handler:           middleware.RequestID(middleware.Tracing(clientIP(middleware.Logger(logger)(middleware.Metrics(ipFilter(security(middleware.Recover(mux)))))))),
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+		ReadTimeout:       cfg.Server.ReadTimeout,
+		WriteTimeout:      cfg.Server.WriteTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
+		MaxHeaderBytes:    cfg.Server.MaxHeaderBytes,
+		TLSConfig:         httpsConfig(cfg.TLS, tlsConfig),
+	}
+
+	errc := make(chan error, 2)
+	go func() {
+		slog.Info("listening", "addr", srv.Addr, "db", cfg.DBPath, "tls", tlsConfig != nil, "mtls", cfg.TLS.ClientCAFile != "")
+		if tlsConfig != nil {
+			// Certificates come from TLSConfig, so no files are passed here.
+			errc <- srv.ListenAndServeTLS("", "")
 			return
 		}
-		http.NotFound(w, r)
-	})
+		errc <- srv.ListenAndServe()
+	}()
+
+	var grpcSrv *grpc.Server
+	if cfg.GRPCPort != "" {
+		lis, err := net.Listen("tcp", ":"+cfg.GRPCPort)
+		if err != nil {
+			fatal("failed to listen for gRPC", "port", cfg.GRPCPort, "err", err)
+		}
+		grpcSrv = newGRPCServer(svc, dedup, authn, tlsConfig)
+		go func() {
+			slog.Info("listening for gRPC", "addr", lis.Addr().String(), "tls", tlsConfig != nil)
+			errc <- grpcSrv.Serve(lis)
+		}()
+	}
+
+	select {
+	case err := <-errc:
+		fatal("server error", "err", err)
+	case <-ctx.Done():
+	}
+
+	// Flip readiness first and give load balancers the drain delay to notice
+	// before the listener closes. In-flight requests then get up to ten
+	// seconds to complete.
+	probes.Drain()
+	if d := cfg.Server.ShutdownDrainDelay; d > 0 {
+		slog.Info("draining", "delay", d)
+		time.Sleep(d)
+	}
 
-	log.Printf("listening on :%s (db: %s)", port, dbPath)
-	if err := http.ListenAndServe(":"+port, mux); err != nil {
-		log.Fatalf("server error: %v", err)
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancelShutdown()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		slog.Error("shutdown error", "err", err)
 	}
+	if grpcSrv != nil {
+		grpcSrv.GracefulStop()
+	}
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		slog.Error("failed to flush traces", "err", err)
+	}
+	slog.Info("server stopped")
 }
 
-// setCORSHeaders adds CORS headers to a response.
-func setCORSHeaders(w http.ResponseWriter) {
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-	w.Header().Set("Access-Control-Expose-Headers", "X-Idempotency-Write")
+// newLogger builds the process-wide logger from the log configuration.
+func newLogger(cfg config.LogConfig) (*slog.Logger, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(cfg.Level)); err != nil {
+		return nil, err
+	}
+	opts := &slog.HandlerOptions{Level: level}
+
+	switch cfg.Format {
+	case "json":
+		return slog.New(middleware.ContextLogHandler{Handler: slog.NewJSONHandler(os.Stderr, opts)}), nil
+	case "text":
+		return slog.New(middleware.ContextLogHandler{Handler: slog.NewTextHandler(os.Stderr, opts)}), nil
+	default:
+		return nil, fmt.Errorf("unknown log format %q", cfg.Format)
+	}
 }
 
-// corsMiddleware wraps an http.Handler with CORS support.
-func corsMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		setCORSHeaders(w)
-		if r.Method == http.MethodOptions {
-			w.WriteHeader(http.StatusNoContent)
-			return
-		}
-		next.ServeHTTP(w, r)
-	})
+// boltOptions returns the options of the durability cfg names, adjusted by
+// its other settings.
+func boltOptions(cfg config.BoltConfig) store.Options {
+	opts, _ := store.DurabilityOptions(cfg.Durability) // validated by config.Load
+	opts.NoSync = opts.NoSync || cfg.NoSync
+	opts.NoGrowSync = opts.NoGrowSync || cfg.NoGrowSync
+	if cfg.InitialMmapSize > 0 {
+		opts.InitialMmapSize = cfg.InitialMmapSize
+	}
+	if cfg.MmapFlags != 0 {
+		opts.MmapFlags = cfg.MmapFlags
+	}
+	return opts
+}
+
+// fatal logs msg at error level and exits. It replaces log.Fatalf now that
+// all output goes through slog.
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
 }
@@ -0,0 +1,153 @@
+// Package metrics defines the Prometheus metrics exported at /metrics.
+//
+// The idempotency counters are the point of this package: they make the
+// write-avoidance claims in the store documentation measurable. A high ratio
+// of replayed creates or skipped updates means clients are retrying and the
+// server is absorbing those retries without extra writes.
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+// Registry holds every metric exported by the server. A dedicated registry
+// (rather than prometheus.DefaultRegisterer) keeps tests free of global
+// registration conflicts.
+var Registry = prometheus.NewRegistry()
+
+var (
+	// Creates counts POST outcomes: "created" or "replayed".
+	Creates = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "chargeback_creates_total",
+		Help: "Chargeback creates by outcome (created, replayed).",
+	}, []string{"result"})
+
+	// Updates counts PUT outcomes: "written", "skipped" or "conflict".
+	Updates = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "chargeback_updates_total",
+		Help: "Chargeback updates by outcome (written, skipped, conflict).",
+	}, []string{"result"})
+
+	// Deletes counts DELETE outcomes: "deleted", "missing" or
+	// "precondition_failed".
+	Deletes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "chargeback_deletes_total",
+		Help: "Chargeback deletes by outcome (deleted, missing, precondition_failed).",
+	}, []string{"result"})
+
+	// Reads counts store reads by operation (get, list) and whether they ran
+	// a transaction ("executed") or shared an identical concurrent one
+	// ("collapsed").
+	Reads = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "store_reads_total",
+		Help: "Store reads by operation (get, list) and result (executed, collapsed).",
+	}, []string{"op", "result"})
+
+	// RequestDuration observes HTTP handler latency by route pattern.
+	RequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "HTTP request latency by method, route and status code.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	// TxDuration observes BoltDB transaction latency by kind (view, update,
+	// batch).
+	TxDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "bolt_tx_duration_seconds",
+		Help:    "BoltDB transaction latency by kind (view, update).",
+		Buckets: []float64{.0001, .00025, .0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+	}, []string{"kind"})
+
+	// BackupLastSuccess is the Unix time of the last successful scheduled
+	// backup. Alert when time() minus this exceeds a few backup intervals.
+	BackupLastSuccess = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "backup_last_success_timestamp_seconds",
+		Help: "Unix time of the last successful scheduled backup.",
+	})
+
+	// Backups counts scheduled backup runs by outcome (success, failure).
+	Backups = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "backups_total",
+		Help: "Scheduled backup runs by outcome (success, failure).",
+	}, []string{"result"})
+
+	// Archived counts the chargebacks moved into the archive by retention.
+	Archived = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "chargebacks_archived_total",
+		Help: "Chargebacks moved into the archive.",
+	})
+
+	// Jobs counts background jobs by kind and outcome: "enqueued", then
+	// "succeeded", "retried" or "failed" for every run.
+	Jobs = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "jobs_total",
+		Help: "Background jobs by kind and outcome (enqueued, succeeded, retried, failed).",
+	}, []string{"kind", "result"})
+
+	// ShadowDivergences counts the reads and writes whose outcome on the
+	// shadow store differed from the primary's, by operation.
+	ShadowDivergences = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "shadow_divergences_total",
+		Help: "Operations whose outcome on the shadow store differed from the primary's, by operation.",
+	}, []string{"op"})
+
+	// Panics counts the requests whose handler panicked.
+	Panics = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "http_panics_total",
+		Help: "Requests whose handler panicked.",
+	})
+
+	// StoreRetries counts the store operations retried after a transient
+	// error, by operation.
+	StoreRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "store_retries_total",
+		Help: "Store operations retried after a transient error, by operation.",
+	}, []string{"op"})
+
+	// QueuedRequests is the number of requests waiting for a slot of a
+	// bulkhead.
+	QueuedRequests = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "http_queued_requests",
+		Help: "Requests waiting for a slot to be served in.",
+	})
+
+	// Shed counts the requests refused with 503 to protect the server, by
+	// reason.
+	Shed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_shed_requests_total",
+		Help: "Requests refused with 503 to protect the server, by reason.",
+	}, []string{"reason"})
+
+	// LoadShedding is 1 while low-priority requests are shed because writes
+	// are slow, and 0 otherwise.
+	LoadShedding = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "http_load_shedding",
+		Help: "Whether low-priority requests are being shed because writes are slow (1) or not (0).",
+	})
+
+	// StoreCircuitState is the state of the circuit breaker around the
+	// store: 0 closed, 1 half-open, 2 open.
+	StoreCircuitState = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "store_circuit_state",
+		Help: "State of the circuit breaker around the store: 0 closed, 1 half-open, 2 open.",
+	})
+
+	// StoreCircuitRejections counts the store operations failed without
+	// trying while the circuit breaker was open.
+	StoreCircuitRejections = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "store_circuit_rejections_total",
+		Help: "Store operations failed without trying while the circuit breaker was open.",
+	})
+)
+
+func init() {
+	Registry.MustRegister(
+		Creates, Updates, Deletes, Reads,
+		RequestDuration, TxDuration,
+		BackupLastSuccess, Backups, Archived, Jobs, ShadowDivergences, StoreRetries, Panics,
+		StoreCircuitState, StoreCircuitRejections, QueuedRequests, Shed, LoadShedding,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
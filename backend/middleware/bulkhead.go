@@ -0,0 +1,72 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/arkantrust/idempotency-example/backend/metrics"
+)
+
+// Bulkhead caps the requests served at once. A request over the cap waits
+// up to a short time for a slot, then is shed with 503 and Retry-After.
+//
+// It is meant for writes: Bolt commits them one at a time, so beyond a few
+// at once more of them add nothing to throughput and only lengthen the
+// queue in front of the database. Shedding them early keeps the wait
+// bounded and tells clients to come back, which a write with an idempotency
+// key can do safely.
+type Bulkhead struct {
+	slots chan struct{}
+	wait  time.Duration
+}
+
+// NewBulkhead returns a Bulkhead serving up to max requests at once, each
+// other one waiting up to wait for a slot.
+func NewBulkhead(max int, wait time.Duration) *Bulkhead {
+	return &Bulkhead{slots: make(chan struct{}, max), wait: wait}
+}
+
+// Middleware applies the bulkhead. Requests waiting for a slot are counted
+// in the http_queued_requests metric and those shed in
+// http_shed_requests_total.
+func (b *Bulkhead) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case b.slots <- struct{}{}:
+		default:
+			if !b.queue(r) {
+				metrics.Shed.WithLabelValues("concurrency").Inc()
+				shed(w, "too many concurrent requests")
+				return
+			}
+		}
+		defer func() { <-b.slots }()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// queue waits for a slot, and reports whether r got one before the wait or
+// the request ended.
+func (b *Bulkhead) queue(r *http.Request) bool {
+	metrics.QueuedRequests.Inc()
+	defer metrics.QueuedRequests.Dec()
+	t := time.NewTimer(b.wait)
+	defer t.Stop()
+	select {
+	case b.slots <- struct{}{}:
+		return true
+	case <-t.C:
+	case <-r.Context().Done():
+	}
+	return false
+}
+
+// shed answers a request refused to protect the server with 503. Nothing
+// was processed, so it can be retried at once.
+func shed(w http.ResponseWriter, msg string) {
+	w.Header().Set("Retry-After", "1")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusServiceUnavailable)
+	fmt.Fprintf(w, `{"error":%q,"retryAfter":1}`+"\n", msg)
+}
@@ -0,0 +1,48 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/arkantrust/idempotency-example/backend/middleware"
+)
+
+func TestBulkhead(t *testing.T) {
+	entered, release := make(chan struct{}), make(chan struct{})
+	h := middleware.NewBulkhead(1, 50*time.Millisecond).Middleware(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		entered <- struct{}{}
+		<-release
+	}))
+	serve := func() int {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/chargebacks", nil))
+		return rec.Code
+	}
+
+	first := make(chan int)
+	go func() { first <- serve() }()
+	<-entered
+
+	// The slot is taken: a second write waits, then is shed.
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/chargebacks", nil))
+	if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") != "1" {
+		t.Fatalf("over the cap: status %d, Retry-After %q", rec.Code, rec.Header().Get("Retry-After"))
+	}
+
+	// A write queued while the slot frees up gets it.
+	second := make(chan int)
+	go func() { second <- serve() }()
+	time.Sleep(5 * time.Millisecond)
+	release <- struct{}{}
+	if code := <-first; code != http.StatusOK {
+		t.Fatalf("first: status %d", code)
+	}
+	<-entered
+	release <- struct{}{}
+	if code := <-second; code != http.StatusOK {
+		t.Fatalf("queued: status %d", code)
+	}
+}
@@ -0,0 +1,79 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// tag returns middleware that appends name to the X-Trace header of the
+// request before calling the next handler.
+func tag(name string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.Header.Add("X-Trace", name)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// echoTrace serves the X-Trace header of the request as the body.
+var echoTrace = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte(strings.Join(r.Header.Values("X-Trace"), ","))) //nolint:errcheck
+})
+
+func serve(h http.Handler, method, target string) string {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(method, target, nil))
+	return rec.Body.String()
+}
+
+func TestChainOrder(t *testing.T) {
+	base := NewChain(tag("a"), tag("b"))
+	if got := serve(base.Then(echoTrace), http.MethodGet, "/"); got != "a,b" {
+		t.Fatalf("got %q, want outermost first", got)
+	}
+
+	// Extending a chain twice must not let one extension overwrite the
+	// other's middleware.
+	x, y := base.Append(tag("x")), base.Append(tag("y"))
+	if got := serve(x.Then(echoTrace), http.MethodGet, "/"); got != "a,b,x" {
+		t.Fatalf("x: got %q", got)
+	}
+	if got := serve(y.Then(echoTrace), http.MethodGet, "/"); got != "a,b,y" {
+		t.Fatalf("y: got %q", got)
+	}
+}
+
+func TestForMethods(t *testing.T) {
+	h := ForMethods(tag("limited"), http.MethodPost)(echoTrace)
+	if got := serve(h, http.MethodPost, "/"); got != "limited" {
+		t.Fatalf("POST: got %q", got)
+	}
+	if got := serve(h, http.MethodGet, "/"); got != "" {
+		t.Fatalf("GET: got %q", got)
+	}
+}
+
+func TestRouterGroups(t *testing.T) {
+	mux := http.NewServeMux()
+	r := NewRouter(mux)
+	r.Use(tag("root"))
+	r.Group(func(g *Router) {
+		g.Use(tag("group"))
+		g.Handle("GET /in", echoTrace)
+	})
+	r.With(tag("with")).Handle("GET /with", echoTrace)
+	r.Handle("GET /out", echoTrace)
+
+	for target, want := range map[string]string{
+		"/in":   "root,group",
+		"/with": "root,with",
+		"/out":  "root",
+	} {
+		if got := serve(mux, http.MethodGet, target); got != want {
+			t.Errorf("%s: got %q, want %q", target, got, want)
+		}
+	}
+}
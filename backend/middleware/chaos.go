@@ -0,0 +1,142 @@
+package middleware
+
+import (
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"time"
+)
+
+// Chaos injects faults into a fraction of requests, for demonstrating that
+// retrying clients keep the data correct. Each faulty request gets one of:
+//
+//   - drop: the handler runs and commits, then the connection is closed
+//     without a response, as if the network failed on the way back;
+//   - error: the handler runs and commits, then the response is replaced by
+//     a 500, as if something failed after the write;
+//   - delay: the response is held for up to MaxDelay before the handler
+//     runs, long enough for impatient clients to time out and retry.
+//
+// The first two are the faults idempotency exists for: the client cannot
+// tell whether its request took effect, and only an idempotent endpoint makes
+// retrying it safe. Never enable Chaos in production.
+type Chaos struct {
+	rate float64
+
+	// MaxDelay bounds the delay fault.
+	MaxDelay time.Duration
+
+	rand func() float64
+}
+
+// Chaos faults, as reported in the X-Chaos response header and the log.
+const (
+	ChaosDrop  = "drop"
+	ChaosError = "error"
+	ChaosDelay = "delay"
+)
+
+// NewChaos returns middleware injecting a fault into a rate fraction (0–1) of
+// requests.
+func NewChaos(rate float64, maxDelay time.Duration) *Chaos {
+	return &Chaos{rate: rate, MaxDelay: maxDelay, rand: rand.Float64}
+}
+
+// pick returns the fault for one request, or "" for none.
+func (c *Chaos) pick() string {
+	if c.rand() >= c.rate {
+		return ""
+	}
+	switch f := c.rand(); {
+	case f < 1.0/3:
+		return ChaosDrop
+	case f < 2.0/3:
+		return ChaosError
+	}
+	return ChaosDelay
+}
+
+// Middleware applies the faults to next.
+func (c *Chaos) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fault := c.pick()
+		if fault == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		slog.WarnContext(r.Context(), "chaos: injecting fault", "fault", fault, "method", r.Method, "path", r.URL.Path)
+
+		switch fault {
+		case ChaosDelay:
+			d := time.Duration(c.rand() * float64(c.MaxDelay))
+			select {
+			case <-time.After(d):
+			case <-r.Context().Done():
+				// The client gave up; the handler still runs, so a
+				// write the client never hears about can still happen.
+			}
+			w.Header().Set("X-Chaos", fault)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if fault == ChaosDrop {
+			commitThenDrop(next, r)
+		}
+		// Let the handler commit into a response nobody will see.
+		next.ServeHTTP(&discardWriter{header: http.Header{}}, r)
+		w.Header().Set("X-Chaos", fault)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(`{"error":"injected fault"}` + "\n")) //nolint:errcheck
+	})
+}
+
+// SimulateHeader lets a client request a fault on a single request, for
+// scripted demonstrations. Its only value is SimulateDropResponse.
+const SimulateHeader = "X-Simulate"
+
+// SimulateDropResponse makes the server process the request fully and then
+// close the connection without responding: the write is committed, but the
+// client sees a network error and cannot know that. Retrying is only safe
+// because the endpoints are idempotent.
+const SimulateDropResponse = "drop-response"
+
+// Simulate returns middleware honouring SimulateHeader. Unknown values are
+// rejected with 400 before the handler runs, so a typo cannot turn into an
+// ordinary write. Like Chaos, it is for demonstrations only: any client can
+// use it, so never mount it in production.
+func Simulate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Header.Get(SimulateHeader) {
+		case "":
+			next.ServeHTTP(w, r)
+		case SimulateDropResponse:
+			slog.InfoContext(r.Context(), "simulating a dropped response", "method", r.Method, "path", r.URL.Path)
+			commitThenDrop(next, r)
+		default:
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, `{"error":"unknown %s value"}`+"\n", SimulateHeader)
+		}
+	})
+}
+
+// commitThenDrop runs next into a response nobody will see, then closes the
+// connection. It does not return.
+func commitThenDrop(next http.Handler, r *http.Request) {
+	next.ServeHTTP(&discardWriter{header: http.Header{}}, r)
+	// The server closes the connection without a response and without
+	// logging a stack trace.
+	panic(http.ErrAbortHandler)
+}
+
+// discardWriter is a ResponseWriter that throws the response away.
+type discardWriter struct {
+	header http.Header
+}
+
+func (d *discardWriter) Header() http.Header         { return d.header }
+func (d *discardWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (d *discardWriter) WriteHeader(int)             {}
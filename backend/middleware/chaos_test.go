@@ -0,0 +1,103 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fixedRand returns the given values in turn.
+func fixedRand(vals ...float64) func() float64 {
+	i := 0
+	return func() float64 {
+		v := vals[i%len(vals)]
+		i++
+		return v
+	}
+}
+
+func TestChaosFaultsRunTheHandler(t *testing.T) {
+	var calls atomic.Int32
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusCreated)
+	})
+
+	c := NewChaos(0.5, time.Millisecond)
+	srv := httptest.NewServer(c.Middleware(h))
+	defer srv.Close()
+	post := func() (*http.Response, error) {
+		return http.Post(srv.URL, "application/json", strings.NewReader("{}"))
+	}
+
+	// Below the rate the request passes through untouched.
+	c.rand = fixedRand(0.9)
+	resp, err := post()
+	if err != nil || resp.StatusCode != http.StatusCreated {
+		t.Fatalf("expected 201 without a fault, got %v %v", resp, err)
+	}
+	resp.Body.Close()
+
+	// A drop commits and then closes the connection.
+	c.rand = fixedRand(0.1, 0.1)
+	if resp, err := post(); err == nil {
+		resp.Body.Close()
+		t.Fatalf("expected a dropped connection, got %d", resp.StatusCode)
+	}
+
+	// An error commits and then answers 500.
+	c.rand = fixedRand(0.1, 0.5)
+	resp, err = post()
+	if err != nil || resp.StatusCode != http.StatusInternalServerError || resp.Header.Get("X-Chaos") != ChaosError {
+		t.Fatalf("expected an injected 500, got %v %v", resp, err)
+	}
+	resp.Body.Close()
+
+	// A delay still returns the handler's response.
+	c.rand = fixedRand(0.1, 0.9)
+	resp, err = post()
+	if err != nil || resp.StatusCode != http.StatusCreated || resp.Header.Get("X-Chaos") != ChaosDelay {
+		t.Fatalf("expected a delayed 201, got %v %v", resp, err)
+	}
+	resp.Body.Close()
+
+	if n := calls.Load(); n != 4 {
+		t.Fatalf("expected the handler to run 4 times, ran %d", n)
+	}
+}
+
+func TestSimulateDropResponse(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(Simulate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusCreated)
+	})))
+	defer srv.Close()
+	do := func(simulate string) (*http.Response, error) {
+		req, _ := http.NewRequest(http.MethodPost, srv.URL, strings.NewReader("{}"))
+		if simulate != "" {
+			req.Header.Set(SimulateHeader, simulate)
+		}
+		return http.DefaultClient.Do(req)
+	}
+
+	if resp, err := do(SimulateDropResponse); err == nil {
+		resp.Body.Close()
+		t.Fatalf("expected a dropped connection, got %d", resp.StatusCode)
+	}
+	if n := calls.Load(); n != 1 {
+		t.Fatalf("expected the handler to run before the drop, ran %d times", n)
+	}
+
+	resp, err := do("explode")
+	if err != nil || resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an unknown value, got %v %v", resp, err)
+	}
+	resp.Body.Close()
+	if n := calls.Load(); n != 1 {
+		t.Fatalf("expected the handler not to run for an unknown value, ran %d times", n)
+	}
+}
@@ -0,0 +1,115 @@
+package middleware
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strings"
+)
+
+type clientAddrKey struct{}
+
+// TrustProxies returns middleware that resolves the address of the client
+// behind the proxies in trusted, for ClientAddr and everything keyed by it.
+//
+// A request arriving from a trusted proxy names the client in
+// X-Forwarded-For. Each proxy appends the address it was reached from, so
+// the list is read from the right, skipping trusted proxies: the first
+// address left is the one the last trusted proxy saw connect, and the ones
+// before it are whatever the client chose to send. A request from anywhere
+// else is its own client, whatever its headers say.
+func TrustProxies(trusted []netip.Prefix) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			addr, ok := remoteAddr(r)
+			if ok && contains(trusted, addr) {
+				addr = forwardedFor(r, trusted, addr)
+				r = r.WithContext(context.WithValue(r.Context(), clientAddrKey{}, addr))
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// forwardedFor returns the client address X-Forwarded-For names for a
+// request proxied by from, or from if the header names none.
+func forwardedFor(r *http.Request, trusted []netip.Prefix, from netip.Addr) netip.Addr {
+	var hops []string
+	for _, v := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(v, ",")...)
+	}
+	for _, hop := range slices.Backward(hops) {
+		addr, err := netip.ParseAddr(strings.TrimSpace(hop))
+		if err != nil {
+			// Garbage the client sent, or a proxy we cannot read past.
+			return from
+		}
+		from = addr.Unmap()
+		if !contains(trusted, from) {
+			break
+		}
+	}
+	return from
+}
+
+// clientAddr returns the client address of r: the one TrustProxies resolved,
+// or the remote address.
+func clientAddr(r *http.Request) (netip.Addr, bool) {
+	if addr, ok := r.Context().Value(clientAddrKey{}).(netip.Addr); ok {
+		return addr, true
+	}
+	return remoteAddr(r)
+}
+
+func remoteAddr(r *http.Request) (netip.Addr, bool) {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	return addr.Unmap(), err == nil
+}
+
+// ClientAddr returns the address of the client that sent r, as resolved by
+// TrustProxies, or its remote address if it was not proxied.
+func ClientAddr(r *http.Request) string {
+	if addr, ok := clientAddr(r); ok {
+		return addr.String()
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// FilterIPs returns middleware that answers 403 to clients whose address,
+// as ClientAddr resolves it, is in deny or, when allow is not empty, not in
+// allow. A client whose address cannot be parsed is only let through when
+// there is no allowlist.
+func FilterIPs(allow, deny []netip.Prefix) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			addr, ok := clientAddr(r)
+			denied := ok && contains(deny, addr) || len(allow) > 0 && !(ok && contains(allow, addr))
+			if denied {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusForbidden)
+				w.Write([]byte(`{"error":"forbidden"}` + "\n")) //nolint:errcheck
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func contains(prefixes []netip.Prefix, addr netip.Addr) bool {
+	for _, p := range prefixes {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,72 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/arkantrust/idempotency-example/backend/middleware"
+)
+
+var proxies = []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}
+
+func clientAddr(remote string, forwardedFor ...string) string {
+	var got string
+	h := middleware.TrustProxies(proxies)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = middleware.ClientAddr(r)
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/chargebacks", nil)
+	req.RemoteAddr = remote
+	for _, v := range forwardedFor {
+		req.Header.Add("X-Forwarded-For", v)
+	}
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	return got
+}
+
+func TestClientAddr(t *testing.T) {
+	tests := []struct {
+		name         string
+		remote       string
+		forwardedFor []string
+		want         string
+	}{
+		{"direct", "203.0.113.7:4000", nil, "203.0.113.7"},
+		{"untrusted proxy ignored", "203.0.113.7:4000", []string{"198.51.100.1"}, "203.0.113.7"},
+		{"trusted proxy", "10.0.0.1:4000", []string{"198.51.100.1"}, "198.51.100.1"},
+		{"spoofed hop skipped", "10.0.0.1:4000", []string{"1.2.3.4, 198.51.100.1"}, "198.51.100.1"},
+		{"proxy chain", "10.0.0.1:4000", []string{"198.51.100.1", "10.0.0.2"}, "198.51.100.1"},
+		{"no header", "10.0.0.1:4000", nil, "10.0.0.1"},
+		{"garbage", "10.0.0.1:4000", []string{"198.51.100.1, nonsense"}, "10.0.0.1"},
+		{"mapped IPv4", "[::ffff:203.0.113.7]:4000", nil, "203.0.113.7"},
+	}
+	for _, tt := range tests {
+		if got := clientAddr(tt.remote, tt.forwardedFor...); got != tt.want {
+			t.Errorf("%s: client = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFilterIPs(t *testing.T) {
+	allow := []netip.Prefix{netip.MustParsePrefix("198.51.100.0/24")}
+	deny := []netip.Prefix{netip.MustParsePrefix("198.51.100.66/32")}
+	h := middleware.TrustProxies(proxies)(middleware.FilterIPs(allow, deny)(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})))
+
+	for remote, want := range map[string]int{
+		"198.51.100.1:4000":  http.StatusOK,
+		"198.51.100.66:4000": http.StatusForbidden,
+		"203.0.113.7:4000":   http.StatusForbidden,
+		// A trusted proxy, forwarding an allowed client.
+		"10.0.0.1:4000": http.StatusOK,
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/chargebacks", nil)
+		req.RemoteAddr = remote
+		req.Header.Set("X-Forwarded-For", "198.51.100.2")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != want {
+			t.Errorf("%s: status = %d, want %d", remote, rec.Code, want)
+		}
+	}
+}
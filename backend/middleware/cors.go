@@ -0,0 +1,124 @@
+// Package middleware contains HTTP middleware shared by every route.
+//
+// Each middleware is a func(http.Handler) http.Handler so they compose by
+// plain function application.
+package middleware
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORSOptions configures the CORS middleware.
+type CORSOptions struct {
+	// AllowedOrigins lists origins allowed to make cross-origin requests.
+	// An entry of "*" allows any origin; an entry such as
+	// "https://*.example.com" allows any subdomain of example.com.
+	AllowedOrigins []string
+
+	// AllowCredentials lets browsers send cookies and Authorization headers
+	// from the origins AllowedOrigins lists, to which the request origin is
+	// echoed back, since the CORS spec forbids combining credentials with a
+	// literal "*". An origin allowed only by a "*" entry is never sent
+	// credentials: that would let any site make requests as the user.
+	AllowCredentials bool
+
+	// MaxAge is how long browsers may cache a preflight response. Zero omits
+	// the header and leaves caching to the browser default.
+	MaxAge time.Duration
+
+	AllowedMethods []string
+	AllowedHeaders []string
+	ExposedHeaders []string
+}
+
+// CORS returns middleware that applies opts to every response and answers
+// preflight (OPTIONS) requests directly.
+//
+// Requests from origins that are not allowed are still served – CORS is
+// enforced by the browser, not the server – but receive no
+// Access-Control-Allow-Origin header, so the browser refuses to expose the
+// response to the calling script.
+func CORS(opts CORSOptions) func(http.Handler) http.Handler {
+	anyOrigin := slices.Contains(opts.AllowedOrigins, "*")
+	methods := strings.Join(opts.AllowedMethods, ", ")
+	headers := strings.Join(opts.AllowedHeaders, ", ")
+	exposed := strings.Join(opts.ExposedHeaders, ", ")
+	maxAge := ""
+	if opts.MaxAge > 0 {
+		maxAge = strconv.Itoa(int(opts.MaxAge.Seconds()))
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h := w.Header()
+			origin := r.Header.Get("Origin")
+
+			allowed, credentials := "", false
+			switch {
+			case anyOrigin && !opts.AllowCredentials:
+				allowed = "*"
+			case origin != "" && originAllowed(opts.AllowedOrigins, origin):
+				// Echoing the origin makes the response vary by it; caches
+				// must not serve one origin's response to another.
+				allowed, credentials = origin, opts.AllowCredentials
+				h.Add("Vary", "Origin")
+			case anyOrigin:
+				allowed = "*"
+				h.Add("Vary", "Origin")
+			default:
+				h.Add("Vary", "Origin")
+			}
+
+			if allowed != "" {
+				h.Set("Access-Control-Allow-Origin", allowed)
+				if credentials {
+					h.Set("Access-Control-Allow-Credentials", "true")
+				}
+				if exposed != "" {
+					h.Set("Access-Control-Expose-Headers", exposed)
+				}
+			}
+
+			if r.Method != http.MethodOptions {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// Preflight: answer directly without calling the route handler.
+			if allowed != "" {
+				h.Set("Access-Control-Allow-Methods", methods)
+				h.Set("Access-Control-Allow-Headers", headers)
+				if maxAge != "" {
+					h.Set("Access-Control-Max-Age", maxAge)
+				}
+			}
+			w.WriteHeader(http.StatusNoContent)
+		})
+	}
+}
+
+// originAllowed reports whether origin matches one of the allowlist entries,
+// other than "*". Entries may contain a single "*" in the host, matching one
+// or more leading labels (https://*.example.com matches https://a.example.com
+// and https://a.b.example.com, but not https://example.com).
+func originAllowed(allowed []string, origin string) bool {
+	for _, a := range allowed {
+		if a == origin {
+			return true
+		}
+		prefix, suffix, ok := strings.Cut(a, "*")
+		if !ok || a == "*" {
+			continue
+		}
+		if len(origin) > len(prefix)+len(suffix) &&
+			strings.HasPrefix(origin, prefix) &&
+			strings.HasSuffix(origin, suffix) {
+			return true
+		}
+	}
+	return false
+}
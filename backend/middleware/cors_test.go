@@ -0,0 +1,99 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/arkantrust/idempotency-example/backend/middleware"
+)
+
+func corsRequest(t *testing.T, opts middleware.CORSOptions, method, origin string) *httptest.ResponseRecorder {
+	t.Helper()
+	called := false
+	h := middleware.CORS(opts)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	req := httptest.NewRequest(method, "/chargebacks", nil)
+	if origin != "" {
+		req.Header.Set("Origin", origin)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if method == http.MethodOptions && called {
+		t.Fatal("preflight must not reach the route handler")
+	}
+	return rec
+}
+
+func TestCORSWildcard(t *testing.T) {
+	rec := corsRequest(t, middleware.CORSOptions{AllowedOrigins: []string{"*"}}, http.MethodGet, "http://any.test")
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "*" {
+		t.Fatalf("expected *, got %q", got)
+	}
+}
+
+func TestCORSAllowlistEchoesOrigin(t *testing.T) {
+	opts := middleware.CORSOptions{
+		AllowedOrigins:   []string{"https://app.example.com", "https://*.preview.example.com"},
+		AllowCredentials: true,
+	}
+
+	for _, origin := range []string{"https://app.example.com", "https://pr-1.preview.example.com"} {
+		rec := corsRequest(t, opts, http.MethodGet, origin)
+		if got := rec.Header().Get("Access-Control-Allow-Origin"); got != origin {
+			t.Fatalf("expected origin %q echoed, got %q", origin, got)
+		}
+		if rec.Header().Get("Access-Control-Allow-Credentials") != "true" {
+			t.Fatal("expected credentials header")
+		}
+	}
+
+	rec := corsRequest(t, opts, http.MethodGet, "https://evil.test")
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Fatalf("expected no allow-origin for disallowed origin, got %q", got)
+	}
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected request to still be served, got %d", rec.Code)
+	}
+}
+
+func TestCORSWildcardWithoutCredentials(t *testing.T) {
+	opts := middleware.CORSOptions{
+		AllowedOrigins:   []string{"*", "https://app.example.com"},
+		AllowCredentials: true,
+	}
+
+	// Only a listed origin is echoed and sent credentials; any other gets
+	// "*", which browsers never combine with credentials.
+	rec := corsRequest(t, opts, http.MethodGet, "https://app.example.com")
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "https://app.example.com" || rec.Header().Get("Access-Control-Allow-Credentials") != "true" {
+		t.Fatalf("expected the listed origin echoed with credentials, got %v", rec.Header())
+	}
+	rec = corsRequest(t, opts, http.MethodGet, "https://evil.test")
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "*" || rec.Header().Get("Access-Control-Allow-Credentials") != "" {
+		t.Fatalf("expected * without credentials, got %v", rec.Header())
+	}
+}
+
+func TestCORSPreflightMaxAge(t *testing.T) {
+	opts := middleware.CORSOptions{
+		AllowedOrigins: []string{"https://app.example.com"},
+		AllowedMethods: []string{"GET", "POST"},
+		MaxAge:         10 * time.Minute,
+	}
+	rec := corsRequest(t, opts, http.MethodOptions, "https://app.example.com")
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", rec.Code)
+	}
+	if got := rec.Header().Get("Access-Control-Max-Age"); got != "600" {
+		t.Fatalf("expected max-age 600, got %q", got)
+	}
+	if got := rec.Header().Get("Access-Control-Allow-Methods"); got != "GET, POST" {
+		t.Fatalf("unexpected methods %q", got)
+	}
+}
@@ -0,0 +1,118 @@
+package middleware
+
+import (
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/arkantrust/idempotency-example/backend/metrics"
+)
+
+// maxLatencySamples bounds the latencies a LoadShedder keeps; under load the
+// window holds the most recent ones.
+const maxLatencySamples = 1024
+
+// LoadShedder refuses low-priority requests while the write path is slow,
+// so that the server keeps answering the requests that matter.
+//
+// Observe times the requests it wraps – the writes – and Shed refuses the
+// requests it wraps – listings and exports, which scan the database and
+// compete with writes for it – with 503 while the 99th percentile of the
+// latencies observed in the last window is above the threshold. Shedding
+// stops by itself once the slow writes leave the window.
+type LoadShedder struct {
+	threshold  time.Duration
+	window     time.Duration
+	minSamples int
+
+	mu       sync.Mutex
+	samples  []latencySample // ring of the latest samples
+	next     int
+	shedding bool
+}
+
+type latencySample struct {
+	at      time.Time
+	latency time.Duration
+}
+
+// NewLoadShedder returns a LoadShedder shedding while the p99 latency of the
+// requests observed in the last window is above threshold. It judges only
+// windows with at least minSamples requests, so that a few slow writes on an
+// idle server shed nothing.
+func NewLoadShedder(threshold, window time.Duration, minSamples int) *LoadShedder {
+	return &LoadShedder{threshold: threshold, window: window, minSamples: max(minSamples, 1)}
+}
+
+// Observe records how long next takes to serve each request.
+func (l *LoadShedder) Observe(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		next.ServeHTTP(w, r)
+		l.record(start, time.Since(start))
+	})
+}
+
+// Shed refuses requests with 503 and Retry-After while the observed
+// requests are slow, counting them in http_shed_requests_total.
+func (l *LoadShedder) Shed(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if l.Shedding() {
+			metrics.Shed.WithLabelValues("latency").Inc()
+			shed(w, "the server is overloaded")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Shedding reports whether requests are being shed now. It is reported in
+// the http_load_shedding metric too.
+func (l *LoadShedder) Shedding() bool {
+	p99, ok := l.P99()
+	shedding := ok && p99 > l.threshold
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if shedding != l.shedding {
+		l.shedding = shedding
+		if shedding {
+			metrics.LoadShedding.Set(1)
+		} else {
+			metrics.LoadShedding.Set(0)
+		}
+	}
+	return shedding
+}
+
+// P99 returns the 99th percentile of the latencies observed in the last
+// window, or false when there are too few of them to tell.
+func (l *LoadShedder) P99() (time.Duration, bool) {
+	since := time.Now().Add(-l.window)
+	l.mu.Lock()
+	var latencies []time.Duration
+	for _, s := range l.samples {
+		if s.at.After(since) {
+			latencies = append(latencies, s.latency)
+		}
+	}
+	l.mu.Unlock()
+
+	if len(latencies) < l.minSamples {
+		return 0, false
+	}
+	slices.Sort(latencies)
+	return latencies[(len(latencies)*99-1)/100], true
+}
+
+func (l *LoadShedder) record(at time.Time, latency time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.samples) < maxLatencySamples {
+		l.samples = append(l.samples, latencySample{at, latency})
+		return
+	}
+	l.samples[l.next] = latencySample{at, latency}
+	l.next = (l.next + 1) % maxLatencySamples
+}
@@ -0,0 +1,53 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/arkantrust/idempotency-example/backend/middleware"
+)
+
+func TestLoadShedder(t *testing.T) {
+	ls := middleware.NewLoadShedder(5*time.Millisecond, time.Hour, 3)
+	var delay time.Duration
+	write := ls.Observe(http.HandlerFunc(func(http.ResponseWriter, *http.Request) { time.Sleep(delay) }))
+	list := ls.Shed(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	serve := func(h http.Handler, method string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(method, "/chargebacks", nil))
+		return rec
+	}
+
+	// Too few writes to judge, however slow.
+	delay = 10 * time.Millisecond
+	serve(write, http.MethodPost)
+	serve(write, http.MethodPost)
+	if rec := serve(list, http.MethodGet); rec.Code != http.StatusOK {
+		t.Fatalf("few samples: status %d", rec.Code)
+	}
+
+	serve(write, http.MethodPost)
+	if p99, ok := ls.P99(); !ok || p99 < delay {
+		t.Fatalf("p99 = %v, %v", p99, ok)
+	}
+	rec := serve(list, http.MethodGet)
+	if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") != "1" {
+		t.Fatalf("slow writes: status %d, Retry-After %q", rec.Code, rec.Header().Get("Retry-After"))
+	}
+}
+
+func TestLoadShedderWindow(t *testing.T) {
+	ls := middleware.NewLoadShedder(time.Millisecond, 20*time.Millisecond, 1)
+	ls.Observe(http.HandlerFunc(func(http.ResponseWriter, *http.Request) { time.Sleep(5 * time.Millisecond) })).
+		ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/chargebacks", nil))
+	if !ls.Shedding() {
+		t.Fatal("not shedding after a slow write")
+	}
+	// The slow write leaves the window, and shedding stops.
+	time.Sleep(30 * time.Millisecond)
+	if ls.Shedding() {
+		t.Fatal("still shedding after the window")
+	}
+}
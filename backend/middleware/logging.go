@@ -0,0 +1,124 @@
+package middleware
+
+import (
+	"bufio"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+)
+
+// statusRecorder captures the status code and body size written by the
+// wrapped handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	if r.status == 0 {
+		r.status = code
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += int64(n)
+	return n, err
+}
+
+// Flush lets streaming handlers (export, backup) flush through the recorder.
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack lets handlers take over the connection through the recorder.
+func (r *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := r.ResponseWriter.(http.Hijacker); ok {
+		return h.Hijack()
+	}
+	return nil, nil, errors.New("hijacking not supported")
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController.
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// Logger returns middleware that logs one line per request with its method,
+// path, status, latency, idempotency key and whether the request was a replay.
+//
+// Replays are the interesting part of an idempotent API: a high replay rate
+// means clients are retrying a lot, which usually points at timeouts or
+// network trouble between them and the server.
+func Logger(logger *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			rec := &statusRecorder{ResponseWriter: w}
+
+			next.ServeHTTP(rec, r)
+
+			status := rec.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+
+			level := slog.LevelInfo
+			if status >= http.StatusInternalServerError {
+				level = slog.LevelError
+			}
+
+			attrs := []slog.Attr{
+				slog.String("method", r.Method),
+				slog.String("path", r.URL.Path),
+				slog.Int("status", status),
+				slog.Duration("latency", time.Since(start)),
+				slog.Int64("bytes", rec.bytes),
+				slog.String("client", ClientAddr(r)),
+			}
+			// The mux fills in path values on r itself, so they are visible
+			// here once the handler has run.
+			// The key is the {id} path value, or the Idempotency-Key header
+			// on routes where the server chooses the ID.
+			key := r.PathValue("id")
+			if key == "" {
+				key = r.Header.Get("Idempotency-Key")
+			}
+			if key != "" {
+				attrs = append(attrs,
+					slog.String("idempotencyKey", key),
+					slog.Bool("replay", isReplay(r.Method, status, rec.Header())),
+				)
+			}
+
+			logger.LogAttrs(r.Context(), level, "request", attrs...)
+		})
+	}
+}
+
+// isReplay reports whether a keyed request was answered without a write:
+// a POST that found an existing record (200 instead of 201), a PUT whose
+// payload matched the stored data or a DELETE of a missing record. Handlers
+// say so in X-Idempotency-Replayed or, for PUT, X-Idempotency-Write; the
+// status is the fallback for POST handlers that set neither.
+func isReplay(method string, status int, h http.Header) bool {
+	if v := h.Get("X-Idempotency-Replayed"); v != "" {
+		return v == "true"
+	}
+	switch method {
+	case http.MethodPost:
+		return status == http.StatusOK
+	case http.MethodPut:
+		return h.Get("X-Idempotency-Write") == "false"
+	}
+	return false
+}
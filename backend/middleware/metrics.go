@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/arkantrust/idempotency-example/backend/metrics"
+)
+
+// Metrics records request latency in metrics.RequestDuration, labelled by the
+// matched route pattern rather than the raw path so that per-ID URLs do not
+// explode label cardinality.
+func Metrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+
+		next.ServeHTTP(rec, r)
+
+		status := rec.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		// The mux sets r.Pattern on the request it was given, which is r.
+		route := r.Pattern
+		if route == "" {
+			route = "unmatched"
+		}
+		metrics.RequestDuration.
+			WithLabelValues(r.Method, route, strconv.Itoa(status)).
+			Observe(time.Since(start).Seconds())
+	})
+}
@@ -0,0 +1,56 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/arkantrust/idempotency-example/backend/store"
+)
+
+// UsageCounter counts requests against quotas; *store.Store is one.
+type UsageCounter interface {
+	CountUsage(ctx context.Context, owner string, at time.Time, write bool, q store.Quota) error
+}
+
+// Quota returns middleware counting every request of the client owner names
+// – and whether it is a write, made with a method other than GET, HEAD or
+// OPTIONS – towards its usage, and answering 429 with Retry-After, until
+// the day or month ends, once the client has used up q. Requests owner
+// names no client for, anonymous ones, are neither counted nor limited.
+//
+// Counting must not take the API down with it: while the store cannot
+// count, in read-only mode or on a failure, requests are served uncounted.
+func Quota(counter UsageCounter, q store.Quota, owner func(*http.Request) string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			client := owner(r)
+			if client == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			write := r.Method != http.MethodGet && r.Method != http.MethodHead && r.Method != http.MethodOptions
+			now := time.Now()
+			err := counter.CountUsage(r.Context(), client, now, write, q)
+			var exceeded *store.QuotaError
+			switch {
+			case errors.As(err, &exceeded):
+				secs := ceilSeconds(exceeded.Reset.Sub(now))
+				w.Header().Set("Retry-After", strconv.Itoa(secs))
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusTooManyRequests)
+				fmt.Fprintf(w, `{"error":%q,"retryAfter":%d}`+"\n", exceeded.Error(), secs)
+				return
+			case errors.Is(err, store.ErrUnavailable):
+				slog.DebugContext(r.Context(), "request not counted towards usage", "owner", client, "err", err)
+			case err != nil:
+				slog.ErrorContext(r.Context(), "failed to count usage", "owner", client, "err", err)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
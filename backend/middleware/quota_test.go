@@ -0,0 +1,48 @@
+package middleware_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/arkantrust/idempotency-example/backend/middleware"
+	"github.com/arkantrust/idempotency-example/backend/store"
+)
+
+// counter is a UsageCounter allowing q.Daily requests per owner.
+type counter map[string]int64
+
+func (c counter) CountUsage(_ context.Context, owner string, at time.Time, _ bool, q store.Quota) error {
+	if c[owner] >= q.Daily {
+		return &store.QuotaError{Period: store.DayPeriod, Reset: at.Add(time.Hour)}
+	}
+	c[owner]++
+	return nil
+}
+
+func TestQuota(t *testing.T) {
+	h := middleware.Quota(counter{}, store.Quota{Daily: 1}, func(r *http.Request) string {
+		return r.Header.Get("X-Owner")
+	})(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	serve := func(owner string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/chargebacks", nil)
+		req.Header.Set("X-Owner", owner)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := serve("key:k1"); rec.Code != http.StatusOK {
+		t.Fatalf("first request: status %d", rec.Code)
+	}
+	if rec := serve("key:k1"); rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "3600" {
+		t.Fatalf("over quota: status %d, Retry-After %q; want 429 after 3600s", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	for range 2 {
+		if rec := serve(""); rec.Code != http.StatusOK {
+			t.Fatalf("anonymous request: status %d, want it unlimited", rec.Code)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package middleware
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RateLimiter is a per-client token-bucket limiter. Each client gets a
+// bucket holding up to Burst tokens that refills at Rate tokens per second;
+// every request takes one token and is rejected with 429 when the bucket is
+// empty.
+//
+// Payment APIs pair idempotency keys with rate limits for a reason: safe
+// retries make clients retry freely, and without throttling a misbehaving
+// client in a tight retry loop can monopolise the single Bolt writer. A 429
+// is itself safe to retry – nothing was processed – and Retry-After tells the
+// client exactly when to do so.
+type RateLimiter struct {
+	rate  float64
+	burst float64
+
+	// KeyFunc identifies the client a request belongs to. The default,
+	// ClientIP, keys by remote address; callers that authenticate requests
+	// should key by the authenticated identity instead.
+	KeyFunc func(*http.Request) string
+
+	now func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter returns a limiter refilling rate tokens per second up to
+// burst tokens per client.
+func NewRateLimiter(rate float64, burst int) *RateLimiter {
+	return &RateLimiter{
+		rate:    rate,
+		burst:   float64(burst),
+		KeyFunc: ClientIP,
+		now:     time.Now,
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// ClientIP identifies a client by its IP address, as ClientAddr resolves it.
+// Unvalidated credentials such as a raw X-API-Key header are deliberately
+// not used: a client could rotate made-up keys to get a fresh bucket per
+// request.
+func ClientIP(r *http.Request) string {
+	return "ip:" + ClientAddr(r)
+}
+
+// take removes one token from key's bucket. It returns whether the request is
+// allowed, the tokens left, and how long until the next token is available.
+func (l *RateLimiter) take(key string) (ok bool, remaining float64, wait time.Duration) {
+	now := l.now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sweep(now)
+
+	b, found := l.buckets[key]
+	if !found {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+
+	// Refill for the time elapsed since the bucket was last touched.
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+
+	if b.tokens < 1 {
+		return false, b.tokens, l.until(1 - b.tokens)
+	}
+	b.tokens--
+	return true, b.tokens, l.until(1 - b.tokens)
+}
+
+// until converts a token deficit into the time needed to refill it.
+func (l *RateLimiter) until(tokens float64) time.Duration {
+	if tokens <= 0 {
+		return 0
+	}
+	return time.Duration(tokens / l.rate * float64(time.Second))
+}
+
+// sweep drops buckets that have been idle long enough to be full again; they
+// are indistinguishable from new buckets. It runs at most once a minute so
+// the map cannot grow without bound under many distinct clients.
+func (l *RateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < time.Minute {
+		return
+	}
+	l.lastSweep = now
+	full := l.until(l.burst)
+	for k, b := range l.buckets {
+		if now.Sub(b.last) > full {
+			delete(l.buckets, k)
+		}
+	}
+}
+
+// Middleware applies the limiter and sets the RateLimit-* headers from the
+// IETF httpapi-ratelimit-headers draft on every response.
+func (l *RateLimiter) Middleware(next http.Handler) http.Handler {
+	window := int(math.Ceil(l.burst / l.rate))
+	policy := fmt.Sprintf("%d;w=%d", int(l.burst), window)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ok, remaining, wait := l.take(l.KeyFunc(r))
+
+		h := w.Header()
+		h.Set("RateLimit-Limit", strconv.Itoa(int(l.burst)))
+		h.Set("RateLimit-Remaining", strconv.Itoa(int(remaining)))
+		h.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(l.until(l.burst-remaining))))
+		h.Set("RateLimit-Policy", policy)
+
+		if !ok {
+			h.Set("Retry-After", strconv.Itoa(ceilSeconds(wait)))
+			h.Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusTooManyRequests)
+			fmt.Fprintf(w, `{"error":"rate limit exceeded","retryAfter":%d}`+"\n", ceilSeconds(wait))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
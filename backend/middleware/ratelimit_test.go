@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterBurstAndRefill(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := NewRateLimiter(1, 2)
+	l.now = func() time.Time { return now }
+
+	h := l.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	do := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/chargebacks/x", nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// The burst allows two immediate requests.
+	for i := 0; i < 2; i++ {
+		if rec := do(); rec.Code != http.StatusOK {
+			t.Fatalf("request %d: expected 200, got %d", i, rec.Code)
+		}
+	}
+
+	rec := do()
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429 after burst, got %d", rec.Code)
+	}
+	if rec.Header().Get("Retry-After") != "1" {
+		t.Fatalf("expected Retry-After 1, got %q", rec.Header().Get("Retry-After"))
+	}
+	if rec.Header().Get("RateLimit-Remaining") != "0" {
+		t.Fatalf("expected remaining 0, got %q", rec.Header().Get("RateLimit-Remaining"))
+	}
+
+	// One second later one token has been refilled.
+	now = now.Add(time.Second)
+	if rec := do(); rec.Code != http.StatusOK {
+		t.Fatalf("expected 200 after refill, got %d", rec.Code)
+	}
+}
+
+func TestRateLimiterKeysAreIndependent(t *testing.T) {
+	l := NewRateLimiter(1, 1)
+	if ok, _, _ := l.take("a"); !ok {
+		t.Fatal("expected first request for a to pass")
+	}
+	if ok, _, _ := l.take("b"); !ok {
+		t.Fatal("expected first request for b to pass")
+	}
+	if ok, _, _ := l.take("a"); ok {
+		t.Fatal("expected second request for a to be limited")
+	}
+}
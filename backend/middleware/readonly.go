@@ -0,0 +1,35 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RejectWrites returns middleware that answers unsafe requests – anything
+// but GET, HEAD and OPTIONS – with 503 and Retry-After while refuse reports
+// true, without running the handler. Safe requests always pass, so reads keep
+// working while writes are paused for a backup, compaction or migration.
+//
+// A 503 is safe to retry: nothing was processed.
+func RejectWrites(refuse func() bool, retryAfter time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodGet, http.MethodHead, http.MethodOptions:
+				next.ServeHTTP(w, r)
+				return
+			}
+			if !refuse() {
+				next.ServeHTTP(w, r)
+				return
+			}
+			secs := ceilSeconds(retryAfter)
+			w.Header().Set("Retry-After", strconv.Itoa(secs))
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprintf(w, `{"error":"writes are temporarily disabled","retryAfter":%d}`+"\n", secs)
+		})
+	}
+}
@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRejectWrites(t *testing.T) {
+	var ran bool
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { ran = true })
+	refuse := true
+	mw := RejectWrites(func() bool { return refuse }, 1500*time.Millisecond)(h)
+
+	rec := httptest.NewRecorder()
+	mw.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/chargebacks", nil))
+	if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") != "2" || ran {
+		t.Fatalf("expected 503 with Retry-After 2 and no handler call, got %d %q ran=%v", rec.Code, rec.Header().Get("Retry-After"), ran)
+	}
+
+	rec = httptest.NewRecorder()
+	mw.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/chargebacks", nil))
+	if rec.Code != http.StatusOK || !ran {
+		t.Fatalf("expected reads to pass, got %d ran=%v", rec.Code, ran)
+	}
+
+	ran, refuse = false, false
+	rec = httptest.NewRecorder()
+	mw.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/chargebacks/x", nil))
+	if !ran {
+		t.Fatal("expected writes to pass once accepted again")
+	}
+}
@@ -0,0 +1,87 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/arkantrust/idempotency-example/backend/models"
+	"github.com/arkantrust/idempotency-example/backend/store"
+)
+
+// RequestLog is where Record keeps requests; *store.Store is one.
+type RequestLog interface {
+	RecordRequest(ctx context.Context, r *models.RecordedRequest) error
+}
+
+// unrecordedHeaders are left out of recordings: a log of requests must not
+// become a store of credentials.
+var unrecordedHeaders = []string{"Authorization", "Cookie", "X-API-Key"}
+
+// Record returns middleware that appends every request to log once it has
+// been answered, with the status it got, for replaying later (see package
+// replay). The body is recorded as far as the handler read it, up to maxBody
+// bytes; the request's writes are stamped with the time it arrived, so that
+// a replay stamps them alike.
+//
+// It belongs just outside the handlers, inside authentication and tenant
+// selection, whose results it records, and inside fault injection, so that
+// the status recorded is the one the handler chose.
+func Record(log RequestLog, maxBody int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now().UTC()
+			body := &cappedBuffer{max: maxBody}
+			r.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.TeeReader(r.Body, body), r.Body}
+			ctx := store.WithTime(r.Context(), start)
+
+			rec := &statusRecorder{ResponseWriter: w}
+			next.ServeHTTP(rec, r.WithContext(ctx))
+
+			header := r.Header.Clone()
+			for _, h := range unrecordedHeaders {
+				header.Del(h)
+			}
+			entry := &models.RecordedRequest{
+				Time:      start,
+				Method:    r.Method,
+				URI:       r.URL.RequestURI(),
+				Header:    header,
+				Body:      body.Bytes(),
+				Truncated: body.truncated,
+				Tenant:    store.TenantFrom(ctx),
+				Owner:     store.OwnerFrom(ctx),
+				RequestID: store.RequestIDFrom(ctx),
+				Status:    rec.status,
+			}
+			if entry.Status == 0 {
+				entry.Status = http.StatusOK
+			}
+			if err := log.RecordRequest(context.WithoutCancel(ctx), entry); err != nil {
+				slog.ErrorContext(ctx, "failed to record request", "method", r.Method, "uri", entry.URI, "err", err)
+			}
+		})
+	}
+}
+
+// cappedBuffer keeps the first max bytes written to it.
+type cappedBuffer struct {
+	bytes.Buffer
+	max       int64
+	truncated bool
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	if room := b.max - int64(b.Len()); int64(len(p)) > room {
+		b.truncated = true
+		b.Buffer.Write(p[:max(room, 0)])
+		return len(p), nil
+	}
+	return b.Buffer.Write(p)
+}
@@ -0,0 +1,62 @@
+package middleware
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/arkantrust/idempotency-example/backend/metrics"
+)
+
+// problem is an RFC 9457 problem details body.
+type problem struct {
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	Detail    string `json:"detail"`
+	Instance  string `json:"instance"`
+	RequestID string `json:"requestId,omitempty"`
+}
+
+// Recover returns middleware turning a panic in next into a 500
+// application/problem+json response carrying the request ID, so that a
+// record that trips a bug fails its own request and nothing else. The panic
+// is logged with its stack and counted in metrics.Panics.
+//
+// If the handler had already started its response, the panic is re-raised
+// as http.ErrAbortHandler, which drops the connection rather than leave the
+// client a truncated body that looks complete. An http.ErrAbortHandler
+// panic is passed on as it is.
+func Recover(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := &statusRecorder{ResponseWriter: w}
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			if v == http.ErrAbortHandler {
+				panic(v)
+			}
+			metrics.Panics.Inc()
+			slog.ErrorContext(r.Context(), "panic serving request",
+				"method", r.Method, "path", r.URL.Path, "panic", v, "stack", string(debug.Stack()))
+			if rec.status != 0 {
+				panic(http.ErrAbortHandler)
+			}
+			body, _ := json.Marshal(problem{
+				Type:      "about:blank",
+				Title:     http.StatusText(http.StatusInternalServerError),
+				Status:    http.StatusInternalServerError,
+				Detail:    "the server failed to handle the request",
+				Instance:  r.URL.Path,
+				RequestID: RequestIDFrom(r.Context()),
+			})
+			w.Header().Set("Content-Type", "application/problem+json")
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write(body) //nolint:errcheck
+		}()
+		next.ServeHTTP(rec, r)
+	})
+}
@@ -0,0 +1,50 @@
+package middleware_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/arkantrust/idempotency-example/backend/middleware"
+)
+
+func TestRecoverAnswersProblem(t *testing.T) {
+	h := middleware.RequestID(middleware.Recover(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		panic("bad record")
+	})))
+	req := httptest.NewRequest(http.MethodGet, "/chargebacks/cb-1", nil)
+	req.Header.Set(middleware.RequestIDHeader, "req-1")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	var body struct {
+		Status    int    `json:"status"`
+		Instance  string `json:"instance"`
+		RequestID string `json:"requestId"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || rec.Code != http.StatusInternalServerError {
+		t.Fatalf("expected a 500 problem, got %d: %s", rec.Code, rec.Body)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/problem+json" {
+		t.Errorf("Content-Type = %q, want application/problem+json", ct)
+	}
+	if body.Status != 500 || body.Instance != "/chargebacks/cb-1" || body.RequestID != "req-1" {
+		t.Errorf("unexpected problem: %s", rec.Body)
+	}
+}
+
+func TestRecoverAbortsStartedResponses(t *testing.T) {
+	h := middleware.Recover(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`[{"id":"cb-1"},`)) //nolint:errcheck
+		panic("bad record")
+	}))
+	defer func() {
+		if v := recover(); v != http.ErrAbortHandler {
+			t.Fatalf("recovered %v, want http.ErrAbortHandler", v)
+		}
+	}()
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/chargebacks", nil))
+	t.Fatal("expected the handler to abort")
+}
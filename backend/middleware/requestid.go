@@ -0,0 +1,96 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+
+	"github.com/arkantrust/idempotency-example/backend/store"
+)
+
+// RequestIDHeader carries the request ID in both directions.
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLen bounds client-supplied IDs so they cannot bloat logs.
+const maxRequestIDLen = 128
+
+// RequestIDFrom returns the request ID stored in ctx, or "" if there is none.
+func RequestIDFrom(ctx context.Context) string {
+	return store.RequestIDFrom(ctx)
+}
+
+// WithRequestID returns a copy of ctx carrying id. It is the store's request
+// ID (see store.WithRequestID), so the records the request writes are
+// stamped with it.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return store.WithRequestID(ctx, id)
+}
+
+// RequestID returns middleware that assigns every request an ID. A valid
+// X-Request-ID sent by the client (or a proxy in front of the server) is
+// propagated; otherwise a random one is generated. The ID is stored in the
+// request context, echoed in the response header and stamped on the
+// chargebacks the request writes.
+//
+// Request IDs and idempotency keys answer different questions. The
+// idempotency key identifies an operation, so every retry of it shares one
+// key. The request ID identifies a single attempt, so two retries of the same
+// operation carry different request IDs and can be traced separately in the
+// logs.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(WithRequestID(r.Context(), id)))
+	})
+}
+
+// validRequestID accepts non-empty IDs of printable ASCII without spaces.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLen {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	var b [16]byte
+	rand.Read(b[:]) //nolint:errcheck // crypto/rand.Read never fails
+	return hex.EncodeToString(b[:])
+}
+
+// ContextLogHandler wraps a slog.Handler and adds the request ID from the
+// record's context to every log line, so calls such as
+// slog.ErrorContext(r.Context(), ...) are correlated without passing the ID
+// around explicitly.
+type ContextLogHandler struct {
+	slog.Handler
+}
+
+// Handle adds the requestId attribute when ctx carries one.
+func (h ContextLogHandler) Handle(ctx context.Context, rec slog.Record) error {
+	if id := RequestIDFrom(ctx); id != "" {
+		rec.AddAttrs(slog.String("requestId", id))
+	}
+	return h.Handler.Handle(ctx, rec)
+}
+
+// WithAttrs keeps the wrapper when attributes are added.
+func (h ContextLogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return ContextLogHandler{h.Handler.WithAttrs(attrs)}
+}
+
+// WithGroup keeps the wrapper when a group is opened.
+func (h ContextLogHandler) WithGroup(name string) slog.Handler {
+	return ContextLogHandler{h.Handler.WithGroup(name)}
+}
@@ -0,0 +1,41 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/arkantrust/idempotency-example/backend/middleware"
+)
+
+func TestRequestIDPropagatesOrGenerates(t *testing.T) {
+	var seen string
+	h := middleware.RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = middleware.RequestIDFrom(r.Context())
+	}))
+
+	// Client-supplied ID is propagated.
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(middleware.RequestIDHeader, "client-abc")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if seen != "client-abc" || rec.Header().Get(middleware.RequestIDHeader) != "client-abc" {
+		t.Fatalf("expected client ID to be propagated, got ctx=%q header=%q", seen, rec.Header().Get(middleware.RequestIDHeader))
+	}
+
+	// Missing or invalid IDs are replaced.
+	for _, id := range []string{"", "has space", string(make([]byte, 200))} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if id != "" {
+			req.Header.Set(middleware.RequestIDHeader, id)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if seen == "" || seen == id {
+			t.Fatalf("expected generated ID for %q, got %q", id, seen)
+		}
+		if rec.Header().Get(middleware.RequestIDHeader) != seen {
+			t.Fatal("expected response header to match context ID")
+		}
+	}
+}
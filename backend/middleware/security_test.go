@@ -0,0 +1,61 @@
+package middleware_test
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/arkantrust/idempotency-example/backend/middleware"
+)
+
+var securityOpts = middleware.SecurityOptions{
+	HSTSMaxAge:            365 * 24 * time.Hour,
+	ReferrerPolicy:        "no-referrer",
+	ContentSecurityPolicy: "default-src 'none'",
+}
+
+func securityRequest(h http.Handler, secure bool) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/chargebacks", nil)
+	if secure {
+		req.TLS = &tls.ConnectionState{}
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestSecurityHeaders(t *testing.T) {
+	h := middleware.SecurityHeaders(securityOpts)(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	rec := securityRequest(h, true)
+
+	want := map[string]string{
+		"Strict-Transport-Security": "max-age=31536000",
+		"X-Content-Type-Options":    "nosniff",
+		"Referrer-Policy":           "no-referrer",
+		"Content-Security-Policy":   "default-src 'none'",
+	}
+	for name, v := range want {
+		if got := rec.Header().Get(name); got != v {
+			t.Errorf("%s = %q, want %q", name, got, v)
+		}
+	}
+}
+
+func TestHSTSOnlyOverTLS(t *testing.T) {
+	h := middleware.SecurityHeaders(securityOpts)(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	if got := securityRequest(h, false).Header().Get("Strict-Transport-Security"); got != "" {
+		t.Errorf("Strict-Transport-Security over plain HTTP = %q, want none", got)
+	}
+}
+
+func TestContentSecurityPolicyOverride(t *testing.T) {
+	ok := http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})
+	for policy, want := range map[string]string{"default-src 'self'": "default-src 'self'", "": ""} {
+		h := middleware.SecurityHeaders(securityOpts)(middleware.ContentSecurityPolicy(policy)(ok))
+		if got := securityRequest(h, false).Header().Get("Content-Security-Policy"); got != want {
+			t.Errorf("override %q: Content-Security-Policy = %q, want %q", policy, got, want)
+		}
+	}
+}
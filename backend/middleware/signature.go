@@ -0,0 +1,147 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/arkantrust/idempotency-example/backend/store"
+)
+
+// Headers of a signed request.
+const (
+	SignatureHeader          = "X-Signature"
+	SignatureTimestampHeader = "X-Signature-Timestamp"
+	SignatureNonceHeader     = "X-Signature-Nonce"
+)
+
+// maxNonceLen bounds the nonces kept, so a client cannot fill the store
+// with a few huge ones.
+const maxNonceLen = 128
+
+// NonceStore remembers the nonces of signed requests; *store.Store is one.
+type NonceStore interface {
+	UseNonce(ctx context.Context, nonce string, expires time.Time) error
+}
+
+// SignatureOptions configures the VerifySignature middleware.
+type SignatureOptions struct {
+	// Secret is the key requests are signed with, shared with the clients.
+	Secret []byte
+
+	// Nonces remembers the nonces already used.
+	Nonces NonceStore
+
+	// MaxSkew is how far a request's timestamp may be from the server's
+	// clock, either way.
+	MaxSkew time.Duration
+
+	// MaxBody bounds the body read to check the signature; larger requests
+	// are refused with 413.
+	MaxBody int64
+}
+
+// Sign returns the signature of a request with the given method, URI
+// (path and query), timestamp, nonce and body under secret: the hex-encoded
+// HMAC-SHA256 of those joined by newlines. Clients send it in
+// X-Signature, with the timestamp in X-Signature-Timestamp, as Unix seconds,
+// and the nonce in X-Signature-Nonce.
+func Sign(secret []byte, method, uri, timestamp, nonce string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	fmt.Fprintf(mac, "%s\n%s\n%s\n%s\n", method, uri, timestamp, nonce)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifySignature returns middleware that refuses, with 401, requests not
+// signed as Sign describes, signed too far from now, or replaying a nonce
+// already used within that window.
+//
+// This rejects a captured request sent again at the transport level, before
+// it reaches a handler. It does not replace idempotency keys: a client
+// retrying a request signs it anew, with a fresh nonce, and it is the key
+// that makes the retry safe.
+//
+// A nonce is remembered until its request's timestamp leaves the window, as
+// a replay is refused for its timestamp after that. Requests are refused
+// with 503 while the store cannot record nonces, in read-only mode.
+func VerifySignature(opts SignatureOptions) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			timestamp := r.Header.Get(SignatureTimestampHeader)
+			nonce := r.Header.Get(SignatureNonceHeader)
+			sig, err := hex.DecodeString(r.Header.Get(SignatureHeader))
+			if err != nil || len(sig) == 0 || timestamp == "" || nonce == "" || len(nonce) > maxNonceLen {
+				refuseSignature(w, "missing or malformed signature headers")
+				return
+			}
+			secs, err := strconv.ParseInt(timestamp, 10, 64)
+			if err != nil {
+				refuseSignature(w, "malformed signature timestamp")
+				return
+			}
+			signedAt := time.Unix(secs, 0)
+			if skew := time.Since(signedAt); skew > opts.MaxSkew || skew < -opts.MaxSkew {
+				refuseSignature(w, "signature timestamp outside the allowed window")
+				return
+			}
+
+			body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, opts.MaxBody))
+			var tooLarge *http.MaxBytesError
+			switch {
+			case errors.As(err, &tooLarge):
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusRequestEntityTooLarge)
+				fmt.Fprintln(w, `{"error":"request body too large"}`)
+				return
+			case err != nil:
+				refuseSignature(w, "failed to read request body")
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			want, _ := hex.DecodeString(Sign(opts.Secret, r.Method, r.URL.RequestURI(), timestamp, nonce, body))
+			if !hmac.Equal(sig, want) {
+				refuseSignature(w, "invalid signature")
+				return
+			}
+
+			// Only a request signed with the secret gets to use up a nonce.
+			err = opts.Nonces.UseNonce(r.Context(), nonce, signedAt.Add(opts.MaxSkew))
+			switch {
+			case errors.Is(err, store.ErrNonceReused):
+				refuseSignature(w, "signature nonce already used")
+				return
+			case errors.Is(err, store.ErrUnavailable):
+				w.Header().Set("Retry-After", "1")
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusServiceUnavailable)
+				fmt.Fprintln(w, `{"error":"cannot record signature nonces"}`)
+				return
+			case err != nil:
+				slog.ErrorContext(r.Context(), "failed to record signature nonce", "err", err)
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusInternalServerError)
+				fmt.Fprintln(w, `{"error":"failed to verify signature"}`)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func refuseSignature(w http.ResponseWriter, msg string) {
+	w.Header().Set("WWW-Authenticate", `Signature headers="`+SignatureTimestampHeader+" "+SignatureNonceHeader+`"`)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnauthorized)
+	fmt.Fprintf(w, "{\"error\":%q}\n", msg)
+}
@@ -0,0 +1,77 @@
+package middleware_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/arkantrust/idempotency-example/backend/middleware"
+	"github.com/arkantrust/idempotency-example/backend/store"
+)
+
+// nonces is a NonceStore in memory.
+type nonces map[string]bool
+
+func (n nonces) UseNonce(_ context.Context, nonce string, _ time.Time) error {
+	if n[nonce] {
+		return store.ErrNonceReused
+	}
+	n[nonce] = true
+	return nil
+}
+
+var secret = []byte("s3cret")
+
+func signedRequest(at time.Time, nonce, body string) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, "/chargebacks/cb-1?strict=true", strings.NewReader(body))
+	ts := strconv.FormatInt(at.Unix(), 10)
+	req.Header.Set(middleware.SignatureTimestampHeader, ts)
+	req.Header.Set(middleware.SignatureNonceHeader, nonce)
+	req.Header.Set(middleware.SignatureHeader, middleware.Sign(secret, http.MethodPost, "/chargebacks/cb-1?strict=true", ts, nonce, []byte(body)))
+	return req
+}
+
+func TestVerifySignature(t *testing.T) {
+	var got string
+	h := middleware.VerifySignature(middleware.SignatureOptions{
+		Secret: secret, Nonces: nonces{}, MaxSkew: time.Minute, MaxBody: 1 << 10,
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		got = string(b)
+	}))
+	serve := func(req *http.Request) int {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	body := `{"amount":100}`
+	if code := serve(signedRequest(time.Now(), "n-1", body)); code != http.StatusOK || got != body {
+		t.Fatalf("signed request: status %d, body %q", code, got)
+	}
+
+	tampered := signedRequest(time.Now(), "n-2", body)
+	tampered.Body = io.NopCloser(strings.NewReader(`{"amount":1000}`))
+	unsigned := httptest.NewRequest(http.MethodPost, "/chargebacks/cb-1", strings.NewReader(body))
+	for name, req := range map[string]*http.Request{
+		"replayed nonce": signedRequest(time.Now(), "n-1", body),
+		"stale":          signedRequest(time.Now().Add(-2*time.Minute), "n-3", body),
+		"future":         signedRequest(time.Now().Add(2*time.Minute), "n-4", body),
+		"tampered body":  tampered,
+		"unsigned":       unsigned,
+	} {
+		if code := serve(req); code != http.StatusUnauthorized {
+			t.Errorf("%s: status %d, want 401", name, code)
+		}
+	}
+
+	// A refused request does not use up its nonce.
+	if code := serve(signedRequest(time.Now(), "n-2", body)); code != http.StatusOK {
+		t.Errorf("nonce of a tampered request: status %d, want 200", code)
+	}
+}
@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// APIKey describes a client credential. The secret itself is never stored:
+// the store keeps only its SHA-256 hash, and the plaintext is shown exactly
+// once, in the response that mints it.
+type APIKey struct {
+	// ID is the public identifier of the key. It appears in the plaintext
+	// key, in logs, and, prefixed with "key:", as the Owner of every
+	// chargeback the key creates.
+	ID string `json:"id"`
+
+	// Name is a human-readable label chosen by the operator.
+	Name string `json:"name"`
+
+	// Tenant, when set, binds the key to a single tenant. Requests made with
+	// it act on that tenant and may not name another in X-Tenant-ID.
+	Tenant string `json:"tenant,omitempty"`
+
+	// Role is what the key may do: "viewer", "operator" or "admin". Keys
+	// minted before roles have none and act as operators.
+	Role string `json:"role,omitempty"`
+
+	CreatedAt time.Time `json:"createdAt"`
+
+	// RevokedAt is set when the key is revoked. Revoked keys are kept so that
+	// the records they own stay attributable.
+	RevokedAt *time.Time `json:"revokedAt,omitempty"`
+}
@@ -0,0 +1,105 @@
+package models
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/arkantrust/idempotency-example/backend/money"
+)
+
+// Charge is a payment a chargeback disputes. Chargebacks reference it by
+// ChargeID, and the store checks the reference in the transaction that
+// writes the chargeback, so no chargeback names a charge that does not
+// exist.
+//
+// Charges are created once and never changed: the API creates and reads
+// them only, so a reference checked once stays valid.
+type Charge struct {
+	XMLName xml.Name `json:"-" xml:"charge"`
+
+	// ID is the client-generated ID, and the idempotency key of POST
+	// /charges/{id}.
+	ID string `json:"id" xml:"id"`
+
+	// Amount is the charged amount in the smallest currency unit. A
+	// chargeback disputes at most this much.
+	Amount int64 `json:"amount" xml:"amount"`
+
+	// Currency is the ISO 4217 code of Amount. Chargebacks of the charge are
+	// in the same currency.
+	Currency string `json:"currency" xml:"currency"`
+
+	// DisplayAmount is Amount formatted like Chargeback.DisplayAmount.
+	DisplayAmount string `json:"displayAmount,omitempty" xml:"displayAmount,omitempty"`
+
+	// Description says what was charged for.
+	Description string `json:"description,omitempty" xml:"description,omitempty"`
+
+	// Owner, CreatedAt, UpdatedAt, RequestID and Version are maintained by
+	// the store, as for chargebacks.
+	Owner     string    `json:"owner,omitempty" xml:"owner,omitempty"`
+	CreatedAt time.Time `json:"createdAt" xml:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt" xml:"updatedAt"`
+	RequestID string    `json:"requestId,omitempty" xml:"requestId,omitempty"`
+	Version   int64     `json:"version" xml:"version"`
+}
+
+func (c *Charge) RecordID() string { return c.ID }
+
+func (c *Charge) SetRecordID(id string) { c.ID = id }
+
+func (c *Charge) RecordOwner() string { return c.Owner }
+
+func (c *Charge) RecordCreatedAt() time.Time { return c.CreatedAt }
+
+func (c *Charge) Stamp(owner string, now time.Time) {
+	c.Owner = owner
+	c.CreatedAt = now
+	c.UpdatedAt = now
+	c.Version = 1
+}
+
+func (c *Charge) Touch(now time.Time) {
+	c.UpdatedAt = now
+	c.Version++
+}
+
+func (c *Charge) RecordVersion() int64 { return c.Version }
+
+func (c *Charge) SetRequestID(id string) { c.RequestID = id }
+
+// Derive sets c.DisplayAmount.
+func (c *Charge) Derive() { c.DisplayAmount = money.Format(c.Amount, c.Currency) }
+
+// MaxDescriptionLength is the maximum length of a charge's description, in
+// characters.
+const MaxDescriptionLength = 500
+
+// Validate checks the client-supplied fields of c.
+func (c *Charge) Validate() error {
+	var e ValidationError
+	add := func(field, format string, args ...any) {
+		e.Fields = append(e.Fields, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if !idPattern.MatchString(c.ID) {
+		add("id", "must be 1-128 characters of letters, digits, '.', '_', ':' or '-', starting with a letter or digit")
+	}
+	validateMoney(add, c.Amount, c.Currency)
+	if n := utf8.RuneCountInString(strings.TrimSpace(c.Description)); n > MaxDescriptionLength {
+		add("description", "must be at most %d characters, got %d", MaxDescriptionLength, n)
+	}
+
+	if len(e.Fields) > 0 {
+		return &e
+	}
+	return nil
+}
+
+// SameCharge reports whether a and b carry the same client-supplied fields.
+func SameCharge(a, b *Charge) bool {
+	return a.Amount == b.Amount && a.Currency == b.Currency && a.Description == b.Description
+}
@@ -1,7 +1,10 @@
 // Package models defines the core domain types for the idempotency example.
 package models
 
-import "time"
+import (
+	"encoding/xml"
+	"time"
+)
 
 // Chargeback represents a financial dispute record.
 //
@@ -10,28 +13,64 @@ import "time"
 // times it is executed. This is critical in distributed systems where retries
 // due to network failures or timeouts are common – without an idempotency key
 // a client retry could create duplicate chargebacks and result in double-charges.
+//
+// The xml tags mirror the json ones so that every representation served by
+// the API uses the same field names.
 type Chargeback struct {
+	XMLName xml.Name `json:"-" xml:"chargeback"`
+
 	// ID is the unique identifier and the idempotency key used in POST
 	// /chargebacks/{id}. Clients should generate this value (e.g. a UUID)
 	// before sending the request so that retries always reference the same key.
-	ID string `json:"id"`
+	ID string `json:"id" xml:"id"`
 
 	// Amount is the disputed amount expressed in the smallest currency unit
 	// (e.g. cents for USD). Using integer arithmetic avoids floating-point
 	// rounding issues that matter in financial systems.
-	Amount int64 `json:"amount"`
+	Amount int64 `json:"amount" xml:"amount"`
 
 	// Currency is the ISO 4217 three-letter currency code (e.g. "USD", "EUR").
-	Currency string `json:"currency"`
+	Currency string `json:"currency" xml:"currency"`
+
+	// DisplayAmount is Amount as a decimal in major units, with the
+	// currency's number of decimal places: "12.34" for 1234 USD cents, "1234"
+	// for 1234 yen. The store sets it; clients sending it have it ignored.
+	DisplayAmount string `json:"displayAmount,omitempty" xml:"displayAmount,omitempty"`
 
 	// Reason describes why the chargeback was raised.
-	Reason string `json:"reason"`
+	Reason string `json:"reason" xml:"reason"`
+
+	// ChargeID, when set, is the ID of the charge disputed. The store
+	// refuses a chargeback whose charge does not exist, is in another
+	// currency, or is of a smaller amount.
+	ChargeID string `json:"chargeId,omitempty" xml:"chargeId,omitempty"`
+
+	// MerchantID, when set, is the ID of the merchant the chargeback is
+	// raised against, which must exist. Listings and stats can be scoped to
+	// one merchant.
+	MerchantID string `json:"merchantId,omitempty" xml:"merchantId,omitempty"`
+
+	// Owner is the ID of the API key that created the record, or empty when
+	// authentication is disabled. It scopes the idempotency key: the same ID
+	// sent by a different client is a conflict, not a replay.
+	Owner string `json:"owner,omitempty" xml:"owner,omitempty"`
 
 	// CreatedAt is the UTC timestamp of the first write.
-	CreatedAt time.Time `json:"createdAt"`
+	CreatedAt time.Time `json:"createdAt" xml:"createdAt"`
 
 	// UpdatedAt is the UTC timestamp of the most recent write.
 	// For idempotent POSTs this stays equal to CreatedAt because the record is
 	// never mutated after creation.
-	UpdatedAt time.Time `json:"updatedAt"`
+	UpdatedAt time.Time `json:"updatedAt" xml:"updatedAt"`
+
+	// RequestID is the X-Request-ID of the request that last wrote the
+	// record, which finds the log lines of that write. The store sets it;
+	// clients sending it have it ignored.
+	RequestID string `json:"requestId,omitempty" xml:"requestId,omitempty"`
+
+	// Version is 1 when the record is created and is incremented by every
+	// write that changes it; skipped writes leave it alone. A client can
+	// send the version it last read with an update to have the update
+	// refused if someone else has written since.
+	Version int64 `json:"version" xml:"version"`
 }
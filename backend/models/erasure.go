@@ -0,0 +1,55 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"time"
+)
+
+// PersonalFields names the chargeback fields that may hold personal data:
+// the free text clients write. The rest are amounts, codes and timestamps the
+// ledger needs, which an erasure keeps.
+var PersonalFields = []string{"reason"}
+
+// Erasure is the proof that a chargeback's personal data was erased. It
+// holds a digest of the erased values, never the values themselves.
+type Erasure struct {
+	XMLName xml.Name `json:"-" xml:"erasure"`
+
+	// ChargebackID is the ID of the erased chargeback.
+	ChargebackID string `json:"chargebackId" xml:"chargebackId"`
+
+	// Owner is the owner of the erased chargeback, who alone can see the
+	// proof.
+	Owner string `json:"owner,omitempty" xml:"owner,omitempty"`
+
+	// Fields are the PersonalFields that were erased.
+	Fields []string `json:"fields" xml:"fields>field"`
+
+	// SHA256 is the hex ErasureDigest of the erased values. Whoever holds a
+	// copy of them can check it against this proof.
+	SHA256 string `json:"sha256" xml:"sha256"`
+
+	// ErasedAt is the UTC time of the erasure.
+	ErasedAt time.Time `json:"erasedAt" xml:"erasedAt"`
+}
+
+// ErasePersonal clears c's personal fields and returns their previous
+// values, in the order of PersonalFields.
+func (c *Chargeback) ErasePersonal() []string {
+	erased := []string{c.Reason}
+	c.Reason = ""
+	return erased
+}
+
+// ErasureDigest returns the hex SHA-256 of the chargeback ID and the values
+// erased from it, each NUL-terminated and in the order of PersonalFields.
+func ErasureDigest(id string, values []string) string {
+	h := sha256.New()
+	for _, v := range append([]string{id}, values...) {
+		h.Write([]byte(v))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,84 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+	"time"
+)
+
+// Event announces a change to a record, e.g. to webhook receivers.
+type Event struct {
+	// ID identifies the event. Every delivery of an event carries the same
+	// ID, so receivers can tell a redelivery from a new event. See EventID.
+	ID string `json:"id"`
+
+	// Type is the record kind and what happened to it, e.g.
+	// "chargeback.created", "chargeback.updated" or "chargeback.deleted".
+	Type string `json:"type"`
+
+	// Subject is the ID of the record.
+	Subject string `json:"subject,omitempty"`
+
+	// Tenant is the tenant of the record; empty for the default tenant.
+	Tenant string `json:"tenant,omitempty"`
+
+	// Time is when the change was made.
+	Time time.Time `json:"time"`
+
+	// Data is the record: as written for creates and updates, as it was
+	// for deletes.
+	Data json.RawMessage `json:"data"`
+}
+
+// EventID derives the ID of the event of type typ about the version of the
+// record id of tenant created at created. The record ID is its idempotency
+// key, so a change published twice – by a retry, or by another instance –
+// is the same event both times, while a record deleted and created again
+// under the same ID, which starts its versions over, makes new ones.
+func EventID(tenant, typ, id string, created time.Time, version int64) string {
+	h := sha256.New()
+	for _, part := range []string{tenant, typ, id, created.UTC().Format(time.RFC3339Nano), strconv.FormatInt(version, 10)} {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil)[:16])
+}
+
+// CloudEventsVersion is the version of the CloudEvents specification
+// CloudEvent follows.
+const CloudEventsVersion = "1.0"
+
+// CloudEvent is an Event in the envelope of the CloudEvents specification,
+// in its structured JSON form, which is how events leave the server.
+type CloudEvent struct {
+	SpecVersion     string          `json:"specversion"`
+	ID              string          `json:"id"`
+	Source          string          `json:"source"`
+	Type            string          `json:"type"`
+	Subject         string          `json:"subject,omitempty"`
+	Time            time.Time       `json:"time"`
+	DataContentType string          `json:"datacontenttype"`
+	Data            json.RawMessage `json:"data"`
+
+	// Tenant is an extension attribute: the tenant of the record, absent
+	// for the default tenant.
+	Tenant string `json:"tenant,omitempty"`
+}
+
+// CloudEvent returns e in a CloudEvents envelope naming source as the
+// producer.
+func (e Event) CloudEvent(source string) CloudEvent {
+	return CloudEvent{
+		SpecVersion:     CloudEventsVersion,
+		ID:              e.ID,
+		Source:          source,
+		Type:            e.Type,
+		Subject:         e.Subject,
+		Time:            e.Time,
+		DataContentType: "application/json",
+		Data:            e.Data,
+		Tenant:          e.Tenant,
+	}
+}
@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// Evidence is a document attached to a chargeback to contest it: a receipt,
+// a delivery confirmation, correspondence with the cardholder.
+//
+// Documents are stored once per tenant under the SHA-256 of their contents,
+// which is also the evidence's ID: uploading the same file again, to the
+// same chargeback, attaches nothing new.
+type Evidence struct {
+	// SHA256 is the hex SHA-256 of the document, and its ID.
+	SHA256 string `json:"sha256"`
+
+	// ChargebackID is the chargeback the document is attached to.
+	ChargebackID string `json:"chargebackId"`
+
+	// Filename and ContentType are as first uploaded.
+	Filename    string `json:"filename,omitempty"`
+	ContentType string `json:"contentType"`
+
+	// Size is the length of the document in bytes.
+	Size int64 `json:"size"`
+
+	// CreatedAt is when the document was first attached.
+	CreatedAt time.Time `json:"createdAt"`
+}
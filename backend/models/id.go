@@ -0,0 +1,33 @@
+package models
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"time"
+)
+
+// crockford is the base32 alphabet used by ULIDs. It omits I, L, O and U to
+// avoid confusion with digits and accidental obscenities.
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// NewID returns a new ULID: 48 bits of millisecond timestamp followed by 80
+// random bits, encoded as 26 Crockford base32 characters. ULIDs sort by
+// creation time, so server-generated IDs keep the bucket's key order roughly
+// chronological.
+func NewID() string {
+	var b [16]byte
+	binary.BigEndian.PutUint64(b[:8], uint64(time.Now().UnixMilli())<<16)
+	rand.Read(b[6:]) //nolint:errcheck // crypto/rand.Read never fails
+
+	// 128 bits are encoded 5 at a time, most significant first; the first
+	// character carries only the top 3 bits.
+	hi := binary.BigEndian.Uint64(b[:8])
+	lo := binary.BigEndian.Uint64(b[8:])
+	var out [26]byte
+	for i := 25; i >= 0; i-- {
+		out[i] = crockford[lo&0x1f]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(out[:])
+}
@@ -0,0 +1,74 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// JobStatus is the state of a Job.
+type JobStatus string
+
+const (
+	// JobPending is a job waiting for its next run, the first or a retry.
+	JobPending JobStatus = "pending"
+
+	// JobRunning is a job a worker has claimed and is running.
+	JobRunning JobStatus = "running"
+
+	// JobSucceeded is a job whose handler finished without error.
+	JobSucceeded JobStatus = "succeeded"
+
+	// JobFailed is a job that gave up; LastError says why. Jobs of the
+	// kinds kept as dead letters leave the queue for the dead-letter queue
+	// in this status.
+	JobFailed JobStatus = "failed"
+)
+
+// Job is a unit of background work – a webhook delivery, a backup, an
+// archival run – kept in the store until it has run, so that it survives a
+// restart.
+type Job struct {
+	// ID identifies the job; the server mints it.
+	ID string `json:"id"`
+
+	// Kind selects the handler that runs the job, e.g. "webhook".
+	Kind string `json:"kind"`
+
+	// Key, when set, deduplicates the job: enqueueing another job with the
+	// same key returns this one instead.
+	Key string `json:"key,omitempty"`
+
+	// Payload is the handler's input, as JSON.
+	Payload json.RawMessage `json:"payload,omitempty"`
+
+	Status JobStatus `json:"status"`
+
+	// Attempts counts the runs so far, and MaxAttempts bounds them.
+	Attempts    int `json:"attempts"`
+	MaxAttempts int `json:"maxAttempts"`
+
+	// RunAt is when a pending job is due to run next.
+	RunAt time.Time `json:"runAt"`
+
+	// LastError is the error of the last failed run.
+	LastError string `json:"lastError,omitempty"`
+
+	// Failures is the history of the failed runs, oldest first.
+	Failures []JobFailure `json:"failures,omitempty"`
+
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+
+	// FinishedAt is when the job succeeded or gave up.
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+}
+
+// JobFailure is a failed run of a Job.
+type JobFailure struct {
+	Attempt int       `json:"attempt"`
+	Error   string    `json:"error"`
+	At      time.Time `json:"at"`
+}
+
+// Done reports whether j has finished, successfully or not.
+func (j *Job) Done() bool { return j.Status == JobSucceeded || j.Status == JobFailed }
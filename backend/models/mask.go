@@ -0,0 +1,63 @@
+package models
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// UpdatableFields lists the fields of a Chargeback a client may change.
+var UpdatableFields = []string{"amount", "currency", "reason", "chargeId", "merchantId"}
+
+// FieldMask selects the fields a partial update applies. A nil mask selects
+// every updatable field, which makes an unmasked PUT a full replacement.
+type FieldMask []string
+
+// ParseFieldMask parses a comma-separated list of Chargeback field names
+// such as "amount,reason". An empty string yields a nil mask.
+func ParseFieldMask(s string) (FieldMask, error) {
+	return ParseFieldMaskOf(s, UpdatableFields)
+}
+
+// ParseFieldMaskOf is ParseFieldMask for a model whose updatable fields are
+// updatable.
+func ParseFieldMaskOf(s string, updatable []string) (FieldMask, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+	var m FieldMask
+	for _, f := range strings.Split(s, ",") {
+		f = strings.TrimSpace(f)
+		if !slices.Contains(updatable, f) {
+			return nil, fmt.Errorf("unknown or read-only field %q (updatable: %s)", f, strings.Join(updatable, ", "))
+		}
+		if !slices.Contains(m, f) {
+			m = append(m, f)
+		}
+	}
+	return m, nil
+}
+
+// Has reports whether field is selected by m.
+func (m FieldMask) Has(field string) bool {
+	return m == nil || slices.Contains(m, field)
+}
+
+// Merge copies the fields selected by m from src into dst.
+func (m FieldMask) Merge(dst, src *Chargeback) {
+	if m.Has("amount") {
+		dst.Amount = src.Amount
+	}
+	if m.Has("currency") {
+		dst.Currency = src.Currency
+	}
+	if m.Has("reason") {
+		dst.Reason = src.Reason
+	}
+	if m.Has("chargeId") {
+		dst.ChargeID = src.ChargeID
+	}
+	if m.Has("merchantId") {
+		dst.MerchantID = src.MerchantID
+	}
+}
@@ -0,0 +1,92 @@
+package models
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Merchant is a business whose charges are disputed. Chargebacks name theirs
+// by MerchantID, which the store checks like a ChargeID and indexes, so that
+// a merchant's chargebacks are listed and summarised without reading the
+// rest.
+//
+// Merchants are created once and never changed or deleted, so a chargeback's
+// merchant always exists.
+type Merchant struct {
+	XMLName xml.Name `json:"-" xml:"merchant"`
+
+	// ID is the client-generated ID, and the idempotency key of POST
+	// /merchants/{id}.
+	ID string `json:"id" xml:"id"`
+
+	// Name is the merchant's display name.
+	Name string `json:"name" xml:"name"`
+
+	// Owner, CreatedAt, UpdatedAt, RequestID and Version are maintained by
+	// the store, as for chargebacks.
+	Owner     string    `json:"owner,omitempty" xml:"owner,omitempty"`
+	CreatedAt time.Time `json:"createdAt" xml:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt" xml:"updatedAt"`
+	RequestID string    `json:"requestId,omitempty" xml:"requestId,omitempty"`
+	Version   int64     `json:"version" xml:"version"`
+}
+
+func (m *Merchant) RecordID() string { return m.ID }
+
+func (m *Merchant) SetRecordID(id string) { m.ID = id }
+
+func (m *Merchant) RecordOwner() string { return m.Owner }
+
+func (m *Merchant) RecordCreatedAt() time.Time { return m.CreatedAt }
+
+func (m *Merchant) Stamp(owner string, now time.Time) {
+	m.Owner = owner
+	m.CreatedAt = now
+	m.UpdatedAt = now
+	m.Version = 1
+}
+
+func (m *Merchant) Touch(now time.Time) {
+	m.UpdatedAt = now
+	m.Version++
+}
+
+func (m *Merchant) RecordVersion() int64 { return m.Version }
+
+func (m *Merchant) SetRequestID(id string) { m.RequestID = id }
+
+// MaxMerchantNameLength is the maximum length of a merchant's name, in
+// characters.
+const MaxMerchantNameLength = 200
+
+// Validate checks the client-supplied fields of m.
+func (m *Merchant) Validate() error {
+	var e ValidationError
+	add := func(field, format string, args ...any) {
+		e.Fields = append(e.Fields, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if !idPattern.MatchString(m.ID) {
+		add("id", "must be 1-128 characters of letters, digits, '.', '_', ':' or '-', starting with a letter or digit")
+	}
+	switch n := utf8.RuneCountInString(strings.TrimSpace(m.Name)); {
+	case n == 0:
+		add("name", "must not be empty")
+	case n > MaxMerchantNameLength:
+		add("name", "must be at most %d characters, got %d", MaxMerchantNameLength, n)
+	}
+
+	if len(e.Fields) > 0 {
+		return &e
+	}
+	return nil
+}
+
+// SameMerchant reports whether a and b carry the same client-supplied
+// fields.
+func SameMerchant(a, b *Merchant) bool {
+	return a.Name == b.Name
+}
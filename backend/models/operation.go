@@ -0,0 +1,52 @@
+package models
+
+import (
+	"encoding/xml"
+	"time"
+)
+
+// OperationStatus is the state of an Operation.
+type OperationStatus string
+
+const (
+	// OperationPending is an operation accepted but not yet finished.
+	OperationPending OperationStatus = "pending"
+
+	// OperationSucceeded is an operation that created its chargeback.
+	OperationSucceeded OperationStatus = "succeeded"
+
+	// OperationFailed is an operation that gave up; Error says why.
+	OperationFailed OperationStatus = "failed"
+)
+
+// Operation is a chargeback create accepted for asynchronous processing,
+// which clients poll until it is no longer pending.
+type Operation struct {
+	XMLName xml.Name `json:"-" xml:"operation"`
+
+	// ID identifies the operation; the server mints it.
+	ID string `json:"id" xml:"id"`
+
+	Status OperationStatus `json:"status" xml:"status"`
+
+	// ChargebackID is the ID of the chargeback the operation created, once
+	// it has succeeded.
+	ChargebackID string `json:"chargebackId,omitempty" xml:"chargebackId,omitempty"`
+
+	// Result is the chargeback the operation created, as it is when the
+	// operation is read. It is not stored, and is absent once the
+	// chargeback has been deleted.
+	Result *Chargeback `json:"result,omitempty" xml:"chargeback,omitempty"`
+
+	// Error says why a failed operation gave up.
+	Error string `json:"error,omitempty" xml:"error,omitempty"`
+
+	// Attempts counts the times the create was tried.
+	Attempts int `json:"attempts" xml:"attempts"`
+
+	CreatedAt time.Time `json:"createdAt" xml:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt" xml:"updatedAt"`
+}
+
+// Done reports whether o has finished, successfully or not.
+func (o *Operation) Done() bool { return o.Status != OperationPending }
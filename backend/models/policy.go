@@ -0,0 +1,106 @@
+package models
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/arkantrust/idempotency-example/backend/money"
+)
+
+// Policy is the set of risk rules chargebacks are held to on every create and
+// update that writes. It comes on top of validation: a valid chargeback can
+// still break a rule, and is then refused with a PolicyError.
+type Policy struct {
+	XMLName xml.Name `json:"-" xml:"policy"`
+
+	// MaxAmounts caps the amount of a chargeback in a currency; currencies
+	// not listed have no cap beyond validation's.
+	MaxAmounts []AmountLimit `json:"maxAmounts" xml:"maxAmount"`
+
+	// DisallowedReasons are reasons a chargeback may not give, compared
+	// ignoring case and surrounding space.
+	DisallowedReasons []string `json:"disallowedReasons" xml:"disallowedReason"`
+
+	// MerchantVelocity, when set, limits how many chargebacks a merchant
+	// may have been given in a window of time.
+	MerchantVelocity *VelocityLimit `json:"merchantVelocity,omitempty" xml:"merchantVelocity,omitempty"`
+}
+
+// AmountLimit is the largest amount, in minor units, of a chargeback in
+// Currency.
+type AmountLimit struct {
+	Currency string `json:"currency" xml:"currency,attr"`
+	Max      int64  `json:"max" xml:"max"`
+}
+
+// VelocityLimit allows at most Max chargebacks created in any window of
+// WindowSeconds.
+type VelocityLimit struct {
+	Max           int   `json:"max" xml:"max"`
+	WindowSeconds int64 `json:"windowSeconds" xml:"windowSeconds"`
+}
+
+// Window returns the window of v as a duration.
+func (v *VelocityLimit) Window() time.Duration {
+	return time.Duration(v.WindowSeconds) * time.Second
+}
+
+// Policy rules, as named by PolicyViolation.Rule.
+const (
+	RuleMaxAmount        = "maxAmount"
+	RuleDisallowedReason = "disallowedReason"
+	RuleMerchantVelocity = "merchantVelocity"
+)
+
+// PolicyViolation is a rule of a Policy a chargeback breaks.
+type PolicyViolation struct {
+	// Rule names the rule broken, e.g. RuleMaxAmount.
+	Rule string `json:"rule"`
+
+	// Field is the field breaking it.
+	Field string `json:"field"`
+
+	Message string `json:"message"`
+}
+
+// PolicyError lists every rule a chargeback breaks, like ValidationError
+// lists every invalid field.
+type PolicyError struct {
+	Violations []PolicyViolation `json:"violations"`
+}
+
+func (e *PolicyError) Error() string {
+	msgs := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		msgs[i] = v.Rule + ": " + v.Message
+	}
+	return "chargeback refused by policy: " + strings.Join(msgs, "; ")
+}
+
+// Check returns the rules of p that c breaks on its own. Velocity limits
+// depend on other chargebacks too, and are left to the store.
+func (p *Policy) Check(c *Chargeback) []PolicyViolation {
+	var violations []PolicyViolation
+	for _, l := range p.MaxAmounts {
+		if l.Currency == c.Currency && c.Amount > l.Max {
+			violations = append(violations, PolicyViolation{
+				Rule:    RuleMaxAmount,
+				Field:   "amount",
+				Message: fmt.Sprintf("must be at most %s %s", money.Format(l.Max, l.Currency), l.Currency),
+			})
+		}
+	}
+	reason := strings.TrimSpace(c.Reason)
+	for _, r := range p.DisallowedReasons {
+		if strings.EqualFold(reason, strings.TrimSpace(r)) {
+			violations = append(violations, PolicyViolation{
+				Rule:    RuleDisallowedReason,
+				Field:   "reason",
+				Message: fmt.Sprintf("%q is not accepted", r),
+			})
+		}
+	}
+	return violations
+}
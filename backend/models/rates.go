@@ -0,0 +1,46 @@
+package models
+
+import "time"
+
+// ExchangeRates is a table of exchange rates published on one day, quoted
+// against one base currency.
+type ExchangeRates struct {
+	// Base is the currency the rates are quoted against.
+	Base string `json:"base"`
+
+	// Date is the day the rates were published, as YYYY-MM-DD.
+	Date string `json:"date"`
+
+	// Rates maps a currency code to the units of that currency one unit of
+	// Base buys. Base need not be listed.
+	Rates map[string]float64 `json:"rates"`
+
+	// Provider names where the rates came from, e.g. "ecb".
+	Provider string `json:"provider"`
+
+	// FetchedAt is the UTC time the rates were fetched from Provider.
+	FetchedAt time.Time `json:"fetchedAt"`
+}
+
+// Rate returns how many units of to one unit of from buys, or false if
+// either has no rate.
+func (r *ExchangeRates) Rate(from, to string) (float64, bool) {
+	f, ok := r.rate(from)
+	if !ok {
+		return 0, false
+	}
+	t, ok := r.rate(to)
+	if !ok {
+		return 0, false
+	}
+	return t / f, true
+}
+
+// rate returns the rate of code against r.Base.
+func (r *ExchangeRates) rate(code string) (float64, bool) {
+	if code == r.Base {
+		return 1, true
+	}
+	rate, ok := r.Rates[code]
+	return rate, ok && rate > 0
+}
@@ -0,0 +1,54 @@
+package models
+
+import "time"
+
+// Reconciliation is the outcome of comparing a payment processor's
+// settlement file with the stored chargebacks of one tenant.
+type Reconciliation struct {
+	// ID identifies the report. It is derived from the tenant and the
+	// file's contents, so reconciling the same file again finds this
+	// report instead of making another.
+	ID string `json:"id"`
+
+	// Tenant is the tenant reconciled; empty for the default tenant.
+	Tenant string `json:"tenant,omitempty"`
+
+	// FileSHA256 is the hex SHA-256 of the settlement file.
+	FileSHA256 string `json:"fileSha256"`
+
+	// CreatedAt is when the file was first reconciled.
+	CreatedAt time.Time `json:"createdAt"`
+
+	// Settled is the number of chargebacks in the file, and Matched the
+	// number stored with the same amount and currency.
+	Settled int `json:"settled"`
+	Matched int `json:"matched"`
+
+	// Missing are settled but not stored, Mismatched are stored with
+	// another amount or currency, and Extra are stored but not settled.
+	// Missing and Mismatched are in file order, Extra in ID order.
+	Missing    []SettlementLine `json:"missing"`
+	Mismatched []Mismatch       `json:"mismatched"`
+	Extra      []SettlementLine `json:"extra"`
+}
+
+// SettlementLine is a chargeback as a settlement file, or the store, has it.
+type SettlementLine struct {
+	// Line is the line number in the file; zero for a stored chargeback.
+	Line int `json:"line,omitempty"`
+
+	ID       string `json:"id"`
+	Amount   int64  `json:"amount"`
+	Currency string `json:"currency"`
+}
+
+// Mismatch is a chargeback the file and the store disagree on.
+type Mismatch struct {
+	Line int    `json:"line"`
+	ID   string `json:"id"`
+
+	SettledAmount   int64  `json:"settledAmount"`
+	SettledCurrency string `json:"settledCurrency"`
+	StoredAmount    int64  `json:"storedAmount"`
+	StoredCurrency  string `json:"storedCurrency"`
+}
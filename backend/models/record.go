@@ -0,0 +1,102 @@
+package models
+
+import (
+	"time"
+
+	"github.com/arkantrust/idempotency-example/backend/money"
+)
+
+// Record is the bookkeeping every model served through the generic resource
+// machinery (store.Collection and handlers.Resource) must expose. The
+// client-facing fields, validation and comparison are left to the model;
+// Record covers only what the framework itself reads and stamps.
+type Record interface {
+	// RecordID returns the record's ID, which is also its idempotency key.
+	RecordID() string
+
+	// SetRecordID sets the ID, typically from the request path.
+	SetRecordID(id string)
+
+	// RecordOwner returns the owner stamped on first write.
+	RecordOwner() string
+
+	// RecordCreatedAt returns the time stamped on first write.
+	RecordCreatedAt() time.Time
+
+	// Stamp sets the owner and both timestamps before the first write.
+	Stamp(owner string, now time.Time)
+
+	// Touch records a later write.
+	Touch(now time.Time)
+}
+
+func (c *Chargeback) RecordID() string { return c.ID }
+
+func (c *Chargeback) SetRecordID(id string) { c.ID = id }
+
+func (c *Chargeback) RecordOwner() string { return c.Owner }
+
+func (c *Chargeback) RecordCreatedAt() time.Time { return c.CreatedAt }
+
+func (c *Chargeback) Stamp(owner string, now time.Time) {
+	c.Owner = owner
+	c.CreatedAt = now
+	c.UpdatedAt = now
+	c.Version = 1
+}
+
+func (c *Chargeback) Touch(now time.Time) {
+	c.UpdatedAt = now
+	c.Version++
+}
+
+// Versioned is implemented by records that count their writes, which lets
+// an update require the version the client last saw (optimistic concurrency
+// control). It is optional: models without it cannot be updated that way.
+type Versioned interface {
+	// RecordVersion returns the number of writes that made the record: 1
+	// when created, incremented by every write that changed it.
+	RecordVersion() int64
+}
+
+func (c *Chargeback) RecordVersion() int64 { return c.Version }
+
+// Traced is implemented by records that keep the ID of the request that last
+// wrote them (see store.WithRequestID). It is optional: models without it
+// are stored without one.
+type Traced interface {
+	// SetRequestID sets the request ID, on every write.
+	SetRequestID(id string)
+}
+
+func (c *Chargeback) SetRequestID(id string) { c.RequestID = id }
+
+// Sensitive is implemented by records with fields the store encrypts at
+// rest when field encryption is configured. It is optional: the fields of
+// models without it are stored as they are.
+type Sensitive interface {
+	// SensitiveFields returns pointers to the fields to encrypt.
+	SensitiveFields() []*string
+}
+
+// SensitiveFields returns c's PersonalFields.
+func (c *Chargeback) SensitiveFields() []*string { return []*string{&c.Reason} }
+
+// Derived is implemented by records with fields computed from the others,
+// such as a formatted amount. The store derives them on every write and
+// read, so they are never stale. It is optional.
+type Derived interface {
+	// Derive sets the computed fields.
+	Derive()
+}
+
+// Derive sets c.DisplayAmount.
+func (c *Chargeback) Derive() { c.DisplayAmount = money.Format(c.Amount, c.Currency) }
+
+// SameContent reports whether a and b carry the same client-supplied fields.
+// It is the comparison behind write-avoidance: server-maintained fields such
+// as UpdatedAt and Version are deliberately ignored.
+func SameContent(a, b *Chargeback) bool {
+	return a.Amount == b.Amount && a.Currency == b.Currency && a.Reason == b.Reason &&
+		a.ChargeID == b.ChargeID && a.MerchantID == b.MerchantID
+}
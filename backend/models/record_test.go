@@ -0,0 +1,52 @@
+package models_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/arkantrust/idempotency-example/backend/models"
+)
+
+// FuzzSameContent changes one field of a chargeback, chosen by the fuzzer,
+// and checks that write-avoidance sees exactly the client-supplied changes:
+// SameContent must report a server-maintained field changed as the same
+// content, so that a retried update is not written, and any other field
+// changed as different, so that no update is lost.
+func FuzzSameContent(f *testing.F) {
+	f.Add(int64(100), "USD", "fraud", "ch-1", "m-1", uint8(0), "x")
+	f.Add(int64(0), "", "", "", "", uint8(7), "")
+	f.Fuzz(func(t *testing.T, amount int64, currency, reason, charge, merchant string, field uint8, v string) {
+		a := models.Chargeback{ID: "cb-1", Amount: amount, Currency: currency, Reason: reason, ChargeID: charge, MerchantID: merchant}
+		if !models.SameContent(&a, &a) {
+			t.Fatal("a record differs from itself")
+		}
+
+		b := a
+		client := true
+		switch field % 10 {
+		case 0:
+			b.Amount = amount + int64(len(v)) + 1
+		case 1:
+			b.Currency += v + "X"
+		case 2:
+			b.Reason += v + "x"
+		case 3:
+			b.ChargeID += v + "x"
+		case 4:
+			b.MerchantID += v + "x"
+		case 5:
+			client, b.Owner = false, v
+		case 6:
+			client, b.UpdatedAt = false, time.Unix(int64(len(v)), 0)
+		case 7:
+			client, b.Version = false, a.Version+1
+		case 8:
+			client, b.RequestID = false, v
+		case 9:
+			client, b.DisplayAmount = false, v
+		}
+		if models.SameContent(&a, &b) != !client || models.SameContent(&b, &a) != !client {
+			t.Fatalf("field %d: expected same content %v for %+v and %+v", field%10, !client, a, b)
+		}
+	})
+}
@@ -0,0 +1,58 @@
+package models
+
+import (
+	"encoding/xml"
+	"time"
+
+	"github.com/arkantrust/idempotency-example/backend/money"
+)
+
+// Refund returns part or all of a chargeback's amount. Its ID is chosen by
+// the client and is the idempotency key of its creation, scoped to the
+// chargeback: a retry with the same ID returns the refund the first request
+// created, so a refund is never issued twice.
+type Refund struct {
+	XMLName xml.Name `json:"-" xml:"refund"`
+
+	// ID identifies the refund among its chargeback's.
+	ID string `json:"id" xml:"id"`
+
+	// ChargebackID is the chargeback refunded. It is taken from the path.
+	ChargebackID string `json:"chargebackId" xml:"chargebackId"`
+
+	// Amount is the refunded amount in the smallest currency unit. The
+	// refunds of a chargeback add up to at most its amount.
+	Amount int64 `json:"amount" xml:"amount"`
+
+	// Currency is the chargeback's; omitted on create means that one.
+	Currency string `json:"currency" xml:"currency"`
+
+	// DisplayAmount is Amount formatted like Chargeback.DisplayAmount.
+	DisplayAmount string `json:"displayAmount,omitempty" xml:"displayAmount,omitempty"`
+
+	// CreatedAt is the UTC time the refund was created.
+	CreatedAt time.Time `json:"createdAt" xml:"createdAt"`
+
+	// RequestID is the X-Request-ID of the request that created it. The
+	// store sets it.
+	RequestID string `json:"requestId,omitempty" xml:"requestId,omitempty"`
+}
+
+// Derive sets r.DisplayAmount.
+func (r *Refund) Derive() { r.DisplayAmount = money.Format(r.Amount, r.Currency) }
+
+// Validate checks the fields a client sends. The currency is checked
+// against the chargeback's when the refund is stored.
+func (r *Refund) Validate() error {
+	var e ValidationError
+	if !idPattern.MatchString(r.ID) {
+		e.Fields = append(e.Fields, FieldError{Field: "id", Message: "must be 1-128 characters of letters, digits, '.', '_', ':' or '-', starting with a letter or digit"})
+	}
+	if r.Amount <= 0 {
+		e.Fields = append(e.Fields, FieldError{Field: "amount", Message: "must be a positive number of minor currency units"})
+	}
+	if len(e.Fields) > 0 {
+		return &e
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package models
+
+import "encoding/xml"
+
+// Report breaks the chargebacks of one tenant down by the day, or week, they
+// were created.
+type Report struct {
+	XMLName xml.Name `json:"-" xml:"report"`
+
+	// Tenant is the tenant the figures belong to; empty for the default
+	// tenant.
+	Tenant string `json:"tenant,omitempty" xml:"tenant,omitempty"`
+
+	// Period is "day" or "week".
+	Period string `json:"period" xml:"period,attr"`
+
+	// From and To are the first and last day covered, as YYYY-MM-DD, when
+	// the request bounded them.
+	From string `json:"from,omitempty" xml:"from,omitempty"`
+	To   string `json:"to,omitempty" xml:"to,omitempty"`
+
+	// Periods are in order; periods without chargebacks are left out.
+	Periods []PeriodStats `json:"periods" xml:"periods>period"`
+}
+
+// PeriodStats is the count and summed amounts per currency of the chargebacks
+// created in one period.
+type PeriodStats struct {
+	// Start is the period's first day as YYYY-MM-DD, in UTC: the day itself,
+	// or the Monday of the week.
+	Start string `json:"start" xml:"start,attr"`
+
+	Count int `json:"count" xml:"count"`
+
+	// ByCurrency is sorted by code, as in Stats.
+	ByCurrency []CurrencyStats `json:"byCurrency" xml:"currency"`
+}
+
+// Derive sets the DisplayAmount of each of p.ByCurrency.
+func (p *PeriodStats) Derive() {
+	for i := range p.ByCurrency {
+		p.ByCurrency[i].Derive()
+	}
+}
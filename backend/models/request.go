@@ -0,0 +1,39 @@
+package models
+
+import "time"
+
+// RecordedRequest is an API request as the server received it and what it
+// answered, kept while recording is enabled so that the requests can be
+// replayed against a fresh database.
+type RecordedRequest struct {
+	// Seq numbers the recorded requests in the order they finished.
+	Seq uint64 `json:"seq"`
+
+	// Time is the UTC time the request arrived. Every write the request
+	// made was stamped with it, so a replay stamps records the same way.
+	Time time.Time `json:"time"`
+
+	Method string `json:"method"`
+
+	// URI is the request's path and query.
+	URI string `json:"uri"`
+
+	// Header holds the request headers, without credentials.
+	Header map[string][]string `json:"header,omitempty"`
+
+	Body []byte `json:"body,omitempty"`
+
+	// Truncated is set when Body is only the start of a body too large to
+	// record; such a request cannot be replayed.
+	Truncated bool `json:"truncated,omitempty"`
+
+	// Tenant, Owner and RequestID are what authentication and the request
+	// ID middleware derived for the request, which a replay, made without
+	// credentials, reuses.
+	Tenant    string `json:"tenant,omitempty"`
+	Owner     string `json:"owner,omitempty"`
+	RequestID string `json:"requestId,omitempty"`
+
+	// Status is the status the server answered.
+	Status int `json:"status"`
+}
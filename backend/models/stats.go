@@ -0,0 +1,65 @@
+package models
+
+import (
+	"encoding/xml"
+
+	"github.com/arkantrust/idempotency-example/backend/money"
+)
+
+// Stats summarises the chargebacks of one tenant.
+type Stats struct {
+	XMLName xml.Name `json:"-" xml:"stats"`
+
+	// Tenant is the tenant the figures belong to; empty for the default
+	// tenant.
+	Tenant string `json:"tenant,omitempty" xml:"tenant,omitempty"`
+
+	// Merchant is the merchant the figures are limited to, if any.
+	Merchant string `json:"merchant,omitempty" xml:"merchant,omitempty"`
+
+	// Count is the total number of chargebacks.
+	Count int `json:"count" xml:"count"`
+
+	// ByCurrency breaks the total down per currency, sorted by code. Amounts
+	// in different currencies cannot be summed, so there is no grand total.
+	ByCurrency []CurrencyStats `json:"byCurrency" xml:"currency"`
+
+	// Converted is the grand total of ByCurrency converted into one
+	// currency, when one was asked for.
+	Converted *ConvertedStats `json:"converted,omitempty" xml:"converted,omitempty"`
+}
+
+// ConvertedStats is the summed amount of chargebacks in every currency,
+// converted into one at the exchange rates of one day. Each currency's sum
+// is converted and rounded before they are added up.
+type ConvertedStats struct {
+	Currency string `json:"currency" xml:"code,attr"`
+
+	// Amount is in minor units of Currency, and DisplayAmount the same
+	// formatted like Chargeback.DisplayAmount.
+	Amount        int64  `json:"amount" xml:"amount"`
+	DisplayAmount string `json:"displayAmount,omitempty" xml:"displayAmount,omitempty"`
+
+	// RatesDate is the day the exchange rates used were published, and
+	// RatesProvider where they came from.
+	RatesDate     string `json:"ratesDate" xml:"ratesDate"`
+	RatesProvider string `json:"ratesProvider" xml:"ratesProvider"`
+}
+
+// Derive sets c.DisplayAmount.
+func (c *ConvertedStats) Derive() { c.DisplayAmount = money.Format(c.Amount, c.Currency) }
+
+// CurrencyStats is the count and summed amount of chargebacks in a single
+// currency.
+type CurrencyStats struct {
+	Currency string `json:"currency" xml:"code,attr"`
+	Count    int    `json:"count" xml:"count"`
+
+	// Amount is in minor units, like Chargeback.Amount, and DisplayAmount
+	// the same formatted like Chargeback.DisplayAmount.
+	Amount        int64  `json:"amount" xml:"amount"`
+	DisplayAmount string `json:"displayAmount,omitempty" xml:"displayAmount,omitempty"`
+}
+
+// Derive sets c.DisplayAmount.
+func (c *CurrencyStats) Derive() { c.DisplayAmount = money.Format(c.Amount, c.Currency) }
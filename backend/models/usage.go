@@ -0,0 +1,17 @@
+package models
+
+// Usage counts what one client did in one period.
+type Usage struct {
+	// Owner is the client, as auth.Principal.Owner names it, e.g. "key:k1".
+	Owner string `json:"owner"`
+
+	// Period is the UTC day ("2006-01-02") or month ("2006-01") counted.
+	Period string `json:"period"`
+
+	// Requests counts the API requests the client was let through.
+	Requests int64 `json:"requests"`
+
+	// Writes counts those of them made with a method other than GET, HEAD
+	// and OPTIONS.
+	Writes int64 `json:"writes"`
+}
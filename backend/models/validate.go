@@ -0,0 +1,90 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/arkantrust/idempotency-example/backend/money"
+)
+
+// MaxReasonLength is the longest Reason accepted, in characters.
+const MaxReasonLength = 500
+
+// idPattern restricts IDs to characters that are safe in a URL path segment
+// without escaping, which covers UUIDs, ULIDs and most natural keys.
+var idPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._:-]{0,127}$`)
+
+// FieldError describes one invalid field.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError lists every invalid field of a record, so that a client can
+// fix them all in one round trip.
+type ValidationError struct {
+	Fields []FieldError `json:"fields"`
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		msgs[i] = f.Field + ": " + f.Message
+	}
+	return "invalid chargeback: " + strings.Join(msgs, "; ")
+}
+
+// Validate checks the client-supplied fields of c. It returns nil or a
+// *ValidationError.
+//
+// Validation runs before the idempotency check, so a retry of an invalid
+// request is rejected the same way every time rather than succeeding once a
+// valid record happens to exist under its ID.
+func (c *Chargeback) Validate() error {
+	var e ValidationError
+	add := func(field, format string, args ...any) {
+		e.Fields = append(e.Fields, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if !idPattern.MatchString(c.ID) {
+		add("id", "must be 1-128 characters of letters, digits, '.', '_', ':' or '-', starting with a letter or digit")
+	}
+	validateMoney(add, c.Amount, c.Currency)
+	switch n := utf8.RuneCountInString(strings.TrimSpace(c.Reason)); {
+	case n == 0:
+		add("reason", "must not be empty")
+	case n > MaxReasonLength:
+		add("reason", "must be at most %d characters, got %d", MaxReasonLength, n)
+	case strings.ContainsRune(c.Reason, 0):
+		// NUL opens the stored form of an encrypted field.
+		add("reason", "must not contain NUL characters")
+	}
+	if c.ChargeID != "" && !idPattern.MatchString(c.ChargeID) {
+		add("chargeId", "must be a valid charge ID")
+	}
+	if c.MerchantID != "" && !idPattern.MatchString(c.MerchantID) {
+		add("merchantId", "must be a valid merchant ID")
+	}
+
+	if len(e.Fields) > 0 {
+		return &e
+	}
+	return nil
+}
+
+// validateMoney checks an amount and its currency: the amount must be
+// positive and, in major units, at most money.MaxMajor.
+func validateMoney(add func(field, format string, args ...any), amount int64, currency string) {
+	cur, ok := money.Lookup(currency)
+	switch {
+	case amount <= 0:
+		add("amount", "must be a positive number of minor currency units")
+	case ok && amount > cur.Max():
+		add("amount", "must be at most %s %s (%d minor units)", cur.Format(cur.Max()), cur.Code, cur.Max())
+	}
+	if !ok {
+		add("currency", "must be an active ISO 4217 code, got %q", currency)
+	}
+}
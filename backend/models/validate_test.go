@@ -0,0 +1,88 @@
+package models_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/arkantrust/idempotency-example/backend/models"
+	"github.com/arkantrust/idempotency-example/backend/money"
+)
+
+func TestValidate(t *testing.T) {
+	valid := models.Chargeback{ID: "cb-1", Amount: 100, Currency: "USD", Reason: "fraud"}
+	if err := valid.Validate(); err != nil {
+		t.Fatalf("expected valid chargeback, got %v", err)
+	}
+
+	cases := map[string]struct {
+		mutate func(*models.Chargeback)
+		field  string
+	}{
+		"negative amount":  {func(c *models.Chargeback) { c.Amount = -5 }, "amount"},
+		"zero amount":      {func(c *models.Chargeback) { c.Amount = 0 }, "amount"},
+		"amount too large": {func(c *models.Chargeback) { c.Amount = money.MaxMajor*100 + 1 }, "amount"},
+		"too large in BHD": {func(c *models.Chargeback) { c.Amount, c.Currency = money.MaxMajor*1000+1, "BHD" }, "amount"},
+		"unknown currency": {func(c *models.Chargeback) { c.Currency = "banana" }, "currency"},
+		"lower currency":   {func(c *models.Chargeback) { c.Currency = "usd" }, "currency"},
+		"empty reason":     {func(c *models.Chargeback) { c.Reason = "  " }, "reason"},
+		"long reason":      {func(c *models.Chargeback) { c.Reason = strings.Repeat("x", models.MaxReasonLength+1) }, "reason"},
+		"reason with NUL":  {func(c *models.Chargeback) { c.Reason = "fraud\x00" }, "reason"},
+		"empty id":         {func(c *models.Chargeback) { c.ID = "" }, "id"},
+		"id with slash":    {func(c *models.Chargeback) { c.ID = "a/b" }, "id"},
+	}
+	for name, tc := range cases {
+		c := valid
+		tc.mutate(&c)
+		var ve *models.ValidationError
+		if err := c.Validate(); !errors.As(err, &ve) {
+			t.Fatalf("%s: expected ValidationError, got %v", name, err)
+		}
+		if len(ve.Fields) != 1 || ve.Fields[0].Field != tc.field {
+			t.Fatalf("%s: expected one error on %s, got %+v", name, tc.field, ve.Fields)
+		}
+	}
+}
+
+func TestValidateReportsEveryField(t *testing.T) {
+	c := models.Chargeback{ID: "cb-1", Amount: -5, Currency: "banana"}
+	var ve *models.ValidationError
+	if err := c.Validate(); !errors.As(err, &ve) {
+		t.Fatalf("expected ValidationError, got %v", err)
+	}
+	if len(ve.Fields) != 3 {
+		t.Fatalf("expected errors on amount, currency and reason, got %+v", ve.Fields)
+	}
+}
+
+func TestNewIDIsValidULID(t *testing.T) {
+	a, b := models.NewID(), models.NewID()
+	if len(a) != 26 || a == b {
+		t.Fatalf("expected distinct 26-character IDs, got %q and %q", a, b)
+	}
+	if a[0] > '7' {
+		t.Fatalf("first character must encode at most 3 bits, got %q", a)
+	}
+	c := models.Chargeback{ID: a, Amount: 1, Currency: "USD", Reason: "x"}
+	if err := c.Validate(); err != nil {
+		t.Fatalf("generated ID failed validation: %v", err)
+	}
+}
+
+func TestParseFieldMask(t *testing.T) {
+	m, err := models.ParseFieldMask(" amount, reason ,amount")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(m) != 2 || !m.Has("amount") || !m.Has("reason") || m.Has("currency") {
+		t.Fatalf("unexpected mask: %v", m)
+	}
+	if m, _ := models.ParseFieldMask(""); m != nil || !m.Has("currency") {
+		t.Fatal("expected an empty mask to select every field")
+	}
+	for _, bad := range []string{"ammount", "createdAt", "id"} {
+		if _, err := models.ParseFieldMask(bad); err == nil {
+			t.Fatalf("expected error for %q", bad)
+		}
+	}
+}
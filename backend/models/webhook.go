@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+// WebhookDelivery is one attempt at delivering an Event to a webhook URL,
+// kept so that receivers can find out why an event did not reach them.
+type WebhookDelivery struct {
+	// ID identifies the attempt; the server mints it.
+	ID string `json:"id"`
+
+	EventID   string `json:"eventId"`
+	EventType string `json:"eventType"`
+	URL       string `json:"url"`
+
+	// Attempt counts the attempts at delivering the event to URL, from 1.
+	Attempt int `json:"attempt"`
+
+	// StatusCode is the receiver's answer; absent when none came, in which
+	// case Error says why.
+	StatusCode int `json:"statusCode,omitempty"`
+
+	// Response is the start of the receiver's answer body.
+	Response string `json:"response,omitempty"`
+
+	Error string `json:"error,omitempty"`
+
+	// Delivered reports whether the receiver accepted the event.
+	Delivered bool `json:"delivered"`
+
+	// At is when the attempt started, and DurationMS how long it took.
+	At         time.Time `json:"at"`
+	DurationMS int64     `json:"durationMs"`
+}
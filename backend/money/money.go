@@ -0,0 +1,108 @@
+// Package money knows the active ISO 4217 currencies and how many minor
+// units make up one major unit of each: 100 cents to the dollar, but no
+// subunit of the yen and 1000 fils to the Bahraini dinar.
+//
+// Amounts are kept as integers of minor units everywhere, which is exact;
+// this package turns them into the decimal a person reads.
+package money
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Currency is an ISO 4217 currency.
+type Currency struct {
+	// Code is the three-letter code, e.g. "USD".
+	Code string
+
+	// Exponent is the number of decimal places of the minor unit: 2 for
+	// USD, 0 for JPY, 3 for BHD.
+	Exponent int
+}
+
+// MaxMajor is the largest amount accepted in any currency, in major units.
+// In minor units the limit grows with the exponent, so that it means the
+// same in every currency; see Currency.Max.
+const MaxMajor = 1_000_000_000_000
+
+// Lookup returns the active currency code, or false.
+func Lookup(code string) (Currency, bool) {
+	exp, ok := exponents[code]
+	return Currency{Code: code, Exponent: exp}, ok
+}
+
+// Max returns the largest amount accepted in c, in minor units.
+func (c Currency) Max() int64 {
+	return MaxMajor * pow10(c.Exponent)
+}
+
+// Format returns amount, in minor units of c, as a decimal with c's number
+// of decimal places: 123456 is "1234.56" in USD and "123456" in JPY.
+func (c Currency) Format(amount int64) string {
+	sign := ""
+	u := uint64(amount)
+	if amount < 0 {
+		sign, u = "-", -u
+	}
+	digits := strconv.FormatUint(u, 10)
+	if c.Exponent == 0 {
+		return sign + digits
+	}
+	if len(digits) <= c.Exponent {
+		digits = strings.Repeat("0", c.Exponent-len(digits)+1) + digits
+	}
+	point := len(digits) - c.Exponent
+	return sign + digits[:point] + "." + digits[point:]
+}
+
+// Format formats amount in the currency code, or as a plain integer if the
+// code is not an active currency.
+func Format(amount int64, code string) string {
+	c, ok := Lookup(code)
+	if !ok {
+		return strconv.FormatInt(amount, 10)
+	}
+	return c.Format(amount)
+}
+
+// Convert converts amount, in minor units of from, into minor units of to,
+// where one major unit of from buys rate major units of to. The result is
+// rounded to the nearest minor unit, halves away from zero.
+func Convert(amount int64, from, to Currency, rate float64) int64 {
+	return int64(math.Round(float64(amount) * rate * math.Pow10(to.Exponent-from.Exponent)))
+}
+
+func pow10(n int) int64 {
+	p := int64(1)
+	for range n {
+		p *= 10
+	}
+	return p
+}
+
+// exponents maps the active ISO 4217 codes to their exponents.
+var exponents = func() map[string]int {
+	byExponent := map[int]string{
+		0: `BIF CLP DJF GNF ISK JPY KMF KRW PYG RWF UGX VND VUV XAF XOF XPF`,
+		2: `
+			AED AFN ALL AMD ANG AOA ARS AUD AWG AZN BAM BBD BDT BGN BMD BND
+			BOB BRL BSD BTN BWP BYN BZD CAD CDF CHF CNY COP CRC CUP CVE CZK
+			DKK DOP DZD EGP ERN ETB EUR FJD FKP GBP GEL GHS GIP GMD GTQ GYD
+			HKD HNL HTG HUF IDR ILS INR IRR JMD KES KGS KHR KPW KYD KZT LAK
+			LBP LKR LRD LSL MAD MDL MGA MKD MMK MNT MOP MRU MUR MVR MWK MXN
+			MYR MZN NAD NGN NIO NOK NPR NZD PAB PEN PGK PHP PKR PLN QAR RON
+			RSD RUB SAR SBD SCR SDG SEK SGD SHP SLE SOS SRD SSP STN SVC SYP
+			SZL THB TJS TMT TOP TRY TTD TWD TZS UAH USD UYU UZS VES WST XCD
+			XCG YER ZAR ZMW ZWG`,
+		3: `BHD IQD JOD KWD LYD OMR TND`,
+	}
+	m := map[string]int{}
+	for exp, codes := range byExponent {
+		for _, code := range strings.Fields(codes) {
+			m[code] = exp
+		}
+	}
+	return m
+}()
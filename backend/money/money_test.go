@@ -0,0 +1,48 @@
+package money_test
+
+import (
+	"testing"
+
+	"github.com/arkantrust/idempotency-example/backend/money"
+)
+
+func TestFormat(t *testing.T) {
+	cases := []struct {
+		amount int64
+		code   string
+		want   string
+	}{
+		{123456, "USD", "1234.56"},
+		{7, "USD", "0.07"},
+		{0, "EUR", "0.00"},
+		{-150, "USD", "-1.50"},
+		{123456, "JPY", "123456"},
+		{1500, "BHD", "1.500"},
+		{5, "KWD", "0.005"},
+		{42, "XXX", "42"},
+	}
+	for _, c := range cases {
+		if got := money.Format(c.amount, c.code); got != c.want {
+			t.Errorf("Format(%d, %s) = %q, want %q", c.amount, c.code, got, c.want)
+		}
+	}
+}
+
+func TestMaxFollowsExponent(t *testing.T) {
+	for code, want := range map[string]int64{
+		"JPY": money.MaxMajor,
+		"USD": money.MaxMajor * 100,
+		"BHD": money.MaxMajor * 1000,
+	} {
+		c, ok := money.Lookup(code)
+		if !ok {
+			t.Fatalf("%s is not a known currency", code)
+		}
+		if got := c.Max(); got != want {
+			t.Errorf("%s: Max() = %d, want %d", code, got, want)
+		}
+	}
+	if _, ok := money.Lookup("usd"); ok {
+		t.Error("lower-case code accepted")
+	}
+}
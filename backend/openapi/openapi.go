@@ -0,0 +1,428 @@
+// Package openapi describes the API as an OpenAPI 3 document.
+//
+// The document is generated from the same route table the server registers
+// its handlers from, so a route cannot be served without being documented or
+// documented without being served. Request and response schemas are derived
+// from the Go types the handlers encode, by reflection over their json tags.
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Access says who may call a route.
+type Access int
+
+const (
+	// Public routes need no credentials.
+	Public Access = iota
+
+	// Read and Write routes accept an API key or a JWT bearer token with the
+	// read or write scope respectively.
+	Read
+	Write
+
+	// Admin routes need the admin bearer token, or an API key or a JWT
+	// bearer token with the admin scope.
+	Admin
+)
+
+// Route describes one registered route.
+type Route struct {
+	Method  string
+	Pattern string // ServeMux pattern path, e.g. "/chargebacks/{id}"
+
+	Summary     string
+	Description string
+	Tag         string
+	Access      Access
+
+	// Scopes are the scopes Read and Write callers must all hold.
+	Scopes []string
+
+	// Idempotency says what a retry of the route does. Empty means what
+	// its method implies; see Route.Semantics.
+	Idempotency Idempotency
+
+	// Deprecated marks a route kept for existing clients only.
+	Deprecated bool
+
+	// Sheddable marks a costly, low-priority route, such as a listing or
+	// an export, refused first when the server is overloaded.
+	Sheddable bool
+
+	// Params documents path and query parameters. Path parameters that
+	// appear in Pattern but not here are added without a description.
+	Params []Param
+
+	// Body is a value of the request body type, or nil for no body.
+	Body any
+
+	// MediaTypes lists the content types of the request body and of
+	// successful responses. Empty means application/json.
+	MediaTypes []string
+
+	Responses []Response
+
+	Handler http.HandlerFunc
+}
+
+// Idempotency says what repeating a request to a route does, so clients
+// know which failed requests they may retry, and how.
+type Idempotency string
+
+const (
+	// Safe routes change nothing.
+	Safe Idempotency = "safe"
+
+	// Idempotent routes have the same effect however often they are
+	// repeated, such as PUT and DELETE.
+	Idempotent Idempotency = "idempotent"
+
+	// KeyedByID routes create the record named by the ID in their path; a
+	// retry returns it instead of creating another.
+	KeyedByID Idempotency = "path-id"
+
+	// KeyedByHeader routes are deduplicated by their Idempotency-Key
+	// header: a retry with the same key returns the first result.
+	KeyedByHeader Idempotency = "idempotency-key"
+
+	// NotIdempotent routes act again on every request.
+	NotIdempotent Idempotency = "none"
+)
+
+// Semantics returns rt.Idempotency, or when it is empty what rt's method
+// implies: GET and HEAD are safe, PUT and DELETE idempotent and POST not.
+func (rt Route) Semantics() Idempotency {
+	switch {
+	case rt.Idempotency != "":
+		return rt.Idempotency
+	case rt.Method == http.MethodGet || rt.Method == http.MethodHead:
+		return Safe
+	case rt.Method == http.MethodPut || rt.Method == http.MethodDelete:
+		return Idempotent
+	default:
+		return NotIdempotent
+	}
+}
+
+// Registrar is what routes are registered on: an *http.ServeMux, or a
+// router adding middleware.
+type Registrar interface {
+	Handle(pattern string, h http.Handler)
+}
+
+// Mount registers the handler of every route on r, with no middleware.
+func Mount(r Registrar, routes []Route) {
+	for _, rt := range routes {
+		r.Handle(rt.Method+" "+rt.Pattern, rt.Handler)
+	}
+}
+
+// Param is a path, query or header parameter. All parameters are strings.
+type Param struct {
+	Name        string
+	In          string // "path", "query" or "header"
+	Description string
+	Required    bool
+}
+
+// Response describes one possible response of a route.
+type Response struct {
+	Status      int
+	Description string
+
+	// Body is a value of the response body type. Error statuses (>= 400)
+	// with a nil Body use the shared Error schema.
+	Body any
+
+	// MediaTypes overrides the route's media types for this response.
+	MediaTypes []string
+
+	// Headers names response headers defined in Headers.
+	Headers []string
+}
+
+// Headers are the response headers routes may reference by name.
+var Headers = map[string]string{
+	"X-Idempotency-Write": `"true" when a PUT changed the stored record, "false" when the payload matched and the write was skipped.`,
+	"X-Request-ID":        "Correlation ID of the request, echoed from the request or generated.",
+	"API-Version":         "API version the response was served in.",
+	"Location":            "Path of the created or replayed record.",
+	"Retry-After":         "Seconds to wait before retrying a throttled request.",
+	"RateLimit-Limit":     "Requests allowed per window.",
+	"RateLimit-Remaining": "Requests left in the current window.",
+	"RateLimit-Reset":     "Seconds until the window resets.",
+}
+
+// Info is the document's info object.
+type Info struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+// Document builds the OpenAPI document for routes.
+func Document(info Info, routes []Route) map[string]any {
+	g := &generator{schemas: map[string]any{
+		"Error": object(map[string]any{
+			"error":     map[string]any{"type": "string"},
+			"requestId": map[string]any{"type": "string"},
+		}, "error"),
+	}}
+
+	paths := map[string]map[string]any{}
+	for _, rt := range routes {
+		item := paths[rt.Pattern]
+		if item == nil {
+			item = map[string]any{}
+			paths[rt.Pattern] = item
+		}
+		item[strings.ToLower(rt.Method)] = g.operation(rt)
+	}
+
+	headers := map[string]any{}
+	for name, desc := range Headers {
+		headers[name] = map[string]any{"description": desc, "schema": map[string]any{"type": "string"}}
+	}
+
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info":    info,
+		"paths":   paths,
+		"components": map[string]any{
+			"schemas": g.schemas,
+			"headers": headers,
+			"securitySchemes": map[string]any{
+				"apiKey":     map[string]any{"type": "apiKey", "in": "header", "name": "X-API-Key"},
+				"bearerAuth": map[string]any{"type": "http", "scheme": "bearer", "bearerFormat": "JWT"},
+				"adminToken": map[string]any{"type": "http", "scheme": "bearer"},
+			},
+		},
+	}
+}
+
+type generator struct {
+	schemas map[string]any
+}
+
+var pathParam = regexp.MustCompile(`\{([^}.]+)(\.\.\.)?\}`)
+
+func (g *generator) operation(rt Route) map[string]any {
+	op := map[string]any{
+		"summary":     rt.Summary,
+		"operationId": operationID(rt),
+	}
+	if rt.Description != "" {
+		op["description"] = rt.Description
+	}
+	if rt.Tag != "" {
+		op["tags"] = []string{rt.Tag}
+	}
+	if rt.Deprecated {
+		op["deprecated"] = true
+	}
+
+	params := []any{}
+	documented := map[string]bool{}
+	for _, p := range rt.Params {
+		documented[p.Name] = true
+		params = append(params, param(p))
+	}
+	for _, m := range pathParam.FindAllStringSubmatch(rt.Pattern, -1) {
+		if !documented[m[1]] {
+			params = append(params, param(Param{Name: m[1], In: "path"}))
+		}
+	}
+	if len(params) > 0 {
+		op["parameters"] = params
+	}
+
+	mediaTypes := rt.MediaTypes
+	if len(mediaTypes) == 0 {
+		mediaTypes = []string{"application/json"}
+	}
+	if rt.Body != nil {
+		op["requestBody"] = map[string]any{
+			"required": true,
+			"content":  g.content(mediaTypes, rt.Body),
+		}
+	}
+
+	responses := map[string]any{}
+	for _, r := range rt.Responses {
+		resp := map[string]any{"description": r.Description}
+		switch {
+		case r.Body != nil && len(r.MediaTypes) > 0:
+			resp["content"] = g.content(r.MediaTypes, r.Body)
+		case r.Body != nil && r.Status < 400:
+			resp["content"] = g.content(mediaTypes, r.Body)
+		case r.Body != nil:
+			resp["content"] = g.content([]string{"application/json"}, r.Body)
+		case r.Status >= 400:
+			resp["content"] = map[string]any{"application/json": map[string]any{"schema": ref("Error")}}
+		}
+		if len(r.Headers) > 0 {
+			hs := map[string]any{}
+			for _, h := range r.Headers {
+				hs[h] = map[string]any{"$ref": "#/components/headers/" + h}
+			}
+			resp["headers"] = hs
+		}
+		responses[strconv.Itoa(r.Status)] = resp
+	}
+	op["responses"] = responses
+
+	op["x-idempotency"] = rt.Semantics()
+
+	switch rt.Access {
+	case Read, Write:
+		op["security"] = []any{
+			map[string]any{"apiKey": []string{}},
+			map[string]any{"bearerAuth": append([]string{}, rt.Scopes...)},
+		}
+	case Admin:
+		op["security"] = []any{
+			map[string]any{"adminToken": []string{}},
+			map[string]any{"apiKey": []string{}},
+			map[string]any{"bearerAuth": []string{"admin"}},
+		}
+	}
+	return op
+}
+
+func param(p Param) map[string]any {
+	m := map[string]any{
+		"name":     p.Name,
+		"in":       p.In,
+		"required": p.Required || p.In == "path",
+		"schema":   map[string]any{"type": "string"},
+	}
+	if p.Description != "" {
+		m["description"] = p.Description
+	}
+	return m
+}
+
+// operationID derives a stable identifier such as "postChargebacksId".
+func operationID(rt Route) string {
+	var b strings.Builder
+	b.WriteString(strings.ToLower(rt.Method))
+	for _, part := range strings.FieldsFunc(rt.Pattern, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		b.WriteString(exported(part))
+	}
+	return b.String()
+}
+
+func (g *generator) content(mediaTypes []string, v any) map[string]any {
+	schema := g.schema(reflect.TypeOf(v))
+	c := map[string]any{}
+	for _, mt := range mediaTypes {
+		c[mt] = map[string]any{"schema": schema}
+	}
+	return c
+}
+
+var (
+	timeType = reflect.TypeOf(time.Time{})
+	rawType  = reflect.TypeOf(json.RawMessage(nil))
+)
+
+// schema returns the schema for t. Named struct types are added to the
+// components and referenced; everything else is inlined.
+func (g *generator) schema(t reflect.Type) map[string]any {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == timeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	case t == rawType:
+		// Embedded JSON: any value.
+		return map[string]any{}
+	case t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8:
+		return map[string]any{"type": "string", "format": "binary"}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return map[string]any{"type": "integer"}
+	case reflect.Int64, reflect.Uint64:
+		return map[string]any{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": g.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": g.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.structSchema(t)
+		}
+		name := exported(t.Name())
+		if _, ok := g.schemas[name]; !ok {
+			g.schemas[name] = nil // guards against recursive types
+			g.schemas[name] = g.structSchema(t)
+		}
+		return ref(name)
+	default:
+		return map[string]any{}
+	}
+}
+
+func (g *generator) structSchema(t reflect.Type) map[string]any {
+	props := map[string]any{}
+	var required []string
+	for i := range t.NumField() {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, opts, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		props[name] = g.schema(f.Type)
+		if !strings.Contains(opts, "omitempty") && f.Type.Kind() != reflect.Pointer {
+			required = append(required, name)
+		}
+	}
+	sort.Strings(required)
+	return object(props, required...)
+}
+
+func object(props map[string]any, required ...string) map[string]any {
+	m := map[string]any{"type": "object", "properties": props}
+	if len(required) > 0 {
+		m["required"] = required
+	}
+	return m
+}
+
+func ref(name string) map[string]any {
+	return map[string]any{"$ref": "#/components/schemas/" + name}
+}
+
+func exported(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
@@ -0,0 +1,95 @@
+package openapi_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/arkantrust/idempotency-example/backend/openapi"
+)
+
+type widget struct {
+	ID      string    `json:"id"`
+	Note    string    `json:"note,omitempty"`
+	Created time.Time `json:"created"`
+	Secret  string    `json:"-"`
+}
+
+func TestDocument(t *testing.T) {
+	doc := openapi.Document(openapi.Info{Title: "t", Version: "1"}, []openapi.Route{{
+		Method: "PUT", Pattern: "/widgets/{id}", Access: openapi.Write,
+		Scopes: []string{"widgets:write"},
+		Body:   widget{},
+		Responses: []openapi.Response{
+			{Status: http.StatusOK, Body: widget{}, Headers: []string{"X-Idempotency-Write"}},
+			{Status: http.StatusNotFound},
+		},
+	}})
+
+	// Round-trip through JSON so the assertions see what clients see.
+	raw, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatalf("failed to marshal document: %v", err)
+	}
+	var got struct {
+		Paths map[string]map[string]struct {
+			Parameters []struct {
+				Name     string `json:"name"`
+				In       string `json:"in"`
+				Required bool   `json:"required"`
+			} `json:"parameters"`
+			Security    []map[string][]string `json:"security"`
+			Idempotency string                `json:"x-idempotency"`
+			Responses   map[string]struct {
+				Content map[string]struct {
+					Schema map[string]any `json:"schema"`
+				} `json:"content"`
+				Headers map[string]any `json:"headers"`
+			} `json:"responses"`
+		} `json:"paths"`
+		Components struct {
+			Schemas map[string]struct {
+				Properties map[string]map[string]string `json:"properties"`
+				Required   []string                     `json:"required"`
+			} `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(raw, &got); err != nil {
+		t.Fatalf("failed to unmarshal document: %v", err)
+	}
+
+	op, ok := got.Paths["/widgets/{id}"]["put"]
+	if !ok {
+		t.Fatal("expected PUT /widgets/{id} to be documented")
+	}
+	if len(op.Parameters) != 1 || op.Parameters[0].Name != "id" || op.Parameters[0].In != "path" || !op.Parameters[0].Required {
+		t.Fatalf("expected the path parameter to be derived from the pattern, got %+v", op.Parameters)
+	}
+	if scopes := op.Security[1]["bearerAuth"]; len(scopes) != 1 || scopes[0] != "widgets:write" {
+		t.Fatalf("expected write scope, got %+v", op.Security)
+	}
+	if op.Idempotency != "idempotent" {
+		t.Fatalf("expected PUT to be idempotent, got %q", op.Idempotency)
+	}
+	if ref := op.Responses["200"].Content["application/json"].Schema["$ref"]; ref != "#/components/schemas/Widget" {
+		t.Fatalf("expected a reference to Widget, got %v", ref)
+	}
+	if _, ok := op.Responses["200"].Headers["X-Idempotency-Write"]; !ok {
+		t.Fatal("expected X-Idempotency-Write header on 200")
+	}
+	if ref := op.Responses["404"].Content["application/json"].Schema["$ref"]; ref != "#/components/schemas/Error" {
+		t.Fatalf("expected the Error schema for 404, got %v", ref)
+	}
+
+	w := got.Components.Schemas["Widget"]
+	if _, ok := w.Properties["-"]; ok || len(w.Properties) != 3 {
+		t.Fatalf("unexpected properties: %+v", w.Properties)
+	}
+	if w.Properties["created"]["format"] != "date-time" {
+		t.Fatalf("expected created to be a date-time, got %+v", w.Properties["created"])
+	}
+	if len(w.Required) != 2 || w.Required[0] != "created" || w.Required[1] != "id" {
+		t.Fatalf("expected created and id to be required, got %v", w.Required)
+	}
+}
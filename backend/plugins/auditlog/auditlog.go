@@ -0,0 +1,41 @@
+// Package auditlog is a plugin logging every committed write to chargebacks,
+// charges and merchants, one line each, with the record's ID and version.
+// Importing it registers it as "audit-log"; PLUGINS=audit-log enables it.
+//
+// It doubles as the example of a plugin: a Plugin adding hooks to the
+// service's resources, registered from an init function.
+package auditlog
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/arkantrust/idempotency-example/backend/models"
+	"github.com/arkantrust/idempotency-example/backend/service"
+	"github.com/arkantrust/idempotency-example/backend/store"
+)
+
+// Name is the name the plugin registers under.
+const Name = "audit-log"
+
+func init() {
+	service.RegisterPlugin(Name, func(cs *service.Chargebacks) error {
+		cs.After(logWrite[models.Chargeback, *models.Chargeback]("chargeback"))
+		cs.Charges.After(logWrite[models.Charge, *models.Charge]("charge"))
+		cs.Merchants.After(logWrite[models.Merchant, *models.Merchant]("merchant"))
+		return nil
+	})
+}
+
+// logWrite returns the hook logging writes of kind.
+func logWrite[T any, PT store.RecordPtr[T]](kind string) service.AfterHook[T] {
+	return func(ctx context.Context, action string, item *T) error {
+		rec := PT(item)
+		attrs := []any{"kind", kind, "action", action, "id", rec.RecordID(), "tenant", store.TenantFrom(ctx), "requestId", store.RequestIDFrom(ctx)}
+		if v, ok := any(rec).(models.Versioned); ok {
+			attrs = append(attrs, "version", v.RecordVersion())
+		}
+		slog.InfoContext(ctx, "audit", attrs...)
+		return nil
+	}
+}
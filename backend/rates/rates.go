@@ -0,0 +1,169 @@
+// Package rates supplies the exchange rates chargeback figures are converted
+// with.
+//
+// A Provider fetches the rates – a Static table from the configuration, or
+// the European Central Bank's daily reference rates – and Refresh keeps the
+// latest in a Cache, which is what requests read: a conversion never waits on
+// the provider, and carries on with the last rates fetched while it is down.
+package rates
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/arkantrust/idempotency-example/backend/models"
+	"github.com/arkantrust/idempotency-example/backend/money"
+)
+
+// Provider fetches the current exchange rates.
+type Provider interface {
+	Rates(ctx context.Context) (*models.ExchangeRates, error)
+}
+
+// Cache keeps the latest exchange rates; *store.Store is one.
+type Cache interface {
+	SaveExchangeRates(ctx context.Context, r *models.ExchangeRates) error
+	ExchangeRates(ctx context.Context) (*models.ExchangeRates, error)
+}
+
+// Refresh fetches the rates from p and saves them in c.
+func Refresh(ctx context.Context, p Provider, c Cache) (*models.ExchangeRates, error) {
+	r, err := p.Rates(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.SaveExchangeRates(ctx, r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Static is a fixed table of rates, for deployments without access to a
+// feed and for tests.
+type Static struct {
+	// Base is the currency the rates are quoted against.
+	Base string
+
+	// Table maps currency codes to the units one unit of Base buys.
+	Table map[string]float64
+}
+
+// ParseStatic returns the Static table of pairs, each "CODE=rate", quoted
+// against base.
+func ParseStatic(base string, pairs []string) (*Static, error) {
+	if _, ok := money.Lookup(base); !ok {
+		return nil, fmt.Errorf("unknown base currency %q", base)
+	}
+	s := &Static{Base: base, Table: map[string]float64{}}
+	for _, pair := range pairs {
+		code, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("rate %q is not CODE=rate", pair)
+		}
+		if _, ok := money.Lookup(code); !ok {
+			return nil, fmt.Errorf("rate %q: unknown currency %q", pair, code)
+		}
+		rate, err := strconv.ParseFloat(value, 64)
+		if err != nil || rate <= 0 {
+			return nil, fmt.Errorf("rate %q: not a positive number", pair)
+		}
+		s.Table[code] = rate
+	}
+	return s, nil
+}
+
+// Rates returns the table, dated today.
+func (s *Static) Rates(ctx context.Context) (*models.ExchangeRates, error) {
+	now := time.Now().UTC()
+	return &models.ExchangeRates{
+		Base:      s.Base,
+		Date:      now.Format(time.DateOnly),
+		Rates:     maps.Clone(s.Table),
+		Provider:  "static",
+		FetchedAt: now,
+	}, nil
+}
+
+// ECBURL is the European Central Bank's feed of the day's euro reference
+// rates, published around 16:00 CET on working days.
+const ECBURL = "https://www.ecb.europa.eu/stats/eurofxref/eurofxref-daily.xml"
+
+// maxFeedBytes bounds the feed read; the real one is under 2 KiB.
+const maxFeedBytes = 1 << 20
+
+// ECB fetches the European Central Bank's euro reference rates.
+type ECB struct {
+	// URL is the feed; empty means ECBURL.
+	URL string
+
+	// Client makes the request; nil means http.DefaultClient.
+	Client *http.Client
+}
+
+// ecbFeed is the part of the feed's XML read. The feed nests the rates of
+// one day in a Cube, in a Cube, in a Cube.
+type ecbFeed struct {
+	Day struct {
+		Time  string `xml:"time,attr"`
+		Rates []struct {
+			Currency string  `xml:"currency,attr"`
+			Rate     float64 `xml:"rate,attr"`
+		} `xml:"Cube"`
+	} `xml:"Cube>Cube"`
+}
+
+// Rates fetches the day's rates from the feed. Currencies the money package
+// does not know are left out.
+func (e *ECB) Rates(ctx context.Context) (*models.ExchangeRates, error) {
+	url, client := e.URL, e.Client
+	if url == "" {
+		url = ECBURL
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching ECB rates: %s", resp.Status)
+	}
+
+	var feed ecbFeed
+	if err := xml.NewDecoder(io.LimitReader(resp.Body, maxFeedBytes)).Decode(&feed); err != nil {
+		return nil, fmt.Errorf("parsing ECB rates: %w", err)
+	}
+	if _, err := time.Parse(time.DateOnly, feed.Day.Time); err != nil {
+		return nil, fmt.Errorf("parsing ECB rates: invalid date %q", feed.Day.Time)
+	}
+	r := &models.ExchangeRates{
+		Base:      "EUR",
+		Date:      feed.Day.Time,
+		Rates:     map[string]float64{},
+		Provider:  "ecb",
+		FetchedAt: time.Now().UTC(),
+	}
+	for _, c := range feed.Day.Rates {
+		if _, ok := money.Lookup(c.Currency); ok && c.Rate > 0 {
+			r.Rates[c.Currency] = c.Rate
+		}
+	}
+	if len(r.Rates) == 0 {
+		return nil, errors.New("parsing ECB rates: no rates in the feed")
+	}
+	return r, nil
+}
@@ -0,0 +1,96 @@
+package rates_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/arkantrust/idempotency-example/backend/rates"
+	"github.com/arkantrust/idempotency-example/backend/store"
+)
+
+const feed = `<?xml version="1.0" encoding="UTF-8"?>
+<gesmes:Envelope xmlns:gesmes="http://www.gesmes.org/xml/2002-08-01" xmlns="http://www.ecb.int/vocabulary/2002-08-01/eurofxref">
+	<gesmes:subject>Reference rates</gesmes:subject>
+	<gesmes:Sender><gesmes:name>European Central Bank</gesmes:name></gesmes:Sender>
+	<Cube>
+		<Cube time="2026-10-16">
+			<Cube currency="USD" rate="1.0850"/>
+			<Cube currency="JPY" rate="162.50"/>
+			<Cube currency="XYZ" rate="3"/>
+		</Cube>
+	</Cube>
+</gesmes:Envelope>`
+
+func TestECB(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(feed))
+	}))
+	defer srv.Close()
+
+	r, err := (&rates.ECB{URL: srv.URL}).Rates(context.Background())
+	if err != nil {
+		t.Fatalf("rates: %v", err)
+	}
+	if r.Base != "EUR" || r.Date != "2026-10-16" || r.Provider != "ecb" {
+		t.Fatalf("unexpected table %+v", r)
+	}
+	if len(r.Rates) != 2 || r.Rates["USD"] != 1.085 || r.Rates["JPY"] != 162.5 {
+		t.Fatalf("expected USD and JPY only, got %v", r.Rates)
+	}
+	if rate, ok := r.Rate("USD", "JPY"); !ok || rate < 149.7 || rate > 149.8 {
+		t.Fatalf("expected USD/JPY of about 149.77, got %v, %v", rate, ok)
+	}
+}
+
+func TestECBFailure(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "down", http.StatusBadGateway)
+	}))
+	defer srv.Close()
+
+	if _, err := (&rates.ECB{URL: srv.URL}).Rates(context.Background()); err == nil {
+		t.Fatal("expected an error from a failing feed")
+	}
+}
+
+func TestParseStatic(t *testing.T) {
+	for _, pairs := range [][]string{{"USD"}, {"usd=1.1"}, {"USD=0"}, {"USD=x"}} {
+		if _, err := rates.ParseStatic("EUR", pairs); err == nil {
+			t.Errorf("%q: expected an error", pairs)
+		}
+	}
+	if _, err := rates.ParseStatic("EURO", []string{"USD=1.1"}); err == nil {
+		t.Error("expected an error for an unknown base")
+	}
+}
+
+func TestRefreshCachesRates(t *testing.T) {
+	s, err := store.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer s.Close()
+	ctx := context.Background()
+
+	if _, err := s.ExchangeRates(ctx); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("expected no rates before a refresh, got %v", err)
+	}
+	p, err := rates.ParseStatic("EUR", []string{"USD=1.1", "GBP=0.85"})
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if _, err := rates.Refresh(ctx, p, s); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	r, err := s.ExchangeRates(ctx)
+	if err != nil {
+		t.Fatalf("cached rates: %v", err)
+	}
+	if r.Provider != "static" || r.Rates["USD"] != 1.1 || r.Rates["GBP"] != 0.85 {
+		t.Fatalf("unexpected cached table %+v", r)
+	}
+}
@@ -0,0 +1,182 @@
+// Package reconcile compares the stored chargebacks with a payment
+// processor's settlement file.
+//
+// A settlement file is CSV with a header row naming at least the id, amount
+// and currency columns, in any order; other columns are ignored. Amounts are
+// in minor units, like models.Chargeback.Amount. Every chargeback of the
+// tenant ends up in exactly one bucket of the report: matched, missing
+// (settled but not stored), mismatched (stored with another amount or
+// currency) or extra (stored but not settled).
+//
+// Reconciliation is idempotent. The report ID is derived from the tenant and
+// the file's bytes, and the first report for an ID is saved: running the
+// same file again returns that report rather than a new one, however often a
+// job or an operator retries it.
+package reconcile
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/arkantrust/idempotency-example/backend/models"
+	"github.com/arkantrust/idempotency-example/backend/store"
+)
+
+// ErrInvalidFile wraps every error about the contents of a settlement file.
+var ErrInvalidFile = errors.New("invalid settlement file")
+
+// File is a parsed settlement file.
+type File struct {
+	Lines []models.SettlementLine
+
+	// SHA256 is the hex SHA-256 of the file's bytes.
+	SHA256 string
+}
+
+// columns are the header names Parse requires.
+var columns = []string{"id", "amount", "currency"}
+
+// Parse reads a settlement file. A file with a malformed line is rejected
+// as a whole, since a report on part of it would be misleading.
+func Parse(r io.Reader) (*File, error) {
+	h := sha256.New()
+	cr := csv.NewReader(io.TeeReader(r, h))
+	cr.FieldsPerRecord = -1
+
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("%w: empty file", ErrInvalidFile)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidFile, err)
+	}
+	index := map[string]int{}
+	for i, name := range header {
+		index[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range columns {
+		if _, ok := index[name]; !ok {
+			return nil, fmt.Errorf("%w: no %q column", ErrInvalidFile, name)
+		}
+	}
+
+	f := &File{}
+	seen := map[string]int{}
+	for {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidFile, err)
+		}
+		n, _ := cr.FieldPos(0)
+		field := func(name string) string {
+			if i := index[name]; i < len(rec) {
+				return strings.TrimSpace(rec[i])
+			}
+			return ""
+		}
+
+		l := models.SettlementLine{Line: n, ID: field("id"), Currency: strings.ToUpper(field("currency"))}
+		if l.ID == "" {
+			return nil, fmt.Errorf("%w: line %d: empty id", ErrInvalidFile, n)
+		}
+		if first, ok := seen[l.ID]; ok {
+			return nil, fmt.Errorf("%w: line %d: id %q already settled on line %d", ErrInvalidFile, n, l.ID, first)
+		}
+		seen[l.ID] = n
+		if l.Amount, err = strconv.ParseInt(field("amount"), 10, 64); err != nil {
+			return nil, fmt.Errorf("%w: line %d: amount must be an integer in minor units", ErrInvalidFile, n)
+		}
+		f.Lines = append(f.Lines, l)
+	}
+	f.SHA256 = hex.EncodeToString(h.Sum(nil))
+	return f, nil
+}
+
+// ReportID returns the ID of the report on the file with the given hash for
+// tenant.
+func ReportID(tenant, sha string) string {
+	sum := sha256.Sum256([]byte(tenant + "\x00" + sha))
+	return "rec_" + hex.EncodeToString(sum[:16])
+}
+
+// Compare reconciles f with the chargebacks forEach yields, which must come
+// in ID order, as store.Store.ForEach yields them.
+func Compare(f *File, forEach func(fn func(models.Chargeback) error) error) (*models.Reconciliation, error) {
+	r := &models.Reconciliation{
+		FileSHA256: f.SHA256,
+		Settled:    len(f.Lines),
+		Missing:    []models.SettlementLine{},
+		Mismatched: []models.Mismatch{},
+		Extra:      []models.SettlementLine{},
+	}
+	settled := make(map[string]models.SettlementLine, len(f.Lines))
+	for _, l := range f.Lines {
+		settled[l.ID] = l
+	}
+	found := make(map[string]models.Chargeback, len(f.Lines))
+
+	err := forEach(func(c models.Chargeback) error {
+		if _, ok := settled[c.ID]; !ok {
+			r.Extra = append(r.Extra, models.SettlementLine{ID: c.ID, Amount: c.Amount, Currency: c.Currency})
+			return nil
+		}
+		found[c.ID] = c
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, l := range f.Lines {
+		c, ok := found[l.ID]
+		switch {
+		case !ok:
+			r.Missing = append(r.Missing, l)
+		case c.Amount != l.Amount || c.Currency != l.Currency:
+			r.Mismatched = append(r.Mismatched, models.Mismatch{
+				Line: l.Line, ID: l.ID,
+				SettledAmount: l.Amount, SettledCurrency: l.Currency,
+				StoredAmount: c.Amount, StoredCurrency: c.Currency,
+			})
+		default:
+			r.Matched++
+		}
+	}
+	return r, nil
+}
+
+// Run reconciles the settlement file read from file with the chargebacks of
+// the tenant in ctx and saves the report, returning it with created true; or,
+// when the same file has been reconciled before, returns that report with
+// created false.
+func Run(ctx context.Context, s *store.Store, file io.Reader) (r *models.Reconciliation, created bool, err error) {
+	f, err := Parse(file)
+	if err != nil {
+		return nil, false, err
+	}
+	tenant := store.TenantFrom(ctx)
+	id := ReportID(tenant, f.SHA256)
+	if r, err := s.Reconciliation(ctx, id); err == nil {
+		return r, false, nil
+	} else if !errors.Is(err, store.ErrNotFound) {
+		return nil, false, err
+	}
+
+	r, err = Compare(f, func(fn func(models.Chargeback) error) error { return s.ForEach(ctx, fn) })
+	if err != nil {
+		return nil, false, err
+	}
+	r.ID, r.Tenant, r.CreatedAt = id, tenant, time.Now().UTC()
+	return s.SaveReconciliation(ctx, r)
+}
@@ -0,0 +1,80 @@
+package reconcile_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/arkantrust/idempotency-example/backend/models"
+	"github.com/arkantrust/idempotency-example/backend/reconcile"
+	"github.com/arkantrust/idempotency-example/backend/store"
+)
+
+func TestParseRejectsMalformedFiles(t *testing.T) {
+	for name, file := range map[string]string{
+		"empty":          "",
+		"missing column": "id,amount\ncb_1,100\n",
+		"empty id":       "id,amount,currency\n,100,USD\n",
+		"duplicate id":   "id,amount,currency\ncb_1,100,USD\ncb_1,100,USD\n",
+		"decimal amount": "id,amount,currency\ncb_1,1.00,USD\n",
+	} {
+		if _, err := reconcile.Parse(strings.NewReader(file)); !errors.Is(err, reconcile.ErrInvalidFile) {
+			t.Fatalf("%s: expected ErrInvalidFile, got %v", name, err)
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	s, err := store.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	ctx := context.Background()
+	for _, c := range []models.Chargeback{
+		{ID: "cb_1", Amount: 100, Currency: "USD", Reason: "fraud"},
+		{ID: "cb_2", Amount: 200, Currency: "USD", Reason: "fraud"},
+		{ID: "cb_3", Amount: 300, Currency: "EUR", Reason: "fraud"},
+	} {
+		if _, _, err := s.Create(ctx, &c); err != nil {
+			t.Fatalf("create: %v", err)
+		}
+	}
+
+	// Columns in another order, an ignored column and a lower case currency.
+	file := "currency,id,amount,note\nusd,cb_1,100,ok\nUSD,cb_2,250,\nUSD,cb_9,50,\n"
+	r, created, err := reconcile.Run(ctx, s, strings.NewReader(file))
+	if err != nil || !created {
+		t.Fatalf("run: created %v, %v", created, err)
+	}
+	if r.Settled != 3 || r.Matched != 1 {
+		t.Fatalf("settled %d, matched %d; want 3, 1", r.Settled, r.Matched)
+	}
+	if len(r.Mismatched) != 1 || r.Mismatched[0].ID != "cb_2" || r.Mismatched[0].Line != 3 ||
+		r.Mismatched[0].SettledAmount != 250 || r.Mismatched[0].StoredAmount != 200 {
+		t.Fatalf("mismatched %+v", r.Mismatched)
+	}
+	if len(r.Missing) != 1 || r.Missing[0].ID != "cb_9" {
+		t.Fatalf("missing %+v", r.Missing)
+	}
+	if len(r.Extra) != 1 || r.Extra[0].ID != "cb_3" {
+		t.Fatalf("extra %+v", r.Extra)
+	}
+
+	// The same file again, after the data changed, replays the first report.
+	if _, err := s.Delete(ctx, "cb_3"); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	again, created, err := reconcile.Run(ctx, s, strings.NewReader(file))
+	if err != nil || created {
+		t.Fatalf("rerun: created %v, %v", created, err)
+	}
+	if again.ID != r.ID || len(again.Extra) != 1 {
+		t.Fatalf("rerun returned %+v, want the first report %s", again, r.ID)
+	}
+	if got, err := s.Reconciliation(ctx, r.ID); err != nil || got.ID != r.ID {
+		t.Fatalf("get saved report: %v", err)
+	}
+}
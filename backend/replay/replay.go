@@ -0,0 +1,162 @@
+// Package replay re-sends the requests a server recorded (see
+// middleware.Record) to a fresh database and checks that they leave it in
+// the state they left the recorded one in: a practical proof that the API
+// is deterministic and its retries idempotent.
+//
+// The requests are served in process, in the order they finished, each with
+// the time, tenant, owner and request ID the server gave it, so that records
+// are stamped as they were. Retries, replays and skipped updates in the log
+// must come out the same for the states to match. Chargebacks created under
+// an Idempotency-Key get a freshly minted ID, so they are compared without
+// it, and later requests naming the recorded ID are reported as mismatches.
+//
+// The comparison needs the recording to start with an empty database: the
+// records that were there before it began are reported missing.
+package replay
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+
+	"github.com/arkantrust/idempotency-example/backend/handlers"
+	"github.com/arkantrust/idempotency-example/backend/models"
+	"github.com/arkantrust/idempotency-example/backend/service"
+	"github.com/arkantrust/idempotency-example/backend/store"
+)
+
+// Mismatch is a request whose replay was answered with another status.
+type Mismatch struct {
+	Seq      uint64 `json:"seq"`
+	Method   string `json:"method"`
+	URI      string `json:"uri"`
+	Recorded int    `json:"recorded"`
+	Replayed int    `json:"replayed"`
+}
+
+// Report is the outcome of Run.
+type Report struct {
+	// Requests is how many requests were replayed, and Skipped how many
+	// were not because their body was truncated.
+	Requests int `json:"requests"`
+	Skipped  int `json:"skipped"`
+
+	// Mismatches lists the requests answered differently. A mismatch is a
+	// symptom; the states are what must agree.
+	Mismatches []Mismatch `json:"mismatches,omitempty"`
+
+	// Missing lists the records of the recorded database the replay did not
+	// produce, and Extra those it produced that the recorded database does
+	// not have.
+	Missing []string `json:"missing,omitempty"`
+	Extra   []string `json:"extra,omitempty"`
+}
+
+// OK reports whether the replay reproduced the recorded state.
+func (r Report) OK() bool {
+	return len(r.Missing) == 0 && len(r.Extra) == 0
+}
+
+// Run replays the requests recorded in recorded against a fresh database
+// created in dir, and compares the two.
+func Run(ctx context.Context, recorded *store.Store, dir string) (Report, error) {
+	var report Report
+	fresh, err := store.New(filepath.Join(dir, "replay.db"))
+	if err != nil {
+		return report, err
+	}
+	defer fresh.Close()
+	h := handlers.New(fresh, service.NewChargebacks(fresh))
+
+	tenants := map[string]bool{"": true}
+	err = recorded.ForEachRecordedRequest(ctx, func(rec models.RecordedRequest) error {
+		tenants[rec.Tenant] = true
+		if rec.Truncated {
+			report.Skipped++
+			return nil
+		}
+		report.Requests++
+		req := httptest.NewRequest(rec.Method, rec.URI, bytes.NewReader(rec.Body))
+		req.Header = http.Header(rec.Header).Clone()
+		rctx := store.WithTenant(store.WithOwner(req.Context(), rec.Owner), rec.Tenant)
+		rctx = store.WithTime(store.WithRequestID(rctx, rec.RequestID), rec.Time)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req.WithContext(rctx))
+		if w.Code != rec.Status {
+			report.Mismatches = append(report.Mismatches, Mismatch{Seq: rec.Seq, Method: rec.Method, URI: rec.URI, Recorded: rec.Status, Replayed: w.Code})
+		}
+		return nil
+	})
+	if err != nil {
+		return report, err
+	}
+
+	for _, tenant := range slices.Sorted(maps.Keys(tenants)) {
+		ctx := store.WithTenant(ctx, tenant)
+		want, err := state(ctx, recorded)
+		if err != nil {
+			return report, err
+		}
+		got, err := state(ctx, fresh)
+		if err != nil {
+			return report, err
+		}
+		report.Missing = append(report.Missing, difference(want, got)...)
+		report.Extra = append(report.Extra, difference(got, want)...)
+	}
+	return report, nil
+}
+
+// state describes the records of the tenant of ctx in s, one string per
+// record. Chargebacks are described without their ID: a stored record does
+// not say whether the client chose it or the server minted it.
+func state(ctx context.Context, s *store.Store) ([]string, error) {
+	tenant := store.TenantFrom(ctx)
+	var out []string
+	cbs, err := s.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range cbs {
+		c.ID = ""
+		out = append(out, fmt.Sprintf("tenant %q chargeback %+v", tenant, c))
+	}
+	charges, err := s.Charges().List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range charges {
+		out = append(out, fmt.Sprintf("tenant %q charge %+v", tenant, c))
+	}
+	merchants, err := s.Merchants().List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range merchants {
+		out = append(out, fmt.Sprintf("tenant %q merchant %+v", tenant, m))
+	}
+	return out, nil
+}
+
+// difference returns the elements of a, counted with multiplicity, that b
+// lacks.
+func difference(a, b []string) []string {
+	left := map[string]int{}
+	for _, s := range b {
+		left[s]++
+	}
+	var out []string
+	for _, s := range a {
+		if left[s] > 0 {
+			left[s]--
+			continue
+		}
+		out = append(out, s)
+	}
+	return out
+}
@@ -0,0 +1,121 @@
+package replay_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/arkantrust/idempotency-example/backend/handlers"
+	"github.com/arkantrust/idempotency-example/backend/middleware"
+	"github.com/arkantrust/idempotency-example/backend/models"
+	"github.com/arkantrust/idempotency-example/backend/replay"
+	"github.com/arkantrust/idempotency-example/backend/service"
+	"github.com/arkantrust/idempotency-example/backend/store"
+)
+
+func newStore(t *testing.T) *store.Store {
+	t.Helper()
+	s, err := store.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// recording returns a store and a handler serving it that records every
+// request in it, with the tenant set from the X-Tenant header as the Tenant
+// middleware would.
+func recording(t *testing.T) (*store.Store, http.Handler) {
+	t.Helper()
+	s := newStore(t)
+	h := middleware.Record(s, 1<<20)(handlers.New(s, service.NewChargebacks(s)))
+	return s, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.ServeHTTP(w, r.WithContext(store.WithTenant(r.Context(), r.Header.Get("X-Tenant"))))
+	})
+}
+
+func send(h http.Handler, method, target, tenant, key, body string) int {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if tenant != "" {
+		req.Header.Set("X-Tenant", tenant)
+	}
+	if key != "" {
+		req.Header.Set("Idempotency-Key", key)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w.Code
+}
+
+func TestRunReproducesState(t *testing.T) {
+	s, h := recording(t)
+	body := `{"amount":500,"currency":"USD","reason":"fraud"}`
+	for _, r := range []struct{ method, target, tenant, key, body string }{
+		{"POST", "/chargebacks/cb-1", "", "", body},
+		{"POST", "/chargebacks/cb-1", "", "", body},
+		{"PUT", "/chargebacks/cb-1", "", "", `{"amount":700,"currency":"USD","reason":"fraud"}`},
+		{"PUT", "/chargebacks/cb-1", "", "", `{"amount":700,"currency":"USD","reason":"fraud"}`},
+		{"POST", "/chargebacks", "", "k-1", body},
+		{"POST", "/chargebacks", "", "k-1", body},
+		{"POST", "/chargebacks/cb-2", "acme", "", body},
+		{"DELETE", "/chargebacks/cb-2", "acme", "", ""},
+		{"DELETE", "/chargebacks/cb-2", "acme", "", ""},
+		{"POST", "/chargebacks/cb-3", "acme", "", `{"amount":-1}`},
+		{"POST", "/charges/ch-1", "", "", `{"amount":500,"currency":"USD"}`},
+	} {
+		send(h, r.method, r.target, r.tenant, r.key, r.body)
+	}
+
+	report, err := replay.Run(context.Background(), s, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.OK() || len(report.Mismatches) > 0 {
+		t.Fatalf("report = %+v, want the recorded state and statuses", report)
+	}
+	if report.Requests != 11 || report.Skipped != 0 {
+		t.Errorf("requests, skipped = %d, %d; want 11, 0", report.Requests, report.Skipped)
+	}
+}
+
+func TestRunReportsDifferences(t *testing.T) {
+	s, h := recording(t)
+	send(h, "POST", "/chargebacks/cb-1", "", "", `{"amount":500,"currency":"USD","reason":"fraud"}`)
+	// A write the log does not have, as if recording had been off.
+	if _, _, err := s.Create(context.Background(), &models.Chargeback{ID: "cb-2", Amount: 100, Currency: "EUR", Reason: "duplicate"}); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := replay.Run(context.Background(), s, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.OK() || len(report.Missing) != 1 || len(report.Extra) != 0 {
+		t.Fatalf("report = %+v, want cb-2 missing", report)
+	}
+	if !strings.Contains(report.Missing[0], "duplicate") {
+		t.Errorf("missing = %q, want cb-2", report.Missing[0])
+	}
+}
+
+func TestRecordSkipsTruncatedBodies(t *testing.T) {
+	s := newStore(t)
+	h := middleware.Record(s, 8)(handlers.New(s, service.NewChargebacks(s)))
+	send(h, "POST", "/chargebacks/cb-1", "", "", `{"amount":500,"currency":"USD","reason":"fraud"}`)
+
+	report, err := replay.Run(context.Background(), s, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Skipped != 1 || report.Requests != 0 {
+		t.Errorf("requests, skipped = %d, %d; want 0, 1", report.Requests, report.Skipped)
+	}
+	if len(report.Missing) != 1 {
+		t.Errorf("missing = %v, want the chargeback the skipped request created", report.Missing)
+	}
+}
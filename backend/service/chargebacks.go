@@ -0,0 +1,426 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/arkantrust/idempotency-example/backend/metrics"
+	"github.com/arkantrust/idempotency-example/backend/models"
+	"github.com/arkantrust/idempotency-example/backend/money"
+	"github.com/arkantrust/idempotency-example/backend/store"
+)
+
+// Chargebacks is the chargeback resource plus the operations only
+// chargebacks have.
+type Chargebacks struct {
+	*Resource[models.Chargeback, *models.Chargeback]
+
+	// Charges and Merchants are the resources of the records chargebacks
+	// reference.
+	Charges   *Resource[models.Charge, *models.Charge]
+	Merchants *Resource[models.Merchant, *models.Merchant]
+
+	// Rates, when set, supplies the exchange rates Convert uses.
+	Rates RateSource
+
+	store Backend
+}
+
+// RateSource supplies exchange rates. *store.Store is one, reading the
+// rates a refresh job caches.
+type RateSource interface {
+	ExchangeRates(ctx context.Context) (*models.ExchangeRates, error)
+}
+
+// ErrNoRates is returned by Convert when it has no exchange rate for a
+// currency it needs.
+var ErrNoRates = errors.New("no exchange rate available")
+
+// Backend stores chargebacks for Chargebacks: the records themselves, and
+// the operations on many at once or outside the resource model.
+type Backend interface {
+	Collection[models.Chargeback]
+	CreateWithKey(ctx context.Context, key string, c *models.Chargeback) (*models.Chargeback, bool, error)
+	CreateMany(ctx context.Context, cs []*models.Chargeback) (*store.Imported, error)
+	DeleteMatching(ctx context.Context, f store.Filter) ([]models.Chargeback, error)
+	Stats(ctx context.Context) (*models.Stats, error)
+	DailyTotals(ctx context.Context, from, to time.Time) ([]models.PeriodStats, error)
+	Erase(ctx context.Context, id string) (*models.Erasure, bool, error)
+	ExpireKey(ctx context.Context, op, key string, anyOwner bool) (int, error)
+	CreateRefund(ctx context.Context, id string, r *models.Refund) (*models.Refund, bool, error)
+	Refunds(ctx context.Context, id string) ([]models.Refund, error)
+
+	// Charges and Merchants store the records the chargebacks reference.
+	// Only their creation is served: they never change.
+	Charges() Collection[models.Charge]
+	Merchants() Collection[models.Merchant]
+	ForEachOfMerchant(ctx context.Context, id string, fn func(models.Chargeback) error) error
+	MerchantStats(ctx context.Context, id string) (*models.Stats, error)
+}
+
+// Local returns the Backend of the single store s.
+func Local(s *store.Store) Backend {
+	return local{Collection: s.Chargebacks(), s: s}
+}
+
+// local is the Backend of a single store.
+type local struct {
+	*store.Collection[models.Chargeback, *models.Chargeback]
+	s *store.Store
+}
+
+func (l local) CreateWithKey(ctx context.Context, key string, c *models.Chargeback) (*models.Chargeback, bool, error) {
+	return l.s.CreateWithKey(ctx, key, c)
+}
+
+func (l local) CreateMany(ctx context.Context, cs []*models.Chargeback) (*store.Imported, error) {
+	return l.s.CreateMany(ctx, cs)
+}
+
+func (l local) DeleteMatching(ctx context.Context, f store.Filter) ([]models.Chargeback, error) {
+	return l.s.DeleteMatching(ctx, f)
+}
+
+func (l local) Stats(ctx context.Context) (*models.Stats, error) {
+	return l.s.Stats(ctx)
+}
+
+func (l local) DailyTotals(ctx context.Context, from, to time.Time) ([]models.PeriodStats, error) {
+	return l.s.DailyTotals(ctx, from, to)
+}
+
+func (l local) Erase(ctx context.Context, id string) (*models.Erasure, bool, error) {
+	return l.s.Erase(ctx, id)
+}
+
+func (l local) ExpireKey(ctx context.Context, op, key string, anyOwner bool) (int, error) {
+	return l.s.ExpireKey(ctx, op, key, anyOwner)
+}
+
+func (l local) Charges() Collection[models.Charge] {
+	return l.s.Charges()
+}
+
+func (l local) Merchants() Collection[models.Merchant] {
+	return l.s.Merchants()
+}
+
+func (l local) ForEachOfMerchant(ctx context.Context, id string, fn func(models.Chargeback) error) error {
+	return l.s.ForEachOfMerchant(ctx, id, fn)
+}
+
+func (l local) MerchantStats(ctx context.Context, id string) (*models.Stats, error) {
+	return l.s.MerchantStats(ctx, id)
+}
+
+func (l local) CreateRefund(ctx context.Context, id string, r *models.Refund) (*models.Refund, bool, error) {
+	return l.s.CreateRefund(ctx, id, r)
+}
+
+func (l local) Refunds(ctx context.Context, id string) ([]models.Refund, error) {
+	return l.s.Refunds(ctx, id)
+}
+
+// chargebackSpec describes chargebacks to the resource machinery.
+var chargebackSpec = Spec[models.Chargeback]{
+	Name:     "chargebacks",
+	Kind:     "chargeback",
+	Validate: (*models.Chargeback).Validate,
+	Equal:    models.SameContent,
+	Fields:   models.UpdatableFields,
+	Merge:    models.FieldMask.Merge,
+	Creates:  metrics.Creates,
+	Updates:  metrics.Updates,
+	Deletes:  metrics.Deletes,
+}
+
+// chargeSpec describes charges to the resource machinery. They have no
+// updatable fields.
+var chargeSpec = Spec[models.Charge]{
+	Name:     "charges",
+	Kind:     "charge",
+	Validate: (*models.Charge).Validate,
+	Equal:    models.SameCharge,
+}
+
+// merchantSpec describes merchants to the resource machinery, like
+// chargeSpec.
+var merchantSpec = Spec[models.Merchant]{
+	Name:     "merchants",
+	Kind:     "merchant",
+	Validate: (*models.Merchant).Validate,
+	Equal:    models.SameMerchant,
+}
+
+// NewChargebacks returns the chargeback service backed by s.
+func NewChargebacks(s *store.Store) *Chargebacks {
+	return NewChargebacksOn(Local(s))
+}
+
+// NewChargebacksOn returns the chargeback service backed by b, such as a
+// replicated store.
+func NewChargebacksOn(b Backend) *Chargebacks {
+	return &Chargebacks{
+		Resource:  NewResourceIn[models.Chargeback, *models.Chargeback](b, chargebackSpec),
+		Charges:   NewResourceIn[models.Charge, *models.Charge](b.Charges(), chargeSpec),
+		Merchants: NewResourceIn[models.Merchant, *models.Merchant](b.Merchants(), merchantSpec),
+		store:     b,
+	}
+}
+
+// CreateWithKey creates c under a server-minted ID, deduplicating on the
+// client's idempotency key instead: a retry with the same key and payload
+// returns the record the first call created, with created false.
+//
+// The key's presence and format are checked by the caller, which knows what
+// to call it in an error (a header, a metadata entry, an argument).
+func (cs *Chargebacks) CreateWithKey(ctx context.Context, key string, c *models.Chargeback) (result *models.Chargeback, created bool, err error) {
+	c.ID = models.NewID()
+	if err := cs.before(ctx, Created, c); err != nil {
+		return nil, false, err
+	}
+	if err := cs.validate(c, nil); err != nil {
+		return nil, false, err
+	}
+
+	result, created, err = cs.store.CreateWithKey(ctx, key, c)
+	if err != nil {
+		return nil, false, err
+	}
+	if created {
+		metrics.Creates.WithLabelValues("created").Inc()
+		cs.committed(ctx, Created, result)
+	} else {
+		metrics.Creates.WithLabelValues("replayed").Inc()
+	}
+	return result, created, nil
+}
+
+// Import creates the records of batch with Create semantics in a single
+// transaction, reporting which were created, skipped or refused; see
+// store.Store.CreateMany. Each record goes through the before hooks and
+// checks of Create first, a record they refuse being reported in Failed
+// with the error Create would have returned, and each record created is
+// committed as Create commits one.
+func (cs *Chargebacks) Import(ctx context.Context, batch []*models.Chargeback) (*store.Imported, error) {
+	failed := map[int]error{}
+	accepted := make([]*models.Chargeback, 0, len(batch))
+	index := make([]int, 0, len(batch)) // the index in batch of each record in accepted
+	for i, c := range batch {
+		err := cs.before(ctx, Created, c)
+		if err == nil {
+			err = cs.validateNew(c)
+		}
+		if err != nil {
+			failed[i] = err
+			continue
+		}
+		accepted, index = append(accepted, c), append(index, i)
+	}
+
+	res := &store.Imported{}
+	if len(accepted) > 0 {
+		var err error
+		if res, err = cs.store.CreateMany(ctx, accepted); err != nil {
+			return nil, err
+		}
+	}
+	for i, err := range res.Failed {
+		failed[index[i]] = err
+	}
+	res.Failed = nil
+	if len(failed) > 0 {
+		res.Failed = failed
+	}
+	for i := range res.Created {
+		metrics.Creates.WithLabelValues("created").Inc()
+		cs.committed(ctx, Created, &res.Created[i])
+	}
+	metrics.Creates.WithLabelValues("replayed").Add(float64(res.Skipped))
+	return res, nil
+}
+
+// DeleteMatching deletes every chargeback matching f and returns how many
+// were deleted, each committed as Delete commits one. At least one filter is
+// required so that a bare call cannot wipe the whole dataset by accident.
+func (cs *Chargebacks) DeleteMatching(ctx context.Context, f store.Filter) (int, error) {
+	if f.IsZero() {
+		return 0, &InvalidError{Reason: "at least one filter (currency, before) is required"}
+	}
+	deleted, err := cs.store.DeleteMatching(ctx, f)
+	if err != nil {
+		return 0, err
+	}
+	for i := range deleted {
+		metrics.Deletes.WithLabelValues("deleted").Inc()
+		cs.committed(ctx, Deleted, &deleted[i])
+	}
+	return len(deleted), nil
+}
+
+// Erase clears the personal data of the chargeback id and returns the proof
+// of the erasure, with created true the first time; repeating it returns the
+// same proof. See store.Store.Erase.
+//
+// The first erasure of an active chargeback is committed as an update of it.
+// An archived one is not: its record is no longer served.
+func (cs *Chargebacks) Erase(ctx context.Context, id string) (*models.Erasure, bool, error) {
+	proof, created, err := cs.store.Erase(ctx, id)
+	if err != nil || !created {
+		return proof, created, err
+	}
+	c, err := cs.store.Get(ctx, id)
+	switch {
+	case err == nil:
+		cs.committed(ctx, Updated, c)
+	case !errors.Is(err, store.ErrNotFound):
+		slog.ErrorContext(ctx, "reading an erased chargeback failed", "id", id, "err", err)
+	}
+	return proof, true, nil
+}
+
+// ExpireKey deletes an idempotency key so that the next request with it is
+// processed anew; see store.Store.ExpireKey.
+func (cs *Chargebacks) ExpireKey(ctx context.Context, op, key string, anyOwner bool) (int, error) {
+	return cs.store.ExpireKey(ctx, op, key, anyOwner)
+}
+
+// CreateRefund refunds r.Amount of the chargeback id, at most once per
+// refund ID: a retry returns the refund the first request created, with
+// created false. See store.Store.CreateRefund.
+func (cs *Chargebacks) CreateRefund(ctx context.Context, id string, r *models.Refund) (*models.Refund, bool, error) {
+	if err := r.Validate(); err != nil {
+		return nil, false, err
+	}
+	return cs.store.CreateRefund(ctx, id, r)
+}
+
+// Refunds returns the refunds of the chargeback id.
+func (cs *Chargebacks) Refunds(ctx context.Context, id string) ([]models.Refund, error) {
+	return cs.store.Refunds(ctx, id)
+}
+
+// Stats summarises the chargebacks of the caller's tenant.
+func (cs *Chargebacks) Stats(ctx context.Context) (*models.Stats, error) {
+	return cs.store.Stats(ctx)
+}
+
+// MerchantStats summarises the chargebacks of the merchant id.
+func (cs *Chargebacks) MerchantStats(ctx context.Context, id string) (*models.Stats, error) {
+	return cs.store.MerchantStats(ctx, id)
+}
+
+// Convert sets stats.Converted to the total of stats.ByCurrency in the
+// currency to, at the exchange rates of Rates. Each currency's sum is
+// converted to the nearest minor unit of to before they are added up.
+func (cs *Chargebacks) Convert(ctx context.Context, stats *models.Stats, to string) error {
+	target, ok := money.Lookup(to)
+	if !ok {
+		return &InvalidError{Reason: fmt.Sprintf("cannot convert to %q: not an ISO 4217 currency code", to)}
+	}
+	if cs.Rates == nil {
+		return ErrNoRates
+	}
+	r, err := cs.Rates.ExchangeRates(ctx)
+	if errors.Is(err, store.ErrNotFound) {
+		return ErrNoRates
+	}
+	if err != nil {
+		return err
+	}
+
+	total := models.ConvertedStats{Currency: to, RatesDate: r.Date, RatesProvider: r.Provider}
+	for _, c := range stats.ByCurrency {
+		rate, ok := r.Rate(c.Currency, to)
+		if !ok {
+			return fmt.Errorf("%w: %s to %s", ErrNoRates, c.Currency, to)
+		}
+		from, _ := money.Lookup(c.Currency)
+		total.Amount += money.Convert(c.Amount, from, target, rate)
+	}
+	total.Derive()
+	stats.Converted = &total
+	return nil
+}
+
+// ForEachOfMerchant calls fn with each chargeback of the merchant id, in
+// order of their IDs.
+func (cs *Chargebacks) ForEachOfMerchant(ctx context.Context, id string, fn func(models.Chargeback) error) error {
+	return cs.store.ForEachOfMerchant(ctx, id, fn)
+}
+
+// Report periods.
+const (
+	Daily  = "day"
+	Weekly = "week"
+)
+
+// Report breaks the chargebacks of the caller's tenant created from from to
+// to, both inclusive, down by day or by ISO week (Monday to Sunday, UTC). A
+// zero from or to leaves that end open. The figures come from totals the
+// store keeps up to date on every write, so a report over years costs no more
+// than one per day and currency in the range.
+func (cs *Chargebacks) Report(ctx context.Context, period string, from, to time.Time) (*models.Report, error) {
+	if period != Daily && period != Weekly {
+		return nil, &InvalidError{Reason: `invalid period: expected "day" or "week"`}
+	}
+	if !from.IsZero() && !to.IsZero() && to.Before(from) {
+		return nil, &InvalidError{Reason: "to is before from"}
+	}
+	days, err := cs.store.DailyTotals(ctx, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &models.Report{Tenant: store.TenantFrom(ctx), Period: period, Periods: days}
+	if !from.IsZero() {
+		r.From = from.UTC().Format(time.DateOnly)
+	}
+	if !to.IsZero() {
+		r.To = to.UTC().Format(time.DateOnly)
+	}
+	if r.Periods == nil {
+		r.Periods = []models.PeriodStats{}
+	}
+	if period == Weekly {
+		r.Periods = byWeek(days)
+	}
+	return r, nil
+}
+
+// byWeek merges daily figures, in order, into weekly ones.
+func byWeek(days []models.PeriodStats) []models.PeriodStats {
+	weeks := []models.PeriodStats{}
+	for _, d := range days {
+		day, err := time.Parse(time.DateOnly, d.Start)
+		if err != nil {
+			continue
+		}
+		// Weekday counts from Sunday; ISO weeks start on Monday.
+		monday := day.AddDate(0, 0, -(int(day.Weekday())+6)%7).Format(time.DateOnly)
+		if len(weeks) == 0 || weeks[len(weeks)-1].Start != monday {
+			weeks = append(weeks, models.PeriodStats{Start: monday, ByCurrency: []models.CurrencyStats{}})
+		}
+		w := &weeks[len(weeks)-1]
+		w.Count += d.Count
+		for _, c := range d.ByCurrency {
+			i, found := slices.BinarySearchFunc(w.ByCurrency, c.Currency, func(e models.CurrencyStats, code string) int {
+				return strings.Compare(e.Currency, code)
+			})
+			if !found {
+				w.ByCurrency = slices.Insert(w.ByCurrency, i, models.CurrencyStats{Currency: c.Currency})
+			}
+			w.ByCurrency[i].Count += c.Count
+			w.ByCurrency[i].Amount += c.Amount
+		}
+	}
+	for i := range weeks {
+		weeks[i].Derive()
+	}
+	return weeks
+}
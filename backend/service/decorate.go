@@ -0,0 +1,225 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/arkantrust/idempotency-example/backend/models"
+	"github.com/arkantrust/idempotency-example/backend/store"
+)
+
+// Policy decides how a Backend made by Decorate runs its operations –
+// retried, guarded by a circuit breaker, mirrored to a second backend – and
+// on which backends. Decorate supplies the operations themselves, each as a
+// call on whatever backend the policy hands it.
+type Policy interface {
+	// Do runs op with call, which makes it on the backend it is given. A
+	// call may be made more than once, and on several backends: it takes
+	// its own copy of anything a backend changes.
+	Do(ctx context.Context, op Op, call func(ctx context.Context, b Backend) (any, error)) (any, error)
+
+	// Walk runs the streamed read op with walk, which walks the backend it
+	// is given, calling the caller's function with each record, and keeps
+	// w up to date with what that function did.
+	Walk(ctx context.Context, op string, walk func(b Backend, w *Walked) error) error
+}
+
+// Op is an operation a Policy runs.
+type Op struct {
+	// Name names it in metrics and logs: "create", "update", …, prefixed
+	// with the kind of record for a charge or merchant ("charge_get").
+	Name string
+
+	// Write tells a write from a read.
+	Write bool
+}
+
+// Walked is what the caller's function did during a streamed read.
+type Walked struct {
+	// Yielded is set once it has been called: walking again would call it
+	// with the same records again.
+	Yielded bool
+
+	// Err is the error it last returned, which stops the walk.
+	Err error
+}
+
+// Decorate returns the Backend running every operation as p says.
+func Decorate(p Policy) Backend {
+	return decorated{decoratedCollection[models.Chargeback]{p: p, pick: func(b Backend) Collection[models.Chargeback] { return b }}}
+}
+
+// do runs call as p runs op.
+func do[R any](ctx context.Context, p Policy, op Op, call func(context.Context, Backend) (R, error)) (R, error) {
+	v, err := p.Do(ctx, op, func(ctx context.Context, b Backend) (any, error) { return call(ctx, b) })
+	r, _ := v.(R)
+	return r, err
+}
+
+// written is the outcome of a write returning a record and whether it
+// changed anything, created or updated it, rather than replaying an earlier
+// write. Its fields are exported for policies comparing outcomes by their
+// JSON.
+type written[T any] struct {
+	Record  *T
+	Changed bool
+}
+
+// write runs call as p runs the write name.
+func write[T any](ctx context.Context, p Policy, name string, call func(context.Context, Backend) (*T, bool, error)) (*T, bool, error) {
+	r, err := do(ctx, p, Op{Name: name, Write: true}, func(ctx context.Context, b Backend) (written[T], error) {
+		r, ok, err := call(ctx, b)
+		return written[T]{r, ok}, err
+	})
+	return r.Record, r.Changed, err
+}
+
+// walk runs the streamed read through, calling fn with each record, as p
+// runs op.
+func walk[T any](ctx context.Context, p Policy, op string, through func(Backend, func(T) error) error, fn func(T) error) error {
+	return p.Walk(ctx, op, func(b Backend, w *Walked) error {
+		return through(b, func(v T) error {
+			w.Yielded = true
+			w.Err = fn(v)
+			return w.Err
+		})
+	})
+}
+
+// decorated is the Backend Decorate returns.
+type decorated struct {
+	decoratedCollection[models.Chargeback]
+}
+
+func (d decorated) CreateWithKey(ctx context.Context, key string, c *models.Chargeback) (*models.Chargeback, bool, error) {
+	return write(ctx, d.p, "create_with_key", func(ctx context.Context, b Backend) (*models.Chargeback, bool, error) {
+		cp := *c
+		return b.CreateWithKey(ctx, key, &cp)
+	})
+}
+
+func (d decorated) CreateMany(ctx context.Context, cs []*models.Chargeback) (*store.Imported, error) {
+	return do(ctx, d.p, Op{Name: "create_many", Write: true}, func(ctx context.Context, b Backend) (*store.Imported, error) {
+		cps := make([]*models.Chargeback, len(cs))
+		for i, c := range cs {
+			cp := *c
+			cps[i] = &cp
+		}
+		return b.CreateMany(ctx, cps)
+	})
+}
+
+func (d decorated) DeleteMatching(ctx context.Context, f store.Filter) ([]models.Chargeback, error) {
+	return do(ctx, d.p, Op{Name: "delete_matching", Write: true}, func(ctx context.Context, b Backend) ([]models.Chargeback, error) {
+		return b.DeleteMatching(ctx, f)
+	})
+}
+
+func (d decorated) Stats(ctx context.Context) (*models.Stats, error) {
+	return do(ctx, d.p, Op{Name: "stats"}, func(ctx context.Context, b Backend) (*models.Stats, error) {
+		return b.Stats(ctx)
+	})
+}
+
+func (d decorated) DailyTotals(ctx context.Context, from, to time.Time) ([]models.PeriodStats, error) {
+	return do(ctx, d.p, Op{Name: "daily_totals"}, func(ctx context.Context, b Backend) ([]models.PeriodStats, error) {
+		return b.DailyTotals(ctx, from, to)
+	})
+}
+
+func (d decorated) Erase(ctx context.Context, id string) (*models.Erasure, bool, error) {
+	return write(ctx, d.p, "erase", func(ctx context.Context, b Backend) (*models.Erasure, bool, error) {
+		return b.Erase(ctx, id)
+	})
+}
+
+func (d decorated) ExpireKey(ctx context.Context, op, key string, anyOwner bool) (int, error) {
+	return do(ctx, d.p, Op{Name: "expire_key", Write: true}, func(ctx context.Context, b Backend) (int, error) {
+		return b.ExpireKey(ctx, op, key, anyOwner)
+	})
+}
+
+func (d decorated) CreateRefund(ctx context.Context, id string, r *models.Refund) (*models.Refund, bool, error) {
+	return write(ctx, d.p, "create_refund", func(ctx context.Context, b Backend) (*models.Refund, bool, error) {
+		cp := *r
+		return b.CreateRefund(ctx, id, &cp)
+	})
+}
+
+func (d decorated) Refunds(ctx context.Context, id string) ([]models.Refund, error) {
+	return do(ctx, d.p, Op{Name: "refunds"}, func(ctx context.Context, b Backend) ([]models.Refund, error) {
+		return b.Refunds(ctx, id)
+	})
+}
+
+func (d decorated) Charges() Collection[models.Charge] {
+	return decoratedCollection[models.Charge]{p: d.p, kind: "charge_", pick: Backend.Charges}
+}
+
+func (d decorated) Merchants() Collection[models.Merchant] {
+	return decoratedCollection[models.Merchant]{p: d.p, kind: "merchant_", pick: Backend.Merchants}
+}
+
+func (d decorated) ForEachOfMerchant(ctx context.Context, id string, fn func(models.Chargeback) error) error {
+	return walk(ctx, d.p, "for_each_of_merchant", func(b Backend, fn func(models.Chargeback) error) error {
+		return b.ForEachOfMerchant(ctx, id, fn)
+	}, fn)
+}
+
+func (d decorated) MerchantStats(ctx context.Context, id string) (*models.Stats, error) {
+	return do(ctx, d.p, Op{Name: "merchant_stats"}, func(ctx context.Context, b Backend) (*models.Stats, error) {
+		return b.MerchantStats(ctx, id)
+	})
+}
+
+// decoratedCollection is the Collection of the records pick chooses from a
+// backend, running every operation as p says. Its operations are named
+// prefixed with kind.
+type decoratedCollection[T any] struct {
+	p    Policy
+	kind string
+	pick func(Backend) Collection[T]
+}
+
+func (c decoratedCollection[T]) List(ctx context.Context) ([]T, error) {
+	return do(ctx, c.p, Op{Name: c.kind + "list"}, func(ctx context.Context, b Backend) ([]T, error) {
+		return c.pick(b).List(ctx)
+	})
+}
+
+func (c decoratedCollection[T]) ForEach(ctx context.Context, fn func(T) error) error {
+	return walk(ctx, c.p, c.kind+"for_each", func(b Backend, fn func(T) error) error {
+		return c.pick(b).ForEach(ctx, fn)
+	}, fn)
+}
+
+func (c decoratedCollection[T]) ForEachCreated(ctx context.Context, after, before time.Time, fn func(T) error) error {
+	return walk(ctx, c.p, c.kind+"for_each_created", func(b Backend, fn func(T) error) error {
+		return c.pick(b).ForEachCreated(ctx, after, before, fn)
+	}, fn)
+}
+
+func (c decoratedCollection[T]) Get(ctx context.Context, id string) (*T, error) {
+	return do(ctx, c.p, Op{Name: c.kind + "get"}, func(ctx context.Context, b Backend) (*T, error) {
+		return c.pick(b).Get(ctx, id)
+	})
+}
+
+func (c decoratedCollection[T]) Create(ctx context.Context, item *T) (*T, bool, error) {
+	return write(ctx, c.p, c.kind+"create", func(ctx context.Context, b Backend) (*T, bool, error) {
+		cp := *item
+		return c.pick(b).Create(ctx, &cp)
+	})
+}
+
+func (c decoratedCollection[T]) UpdateIf(ctx context.Context, id string, apply func(*T), check func(*T) bool) (*T, bool, error) {
+	return write(ctx, c.p, c.kind+"update", func(ctx context.Context, b Backend) (*T, bool, error) {
+		return c.pick(b).UpdateIf(ctx, id, apply, check)
+	})
+}
+
+func (c decoratedCollection[T]) Remove(ctx context.Context, id string, check func(*T) bool) (*T, error) {
+	return do(ctx, c.p, Op{Name: c.kind + "remove", Write: true}, func(ctx context.Context, b Backend) (*T, error) {
+		return c.pick(b).Remove(ctx, id, check)
+	})
+}
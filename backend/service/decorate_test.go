@@ -0,0 +1,67 @@
+package service_test
+
+import (
+	"context"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/arkantrust/idempotency-example/backend/models"
+	"github.com/arkantrust/idempotency-example/backend/service"
+	"github.com/arkantrust/idempotency-example/backend/store"
+)
+
+// logged is a Policy running every operation on b, logging its name.
+type logged struct {
+	b   service.Backend
+	ops []string
+}
+
+func (l *logged) Do(ctx context.Context, op service.Op, call func(context.Context, service.Backend) (any, error)) (any, error) {
+	name := op.Name
+	if op.Write {
+		name += "!"
+	}
+	l.ops = append(l.ops, name)
+	return call(ctx, l.b)
+}
+
+func (l *logged) Walk(ctx context.Context, op string, walk func(service.Backend, *service.Walked) error) error {
+	l.ops = append(l.ops, op)
+	return walk(l.b, &service.Walked{})
+}
+
+func TestDecorate(t *testing.T) {
+	s, err := store.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	p := &logged{b: service.Local(s)}
+	b := service.Decorate(p)
+	ctx := context.Background()
+
+	c := &models.Chargeback{ID: "cb-1", Amount: 100, Currency: "USD", Reason: "fraud"}
+	got, created, err := b.Create(ctx, c)
+	if err != nil || !created || got.Version != 1 || c.Version != 0 {
+		t.Fatalf("create: %+v, %v, %v; want it created from a copy of c", got, created, err)
+	}
+	if _, err := b.Get(ctx, "cb-1"); err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	if err := b.ForEach(ctx, func(models.Chargeback) error { n++; return nil }); err != nil || n != 1 {
+		t.Fatalf("for each: %d records, %v", n, err)
+	}
+	if _, err := b.Charges().Get(ctx, "ch-1"); err == nil {
+		t.Fatal("expected no charge ch-1")
+	}
+	if _, err := b.DeleteMatching(ctx, store.Filter{Currency: "USD"}); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"create!", "get", "for_each", "charge_get", "delete_matching!"}
+	if !slices.Equal(p.ops, want) {
+		t.Fatalf("ops = %v, want %v", p.ops, want)
+	}
+}
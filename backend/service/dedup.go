@@ -0,0 +1,137 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/arkantrust/idempotency-example/backend/store"
+)
+
+// Dedup deduplicates whole calls by idempotency key: the response to the
+// first successful call with a key is saved, together with a fingerprint of
+// the request, and retries get it back without the call running again. The
+// gRPC interceptor and the GraphQL mutations use it, and so does the REST API
+// in strict idempotency mode; otherwise the REST API has no need to, as its
+// responses are the stored records themselves.
+//
+// Keys are scoped like every other store operation, by the tenant and owner
+// in the context, and by the operation they are sent to: a key used for one
+// gRPC method or GraphQL mutation is a fresh key for every other.
+type Dedup struct {
+	store *store.Store
+
+	// mu guards locks, which serialises concurrent calls with the same
+	// scoped key so that two in-flight retries cannot both miss the saved
+	// response and run twice. Entries are removed when their last holder
+	// leaves, so the map only holds keys in flight.
+	mu    sync.Mutex
+	locks map[string]*keyLock
+}
+
+type keyLock struct {
+	sync.Mutex
+	refs int
+}
+
+// NewDedup returns a Dedup saving responses in s.
+func NewDedup(s *store.Store) *Dedup {
+	return &Dedup{store: s, locks: map[string]*keyLock{}}
+}
+
+// ErrInFlight is returned by TryDo when a call with the same key is still
+// running.
+var ErrInFlight = errors.New("a request with this idempotency key is still being processed")
+
+// Fingerprint identifies a request by the operation it calls and its
+// encoded arguments, which must be encoded deterministically.
+func Fingerprint(op string, args []byte) string {
+	sum := sha256.Sum256(append([]byte(op+"\x00"), args...))
+	return hex.EncodeToString(sum[:])
+}
+
+// Do returns the response saved under key for the operation op, with
+// replayed true, if there is one; run is not called. Otherwise it calls run
+// and saves the response it returns, unless run fails: failed calls are not
+// saved, so a retry after an error runs again.
+//
+// A response saved for another fingerprint means the key was reused for a
+// different request, and Do returns store.ErrKeyReused: replaying would hide
+// that the second request was never applied.
+func (d *Dedup) Do(ctx context.Context, op, key, fingerprint string, run func() (*store.Response, error)) (resp *store.Response, replayed bool, err error) {
+	return d.do(ctx, op, key, fingerprint, true, run)
+}
+
+// TryDo is Do for callers that would rather fail than wait: if a call with
+// the same key is in flight it returns ErrInFlight at once, and the client
+// retries once that call has finished.
+func (d *Dedup) TryDo(ctx context.Context, op, key, fingerprint string, run func() (*store.Response, error)) (resp *store.Response, replayed bool, err error) {
+	return d.do(ctx, op, key, fingerprint, false, run)
+}
+
+func (d *Dedup) do(ctx context.Context, op, key, fingerprint string, wait bool, run func() (*store.Response, error)) (*store.Response, bool, error) {
+	unlock, ok := d.lock(store.TenantFrom(ctx)+"\x00"+store.OwnerFrom(ctx)+"\x00"+op+"\x00"+key, wait)
+	if !ok {
+		return nil, false, ErrInFlight
+	}
+	defer unlock()
+
+	saved, err := d.store.LoadResponse(ctx, op, key)
+	switch {
+	case err == nil:
+		if saved.Fingerprint != fingerprint {
+			return nil, false, store.ErrKeyReused
+		}
+		return saved, true, nil
+	case !errors.Is(err, store.ErrNotFound):
+		return nil, false, err
+	}
+
+	resp, err := run()
+	if err != nil {
+		return nil, false, err
+	}
+	resp.Fingerprint = fingerprint
+	resp.CreatedAt = time.Now().UTC()
+	if _, err := d.store.SaveResponse(ctx, op, key, resp); err != nil {
+		// The call itself succeeded; failing it now would invite a retry
+		// that repeats the work. Log and return the response unsaved.
+		slog.ErrorContext(ctx, "failed to save response", "err", err)
+	}
+	return resp, false, nil
+}
+
+// lock acquires the mutex for key and returns its release function. Unless
+// wait is set it gives up, returning false, if the mutex is held.
+func (d *Dedup) lock(key string, wait bool) (func(), bool) {
+	d.mu.Lock()
+	l := d.locks[key]
+	if l == nil {
+		l = &keyLock{}
+		d.locks[key] = l
+	}
+	l.refs++
+	d.mu.Unlock()
+
+	release := func() {
+		d.mu.Lock()
+		if l.refs--; l.refs == 0 {
+			delete(d.locks, key)
+		}
+		d.mu.Unlock()
+	}
+	if wait {
+		l.Lock()
+	} else if !l.TryLock() {
+		release()
+		return nil, false
+	}
+	return func() {
+		l.Unlock()
+		release()
+	}, true
+}
@@ -0,0 +1,44 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/arkantrust/idempotency-example/backend/service"
+	"github.com/arkantrust/idempotency-example/backend/store"
+)
+
+func TestTryDoRefusesKeysInFlight(t *testing.T) {
+	s, err := store.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	d := service.NewDedup(s)
+	ctx := context.Background()
+
+	runs := 0
+	run := func() (*store.Response, error) {
+		runs++
+		return &store.Response{Type: "test", Body: []byte("ok")}, nil
+	}
+	_, _, err = d.TryDo(ctx, "op", "k", "fp", func() (*store.Response, error) {
+		// A retry arriving while the first call runs is refused, not queued.
+		if _, _, err := d.TryDo(ctx, "op", "k", "fp", run); !errors.Is(err, service.ErrInFlight) {
+			t.Errorf("expected ErrInFlight, got %v", err)
+		}
+		// Other keys and operations are unaffected.
+		if _, _, err := d.TryDo(ctx, "other", "k", "fp", run); err != nil {
+			t.Errorf("expected another operation to run, got %v", err)
+		}
+		return run()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp, replayed, err := d.TryDo(ctx, "op", "k", "fp", run); err != nil || !replayed || string(resp.Body) != "ok" || runs != 2 {
+		t.Fatalf("expected a replay once the first call finished, got %v %v runs=%d", replayed, err, runs)
+	}
+}
@@ -0,0 +1,123 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+)
+
+// Write actions, as hooks are told them.
+const (
+	Created = "created"
+	Updated = "updated"
+	Deleted = "deleted"
+)
+
+// BeforeHook runs before a create or update is validated, with the record
+// as the client sent it: action is Created or Updated, and each record of an
+// import is a create. It may change the record – to normalise or enrich it –
+// and may refuse the write by returning an error, which the caller gets as
+// is (an import, as the error of that record); return a
+// *models.ValidationError or an *InvalidError to have it reported as invalid
+// input. A hook changing the record must change a retry the same way, or
+// the retry would no longer match the write it repeats.
+type BeforeHook[T any] func(ctx context.Context, action string, item *T) error
+
+// AfterHook runs after a write is committed, with the record as stored (as
+// it was, for a delete). Each record an import creates or a bulk delete
+// removes is a write of its own, and an erasure is an update; archival is
+// not a write. It runs only for writes that wrote something – never for
+// replays, skipped updates or deletes of missing records – and at most once
+// per write. The write has happened whatever it returns; an error is logged.
+type AfterHook[T any] func(ctx context.Context, action string, item *T) error
+
+// hooks are the hooks of a Resource, run in the order they were added.
+type hooks[T any] struct {
+	before []BeforeHook[T]
+	after  []AfterHook[T]
+}
+
+// Before adds h to the hooks run before every create and update. Hooks
+// must be added before the resource is used.
+func (r *Resource[T, PT]) Before(h BeforeHook[T]) {
+	r.hooks.before = append(r.hooks.before, h)
+}
+
+// After adds h to the hooks run after every committed write. Hooks must be
+// added before the resource is used.
+func (r *Resource[T, PT]) After(h AfterHook[T]) {
+	r.hooks.after = append(r.hooks.after, h)
+}
+
+// before runs the before hooks on item, stopping at the first error.
+func (r *Resource[T, PT]) before(ctx context.Context, action string, item *T) error {
+	for _, h := range r.hooks.before {
+		if err := h(ctx, action, item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// committed tells the after hooks and r.Events that item was written, as
+// action says.
+func (r *Resource[T, PT]) committed(ctx context.Context, action string, item *T) {
+	for _, h := range r.hooks.after {
+		if err := h(ctx, action, item); err != nil {
+			slog.ErrorContext(ctx, "an after-write hook failed", "action", r.spec.Kind+"."+action, "id", PT(item).RecordID(), "err", err)
+		}
+	}
+	r.publish(ctx, action, item)
+}
+
+// Plugin extends the chargeback service, typically by adding hooks to its
+// resources. Plugins compiled into the binary register themselves with
+// RegisterPlugin from an init function, and run when enabled by name.
+type Plugin func(cs *Chargebacks) error
+
+var (
+	pluginsMu sync.Mutex
+	plugins   = map[string]Plugin{}
+)
+
+// RegisterPlugin makes p available under name. It panics if name is
+// already taken, like registering a database/sql driver twice.
+func RegisterPlugin(name string, p Plugin) {
+	pluginsMu.Lock()
+	defer pluginsMu.Unlock()
+	if _, dup := plugins[name]; dup {
+		panic("service: plugin " + name + " registered twice")
+	}
+	plugins[name] = p
+}
+
+// Plugins returns the names of the registered plugins, sorted.
+func Plugins() []string {
+	pluginsMu.Lock()
+	defer pluginsMu.Unlock()
+	names := make([]string, 0, len(plugins))
+	for name := range plugins {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// EnablePlugins runs the plugins names on cs, in order. It must be called
+// before cs is used.
+func (cs *Chargebacks) EnablePlugins(names ...string) error {
+	for _, name := range names {
+		pluginsMu.Lock()
+		p, ok := plugins[name]
+		pluginsMu.Unlock()
+		if !ok {
+			return fmt.Errorf("unknown plugin %q; registered: %v", name, Plugins())
+		}
+		if err := p(cs); err != nil {
+			return fmt.Errorf("plugin %s: %w", name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/arkantrust/idempotency-example/backend/models"
+	"github.com/arkantrust/idempotency-example/backend/service"
+	"github.com/arkantrust/idempotency-example/backend/store"
+)
+
+func TestHooks(t *testing.T) {
+	s, err := store.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	svc := service.NewChargebacks(s)
+	ctx := context.Background()
+
+	// The before hook runs ahead of validation: it can fix up a record
+	// validation would refuse, or refuse one validation would accept.
+	svc.Before(func(ctx context.Context, action string, c *models.Chargeback) error {
+		if c.Reason == "test" {
+			return &models.ValidationError{Fields: []models.FieldError{{Field: "reason", Message: "no tests in production"}}}
+		}
+		c.Currency = strings.ToUpper(c.Currency)
+		return nil
+	})
+	var after []string
+	svc.After(func(ctx context.Context, action string, c *models.Chargeback) error {
+		after = append(after, action+" "+c.ID)
+		return errors.New("failures are logged, not returned")
+	})
+
+	for range 2 {
+		c := models.Chargeback{ID: "cb-1", Amount: 100, Currency: "usd", Reason: "fraud"}
+		if _, _, err := svc.Create(ctx, &c); err != nil {
+			t.Fatalf("create: %v", err)
+		}
+	}
+	var ve *models.ValidationError
+	if _, _, err := svc.Create(ctx, &models.Chargeback{ID: "cb-2", Amount: 100, Currency: "USD", Reason: "test"}); !errors.As(err, &ve) {
+		t.Fatalf("expected the hook to refuse the create, got %v", err)
+	}
+	for range 2 {
+		if _, _, err := svc.Update(ctx, "cb-1", &models.Chargeback{Amount: 200, Currency: "usd", Reason: "fraud"}, nil); err != nil {
+			t.Fatalf("update: %v", err)
+		}
+	}
+	for range 2 {
+		if _, err := svc.Delete(ctx, "cb-1"); err != nil {
+			t.Fatalf("delete: %v", err)
+		}
+	}
+
+	// Replays, skipped updates and deletes of missing records wrote
+	// nothing, and the refused create never got that far.
+	want := []string{"created cb-1", "updated cb-1", "deleted cb-1"}
+	if strings.Join(after, ", ") != strings.Join(want, ", ") {
+		t.Fatalf("after hooks ran for %v, want %v", after, want)
+	}
+}
+
+func TestHooksSeeBulkWrites(t *testing.T) {
+	s, err := store.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	svc := service.NewChargebacks(s)
+	ctx := context.Background()
+
+	svc.Before(func(ctx context.Context, action string, c *models.Chargeback) error {
+		if c.Reason == "test" {
+			return &models.ValidationError{Fields: []models.FieldError{{Field: "reason", Message: "no tests in production"}}}
+		}
+		c.Currency = strings.ToUpper(c.Currency)
+		return nil
+	})
+	var after []string
+	svc.After(func(ctx context.Context, action string, c *models.Chargeback) error {
+		after = append(after, action+" "+c.ID)
+		return nil
+	})
+
+	// Each imported record goes through the before hook, then validation:
+	// the hook fixes up cb-1, refuses cb-2, and cb-3 is still invalid.
+	res, err := svc.Import(ctx, []*models.Chargeback{
+		{ID: "cb-1", Amount: 100, Currency: "usd", Reason: "fraud"},
+		{ID: "cb-2", Amount: 100, Currency: "USD", Reason: "test"},
+		{ID: "cb-3", Amount: -1, Currency: "USD", Reason: "fraud"},
+		{ID: "cb-4", Amount: 100, Currency: "USD", Reason: "fraud", MerchantID: "nope"},
+	})
+	var ve *models.ValidationError
+	if err != nil || len(res.Created) != 1 || res.Created[0].Currency != "USD" || len(res.Failed) != 3 ||
+		!errors.As(res.Failed[1], &ve) || ve.Fields[0].Field != "reason" || !errors.As(res.Failed[2], &ve) || res.Failed[3] == nil {
+		t.Fatalf("import: %+v, %v", res, err)
+	}
+	if _, err := svc.DeleteMatching(ctx, store.Filter{Currency: "USD"}); err != nil {
+		t.Fatalf("delete matching: %v", err)
+	}
+
+	want := []string{"created cb-1", "deleted cb-1"}
+	if strings.Join(after, ", ") != strings.Join(want, ", ") {
+		t.Fatalf("after hooks ran for %v, want %v", after, want)
+	}
+}
+
+func TestEnablePlugins(t *testing.T) {
+	var enabled []string
+	service.RegisterPlugin("test-plugin", func(cs *service.Chargebacks) error {
+		enabled = append(enabled, "test-plugin")
+		return nil
+	})
+	s, err := store.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	svc := service.NewChargebacks(s)
+
+	if err := svc.EnablePlugins("test-plugin"); err != nil || len(enabled) != 1 {
+		t.Fatalf("expected the plugin enabled, got %v", err)
+	}
+	if err := svc.EnablePlugins("no-such-plugin"); err == nil {
+		t.Fatal("expected an error for an unknown plugin")
+	}
+}
@@ -0,0 +1,61 @@
+package service
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// Idempotency key formats accepted by NewKeyFormat.
+const (
+	KeyFormatAny  = "any"
+	KeyFormatUUID = "uuid"
+	KeyFormatULID = "ulid"
+)
+
+var (
+	uuidV4Pattern = regexp.MustCompile(`^(?i)[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	ulidPattern   = regexp.MustCompile(`^(?i)[0-7][0-9a-hjkmnp-tv-z]{25}$`)
+)
+
+// KeyFormat checks that a client-generated idempotency key is strong enough.
+//
+// Client-generated keys only deduplicate retries if two different operations
+// never share a key. Keys like "1" or "order" collide across clients and
+// across time, turning a new request into a "replay" of an unrelated one, so
+// operators can require keys drawn from a large random space.
+type KeyFormat struct {
+	pattern *regexp.Regexp
+	desc    string
+}
+
+// NewKeyFormat returns the key format named by format ("any", "uuid" or
+// "ulid"). A non-empty pattern is a regular expression that overrides format.
+func NewKeyFormat(format, pattern string) (*KeyFormat, error) {
+	if pattern != "" {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid key pattern: %w", err)
+		}
+		return &KeyFormat{pattern: re, desc: "must match " + pattern}, nil
+	}
+
+	switch format {
+	case "", KeyFormatAny:
+		return &KeyFormat{}, nil
+	case KeyFormatUUID:
+		return &KeyFormat{pattern: uuidV4Pattern, desc: "must be a UUIDv4"}, nil
+	case KeyFormatULID:
+		return &KeyFormat{pattern: ulidPattern, desc: "must be a ULID"}, nil
+	default:
+		return nil, fmt.Errorf("unknown key format %q", format)
+	}
+}
+
+// Check returns a description of the required format if key does not match,
+// or "" if it does. A nil KeyFormat accepts every key.
+func (f *KeyFormat) Check(key string) string {
+	if f == nil || f.pattern == nil || f.pattern.MatchString(key) {
+		return ""
+	}
+	return f.desc
+}
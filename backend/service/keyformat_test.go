@@ -0,0 +1,35 @@
+package service_test
+
+import (
+	"testing"
+
+	"github.com/arkantrust/idempotency-example/backend/service"
+)
+
+func TestKeyFormat(t *testing.T) {
+	cases := []struct {
+		format, pattern, key string
+		ok                   bool
+	}{
+		{"any", "", "1", true},
+		{"uuid", "", "1", false},
+		{"uuid", "", "0b7e4f7a-3c1d-4e2b-9a6f-5d8c7b6a5e4f", true},
+		{"uuid", "", "0b7e4f7a-3c1d-1e2b-9a6f-5d8c7b6a5e4f", false}, // version 1
+		{"ulid", "", "01ARZ3NDEKTSV4RRFFQ69G5FAV", true},
+		{"ulid", "", "01ARZ3NDEKTSV4RRFFQ69G5FAU", false}, // U is not Crockford base32
+		{"uuid", `^ord_[a-z0-9]{16}$`, "ord_0123456789abcdef", true},
+	}
+	for _, tc := range cases {
+		f, err := service.NewKeyFormat(tc.format, tc.pattern)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got := f.Check(tc.key) == ""; got != tc.ok {
+			t.Fatalf("%s/%q: Check(%q) ok=%v, want %v", tc.format, tc.pattern, tc.key, got, tc.ok)
+		}
+	}
+
+	if _, err := service.NewKeyFormat("sha", ""); err == nil {
+		t.Fatal("expected error for unknown format")
+	}
+}
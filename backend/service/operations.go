@@ -0,0 +1,273 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/arkantrust/idempotency-example/backend/models"
+	"github.com/arkantrust/idempotency-example/backend/store"
+)
+
+// Operations creates chargebacks asynchronously: Start records the create as
+// a pending models.Operation and returns at once, and a pool of workers
+// started by Run performs it with CreateWithKey and records the outcome.
+//
+// Both steps are idempotent on the client's key. Starting again with the same
+// key returns the operation the first call started, however far it has got,
+// and a worker repeating a create – after a crash, say – replays the record
+// the first attempt made. Pending operations are resumed when Run starts.
+//
+// Operations are stored in the local store, like the responses Dedup saves:
+// with Raft, a client starts them on the leader and polls the same instance.
+// While writes are refused an operation stays pending, and is resumed by the
+// rescan that runs every minute.
+type Operations struct {
+	svc   *Chargebacks
+	store *store.Store
+
+	// Workers is the number of creates run concurrently; zero means one.
+	Workers int
+
+	// MaxAttempts bounds the tries of a create failing with a transient
+	// error, RetryDelay being the wait before the first retry, doubled for
+	// each one after; zero means DefaultMaxAttempts and
+	// DefaultRetryDelay. Invalid requests and reused keys fail at once.
+	MaxAttempts int
+	RetryDelay  time.Duration
+
+	queue chan store.PendingOperation
+
+	// mu guards queued, the IDs of operations in the queue or being run,
+	// so that a rescan does not queue them twice.
+	mu     sync.Mutex
+	queued map[string]bool
+}
+
+// Defaults of Operations.MaxAttempts and Operations.RetryDelay.
+const (
+	DefaultMaxAttempts = 5
+	DefaultRetryDelay  = 100 * time.Millisecond
+)
+
+const (
+	// operationQueueSize bounds the operations waiting for a worker.
+	// Operations started while it is full stay pending until the next
+	// rescan.
+	operationQueueSize = 1024
+
+	// rescanInterval is how often Run looks for pending operations the
+	// queue had no room for.
+	rescanInterval = time.Minute
+)
+
+// NewOperations returns the asynchronous creates of svc, recorded in s.
+func NewOperations(svc *Chargebacks, s *store.Store) *Operations {
+	return &Operations{
+		svc:    svc,
+		store:  s,
+		queue:  make(chan store.PendingOperation, operationQueueSize),
+		queued: map[string]bool{},
+	}
+}
+
+// Start validates c and starts creating it under a server-minted ID,
+// deduplicated on key like CreateWithKey. It returns the operation, with
+// created false when key had already started it; store.ErrKeyReused when
+// key started another create.
+func (o *Operations) Start(ctx context.Context, key string, c *models.Chargeback) (op *models.Operation, created bool, err error) {
+	c.ID = models.NewID()
+	if err := o.svc.validate(c, nil); err != nil {
+		return nil, false, err
+	}
+	c.ID = ""
+	args, err := json.Marshal([]any{c.Amount, c.Currency, c.Reason})
+	if err != nil {
+		return nil, false, err
+	}
+
+	op, created, err = o.store.StartOperation(ctx, key, Fingerprint("chargebacks.create", args), c)
+	if err != nil || !created {
+		return op, created, err
+	}
+	o.enqueue(store.PendingOperation{
+		ID:      op.ID,
+		Tenant:  store.TenantFrom(ctx),
+		Owner:   store.OwnerFrom(ctx),
+		Key:     key,
+		Request: *c,
+	})
+	return op, true, nil
+}
+
+// Get returns the operation id with the chargeback it created, if it has
+// succeeded and the chargeback still exists.
+func (o *Operations) Get(ctx context.Context, id string) (*models.Operation, error) {
+	op, err := o.store.Operation(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if op.Status == models.OperationSucceeded {
+		result, err := o.svc.Get(ctx, op.ChargebackID)
+		switch {
+		case err == nil:
+			op.Result = result
+		case !errors.Is(err, store.ErrNotFound):
+			return nil, err
+		}
+	}
+	return op, nil
+}
+
+// Run runs operations until ctx is cancelled, starting with those left
+// pending by an earlier process.
+func (o *Operations) Run(ctx context.Context) {
+	workers := max(o.Workers, 1)
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case p := <-o.queue:
+					o.run(ctx, p)
+				}
+			}
+		}()
+	}
+
+	t := time.NewTicker(rescanInterval)
+	defer t.Stop()
+	for {
+		o.rescan(ctx)
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// rescan queues the stored pending operations not queued already.
+func (o *Operations) rescan(ctx context.Context) {
+	pending, err := o.store.PendingOperations(ctx)
+	if err != nil {
+		slog.Error("listing pending operations failed", "err", err)
+		return
+	}
+	for _, p := range pending {
+		o.enqueue(p)
+	}
+}
+
+// enqueue hands p to the workers unless it is queued already or the queue is
+// full, in which case the next rescan finds it.
+func (o *Operations) enqueue(p store.PendingOperation) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.queued[p.ID] {
+		return
+	}
+	select {
+	case o.queue <- p:
+		o.queued[p.ID] = true
+	default:
+		slog.Warn("operation queue full; the operation waits for the next rescan", "operation", p.ID)
+	}
+}
+
+// run creates the chargeback of p, retrying transient failures, and records
+// the outcome.
+func (o *Operations) run(ctx context.Context, p store.PendingOperation) {
+	defer func() {
+		o.mu.Lock()
+		delete(o.queued, p.ID)
+		o.mu.Unlock()
+	}()
+	ctx = store.WithOwner(store.WithTenant(ctx, p.Tenant), p.Owner)
+
+	attempts := o.MaxAttempts
+	if attempts <= 0 {
+		attempts = DefaultMaxAttempts
+	}
+	delay := o.RetryDelay
+	if delay <= 0 {
+		delay = DefaultRetryDelay
+	}
+
+	var (
+		result *models.Chargeback
+		err    error
+		tried  int
+	)
+	for tried < attempts {
+		if tried > 0 {
+			select {
+			case <-ctx.Done():
+				// Left pending, to be resumed by the next process.
+				return
+			case <-time.After(delay):
+			}
+			delay *= 2
+		}
+		tried++
+		c := p.Request
+		result, _, err = o.svc.CreateWithKey(ctx, p.Key, &c)
+		if err == nil || permanent(err) {
+			break
+		}
+		slog.WarnContext(ctx, "asynchronous create failed", "operation", p.ID, "attempt", tried, "err", err)
+	}
+	if errors.Is(err, store.ErrReadOnly) {
+		// Writes are off for now; the operation stays pending and a
+		// rescan resumes it.
+		return
+	}
+
+	record := func(op *models.Operation) {
+		op.Attempts += tried
+		if err != nil {
+			op.Status, op.Error = models.OperationFailed, failure(err)
+			return
+		}
+		op.Status, op.ChargebackID = models.OperationSucceeded, result.ID
+	}
+	if err := o.store.UpdateOperation(ctx, p.ID, record); err != nil {
+		// The create is idempotent on the key: resuming the operation
+		// replays it and records the outcome then.
+		slog.ErrorContext(ctx, "recording the outcome of an operation failed", "operation", p.ID, "err", err)
+	}
+}
+
+// permanent reports whether a failed create would fail again however often
+// it was retried.
+func permanent(err error) bool {
+	var (
+		invalid *InvalidError
+		fields  *models.ValidationError
+		policy  *models.PolicyError
+	)
+	return errors.As(err, &invalid) || errors.As(err, &fields) || errors.As(err, &policy) ||
+		errors.Is(err, store.ErrKeyReused) || errors.Is(err, store.ErrNotFound)
+}
+
+// failure describes err to the client polling the operation. Internal errors
+// are not spelled out.
+func failure(err error) string {
+	switch {
+	case errors.Is(err, store.ErrKeyReused):
+		return "idempotency key was already used with a different payload"
+	case errors.Is(err, store.ErrNotFound):
+		return "the chargeback created with this idempotency key has been deleted"
+	case permanent(err):
+		return err.Error()
+	}
+	return "the chargeback could not be created; retry with a new idempotency key"
+}
@@ -0,0 +1,51 @@
+package service_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/arkantrust/idempotency-example/backend/models"
+	"github.com/arkantrust/idempotency-example/backend/service"
+	"github.com/arkantrust/idempotency-example/backend/store"
+)
+
+func TestOperationsResumeAfterRestart(t *testing.T) {
+	s, err := store.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	svc := service.NewChargebacks(s)
+	ctx := store.WithTenant(context.Background(), "acme")
+
+	// The process that accepted the operation stops before running it.
+	op, created, err := service.NewOperations(svc, s).Start(ctx, "k-1", &models.Chargeback{Amount: 100, Currency: "USD", Reason: "fraud"})
+	if err != nil || !created || op.Status != models.OperationPending {
+		t.Fatalf("expected a pending operation, got %+v %v %v", op, created, err)
+	}
+
+	ops := service.NewOperations(svc, s)
+	runCtx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go ops.Run(runCtx)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !op.Done() {
+		if time.Now().After(deadline) {
+			t.Fatal("the operation was not resumed")
+		}
+		time.Sleep(10 * time.Millisecond)
+		if op, err = ops.Get(ctx, op.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if op.Status != models.OperationSucceeded || op.Result == nil || op.Attempts != 1 {
+		t.Fatalf("expected the resumed operation to succeed, got %+v", op)
+	}
+	// The key still deduplicates the create the operation made.
+	if got, created, err := svc.CreateWithKey(ctx, "k-1", &models.Chargeback{Amount: 100, Currency: "USD", Reason: "fraud"}); err != nil || created || got.ID != op.ChargebackID {
+		t.Fatalf("expected a replay of %s, got %+v %v %v", op.ChargebackID, got, created, err)
+	}
+}
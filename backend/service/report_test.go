@@ -0,0 +1,57 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/arkantrust/idempotency-example/backend/models"
+	"github.com/arkantrust/idempotency-example/backend/service"
+	"github.com/arkantrust/idempotency-example/backend/store"
+)
+
+func TestWeeklyReport(t *testing.T) {
+	s, err := store.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	svc := service.NewChargebacks(s)
+
+	// Sunday 1 March 2026 ends one ISO week; Monday 2 and Sunday 8 March
+	// make up the next.
+	for i, c := range []struct {
+		day      int
+		currency string
+	}{{1, "USD"}, {2, "USD"}, {8, "EUR"}} {
+		ctx := store.WithTime(context.Background(), time.Date(2026, 3, c.day, 12, 0, 0, 0, time.UTC))
+		cb := &models.Chargeback{ID: string(rune('a' + i)), Amount: 100, Currency: c.currency, Reason: "fraud"}
+		if _, _, err := svc.Create(ctx, cb); err != nil {
+			t.Fatalf("create: %v", err)
+		}
+	}
+
+	r, err := svc.Report(context.Background(), service.Weekly, time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatalf("report: %v", err)
+	}
+	want := []models.PeriodStats{
+		{Start: "2026-02-23", Count: 1, ByCurrency: []models.CurrencyStats{{Currency: "USD", Count: 1, Amount: 100, DisplayAmount: "1.00"}}},
+		{Start: "2026-03-02", Count: 2, ByCurrency: []models.CurrencyStats{
+			{Currency: "EUR", Count: 1, Amount: 100, DisplayAmount: "1.00"},
+			{Currency: "USD", Count: 1, Amount: 100, DisplayAmount: "1.00"},
+		}},
+	}
+	if !reflect.DeepEqual(r.Periods, want) {
+		t.Fatalf("got %+v\nwant %+v", r.Periods, want)
+	}
+
+	_, err = svc.Report(context.Background(), "month", time.Time{}, time.Time{})
+	var invalid *service.InvalidError
+	if !errors.As(err, &invalid) {
+		t.Fatalf("expected an InvalidError for an unknown period, got %v", err)
+	}
+}
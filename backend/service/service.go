@@ -0,0 +1,321 @@
+// Package service implements the idempotent operations of the API once, for
+// every transport.
+//
+// The HTTP handlers and the gRPC server differ only in how they decode a
+// request, report an outcome and map errors to status codes. Everything else –
+// key formats, validation, which store call makes an operation idempotent and
+// the metrics counting its outcome – lives here, so the two transports cannot
+// drift apart.
+//
+// Errors are the store's sentinels (store.ErrNotFound, store.ErrKeyConflict,
+// store.ErrKeyReused), a *models.ValidationError for invalid fields, or an
+// *InvalidError for input rejected as a whole. Anything else is internal.
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/arkantrust/idempotency-example/backend/models"
+	"github.com/arkantrust/idempotency-example/backend/store"
+)
+
+// InvalidError is input rejected as a whole rather than field by field;
+// transports report it as a bad request with the error's text.
+type InvalidError struct {
+	Reason string
+}
+
+func (e *InvalidError) Error() string { return e.Reason }
+
+// Spec describes a model to serve as a resource. Registering a spec with
+// NewResource is all it takes to get idempotent create, update and delete;
+// chargebacks are served this way.
+type Spec[T any] struct {
+	// Name is the plural resource name and bucket name, e.g. "chargebacks".
+	Name string
+
+	// Kind names a single record in messages and traces, e.g. "chargeback".
+	Kind string
+
+	// Validate checks a decoded record, returning nil or a
+	// *models.ValidationError. Other errors are returned as an
+	// *InvalidError.
+	Validate func(*T) error
+
+	// Equal decides write-avoidance on update: when the merged record is
+	// equal to the stored one, nothing is written.
+	Equal func(a, b *T) bool
+
+	// Fields lists the updatable fields and Merge copies the fields selected
+	// by a mask from src into dst. An update replaces every field in Fields
+	// unless the client sends a mask.
+	Fields []string
+	Merge  func(mask models.FieldMask, dst, src *T)
+
+	// Creates, Updates and Deletes, when set, count outcomes by label.
+	Creates, Updates, Deletes *prometheus.CounterVec
+}
+
+// Resource implements the operations every resource has:
+//
+//   - Create is idempotent on the record ID: a retry returns the stored
+//     record instead of creating another.
+//   - Update skips the write when the merged record equals the stored one.
+//   - Delete succeeds whether or not the record existed.
+type Resource[T any, PT store.RecordPtr[T]] struct {
+	spec  Spec[T]
+	store Collection[T]
+
+	// KeyFormat, when set, restricts the IDs accepted by Create. Existing
+	// records are still reachable by any ID.
+	KeyFormat *KeyFormat
+
+	// Events, when set, is told of every create, update and delete that
+	// wrote something; replays, skipped updates and deletes of missing
+	// records are not events.
+	Events Publisher
+
+	// hooks extend the writes; see Before and After.
+	hooks hooks[T]
+}
+
+// Publisher announces the changes a Resource makes. A change is published
+// after it is committed; a failure to publish it is logged, and does not
+// fail the change.
+type Publisher interface {
+	Publish(ctx context.Context, e models.Event) error
+}
+
+// Collection is where a Resource keeps its records. *store.Collection is
+// one; a replicated store provides another with the same semantics.
+type Collection[T any] interface {
+	List(ctx context.Context) ([]T, error)
+	ForEach(ctx context.Context, fn func(T) error) error
+	ForEachCreated(ctx context.Context, after, before time.Time, fn func(T) error) error
+	Get(ctx context.Context, id string) (*T, error)
+	Create(ctx context.Context, item *T) (*T, bool, error)
+	UpdateIf(ctx context.Context, id string, apply func(*T), check func(*T) bool) (*T, bool, error)
+	Remove(ctx context.Context, id string, check func(*T) bool) (*T, error)
+}
+
+// NewResource returns the resource described by spec, storing its records
+// in s in a bucket named after the resource.
+func NewResource[T any, PT store.RecordPtr[T]](s *store.Store, spec Spec[T]) *Resource[T, PT] {
+	return NewResourceIn[T, PT](store.NewCollection[T, PT](s, spec.Name, spec.Kind, spec.Equal), spec)
+}
+
+// NewResourceIn returns the resource described by spec, storing its records
+// in c.
+func NewResourceIn[T any, PT store.RecordPtr[T]](c Collection[T], spec Spec[T]) *Resource[T, PT] {
+	return &Resource[T, PT]{spec: spec, store: c}
+}
+
+// Spec returns the spec the resource was created from.
+func (r *Resource[T, PT]) Spec() Spec[T] {
+	return r.spec
+}
+
+// List returns every record visible to the caller.
+func (r *Resource[T, PT]) List(ctx context.Context) ([]T, error) {
+	return r.store.List(ctx)
+}
+
+// ForEach calls fn for every record visible to the caller, in ID order,
+// without holding them all in memory; see store.Collection.ForEach.
+func (r *Resource[T, PT]) ForEach(ctx context.Context, fn func(T) error) error {
+	return r.store.ForEach(ctx, fn)
+}
+
+// ForEachCreated is ForEach over the records created strictly between after
+// and before, in order of creation; a zero time leaves that end open. See
+// store.Collection.ForEachCreated.
+func (r *Resource[T, PT]) ForEachCreated(ctx context.Context, after, before time.Time, fn func(T) error) error {
+	return r.store.ForEachCreated(ctx, after, before, fn)
+}
+
+// Get returns the record with the given ID, or store.ErrNotFound.
+func (r *Resource[T, PT]) Get(ctx context.Context, id string) (*T, error) {
+	return r.store.Get(ctx, id)
+}
+
+// Create stores item under its ID. created is false when the ID already
+// existed, in which case the stored record is returned unchanged.
+func (r *Resource[T, PT]) Create(ctx context.Context, item *T) (result *T, created bool, err error) {
+	if err := r.before(ctx, Created, item); err != nil {
+		return nil, false, err
+	}
+	if err := r.validateNew(item); err != nil {
+		return nil, false, err
+	}
+
+	result, created, err = r.store.Create(ctx, item)
+	if err != nil {
+		return nil, false, err
+	}
+	if created {
+		count(r.spec.Creates, "created")
+		r.committed(ctx, Created, result)
+	} else {
+		count(r.spec.Creates, "replayed")
+	}
+	return result, created, nil
+}
+
+// Update copies the fields of item selected by mask (every field in
+// Spec.Fields when mask is empty) into the record with the given ID. written
+// is false when that changed nothing, in which case nothing was written.
+func (r *Resource[T, PT]) Update(ctx context.Context, id string, item *T, mask models.FieldMask) (result *T, written bool, err error) {
+	return r.update(ctx, id, item, mask, nil)
+}
+
+// UpdateAt is Update for a client that last read the record at version. The
+// update only writes if the record is still at that version, and returns
+// store.ErrPreconditionFailed if someone else has written since. An update
+// that changes nothing succeeds at any version, so a retry of one that
+// succeeded does too. The model must implement models.Versioned.
+func (r *Resource[T, PT]) UpdateAt(ctx context.Context, id string, item *T, mask models.FieldMask, version int64) (result *T, written bool, err error) {
+	if _, ok := any(PT(item)).(models.Versioned); !ok {
+		return nil, false, &InvalidError{Reason: r.spec.Kind + " records are not versioned"}
+	}
+	return r.update(ctx, id, item, mask, func(stored *T) bool {
+		return any(PT(stored)).(models.Versioned).RecordVersion() == version
+	})
+}
+
+func (r *Resource[T, PT]) update(ctx context.Context, id string, item *T, mask models.FieldMask, check func(*T) bool) (result *T, written bool, err error) {
+	PT(item).SetRecordID(id)
+	if err := r.before(ctx, Updated, item); err != nil {
+		return nil, false, err
+	}
+	PT(item).SetRecordID(id) // the path names the record, whatever a hook did
+	if err := r.validate(item, mask); err != nil {
+		return nil, false, err
+	}
+
+	result, written, err = r.store.UpdateIf(ctx, id, func(dst *T) { r.spec.Merge(mask, dst, item) }, check)
+	if errors.Is(err, store.ErrPreconditionFailed) {
+		count(r.spec.Updates, "conflict")
+		return nil, false, err
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if written {
+		count(r.spec.Updates, "written")
+		r.committed(ctx, Updated, result)
+	} else {
+		count(r.spec.Updates, "skipped")
+	}
+	return result, written, nil
+}
+
+// Delete removes the record with the given ID, reporting whether it existed.
+func (r *Resource[T, PT]) Delete(ctx context.Context, id string) (existed bool, err error) {
+	removed, err := r.Remove(ctx, id, nil)
+	return removed != nil, err
+}
+
+// Remove is Delete returning the removed record, or nil when it was already
+// gone. A record failing check is kept and store.ErrPreconditionFailed
+// returned; see store.Collection.Remove.
+func (r *Resource[T, PT]) Remove(ctx context.Context, id string, check func(*T) bool) (removed *T, err error) {
+	removed, err = r.store.Remove(ctx, id, check)
+	switch {
+	case errors.Is(err, store.ErrPreconditionFailed):
+		count(r.spec.Deletes, "precondition_failed")
+		return nil, err
+	case err != nil:
+		return nil, err
+	case removed != nil:
+		count(r.spec.Deletes, "deleted")
+		r.committed(ctx, Deleted, removed)
+	default:
+		count(r.spec.Deletes, "missing")
+	}
+	return removed, nil
+}
+
+// ParseMask parses a field mask over the resource's updatable fields,
+// returning an *InvalidError if it names another field.
+func (r *Resource[T, PT]) ParseMask(s string) (models.FieldMask, error) {
+	mask, err := models.ParseFieldMaskOf(s, r.spec.Fields)
+	if err != nil {
+		return nil, &InvalidError{Reason: "invalid field mask: " + err.Error()}
+	}
+	return mask, nil
+}
+
+// validateNew checks a record to be created: its ID against r.KeyFormat,
+// then the whole record.
+func (r *Resource[T, PT]) validateNew(item *T) error {
+	if desc := r.KeyFormat.Check(PT(item).RecordID()); desc != "" {
+		return &models.ValidationError{Fields: []models.FieldError{{Field: "id", Message: desc}}}
+	}
+	return r.validate(item, nil)
+}
+
+// validate runs the spec's validation. Only the fields selected by mask (and
+// the ID) are checked: fields outside the mask are not taken from item.
+func (r *Resource[T, PT]) validate(item *T, mask models.FieldMask) error {
+	if r.spec.Validate == nil {
+		return nil
+	}
+	err := r.spec.Validate(item)
+	if err == nil {
+		return nil
+	}
+	var ve *models.ValidationError
+	if !errors.As(err, &ve) {
+		return &InvalidError{Reason: err.Error()}
+	}
+	var fields []models.FieldError
+	for _, f := range ve.Fields {
+		if f.Field == "id" || mask.Has(f.Field) {
+			fields = append(fields, f)
+		}
+	}
+	if len(fields) == 0 {
+		return nil
+	}
+	return &models.ValidationError{Fields: fields}
+}
+
+// publish announces that item was created, updated or deleted, as action
+// says, to r.Events. The event of a versioned record has an ID derived from
+// the change (see models.EventID), so publishing it again is harmless.
+func (r *Resource[T, PT]) publish(ctx context.Context, action string, item *T) {
+	if r.Events == nil {
+		return
+	}
+	rec, typ, tenant := PT(item), r.spec.Kind+"."+action, store.TenantFrom(ctx)
+	id := models.NewID()
+	if v, ok := any(rec).(models.Versioned); ok {
+		id = models.EventID(tenant, typ, rec.RecordID(), rec.RecordCreatedAt(), v.RecordVersion())
+	}
+	data, err := json.Marshal(item)
+	if err == nil {
+		err = r.Events.Publish(ctx, models.Event{
+			ID:      id,
+			Type:    typ,
+			Subject: rec.RecordID(),
+			Tenant:  tenant,
+			Time:    time.Now().UTC(),
+			Data:    data,
+		})
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "publishing an event failed", "type", typ, "id", rec.RecordID(), "err", err)
+	}
+}
+
+func count(c *prometheus.CounterVec, outcome string) {
+	if c != nil {
+		c.WithLabelValues(outcome).Inc()
+	}
+}
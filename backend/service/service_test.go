@@ -0,0 +1,153 @@
+package service_test
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	"github.com/arkantrust/idempotency-example/backend/models"
+	"github.com/arkantrust/idempotency-example/backend/service"
+	"github.com/arkantrust/idempotency-example/backend/store"
+)
+
+// recorder is a service.Publisher keeping the events published.
+type recorder []models.Event
+
+func (r *recorder) Publish(ctx context.Context, e models.Event) error {
+	*r = append(*r, e)
+	return nil
+}
+
+func TestOnlyWritesArePublished(t *testing.T) {
+	s, err := store.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	svc := service.NewChargebacks(s)
+	var events recorder
+	svc.Events = &events
+	ctx := context.Background()
+
+	cb := models.Chargeback{ID: "cb-1", Amount: 100, Currency: "USD", Reason: "fraud"}
+	for range 2 {
+		c := cb
+		if _, _, err := svc.Create(ctx, &c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for range 2 {
+		c := cb
+		c.Amount = 200
+		if _, _, err := svc.Update(ctx, "cb-1", &c, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for range 2 {
+		if _, err := svc.Delete(ctx, "cb-1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for range 2 {
+		if _, _, err := svc.CreateWithKey(ctx, "k-1", &models.Chargeback{Amount: 100, Currency: "USD", Reason: "fraud"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := []string{"chargeback.created", "chargeback.updated", "chargeback.deleted", "chargeback.created"}
+	if len(events) != len(want) {
+		t.Fatalf("expected %v, got %v", want, events)
+	}
+	for i := range want {
+		if events[i].Type != want[i] {
+			t.Fatalf("expected %v, got %v", want, events)
+		}
+	}
+}
+
+func TestEventIDsIdentifyTheChange(t *testing.T) {
+	s, err := store.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	svc := service.NewChargebacks(s)
+	var events recorder
+	svc.Events = &events
+	ctx := context.Background()
+
+	cb := models.Chargeback{ID: "cb-1", Amount: 100, Currency: "USD", Reason: "fraud"}
+	for range 2 {
+		c := cb
+		if _, _, err := svc.Create(ctx, &c); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := svc.Delete(ctx, "cb-1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(events) != 4 {
+		t.Fatalf("expected 4 events, got %+v", events)
+	}
+	stored := events[0]
+	var created models.Chargeback
+	if err := json.Unmarshal(stored.Data, &created); err != nil {
+		t.Fatal(err)
+	}
+	if want := models.EventID("", "chargeback.created", "cb-1", created.CreatedAt, 1); stored.ID != want || stored.Subject != "cb-1" {
+		t.Fatalf("expected the ID derived from the record, got %+v", stored)
+	}
+	seen := map[string]bool{}
+	for _, e := range events {
+		if seen[e.ID] {
+			t.Fatalf("expected a new ID for every change, got %+v", events)
+		}
+		seen[e.ID] = true
+	}
+}
+
+func TestBulkWritesArePublished(t *testing.T) {
+	s, err := store.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	svc := service.NewChargebacks(s)
+	var events recorder
+	svc.Events = &events
+	ctx := context.Background()
+
+	for range 2 {
+		if _, err := svc.Import(ctx, []*models.Chargeback{
+			{ID: "cb-1", Amount: 100, Currency: "USD", Reason: "fraud"},
+			{ID: "cb-2", Amount: 200, Currency: "USD", Reason: "fraud"},
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for range 2 {
+		if _, _, err := svc.Erase(ctx, "cb-1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for range 2 {
+		if _, err := svc.DeleteMatching(ctx, store.Filter{Currency: "USD"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := []string{
+		"chargeback.created cb-1", "chargeback.created cb-2",
+		"chargeback.updated cb-1",
+		"chargeback.deleted cb-1", "chargeback.deleted cb-2",
+	}
+	if len(events) != len(want) {
+		t.Fatalf("expected %v, got %+v", want, events)
+	}
+	for i := range want {
+		if got := events[i].Type + " " + events[i].Subject; got != want[i] {
+			t.Fatalf("expected %v, got %+v", want, events)
+		}
+	}
+}
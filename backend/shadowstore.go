@@ -0,0 +1,46 @@
+package main
+
+import (
+	"github.com/arkantrust/idempotency-example/backend/config"
+	"github.com/arkantrust/idempotency-example/backend/store"
+)
+
+// openShadow opens the shadow database cfg names, set up like the primary –
+// durability, timeout, encryption keys, key TTL and policy – so that it
+// decides writes alike, in its own encoding.
+func openShadow(cfg *config.Config) (*store.Store, error) {
+	s, err := store.New(cfg.Shadow.DBPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.SetOptions(boltOptions(cfg.Bolt)); err != nil {
+		s.Close()
+		return nil, err
+	}
+	s.SetTimeout(cfg.DBTimeout)
+	encoding := cfg.Shadow.Encoding
+	if encoding == "" {
+		encoding = cfg.DBEncoding
+	}
+	codec, err := store.CodecByName(encoding)
+	if err != nil {
+		s.Close()
+		return nil, err
+	}
+	s.SetCodec(codec)
+	if len(cfg.Encryption.Keys) > 0 {
+		keys, err := store.ParseKeys(cfg.Encryption.Keys)
+		if err != nil {
+			s.Close()
+			return nil, err
+		}
+		s.SetKeys(keys)
+	}
+	if cfg.Idempotency.KeyTTL > 0 {
+		s.SetKeyTTL(cfg.Idempotency.KeyTTL)
+	}
+	if policy, _ := cfg.Policy.Rules(); policy != nil { // validated by config.Load
+		s.SetPolicy(policy)
+	}
+	return s, nil
+}
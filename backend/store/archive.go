@@ -0,0 +1,179 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"slices"
+	"time"
+
+	bolt "github.com/boltdb/bolt"
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/arkantrust/idempotency-example/backend/metrics"
+	"github.com/arkantrust/idempotency-example/backend/models"
+)
+
+// Archived chargebacks live in a bucket of their own, next to the active
+// ones and with its own creation time index, so that the active bucket – and
+// every List, ForEach and Stats over it – only holds recent records:
+//
+//	chargebacks_archive/<id>
+//	chargebacks_archive_by_created/<createdAt><id>
+//
+// Archiving moves a record; it does not delete it. The archive keeps its ID,
+// so creating a chargeback with an archived ID replays the archived record
+// rather than writing a second one, and an idempotency key that created an
+// archived record keeps replaying it. The daily totals keep counting archived
+// records too: reports cover the whole history. Archived records are read
+// only; updates and deletes do not see them.
+const archiveBucketName = "chargebacks_archive"
+
+// archiveBatch bounds the records Archive moves per transaction, so that a
+// first run over a large database does not hold one long write transaction.
+const archiveBatch = 1000
+
+// Archive moves the chargebacks of every tenant created before before from
+// the active bucket into the archive and returns how many it moved. It is a
+// maintenance operation, so it also runs in ModeMaintenance; run again, it
+// finds nothing left to move.
+func (s *Store) Archive(ctx context.Context, before time.Time) (int, error) {
+	_, span := startSpan(context.Background(), "store.Archive", "")
+	span.SetAttributes(attribute.String("range.before", formatBound(before)))
+	end := createdKey(before, "")
+	total := 0
+	var err error
+	for {
+		n := 0
+		err = s.maintain(ctx, func(tx *bolt.Tx) error {
+			n = 0
+			parents, err := tenantParents(tx)
+			if err != nil {
+				return err
+			}
+			for _, p := range parents {
+				moved, err := s.archiveIn(p, end, archiveBatch-n)
+				if err != nil {
+					return err
+				}
+				if n += moved; n == archiveBatch {
+					break
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			break
+		}
+		total += n
+		metrics.Archived.Add(float64(n))
+		if n < archiveBatch {
+			break
+		}
+	}
+	span.SetAttributes(attribute.Int("chargeback.count", total))
+	endSpan(span, err)
+	return total, err
+}
+
+// archiveIn moves up to limit of the records in p whose index key sorts
+// before end into the archive, oldest first.
+func (s *Store) archiveIn(p bucketParent, end []byte, limit int) (int, error) {
+	records := p.Bucket([]byte(bucketName))
+	idx := p.Bucket([]byte(s.chargebacks.indexBucket()))
+	if records == nil || idx == nil {
+		return 0, nil
+	}
+
+	// Collect first: the cursor must not see the deletes.
+	var keys [][]byte
+	cur := idx.Cursor()
+	for k, _ := cur.First(); k != nil && bytes.Compare(k, end) < 0 && len(keys) < limit; k, _ = cur.Next() {
+		keys = append(keys, slices.Clone(k))
+	}
+	if len(keys) == 0 {
+		return 0, nil
+	}
+
+	archive, err := childBucket(p, archiveBucketName)
+	if err != nil {
+		return 0, err
+	}
+	archiveIdx, err := childBucket(p, s.archive.indexBucket())
+	if err != nil {
+		return 0, err
+	}
+	// Archived chargebacks leave their merchant's listing and stats, and
+	// lose their evidence, but not the reports, whose rollups keep counting
+	// them.
+	merchantIdx := p.Bucket([]byte(merchantIndexBucketName))
+	for _, k := range keys {
+		id := k[createdPrefix:]
+		if v := records.Get(id); v != nil {
+			// Re-encoded rather than copied: the archive has its own
+			// schema version.
+			var c models.Chargeback
+			if err := s.decode(bucketName, v, &c); err != nil {
+				return 0, err
+			}
+			data, err := s.encode(archiveBucketName, &c)
+			if err != nil {
+				return 0, err
+			}
+			if err := archive.Put(id, data); err != nil {
+				return 0, err
+			}
+			if err := archiveIdx.Put(k, []byte{}); err != nil {
+				return 0, err
+			}
+			if err := records.Delete(id); err != nil {
+				return 0, err
+			}
+			if merchantIdx != nil && c.MerchantID != "" {
+				if err := merchantIdx.Delete(merchantKey(c.MerchantID, c.ID)); err != nil {
+					return 0, err
+				}
+			}
+			if err := dropEvidence(func(name string) *bolt.Bucket { return p.Bucket([]byte(name)) }, c.ID); err != nil {
+				return 0, err
+			}
+		}
+		if err := idx.Delete(k); err != nil {
+			return 0, err
+		}
+	}
+	return len(keys), nil
+}
+
+// childBucket returns p's bucket name, creating it if needed.
+func childBucket(p bucketParent, name string) (*bolt.Bucket, error) {
+	if b := p.Bucket([]byte(name)); b != nil {
+		return b, nil
+	}
+	return p.CreateBucket([]byte(name))
+}
+
+// ForEachArchived is ForEachCreated over the archived chargebacks.
+func (s *Store) ForEachArchived(ctx context.Context, after, before time.Time, fn func(models.Chargeback) error) error {
+	return s.archive.ForEachCreated(ctx, after, before, fn)
+}
+
+// archived returns the archived record with the given ID, whoever owns it,
+// or nil.
+func (c *Collection[T, PT]) archived(ctx context.Context, tx *bolt.Tx, id string) (*T, error) {
+	if c.archive == nil {
+		return nil, nil
+	}
+	b := tenantBucket(ctx, tx, c.archive.bucket)
+	if b == nil {
+		return nil, nil
+	}
+	v := b.Get([]byte(id))
+	if v == nil {
+		return nil, nil
+	}
+	var item T
+	if err := c.s.decode(c.archive.bucket, v, &item); err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
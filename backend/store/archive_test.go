@@ -0,0 +1,90 @@
+package store_test
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/arkantrust/idempotency-example/backend/models"
+	"github.com/arkantrust/idempotency-example/backend/store"
+)
+
+func archivedBetween(t *testing.T, s *store.Store, after, before time.Time) []string {
+	t.Helper()
+	var ids []string
+	err := s.ForEachArchived(ctx, after, before, func(c models.Chargeback) error {
+		ids = append(ids, c.ID)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ForEachArchived: %v", err)
+	}
+	return ids
+}
+
+func TestArchive(t *testing.T) {
+	s := newTestStore(t)
+	createAt(t, s, "a", "b", "c", "d")
+
+	n, err := s.Archive(ctx, day.Add(2*time.Hour))
+	if err != nil || n != 2 {
+		t.Fatalf("archive: moved %d, %v; want 2", n, err)
+	}
+	if got := createdBetween(t, s, time.Time{}, time.Time{}); !slices.Equal(got, []string{"c", "d"}) {
+		t.Fatalf("active %v, want [c d]", got)
+	}
+	if got := archivedBetween(t, s, time.Time{}, time.Time{}); !slices.Equal(got, []string{"a", "b"}) {
+		t.Fatalf("archived %v, want [a b]", got)
+	}
+	if got := archivedBetween(t, s, day, time.Time{}); !slices.Equal(got, []string{"b"}) {
+		t.Fatalf("archived after the first %v, want [b]", got)
+	}
+
+	// A second run finds nothing left to move.
+	if n, err := s.Archive(ctx, day.Add(2*time.Hour)); err != nil || n != 0 {
+		t.Fatalf("rerun: moved %d, %v; want 0", n, err)
+	}
+
+	// An archived ID stays taken: creating it again replays the archived
+	// record instead of writing a new one.
+	got, created, err := s.Create(ctx, &models.Chargeback{ID: "a", Amount: 100, Currency: "USD", Reason: "fraud"})
+	if err != nil || created || !got.CreatedAt.Equal(day) {
+		t.Fatalf("create archived ID: created %v, %+v, %v", created, got, err)
+	}
+	if _, err := s.Get(ctx, "a"); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("archived record still active: %v", err)
+	}
+	// So does importing it again.
+	res, err := s.CreateMany(ctx, []*models.Chargeback{{ID: "a", Amount: 100, Currency: "USD", Reason: "fraud"}})
+	if err != nil || len(res.Created) != 0 || res.Skipped != 1 {
+		t.Fatalf("import archived ID: %+v, %v", res, err)
+	}
+	if _, err := s.Get(ctx, "a"); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("archived record imported again: %v", err)
+	}
+
+	// Reports keep counting archived chargebacks.
+	days, err := s.DailyTotals(ctx, time.Time{}, time.Time{})
+	if err != nil || len(days) != 1 || days[0].Count != 4 {
+		t.Fatalf("daily totals %+v, %v; want 4 on one day", days, err)
+	}
+}
+
+func TestArchivedKeyReplays(t *testing.T) {
+	s := newTestStore(t)
+	cb := func() *models.Chargeback {
+		return &models.Chargeback{ID: models.NewID(), Amount: 100, Currency: "USD", Reason: "fraud"}
+	}
+	first, _, err := s.CreateWithKey(store.WithTime(ctx, day), "key-1", cb())
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if _, err := s.Archive(ctx, day.Add(time.Hour)); err != nil {
+		t.Fatalf("archive: %v", err)
+	}
+	replay, created, err := s.CreateWithKey(ctx, "key-1", cb())
+	if err != nil || created || replay.ID != first.ID {
+		t.Fatalf("replay after archival: created %v, %+v, %v", created, replay, err)
+	}
+}
@@ -19,12 +19,25 @@
 package store
 
 import (
-	"encoding/json"
+	"context"
 	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	bolt "github.com/boltdb/bolt"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sync/singleflight"
 
+	"github.com/arkantrust/idempotency-example/backend/metrics"
 	"github.com/arkantrust/idempotency-example/backend/models"
 )
 
@@ -33,19 +46,131 @@ const bucketName = "chargebacks"
 // ErrNotFound is returned when a requested chargeback does not exist.
 var ErrNotFound = errors.New("chargeback not found")
 
+// ErrKeyConflict is returned by Create when the idempotency key (the record
+// ID) is already in use by a different owner. Replaying the existing record
+// would leak another client's data, so the request is rejected instead.
+var ErrKeyConflict = newError(ErrConflict, "idempotency key belongs to another client")
+
+// ErrPreconditionFailed is returned by Remove and UpdateIf when the record
+// exists but fails the caller's check, in which case it is left unchanged.
+var ErrPreconditionFailed = newError(ErrConflict, "record does not match the precondition")
+
 // Store wraps a BoltDB database and exposes CRUD operations for Chargeback
 // records. All operations are idempotent by design.
 type Store struct {
+	path string
+
+	// mu guards db. Every transaction holds a read lock for its duration;
+	// operations that replace the underlying file (Restore) take the write
+	// lock so no transaction can observe a closed or half-swapped database.
+	mu sync.RWMutex
 	db *bolt.DB
+
+	// mode decides which writes are accepted; see SetMode. It is guarded by
+	// mu, so a transaction's check holds until it finishes.
+	mode Mode
+
+	// codec encodes records on write; see SetCodec.
+	codec Codec
+
+	// keys, when set, encrypts sensitive fields; see SetKeys.
+	keys KeyProvider
+
+	// keyTTL, when positive, is how long idempotency keys are honoured; see
+	// SetKeyTTL.
+	keyTTL time.Duration
+
+	// policy, when set, holds chargeback writes to risk rules; see
+	// SetPolicy.
+	policy *models.Policy
+
+	// migrations upgrade old records, by bucket; see AddMigration.
+	migrations map[string][]Migration
+
+	// batchSize and batchDelay configure write coalescing; see SetBatching.
+	batchSize  int
+	batchDelay time.Duration
+
+	// chargebacks implements the single-record operations below.
+	chargebacks *Collection[models.Chargeback, *models.Chargeback]
+
+	// archive holds the chargebacks Archive moved out of chargebacks.
+	archive *Collection[models.Chargeback, *models.Chargeback]
+
+	// charges and merchants hold the records chargebacks reference.
+	charges   *Collection[models.Charge, *models.Charge]
+	merchants *Collection[models.Merchant, *models.Merchant]
+
+	// reads shares identical concurrent reads, and writes counts finished
+	// write transactions so that they are not shared across one; see
+	// shared.
+	reads  singleflight.Group
+	writes atomic.Uint64
+
+	// options are those the file is opened with; see SetOptions.
+	options atomic.Pointer[Options]
+
+	// timeout, in nanoseconds, bounds the wait for a transaction; see
+	// SetTimeout.
+	timeout atomic.Int64
 }
 
 // New opens (or creates) a BoltDB database at the given path and ensures the
 // chargebacks bucket exists.
 func New(path string) (*Store, error) {
-	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 1 * time.Second})
+	return newStore(path, ModeReadWrite)
+}
+
+// NewReadOnly opens an existing BoltDB database in ModeReadOnly. Unlike New it
+// takes a shared lock on the file, so it works alongside other readers and on
+// read-only filesystems.
+func NewReadOnly(path string) (*Store, error) {
+	return newStore(path, ModeReadOnly)
+}
+
+func newStore(path string, mode Mode) (*Store, error) {
+	db, err := open(path, mode == ModeReadOnly, Options{})
+	if err != nil {
+		return nil, err
+	}
+	s := &Store{
+		path:  path,
+		db:    db,
+		mode:  mode,
+		codec: JSON,
+		migrations: map[string][]Migration{
+			bucketName:        slices.Clone(chargebackMigrations),
+			archiveBucketName: slices.Clone(chargebackMigrations),
+		},
+	}
+	s.chargebacks = NewCollection[models.Chargeback](s, bucketName, "chargeback", models.SameContent)
+	s.charges = NewCollection[models.Charge](s, chargesBucketName, "charge", models.SameCharge)
+	s.merchants = NewCollection[models.Merchant](s, merchantsBucketName, "merchant", models.SameMerchant)
+	s.chargebacks.changed = s.chargebackChanged
+	s.archive = NewCollection[models.Chargeback](s, archiveBucketName, "chargeback", models.SameContent)
+	s.chargebacks.archive = s.archive
+	if mode != ModeReadOnly {
+		if err := s.buildIndexes(); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// openTimeout bounds the wait for another process's lock on the file.
+const openTimeout = 1 * time.Second
+
+// open opens the Bolt file at path with opts and, unless readOnly, creates
+// the chargebacks bucket.
+func open(path string, readOnly bool, opts Options) (*bolt.DB, error) {
+	db, err := bolt.Open(path, 0600, opts.bolt(readOnly))
 	if err != nil {
 		return nil, err
 	}
+	if readOnly {
+		return db, nil
+	}
 
 	// Create the bucket if it does not yet exist. This is idempotent by
 	// definition – calling CreateBucketIfNotExists is safe to run on every
@@ -59,60 +184,524 @@ func New(path string) (*Store, error) {
 		return nil, err
 	}
 
-	return &Store{db: db}, nil
+	return db, nil
 }
 
 // Close releases the database file lock.
 func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	return s.db.Close()
 }
 
-// List returns all chargebacks stored in the database.
-// This is a pure read – always idempotent.
-func (s *Store) List() ([]models.Chargeback, error) {
-	var items []models.Chargeback
+// view runs fn in a read-only transaction, once ctx allows; see begin.
+func (s *Store) view(ctx context.Context, fn func(*bolt.Tx) error) error {
+	return s.begin(ctx, func(fn func(*bolt.Tx) error) error {
+		s.mu.RLock()
+		defer s.mu.RUnlock()
+		defer observeTx("view", time.Now())
+		return s.db.View(fn)
+	}, fn)
+}
+
+// update runs fn in a read-write transaction, or returns ErrReadOnly if the
+// mode does not accept writes.
+func (s *Store) update(ctx context.Context, fn func(*bolt.Tx) error) error {
+	return s.begin(ctx, func(fn func(*bolt.Tx) error) error {
+		s.mu.RLock()
+		defer s.mu.RUnlock()
+		if err := s.writable(); err != nil {
+			return err
+		}
+		defer s.wrote()
+		defer observeTx("update", time.Now())
+		return s.db.Update(fn)
+	}, fn)
+}
+
+// maintain is update for maintenance operations, which ModeMaintenance still
+// runs.
+func (s *Store) maintain(ctx context.Context, fn func(*bolt.Tx) error) error {
+	return s.begin(ctx, func(fn func(*bolt.Tx) error) error {
+		s.mu.RLock()
+		defer s.mu.RUnlock()
+		if err := s.maintainable(); err != nil {
+			return err
+		}
+		defer s.wrote()
+		defer observeTx("update", time.Now())
+		return s.db.Update(fn)
+	}, fn)
+}
+
+// tally is maintain for bookkeeping written on every request: concurrent
+// calls always share transactions, as batch shares them when batching is
+// enabled, so that counting a request costs no fsync of its own. It waits up
+// to the batch delay for company. fn may run more than once, as with batch.
+func (s *Store) tally(ctx context.Context, fn func(*bolt.Tx) error) error {
+	return s.begin(ctx, func(fn func(*bolt.Tx) error) error {
+		s.mu.RLock()
+		defer s.mu.RUnlock()
+		if err := s.maintainable(); err != nil {
+			return err
+		}
+		defer s.wrote()
+		defer observeTx("batch", time.Now())
+		return s.db.Batch(fn)
+	}, fn)
+}
+
+// SetBatching makes single-record writes (Create, Update, Delete,
+// CreateWithKey, SaveResponse) share transactions: concurrent writes are
+// collected for up to delay, or until maxSize are waiting, and committed
+// together with a single fsync. This trades up to delay of latency per write
+// for much higher throughput under concurrent load. maxSize 0 turns batching
+// off, which is the default.
+//
+// Each write keeps its own idempotency check: the writes in a batch run one
+// after another in the same transaction, so a retry batched with the request
+// it repeats finds the record that request created. If one of them fails,
+// the others are re-run without it and it is re-run alone, so one write's
+// error never rolls back another's.
+func (s *Store) SetBatching(maxSize int, delay time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.batchSize, s.batchDelay = maxSize, delay
+	s.configure()
+}
+
+// configure applies the batching settings and NoSync to s.db. The caller
+// must hold s.mu for writing.
+func (s *Store) configure() {
+	s.db.NoSync = s.Options().NoSync
+	if s.batchSize > 0 {
+		s.db.MaxBatchSize = s.batchSize
+		s.db.MaxBatchDelay = s.batchDelay
+	}
+}
+
+// batch runs fn in a read-write transaction, shared with concurrent calls
+// when batching is enabled. fn may run more than once, so it must reset any
+// state it captures before using it.
+func (s *Store) batch(ctx context.Context, fn func(*bolt.Tx) error) error {
+	return s.begin(ctx, func(fn func(*bolt.Tx) error) error {
+		s.mu.RLock()
+		defer s.mu.RUnlock()
+		if err := s.writable(); err != nil {
+			return err
+		}
+		defer s.wrote()
+		if s.batchSize <= 0 {
+			defer observeTx("update", time.Now())
+			return s.db.Update(fn)
+		}
+		defer observeTx("batch", time.Now())
+		return s.db.Batch(fn)
+	}, fn)
+}
+
+// tracer creates the spans for store operations. Spans are children of
+// whatever span is active in the caller's context (normally the HTTP request
+// span), so a trace shows exactly which path a request took through the store.
+var tracer = otel.Tracer("github.com/arkantrust/idempotency-example/backend/store")
+
+// startSpan starts a span for a store operation on the given record ID.
+func startSpan(ctx context.Context, name, id string) (context.Context, trace.Span) {
+	ctx, span := tracer.Start(ctx, name)
+	if id != "" {
+		span.SetAttributes(attribute.String("chargeback.id", id))
+	}
+	return ctx, span
+}
+
+// endSpan records err (if any) on span and ends it.
+func endSpan(span trace.Span, err error) {
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// observeTx records how long a transaction of the given kind took, including
+// the commit (and therefore the fsync) for updates.
+func observeTx(kind string, start time.Time) {
+	metrics.TxDuration.WithLabelValues(kind).Observe(time.Since(start).Seconds())
+}
+
+// Ping checks that the database is reachable by running an empty read
+// transaction. It is cheap enough to call from a readiness probe.
+func (s *Store) Ping(ctx context.Context) error {
+	_, span := startSpan(ctx, "store.Ping", "")
+	err := s.view(ctx, func(tx *bolt.Tx) error {
+		if tx.Bucket([]byte(bucketName)) == nil {
+			return fmt.Errorf("bucket %q missing", bucketName)
+		}
+		return nil
+	})
+	endSpan(span, err)
+	return err
+}
+
+// ErrInvalidSnapshot is returned when a file offered to Restore is not a
+// usable chargebacks database.
+var ErrInvalidSnapshot = newError(ErrValidation, "invalid snapshot")
+
+// ValidateSnapshot checks that the file at path is a consistent BoltDB file
+// containing a chargebacks bucket whose every value decodes as a Chargeback.
+// Tenant buckets, if any, are checked the same way.
+// The file is opened read-only and never modified.
+func ValidateSnapshot(path string) error {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 1 * time.Second, ReadOnly: true})
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSnapshot, err)
+	}
+	defer db.Close()
+
+	return db.View(func(tx *bolt.Tx) error {
+		// Check walks every page and reports structural damage such as
+		// unreachable or doubly-referenced pages.
+		for err := range tx.Check() {
+			return fmt.Errorf("%w: %v", ErrInvalidSnapshot, err)
+		}
 
-	err := s.db.View(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(bucketName))
-		return b.ForEach(func(k, v []byte) error {
-			var c models.Chargeback
-			if err := json.Unmarshal(v, &c); err != nil {
-				return err
+		if b == nil {
+			return fmt.Errorf("%w: missing %q bucket", ErrInvalidSnapshot, bucketName)
+		}
+		if err := validateRecords(b); err != nil {
+			return err
+		}
+
+		tenants := tx.Bucket([]byte(tenantsBucketName))
+		if tenants == nil {
+			return nil
+		}
+		return tenants.ForEach(func(name, _ []byte) error {
+			tb := tenants.Bucket(name)
+			if tb == nil {
+				return fmt.Errorf("%w: tenant %q is not a bucket", ErrInvalidSnapshot, name)
+			}
+			if cb := tb.Bucket([]byte(bucketName)); cb != nil {
+				return validateRecords(cb)
 			}
-			items = append(items, c)
 			return nil
 		})
 	})
+}
+
+// validateRecords checks that every value in b decodes as a Chargeback.
+func validateRecords(b *bolt.Bucket) error {
+	return b.ForEach(func(k, v []byte) error {
+		var c models.Chargeback
+		if err := decode(v, &c); err != nil {
+			return fmt.Errorf("%w: record %q: %v", ErrInvalidSnapshot, k, err)
+		}
+		return nil
+	})
+}
+
+// Restore replaces the live database with the snapshot at src.
+//
+// The snapshot is validated first and copied next to the live file, so a bad
+// or partially-copied snapshot never touches live data. The swap itself waits
+// for in-flight transactions to finish, closes the database, renames the copy
+// over the live file (an atomic operation on POSIX filesystems) and reopens
+// it; should the copy fail to open, the original is put back. Requests
+// arriving during the swap simply block until it completes.
+func (s *Store) Restore(ctx context.Context, src string) error {
+	if err := ValidateSnapshot(src); err != nil {
+		return err
+	}
+
+	tmp, err := copyToTemp(src, filepath.Dir(s.path))
 	if err != nil {
-		return nil, err
+		return err
 	}
+	defer os.Remove(tmp) // no-op after a successful rename
 
-	// Return an empty slice rather than nil so the JSON encoder emits [] instead
-	// of null. This makes client-side handling simpler.
-	if items == nil {
-		items = []models.Chargeback{}
+	if err := s.lockExclusive(ctx); err != nil {
+		return err
 	}
-	return items, nil
+	defer s.mu.Unlock()
+	if err := s.maintainable(); err != nil {
+		return err
+	}
+	return s.swap(tmp)
 }
 
-// Get retrieves a single chargeback by ID.
-// Returns ErrNotFound if the key does not exist.
-func (s *Store) Get(id string) (*models.Chargeback, error) {
-	var c models.Chargeback
+// exclusiveWait bounds how long lockExclusive waits for the store's lock.
+const exclusiveWait = 5 * time.Second
+
+// lockExclusive takes s.mu for writing, for the operations that replace the
+// database file. It does not queue for it: a writer waiting in Lock holds up
+// every new reader, so one client slowly downloading an export or a backup
+// would stall the whole API until it finished. Instead it tries until no
+// transaction holds the lock, and gives up after exclusiveWait, or when ctx
+// ends, with ErrTimeout, for the caller to try again later.
+func (s *Store) lockExclusive(ctx context.Context) error {
+	if s.mu.TryLock() {
+		return nil
+	}
+	deadline := time.NewTimer(exclusiveWait)
+	defer deadline.Stop()
+	tick := time.NewTicker(10 * time.Millisecond)
+	defer tick.Stop()
+	for {
+		select {
+		case <-tick.C:
+			if s.mu.TryLock() {
+				return nil
+			}
+		case <-deadline.C:
+			return ErrTimeout
+		case <-ctx.Done():
+			return fmt.Errorf("%w: %w", ErrTimeout, ctx.Err())
+		}
+	}
+}
+
+// swap closes the live database, renames the file at tmp over it and reopens
+// it. The original file is kept, hard-linked next to the live one, until the
+// new one is open and indexed: if it cannot be, the original is put back and
+// reopened, so the store stays usable. The caller must hold s.mu for writing.
+func (s *Store) swap(tmp string) error {
+	defer s.wrote()
+	if err := s.db.Close(); err != nil {
+		return err
+	}
 
+	old := s.path + ".old"
+	os.Remove(old) // left over from a swap that crashed
+	if err := os.Link(s.path, old); err != nil {
+		return errors.Join(err, s.reopen())
+	}
+	defer os.Remove(old)
+	if err := os.Rename(tmp, s.path); err != nil {
+		return errors.Join(err, s.reopen())
+	}
+
+	if err := s.reopen(); err != nil {
+		if rerr := os.Rename(old, s.path); rerr != nil {
+			return errors.Join(err, rerr)
+		}
+		return errors.Join(err, s.reopen())
+	}
+	return nil
+}
+
+// reopen opens the file at s.path as the live database and builds the
+// indexes from it. The caller must hold s.mu for writing.
+func (s *Store) reopen() error {
+	db, err := open(s.path, false, s.Options())
+	if err != nil {
+		return err
+	}
+	s.db = db
+	s.configure()
+	if err := s.buildIndexes(); err != nil {
+		db.Close()
+		return err
+	}
+	return nil
+}
+
+// CompactStats reports the database file size before and after compaction.
+type CompactStats struct {
+	Before int64 `json:"before"`
+	After  int64 `json:"after"`
+}
+
+// FreeRatio returns the fraction of the database file occupied by free or
+// pending-free pages. Bolt never returns freed pages to the filesystem, so
+// after heavy deletes this ratio grows until the file is compacted.
+func (s *Store) FreeRatio(ctx context.Context) (float64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var size int64
 	err := s.db.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(bucketName))
-		v := b.Get([]byte(id))
+		size = tx.Size()
+		return nil
+	})
+	if err != nil || size == 0 {
+		return 0, err
+	}
+
+	st := s.db.Stats()
+	free := int64(st.FreePageN+st.PendingPageN) * int64(s.db.Info().PageSize)
+	return float64(free) / float64(size), nil
+}
+
+// Compact rewrites all live data into a fresh file and atomically swaps it in
+// for the current one, reclaiming the space held by free pages.
+//
+// Compaction holds the store's exclusive lock for its whole duration: writes
+// that happened during the copy would otherwise be lost by the swap. Requests
+// block until it finishes, which is acceptable for a demo-sized database but
+// worth keeping in mind for the automatic trigger threshold. While a
+// long-running transaction, such as a streamed export, holds the store, it
+// gives up with ErrTimeout instead (see lockExclusive).
+func (s *Store) Compact(ctx context.Context) (CompactStats, error) {
+	var st CompactStats
+	if err := s.lockExclusive(ctx); err != nil {
+		return st, err
+	}
+	defer s.mu.Unlock()
+
+	if err := s.maintainable(); err != nil {
+		return st, err
+	}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		st.Before = tx.Size()
+		return nil
+	})
+	if err != nil {
+		return st, err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), ".compact-*")
+	if err != nil {
+		return st, err
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name()) // no-op after a successful swap
+
+	dst, err := bolt.Open(tmp.Name(), 0600, &bolt.Options{Timeout: 1 * time.Second})
+	if err != nil {
+		return st, err
+	}
+	if err := copyDB(dst, s.db); err != nil {
+		dst.Close()
+		return st, err
+	}
+	if err := dst.Close(); err != nil {
+		return st, err
+	}
+
+	if err := s.swap(tmp.Name()); err != nil {
+		return st, err
+	}
+
+	err = s.db.View(func(tx *bolt.Tx) error {
+		st.After = tx.Size()
+		return nil
+	})
+	return st, err
+}
+
+// copyDB copies every bucket (recursively) from src into dst in a single
+// write transaction. Keys are inserted in sorted order with a 100% fill
+// percent, producing densely packed pages.
+func copyDB(dst, src *bolt.DB) error {
+	return src.View(func(stx *bolt.Tx) error {
+		return dst.Update(func(dtx *bolt.Tx) error {
+			return stx.ForEach(func(name []byte, sb *bolt.Bucket) error {
+				db, err := dtx.CreateBucket(name)
+				if err != nil {
+					return err
+				}
+				return copyBucket(db, sb)
+			})
+		})
+	})
+}
+
+// copyBucket copies the contents and sequence of src into dst, descending
+// into nested buckets.
+func copyBucket(dst, src *bolt.Bucket) error {
+	dst.FillPercent = 1.0
+	if err := dst.SetSequence(src.Sequence()); err != nil {
+		return err
+	}
+	return src.ForEach(func(k, v []byte) error {
 		if v == nil {
-			return ErrNotFound
+			// A nil value marks a nested bucket.
+			child, err := dst.CreateBucket(k)
+			if err != nil {
+				return err
+			}
+			return copyBucket(child, src.Bucket(k))
 		}
-		return json.Unmarshal(v, &c)
+		return dst.Put(k, v)
 	})
+}
+
+// copyToTemp copies src into a new temporary file in dir, fsyncs it and
+// returns its path.
+func copyToTemp(src, dir string) (string, error) {
+	in, err := os.Open(src)
 	if err != nil {
-		return nil, err
+		return "", err
+	}
+	defer in.Close()
+
+	out, err := os.CreateTemp(dir, ".restore-*")
+	if err != nil {
+		return "", err
 	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(out.Name())
+		return "", err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		os.Remove(out.Name())
+		return "", err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(out.Name())
+		return "", err
+	}
+	return out.Name(), nil
+}
+
+// Backup writes a consistent snapshot of the entire database file to w and
+// returns the number of bytes written.
+//
+// The copy runs inside a read transaction, so it sees a point-in-time view of
+// the data while writers carry on unblocked. The output is a regular BoltDB
+// file that can be opened directly with New.
+func (s *Store) Backup(ctx context.Context, w io.Writer) (int64, error) {
+	var n int64
+	err := s.view(ctx, func(tx *bolt.Tx) error {
+		var err error
+		n, err = tx.WriteTo(w)
+		return err
+	})
+	return n, err
+}
+
+// List returns all chargebacks stored in the database.
+// This is a pure read – always idempotent.
+func (s *Store) List(ctx context.Context) ([]models.Chargeback, error) {
+	return s.chargebacks.List(ctx)
+}
 
-	return &c, nil
+// Chargebacks returns the collection behind the chargeback methods of s. Use
+// it rather than a new collection over the same bucket: it also keeps the
+// daily totals (see DailyTotals) in step with the records.
+func (s *Store) Chargebacks() *Collection[models.Chargeback, *models.Chargeback] {
+	return s.chargebacks
+}
+
+// ForEach calls fn for every chargeback in key order; see
+// Collection.ForEach.
+func (s *Store) ForEach(ctx context.Context, fn func(models.Chargeback) error) error {
+	return s.chargebacks.ForEach(ctx, fn)
+}
+
+// ForEachCreated calls fn for every chargeback created strictly between after
+// and before, in order of creation; see Collection.ForEachCreated.
+func (s *Store) ForEachCreated(ctx context.Context, after, before time.Time, fn func(models.Chargeback) error) error {
+	return s.chargebacks.ForEachCreated(ctx, after, before, fn)
+}
+
+// Get retrieves a single chargeback by ID.
+// Returns ErrNotFound if the key does not exist.
+func (s *Store) Get(ctx context.Context, id string) (*models.Chargeback, error) {
+	return s.chargebacks.Get(ctx, id)
 }
 
 // Create persists a new chargeback ONLY if one with the same ID does not
@@ -124,41 +713,104 @@ func (s *Store) Get(id string) (*models.Chargeback, error) {
 //
 // Returns (existing, false, nil) when the record already existed.
 // Returns (new, true, nil) when the record was successfully created.
-func (s *Store) Create(c *models.Chargeback) (*models.Chargeback, bool, error) {
-	var result models.Chargeback
-	created := false
-
-	err := s.db.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(bucketName))
+func (s *Store) Create(ctx context.Context, c *models.Chargeback) (*models.Chargeback, bool, error) {
+	return s.chargebacks.Create(ctx, c)
+}
 
-		// --- Idempotency check ---
-		// If the key already exists we return the stored value and skip the
-		// write. This is the core of POST idempotency: the same request ID
-		// always returns the same response regardless of retry count.
-		existing := b.Get([]byte(c.ID))
-		if existing != nil {
-			return json.Unmarshal(existing, &result)
-		}
+// Imported is the outcome of CreateMany.
+type Imported struct {
+	// Created holds the records inserted, as stored.
+	Created []models.Chargeback
+	// Skipped counts the records whose ID already existed.
+	Skipped int
+	// Failed holds the records Create would have refused – for a missing
+	// charge or merchant, or by the policy – by index in the input, with the
+	// error Create would have returned.
+	Failed map[int]error
+}
 
-		// First-time creation: stamp timestamps and persist.
-		now := time.Now().UTC()
-		c.CreatedAt = now
-		c.UpdatedAt = now
+// CreateMany applies Create semantics to every record in cs inside a single
+// transaction: records whose ID already exists, active or archived, are
+// skipped, the rest are inserted. Records Create would have refused are left
+// out and reported in the result's Failed; the rest are still inserted.
+//
+// Because existing keys are never overwritten, calling CreateMany repeatedly
+// with the same input is a no-op after the first call. Records with duplicate
+// IDs inside the same batch are treated the same way – the first one wins.
+//
+// A record with a non-zero CreatedAt keeps it, with UpdatedAt set to match,
+// so that generated or migrated data can carry its own history; the rest are
+// stamped with the current time.
+func (s *Store) CreateMany(ctx context.Context, cs []*models.Chargeback) (*Imported, error) {
+	_, span := startSpan(ctx, "store.CreateMany", "")
+	var res Imported
 
-		data, err := json.Marshal(c)
+	err := s.update(ctx, func(tx *bolt.Tx) error {
+		b, err := createTenantBucket(ctx, tx, bucketName)
 		if err != nil {
 			return err
 		}
+		now := now(ctx)
+
+		owner := OwnerFrom(ctx)
+		res = Imported{}
+		for i, c := range cs {
+			archived, err := s.chargebacks.archived(ctx, tx, c.ID)
+			if err != nil {
+				return err
+			}
+			if archived != nil || b.Get([]byte(c.ID)) != nil {
+				res.Skipped++
+				continue
+			}
 
-		result = *c
-		created = true
-		return b.Put([]byte(c.ID), data)
+			c.Owner = owner
+			if c.CreatedAt.IsZero() {
+				c.CreatedAt = now
+			}
+			c.UpdatedAt = c.CreatedAt
+			c.Version = 1
+
+			// The checks of chargebackChanged come before its writes, so a
+			// record they refuse leaves nothing behind.
+			err = s.chargebacks.change(ctx, tx, nil, c)
+			var verr *models.ValidationError
+			var perr *models.PolicyError
+			if errors.As(err, &verr) || errors.As(err, &perr) {
+				if res.Failed == nil {
+					res.Failed = map[int]error{}
+				}
+				res.Failed[i] = err
+				continue
+			}
+			if err != nil {
+				return err
+			}
+
+			data, err := s.encode(bucketName, c)
+			if err != nil {
+				return err
+			}
+			if err := b.Put([]byte(c.ID), data); err != nil {
+				return err
+			}
+			if err := s.chargebacks.index(ctx, tx, c); err != nil {
+				return err
+			}
+			res.Created = append(res.Created, *c)
+		}
+		if len(res.Created) == 0 {
+			return nil
+		}
+		return fence(ctx, tx)
 	})
+	span.SetAttributes(attribute.Int("import.created", len(res.Created)), attribute.Int("import.skipped", res.Skipped))
+	endSpan(span, err)
 	if err != nil {
-		return nil, false, err
+		return nil, err
 	}
 
-	return &result, created, nil
+	return &res, nil
 }
 
 // Update persists changes to an existing chargeback ONLY if the payload
@@ -174,71 +826,204 @@ func (s *Store) Create(c *models.Chargeback) (*models.Chargeback, bool, error) {
 // By comparing the incoming payload to the stored record before writing we
 // make PUT effectively idempotent: retrying with the same data is a no-op.
 //
+// Only the fields selected by mask are taken from incoming; a nil mask takes
+// them all. Write-avoidance compares the merged record, so a masked retry is
+// as cheap as a full one.
+//
 // Returns (updated, true, nil) when a write occurred.
 // Returns (existing, false, nil) when the payload was identical (write skipped).
-func (s *Store) Update(id string, incoming *models.Chargeback) (*models.Chargeback, bool, error) {
-	var result models.Chargeback
-	written := false
+func (s *Store) Update(ctx context.Context, id string, incoming *models.Chargeback, mask models.FieldMask) (*models.Chargeback, bool, error) {
+	return s.chargebacks.Update(ctx, id, func(c *models.Chargeback) { mask.Merge(c, incoming) })
+}
 
-	err := s.db.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(bucketName))
+// Delete removes a chargeback by ID.
+//
+// Idempotency guarantee: deleting a record that does not exist is not treated
+// as an error. This means a client can safely retry a DELETE without receiving
+// a spurious 404 on subsequent attempts. In distributed systems the initial
+// DELETE may succeed on the server but the client may never receive the
+// response – a retry is the only safe recovery strategy, and it must succeed.
+//
+// The returned bool reports whether a record was actually removed; it is
+// informational only and false on every retry.
+func (s *Store) Delete(ctx context.Context, id string) (bool, error) {
+	return s.chargebacks.Delete(ctx, id)
+}
 
-		existingBytes := b.Get([]byte(id))
-		if existingBytes == nil {
-			return ErrNotFound
-		}
+// Filter selects chargebacks for bulk operations. Zero-valued fields are
+// ignored, so an empty Filter matches every record.
+type Filter struct {
+	// Currency matches records with exactly this ISO 4217 code.
+	Currency string
 
-		var existing models.Chargeback
-		if err := json.Unmarshal(existingBytes, &existing); err != nil {
-			return err
-		}
+	// Before matches records whose CreatedAt is strictly earlier than this
+	// instant.
+	Before time.Time
+}
 
-		// --- Write-avoidance check ---
-		// Compare the mutable fields. If nothing changed we skip the write
-		// entirely and return the existing record. This is the write-avoidance
-		// form of idempotency: the same PUT payload is safe to retry any number
-		// of times.
-		if existing.Amount == incoming.Amount &&
-			existing.Currency == incoming.Currency &&
-			existing.Reason == incoming.Reason {
-			result = existing
+// IsZero reports whether the filter has no criteria set.
+func (f Filter) IsZero() bool {
+	return f.Currency == "" && f.Before.IsZero()
+}
+
+// Match reports whether c satisfies every criterion in the filter.
+func (f Filter) Match(c *models.Chargeback) bool {
+	if f.Currency != "" && c.Currency != f.Currency {
+		return false
+	}
+	if !f.Before.IsZero() && !c.CreatedAt.Before(f.Before) {
+		return false
+	}
+	return true
+}
+
+// DeleteMatching removes every chargeback matching f in a single transaction
+// and returns the records deleted, as they were before deletion.
+//
+// Idempotency guarantee: the desired end state is "no record matches f". A
+// retry after a successful call finds nothing to delete and returns no
+// records rather than an error, so clients can repeat the request safely.
+func (s *Store) DeleteMatching(ctx context.Context, f Filter) ([]models.Chargeback, error) {
+	_, span := startSpan(ctx, "store.DeleteMatching", "")
+	var deleted []models.Chargeback
+
+	err := s.update(ctx, func(tx *bolt.Tx) error {
+		deleted = nil
+		b := tenantBucket(ctx, tx, bucketName)
+		if b == nil {
 			return nil
 		}
 
-		// At least one field changed – apply the update and bump UpdatedAt.
-		existing.Amount = incoming.Amount
-		existing.Currency = incoming.Currency
-		existing.Reason = incoming.Reason
-		existing.UpdatedAt = time.Now().UTC()
-
-		data, err := json.Marshal(existing)
+		// Collect matches first: deleting while iterating with ForEach is
+		// not supported by Bolt and would skip entries.
+		var matches []models.Chargeback
+		err := b.ForEach(func(k, v []byte) error {
+			var c models.Chargeback
+			if err := s.decode(bucketName, v, &c); err != nil {
+				return err
+			}
+			if visible(ctx, &c) && f.Match(&c) {
+				matches = append(matches, c)
+			}
+			return nil
+		})
 		if err != nil {
 			return err
 		}
 
-		written = true
-		result = existing
-		return b.Put([]byte(id), data)
+		for i := range matches {
+			if err := b.Delete([]byte(matches[i].ID)); err != nil {
+				return err
+			}
+			if err := s.chargebacks.unindex(ctx, tx, &matches[i]); err != nil {
+				return err
+			}
+			if err := s.chargebacks.change(ctx, tx, &matches[i], nil); err != nil {
+				return err
+			}
+		}
+		deleted = matches
+		if len(deleted) == 0 {
+			return nil
+		}
+		return fence(ctx, tx)
 	})
+	span.SetAttributes(attribute.Int("chargeback.deleted", len(deleted)))
+	endSpan(span, err)
 	if err != nil {
-		return nil, false, err
+		return nil, err
 	}
 
-	return &result, written, nil
+	return deleted, nil
 }
 
-// Delete removes a chargeback by ID.
+type ownerKey struct{}
+
+// WithOwner returns a copy of ctx scoping store operations to owner, the ID of
+// the authenticated caller. Records created under an owner are only visible
+// to that same owner: idempotency keys are namespaced per client, so one
+// client cannot replay (and thereby read) another client's request. The
+// empty owner is the anonymous caller's, who sees only the records created
+// anonymously.
 //
-// Idempotency guarantee: deleting a record that does not exist is not treated
-// as an error. This means a client can safely retry a DELETE without receiving
-// a spurious 404 on subsequent attempts. In distributed systems the initial
-// DELETE may succeed on the server but the client may never receive the
-// response – a retry is the only safe recovery strategy, and it must succeed.
-func (s *Store) Delete(id string) error {
-	return s.db.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(bucketName))
-		// If the key does not exist bolt.Delete is a no-op, which is exactly
-		// the idempotent behaviour we want.
-		return b.Delete([]byte(id))
-	})
+// A context without an owner is unscoped and sees every record. Only the
+// server's own work and the admin routes run unscoped: the API's
+// authentication scopes every request, anonymous ones included.
+func WithOwner(ctx context.Context, owner string) context.Context {
+	return context.WithValue(ctx, ownerKey{}, owner)
+}
+
+// OwnerFrom returns the owner set by WithOwner, or "" when there is none;
+// Scoped tells the anonymous owner from an unscoped context.
+func OwnerFrom(ctx context.Context) string {
+	owner, _ := ctx.Value(ownerKey{}).(string)
+	return owner
+}
+
+// Scoped reports whether ctx is scoped to an owner, the anonymous one
+// included.
+func Scoped(ctx context.Context) bool {
+	_, ok := ctx.Value(ownerKey{}).(string)
+	return ok
+}
+
+type requestIDKey struct{}
+
+// WithRequestID returns a copy of ctx whose writes are stamped with id, the
+// ID of the request making them, on the records that keep one (see
+// models.Traced). It ties a stored record to the log lines of the request
+// that last wrote it.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFrom returns the request ID set by WithRequestID, or "".
+func RequestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// stampRequest stamps record with the request ID in ctx, if it keeps one.
+func stampRequest(ctx context.Context, record any) {
+	if t, ok := record.(models.Traced); ok {
+		t.SetRequestID(RequestIDFrom(ctx))
+	}
+}
+
+type timeKey struct{}
+
+// WithTime returns a copy of ctx whose writes are stamped with t rather than
+// the current time. A replicated store uses it to make every replica stamp a
+// record the same way when it applies the same write.
+func WithTime(ctx context.Context, t time.Time) context.Context {
+	return context.WithValue(ctx, timeKey{}, t.UTC())
+}
+
+// TimeFrom returns the time writes made with ctx are stamped with: the one
+// set by WithTime, or the current time.
+func TimeFrom(ctx context.Context) time.Time {
+	return now(ctx)
+}
+
+// now returns the time writes made with ctx are stamped with.
+func now(ctx context.Context) time.Time {
+	if t, ok := ctx.Value(timeKey{}).(time.Time); ok {
+		return t
+	}
+	return time.Now().UTC()
+}
+
+// visible reports whether c can be seen by the owner in ctx. Unscoped
+// contexts see every record.
+func visible(ctx context.Context, c *models.Chargeback) bool {
+	return visibleTo(ctx, c.Owner)
+}
+
+// outcome picks the span attribute value describing which path an operation
+// took.
+func outcome(cond bool, yes, no string) string {
+	if cond {
+		return yes
+	}
+	return no
 }
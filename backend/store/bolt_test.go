@@ -1,14 +1,22 @@
 package store_test
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/arkantrust/idempotency-example/backend/models"
 	"github.com/arkantrust/idempotency-example/backend/store"
 )
 
+var ctx = context.Background()
+
 func newTestStore(t *testing.T) *store.Store {
 	t.Helper()
 	dir := t.TempDir()
@@ -22,7 +30,7 @@ func newTestStore(t *testing.T) *store.Store {
 
 func TestListEmpty(t *testing.T) {
 	s := newTestStore(t)
-	items, err := s.List()
+	items, err := s.List(ctx)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -42,7 +50,7 @@ func TestCreateIdempotency(t *testing.T) {
 	}
 
 	// First call – should create.
-	first, created, err := s.Create(cb)
+	first, created, err := s.Create(ctx, cb)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -54,7 +62,7 @@ func TestCreateIdempotency(t *testing.T) {
 	}
 
 	// Second call with same ID – should return existing, no write.
-	second, created, err := s.Create(cb)
+	second, created, err := s.Create(ctx, cb)
 	if err != nil {
 		t.Fatalf("unexpected error on retry: %v", err)
 	}
@@ -78,11 +86,11 @@ func TestUpdateWriteAvoidance(t *testing.T) {
 		Currency: "EUR",
 		Reason:   "fraudulent",
 	}
-	original, _, _ := s.Create(cb)
+	original, _, _ := s.Create(ctx, cb)
 
 	// Update with identical payload – no write should occur.
 	same := &models.Chargeback{Amount: 500, Currency: "EUR", Reason: "fraudulent"}
-	result, written, err := s.Update("test-id-2", same)
+	result, written, err := s.Update(ctx, "test-id-2", same, nil)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -92,24 +100,50 @@ func TestUpdateWriteAvoidance(t *testing.T) {
 	if !result.UpdatedAt.Equal(original.UpdatedAt) {
 		t.Fatal("updatedAt should not change when write is skipped")
 	}
+	if original.Version != 1 || result.Version != 1 {
+		t.Fatalf("expected version 1 after create and a skipped write, got %d and %d", original.Version, result.Version)
+	}
 
 	// Update with different payload – write should occur.
 	changed := &models.Chargeback{Amount: 999, Currency: "EUR", Reason: "fraudulent"}
-	result2, written2, err := s.Update("test-id-2", changed)
+	result2, written2, err := s.Update(ctx, "test-id-2", changed, nil)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
 	if !written2 {
 		t.Fatal("expected written=true when payload differs")
 	}
-	if result2.Amount != 999 {
-		t.Fatalf("expected amount=999, got %d", result2.Amount)
+	if result2.Amount != 999 || result2.Version != 2 {
+		t.Fatalf("expected amount=999 at version 2, got %d at %d", result2.Amount, result2.Version)
+	}
+}
+
+func TestWritesKeepRequestID(t *testing.T) {
+	s := newTestStore(t)
+
+	cb := &models.Chargeback{ID: "cb-1", Amount: 500, Currency: "EUR", Reason: "fraud", RequestID: "forged"}
+	created, _, err := s.Create(store.WithRequestID(ctx, "req-1"), cb)
+	if err != nil || created.RequestID != "req-1" {
+		t.Fatalf("expected the create stamped with its request ID, got %+v, %v", created, err)
+	}
+
+	// A skipped write keeps the request ID of the last real one.
+	same := &models.Chargeback{Amount: 500, Currency: "EUR", Reason: "fraud"}
+	if got, _, err := s.Update(store.WithRequestID(ctx, "req-2"), "cb-1", same, nil); err != nil || got.RequestID != "req-1" {
+		t.Fatalf("expected a skipped write to keep req-1, got %+v, %v", got, err)
+	}
+	changed := &models.Chargeback{Amount: 999, Currency: "EUR", Reason: "fraud"}
+	if _, _, err := s.Update(store.WithRequestID(ctx, "req-3"), "cb-1", changed, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got, err := s.Get(ctx, "cb-1"); err != nil || got.RequestID != "req-3" {
+		t.Fatalf("expected the stored record stamped with req-3, got %+v, %v", got, err)
 	}
 }
 
 func TestUpdateNotFound(t *testing.T) {
 	s := newTestStore(t)
-	_, _, err := s.Update("nonexistent", &models.Chargeback{})
+	_, _, err := s.Update(ctx, "nonexistent", &models.Chargeback{}, nil)
 	if err == nil {
 		t.Fatal("expected error for missing record")
 	}
@@ -125,22 +159,30 @@ func TestDeleteIdempotency(t *testing.T) {
 	s := newTestStore(t)
 
 	cb := &models.Chargeback{ID: "del-id", Amount: 100, Currency: "USD", Reason: "test"}
-	_, _, _ = s.Create(cb)
+	_, _, _ = s.Create(ctx, cb)
 
 	// First delete – record exists.
-	if err := s.Delete("del-id"); err != nil {
+	existed, err := s.Delete(ctx, "del-id")
+	if err != nil {
 		t.Fatalf("unexpected error on first delete: %v", err)
 	}
+	if !existed {
+		t.Fatal("expected existed=true on first delete")
+	}
 
 	// Second delete – record already gone, should still succeed.
-	if err := s.Delete("del-id"); err != nil {
+	existed, err = s.Delete(ctx, "del-id")
+	if err != nil {
 		t.Fatalf("unexpected error on second delete: %v", err)
 	}
+	if existed {
+		t.Fatal("expected existed=false on second delete")
+	}
 }
 
 func TestGetNotFound(t *testing.T) {
 	s := newTestStore(t)
-	_, err := s.Get("missing")
+	_, err := s.Get(ctx, "missing")
 	if err == nil {
 		t.Fatal("expected ErrNotFound")
 	}
@@ -148,3 +190,587 @@ func TestGetNotFound(t *testing.T) {
 		t.Fatalf("expected ErrNotFound, got %v", err)
 	}
 }
+
+func TestDeleteMatchingIdempotency(t *testing.T) {
+	s := newTestStore(t)
+
+	for _, cb := range []*models.Chargeback{
+		{ID: "usd-1", Amount: 100, Currency: "USD", Reason: "a"},
+		{ID: "usd-2", Amount: 200, Currency: "USD", Reason: "b"},
+		{ID: "eur-1", Amount: 300, Currency: "EUR", Reason: "c"},
+	} {
+		if _, _, err := s.Create(ctx, cb); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	f := store.Filter{Currency: "USD", Before: time.Now().Add(time.Hour)}
+
+	// First call – removes the two USD records.
+	deleted, err := s.DeleteMatching(ctx, f)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(deleted) != 2 || deleted[0].Currency != "USD" || deleted[1].Currency != "USD" {
+		t.Fatalf("expected the 2 USD records deleted, got %+v", deleted)
+	}
+
+	// Retry – nothing left to delete, still succeeds.
+	deleted, err = s.DeleteMatching(ctx, f)
+	if err != nil {
+		t.Fatalf("unexpected error on retry: %v", err)
+	}
+	if len(deleted) != 0 {
+		t.Fatalf("expected 0 deleted on retry, got %d", len(deleted))
+	}
+
+	items, _ := s.List(ctx)
+	if len(items) != 1 || items[0].ID != "eur-1" {
+		t.Fatalf("expected only eur-1 to remain, got %+v", items)
+	}
+}
+
+func TestCreateManyIdempotency(t *testing.T) {
+	s := newTestStore(t)
+
+	batch := func() []*models.Chargeback {
+		return []*models.Chargeback{
+			{ID: "imp-1", Amount: 100, Currency: "USD", Reason: "a"},
+			{ID: "imp-2", Amount: 200, Currency: "USD", Reason: "b"},
+			{ID: "imp-1", Amount: 999, Currency: "USD", Reason: "dup in batch"},
+		}
+	}
+
+	res, err := s.CreateMany(ctx, batch())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(res.Created) != 2 || res.Skipped != 1 || res.Created[0].Version != 1 {
+		t.Fatalf("expected 2 created at version 1 and 1 skipped, got %+v", res)
+	}
+
+	// Re-running the same batch must be a no-op.
+	res, err = s.CreateMany(ctx, batch())
+	if err != nil {
+		t.Fatalf("unexpected error on retry: %v", err)
+	}
+	if len(res.Created) != 0 || res.Skipped != 3 {
+		t.Fatalf("expected created=0 skipped=3, got created=%d skipped=%d", len(res.Created), res.Skipped)
+	}
+
+	got, err := s.Get(ctx, "imp-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.Amount != 100 {
+		t.Fatalf("expected first record in batch to win, got amount=%d", got.Amount)
+	}
+
+	// A record that carries its own creation time keeps it.
+	then := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	if _, err := s.CreateMany(ctx, []*models.Chargeback{{ID: "imp-3", Amount: 300, Currency: "USD", Reason: "c", CreatedAt: then}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got, err := s.Get(ctx, "imp-3"); err != nil || !got.CreatedAt.Equal(then) || !got.UpdatedAt.Equal(then) {
+		t.Fatalf("expected timestamps %v, got %+v (err %v)", then, got, err)
+	}
+}
+
+func TestForEachKeyOrder(t *testing.T) {
+	s := newTestStore(t)
+
+	for _, id := range []string{"c", "a", "b"} {
+		_, _, _ = s.Create(ctx, &models.Chargeback{ID: id, Amount: 1, Currency: "USD", Reason: "x"})
+	}
+
+	var got []string
+	err := s.ForEach(ctx, func(c models.Chargeback) error {
+		got = append(got, c.ID)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(got) != 3 || got[0] != "a" || got[1] != "b" || got[2] != "c" {
+		t.Fatalf("expected [a b c], got %v", got)
+	}
+}
+
+func TestBackupRoundTrip(t *testing.T) {
+	s := newTestStore(t)
+	_, _, _ = s.Create(ctx, &models.Chargeback{ID: "bk-1", Amount: 42, Currency: "USD", Reason: "backup"})
+
+	path := filepath.Join(t.TempDir(), "backup.db")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("failed to create backup file: %v", err)
+	}
+	if _, err := s.Backup(ctx, f); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	f.Close()
+
+	restored, err := store.New(path)
+	if err != nil {
+		t.Fatalf("failed to open backup: %v", err)
+	}
+	defer restored.Close()
+
+	got, err := restored.Get(ctx, "bk-1")
+	if err != nil {
+		t.Fatalf("expected record in backup: %v", err)
+	}
+	if got.Amount != 42 {
+		t.Fatalf("expected amount=42, got %d", got.Amount)
+	}
+}
+
+func TestRestoreSwapsInSnapshot(t *testing.T) {
+	dir := t.TempDir()
+
+	// Build a snapshot containing a single record.
+	src, err := store.New(filepath.Join(dir, "src.db"))
+	if err != nil {
+		t.Fatalf("failed to open source store: %v", err)
+	}
+	_, _, _ = src.Create(ctx, &models.Chargeback{ID: "from-snapshot", Amount: 7, Currency: "USD", Reason: "r"})
+	snapshot := filepath.Join(dir, "snapshot.db")
+	f, _ := os.Create(snapshot)
+	if _, err := src.Backup(ctx, f); err != nil {
+		t.Fatalf("unexpected backup error: %v", err)
+	}
+	f.Close()
+	src.Close()
+
+	s := newTestStore(t)
+	_, _, _ = s.Create(ctx, &models.Chargeback{ID: "live-only", Amount: 1, Currency: "USD", Reason: "r"})
+
+	if err := s.Restore(ctx, snapshot); err != nil {
+		t.Fatalf("unexpected restore error: %v", err)
+	}
+
+	if _, err := s.Get(ctx, "from-snapshot"); err != nil {
+		t.Fatalf("expected snapshot record after restore: %v", err)
+	}
+	if _, err := s.Get(ctx, "live-only"); err != store.ErrNotFound {
+		t.Fatalf("expected live-only record to be gone, got %v", err)
+	}
+}
+
+func TestRestoreRejectsInvalidSnapshot(t *testing.T) {
+	s := newTestStore(t)
+	_, _, _ = s.Create(ctx, &models.Chargeback{ID: "keep-me", Amount: 1, Currency: "USD", Reason: "r"})
+
+	bad := filepath.Join(t.TempDir(), "bad.db")
+	if err := os.WriteFile(bad, []byte("not a bolt file"), 0600); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	err := s.Restore(ctx, bad)
+	if !errors.Is(err, store.ErrInvalidSnapshot) {
+		t.Fatalf("expected ErrInvalidSnapshot, got %v", err)
+	}
+	if _, err := s.Get(ctx, "keep-me"); err != nil {
+		t.Fatalf("live data must survive a rejected restore: %v", err)
+	}
+}
+
+func TestCompactPreservesData(t *testing.T) {
+	s := newTestStore(t)
+
+	for i := 0; i < 500; i++ {
+		id := fmt.Sprintf("cmp-%03d", i)
+		_, _, _ = s.Create(ctx, &models.Chargeback{ID: id, Amount: int64(i), Currency: "USD", Reason: "compaction test"})
+	}
+	if _, err := s.DeleteMatching(ctx, store.Filter{Currency: "USD"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_, _, _ = s.Create(ctx, &models.Chargeback{ID: "survivor", Amount: 1, Currency: "EUR", Reason: "r"})
+
+	st, err := s.Compact(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if st.After > st.Before {
+		t.Fatalf("expected file not to grow, before=%d after=%d", st.Before, st.After)
+	}
+
+	items, err := s.List(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error after compaction: %v", err)
+	}
+	if len(items) != 1 || items[0].ID != "survivor" {
+		t.Fatalf("expected only survivor after compaction, got %+v", items)
+	}
+}
+
+func TestCompactDoesNotStallReaders(t *testing.T) {
+	s := newTestStore(t)
+	_, _, _ = s.Create(ctx, &models.Chargeback{ID: "a", Amount: 1, Currency: "USD", Reason: "r"})
+
+	// A slow client holds a read transaction open while it streams.
+	streaming, release := make(chan struct{}), make(chan struct{})
+	go s.ForEach(ctx, func(models.Chargeback) error {
+		close(streaming)
+		<-release
+		return nil
+	})
+	<-streaming
+	defer close(release)
+
+	compacted := make(chan error)
+	go func() {
+		cctx, cancel := context.WithTimeout(ctx, 200*time.Millisecond)
+		defer cancel()
+		_, err := s.Compact(cctx)
+		compacted <- err
+	}()
+
+	// Compaction waiting for the lock does not hold up other reads.
+	time.Sleep(20 * time.Millisecond)
+	if _, err := s.Get(ctx, "a"); err != nil {
+		t.Fatalf("read while compaction waits: %v", err)
+	}
+	if err := <-compacted; !errors.Is(err, store.ErrTimeout) {
+		t.Fatalf("compact during a stream: %v, want ErrTimeout", err)
+	}
+}
+
+func TestOwnerScoping(t *testing.T) {
+	s := newTestStore(t)
+	alice := store.WithOwner(ctx, "alice")
+	bob := store.WithOwner(ctx, "bob")
+
+	if _, _, err := s.Create(alice, &models.Chargeback{ID: "cb-1", Amount: 100, Currency: "USD"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Bob reusing Alice's key must not get her record back as a replay.
+	if _, _, err := s.Create(bob, &models.Chargeback{ID: "cb-1", Amount: 999, Currency: "USD"}); !errors.Is(err, store.ErrKeyConflict) {
+		t.Fatalf("expected ErrKeyConflict, got %v", err)
+	}
+
+	items, err := s.List(bob)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(items) != 0 {
+		t.Fatalf("expected bob to see no records, got %d", len(items))
+	}
+	if _, err := s.Get(bob, "cb-1"); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound for another owner's record, got %v", err)
+	}
+
+	// Bob's delete is a no-op; Alice's record survives.
+	existed, err := s.Delete(bob, "cb-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if existed {
+		t.Fatal("expected existed=false when deleting another owner's record")
+	}
+	got, err := s.Get(alice, "cb-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.Owner != "alice" || got.Amount != 100 {
+		t.Fatalf("alice's record was modified: %+v", got)
+	}
+
+	// Anonymous callers see only the records created anonymously, and
+	// unscoped ones see them all.
+	anonymous := store.WithOwner(ctx, "")
+	if _, _, err := s.Create(anonymous, &models.Chargeback{ID: "cb-2", Amount: 200, Currency: "USD"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := s.Get(anonymous, "cb-1"); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound for an anonymous caller, got %v", err)
+	}
+	if _, _, err := s.Create(anonymous, &models.Chargeback{ID: "cb-1", Amount: 100, Currency: "USD"}); !errors.Is(err, store.ErrKeyConflict) {
+		t.Fatalf("expected an anonymous replay of alice's key to conflict, got %v", err)
+	}
+	if items, err := s.List(anonymous); err != nil || len(items) != 1 || items[0].ID != "cb-2" {
+		t.Fatalf("expected an anonymous caller to list cb-2 alone, got %v, %v", items, err)
+	}
+	if items, err := s.List(ctx); err != nil || len(items) != 2 {
+		t.Fatalf("expected an unscoped caller to list both records, got %v, %v", items, err)
+	}
+}
+
+func TestCreateWithKeyIdempotency(t *testing.T) {
+	s := newTestStore(t)
+
+	first, created, err := s.CreateWithKey(ctx, "key-1", &models.Chargeback{ID: models.NewID(), Amount: 100, Currency: "USD", Reason: "fraud"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !created {
+		t.Fatal("expected created=true on first call")
+	}
+
+	// A retry mints a fresh ID, but the key maps it back to the first record.
+	second, created, err := s.CreateWithKey(ctx, "key-1", &models.Chargeback{ID: models.NewID(), Amount: 100, Currency: "USD", Reason: "fraud"})
+	if err != nil {
+		t.Fatalf("unexpected error on retry: %v", err)
+	}
+	if created || second.ID != first.ID {
+		t.Fatalf("expected replay of %q, got created=%v id=%q", first.ID, created, second.ID)
+	}
+
+	if _, _, err := s.CreateWithKey(ctx, "key-1", &models.Chargeback{ID: models.NewID(), Amount: 999, Currency: "USD", Reason: "fraud"}); !errors.Is(err, store.ErrKeyReused) {
+		t.Fatalf("expected ErrKeyReused, got %v", err)
+	}
+
+	// Keys are scoped per owner.
+	_, created, err = s.CreateWithKey(store.WithOwner(ctx, "bob"), "key-1", &models.Chargeback{ID: models.NewID(), Amount: 100, Currency: "USD", Reason: "fraud"})
+	if err != nil || !created {
+		t.Fatalf("expected a new record for another owner, got created=%v err=%v", created, err)
+	}
+
+	items, err := s.List(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(items) != 2 {
+		t.Fatalf("expected 2 records, got %d", len(items))
+	}
+
+	keys, _, err := s.IdempotencyKeys(ctx, store.KeyQuery{Prefix: "key-"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(keys) != 2 || keys[0].Owner != "" || keys[1].Owner != "bob" || keys[0].RecordID != first.ID {
+		t.Fatalf("expected key-1 for both owners, got %+v", keys)
+	}
+}
+
+func TestUpdateFieldMask(t *testing.T) {
+	s := newTestStore(t)
+	if _, _, err := s.Create(ctx, &models.Chargeback{ID: "cb-1", Amount: 100, Currency: "USD", Reason: "fraud"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Only amount is taken from the payload; the empty currency and reason
+	// are ignored.
+	mask := models.FieldMask{"amount"}
+	got, written, err := s.Update(ctx, "cb-1", &models.Chargeback{Amount: 250}, mask)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !written {
+		t.Fatal("expected written=true for a changed amount")
+	}
+	if got.Amount != 250 || got.Currency != "USD" || got.Reason != "fraud" {
+		t.Fatalf("expected only amount to change, got %+v", got)
+	}
+
+	// Retrying the same masked update compares the merged record and skips
+	// the write.
+	_, written, err = s.Update(ctx, "cb-1", &models.Chargeback{Amount: 250}, mask)
+	if err != nil {
+		t.Fatalf("unexpected error on retry: %v", err)
+	}
+	if written {
+		t.Fatal("expected written=false for a repeated masked update")
+	}
+}
+
+func TestTenantIsolation(t *testing.T) {
+	s := newTestStore(t)
+	acme := store.WithTenant(ctx, "acme")
+	globex := store.WithTenant(ctx, "globex")
+
+	// The same ID and the same idempotency key create independent records in
+	// each tenant.
+	for _, tc := range []context.Context{ctx, acme, globex} {
+		if _, created, err := s.Create(tc, &models.Chargeback{ID: "cb-1", Amount: 100, Currency: "USD", Reason: "fraud"}); err != nil || !created {
+			t.Fatalf("expected create in %q, got created=%v err=%v", store.TenantFrom(tc), created, err)
+		}
+		if _, created, err := s.CreateWithKey(tc, "key-1", &models.Chargeback{ID: models.NewID(), Amount: 50, Currency: "EUR", Reason: "fraud"}); err != nil || !created {
+			t.Fatalf("expected keyed create in %q, got created=%v err=%v", store.TenantFrom(tc), created, err)
+		}
+	}
+
+	if _, _, err := s.Update(acme, "cb-1", &models.Chargeback{Amount: 999, Currency: "USD", Reason: "fraud"}, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got, err := s.Get(globex, "cb-1")
+	if err != nil || got.Amount != 100 {
+		t.Fatalf("expected globex record untouched, got %+v err=%v", got, err)
+	}
+
+	if _, err := s.Get(store.WithTenant(ctx, "initech"), "cb-1"); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound in an unused tenant, got %v", err)
+	}
+	if existed, err := s.Delete(store.WithTenant(ctx, "initech"), "cb-1"); err != nil || existed {
+		t.Fatalf("expected no-op delete in an unused tenant, got existed=%v err=%v", existed, err)
+	}
+
+	stats, err := s.Stats(acme)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if stats.Tenant != "acme" || stats.Count != 2 || len(stats.ByCurrency) != 2 ||
+		stats.ByCurrency[0].Currency != "EUR" || stats.ByCurrency[1].Amount != 999 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+
+	items, err := s.List(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(items) != 2 {
+		t.Fatalf("expected 2 records in the default tenant, got %d", len(items))
+	}
+}
+
+func TestWithTxIsAtomic(t *testing.T) {
+	s := newTestStore(t)
+	for _, id := range []string{"keep", "drop"} {
+		if _, _, err := s.Create(ctx, &models.Chargeback{ID: id, Amount: 100, Currency: "USD", Reason: "fraud"}); err != nil {
+			t.Fatalf("create %s failed: %v", id, err)
+		}
+	}
+
+	ops := func(tx store.Tx) error {
+		if _, created, err := tx.Create(&models.Chargeback{ID: "new", Amount: 200, Currency: "EUR", Reason: "fraud"}); err != nil || !created {
+			return fmt.Errorf("create: %v %v", created, err)
+		}
+		if _, written, err := tx.Update("keep", &models.Chargeback{Amount: 300, Currency: "USD", Reason: "fraud"}, nil); err != nil || !written {
+			return fmt.Errorf("update: %v %v", written, err)
+		}
+		if existed, err := tx.Delete("drop"); err != nil || !existed {
+			return fmt.Errorf("delete: %v %v", existed, err)
+		}
+		// The transaction sees its own writes.
+		if _, err := tx.Get("new"); err != nil {
+			return fmt.Errorf("get: %v", err)
+		}
+		return nil
+	}
+
+	// A failing transaction leaves no trace.
+	errAbort := errors.New("abort")
+	err := s.WithTx(ctx, func(tx store.Tx) error {
+		if err := ops(tx); err != nil {
+			return err
+		}
+		return errAbort
+	})
+	if !errors.Is(err, errAbort) {
+		t.Fatalf("expected the abort error, got %v", err)
+	}
+	if _, err := s.Get(ctx, "new"); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("expected the create to be rolled back, got %v", err)
+	}
+	if got, _ := s.Get(ctx, "keep"); got.Amount != 100 {
+		t.Fatalf("expected the update to be rolled back, got amount %d", got.Amount)
+	}
+	if _, err := s.Get(ctx, "drop"); err != nil {
+		t.Fatalf("expected the delete to be rolled back, got %v", err)
+	}
+
+	// A successful one applies everything.
+	if err := s.WithTx(ctx, ops); err != nil {
+		t.Fatalf("transaction failed: %v", err)
+	}
+	items, _ := s.List(ctx)
+	if len(items) != 2 {
+		t.Fatalf("expected 2 records after commit, got %d", len(items))
+	}
+	if got, _ := s.Get(ctx, "keep"); got.Amount != 300 {
+		t.Fatalf("expected the update to commit, got amount %d", got.Amount)
+	}
+}
+
+func TestBatchingKeepsIdempotency(t *testing.T) {
+	s := newTestStore(t)
+	s.SetBatching(64, 5*time.Millisecond)
+
+	// Every ID is created by several concurrent requests, which land in the
+	// same batches; exactly one of them may report a creation.
+	const ids, dups = 50, 4
+	var created atomic.Int32
+	var wg sync.WaitGroup
+	for i := range ids * dups {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cb := &models.Chargeback{ID: fmt.Sprintf("cb-%d", i%ids), Amount: 100, Currency: "USD", Reason: "fraud"}
+			_, ok, err := s.Create(ctx, cb)
+			if err != nil {
+				t.Errorf("create failed: %v", err)
+			}
+			if ok {
+				created.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	items, _ := s.List(ctx)
+	if len(items) != ids || created.Load() != ids {
+		t.Fatalf("expected %d records created once each, got %d records and %d creations", ids, len(items), created.Load())
+	}
+
+	// A failing write in a batch does not roll back the others.
+	if _, _, err := s.Create(store.WithOwner(ctx, "someone-else"), &models.Chargeback{ID: "cb-0"}); !errors.Is(err, store.ErrKeyConflict) {
+		t.Fatalf("expected a key conflict, got %v", err)
+	}
+}
+
+// BenchmarkCreateParallel compares concurrent creates committed one per
+// transaction with creates coalesced by SetBatching. Each commit fsyncs, so
+// batching wins by roughly the number of writes per batch.
+func BenchmarkCreateParallel(b *testing.B) {
+	for _, bc := range []struct {
+		name string
+		size int
+	}{{"unbatched", 0}, {"batched", 256}} {
+		b.Run(bc.name, func(b *testing.B) {
+			s, err := store.New(filepath.Join(b.TempDir(), "bench.db"))
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer s.Close()
+			s.SetBatching(bc.size, 2*time.Millisecond)
+
+			var n atomic.Int64
+			b.SetParallelism(32)
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					cb := &models.Chargeback{ID: fmt.Sprintf("cb-%d", n.Add(1)), Amount: 100, Currency: "USD", Reason: "fraud"}
+					if _, _, err := s.Create(ctx, cb); err != nil {
+						b.Error(err)
+						return
+					}
+				}
+			})
+		})
+	}
+}
+
+func TestRemoveChecksInTransaction(t *testing.T) {
+	s := newTestStore(t)
+	c := store.NewCollection[models.Chargeback](s, "chargebacks", "chargeback", func(a, b *models.Chargeback) bool { return *a == *b })
+	if _, _, err := s.Create(ctx, &models.Chargeback{ID: "cb-1", Amount: 100, Currency: "USD"}); err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+
+	isEUR := func(cb *models.Chargeback) bool { return cb.Currency == "EUR" }
+	if _, err := c.Remove(ctx, "cb-1", isEUR); !errors.Is(err, store.ErrPreconditionFailed) {
+		t.Fatalf("expected ErrPreconditionFailed, got %v", err)
+	}
+	if _, err := s.Get(ctx, "cb-1"); err != nil {
+		t.Fatalf("expected the record kept, got %v", err)
+	}
+
+	removed, err := c.Remove(ctx, "cb-1", func(cb *models.Chargeback) bool { return cb.Amount == 100 })
+	if err != nil || removed == nil || removed.ID != "cb-1" {
+		t.Fatalf("expected the removed record, got %+v %v", removed, err)
+	}
+	if removed, err := c.Remove(ctx, "cb-1", isEUR); err != nil || removed != nil {
+		t.Fatalf("expected a missing record to be a no-op, got %+v %v", removed, err)
+	}
+}
@@ -0,0 +1,188 @@
+// Package breaker guards the chargeback operations of a backend with a
+// circuit breaker, so that a failing disk is not hammered by every request
+// while it fails, and requests fail at once instead of each waiting out the
+// failure.
+//
+// The breaker is closed at first, and counts the operations that fail in a
+// row on the store itself – an error of no kind (see store.ErrConflict), or
+// a timeout. After Policy.Failures of them it opens: every operation fails
+// at once with store.ErrCircuitOpen, which the APIs answer with 503 and
+// Retry-After. After Policy.Cooldown it is half-open: one operation is let
+// through to try the store, and closes the breaker if it succeeds or opens
+// it again if it fails. Errors about the operation rather than the store –
+// a missing record, a conflict, invalid input, a read-only mode, a
+// cancelled request – neither count nor reset the count.
+//
+// The state is exported as the store_circuit_state metric and reported by
+// GET /healthz.
+package breaker
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/arkantrust/idempotency-example/backend/metrics"
+	"github.com/arkantrust/idempotency-example/backend/service"
+	"github.com/arkantrust/idempotency-example/backend/store"
+)
+
+// Policy configures a Breaker.
+type Policy struct {
+	// Failures is how many operations must fail in a row to open the
+	// breaker.
+	Failures int
+
+	// Cooldown is how long the breaker stays open before letting an
+	// operation through to try the store again.
+	Cooldown time.Duration
+}
+
+// States of a Breaker, as State reports them.
+const (
+	Closed   = "closed"
+	HalfOpen = "half-open"
+	Open     = "open"
+)
+
+// Breaker is the state of a circuit breaker.
+type Breaker struct {
+	p   Policy
+	now func() time.Time
+
+	mu       sync.Mutex
+	state    string
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// NewBreaker returns a closed Breaker opening as p says.
+func NewBreaker(p Policy) *Breaker {
+	metrics.StoreCircuitState.Set(0)
+	return &Breaker{p: p, now: time.Now, state: Closed}
+}
+
+// State reports whether the breaker is Closed, HalfOpen or Open.
+func (b *Breaker) State() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == Open && !b.now().Before(b.openedAt.Add(b.p.Cooldown)) {
+		return HalfOpen
+	}
+	return b.state
+}
+
+// allow returns store.ErrCircuitOpen unless an operation may try the store
+// now. An operation allowed while half-open is the one probe, and must
+// report its outcome with done.
+func (b *Breaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == Open && !b.now().Before(b.openedAt.Add(b.p.Cooldown)) {
+		b.set(HalfOpen)
+	}
+	switch {
+	case b.state == Closed:
+		return nil
+	case b.state == HalfOpen && !b.probing:
+		b.probing = true
+		return nil
+	}
+	metrics.StoreCircuitRejections.Inc()
+	return store.ErrCircuitOpen
+}
+
+// done records the outcome of an operation allow let through.
+func (b *Breaker) done(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	probe := b.state == HalfOpen && b.probing
+	if probe {
+		b.probing = false
+	}
+	// An operation let through before the breaker opened may finish after;
+	// only a probe closes an open breaker. A probe telling nothing about the
+	// store leaves the next operation to probe again.
+	switch {
+	case failed(err):
+		b.failures++
+		if probe || b.state == Closed && b.failures >= b.p.Failures {
+			b.openedAt = b.now()
+			b.set(Open)
+		}
+	case (err == nil || answered(err)) && (probe || b.state == Closed):
+		b.failures = 0
+		b.set(Closed)
+	}
+}
+
+func (b *Breaker) set(state string) {
+	b.state = state
+	switch state {
+	case Closed:
+		metrics.StoreCircuitState.Set(0)
+	case HalfOpen:
+		metrics.StoreCircuitState.Set(1)
+	case Open:
+		metrics.StoreCircuitState.Set(2)
+	}
+}
+
+// failed reports whether err is a failure of the store itself.
+func failed(err error) bool {
+	switch {
+	case err == nil, answered(err), errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return false
+	case errors.Is(err, store.ErrTimeout):
+		return true
+	}
+	// The store's other unavailable errors are its mode refusing the
+	// operation.
+	return !errors.Is(err, store.ErrUnavailable)
+}
+
+// answered reports whether err refused the operation on its merits: the
+// store answered it, so it works.
+func answered(err error) bool {
+	return errors.Is(err, store.ErrNotFound) || errors.Is(err, store.ErrConflict) ||
+		errors.Is(err, store.ErrValidation) || errors.Is(err, store.ErrTooLarge)
+}
+
+// guard is the Policy of a Backend guarding the operations of b with c.
+type guard struct {
+	b service.Backend
+	c *Breaker
+}
+
+// New returns a Backend guarding the operations of b with c.
+func New(b service.Backend, c *Breaker) service.Backend {
+	return service.Decorate(guard{b: b, c: c})
+}
+
+// Do runs call if the breaker allows, recording its outcome.
+func (g guard) Do(ctx context.Context, op service.Op, call func(context.Context, service.Backend) (any, error)) (any, error) {
+	if err := g.c.allow(); err != nil {
+		return nil, err
+	}
+	v, err := call(ctx, g.b)
+	g.c.done(err)
+	return v, err
+}
+
+// Walk walks as Do runs call. An error returned by the caller's function is
+// the caller's, not the store's, and is not recorded as a failure.
+func (g guard) Walk(ctx context.Context, op string, walk func(service.Backend, *service.Walked) error) error {
+	if err := g.c.allow(); err != nil {
+		return err
+	}
+	var w service.Walked
+	err := walk(g.b, &w)
+	if err != nil && err == w.Err {
+		g.c.done(nil)
+	} else {
+		g.c.done(err)
+	}
+	return err
+}
@@ -0,0 +1,105 @@
+package breaker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/arkantrust/idempotency-example/backend/models"
+	"github.com/arkantrust/idempotency-example/backend/service"
+	"github.com/arkantrust/idempotency-example/backend/store"
+)
+
+var ctx = context.Background()
+
+var errDisk = errors.New("input/output error")
+
+// fake is a backend whose Get fails with err.
+type fake struct {
+	service.Backend
+	err   error
+	calls int
+}
+
+func (f *fake) Get(_ context.Context, id string) (*models.Chargeback, error) {
+	f.calls++
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &models.Chargeback{ID: id}, nil
+}
+
+// newTestBackend returns a backend guarding f, and a function moving its
+// breaker's clock forward.
+func newTestBackend(f *fake) (service.Backend, *Breaker, func(time.Duration)) {
+	c := NewBreaker(Policy{Failures: 3, Cooldown: time.Minute})
+	now := time.Now()
+	c.now = func() time.Time { return now }
+	return New(f, c), c, func(d time.Duration) { now = now.Add(d) }
+}
+
+func TestOpensAfterConsecutiveFailures(t *testing.T) {
+	f := &fake{err: errDisk}
+	b, c, _ := newTestBackend(f)
+	for range 3 {
+		if _, err := b.Get(ctx, "cb-1"); !errors.Is(err, errDisk) {
+			t.Fatalf("get: err = %v, want the disk's", err)
+		}
+	}
+	if _, err := b.Get(ctx, "cb-1"); !errors.Is(err, store.ErrCircuitOpen) || !errors.Is(err, store.ErrUnavailable) || f.calls != 3 {
+		t.Fatalf("get: err = %v after %d calls; want the open circuit after 3", err, f.calls)
+	}
+	if c.State() != Open {
+		t.Errorf("state = %s, want open", c.State())
+	}
+}
+
+func TestIgnoresErrorsOfTheOperation(t *testing.T) {
+	f := &fake{err: store.ErrNotFound}
+	b, c, _ := newTestBackend(f)
+	for range 5 {
+		b.Get(ctx, "cb-1") //nolint:errcheck
+	}
+	if c.State() != Closed || f.calls != 5 {
+		t.Fatalf("state = %s after %d calls; want closed after 5", c.State(), f.calls)
+	}
+}
+
+func TestHalfOpenProbe(t *testing.T) {
+	f := &fake{err: errDisk}
+	b, c, wait := newTestBackend(f)
+	for range 3 {
+		b.Get(ctx, "cb-1") //nolint:errcheck
+	}
+
+	// A failed probe opens the breaker for another cooldown.
+	wait(time.Minute)
+	if c.State() != HalfOpen {
+		t.Fatalf("state = %s after the cooldown, want half-open", c.State())
+	}
+	if _, err := b.Get(ctx, "cb-1"); !errors.Is(err, errDisk) || c.State() != Open {
+		t.Fatalf("failed probe: err = %v, state %s; want the disk's, open", err, c.State())
+	}
+
+	// A successful one closes it.
+	f.err = nil
+	wait(time.Minute)
+	if _, err := b.Get(ctx, "cb-1"); err != nil || c.State() != Closed {
+		t.Fatalf("probe: err = %v, state %s; want closed", err, c.State())
+	}
+}
+
+func TestOneProbeAtATime(t *testing.T) {
+	_, c, wait := newTestBackend(&fake{})
+	for range 3 {
+		c.done(errDisk)
+	}
+	wait(time.Minute)
+	if err := c.allow(); err != nil {
+		t.Fatalf("probe: %v", err)
+	}
+	if err := c.allow(); !errors.Is(err, store.ErrCircuitOpen) {
+		t.Fatalf("second operation while probing: err = %v, want the open circuit", err)
+	}
+}
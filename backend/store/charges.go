@@ -0,0 +1,81 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	bolt "github.com/boltdb/bolt"
+
+	"github.com/arkantrust/idempotency-example/backend/models"
+)
+
+// chargesBucketName holds the charges of each tenant, keyed by ID.
+const chargesBucketName = "charges"
+
+// Charges returns the collection of charges.
+func (s *Store) Charges() *Collection[models.Charge, *models.Charge] {
+	return s.charges
+}
+
+// chargebackChanged is told of every chargeback write, in its transaction.
+// A chargeback created with a charge or a merchant, or moved to another, is
+// checked against it before the write commits (see checkCharge and
+// checkMerchant), as is every chargeback written against the policy (see
+// checkPolicy), and the merchant index and daily totals follow it. A deleted
+// chargeback's evidence goes with it.
+func (s *Store) chargebackChanged(ctx context.Context, tx *bolt.Tx, old, new *models.Chargeback) error {
+	if new != nil && new.ChargeID != "" && (old == nil || !sameCharge(old, new)) {
+		if err := s.checkCharge(ctx, tx, new); err != nil {
+			return err
+		}
+	}
+	if new != nil && new.MerchantID != "" && (old == nil || old.MerchantID != new.MerchantID) {
+		if err := s.checkMerchant(ctx, tx, new); err != nil {
+			return err
+		}
+	}
+	if new != nil {
+		if err := s.checkPolicy(ctx, tx, old, new); err != nil {
+			return err
+		}
+	}
+	if err := indexMerchant(ctx, tx, old, new); err != nil {
+		return err
+	}
+	if new == nil {
+		if err := dropEvidence(tenantBuckets(ctx, tx), old.ID); err != nil {
+			return err
+		}
+	}
+	return rollup(ctx, tx, old, new)
+}
+
+// sameCharge reports whether an update leaves what checkCharge checks alone.
+func sameCharge(old, new *models.Chargeback) bool {
+	return old.ChargeID == new.ChargeID && old.Currency == new.Currency && old.Amount == new.Amount
+}
+
+// checkCharge returns a *models.ValidationError unless c's charge exists, is
+// visible to the caller, is in c's currency and is of at least c's amount.
+func (s *Store) checkCharge(ctx context.Context, tx *bolt.Tx, c *models.Chargeback) error {
+	charge, err := s.charges.getIn(ctx, tx, c.ChargeID)
+	if errors.Is(err, ErrNotFound) {
+		return invalid("chargeId", "no charge "+strconv.Quote(c.ChargeID))
+	}
+	if err != nil {
+		return err
+	}
+	if charge.Currency != c.Currency {
+		return invalid("currency", "must be the charge's, "+charge.Currency)
+	}
+	if c.Amount > charge.Amount {
+		return invalid("amount", "must be at most the charge's, "+strconv.FormatInt(charge.Amount, 10))
+	}
+	return nil
+}
+
+// invalid returns a validation error for one field.
+func invalid(field, message string) error {
+	return &models.ValidationError{Fields: []models.FieldError{{Field: field, Message: message}}}
+}
@@ -0,0 +1,41 @@
+package store_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/arkantrust/idempotency-example/backend/models"
+)
+
+func TestChargebacksReferenceExistingCharges(t *testing.T) {
+	s := newTestStore(t)
+	cb := &models.Chargeback{ID: "cb-1", Amount: 100, Currency: "USD", Reason: "fraud", ChargeID: "ch-1"}
+	var ve *models.ValidationError
+	if _, _, err := s.Create(ctx, cb); !errors.As(err, &ve) || ve.Fields[0].Field != "chargeId" {
+		t.Fatalf("expected the missing charge refused, got %v", err)
+	}
+	if _, err := s.Get(ctx, "cb-1"); err == nil {
+		t.Fatal("expected nothing written")
+	}
+
+	if _, _, err := s.Charges().Create(ctx, &models.Charge{ID: "ch-1", Amount: 80, Currency: "USD"}); err != nil {
+		t.Fatalf("create charge: %v", err)
+	}
+	if _, _, err := s.Create(ctx, cb); !errors.As(err, &ve) || ve.Fields[0].Field != "amount" {
+		t.Fatalf("expected an amount over the charge's refused, got %v", err)
+	}
+	cb.Amount = 80
+	if _, _, err := s.Create(ctx, cb); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	// Moving it to another currency is checked too.
+	_, _, err := s.Update(ctx, "cb-1", &models.Chargeback{Amount: 80, Currency: "EUR", Reason: "fraud", ChargeID: "ch-1"}, nil)
+	if !errors.As(err, &ve) || ve.Fields[0].Field != "currency" {
+		t.Fatalf("expected another currency refused, got %v", err)
+	}
+	// Dropping the charge is not.
+	if _, _, err := s.Update(ctx, "cb-1", &models.Chargeback{Amount: 90, Currency: "EUR", Reason: "fraud"}, nil); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+}
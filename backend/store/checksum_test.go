@@ -0,0 +1,99 @@
+package store_test
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	bolt "github.com/boltdb/bolt"
+
+	"github.com/arkantrust/idempotency-example/backend/models"
+	"github.com/arkantrust/idempotency-example/backend/store"
+)
+
+func TestCorruptRecordsAreDetected(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.db")
+	s, err := store.New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	acme := store.WithTenant(ctx, "acme")
+	for _, id := range []string{"cb-1", "cb-2"} {
+		if _, _, err := s.Create(acme, &models.Chargeback{ID: id, Amount: 100, Currency: "USD", Reason: "fraud"}); err != nil {
+			t.Fatalf("create failed: %v", err)
+		}
+	}
+	if report, err := s.Verify(ctx); err != nil || !report.OK() || report.Records != 2 || report.Unchecked != 0 {
+		t.Fatalf("expected two intact records, got %+v %v", report, err)
+	}
+	s.Close()
+
+	// Flip one bit of the payload behind Bolt's back, as a bad disk would.
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("tenants")).Bucket([]byte("acme")).Bucket([]byte("chargebacks"))
+		v := append([]byte(nil), b.Get([]byte("cb-2"))...)
+		v[len(v)-2] ^= 0x01
+		return b.Put([]byte("cb-2"), v)
+	})
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err = store.New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if _, err := s.Get(acme, "cb-2"); !errors.Is(err, store.ErrCorrupt) {
+		t.Fatalf("expected ErrCorrupt reading the damaged record, got %v", err)
+	}
+	if _, err := s.Get(acme, "cb-1"); err != nil {
+		t.Fatalf("expected the intact record readable, got %v", err)
+	}
+	report, err := s.Verify(ctx)
+	if err != nil {
+		t.Fatalf("verify failed: %v", err)
+	}
+	if report.OK() || len(report.Corrupt) != 1 || report.Corrupt[0].Key != "cb-2" || report.Corrupt[0].Bucket != "tenants/acme/chargebacks" {
+		t.Fatalf("expected cb-2 reported corrupt, got %+v", report)
+	}
+}
+
+func TestReencodeChecksumsLegacyRecords(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "legacy.db")
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte("chargebacks"))
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte("old"), []byte(`{"id":"old","amount":5,"currency":"USD","reason":"fraud","createdAt":"2024-01-02T03:04:05Z"}`))
+	})
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := store.New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if report, err := s.Verify(ctx); err != nil || !report.OK() || report.Unchecked != 1 {
+		t.Fatalf("expected the legacy record intact but unchecked, got %+v %v", report, err)
+	}
+	if st, err := s.Reencode(ctx); err != nil || st.Rewritten != 1 {
+		t.Fatalf("expected the legacy record rewritten, got %+v %v", st, err)
+	}
+	if report, err := s.Verify(ctx); err != nil || !report.OK() || report.Unchecked != 0 {
+		t.Fatalf("expected the record checksummed, got %+v %v", report, err)
+	}
+}
@@ -0,0 +1,327 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+
+	bolt "github.com/boltdb/bolt"
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/arkantrust/idempotency-example/backend/models"
+)
+
+// Codec encodes records for storage. The codecs are JSON, MessagePack and
+// Protobuf; JSON is the default.
+//
+// Stored values are self-describing, so a database can hold a mix of
+// encodings: JSON values are JSON objects (they start with '{'), binary ones
+// start with a tag byte naming their codec. Reads decode
+// whatever they find, and writes use the store's codec, so switching codecs
+// needs no downtime – existing records are converted as they are written,
+// or all at once by Reencode.
+type Codec interface {
+	// Name is the codec's name in configuration.
+	Name() string
+
+	// Marshal returns the stored form of v, including the tag byte.
+	Marshal(v any) ([]byte, error)
+
+	tag() byte
+	unmarshal(payload []byte, v any) error
+}
+
+// The codecs, by name.
+var (
+	JSON        Codec = jsonCodec{}
+	MessagePack Codec = msgpackCodec{}
+	Protobuf    Codec = protobufCodec{}
+)
+
+var codecs = []Codec{JSON, MessagePack, Protobuf}
+
+// CodecByName returns the codec called name.
+func CodecByName(name string) (Codec, error) {
+	for _, c := range codecs {
+		if c.Name() == name {
+			return c, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown record encoding %q", name)
+}
+
+// decode decodes a stored value written by any codec into v, as it was
+// written: no migrations are applied. Store.decode is the usual way to read a
+// record.
+func decode(data []byte, v any) error {
+	c, _, payload, err := header(data)
+	if err != nil {
+		return err
+	}
+	return c.unmarshal(payload, v)
+}
+
+// SetCodec selects the codec new writes use.
+func (s *Store) SetCodec(c Codec) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.codec = c
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string                    { return "json" }
+func (jsonCodec) tag() byte                       { return '{' }
+func (jsonCodec) Marshal(v any) ([]byte, error)   { return json.Marshal(v) }
+func (jsonCodec) unmarshal(p []byte, v any) error { return json.Unmarshal(p, v) }
+
+// msgpackCodec uses the json struct tags, so field names match the JSON
+// encoding.
+type msgpackCodec struct{}
+
+func (msgpackCodec) Name() string { return "msgpack" }
+func (msgpackCodec) tag() byte    { return 0x01 }
+
+func (c msgpackCodec) Marshal(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte(c.tag())
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetCustomStructTag("json")
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (msgpackCodec) unmarshal(p []byte, v any) error {
+	dec := msgpack.NewDecoder(bytes.NewReader(p))
+	dec.SetCustomStructTag("json")
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+	// MessagePack timestamps carry no location and decode as local time;
+	// records are always stamped in UTC.
+	utcTimes(reflect.ValueOf(v))
+	return nil
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// utcTimes converts every time.Time field reachable from v to UTC.
+func utcTimes(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Pointer:
+		if !v.IsNil() {
+			utcTimes(v.Elem())
+		}
+	case reflect.Struct:
+		if v.Type() == timeType {
+			if v.CanSet() {
+				v.Set(reflect.ValueOf(v.Interface().(time.Time).UTC()))
+			}
+			return
+		}
+		for i := range v.NumField() {
+			if v.Type().Field(i).IsExported() {
+				utcTimes(v.Field(i))
+			}
+		}
+	}
+}
+
+// protobufCodec encodes chargebacks as this message, with protowire rather
+// than generated code:
+//
+//	message StoredChargeback {
+//	  string id = 1;
+//	  int64 amount = 2;
+//	  string currency = 3;
+//	  string reason = 4;
+//	  string owner = 5;
+//	  int64 created_at = 6; // Unix nanoseconds, absent when zero
+//	  int64 updated_at = 7; // Unix nanoseconds, absent when zero
+//	  string request_id = 8;
+//	  int64 version = 9;
+//	  string charge_id = 10;
+//	  string merchant_id = 11;
+//	}
+//
+// Other record types have no schema and are stored as MessagePack.
+type protobufCodec struct{}
+
+func (protobufCodec) Name() string { return "protobuf" }
+func (protobufCodec) tag() byte    { return 0x02 }
+
+func (c protobufCodec) Marshal(v any) ([]byte, error) {
+	cb, ok := v.(*models.Chargeback)
+	if !ok {
+		return MessagePack.Marshal(v)
+	}
+	b := []byte{c.tag()}
+	str := func(num protowire.Number, s string) {
+		if s != "" {
+			b = protowire.AppendTag(b, num, protowire.BytesType)
+			b = protowire.AppendString(b, s)
+		}
+	}
+	i64 := func(num protowire.Number, n int64) {
+		if n != 0 {
+			b = protowire.AppendTag(b, num, protowire.VarintType)
+			b = protowire.AppendVarint(b, uint64(n))
+		}
+	}
+	ts := func(num protowire.Number, t time.Time) {
+		if !t.IsZero() {
+			i64(num, t.UnixNano())
+		}
+	}
+	str(1, cb.ID)
+	i64(2, cb.Amount)
+	str(3, cb.Currency)
+	str(4, cb.Reason)
+	str(5, cb.Owner)
+	ts(6, cb.CreatedAt)
+	ts(7, cb.UpdatedAt)
+	str(8, cb.RequestID)
+	i64(9, cb.Version)
+	str(10, cb.ChargeID)
+	str(11, cb.MerchantID)
+	return b, nil
+}
+
+func (protobufCodec) unmarshal(p []byte, v any) error {
+	cb, ok := v.(*models.Chargeback)
+	if !ok {
+		return fmt.Errorf("protobuf records decode into *models.Chargeback, not %T", v)
+	}
+	*cb = models.Chargeback{}
+	for len(p) > 0 {
+		num, typ, n := protowire.ConsumeTag(p)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		p = p[n:]
+
+		switch typ {
+		case protowire.BytesType:
+			v, n := protowire.ConsumeString(p)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			p = p[n:]
+			switch num {
+			case 1:
+				cb.ID = v
+			case 3:
+				cb.Currency = v
+			case 4:
+				cb.Reason = v
+			case 5:
+				cb.Owner = v
+			case 8:
+				cb.RequestID = v
+			case 10:
+				cb.ChargeID = v
+			case 11:
+				cb.MerchantID = v
+			}
+		case protowire.VarintType:
+			u, n := protowire.ConsumeVarint(p)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			p = p[n:]
+			switch num {
+			case 2:
+				cb.Amount = int64(u)
+			case 6:
+				cb.CreatedAt = time.Unix(0, int64(u)).UTC()
+			case 7:
+				cb.UpdatedAt = time.Unix(0, int64(u)).UTC()
+			case 9:
+				cb.Version = int64(u)
+			}
+		default:
+			// Unknown fields are skipped, so newer schemas stay readable.
+			n := protowire.ConsumeFieldValue(num, typ, p)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			p = p[n:]
+		}
+	}
+	return nil
+}
+
+// ReencodeStats reports the outcome of Reencode.
+type ReencodeStats struct {
+	Codec         string `json:"codec"`
+	SchemaVersion int    `json:"schemaVersion"`
+	Scanned       int    `json:"scanned"`
+	Rewritten     int    `json:"rewritten"`
+}
+
+// Reencode rewrites every chargeback, in every tenant, that is not stored
+// with the store's current codec and schema version, or, with field
+// encryption, has a field not sealed with the current key. It is the
+// migration path after changing codecs, adding a Migration or rotating keys;
+// without it, records are converted only when they are next written.
+//
+// Records are decoded (and upgraded) and re-encoded, never otherwise changed,
+// so running it again rewrites nothing.
+func (s *Store) Reencode(ctx context.Context) (ReencodeStats, error) {
+	var st ReencodeStats
+	err := s.maintain(ctx, func(tx *bolt.Tx) error {
+		st = ReencodeStats{Codec: s.codec.Name(), SchemaVersion: s.schemaVersion(bucketName)}
+		buckets := []*bolt.Bucket{tx.Bucket([]byte(bucketName))}
+		if tenants := tx.Bucket([]byte(tenantsBucketName)); tenants != nil {
+			err := tenants.ForEach(func(k, v []byte) error {
+				if t := tenants.Bucket(k); v == nil && t != nil {
+					if b := t.Bucket([]byte(bucketName)); b != nil {
+						buckets = append(buckets, b)
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		for _, b := range buckets {
+			// Collect first: Bolt does not support writes during ForEach.
+			rewrites := map[string][]byte{}
+			err := b.ForEach(func(k, v []byte) error {
+				st.Scanned++
+				if !s.stale(bucketName, v) && !s.unsealed(bucketName, v) {
+					return nil
+				}
+				var cb models.Chargeback
+				if err := s.decode(bucketName, v, &cb); err != nil {
+					return fmt.Errorf("record %q: %w", k, err)
+				}
+				data, err := s.encode(bucketName, &cb)
+				if err != nil {
+					return err
+				}
+				rewrites[string(k)] = data
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			for k, data := range rewrites {
+				if err := b.Put([]byte(k), data); err != nil {
+					return err
+				}
+			}
+			st.Rewritten += len(rewrites)
+		}
+		return nil
+	})
+	return st, err
+}
@@ -0,0 +1,401 @@
+package store
+
+import (
+	"context"
+	"slices"
+
+	bolt "github.com/boltdb/bolt"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/arkantrust/idempotency-example/backend/models"
+)
+
+// RecordPtr constrains a Collection's element type: PT must be *T and
+// implement models.Record.
+type RecordPtr[T any] interface {
+	*T
+	models.Record
+}
+
+// Collection stores records of one model type in their own bucket, with the
+// same idempotency guarantees, tenant buckets and owner scoping as the
+// chargeback methods on Store (which are implemented with one).
+type Collection[T any, PT RecordPtr[T]] struct {
+	s      *Store
+	bucket string
+	kind   string
+	equal  func(a, b *T) bool
+
+	// changed, when set, is told of every record written, in the write's
+	// transaction: old is nil for a create and new for a delete.
+	changed func(ctx context.Context, tx *bolt.Tx, old, new *T) error
+
+	// archive, when set, holds the records archived out of this
+	// collection, whose IDs stay taken; see Store.Archive.
+	archive *Collection[T, PT]
+}
+
+// NewCollection returns a collection of records stored in bucket. kind names
+// a single record in traces (e.g. "chargeback"). equal decides write-avoidance
+// in Update: when it reports the merged record equal to the stored one,
+// nothing is written.
+func NewCollection[T any, PT RecordPtr[T]](s *Store, bucket, kind string, equal func(a, b *T) bool) *Collection[T, PT] {
+	return &Collection[T, PT]{s: s, bucket: bucket, kind: kind, equal: equal}
+}
+
+// change calls c.changed, if set.
+func (c *Collection[T, PT]) change(ctx context.Context, tx *bolt.Tx, old, new *T) error {
+	if c.changed == nil {
+		return nil
+	}
+	return c.changed(ctx, tx, old, new)
+}
+
+func (c *Collection[T, PT]) startSpan(ctx context.Context, name, id string) (context.Context, trace.Span) {
+	ctx, span := tracer.Start(ctx, name)
+	if id != "" {
+		span.SetAttributes(attribute.String(c.kind+".id", id))
+	}
+	return ctx, span
+}
+
+// visibleTo reports whether a record owned by owner can be seen by the owner
+// in ctx. Unscoped contexts see every record.
+func visibleTo(ctx context.Context, owner string) bool {
+	o, scoped := ctx.Value(ownerKey{}).(string)
+	return !scoped || owner == o
+}
+
+// List returns every record visible to the caller. This is a pure read –
+// always idempotent – so concurrent identical calls share one transaction.
+func (c *Collection[T, PT]) List(ctx context.Context) ([]T, error) {
+	_, span := c.startSpan(ctx, "store.List", "")
+	v, collapsed, err := c.s.shared(ctx, "list", c.bucket, func() (any, error) {
+		items := []T{}
+		err := c.s.view(ctx, func(tx *bolt.Tx) error {
+			b := tenantBucket(ctx, tx, c.bucket)
+			if b == nil {
+				return nil
+			}
+			return b.ForEach(func(k, v []byte) error {
+				var item T
+				if err := c.s.decode(c.bucket, v, &item); err != nil {
+					return err
+				}
+				if visibleTo(ctx, PT(&item).RecordOwner()) {
+					items = append(items, item)
+				}
+				return nil
+			})
+		})
+		return items, err
+	})
+	// Every caller gets its own slice: they may sort or filter it.
+	items := slices.Clone(v.([]T))
+	span.SetAttributes(attribute.Int(c.kind+".count", len(items)), attribute.Bool("read.collapsed", collapsed))
+	endSpan(span, err)
+	if err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// ForEach calls fn for every record visible to the caller in key order,
+// walking the bucket with a cursor so that only one record is decoded at a
+// time. Iteration stops at the first error returned by fn, which is passed
+// back to the caller.
+//
+// The whole walk runs inside a single read transaction and therefore sees a
+// consistent snapshot even while writers are active. Bolt readers never block
+// writers, but a long-lived read transaction does keep old pages from being
+// reused until it finishes. Unlike List, concurrent walks are not shared.
+func (c *Collection[T, PT]) ForEach(ctx context.Context, fn func(T) error) (err error) {
+	_, span := c.startSpan(ctx, "store.ForEach", "")
+	defer func() { endSpan(span, err) }()
+
+	return c.s.view(ctx, func(tx *bolt.Tx) error {
+		b := tenantBucket(ctx, tx, c.bucket)
+		if b == nil {
+			return nil
+		}
+		cur := b.Cursor()
+		for k, v := cur.First(); k != nil; k, v = cur.Next() {
+			var item T
+			if err := c.s.decode(c.bucket, v, &item); err != nil {
+				return err
+			}
+			if !visibleTo(ctx, PT(&item).RecordOwner()) {
+				continue
+			}
+			if err := fn(item); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Get retrieves a single record by ID, or returns ErrNotFound. Concurrent
+// calls for the same ID share one transaction.
+func (c *Collection[T, PT]) Get(ctx context.Context, id string) (*T, error) {
+	_, span := c.startSpan(ctx, "store.Get", id)
+	v, collapsed, err := c.s.shared(ctx, "get", c.bucket+"/"+id, func() (any, error) {
+		var item *T
+		err := c.s.view(ctx, func(tx *bolt.Tx) (err error) {
+			item, err = c.getIn(ctx, tx, id)
+			return err
+		})
+		return item, err
+	})
+	span.SetAttributes(attribute.Bool("read.collapsed", collapsed))
+	endSpan(span, err)
+	if err != nil {
+		return nil, err
+	}
+	// As in List, the record is the caller's to change.
+	item := *v.(*T)
+	return &item, nil
+}
+
+// getIn is Get inside tx.
+func (c *Collection[T, PT]) getIn(ctx context.Context, tx *bolt.Tx, id string) (*T, error) {
+	b := tenantBucket(ctx, tx, c.bucket)
+	if b == nil {
+		return nil, ErrNotFound
+	}
+	v := b.Get([]byte(id))
+	if v == nil {
+		return nil, ErrNotFound
+	}
+	var item T
+	if err := c.s.decode(c.bucket, v, &item); err != nil {
+		return nil, err
+	}
+	if !visibleTo(ctx, PT(&item).RecordOwner()) {
+		return nil, ErrNotFound
+	}
+	return &item, nil
+}
+
+// Create persists item ONLY if no record with the same ID exists; otherwise
+// the stored record is returned unchanged and nothing is written. It returns
+// ErrKeyConflict when the ID belongs to another owner.
+func (c *Collection[T, PT]) Create(ctx context.Context, item *T) (*T, bool, error) {
+	_, span := c.startSpan(ctx, "store.Create", PT(item).RecordID())
+	var (
+		result  *T
+		created bool
+	)
+	err := c.s.batch(ctx, func(tx *bolt.Tx) (err error) {
+		result, created, err = c.createIn(ctx, tx, item)
+		return err
+	})
+	// "replayed" is the cache-hit path: the key existed and nothing was
+	// written. Comparing it with "created" spans shows the cost of a write.
+	span.SetAttributes(attribute.String("idempotency.outcome", outcome(created, "created", "replayed")))
+	endSpan(span, err)
+	if err != nil {
+		return nil, false, err
+	}
+	return result, created, nil
+}
+
+// createIn is Create inside tx.
+func (c *Collection[T, PT]) createIn(ctx context.Context, tx *bolt.Tx, item *T) (*T, bool, error) {
+	p := PT(item)
+	b, err := createTenantBucket(ctx, tx, c.bucket)
+	if err != nil {
+		return nil, false, err
+	}
+
+	// --- Idempotency check ---
+	// If the key already exists we return the stored value and skip the
+	// write. This is the core of POST idempotency: the same request ID
+	// always returns the same response regardless of retry count.
+	existing, err := c.archived(ctx, tx, p.RecordID())
+	if err != nil {
+		return nil, false, err
+	}
+	if v := b.Get([]byte(p.RecordID())); v != nil {
+		existing = new(T)
+		if err := c.s.decode(c.bucket, v, existing); err != nil {
+			return nil, false, err
+		}
+	}
+	if existing != nil {
+		if !visibleTo(ctx, PT(existing).RecordOwner()) {
+			return nil, false, ErrKeyConflict
+		}
+		return existing, false, nil
+	}
+
+	// First-time creation: stamp owner and timestamps, then persist.
+	p.Stamp(OwnerFrom(ctx), now(ctx))
+	stampRequest(ctx, p)
+	data, err := c.s.encode(c.bucket, item)
+	if err != nil {
+		return nil, false, err
+	}
+	if err := b.Put([]byte(p.RecordID()), data); err != nil {
+		return nil, false, err
+	}
+	if err := c.index(ctx, tx, item); err != nil {
+		return nil, false, err
+	}
+	if err := c.change(ctx, tx, nil, item); err != nil {
+		return nil, false, err
+	}
+	if err := fence(ctx, tx); err != nil {
+		return nil, false, err
+	}
+	result := *item
+	return &result, true, nil
+}
+
+// Update applies apply to a copy of the stored record and persists the
+// result ONLY if the collection's equal function reports a change.
+//
+// Returns (updated, true, nil) when a write occurred, (existing, false, nil)
+// when the write was skipped, and ErrNotFound when there is no record with
+// that ID visible to the caller.
+func (c *Collection[T, PT]) Update(ctx context.Context, id string, apply func(*T)) (*T, bool, error) {
+	return c.UpdateIf(ctx, id, apply, nil)
+}
+
+// UpdateIf is Update with a precondition. When the update would write, check
+// first sees the stored record, in the same transaction, and unless it
+// returns true nothing is written and UpdateIf returns ErrPreconditionFailed.
+// A skipped write is not checked: the requested state already holds, which
+// keeps a retry of a successful conditional update successful.
+func (c *Collection[T, PT]) UpdateIf(ctx context.Context, id string, apply func(*T), check func(*T) bool) (*T, bool, error) {
+	_, span := c.startSpan(ctx, "store.Update", id)
+	var (
+		result  *T
+		written bool
+	)
+	err := c.s.batch(ctx, func(tx *bolt.Tx) (err error) {
+		result, written, err = c.updateIn(ctx, tx, id, apply, check)
+		return err
+	})
+	span.SetAttributes(attribute.String("idempotency.outcome", outcome(written, "written", "skipped")))
+	endSpan(span, err)
+	if err != nil {
+		return nil, false, err
+	}
+	return result, written, nil
+}
+
+// updateIn is UpdateIf inside tx.
+func (c *Collection[T, PT]) updateIn(ctx context.Context, tx *bolt.Tx, id string, apply func(*T), check func(*T) bool) (*T, bool, error) {
+	existing, err := c.getIn(ctx, tx, id)
+	if err != nil {
+		return nil, false, err
+	}
+
+	merged := *existing
+	apply(&merged)
+
+	// --- Write-avoidance check ---
+	// If nothing the client controls changed we skip the write entirely
+	// and return the existing record, so the same PUT payload is safe to
+	// retry any number of times.
+	if c.equal(existing, &merged) {
+		return existing, false, nil
+	}
+	if check != nil && !check(existing) {
+		return nil, false, ErrPreconditionFailed
+	}
+
+	PT(&merged).Touch(now(ctx))
+	stampRequest(ctx, PT(&merged))
+	data, err := c.s.encode(c.bucket, &merged)
+	if err != nil {
+		return nil, false, err
+	}
+	if err := tenantBucket(ctx, tx, c.bucket).Put([]byte(id), data); err != nil {
+		return nil, false, err
+	}
+	if err := c.change(ctx, tx, existing, &merged); err != nil {
+		return nil, false, err
+	}
+	if err := fence(ctx, tx); err != nil {
+		return nil, false, err
+	}
+	return &merged, true, nil
+}
+
+// Delete removes a record by ID. Deleting a record that does not exist (or
+// belongs to another owner) is not an error; the returned bool reports
+// whether a record was actually removed.
+func (c *Collection[T, PT]) Delete(ctx context.Context, id string) (bool, error) {
+	removed, err := c.Remove(ctx, id, nil)
+	return removed != nil, err
+}
+
+// Remove is Delete returning the removed record, or nil when there was none.
+// When check is set it sees the record first, in the same transaction, and
+// the record is only removed if check returns true; otherwise Remove returns
+// ErrPreconditionFailed. A missing record is not checked: there is nothing
+// left to protect.
+func (c *Collection[T, PT]) Remove(ctx context.Context, id string, check func(*T) bool) (*T, error) {
+	_, span := c.startSpan(ctx, "store.Delete", id)
+	var removed *T
+
+	err := c.s.batch(ctx, func(tx *bolt.Tx) (err error) {
+		removed, err = c.removeIn(ctx, tx, id, check)
+		return err
+	})
+	span.SetAttributes(attribute.String("idempotency.outcome", outcome(removed != nil, "deleted", "missing")))
+	endSpan(span, err)
+	if err != nil {
+		return nil, err
+	}
+	return removed, nil
+}
+
+// deleteIn is Delete inside tx.
+func (c *Collection[T, PT]) deleteIn(ctx context.Context, tx *bolt.Tx, id string) (bool, error) {
+	removed, err := c.removeIn(ctx, tx, id, nil)
+	return removed != nil, err
+}
+
+// removeIn is Remove inside tx.
+func (c *Collection[T, PT]) removeIn(ctx context.Context, tx *bolt.Tx, id string, check func(*T) bool) (*T, error) {
+	b := tenantBucket(ctx, tx, c.bucket)
+	if b == nil {
+		// The tenant has never written anything, so there is nothing to
+		// delete either.
+		return nil, nil
+	}
+	v := b.Get([]byte(id))
+	if v == nil {
+		// Nothing to delete: the desired end state already holds.
+		return nil, nil
+	}
+	var item T
+	if err := c.s.decode(c.bucket, v, &item); err != nil {
+		return nil, err
+	}
+	if !visibleTo(ctx, PT(&item).RecordOwner()) {
+		// Another owner's record does not exist from the caller's point
+		// of view, so this is the same no-op as deleting a missing key.
+		return nil, nil
+	}
+	if check != nil && !check(&item) {
+		return nil, ErrPreconditionFailed
+	}
+	if err := b.Delete([]byte(id)); err != nil {
+		return nil, err
+	}
+	if err := c.unindex(ctx, tx, &item); err != nil {
+		return nil, err
+	}
+	if err := c.change(ctx, tx, &item, nil); err != nil {
+		return nil, err
+	}
+	if err := fence(ctx, tx); err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
@@ -0,0 +1,208 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"slices"
+	"time"
+
+	bolt "github.com/boltdb/bolt"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Every collection keeps a second bucket next to its records that orders
+// them by creation time, so that a range of creation times is a cursor seek
+// and a short walk instead of a scan of every record:
+//
+//	chargebacks_by_created/<createdAt><id>
+//
+// The key is the UTC creation time in RFC 3339 with all nine fractional
+// digits – fixed width, so that byte order is time order, which RFC3339Nano
+// with its trimmed zeros is not – followed by the record ID. Values are
+// empty: the record is looked up by ID in the records bucket.
+//
+// Creation times never change after the first write, so the index is only
+// written when a record is created or removed. Databases written before it
+// existed get it built when they are opened for writing; see buildIndexes.
+
+// createdIndexSuffix names a collection's creation time index after its
+// records bucket.
+const createdIndexSuffix = "_by_created"
+
+// createdLayout is the fixed-width time prefix of index keys, which is
+// createdPrefix bytes long in UTC.
+const (
+	createdLayout = "2006-01-02T15:04:05.000000000Z07:00"
+	createdPrefix = len("2006-01-02T15:04:05.000000000Z")
+)
+
+// createdKey returns the index key of the record id created at t.
+func createdKey(t time.Time, id string) []byte {
+	return append([]byte(t.UTC().Format(createdLayout)), id...)
+}
+
+// indexBucket is the name of the collection's creation time index.
+func (c *Collection[T, PT]) indexBucket() string {
+	return c.bucket + createdIndexSuffix
+}
+
+// index adds item, which was just created, to the index in tx.
+func (c *Collection[T, PT]) index(ctx context.Context, tx *bolt.Tx, item *T) error {
+	b, err := createTenantBucket(ctx, tx, c.indexBucket())
+	if err != nil {
+		return err
+	}
+	p := PT(item)
+	return b.Put(createdKey(p.RecordCreatedAt(), p.RecordID()), []byte{})
+}
+
+// unindex removes item, which was just removed, from the index in tx.
+func (c *Collection[T, PT]) unindex(ctx context.Context, tx *bolt.Tx, item *T) error {
+	b := tenantBucket(ctx, tx, c.indexBucket())
+	if b == nil {
+		return nil
+	}
+	p := PT(item)
+	return b.Delete(createdKey(p.RecordCreatedAt(), p.RecordID()))
+}
+
+// buildIndex builds the index of every tenant that has records but no index
+// yet, which is only the case for databases written before the index
+// existed: from then on the first write creates both.
+func (c *Collection[T, PT]) buildIndex(tx *bolt.Tx) error {
+	parents, err := tenantParents(tx)
+	if err != nil {
+		return err
+	}
+	for _, p := range parents {
+		records := p.Bucket([]byte(c.bucket))
+		if records == nil || p.Bucket([]byte(c.indexBucket())) != nil {
+			continue
+		}
+		idx, err := p.CreateBucket([]byte(c.indexBucket()))
+		if err != nil {
+			return err
+		}
+		err = records.ForEach(func(k, v []byte) error {
+			var item T
+			if err := c.s.decode(c.bucket, v, &item); err != nil {
+				return err
+			}
+			return idx.Put(createdKey(PT(&item).RecordCreatedAt(), string(k)), []byte{})
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// buildIndexes builds the indexes and daily totals missing from a database
+// written before they existed. It runs when the store opens a database for
+// writing, without taking s.mu: the caller either holds it or is the only
+// user of s.
+func (s *Store) buildIndexes() error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if err := s.chargebacks.buildIndex(tx); err != nil {
+			return err
+		}
+		return s.buildRollups(tx)
+	})
+}
+
+// ForEachCreated is ForEach over the records created strictly after after
+// and strictly before before, in order of creation; a zero time leaves that
+// end of the range open. Records created at the same instant come in ID
+// order.
+//
+// It seeks to the start of the range in the creation time index and walks it
+// to the end, so its cost depends on the size of the range, not of the
+// collection. Like ForEach it runs in a single read transaction.
+func (c *Collection[T, PT]) ForEachCreated(ctx context.Context, after, before time.Time, fn func(T) error) (err error) {
+	_, span := c.startSpan(ctx, "store.ForEachCreated", "")
+	span.SetAttributes(attribute.String("range.after", formatBound(after)), attribute.String("range.before", formatBound(before)))
+	defer func() { endSpan(span, err) }()
+
+	return c.s.view(ctx, func(tx *bolt.Tx) error {
+		records := tenantBucket(ctx, tx, c.bucket)
+		if records == nil {
+			return nil
+		}
+		idx := tenantBucket(ctx, tx, c.indexBucket())
+		if idx == nil {
+			// A database opened read-only before its index was built.
+			return c.scanCreated(ctx, records, after, before, fn)
+		}
+
+		var end []byte
+		if !before.IsZero() {
+			end = createdKey(before, "")
+		}
+		cur := idx.Cursor()
+		k, _ := cur.First()
+		if !after.IsZero() {
+			k, _ = cur.Seek(createdKey(after.Add(time.Nanosecond), ""))
+		}
+		for ; k != nil; k, _ = cur.Next() {
+			if end != nil && bytes.Compare(k, end) >= 0 {
+				return nil
+			}
+			v := records.Get(k[createdPrefix:])
+			if v == nil {
+				continue
+			}
+			var item T
+			if err := c.s.decode(c.bucket, v, &item); err != nil {
+				return err
+			}
+			if !visibleTo(ctx, PT(&item).RecordOwner()) {
+				continue
+			}
+			if err := fn(item); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// scanCreated is ForEachCreated without an index: every record is read and
+// the matches sorted in memory.
+func (c *Collection[T, PT]) scanCreated(ctx context.Context, records *bolt.Bucket, after, before time.Time, fn func(T) error) error {
+	var items []T
+	err := records.ForEach(func(k, v []byte) error {
+		var item T
+		if err := c.s.decode(c.bucket, v, &item); err != nil {
+			return err
+		}
+		p := PT(&item)
+		created := p.RecordCreatedAt()
+		if !visibleTo(ctx, p.RecordOwner()) ||
+			(!after.IsZero() && !created.After(after)) ||
+			(!before.IsZero() && !created.Before(before)) {
+			return nil
+		}
+		items = append(items, item)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	slices.SortStableFunc(items, func(a, b T) int {
+		return PT(&a).RecordCreatedAt().Compare(PT(&b).RecordCreatedAt())
+	})
+	for _, item := range items {
+		if err := fn(item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// formatBound formats a range bound for a span attribute.
+func formatBound(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
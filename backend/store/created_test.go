@@ -0,0 +1,148 @@
+package store_test
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	bolt "github.com/boltdb/bolt"
+
+	"github.com/arkantrust/idempotency-example/backend/models"
+	"github.com/arkantrust/idempotency-example/backend/store"
+)
+
+var day = time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+
+// createAt creates a chargeback for each id, the nth created n hours after
+// day.
+func createAt(t *testing.T, s *store.Store, ids ...string) {
+	t.Helper()
+	for i, id := range ids {
+		at := store.WithTime(ctx, day.Add(time.Duration(i)*time.Hour))
+		if _, _, err := s.Create(at, &models.Chargeback{ID: id, Amount: 100, Currency: "USD", Reason: "fraud"}); err != nil {
+			t.Fatalf("create %s: %v", id, err)
+		}
+	}
+}
+
+func createdBetween(t *testing.T, s *store.Store, after, before time.Time) []string {
+	t.Helper()
+	var ids []string
+	err := s.ForEachCreated(ctx, after, before, func(c models.Chargeback) error {
+		ids = append(ids, c.ID)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ForEachCreated: %v", err)
+	}
+	return ids
+}
+
+func TestForEachCreatedRange(t *testing.T) {
+	s := newTestStore(t)
+	// IDs in reverse: creation order must win over ID order.
+	createAt(t, s, "e", "d", "c", "b", "a")
+
+	hour := func(n int) time.Time { return day.Add(time.Duration(n) * time.Hour) }
+	cases := []struct {
+		name          string
+		after, before time.Time
+		want          []string
+	}{
+		{"open", time.Time{}, time.Time{}, []string{"e", "d", "c", "b", "a"}},
+		{"after is exclusive", hour(1), time.Time{}, []string{"c", "b", "a"}},
+		{"before is exclusive", time.Time{}, hour(3), []string{"e", "d", "c"}},
+		{"between", hour(0), hour(4), []string{"d", "c", "b"}},
+		{"between instants", hour(1).Add(time.Minute), hour(2).Add(time.Minute), []string{"c"}},
+		{"empty", hour(4), hour(0), nil},
+	}
+	for _, tc := range cases {
+		if got := createdBetween(t, s, tc.after, tc.before); !slices.Equal(got, tc.want) {
+			t.Fatalf("%s: got %v, want %v", tc.name, got, tc.want)
+		}
+	}
+
+	if _, err := s.Delete(ctx, "c"); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if _, err := s.DeleteMatching(ctx, store.Filter{Before: hour(1)}); err != nil {
+		t.Fatalf("delete matching: %v", err)
+	}
+	if got, want := createdBetween(t, s, time.Time{}, time.Time{}), []string{"d", "b", "a"}; !slices.Equal(got, want) {
+		t.Fatalf("after deletes: got %v, want %v", got, want)
+	}
+}
+
+func TestForEachCreatedTenants(t *testing.T) {
+	s := newTestStore(t)
+	a := store.WithTenant(store.WithTime(ctx, day), "a")
+	if _, _, err := s.Create(a, &models.Chargeback{ID: "cb-1", Amount: 100, Currency: "USD", Reason: "fraud"}); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if got := createdBetween(t, s, time.Time{}, time.Time{}); len(got) != 0 {
+		t.Fatalf("default tenant sees %v", got)
+	}
+	var ids []string
+	err := s.ForEachCreated(store.WithTenant(ctx, "a"), time.Time{}, time.Time{}, func(c models.Chargeback) error {
+		ids = append(ids, c.ID)
+		return nil
+	})
+	if err != nil || !slices.Equal(ids, []string{"cb-1"}) {
+		t.Fatalf("tenant a: got %v, %v", ids, err)
+	}
+}
+
+// TestCreatedIndexIsBuilt drops the index, as in a database written before
+// it existed, and checks that ranges still work: read-only by scanning, and
+// from an index built when the database is next opened for writing.
+func TestCreatedIndexIsBuilt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	s, err := store.New(path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	createAt(t, s, "c", "b", "a")
+	s.Close()
+
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		t.Fatalf("bolt open: %v", err)
+	}
+	if err := db.Update(func(tx *bolt.Tx) error { return tx.DeleteBucket([]byte("chargebacks_by_created")) }); err != nil {
+		t.Fatalf("drop index: %v", err)
+	}
+	db.Close()
+
+	want := []string{"b", "a"}
+	ro, err := store.NewReadOnly(path)
+	if err != nil {
+		t.Fatalf("open read-only: %v", err)
+	}
+	if got := createdBetween(t, ro, day, time.Time{}); !slices.Equal(got, want) {
+		t.Fatalf("read-only: got %v, want %v", got, want)
+	}
+	ro.Close()
+
+	s, err = store.New(path)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	if got := createdBetween(t, s, day, time.Time{}); !slices.Equal(got, want) {
+		t.Fatalf("rebuilt: got %v, want %v", got, want)
+	}
+	s.Close()
+
+	db, err = bolt.Open(path, 0600, nil)
+	if err != nil {
+		t.Fatalf("bolt open: %v", err)
+	}
+	defer db.Close()
+	db.View(func(tx *bolt.Tx) error { //nolint:errcheck
+		b := tx.Bucket([]byte("chargebacks_by_created"))
+		if b == nil || b.Stats().KeyN != 3 {
+			t.Fatalf("index was not rebuilt")
+		}
+		return nil
+	})
+}
@@ -0,0 +1,229 @@
+package store
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/arkantrust/idempotency-example/backend/models"
+)
+
+// Field encryption seals the sensitive fields of records (see
+// models.Sensitive) with AES-GCM as they are encoded, and opens them as they
+// are decoded, so everything above the store sees plaintext. A sealed field
+// is stored as a string in place of the plaintext, whatever the codec:
+//
+//	\x00enc:v1:<key ID>:<base64url(nonce || ciphertext)>
+//
+// The record ID is the additional data, so a sealed value copied into
+// another record does not open. Empty fields are left empty.
+//
+// Values are sealed with the provider's current key and opened with the key
+// they name, so keys can be rotated: add a new current key and keep the old
+// ones until Reencode has resealed every record with the new one. Records
+// written before encryption was configured are sealed when they are next
+// written, or by Reencode. Either way the free pages of the file keep the old
+// values until Compact rewrites it.
+const sealedPrefix = "\x00enc:v1:"
+
+// ErrUnknownKey is returned when a record holds a field sealed with a key the
+// store's KeyProvider does not have, or any sealed field when the store has
+// no KeyProvider.
+var ErrUnknownKey = errors.New("field encrypted with an unknown key")
+
+// KeyProvider supplies the AES keys of field encryption. StaticKeys serves
+// keys from configuration; an implementation backed by a KMS would unwrap
+// data keys held in encrypted form.
+type KeyProvider interface {
+	// CurrentKey returns the key new values are sealed with and its ID,
+	// which must not contain ':'.
+	CurrentKey() (id string, key []byte, err error)
+
+	// Key returns the key with the given ID, or ErrUnknownKey.
+	Key(id string) ([]byte, error)
+}
+
+// StaticKeys is a KeyProvider over keys held in memory.
+type StaticKeys struct {
+	current string
+	keys    map[string][]byte
+}
+
+// NewStaticKeys returns the keys by ID, current being the ID of the one new
+// values are sealed with.
+func NewStaticKeys(current string, keys map[string][]byte) *StaticKeys {
+	return &StaticKeys{current: current, keys: keys}
+}
+
+// ParseKeys returns the keys given as "id=<base64 key>", the first being
+// current. Keys must be 16, 24 or 32 bytes long, for AES-128, AES-192 or
+// AES-256, and IDs unique and without ':'.
+func ParseKeys(specs []string) (*StaticKeys, error) {
+	if len(specs) == 0 {
+		return nil, errors.New("no encryption keys")
+	}
+	keys := map[string][]byte{}
+	for _, spec := range specs {
+		id, enc, ok := strings.Cut(spec, "=")
+		if !ok || id == "" || strings.Contains(id, ":") {
+			return nil, fmt.Errorf("encryption key %q is not id=<base64 key>", id)
+		}
+		if _, dup := keys[id]; dup {
+			return nil, fmt.Errorf("encryption key %q is listed twice", id)
+		}
+		key, err := base64.StdEncoding.DecodeString(enc)
+		if err != nil {
+			return nil, fmt.Errorf("encryption key %q is not base64: %w", id, err)
+		}
+		if n := len(key); n != 16 && n != 24 && n != 32 {
+			return nil, fmt.Errorf("encryption key %q is %d bytes; want 16, 24 or 32", id, n)
+		}
+		keys[id] = key
+	}
+	current, _, _ := strings.Cut(specs[0], "=")
+	return NewStaticKeys(current, keys), nil
+}
+
+func (k *StaticKeys) CurrentKey() (string, []byte, error) {
+	key, err := k.Key(k.current)
+	return k.current, key, err
+}
+
+func (k *StaticKeys) Key(id string) ([]byte, error) {
+	key, ok := k.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownKey, id)
+	}
+	return key, nil
+}
+
+// SetKeys enables field encryption with the keys p provides; nil disables
+// it for new writes. Like AddMigration, it must be called before the store is
+// used.
+func (s *Store) SetKeys(p KeyProvider) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys = p
+}
+
+// sealed returns v, a pointer to a record about to be encoded, or a copy of
+// it with its sensitive fields sealed. v itself is left alone: the caller
+// goes on using it.
+func (s *Store) sealed(v any) (any, error) {
+	if s.keys == nil {
+		return v, nil
+	}
+	if _, ok := v.(models.Sensitive); !ok {
+		return v, nil
+	}
+	rv := reflect.ValueOf(v)
+	cp := reflect.New(rv.Type().Elem())
+	cp.Elem().Set(rv.Elem())
+	out := cp.Interface()
+
+	id, key, err := s.keys.CurrentKey()
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	aad := recordID(out)
+	for _, f := range out.(models.Sensitive).SensitiveFields() {
+		if *f == "" {
+			continue
+		}
+		nonce := make([]byte, aead.NonceSize())
+		if _, err := rand.Read(nonce); err != nil {
+			return nil, err
+		}
+		ct := aead.Seal(nonce, nonce, []byte(*f), aad)
+		*f = sealedPrefix + id + ":" + base64.RawURLEncoding.EncodeToString(ct)
+	}
+	return out, nil
+}
+
+// open opens the sealed fields of v, a record just decoded.
+func (s *Store) open(v any) error {
+	sv, ok := v.(models.Sensitive)
+	if !ok {
+		return nil
+	}
+	aad := recordID(v)
+	for _, f := range sv.SensitiveFields() {
+		rest, ok := strings.CutPrefix(*f, sealedPrefix)
+		if !ok {
+			continue
+		}
+		id, data, ok := strings.Cut(rest, ":")
+		if !ok {
+			return errors.New("malformed encrypted field")
+		}
+		if s.keys == nil {
+			return fmt.Errorf("%w %q: no keys are configured", ErrUnknownKey, id)
+		}
+		key, err := s.keys.Key(id)
+		if err != nil {
+			return err
+		}
+		aead, err := newAEAD(key)
+		if err != nil {
+			return err
+		}
+		ct, err := base64.RawURLEncoding.DecodeString(data)
+		if err != nil || len(ct) < aead.NonceSize() {
+			return errors.New("malformed encrypted field")
+		}
+		pt, err := aead.Open(nil, ct[:aead.NonceSize()], ct[aead.NonceSize():], aad)
+		if err != nil {
+			return fmt.Errorf("encrypted field does not open with key %q: %w", id, err)
+		}
+		*f = string(pt)
+	}
+	return nil
+}
+
+// unsealed reports whether the chargeback in data, stored in bucket, has a
+// sensitive field that is not sealed with the current key, which Reencode
+// then reseals. It is always false without a KeyProvider.
+func (s *Store) unsealed(bucket string, data []byte) bool {
+	if s.keys == nil {
+		return false
+	}
+	id, _, err := s.keys.CurrentKey()
+	if err != nil {
+		return false
+	}
+	var c models.Chargeback
+	if err := s.decodeSealed(bucket, data, &c); err != nil {
+		return false
+	}
+	for _, f := range c.SensitiveFields() {
+		if *f != "" && !strings.HasPrefix(*f, sealedPrefix+id+":") {
+			return true
+		}
+	}
+	return false
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// recordID returns the ID of v, if it is a record, as additional data.
+func recordID(v any) []byte {
+	if r, ok := v.(models.Record); ok {
+		return []byte(r.RecordID())
+	}
+	return nil
+}
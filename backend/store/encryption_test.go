@@ -0,0 +1,100 @@
+package store_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"testing"
+
+	"github.com/arkantrust/idempotency-example/backend/models"
+	"github.com/arkantrust/idempotency-example/backend/store"
+)
+
+func keys(t *testing.T, ids ...string) *store.StaticKeys {
+	t.Helper()
+	var specs []string
+	for _, id := range ids {
+		specs = append(specs, id+"="+base64.StdEncoding.EncodeToString(bytes.Repeat([]byte(id[:1]), 32)))
+	}
+	k, err := store.ParseKeys(specs)
+	if err != nil {
+		t.Fatalf("parse keys: %v", err)
+	}
+	return k
+}
+
+// holds reports whether the database file contains s.
+func holds(t *testing.T, st *store.Store, s string) bool {
+	t.Helper()
+	var buf bytes.Buffer
+	if _, err := st.Backup(ctx, &buf); err != nil {
+		t.Fatalf("backup: %v", err)
+	}
+	return bytes.Contains(buf.Bytes(), []byte(s))
+}
+
+func TestFieldEncryption(t *testing.T) {
+	s := newTestStore(t)
+	if _, _, err := s.Create(ctx, &models.Chargeback{ID: "cb-0", Amount: 100, Currency: "USD", Reason: "written in plaintext"}); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	s.SetKeys(keys(t, "a1"))
+	in := &models.Chargeback{ID: "cb-1", Amount: 100, Currency: "USD", Reason: "card stolen from Jane Doe"}
+	if _, _, err := s.Create(ctx, in); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if in.Reason != "card stolen from Jane Doe" {
+		t.Fatalf("the caller's record was changed: %q", in.Reason)
+	}
+	if c, err := s.Get(ctx, "cb-1"); err != nil || c.Reason != "card stolen from Jane Doe" {
+		t.Fatalf("get: %+v, %v", c, err)
+	}
+	if holds(t, s, "Jane Doe") {
+		t.Fatal("the reason is stored in plaintext")
+	}
+
+	// Reencode seals the record written before encryption was on, and
+	// compaction drops the pages that held it.
+	if st, err := s.Reencode(ctx); err != nil || st.Rewritten != 1 {
+		t.Fatalf("reencode: %+v, %v; want 1 rewritten", st, err)
+	}
+	if _, err := s.Compact(ctx); err != nil {
+		t.Fatalf("compact: %v", err)
+	}
+	if holds(t, s, "written in plaintext") {
+		t.Fatal("reencode left a reason in plaintext")
+	}
+
+	// Rotation: a new first key; the old one still opens, and Reencode
+	// reseals everything so that it can go.
+	s.SetKeys(keys(t, "b2", "a1"))
+	if st, err := s.Reencode(ctx); err != nil || st.Rewritten != 2 {
+		t.Fatalf("reencode after rotation: %+v, %v; want 2 rewritten", st, err)
+	}
+	s.SetKeys(keys(t, "b2"))
+	if c, err := s.Get(ctx, "cb-0"); err != nil || c.Reason != "written in plaintext" {
+		t.Fatalf("get after rotation: %+v, %v", c, err)
+	}
+
+	s.SetKeys(nil)
+	if _, err := s.Get(ctx, "cb-1"); !errors.Is(err, store.ErrUnknownKey) {
+		t.Fatalf("expected ErrUnknownKey without keys, got %v", err)
+	}
+}
+
+func TestParseKeys(t *testing.T) {
+	key := base64.StdEncoding.EncodeToString(make([]byte, 32))
+	for _, specs := range [][]string{
+		nil,
+		{key},
+		{"a:b=" + key},
+		{"a=" + key, "a=" + key},
+		{"a=not base64"},
+		{"a=" + base64.StdEncoding.EncodeToString(make([]byte, 20))},
+	} {
+		if _, err := store.ParseKeys(specs); err == nil {
+			t.Fatalf("expected an error for %q", specs)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"slices"
+
+	bolt "github.com/boltdb/bolt"
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/arkantrust/idempotency-example/backend/models"
+)
+
+// erasuresBucketName holds the proof of every erasure by chargeback ID, per
+// tenant.
+const erasuresBucketName = "erasures"
+
+// Erase clears the personal fields (models.PersonalFields) of the chargeback
+// id, active or archived, and saves a proof of the erasure in the same
+// transaction. The proof is the idempotency record: erasing again returns
+// the first proof with created false, without touching the chargeback, even
+// once it has been deleted. It returns ErrNotFound when there is neither a
+// proof nor a chargeback id visible to the caller.
+//
+// Only the record is scrubbed. Copies of it elsewhere – responses saved for
+// gRPC and GraphQL replays, backups, the Raft log – keep the old values.
+func (s *Store) Erase(ctx context.Context, id string) (proof *models.Erasure, created bool, err error) {
+	_, span := startSpan(ctx, "store.Erase", id)
+	// One clock reading, so that the record's UpdatedAt and the proof's
+	// ErasedAt agree.
+	ctx = WithTime(ctx, now(ctx))
+	err = s.batch(ctx, func(tx *bolt.Tx) error {
+		proof, created = nil, false
+		b, err := createTenantBucket(ctx, tx, erasuresBucketName)
+		if err != nil {
+			return err
+		}
+		if v := b.Get([]byte(id)); v != nil {
+			var e models.Erasure
+			if err := json.Unmarshal(v, &e); err != nil {
+				return err
+			}
+			if !visibleTo(ctx, e.Owner) {
+				return ErrNotFound
+			}
+			proof = &e
+			return nil
+		}
+
+		c := s.chargebacks
+		stored, err := c.getIn(ctx, tx, id)
+		if errors.Is(err, ErrNotFound) {
+			c = s.archive
+			stored, err = c.getIn(ctx, tx, id)
+		}
+		if err != nil {
+			return err
+		}
+		var values []string
+		if _, _, err := c.updateIn(ctx, tx, id, func(c *models.Chargeback) { values = c.ErasePersonal() }, nil); err != nil {
+			return err
+		}
+
+		e := &models.Erasure{
+			ChargebackID: id,
+			Owner:        stored.Owner,
+			Fields:       slices.Clone(models.PersonalFields),
+			SHA256:       models.ErasureDigest(id, values),
+			ErasedAt:     now(ctx),
+		}
+		data, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		if err := b.Put([]byte(id), data); err != nil {
+			return err
+		}
+		proof, created = e, true
+		return nil
+	})
+	span.SetAttributes(attribute.String("idempotency.outcome", outcome(created, "erased", "replayed")))
+	endSpan(span, err)
+	if err != nil {
+		return nil, false, err
+	}
+	return proof, created, nil
+}
@@ -0,0 +1,72 @@
+package store_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/arkantrust/idempotency-example/backend/models"
+	"github.com/arkantrust/idempotency-example/backend/store"
+)
+
+func TestErase(t *testing.T) {
+	s := newTestStore(t)
+	if _, _, err := s.Create(ctx, &models.Chargeback{ID: "cb-1", Amount: 100, Currency: "USD", Reason: "card stolen from Jane Doe"}); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	proof, created, err := s.Erase(store.WithTime(ctx, day), "cb-1")
+	if err != nil || !created {
+		t.Fatalf("erase: created %v, %v", created, err)
+	}
+	if want := models.ErasureDigest("cb-1", []string{"card stolen from Jane Doe"}); proof.SHA256 != want {
+		t.Fatalf("digest %s, want %s", proof.SHA256, want)
+	}
+	c, err := s.Get(ctx, "cb-1")
+	if err != nil || c.Reason != "" || c.Amount != 100 || c.Version != 2 {
+		t.Fatalf("erased record %+v, %v", c, err)
+	}
+
+	// Repeating returns the first proof, also once the record is gone.
+	if _, err := s.Delete(ctx, "cb-1"); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	again, created, err := s.Erase(store.WithTime(ctx, day.Add(time.Hour)), "cb-1")
+	if err != nil || created || again.SHA256 != proof.SHA256 || !again.ErasedAt.Equal(day) {
+		t.Fatalf("repeat: created %v, %+v, %v", created, again, err)
+	}
+
+	if _, _, err := s.Erase(ctx, "missing"); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+
+	// A policy rule added since a record was written does not block its
+	// erasure.
+	if _, _, err := s.Create(ctx, &models.Chargeback{ID: "cb-2", Amount: 5000, Currency: "USD", Reason: "John Roe"}); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	s.SetPolicy(&models.Policy{MaxAmounts: []models.AmountLimit{{Currency: "USD", Max: 1000}}})
+	if _, _, err := s.Erase(ctx, "cb-2"); err != nil {
+		t.Fatalf("erase under a stricter policy: %v", err)
+	}
+}
+
+func TestEraseArchived(t *testing.T) {
+	s := newTestStore(t)
+	createAt(t, s, "a")
+	if _, err := s.Archive(ctx, day.Add(time.Hour)); err != nil {
+		t.Fatalf("archive: %v", err)
+	}
+	if _, created, err := s.Erase(ctx, "a"); err != nil || !created {
+		t.Fatalf("erase: created %v, %v", created, err)
+	}
+	err := s.ForEachArchived(ctx, time.Time{}, time.Time{}, func(c models.Chargeback) error {
+		if c.Reason != "" {
+			t.Fatalf("archived record kept its reason: %+v", c)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ForEachArchived: %v", err)
+	}
+}
@@ -0,0 +1,61 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+
+	bolt "github.com/boltdb/bolt"
+)
+
+// Kinds of errors. Every error the store returns on purpose is one of them,
+// or ErrNotFound, so that callers can answer it by what went wrong rather
+// than by which check failed: errors.Is(err, ErrConflict) holds for
+// ErrKeyConflict, ErrPreconditionFailed and the other conflicts. Errors of
+// no kind – a corrupt record, a failing disk – are internal.
+var (
+	// ErrConflict is the kind of errors refusing an operation that
+	// contradicts the stored state: the same operation would fail again,
+	// until the state changes.
+	ErrConflict = errors.New("conflicts with the stored state")
+
+	// ErrValidation is the kind of errors refusing an operation's input.
+	ErrValidation = errors.New("invalid input")
+
+	// ErrTooLarge is the kind of errors refusing a key or value too large
+	// to store.
+	ErrTooLarge = errors.New("too large to store")
+
+	// ErrUnavailable is the kind of errors refusing an operation the store
+	// cannot take now, but may later: it is not accepting writes, or the
+	// database is busy.
+	ErrUnavailable = errors.New("store unavailable")
+)
+
+// ErrCircuitOpen is returned, without trying, for the operations of a store
+// that has failed repeatedly (see package store/breaker).
+var ErrCircuitOpen = newError(ErrUnavailable, "store operations are failing")
+
+// kindError is an error of a kind, with its own message.
+type kindError struct {
+	msg  string
+	kind error
+}
+
+func (e *kindError) Error() string        { return e.msg }
+func (e *kindError) Is(target error) bool { return target == e.kind }
+
+// newError returns an error of kind with message msg.
+func newError(kind error, msg string) error {
+	return &kindError{msg: msg, kind: kind}
+}
+
+// classify gives the errors Bolt refuses a write with their kinds.
+func classify(err error) error {
+	switch {
+	case errors.Is(err, bolt.ErrKeyTooLarge), errors.Is(err, bolt.ErrValueTooLarge):
+		return fmt.Errorf("%w: %w", ErrTooLarge, err)
+	case errors.Is(err, bolt.ErrKeyRequired):
+		return fmt.Errorf("%w: %w", ErrValidation, err)
+	}
+	return err
+}
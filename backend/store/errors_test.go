@@ -0,0 +1,40 @@
+package store_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/arkantrust/idempotency-example/backend/models"
+	"github.com/arkantrust/idempotency-example/backend/store"
+)
+
+func TestErrorKinds(t *testing.T) {
+	for _, tc := range []struct {
+		err, kind error
+	}{
+		{store.ErrKeyConflict, store.ErrConflict},
+		{store.ErrKeyReused, store.ErrConflict},
+		{store.ErrPreconditionFailed, store.ErrConflict},
+		{store.ErrRefundExceedsAmount, store.ErrConflict},
+		{store.ErrInvalidCursor, store.ErrValidation},
+		{store.ErrReadOnly, store.ErrUnavailable},
+		{store.ErrTimeout, store.ErrUnavailable},
+	} {
+		if !errors.Is(tc.err, tc.kind) {
+			t.Errorf("%q is not of kind %q", tc.err, tc.kind)
+		}
+	}
+	if errors.Is(store.ErrNotFound, store.ErrConflict) || errors.Is(store.ErrKeyReused, store.ErrValidation) {
+		t.Error("errors are of kinds they should not be")
+	}
+}
+
+func TestBoltRefusalsHaveKinds(t *testing.T) {
+	s := newTestStore(t)
+	// Bolt keys are at most 32KiB.
+	_, _, err := s.Create(ctx, &models.Chargeback{ID: strings.Repeat("x", 40000), Amount: 100, Currency: "USD", Reason: "fraud"})
+	if !errors.Is(err, store.ErrTooLarge) {
+		t.Fatalf("create: err = %v, want too large", err)
+	}
+}
@@ -0,0 +1,239 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+
+	bolt "github.com/boltdb/bolt"
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/arkantrust/idempotency-example/backend/models"
+)
+
+// Evidence lives in three buckets per tenant:
+//
+//	evidence/<chargeback id>\x00<sha256>   the documents of each chargeback
+//	blobs/<sha256>                         the contents of every document
+//	blob_refs/<sha256>\x00<chargeback id>  the chargebacks holding each one
+//
+// A document attached to several chargebacks is stored once, and dropped
+// with the last of them. A chargeback's documents go with it when it is
+// deleted or archived, so a chargeback created later with the same ID, by
+// whichever owner, starts with none.
+const (
+	evidenceBucketName = "evidence"
+	blobsBucketName    = "blobs"
+	blobRefsBucketName = "blob_refs"
+)
+
+// AddEvidence attaches data, described by e's Filename and ContentType, to
+// the chargeback id, and returns the evidence with created true. A document
+// with the same contents already attached to it is returned instead, with
+// created false: re-uploading a file is a no-op. It returns ErrNotFound when
+// there is no active chargeback id visible to the caller.
+func (s *Store) AddEvidence(ctx context.Context, id string, e *models.Evidence, data []byte) (result *models.Evidence, created bool, err error) {
+	_, span := startSpan(ctx, "store.AddEvidence", id)
+	sum := sha256.Sum256(data)
+	digest := hex.EncodeToString(sum[:])
+	err = s.update(ctx, func(tx *bolt.Tx) error {
+		result, created = nil, false
+		if _, err := s.chargebacks.getIn(ctx, tx, id); err != nil {
+			return err
+		}
+		b, err := createTenantBucket(ctx, tx, evidenceBucketName)
+		if err != nil {
+			return err
+		}
+		key := evidenceKey(id, digest)
+		if v := b.Get(key); v != nil {
+			result = &models.Evidence{}
+			return s.decode(evidenceBucketName, v, result)
+		}
+
+		blobs, err := createTenantBucket(ctx, tx, blobsBucketName)
+		if err != nil {
+			return err
+		}
+		if blobs.Get([]byte(digest)) == nil {
+			if err := blobs.Put([]byte(digest), data); err != nil {
+				return err
+			}
+		}
+		refs, err := createTenantBucket(ctx, tx, blobRefsBucketName)
+		if err != nil {
+			return err
+		}
+		if err := refs.Put(evidenceKey(digest, id), []byte{}); err != nil {
+			return err
+		}
+
+		result = &models.Evidence{
+			SHA256:       digest,
+			ChargebackID: id,
+			Filename:     e.Filename,
+			ContentType:  e.ContentType,
+			Size:         int64(len(data)),
+			CreatedAt:    now(ctx),
+		}
+		v, err := s.encode(evidenceBucketName, result)
+		if err != nil {
+			return err
+		}
+		if err := b.Put(key, v); err != nil {
+			return err
+		}
+		created = true
+		return fence(ctx, tx)
+	})
+	span.SetAttributes(attribute.String("idempotency.outcome", outcome(created, "created", "replayed")))
+	endSpan(span, err)
+	if err != nil {
+		return nil, false, err
+	}
+	return result, created, nil
+}
+
+// Evidence returns the documents attached to the chargeback id, in order of
+// their SHA-256, or ErrNotFound when there is no active chargeback id
+// visible to the caller.
+func (s *Store) Evidence(ctx context.Context, id string) ([]models.Evidence, error) {
+	list := []models.Evidence{}
+	err := s.view(ctx, func(tx *bolt.Tx) error {
+		if _, err := s.chargebacks.getIn(ctx, tx, id); err != nil {
+			return err
+		}
+		b := tenantBucket(ctx, tx, evidenceBucketName)
+		if b == nil {
+			return nil
+		}
+		prefix := evidenceKey(id, "")
+		c := b.Cursor()
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			var e models.Evidence
+			if err := s.decode(evidenceBucketName, v, &e); err != nil {
+				return err
+			}
+			list = append(list, e)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// EvidenceDocument returns the document digest attached to the chargeback
+// id, with its contents, or ErrNotFound.
+func (s *Store) EvidenceDocument(ctx context.Context, id, digest string) (*models.Evidence, []byte, error) {
+	var e models.Evidence
+	var data []byte
+	err := s.view(ctx, func(tx *bolt.Tx) error {
+		if _, err := s.chargebacks.getIn(ctx, tx, id); err != nil {
+			return err
+		}
+		b := tenantBucket(ctx, tx, evidenceBucketName)
+		if b == nil {
+			return ErrNotFound
+		}
+		v := b.Get(evidenceKey(id, digest))
+		if v == nil {
+			return ErrNotFound
+		}
+		if err := s.decode(evidenceBucketName, v, &e); err != nil {
+			return err
+		}
+		blobs := tenantBucket(ctx, tx, blobsBucketName)
+		if blobs == nil {
+			return ErrNotFound
+		}
+		// Bolt's memory is only valid during the transaction.
+		data = bytes.Clone(blobs.Get([]byte(digest)))
+		if data == nil {
+			return ErrNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return &e, data, nil
+}
+
+// DeleteEvidence detaches the document digest from the chargeback id, and
+// drops its contents if no other chargeback holds it. Like Delete it
+// succeeds whether or not the document was attached, reporting which in
+// existed; it returns ErrNotFound only when there is no active chargeback id
+// visible to the caller.
+func (s *Store) DeleteEvidence(ctx context.Context, id, digest string) (existed bool, err error) {
+	_, span := startSpan(ctx, "store.DeleteEvidence", id)
+	defer func() { endSpan(span, err) }()
+	err = s.update(ctx, func(tx *bolt.Tx) error {
+		existed = false
+		if _, err := s.chargebacks.getIn(ctx, tx, id); err != nil {
+			return err
+		}
+		b := tenantBucket(ctx, tx, evidenceBucketName)
+		if b == nil || b.Get(evidenceKey(id, digest)) == nil {
+			return nil
+		}
+		existed = true
+		if err := detachEvidence(tenantBuckets(ctx, tx), id, digest); err != nil {
+			return err
+		}
+		return fence(ctx, tx)
+	})
+	return existed, err
+}
+
+// dropEvidence detaches every document from the chargeback id, as it leaves
+// the active bucket. bucket returns the tenant's bucket of a name, or nil.
+func dropEvidence(bucket func(name string) *bolt.Bucket, id string) error {
+	b := bucket(evidenceBucketName)
+	if b == nil {
+		return nil
+	}
+	// Collect first: the cursor must not see the deletes.
+	var digests []string
+	prefix := evidenceKey(id, "")
+	c := b.Cursor()
+	for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+		digests = append(digests, string(k[len(prefix):]))
+	}
+	for _, digest := range digests {
+		if err := detachEvidence(bucket, id, digest); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// detachEvidence detaches the document digest from the chargeback id, and
+// drops its contents if no other chargeback holds it.
+func detachEvidence(bucket func(name string) *bolt.Bucket, id, digest string) error {
+	if err := bucket(evidenceBucketName).Delete(evidenceKey(id, digest)); err != nil {
+		return err
+	}
+	refs := bucket(blobRefsBucketName)
+	if err := refs.Delete(evidenceKey(digest, id)); err != nil {
+		return err
+	}
+	prefix := evidenceKey(digest, "")
+	if k, _ := refs.Cursor().Seek(prefix); k == nil || !bytes.HasPrefix(k, prefix) {
+		return bucket(blobsBucketName).Delete([]byte(digest))
+	}
+	return nil
+}
+
+// tenantBuckets returns tenantBucket for the tenant in ctx, as a function
+// of the bucket name.
+func tenantBuckets(ctx context.Context, tx *bolt.Tx) func(string) *bolt.Bucket {
+	return func(name string) *bolt.Bucket { return tenantBucket(ctx, tx, name) }
+}
+
+// evidenceKey joins the two parts of an evidence or blob reference key.
+func evidenceKey(a, b string) []byte {
+	return []byte(a + "\x00" + b)
+}
@@ -0,0 +1,52 @@
+package store_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/arkantrust/idempotency-example/backend/models"
+	"github.com/arkantrust/idempotency-example/backend/store"
+)
+
+func TestEvidenceGoesWithChargeback(t *testing.T) {
+	s := newTestStore(t)
+	alice, bob := store.WithOwner(ctx, "key:alice"), store.WithOwner(ctx, "key:bob")
+	cb := func() *models.Chargeback {
+		return &models.Chargeback{ID: "cb-1", Amount: 100, Currency: "USD", Reason: "fraud"}
+	}
+	if _, _, err := s.Create(alice, cb()); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	e, _, err := s.AddEvidence(alice, "cb-1", &models.Evidence{Filename: "alice-id.pdf", ContentType: "application/pdf"}, []byte("alice"))
+	if err != nil {
+		t.Fatalf("add evidence: %v", err)
+	}
+	if _, err := s.Delete(alice, "cb-1"); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+
+	// Another owner recreating the ID does not inherit the documents.
+	if _, _, err := s.Create(bob, cb()); err != nil {
+		t.Fatalf("recreate: %v", err)
+	}
+	if list, err := s.Evidence(bob, "cb-1"); err != nil || len(list) != 0 {
+		t.Fatalf("evidence after recreate: %+v, %v", list, err)
+	}
+	if _, _, err := s.EvidenceDocument(bob, "cb-1", e.SHA256); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("document after recreate: %v, want ErrNotFound", err)
+	}
+
+	// Nor do bulk deletes leave them behind.
+	if _, _, err := s.AddEvidence(bob, "cb-1", &models.Evidence{Filename: "bob.pdf"}, []byte("bob")); err != nil {
+		t.Fatalf("add evidence: %v", err)
+	}
+	if _, err := s.DeleteMatching(bob, store.Filter{Currency: "USD"}); err != nil {
+		t.Fatalf("delete matching: %v", err)
+	}
+	if _, _, err := s.Create(alice, cb()); err != nil {
+		t.Fatalf("recreate: %v", err)
+	}
+	if list, err := s.Evidence(alice, "cb-1"); err != nil || len(list) != 0 {
+		t.Fatalf("evidence after bulk delete: %+v, %v", list, err)
+	}
+}
@@ -0,0 +1,108 @@
+package store
+
+import (
+	"context"
+	"encoding/binary"
+
+	bolt "github.com/boltdb/bolt"
+)
+
+// Fencing tokens order the writes a store makes. Every transaction that
+// changes data draws the next value of a store-wide counter, persisted in
+// Bolt and so monotonic across restarts, and reports it to the caller (see
+// WithFencing). A client that triggers a side effect elsewhere – a payment, a
+// message – passes the token along, and the system doing it remembers the
+// highest token it has acted on per resource and refuses lower ones: a
+// command held up in a retry queue while a newer write went through can no
+// longer undo that write's effect. AcceptFencingToken is that check, kept
+// in the same file so the example is self-contained.
+
+// fencingBucketName holds the counter, as the bucket's sequence, and the
+// highest token accepted per resource.
+const fencingBucketName = "fencing"
+
+// ErrStaleFencingToken is returned by AcceptFencingToken for a token lower
+// than one already accepted for the same resource.
+var ErrStaleFencingToken = newError(ErrConflict, "fencing token is older than one already accepted")
+
+// ErrUnknownFencingToken is returned by AcceptFencingToken for a token this
+// store has not issued.
+var ErrUnknownFencingToken = newError(ErrValidation, "fencing token was never issued")
+
+type fencingKey struct{}
+
+// WithFencing returns a copy of ctx that collects the fencing token of the
+// writes made with it; read it back with FencingTokenFrom.
+func WithFencing(ctx context.Context) context.Context {
+	return context.WithValue(ctx, fencingKey{}, new(uint64))
+}
+
+// FencingTokenFrom returns the token of the latest write made with ctx, or 0
+// when ctx did not come from WithFencing or made no write.
+func FencingTokenFrom(ctx context.Context) uint64 {
+	if t, ok := ctx.Value(fencingKey{}).(*uint64); ok {
+		return *t
+	}
+	return 0
+}
+
+// SetFencingToken reports token to ctx as FencingTokenFrom would if ctx had
+// made the write itself. It is for callers that make a write on ctx's behalf
+// with another context, such as a replicated store applying it.
+func SetFencingToken(ctx context.Context, token uint64) {
+	if t, ok := ctx.Value(fencingKey{}).(*uint64); ok {
+		*t = token
+	}
+}
+
+// fence draws a token for a write in tx and reports it to ctx. Every
+// transaction that changes data calls it, whether or not anyone asked for
+// the token, so the counter orders all writes.
+func fence(ctx context.Context, tx *bolt.Tx) error {
+	b, err := tx.CreateBucketIfNotExists([]byte(fencingBucketName))
+	if err != nil {
+		return err
+	}
+	n, err := b.NextSequence()
+	if err != nil {
+		return err
+	}
+	if t, ok := ctx.Value(fencingKey{}).(*uint64); ok {
+		*t = n
+	}
+	return nil
+}
+
+// FencingToken returns the token of the latest write, 0 before the first.
+func (s *Store) FencingToken(ctx context.Context) (uint64, error) {
+	var n uint64
+	err := s.view(ctx, func(tx *bolt.Tx) error {
+		if b := tx.Bucket([]byte(fencingBucketName)); b != nil {
+			n = b.Sequence()
+		}
+		return nil
+	})
+	return n, err
+}
+
+// AcceptFencingToken is the check a downstream system makes before acting on
+// a command carrying token for resource, a name of its choosing. It records
+// token as the highest accepted for resource, or returns
+// ErrStaleFencingToken if a higher one already was. Accepting the same token
+// again succeeds: it is the same command retried, which the downstream
+// system has to deduplicate anyway.
+func (s *Store) AcceptFencingToken(ctx context.Context, resource string, token uint64) error {
+	return s.update(ctx, func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(fencingBucketName))
+		if err != nil {
+			return err
+		}
+		if token == 0 || token > b.Sequence() {
+			return ErrUnknownFencingToken
+		}
+		if v := b.Get([]byte(resource)); v != nil && token < binary.BigEndian.Uint64(v) {
+			return ErrStaleFencingToken
+		}
+		return b.Put([]byte(resource), binary.BigEndian.AppendUint64(nil, token))
+	})
+}
@@ -0,0 +1,62 @@
+package store_test
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/arkantrust/idempotency-example/backend/models"
+	"github.com/arkantrust/idempotency-example/backend/store"
+)
+
+func TestFencingTokens(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fencing.db")
+	s, err := store.New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	write := func(amount int64) uint64 {
+		fctx := store.WithFencing(ctx)
+		if _, _, err := s.Update(fctx, "cb-1", &models.Chargeback{Amount: amount, Currency: "USD"}, nil); err != nil {
+			t.Fatalf("update failed: %v", err)
+		}
+		return store.FencingTokenFrom(fctx)
+	}
+	fctx := store.WithFencing(ctx)
+	if _, _, err := s.Create(fctx, &models.Chargeback{ID: "cb-1", Amount: 1, Currency: "USD"}); err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+	first := store.FencingTokenFrom(fctx)
+	second := write(2)
+	if first == 0 || second <= first {
+		t.Fatalf("expected increasing tokens, got %d then %d", first, second)
+	}
+	if skipped := write(2); skipped != 0 {
+		t.Fatalf("expected no token for a skipped write, got %d", skipped)
+	}
+
+	if err := s.AcceptFencingToken(ctx, "payout/cb-1", second); err != nil {
+		t.Fatalf("expected the newer token accepted, got %v", err)
+	}
+	if err := s.AcceptFencingToken(ctx, "payout/cb-1", second); err != nil {
+		t.Fatalf("expected the same token accepted again, got %v", err)
+	}
+	if err := s.AcceptFencingToken(ctx, "payout/cb-1", first); !errors.Is(err, store.ErrStaleFencingToken) {
+		t.Fatalf("expected ErrStaleFencingToken, got %v", err)
+	}
+	if err := s.AcceptFencingToken(ctx, "payout/cb-2", second+1); !errors.Is(err, store.ErrUnknownFencingToken) {
+		t.Fatalf("expected ErrUnknownFencingToken, got %v", err)
+	}
+
+	// The counter survives a restart.
+	s.Close()
+	s, err = store.New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if third := write(3); third <= second {
+		t.Fatalf("expected tokens to keep increasing after a restart, got %d after %d", third, second)
+	}
+}
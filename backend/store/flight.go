@@ -0,0 +1,46 @@
+package store
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/arkantrust/idempotency-example/backend/metrics"
+)
+
+// Identical reads that overlap share one transaction. A frontend polling the
+// list, or a burst of retries fetching the record they just wrote, would
+// otherwise open a View transaction each, all returning the same bytes;
+// instead the first read runs and the others wait for its result.
+//
+// A read only joins one that started after the last write to the store
+// finished, so sharing never hides a write from a caller: a client that
+// reads back its own write starts a new read rather than joining one that
+// may have begun before it.
+
+// shared runs read, or waits for an identical read already running and
+// returns its result. key names the read within the caller's tenant and
+// owner, which are added to it. collapsed reports whether the caller waited
+// rather than ran read.
+func (s *Store) shared(ctx context.Context, op, key string, read func() (any, error)) (v any, collapsed bool, err error) {
+	owner := "*" // unscoped, unlike any owner, the anonymous "" included
+	if Scoped(ctx) {
+		owner = "=" + OwnerFrom(ctx)
+	}
+	flight := strings.Join([]string{
+		strconv.FormatUint(s.writes.Load(), 10), op, TenantFrom(ctx), owner, key,
+	}, "\x00")
+	collapsed = true
+	v, err, _ = s.reads.Do(flight, func() (any, error) {
+		collapsed = false
+		return read()
+	})
+	metrics.Reads.WithLabelValues(op, outcome(collapsed, "collapsed", "executed")).Inc()
+	return v, collapsed, err
+}
+
+// wrote marks the end of a write transaction, so that reads starting from
+// now on no longer join one that may have started before it.
+func (s *Store) wrote() {
+	s.writes.Add(1)
+}
@@ -0,0 +1,94 @@
+package store_test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/arkantrust/idempotency-example/backend/models"
+	"github.com/arkantrust/idempotency-example/backend/store"
+)
+
+// TestSharedReadsSeeWrites hammers a record with concurrent reads, which
+// share transactions, while updating it: a read started after an update must
+// see it, and a caller changing what it read must not change what the others
+// get.
+func TestSharedReadsSeeWrites(t *testing.T) {
+	s := newTestStore(t)
+	if _, _, err := s.Create(ctx, &models.Chargeback{ID: "cb-1", Amount: 1, Currency: "USD", Reason: "fraud"}); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				if c, err := s.Get(ctx, "cb-1"); err == nil {
+					c.Amount = -1
+				}
+				if items, err := s.List(ctx); err == nil && len(items) > 0 {
+					items[0].Amount = -1
+				}
+			}
+		}()
+	}
+	defer func() {
+		close(stop)
+		wg.Wait()
+	}()
+
+	for amount := int64(2); amount <= 50; amount++ {
+		if _, _, err := s.Update(ctx, "cb-1", &models.Chargeback{Amount: amount, Currency: "USD", Reason: "fraud"}, nil); err != nil {
+			t.Fatalf("update: %v", err)
+		}
+		c, err := s.Get(ctx, "cb-1")
+		if err != nil {
+			t.Fatalf("get: %v", err)
+		}
+		if c.Amount != amount {
+			t.Fatalf("get after update to %v returned amount %v", amount, c.Amount)
+		}
+		items, err := s.List(ctx)
+		if err != nil {
+			t.Fatalf("list: %v", err)
+		}
+		if len(items) != 1 || items[0].Amount != amount {
+			t.Fatalf("list after update to %v returned %+v", amount, items)
+		}
+	}
+}
+
+// TestSharedReadsKeepTenantsApart checks that reads are only shared within a
+// tenant: the same ID read for two tenants gives each its own record.
+func TestSharedReadsKeepTenantsApart(t *testing.T) {
+	s := newTestStore(t)
+	a, b := store.WithTenant(ctx, "a"), store.WithTenant(ctx, "b")
+	if _, _, err := s.Create(a, &models.Chargeback{ID: "cb-1", Amount: 1, Currency: "USD", Reason: "fraud"}); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for range 16 {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if _, err := s.Get(a, "cb-1"); err != nil {
+				t.Errorf("tenant a: %v", err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if _, err := s.Get(b, "cb-1"); err != store.ErrNotFound {
+				t.Errorf("tenant b: want ErrNotFound, got %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,465 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	bolt "github.com/boltdb/bolt"
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/arkantrust/idempotency-example/backend/models"
+)
+
+const idempotencyBucketName = "idempotency"
+
+// createOp is the operation CreateWithKey namespaces its keys by.
+const createOp = "create"
+
+// ErrKeyReused is returned by CreateWithKey when an Idempotency-Key is sent
+// again with a different payload. Replaying the original response would hide
+// the fact that the second request was never applied.
+var ErrKeyReused = newError(ErrConflict, "idempotency key reused with a different payload")
+
+// keyRecord is what the idempotency bucket stores per key: the record the
+// key created and a fingerprint of the payload that created it.
+type keyRecord struct {
+	ID          string    `json:"id"`
+	Fingerprint string    `json:"fingerprint"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+// fingerprint hashes the client-supplied fields of c. Hashing fields rather
+// than the raw body means a retry that re-serialises the same payload with
+// different whitespace or key order is still recognised as the same request.
+func fingerprint(c *models.Chargeback) string {
+	h := sha256.New()
+	for _, f := range []string{strconv.FormatInt(c.Amount, 10), c.Currency, c.Reason} {
+		h.Write([]byte(f))
+		h.Write([]byte{0})
+	}
+	// Added after keys were first stored, so only when set: the
+	// fingerprints of those keys stay what they were.
+	// Each is named, so that one cannot pass for the other.
+	for _, f := range [][2]string{{"chargeId", c.ChargeID}, {"merchantId", c.MerchantID}} {
+		if f[1] != "" {
+			h.Write([]byte(f[0] + "=" + f[1]))
+			h.Write([]byte{0})
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// CreateWithKey persists c under its (server-generated) ID unless key has
+// been used before, in which case the record created by the first request is
+// returned instead.
+//
+// This is "surrogate key" idempotency: the client does not choose the record
+// ID, so deduplication hangs off a separate Idempotency-Key. Keys are scoped
+// to the tenant and owner in ctx, like IDs are for Create, and to creation:
+// the same key sent to another operation is another key.
+//
+// Returns (existing, false, nil) on a replay, also when the record has since
+// been archived, ErrKeyReused if key was first used with a different payload,
+// and ErrNotFound if the record it created has since been deleted. A key that
+// has expired (see SetKeyTTL) or been expired with ExpireKey is free again:
+// sending it creates a new record.
+func (s *Store) CreateWithKey(ctx context.Context, key string, c *models.Chargeback) (*models.Chargeback, bool, error) {
+	_, span := startSpan(ctx, "store.CreateWithKey", c.ID)
+	var result models.Chargeback
+	created := false
+
+	err := s.batch(ctx, func(tx *bolt.Tx) error {
+		created = false
+		keys, err := createTenantBucket(ctx, tx, idempotencyBucketName)
+		if err != nil {
+			return err
+		}
+		b, err := createTenantBucket(ctx, tx, bucketName)
+		if err != nil {
+			return err
+		}
+
+		// The owner is part of the bucket key, so clients sharing a key
+		// string never see each other's records.
+		fp := fingerprint(c)
+
+		// An expired key is overwritten below.
+		kr, live, err := s.liveKey(ctx, keys, key)
+		if err != nil {
+			return err
+		}
+		if live {
+			if kr.Fingerprint != fp {
+				return ErrKeyReused
+			}
+			existing := b.Get([]byte(kr.ID))
+			if existing == nil {
+				archived, err := s.chargebacks.archived(ctx, tx, kr.ID)
+				if err != nil {
+					return err
+				}
+				if archived == nil {
+					return ErrNotFound
+				}
+				result = *archived
+				return nil
+			}
+			return s.decode(bucketName, existing, &result)
+		}
+
+		c.Owner = OwnerFrom(ctx)
+		c.RequestID = RequestIDFrom(ctx)
+		now := now(ctx)
+		c.CreatedAt = now
+		c.UpdatedAt = now
+		c.Version = 1
+
+		data, err := s.encode(bucketName, c)
+		if err != nil {
+			return err
+		}
+		entry, err := json.Marshal(keyRecord{ID: c.ID, Fingerprint: fp, CreatedAt: now})
+		if err != nil {
+			return err
+		}
+		if err := b.Put([]byte(c.ID), data); err != nil {
+			return err
+		}
+		if err := s.chargebacks.index(ctx, tx, c); err != nil {
+			return err
+		}
+		if err := rollup(ctx, tx, nil, c); err != nil {
+			return err
+		}
+
+		if err := keys.Put(scopedKey(ctx, createOp, key), entry); err != nil {
+			return err
+		}
+		result = *c
+		created = true
+		return fence(ctx, tx)
+	})
+	span.SetAttributes(attribute.String("idempotency.outcome", outcome(created, "created", "replayed")))
+	endSpan(span, err)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return &result, created, nil
+}
+
+// SetKeyTTL makes idempotency keys – those of CreateWithKey and saved
+// responses – expire ttl after their first use: a later request with the
+// key is a new request. Zero, the default, keeps them until ExpireKey
+// removes them. Expired keys are ignored at once and deleted by SweepKeys.
+// Like AddMigration, it must be called before the store is used.
+func (s *Store) SetKeyTTL(ttl time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keyTTL = ttl
+}
+
+// expiry returns when a key first used at createdAt expires, or the zero
+// time if keys do not expire.
+func (s *Store) expiry(createdAt time.Time) time.Time {
+	if s.keyTTL <= 0 {
+		return time.Time{}
+	}
+	return createdAt.Add(s.keyTTL)
+}
+
+// expired reports whether a key first used at createdAt has expired by the
+// time in ctx.
+func (s *Store) expired(ctx context.Context, createdAt time.Time) bool {
+	exp := s.expiry(createdAt)
+	return !exp.IsZero() && !now(ctx).Before(exp)
+}
+
+// liveKey returns the record of the create key in keys, with ok false if
+// there is none or it has expired.
+func (s *Store) liveKey(ctx context.Context, keys *bolt.Bucket, key string) (keyRecord, bool, error) {
+	var kr keyRecord
+	v := lookup(ctx, keys, createOp, key)
+	if v == nil {
+		return kr, false, nil
+	}
+	if err := json.Unmarshal(v, &kr); err != nil {
+		return kr, false, err
+	}
+	return kr, !s.expired(ctx, kr.CreatedAt), nil
+}
+
+// KeyInfo describes a stored idempotency key, for inspection by operators.
+type KeyInfo struct {
+	Key   string `json:"key"`
+	Owner string `json:"owner,omitempty"`
+
+	// Kind is "create" for keys recorded by CreateWithKey, which map to the
+	// record they created, and "response" for responses saved by
+	// SaveResponse.
+	Kind string `json:"kind"`
+
+	// Operation is the operation the key was sent to, which namespaces it:
+	// "create" for CreateWithKey, the gRPC method or GraphQL mutation for a
+	// saved response. It is empty for responses saved before keys were
+	// namespaced, which answer any operation.
+	Operation string `json:"operation,omitempty"`
+
+	RecordID     string    `json:"recordId,omitempty"`
+	ResponseType string    `json:"responseType,omitempty"`
+	Fingerprint  string    `json:"fingerprint"`
+	CreatedAt    time.Time `json:"createdAt"`
+
+	// ExpiresAt is when the key stops being honoured; absent when keys do
+	// not expire.
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
+
+// KeyQuery selects the idempotency keys IdempotencyKeys lists.
+type KeyQuery struct {
+	// Prefix keeps the keys starting with it.
+	Prefix string
+
+	// Operation, when set, keeps the keys of that operation.
+	Operation string
+
+	// CreatedAfter and CreatedBefore, when set, keep the keys first used
+	// strictly after and strictly before them.
+	CreatedAfter, CreatedBefore time.Time
+
+	// Limit caps the number of keys returned; zero returns them all.
+	Limit int
+
+	// Cursor resumes a listing where the page that returned it ended.
+	Cursor string
+}
+
+// ErrInvalidCursor is returned by IdempotencyKeys for a cursor it did not
+// issue.
+var ErrInvalidCursor = newError(ErrValidation, "invalid cursor")
+
+// keyKinds are the buckets IdempotencyKeys lists, in order, by KeyInfo.Kind.
+var keyKinds = []struct{ kind, bucket string }{
+	{"create", idempotencyBucketName},
+	{"response", responsesBucketName},
+}
+
+// IdempotencyKeys returns the live idempotency keys of the tenant in ctx that
+// q selects, for every owner: it is meant for operators, not clients. Keys
+// recorded by CreateWithKey come first, then saved responses, each sorted by
+// owner, operation and key.
+//
+// With a Limit, next is a cursor for the following page, or "" on the last.
+// Cursors name the last key returned, so a listing resumed after writes
+// neither repeats nor skips the keys that were already there.
+func (s *Store) IdempotencyKeys(ctx context.Context, q KeyQuery) (keys []KeyInfo, next string, err error) {
+	start, from, err := parseKeyCursor(q.Cursor)
+	if err != nil {
+		return nil, "", err
+	}
+	keys = []KeyInfo{}
+	var last struct {
+		kind int
+		k    []byte
+	}
+	err = s.view(ctx, func(tx *bolt.Tx) error {
+		for i := start; i < len(keyKinds); i++ {
+			b := tenantBucket(ctx, tx, keyKinds[i].bucket)
+			if b == nil {
+				continue
+			}
+			c := b.Cursor()
+			k, v := c.First()
+			if i == start && from != nil {
+				if k, v = c.Seek(from); k != nil && bytes.Equal(k, from) {
+					k, v = c.Next()
+				}
+			}
+			for ; k != nil; k, v = c.Next() {
+				info, err := keyInfo(keyKinds[i].kind, k, v)
+				if err != nil {
+					return err
+				}
+				if !s.selects(ctx, q, &info) {
+					continue
+				}
+				if q.Limit > 0 && len(keys) == q.Limit {
+					next = keyCursor(keyKinds[last.kind].kind, last.k)
+					return nil
+				}
+				keys = append(keys, info)
+				last.kind, last.k = i, append(last.k[:0], k...)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return keys, next, nil
+}
+
+// keyInfo describes the key k of kind, stored as v.
+func keyInfo(kind string, k, v []byte) (KeyInfo, error) {
+	owner, op, key := splitKey(k)
+	info := KeyInfo{Key: key, Owner: owner, Kind: kind, Operation: op}
+	if kind == "create" {
+		info.Operation = createOp
+		var kr keyRecord
+		if err := json.Unmarshal(v, &kr); err != nil {
+			return info, err
+		}
+		info.RecordID, info.Fingerprint, info.CreatedAt = kr.ID, kr.Fingerprint, kr.CreatedAt
+		return info, nil
+	}
+	var resp Response
+	if err := json.Unmarshal(v, &resp); err != nil {
+		return info, err
+	}
+	info.ResponseType, info.Fingerprint, info.CreatedAt = resp.Type, resp.Fingerprint, resp.CreatedAt
+	return info, nil
+}
+
+// selects reports whether info is live and matches q, setting its ExpiresAt.
+func (s *Store) selects(ctx context.Context, q KeyQuery, info *KeyInfo) bool {
+	if !strings.HasPrefix(info.Key, q.Prefix) || s.expired(ctx, info.CreatedAt) {
+		return false
+	}
+	if q.Operation != "" && info.Operation != q.Operation {
+		return false
+	}
+	if !q.CreatedAfter.IsZero() && !info.CreatedAt.After(q.CreatedAfter) {
+		return false
+	}
+	if !q.CreatedBefore.IsZero() && !info.CreatedAt.Before(q.CreatedBefore) {
+		return false
+	}
+	if exp := s.expiry(info.CreatedAt); !exp.IsZero() {
+		info.ExpiresAt = &exp
+	}
+	return true
+}
+
+// keyCursor returns the cursor naming the key stored as k in the bucket of
+// kind.
+func keyCursor(kind string, k []byte) string {
+	return base64.RawURLEncoding.EncodeToString(append([]byte(kind+":"), k...))
+}
+
+// parseKeyCursor returns the index in keyKinds and the bucket key a cursor
+// names; an empty cursor names the start.
+func parseKeyCursor(cursor string) (int, []byte, error) {
+	if cursor == "" {
+		return 0, nil, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, nil, ErrInvalidCursor
+	}
+	kind, k, ok := strings.Cut(string(raw), ":")
+	for i, kk := range keyKinds {
+		if ok && kk.kind == kind {
+			return i, []byte(k), nil
+		}
+	}
+	return 0, nil, ErrInvalidCursor
+}
+
+// ExpireKey deletes the idempotency key of the tenant in ctx – the record of
+// a CreateWithKey and any saved response – so that the next request with it
+// is processed anew. It deletes the key of the operation op, or of every
+// operation if op is "", and with anyOwner the key of every owner, otherwise
+// only that of the owner in ctx. It returns how many entries it deleted;
+// none is not an error. The records the key created are kept.
+func (s *Store) ExpireKey(ctx context.Context, op, key string, anyOwner bool) (int, error) {
+	_, span := startSpan(ctx, "store.ExpireKey", "")
+	n := 0
+	err := s.update(ctx, func(tx *bolt.Tx) error {
+		n = 0
+		for _, kk := range keyKinds {
+			b := tenantBucket(ctx, tx, kk.bucket)
+			if b == nil {
+				continue
+			}
+			var doomed [][]byte
+			err := b.ForEach(func(k, _ []byte) error {
+				kowner, kop, kkey := splitKey(k)
+				if kk.kind == "create" {
+					kop = createOp
+				}
+				if kkey == key && (anyOwner || kowner == OwnerFrom(ctx)) && (op == "" || kop == op) {
+					doomed = append(doomed, append([]byte(nil), k...))
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			for _, k := range doomed {
+				if err := b.Delete(k); err != nil {
+					return err
+				}
+			}
+			n += len(doomed)
+		}
+		return nil
+	})
+	span.SetAttributes(attribute.Int("idempotency.keys", n))
+	endSpan(span, err)
+	return n, err
+}
+
+// SweepKeys deletes the idempotency keys of every tenant that have expired
+// by now, returning how many it deleted. Expired keys are already ignored;
+// sweeping reclaims their space. It does nothing if keys do not expire.
+func (s *Store) SweepKeys(ctx context.Context, now time.Time) (int, error) {
+	if s.keyTTL <= 0 {
+		return 0, nil
+	}
+	ctx = WithTime(ctx, now)
+	n := 0
+	err := s.maintain(ctx, func(tx *bolt.Tx) error {
+		n = 0
+		parents, err := tenantParents(tx)
+		if err != nil {
+			return err
+		}
+		for _, p := range parents {
+			for _, kk := range keyKinds {
+				b := p.Bucket([]byte(kk.bucket))
+				if b == nil {
+					continue
+				}
+				var doomed [][]byte
+				err := b.ForEach(func(k, v []byte) error {
+					info, err := keyInfo(kk.kind, k, v)
+					if err != nil {
+						return err
+					}
+					if s.expired(ctx, info.CreatedAt) {
+						doomed = append(doomed, append([]byte(nil), k...))
+					}
+					return nil
+				})
+				if err != nil {
+					return err
+				}
+				for _, k := range doomed {
+					if err := b.Delete(k); err != nil {
+						return err
+					}
+				}
+				n += len(doomed)
+			}
+		}
+		return nil
+	})
+	return n, err
+}
@@ -0,0 +1,164 @@
+package store_test
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	bolt "github.com/boltdb/bolt"
+
+	"github.com/arkantrust/idempotency-example/backend/models"
+	"github.com/arkantrust/idempotency-example/backend/store"
+)
+
+func TestIdempotencyKeysPaginate(t *testing.T) {
+	s := newTestStore(t)
+	start := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	for i := range 5 {
+		at := store.WithTime(ctx, start.Add(time.Duration(i)*time.Hour))
+		if _, _, err := s.CreateWithKey(at, fmt.Sprint("key-", i), &models.Chargeback{ID: models.NewID(), Amount: 1, Currency: "USD"}); err != nil {
+			t.Fatalf("create failed: %v", err)
+		}
+	}
+	if _, err := s.SaveResponse(ctx, "/svc/Method", "rpc-1", &store.Response{Type: "t", CreatedAt: start}); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+
+	var all []string
+	cursor := ""
+	for pages := 0; ; pages++ {
+		keys, next, err := s.IdempotencyKeys(ctx, store.KeyQuery{Limit: 2, Cursor: cursor})
+		if err != nil || len(keys) == 0 || len(keys) > 2 || pages > 3 {
+			t.Fatalf("unexpected page %d: %+v %q %v", pages, keys, next, err)
+		}
+		for _, k := range keys {
+			all = append(all, k.Kind+":"+k.Key)
+		}
+		if cursor = next; cursor == "" {
+			break
+		}
+	}
+	if fmt.Sprint(all) != "[create:key-0 create:key-1 create:key-2 create:key-3 create:key-4 response:rpc-1]" {
+		t.Fatalf("expected every key once, in order, got %v", all)
+	}
+
+	// The creation range selects by age.
+	keys, _, err := s.IdempotencyKeys(ctx, store.KeyQuery{CreatedAfter: start, CreatedBefore: start.Add(3 * time.Hour)})
+	if err != nil || len(keys) != 2 || keys[0].Key != "key-1" || keys[1].Key != "key-2" {
+		t.Fatalf("expected key-1 and key-2, got %+v %v", keys, err)
+	}
+
+	if _, _, err := s.IdempotencyKeys(ctx, store.KeyQuery{Cursor: "bogus!"}); !errors.Is(err, store.ErrInvalidCursor) {
+		t.Fatalf("expected ErrInvalidCursor, got %v", err)
+	}
+}
+
+func TestIdempotencyKeysExpire(t *testing.T) {
+	s := newTestStore(t)
+	s.SetKeyTTL(24 * time.Hour)
+	start := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	day := store.WithTime(ctx, start)
+	cb := func() *models.Chargeback {
+		return &models.Chargeback{ID: models.NewID(), Amount: 1, Currency: "USD", Reason: "fraud"}
+	}
+
+	first, _, err := s.CreateWithKey(day, "key-1", cb())
+	if err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+	keys, _, err := s.IdempotencyKeys(day, store.KeyQuery{})
+	if err != nil || len(keys) != 1 || keys[0].ExpiresAt == nil || !keys[0].ExpiresAt.Equal(start.Add(24*time.Hour)) {
+		t.Fatalf("expected key-1 expiring a day later, got %+v %v", keys, err)
+	}
+
+	// Within the TTL a retry replays; after it, the key is new again.
+	if again, created, err := s.CreateWithKey(store.WithTime(ctx, start.Add(23*time.Hour)), "key-1", cb()); err != nil || created || again.ID != first.ID {
+		t.Fatalf("expected a replay within the TTL, got %+v %v %v", again, created, err)
+	}
+	later := store.WithTime(ctx, start.Add(25*time.Hour))
+	if keys, _, err := s.IdempotencyKeys(later, store.KeyQuery{}); err != nil || len(keys) != 0 {
+		t.Fatalf("expected the expired key hidden, got %+v %v", keys, err)
+	}
+	second, created, err := s.CreateWithKey(later, "key-1", cb())
+	if err != nil || !created || second.ID == first.ID {
+		t.Fatalf("expected a new record once the key expired, got %+v %v %v", second, created, err)
+	}
+
+	if n, err := s.SweepKeys(ctx, start.Add(72*time.Hour)); err != nil || n != 1 {
+		t.Fatalf("expected the reused key swept, got %d %v", n, err)
+	}
+}
+
+func TestExpireKey(t *testing.T) {
+	s := newTestStore(t)
+	alice, bob := store.WithOwner(ctx, "alice"), store.WithOwner(ctx, "bob")
+	first, _, err := s.CreateWithKey(alice, "key-1", &models.Chargeback{ID: models.NewID(), Amount: 1, Currency: "USD"})
+	if err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+	if _, _, err := s.CreateWithKey(bob, "key-1", &models.Chargeback{ID: models.NewID(), Amount: 1, Currency: "USD"}); err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+
+	if n, err := s.ExpireKey(alice, "", "key-1", false); err != nil || n != 1 {
+		t.Fatalf("expected alice's key expired, got %d %v", n, err)
+	}
+	if _, created, err := s.CreateWithKey(alice, "key-1", &models.Chargeback{ID: models.NewID(), Amount: 1, Currency: "USD"}); err != nil || !created {
+		t.Fatalf("expected the expired key to create anew, got %v %v", created, err)
+	}
+	if _, err := s.Get(alice, first.ID); err != nil {
+		t.Fatalf("expected the first record kept, got %v", err)
+	}
+
+	if n, err := s.ExpireKey(ctx, "", "key-1", true); err != nil || n != 2 {
+		t.Fatalf("expected both owners' keys expired, got %d %v", n, err)
+	}
+	if n, err := s.ExpireKey(ctx, "", "key-1", true); err != nil || n != 0 {
+		t.Fatalf("expected nothing left to expire, got %d %v", n, err)
+	}
+}
+
+func TestKeysAreNamespacedByOperation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.db")
+	s, err := store.New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.SaveResponse(ctx, "/svc/Create", "key-1", &store.Response{Fingerprint: "a", CreatedAt: time.Now()}); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+	if _, err := s.LoadResponse(ctx, "/svc/Update", "key-1"); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("expected the key unknown to another operation, got %v", err)
+	}
+	if saved, err := s.SaveResponse(ctx, "/svc/Update", "key-1", &store.Response{Fingerprint: "b", CreatedAt: time.Now()}); err != nil || saved.Fingerprint != "b" {
+		t.Fatalf("expected a response of its own for the other operation, got %+v %v", saved, err)
+	}
+	keys, _, err := s.IdempotencyKeys(ctx, store.KeyQuery{Operation: "/svc/Update"})
+	if err != nil || len(keys) != 1 || keys[0].Fingerprint != "b" {
+		t.Fatalf("expected the update's key alone, got %+v %v", keys, err)
+	}
+	s.Close()
+
+	// Responses saved before keys were namespaced answer every operation.
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte("responses")).Put([]byte("\x00old"), []byte(`{"fingerprint":"c","createdAt":"2025-01-01T00:00:00Z"}`))
+	})
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err = store.New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if resp, err := s.LoadResponse(ctx, "/svc/Create", "old"); err != nil || resp.Fingerprint != "c" {
+		t.Fatalf("expected the legacy response, got %+v %v", resp, err)
+	}
+}
@@ -0,0 +1,400 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	bolt "github.com/boltdb/bolt"
+
+	"github.com/arkantrust/idempotency-example/backend/models"
+)
+
+// Background jobs live at the root of the file, outside every tenant: a job
+// is the server's work, not a client's.
+//
+//	jobs/<id>              the jobs, by ID
+//	jobs_due/<runAt><id>   the pending jobs, in the order they are due
+//	job_keys/<key>         the ID of the job enqueued with each key
+//	dead_letters/<id>      the failed jobs moved out of the queue, by ID
+//
+// Job bookkeeping is maintenance, so the queue keeps running – backups and
+// archival included – in ModeMaintenance.
+const (
+	jobsBucketName    = "jobs"
+	jobsDueBucketName = "jobs_due"
+	jobKeysBucketName = "job_keys"
+	deadLettersName   = "dead_letters"
+)
+
+// EnqueueJob stores j as a pending job due at j.RunAt, or at once when that
+// is zero, and returns it with created true. A job with a Key is enqueued
+// once: if a job was already enqueued with that key, it is returned as it is
+// now, with created false.
+func (s *Store) EnqueueJob(ctx context.Context, j *models.Job) (job *models.Job, created bool, err error) {
+	_, span := startSpan(ctx, "store.EnqueueJob", "")
+	defer func() { endSpan(span, err) }()
+	err = s.maintain(ctx, func(tx *bolt.Tx) error {
+		keys, err := tx.CreateBucketIfNotExists([]byte(jobKeysBucketName))
+		if err != nil {
+			return err
+		}
+		if j.Key != "" {
+			if id := keys.Get([]byte(j.Key)); id != nil {
+				job, err = s.jobIn(tx, string(id))
+				return err
+			}
+		}
+
+		t := now(ctx)
+		job = &models.Job{
+			ID:          models.NewID(),
+			Kind:        j.Kind,
+			Key:         j.Key,
+			Payload:     j.Payload,
+			Status:      models.JobPending,
+			MaxAttempts: j.MaxAttempts,
+			RunAt:       j.RunAt,
+			CreatedAt:   t,
+			UpdatedAt:   t,
+		}
+		if job.RunAt.IsZero() {
+			job.RunAt = t
+		}
+		if err := s.putJob(tx, nil, job); err != nil {
+			return err
+		}
+		created = true
+		if j.Key == "" {
+			return nil
+		}
+		return keys.Put([]byte(j.Key), []byte(job.ID))
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return job, created, nil
+}
+
+// ClaimJob marks the pending job due first as running, counting the attempt,
+// and returns it; nil when no job is due by now.
+func (s *Store) ClaimJob(ctx context.Context) (*models.Job, error) {
+	var job *models.Job
+	err := s.maintain(ctx, func(tx *bolt.Tx) error {
+		job = nil
+		due := tx.Bucket([]byte(jobsDueBucketName))
+		if due == nil {
+			return nil
+		}
+		k, _ := due.Cursor().First()
+		if k == nil || bytes.Compare(k[:createdPrefix], createdKey(now(ctx), "")) > 0 {
+			return nil
+		}
+		old, err := s.jobIn(tx, string(k[createdPrefix:]))
+		if err != nil {
+			return err
+		}
+		claimed := *old
+		claimed.Status = models.JobRunning
+		claimed.Attempts++
+		claimed.UpdatedAt = now(ctx)
+		if err := s.putJob(tx, old, &claimed); err != nil {
+			return err
+		}
+		job = &claimed
+		return nil
+	})
+	return job, err
+}
+
+// UpdateJob applies fn to the job id and stores the result, moving it into
+// or out of the due jobs as its status and RunAt say.
+func (s *Store) UpdateJob(ctx context.Context, id string, fn func(*models.Job)) error {
+	return s.maintain(ctx, func(tx *bolt.Tx) error {
+		old, err := s.jobIn(tx, id)
+		if err != nil {
+			return err
+		}
+		return s.putJob(tx, old, applyJob(ctx, old, fn))
+	})
+}
+
+// DeadLetterJob applies fn to the job id, which must leave it failed, and
+// moves the result out of the queue into the dead letters. Its key is freed:
+// enqueueing with it again enqueues a new job.
+func (s *Store) DeadLetterJob(ctx context.Context, id string, fn func(*models.Job)) error {
+	return s.maintain(ctx, func(tx *bolt.Tx) error {
+		old, err := s.jobIn(tx, id)
+		if err != nil {
+			return err
+		}
+		j := applyJob(ctx, old, fn)
+		if j.Status != models.JobFailed {
+			return fmt.Errorf("job %s is %s, not failed", id, j.Status)
+		}
+		if err := s.deleteJob(tx, old); err != nil {
+			return err
+		}
+		dead, err := tx.CreateBucketIfNotExists([]byte(deadLettersName))
+		if err != nil {
+			return err
+		}
+		data, err := s.encode(deadLettersName, j)
+		if err != nil {
+			return err
+		}
+		return dead.Put([]byte(j.ID), data)
+	})
+}
+
+// DeadLetter returns the dead letter id, or ErrNotFound.
+func (s *Store) DeadLetter(ctx context.Context, id string) (*models.Job, error) {
+	var job *models.Job
+	err := s.view(ctx, func(tx *bolt.Tx) error {
+		var err error
+		job, err = s.deadLetterIn(tx, id)
+		return err
+	})
+	return job, err
+}
+
+// DeadLetters returns the dead letters q selects, like Jobs; q.Status is
+// ignored, since every dead letter failed.
+func (s *Store) DeadLetters(ctx context.Context, q JobQuery) (jobs []models.Job, next string, err error) {
+	q.Status = ""
+	return s.listJobs(ctx, deadLettersName, q)
+}
+
+// RequeueDeadLetter moves the dead letter id back into the queue as a
+// pending job due at once, with its attempts reset and its failure history
+// kept, and returns it; ErrNotFound if there is no such dead letter, which
+// includes one already requeued. It takes its key back unless another job
+// has taken it since.
+func (s *Store) RequeueDeadLetter(ctx context.Context, id string) (*models.Job, error) {
+	var job *models.Job
+	err := s.maintain(ctx, func(tx *bolt.Tx) error {
+		j, err := s.deadLetterIn(tx, id)
+		if err != nil {
+			return err
+		}
+		if err := tx.Bucket([]byte(deadLettersName)).Delete([]byte(id)); err != nil {
+			return err
+		}
+		t := now(ctx)
+		j.Status, j.Attempts, j.LastError = models.JobPending, 0, ""
+		j.RunAt, j.UpdatedAt, j.FinishedAt = t, t, nil
+		if err := s.putJob(tx, nil, j); err != nil {
+			return err
+		}
+		job = j
+		if j.Key == "" {
+			return nil
+		}
+		keys, err := tx.CreateBucketIfNotExists([]byte(jobKeysBucketName))
+		if err != nil {
+			return err
+		}
+		if keys.Get([]byte(j.Key)) != nil {
+			return nil
+		}
+		return keys.Put([]byte(j.Key), []byte(j.ID))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// ResumeJobs returns the jobs left running by an earlier process, which
+// stopped before they finished, to the due jobs, and returns how many there
+// were. Their attempts stay counted.
+func (s *Store) ResumeJobs(ctx context.Context) (int, error) {
+	n := 0
+	err := s.maintain(ctx, func(tx *bolt.Tx) error {
+		n = 0
+		b := tx.Bucket([]byte(jobsBucketName))
+		if b == nil {
+			return nil
+		}
+		var running []*models.Job
+		err := b.ForEach(func(_, v []byte) error {
+			var j models.Job
+			if err := s.decode(jobsBucketName, v, &j); err != nil {
+				return err
+			}
+			if j.Status == models.JobRunning {
+				running = append(running, &j)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, old := range running {
+			j := *old
+			j.Status, j.RunAt, j.UpdatedAt = models.JobPending, now(ctx), now(ctx)
+			if err := s.putJob(tx, old, &j); err != nil {
+				return err
+			}
+		}
+		n = len(running)
+		return nil
+	})
+	return n, err
+}
+
+// Job returns the job id, or ErrNotFound.
+func (s *Store) Job(ctx context.Context, id string) (*models.Job, error) {
+	var job *models.Job
+	err := s.view(ctx, func(tx *bolt.Tx) error {
+		var err error
+		job, err = s.jobIn(tx, id)
+		return err
+	})
+	return job, err
+}
+
+// JobQuery selects the jobs Jobs lists. Zero fields select everything.
+type JobQuery struct {
+	Status models.JobStatus
+	Kind   string
+
+	// Limit bounds the page; zero means no limit.
+	Limit int
+
+	// Cursor resumes a listing after the job with this ID.
+	Cursor string
+}
+
+// Jobs returns the jobs q selects, oldest first. With a Limit, next is the
+// cursor for the following page, or "" on the last.
+func (s *Store) Jobs(ctx context.Context, q JobQuery) (jobs []models.Job, next string, err error) {
+	return s.listJobs(ctx, jobsBucketName, q)
+}
+
+// listJobs lists the jobs of bucket q selects.
+func (s *Store) listJobs(ctx context.Context, bucket string, q JobQuery) (jobs []models.Job, next string, err error) {
+	jobs = []models.Job{}
+	err = s.view(ctx, func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucket))
+		if b == nil {
+			return nil
+		}
+		c := b.Cursor()
+		k, v := c.First()
+		if q.Cursor != "" {
+			if k, v = c.Seek([]byte(q.Cursor)); k != nil && string(k) == q.Cursor {
+				k, v = c.Next()
+			}
+		}
+		for ; k != nil; k, v = c.Next() {
+			var j models.Job
+			if err := s.decode(bucket, v, &j); err != nil {
+				return err
+			}
+			if (q.Status != "" && j.Status != q.Status) || (q.Kind != "" && j.Kind != q.Kind) {
+				continue
+			}
+			if q.Limit > 0 && len(jobs) == q.Limit {
+				next = jobs[len(jobs)-1].ID
+				return nil
+			}
+			jobs = append(jobs, j)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return jobs, next, nil
+}
+
+// jobIn returns the job id in tx, or ErrNotFound.
+func (s *Store) jobIn(tx *bolt.Tx, id string) (*models.Job, error) {
+	b := tx.Bucket([]byte(jobsBucketName))
+	if b == nil {
+		return nil, ErrNotFound
+	}
+	v := b.Get([]byte(id))
+	if v == nil {
+		return nil, ErrNotFound
+	}
+	var j models.Job
+	if err := s.decode(jobsBucketName, v, &j); err != nil {
+		return nil, err
+	}
+	return &j, nil
+}
+
+// deadLetterIn returns the dead letter id in tx, or ErrNotFound.
+func (s *Store) deadLetterIn(tx *bolt.Tx, id string) (*models.Job, error) {
+	b := tx.Bucket([]byte(deadLettersName))
+	if b == nil {
+		return nil, ErrNotFound
+	}
+	v := b.Get([]byte(id))
+	if v == nil {
+		return nil, ErrNotFound
+	}
+	var j models.Job
+	if err := s.decode(deadLettersName, v, &j); err != nil {
+		return nil, err
+	}
+	return &j, nil
+}
+
+// applyJob returns a copy of old changed by fn, stamped as updated now and,
+// once it is done, as finished.
+func applyJob(ctx context.Context, old *models.Job, fn func(*models.Job)) *models.Job {
+	j := *old
+	fn(&j)
+	j.UpdatedAt = now(ctx)
+	if j.Done() && j.FinishedAt == nil {
+		t := j.UpdatedAt
+		j.FinishedAt = &t
+	}
+	return &j
+}
+
+// deleteJob removes j from tx, with its key.
+func (s *Store) deleteJob(tx *bolt.Tx, j *models.Job) error {
+	if j.Status == models.JobPending {
+		if err := tx.Bucket([]byte(jobsDueBucketName)).Delete(createdKey(j.RunAt, j.ID)); err != nil {
+			return err
+		}
+	}
+	if keys := tx.Bucket([]byte(jobKeysBucketName)); keys != nil && j.Key != "" && string(keys.Get([]byte(j.Key))) == j.ID {
+		if err := keys.Delete([]byte(j.Key)); err != nil {
+			return err
+		}
+	}
+	return tx.Bucket([]byte(jobsBucketName)).Delete([]byte(j.ID))
+}
+
+// putJob stores j in tx, replacing old, and keeps the due jobs in step: a
+// pending job is due at its RunAt, any other is not due at all.
+func (s *Store) putJob(tx *bolt.Tx, old, j *models.Job) error {
+	jobs, err := tx.CreateBucketIfNotExists([]byte(jobsBucketName))
+	if err != nil {
+		return err
+	}
+	due, err := tx.CreateBucketIfNotExists([]byte(jobsDueBucketName))
+	if err != nil {
+		return err
+	}
+	if old != nil && old.Status == models.JobPending {
+		if err := due.Delete(createdKey(old.RunAt, old.ID)); err != nil {
+			return err
+		}
+	}
+	if j.Status == models.JobPending {
+		if err := due.Put(createdKey(j.RunAt, j.ID), []byte{}); err != nil {
+			return err
+		}
+	}
+	data, err := s.encode(jobsBucketName, j)
+	if err != nil {
+		return err
+	}
+	return jobs.Put([]byte(j.ID), data)
+}
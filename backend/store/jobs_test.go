@@ -0,0 +1,136 @@
+package store_test
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/arkantrust/idempotency-example/backend/models"
+	"github.com/arkantrust/idempotency-example/backend/store"
+)
+
+func TestEnqueueJobDeduplicatesOnKey(t *testing.T) {
+	s, err := store.New(filepath.Join(t.TempDir(), "jobs.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	first, created, err := s.EnqueueJob(ctx, &models.Job{Kind: "backup", Key: "backup:1"})
+	if err != nil || !created || first.Status != models.JobPending {
+		t.Fatalf("expected a pending job, got %+v %v %v", first, created, err)
+	}
+	again, created, err := s.EnqueueJob(ctx, &models.Job{Kind: "backup", Key: "backup:1"})
+	if err != nil || created || again.ID != first.ID {
+		t.Fatalf("expected the first job back, got %+v %v %v", again, created, err)
+	}
+	if _, created, _ := s.EnqueueJob(ctx, &models.Job{Kind: "backup"}); !created {
+		t.Fatal("expected a job without a key to be enqueued")
+	}
+	jobs, _, err := s.Jobs(ctx, store.JobQuery{})
+	if err != nil || len(jobs) != 2 {
+		t.Fatalf("expected 2 jobs, got %d %v", len(jobs), err)
+	}
+}
+
+func TestClaimJobTakesDueJobsInOrder(t *testing.T) {
+	s, err := store.New(filepath.Join(t.TempDir(), "jobs.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	t0 := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) *models.Job { return &models.Job{Kind: "k", RunAt: t0.Add(d)} }
+	later, _, _ := s.EnqueueJob(ctx, at(time.Minute))
+	sooner, _, _ := s.EnqueueJob(ctx, at(0))
+
+	job, err := s.ClaimJob(store.WithTime(ctx, t0))
+	if err != nil || job == nil || job.ID != sooner.ID || job.Status != models.JobRunning || job.Attempts != 1 {
+		t.Fatalf("expected to claim the sooner job, got %+v %v", job, err)
+	}
+	if job, err := s.ClaimJob(store.WithTime(ctx, t0)); err != nil || job != nil {
+		t.Fatalf("expected no job due yet, got %+v %v", job, err)
+	}
+
+	// A failed run is put back, due again later.
+	err = s.UpdateJob(ctx, sooner.ID, func(j *models.Job) {
+		j.Status, j.RunAt = models.JobPending, t0.Add(2*time.Minute)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job, _ := s.ClaimJob(store.WithTime(ctx, t0.Add(time.Minute))); job == nil || job.ID != later.ID {
+		t.Fatalf("expected to claim the later job, got %+v", job)
+	}
+	if job, _ := s.ClaimJob(store.WithTime(ctx, t0.Add(2*time.Minute))); job == nil || job.ID != sooner.ID || job.Attempts != 2 {
+		t.Fatalf("expected to claim the retried job, got %+v", job)
+	}
+
+	err = s.UpdateJob(ctx, sooner.ID, func(j *models.Job) { j.Status = models.JobSucceeded })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job, _ := s.Job(ctx, sooner.ID); job.FinishedAt == nil {
+		t.Fatalf("expected a finish time, got %+v", job)
+	}
+
+	// The later job was left running by a process that stopped.
+	if n, err := s.ResumeJobs(store.WithTime(ctx, t0.Add(3*time.Minute))); err != nil || n != 1 {
+		t.Fatalf("expected 1 job resumed, got %d %v", n, err)
+	}
+	if job, _ := s.ClaimJob(store.WithTime(ctx, t0.Add(3*time.Minute))); job == nil || job.ID != later.ID {
+		t.Fatalf("expected to claim the resumed job, got %+v", job)
+	}
+
+	done, next, err := s.Jobs(ctx, store.JobQuery{Status: models.JobSucceeded, Limit: 1})
+	if err != nil || len(done) != 1 || done[0].ID != sooner.ID || next != "" {
+		t.Fatalf("expected the succeeded job alone, got %+v %q %v", done, next, err)
+	}
+}
+
+func TestDeadLettersAreRequeuedOnce(t *testing.T) {
+	s, err := store.New(filepath.Join(t.TempDir(), "jobs.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	job, _, err := s.EnqueueJob(ctx, &models.Job{Kind: "webhook", Key: "evt-1 https://example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.ClaimJob(ctx); err != nil {
+		t.Fatal(err)
+	}
+	err = s.DeadLetterJob(ctx, job.ID, func(j *models.Job) {
+		j.Status = models.JobFailed
+		j.Failures = append(j.Failures, models.JobFailure{Attempt: j.Attempts, Error: "502"})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Job(ctx, job.ID); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("expected the job out of the queue, got %v", err)
+	}
+	dead, _, err := s.DeadLetters(ctx, store.JobQuery{Kind: "webhook"})
+	if err != nil || len(dead) != 1 || dead[0].ID != job.ID || len(dead[0].Failures) != 1 {
+		t.Fatalf("expected the dead letter with its failure, got %+v %v", dead, err)
+	}
+
+	requeued, err := s.RequeueDeadLetter(ctx, job.ID)
+	if err != nil || requeued.Status != models.JobPending || requeued.Attempts != 0 || len(requeued.Failures) != 1 {
+		t.Fatalf("expected the job pending again, got %+v %v", requeued, err)
+	}
+	if _, err := s.RequeueDeadLetter(ctx, job.ID); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("expected a second requeue to find nothing, got %v", err)
+	}
+	// It has its key back.
+	if again, created, err := s.EnqueueJob(ctx, &models.Job{Kind: "webhook", Key: job.Key}); err != nil || created || again.ID != job.ID {
+		t.Fatalf("expected the key to find the requeued job, got %+v %v %v", again, created, err)
+	}
+	if claimed, err := s.ClaimJob(ctx); err != nil || claimed == nil || claimed.ID != job.ID {
+		t.Fatalf("expected the requeued job due, got %+v %v", claimed, err)
+	}
+}
@@ -0,0 +1,162 @@
+package store
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	bolt "github.com/boltdb/bolt"
+
+	"github.com/arkantrust/idempotency-example/backend/models"
+)
+
+const keysBucketName = "apikeys"
+
+// keyPrefix marks plaintext keys so they are recognisable in config files
+// and secret scanners.
+const keyPrefix = "cbk_"
+
+// ErrInvalidKey is returned by LookupAPIKey for unknown or revoked keys. The
+// two cases are deliberately indistinguishable to callers.
+var ErrInvalidKey = errors.New("invalid API key")
+
+// hashKey returns the bucket key under which a plaintext key is stored.
+func hashKey(plaintext string) []byte {
+	sum := sha256.Sum256([]byte(plaintext))
+	return []byte(hex.EncodeToString(sum[:]))
+}
+
+// CreateAPIKey mints a new key with the given name and role, bound to tenant
+// unless tenant is empty, and returns its plaintext form together with its
+// metadata. The plaintext cannot be recovered later.
+func (s *Store) CreateAPIKey(ctx context.Context, name, tenant, role string) (string, *models.APIKey, error) {
+	var id, secret [16]byte
+	rand.Read(id[:])     //nolint:errcheck // crypto/rand.Read never fails
+	rand.Read(secret[:]) //nolint:errcheck
+
+	k := models.APIKey{
+		ID:        hex.EncodeToString(id[:8]),
+		Name:      name,
+		Tenant:    tenant,
+		Role:      role,
+		CreatedAt: time.Now().UTC(),
+	}
+	plaintext := keyPrefix + k.ID + "_" + hex.EncodeToString(secret[:])
+
+	data, err := json.Marshal(k)
+	if err != nil {
+		return "", nil, err
+	}
+	err = s.update(ctx, func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(keysBucketName))
+		if err != nil {
+			return err
+		}
+		return b.Put(hashKey(plaintext), data)
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	return plaintext, &k, nil
+}
+
+// LookupAPIKey returns the metadata for a plaintext key, or ErrInvalidKey if
+// it is unknown or revoked.
+func (s *Store) LookupAPIKey(ctx context.Context, plaintext string) (*models.APIKey, error) {
+	if !strings.HasPrefix(plaintext, keyPrefix) {
+		return nil, ErrInvalidKey
+	}
+
+	var k models.APIKey
+	err := s.view(ctx, func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(keysBucketName))
+		if b == nil {
+			return ErrInvalidKey
+		}
+		v := b.Get(hashKey(plaintext))
+		if v == nil {
+			return ErrInvalidKey
+		}
+		return json.Unmarshal(v, &k)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if k.RevokedAt != nil {
+		return nil, ErrInvalidKey
+	}
+	return &k, nil
+}
+
+// ListAPIKeys returns the metadata of every key, including revoked ones.
+func (s *Store) ListAPIKeys(ctx context.Context) ([]models.APIKey, error) {
+	keys := []models.APIKey{}
+	err := s.view(ctx, func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(keysBucketName))
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(_, v []byte) error {
+			var k models.APIKey
+			if err := json.Unmarshal(v, &k); err != nil {
+				return err
+			}
+			keys = append(keys, k)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// RevokeAPIKey marks the key with the given ID as revoked.
+//
+// Idempotency guarantee: revoking an already-revoked key is a no-op that
+// returns the original revocation, so RevokedAt never moves on retries.
+// Returns ErrNotFound if no key has that ID.
+func (s *Store) RevokeAPIKey(ctx context.Context, id string) (*models.APIKey, error) {
+	var result models.APIKey
+	err := s.update(ctx, func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(keysBucketName))
+		if b == nil {
+			return ErrNotFound
+		}
+
+		// Keys are stored by hash, so finding one by ID means a scan. The
+		// bucket holds one entry per client, which keeps this cheap.
+		c := b.Cursor()
+		for hk, v := c.First(); hk != nil; hk, v = c.Next() {
+			var k models.APIKey
+			if err := json.Unmarshal(v, &k); err != nil {
+				return err
+			}
+			if k.ID != id {
+				continue
+			}
+			if k.RevokedAt != nil {
+				result = k
+				return nil
+			}
+			now := time.Now().UTC()
+			k.RevokedAt = &now
+			data, err := json.Marshal(k)
+			if err != nil {
+				return err
+			}
+			result = k
+			return b.Put(hk, data)
+		}
+		return ErrNotFound
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
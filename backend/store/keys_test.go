@@ -0,0 +1,49 @@
+package store_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/arkantrust/idempotency-example/backend/store"
+)
+
+func TestAPIKeyLifecycle(t *testing.T) {
+	s := newTestStore(t)
+
+	plaintext, k, err := s.CreateAPIKey(ctx, "ci", "", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got, err := s.LookupAPIKey(ctx, plaintext)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.ID != k.ID {
+		t.Fatalf("expected key %q, got %q", k.ID, got.ID)
+	}
+	if _, err := s.LookupAPIKey(ctx, plaintext+"x"); !errors.Is(err, store.ErrInvalidKey) {
+		t.Fatalf("expected ErrInvalidKey for wrong secret, got %v", err)
+	}
+
+	first, err := s.RevokeAPIKey(ctx, k.ID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := s.LookupAPIKey(ctx, plaintext); !errors.Is(err, store.ErrInvalidKey) {
+		t.Fatalf("expected ErrInvalidKey after revocation, got %v", err)
+	}
+
+	// Revoking again is a no-op that keeps the original timestamp.
+	second, err := s.RevokeAPIKey(ctx, k.ID)
+	if err != nil {
+		t.Fatalf("unexpected error on retry: %v", err)
+	}
+	if !second.RevokedAt.Equal(*first.RevokedAt) {
+		t.Fatal("revokedAt should not change on repeated revocation")
+	}
+
+	if _, err := s.RevokeAPIKey(ctx, "missing"); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,121 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strconv"
+
+	bolt "github.com/boltdb/bolt"
+
+	"github.com/arkantrust/idempotency-example/backend/models"
+)
+
+// merchantsBucketName holds the merchants of each tenant, keyed by ID, and
+// merchantIndexBucketName indexes their chargebacks, keyed
+// <merchant id>\x00<chargeback id>, so that one merchant's chargebacks are
+// read without scanning the others.
+const (
+	merchantsBucketName     = "merchants"
+	merchantIndexBucketName = "chargebacks_by_merchant"
+)
+
+// Merchants returns the collection of merchants.
+func (s *Store) Merchants() *Collection[models.Merchant, *models.Merchant] {
+	return s.merchants
+}
+
+// ForEachOfMerchant calls fn with each chargeback of the merchant id visible
+// to the caller, in order of their IDs. It reads the merchant index, so it
+// costs what the merchant has, not what the tenant does.
+func (s *Store) ForEachOfMerchant(ctx context.Context, id string, fn func(models.Chargeback) error) error {
+	return s.view(ctx, func(tx *bolt.Tx) error {
+		return s.eachOfMerchant(ctx, tx, id, func(c *models.Chargeback) error {
+			if !visible(ctx, c) {
+				return nil
+			}
+			return fn(*c)
+		})
+	})
+}
+
+// MerchantStats is Stats for the chargebacks of the merchant id.
+func (s *Store) MerchantStats(ctx context.Context, id string) (*models.Stats, error) {
+	stats, err := s.stats(ctx, "store.MerchantStats", func(tx *bolt.Tx, fn func(*models.Chargeback) error) error {
+		return s.eachOfMerchant(ctx, tx, id, fn)
+	})
+	if err != nil {
+		return nil, err
+	}
+	stats.Merchant = id
+	return stats, nil
+}
+
+// eachOfMerchant calls fn with each chargeback in the index of the merchant
+// id, visible or not.
+func (s *Store) eachOfMerchant(ctx context.Context, tx *bolt.Tx, id string, fn func(*models.Chargeback) error) error {
+	idx := tenantBucket(ctx, tx, merchantIndexBucketName)
+	records := tenantBucket(ctx, tx, bucketName)
+	if idx == nil || records == nil {
+		return nil
+	}
+	prefix := merchantKey(id, "")
+	c := idx.Cursor()
+	for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+		v := records.Get(k[len(prefix):])
+		if v == nil {
+			continue
+		}
+		var cb models.Chargeback
+		if err := s.decode(bucketName, v, &cb); err != nil {
+			return err
+		}
+		// An entry left behind by a chargeback since recreated under
+		// another merchant is not this merchant's.
+		if cb.MerchantID != id {
+			continue
+		}
+		if err := fn(&cb); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkMerchant returns a *models.ValidationError unless c's merchant
+// exists and is visible to the caller.
+func (s *Store) checkMerchant(ctx context.Context, tx *bolt.Tx, c *models.Chargeback) error {
+	_, err := s.merchants.getIn(ctx, tx, c.MerchantID)
+	if errors.Is(err, ErrNotFound) {
+		return invalid("merchantId", "no merchant "+strconv.Quote(c.MerchantID))
+	}
+	return err
+}
+
+// indexMerchant moves a chargeback in the merchant index from old to new:
+// nil old for a create, nil new for a delete.
+func indexMerchant(ctx context.Context, tx *bolt.Tx, old, new *models.Chargeback) error {
+	if old != nil && new != nil && old.MerchantID == new.MerchantID {
+		return nil
+	}
+	if old != nil && old.MerchantID != "" {
+		if b := tenantBucket(ctx, tx, merchantIndexBucketName); b != nil {
+			if err := b.Delete(merchantKey(old.MerchantID, old.ID)); err != nil {
+				return err
+			}
+		}
+	}
+	if new != nil && new.MerchantID != "" {
+		b, err := createTenantBucket(ctx, tx, merchantIndexBucketName)
+		if err != nil {
+			return err
+		}
+		return b.Put(merchantKey(new.MerchantID, new.ID), []byte{})
+	}
+	return nil
+}
+
+// merchantKey is the index key of the chargeback id of the merchant.
+func merchantKey(merchant, id string) []byte {
+	return []byte(merchant + "\x00" + id)
+}
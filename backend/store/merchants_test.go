@@ -0,0 +1,96 @@
+package store_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/arkantrust/idempotency-example/backend/models"
+	"github.com/arkantrust/idempotency-example/backend/store"
+)
+
+func TestMerchantIndex(t *testing.T) {
+	s := newTestStore(t)
+	var ve *models.ValidationError
+	if _, _, err := s.Create(ctx, &models.Chargeback{ID: "cb-1", Amount: 100, Currency: "USD", Reason: "fraud", MerchantID: "m-1"}); !errors.As(err, &ve) {
+		t.Fatalf("expected the missing merchant refused, got %v", err)
+	}
+	for _, id := range []string{"m-1", "m-2"} {
+		if _, _, err := s.Merchants().Create(ctx, &models.Merchant{ID: id, Name: "Shop " + id}); err != nil {
+			t.Fatalf("create merchant: %v", err)
+		}
+	}
+	for _, c := range []models.Chargeback{
+		{ID: "cb-1", Amount: 100, Currency: "USD", Reason: "fraud", MerchantID: "m-1"},
+		{ID: "cb-2", Amount: 50, Currency: "EUR", Reason: "fraud", MerchantID: "m-2"},
+		{ID: "cb-3", Amount: 25, Currency: "USD", Reason: "fraud", MerchantID: "m-1"},
+		{ID: "cb-4", Amount: 10, Currency: "USD", Reason: "fraud"},
+	} {
+		if _, _, err := s.Create(ctx, &c); err != nil {
+			t.Fatalf("create %s: %v", c.ID, err)
+		}
+	}
+
+	ids := func(merchant string) []string {
+		var got []string
+		if err := s.ForEachOfMerchant(ctx, merchant, func(c models.Chargeback) error {
+			got = append(got, c.ID)
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+	if got := ids("m-1"); len(got) != 2 || got[0] != "cb-1" || got[1] != "cb-3" {
+		t.Fatalf("m-1: %v", got)
+	}
+
+	// Moving and deleting chargebacks moves them in the index.
+	if _, _, err := s.Update(ctx, "cb-3", &models.Chargeback{Amount: 25, Currency: "USD", Reason: "fraud", MerchantID: "m-2"}, nil); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if _, err := s.Delete(ctx, "cb-2"); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if got := ids("m-2"); len(got) != 1 || got[0] != "cb-3" {
+		t.Fatalf("m-2: %v", got)
+	}
+	stats, err := s.MerchantStats(ctx, "m-1")
+	if err != nil || stats.Merchant != "m-1" || stats.Count != 1 || stats.ByCurrency[0].Amount != 100 {
+		t.Fatalf("stats: %+v, %v", stats, err)
+	}
+
+	// Imports are checked and indexed like creates; a record refused is
+	// left out and the rest imported.
+	res, err := s.CreateMany(ctx, []*models.Chargeback{
+		{ID: "cb-5", Amount: 10, Currency: "USD", Reason: "fraud", MerchantID: "nope"},
+		{ID: "cb-6", Amount: 10, Currency: "USD", Reason: "fraud", MerchantID: "m-1"},
+	})
+	if err != nil || len(res.Created) != 1 || !errors.As(res.Failed[0], &ve) || res.Failed[1] != nil {
+		t.Fatalf("import: %+v, %v", res, err)
+	}
+	if got := ids("m-1"); len(got) != 2 || got[1] != "cb-6" {
+		t.Fatalf("m-1 after import: %v", got)
+	}
+
+	// Bulk deletes and archival take chargebacks out of the index too: a
+	// chargeback recreated under another merchant is only that one's.
+	if _, err := s.DeleteMatching(ctx, store.Filter{Currency: "USD"}); err != nil {
+		t.Fatalf("delete matching: %v", err)
+	}
+	if _, _, err := s.Create(ctx, &models.Chargeback{ID: "cb-1", Amount: 100, Currency: "USD", Reason: "fraud", MerchantID: "m-2"}); err != nil {
+		t.Fatalf("recreate: %v", err)
+	}
+	if got := ids("m-1"); len(got) != 0 {
+		t.Fatalf("m-1 after delete: %v", got)
+	}
+	if got := ids("m-2"); len(got) != 1 || got[0] != "cb-1" {
+		t.Fatalf("m-2 after recreate: %v", got)
+	}
+	if _, err := s.Archive(ctx, time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("archive: %v", err)
+	}
+	if got := ids("m-2"); len(got) != 0 {
+		t.Fatalf("m-2 after archive: %v", got)
+	}
+}
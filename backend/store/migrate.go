@@ -0,0 +1,271 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	bolt "github.com/boltdb/bolt"
+)
+
+// copyProgressBucketName holds, in a destination of CopyTo, how far an
+// unfinished copy got. It is neither copied nor compared.
+const copyProgressBucketName = "copy_progress"
+
+// copyCursorKey is the key of the path of the last entry copied.
+var copyCursorKey = []byte("cursor")
+
+// CopyStats reports what CopyTo did.
+type CopyStats struct {
+	// Copied counts the entries – values and buckets – this run copied,
+	// and Skipped those an earlier, interrupted run had.
+	Copied  int `json:"copied"`
+	Skipped int `json:"skipped"`
+}
+
+// entry is a value or, when bucket is set, a bucket of the tree of buckets,
+// at path.
+type entry struct {
+	path   [][]byte
+	bucket bool
+	seq    uint64
+	value  []byte
+}
+
+// walk calls fn with every entry of tx but the copy progress, depth first in
+// key order, each bucket before its contents.
+func walk(tx *bolt.Tx, fn func(entry) error) error {
+	return tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+		if string(name) == copyProgressBucketName {
+			return nil
+		}
+		return walkBucket(b, [][]byte{name}, fn)
+	})
+}
+
+func walkBucket(b *bolt.Bucket, path [][]byte, fn func(entry) error) error {
+	if err := fn(entry{path: path, bucket: true, seq: b.Sequence()}); err != nil {
+		return err
+	}
+	return b.ForEach(func(k, v []byte) error {
+		p := append(slices.Clip(path), k)
+		if v == nil {
+			return walkBucket(b.Bucket(k), p, fn)
+		}
+		return fn(entry{path: p, value: v})
+	})
+}
+
+// comparePaths orders paths as walk visits them.
+func comparePaths(a, b [][]byte) int {
+	for i := range min(len(a), len(b)) {
+		if c := bytes.Compare(a[i], b[i]); c != 0 {
+			return c
+		}
+	}
+	return len(a) - len(b)
+}
+
+// find returns the entry of tx at path.
+func find(tx *bolt.Tx, path [][]byte) (entry, bool) {
+	b := tx.Bucket(path[0])
+	for i, name := range path[1:] {
+		if b == nil {
+			return entry{}, false
+		}
+		if i == len(path)-2 {
+			if v := b.Get(name); v != nil {
+				return entry{path: path, value: v}, true
+			}
+		}
+		b = b.Bucket(name)
+	}
+	if b == nil {
+		return entry{}, false
+	}
+	return entry{path: path, bucket: true, seq: b.Sequence()}, true
+}
+
+// put writes e into tx, creating the buckets on its path.
+func put(tx *bolt.Tx, e entry) error {
+	b, err := tx.CreateBucketIfNotExists(e.path[0])
+	if err != nil {
+		return err
+	}
+	buckets := e.path[1:]
+	if !e.bucket {
+		buckets = e.path[1 : len(e.path)-1]
+	}
+	for _, name := range buckets {
+		if b, err = b.CreateBucketIfNotExists(name); err != nil {
+			return err
+		}
+	}
+	if e.bucket {
+		return b.SetSequence(e.seq)
+	}
+	return b.Put(e.path[len(e.path)-1], e.value)
+}
+
+// CopyTo copies every bucket of s into dst as it is – records, idempotency
+// keys, saved responses, jobs and the rest, with their encoding and bucket
+// sequences – batch entries per transaction. Entries dst already has are
+// overwritten; those s lacks are left alone, and reported by Diff.
+//
+// The copy is resumable: dst records the last entry each transaction copied,
+// and a CopyTo interrupted by an error or by ctx continues after it when run
+// again. Once the copy completes the record is removed, so running CopyTo
+// again copies everything anew. s must not change in between.
+func (s *Store) CopyTo(ctx context.Context, dst *Store, batch int) (CopyStats, error) {
+	var (
+		st     CopyStats
+		cursor [][]byte
+	)
+	err := dst.view(ctx, func(tx *bolt.Tx) error {
+		if b := tx.Bucket([]byte(copyProgressBucketName)); b != nil {
+			if v := b.Get(copyCursorKey); v != nil {
+				return json.Unmarshal(v, &cursor)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return st, err
+	}
+
+	var pending []entry
+	flush := func() error {
+		if len(pending) == 0 {
+			return nil
+		}
+		err := dst.maintain(ctx, func(tx *bolt.Tx) error {
+			for _, e := range pending {
+				if err := put(tx, e); err != nil {
+					return err
+				}
+			}
+			last, err := json.Marshal(pending[len(pending)-1].path)
+			if err != nil {
+				return err
+			}
+			b, err := tx.CreateBucketIfNotExists([]byte(copyProgressBucketName))
+			if err != nil {
+				return err
+			}
+			return b.Put(copyCursorKey, last)
+		})
+		if err != nil {
+			return err
+		}
+		st.Copied += len(pending)
+		pending = pending[:0]
+		return nil
+	}
+	err = s.view(ctx, func(tx *bolt.Tx) error {
+		err := walk(tx, func(e entry) error {
+			if cursor != nil && comparePaths(e.path, cursor) <= 0 {
+				st.Skipped++
+				return nil
+			}
+			pending = append(pending, e)
+			if len(pending) >= max(batch, 1) {
+				return flush()
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		return flush()
+	})
+	if err != nil {
+		return st, err
+	}
+	err = dst.maintain(ctx, func(tx *bolt.Tx) error {
+		if tx.Bucket([]byte(copyProgressBucketName)) == nil {
+			return nil
+		}
+		return tx.DeleteBucket([]byte(copyProgressBucketName))
+	})
+	return st, err
+}
+
+// diffExamples caps the entries a DiffReport names.
+const diffExamples = 20
+
+// DiffReport is the outcome of Diff.
+type DiffReport struct {
+	// Compared counts the entries of the source.
+	Compared int `json:"compared"`
+
+	// Missing counts the entries of the source the destination lacks,
+	// Different those it has with another value or bucket sequence, and
+	// Extra those only the destination has.
+	Missing   int `json:"missing"`
+	Different int `json:"different"`
+	Extra     int `json:"extra"`
+
+	// Examples names the first of them, e.g. "missing chargebacks/cb-1".
+	Examples []string `json:"examples,omitempty"`
+}
+
+// OK reports whether the destination holds exactly what the source does.
+func (r DiffReport) OK() bool {
+	return r.Missing == 0 && r.Different == 0 && r.Extra == 0
+}
+
+func (r *DiffReport) add(count *int, kind string, path [][]byte) {
+	*count++
+	if len(r.Examples) < diffExamples {
+		r.Examples = append(r.Examples, kind+" "+formatPath(path))
+	}
+}
+
+// Diff compares every entry of s with dst without changing either: the
+// verification of a CopyTo, or, before one, a dry run of what it would
+// copy. The copy progress of an unfinished CopyTo is not compared.
+func (s *Store) Diff(ctx context.Context, dst *Store) (DiffReport, error) {
+	var r DiffReport
+	err := s.view(ctx, func(stx *bolt.Tx) error {
+		return dst.view(ctx, func(dtx *bolt.Tx) error {
+			err := walk(stx, func(e entry) error {
+				r.Compared++
+				got, ok := find(dtx, e.path)
+				switch {
+				case !ok || got.bucket != e.bucket:
+					r.add(&r.Missing, "missing", e.path)
+				case got.seq != e.seq || !bytes.Equal(got.value, e.value):
+					r.add(&r.Different, "different", e.path)
+				}
+				return ctx.Err()
+			})
+			if err != nil {
+				return err
+			}
+			return walk(dtx, func(e entry) error {
+				if got, ok := find(stx, e.path); !ok || got.bucket != e.bucket {
+					r.add(&r.Extra, "extra", e.path)
+				}
+				return ctx.Err()
+			})
+		})
+	})
+	return r, err
+}
+
+// formatPath joins the keys of path with slashes, writing those that are not
+// printable text in hex.
+func formatPath(path [][]byte) string {
+	parts := make([]string, len(path))
+	for i, k := range path {
+		parts[i] = string(k)
+		if !utf8.Valid(k) || strings.ContainsFunc(parts[i], func(r rune) bool { return r < ' ' || r == '/' }) {
+			parts[i] = "0x" + hex.EncodeToString(k)
+		}
+	}
+	return strings.Join(parts, "/")
+}
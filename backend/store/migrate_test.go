@@ -0,0 +1,109 @@
+package store_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/arkantrust/idempotency-example/backend/models"
+	"github.com/arkantrust/idempotency-example/backend/store"
+)
+
+// interrupted is a context cancelled once Err has been asked n times.
+type interrupted struct {
+	context.Context
+	n int
+}
+
+func (c *interrupted) Err() error {
+	if c.n--; c.n < 0 {
+		return context.Canceled
+	}
+	return nil
+}
+
+func seedForCopy(t *testing.T, s *store.Store) {
+	t.Helper()
+	for i := range 10 {
+		cb := &models.Chargeback{ID: fmt.Sprintf("cb-%d", i), Amount: 100, Currency: "USD", Reason: "fraud"}
+		if _, _, err := s.Create(ctx, cb); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, _, err := s.CreateWithKey(ctx, "k-1", &models.Chargeback{ID: "minted", Amount: 5, Currency: "EUR", Reason: "duplicate"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.Create(store.WithTenant(ctx, "acme"), &models.Chargeback{ID: "cb-1", Amount: 7, Currency: "GBP", Reason: "fraud"}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCopyToResumes(t *testing.T) {
+	src, dst := newTestStore(t), newTestStore(t)
+	seedForCopy(t, src)
+
+	first, err := src.CopyTo(&interrupted{Context: ctx, n: 4}, dst, 3)
+	if !errors.Is(err, context.Canceled) || first.Copied != 6 {
+		t.Fatalf("interrupted copy = %+v, %v; want 6 copied, canceled", first, err)
+	}
+	if r, err := src.Diff(ctx, dst); err != nil || r.OK() {
+		t.Fatalf("diff after an interrupted copy = %+v, %v; want differences", r, err)
+	}
+
+	second, err := src.CopyTo(ctx, dst, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.Skipped != first.Copied || second.Copied == 0 {
+		t.Errorf("resumed copy = %+v, want the %d entries copied before skipped", second, first.Copied)
+	}
+	r, err := src.Diff(ctx, dst)
+	if err != nil || !r.OK() {
+		t.Fatalf("diff after the copy = %+v, %v; want none", r, err)
+	}
+
+	got, err := dst.Get(store.WithTenant(ctx, "acme"), "cb-1")
+	if err != nil || got.Amount != 7 {
+		t.Errorf("tenant record = %+v, %v; want it copied", got, err)
+	}
+	replay, created, err := dst.CreateWithKey(ctx, "k-1", &models.Chargeback{ID: "other", Amount: 5, Currency: "EUR", Reason: "duplicate"})
+	if err != nil || created || replay.ID != "minted" {
+		t.Errorf("create with a copied key = %+v, %v, %v; want the original replayed", replay, created, err)
+	}
+
+	// A completed copy leaves no progress behind: running it again copies
+	// everything anew.
+	third, err := src.CopyTo(ctx, dst, 100)
+	if err != nil || third.Skipped != 0 || third.Copied != second.Copied+second.Skipped {
+		t.Errorf("repeated copy = %+v, %v; want a full copy", third, err)
+	}
+}
+
+func TestDiffReportsDifferences(t *testing.T) {
+	src := newTestStore(t)
+	seedForCopy(t, src)
+	dst, err := store.New(filepath.Join(t.TempDir(), "dst.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dst.Close()
+	if _, err := src.CopyTo(ctx, dst, 1000); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := dst.Delete(ctx, "cb-1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := dst.Create(ctx, &models.Chargeback{ID: "cb-new", Amount: 1, Currency: "USD", Reason: "fraud"}); err != nil {
+		t.Fatal(err)
+	}
+	r, err := src.Diff(ctx, dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.OK() || r.Missing == 0 || r.Extra == 0 || len(r.Examples) == 0 {
+		t.Errorf("diff = %+v, want cb-1 missing and cb-new extra", r)
+	}
+}
@@ -0,0 +1,97 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Mode controls which writes the store accepts.
+type Mode string
+
+// The modes.
+const (
+	// ModeReadWrite accepts every write. It is the default.
+	ModeReadWrite Mode = "read-write"
+
+	// ModeMaintenance refuses writes to the data but still runs maintenance
+	// operations: Compact, Restore and Reencode. Use it to keep serving
+	// reads during a migration or a compaction.
+	ModeMaintenance Mode = "maintenance"
+
+	// ModeReadOnly refuses every write and opens the Bolt file read-only,
+	// which trades the exclusive file lock for a shared one: other
+	// processes can open the file read-only alongside the server, and
+	// nothing changes it while it is copied for a backup.
+	ModeReadOnly Mode = "read-only"
+)
+
+// ErrReadOnly is returned by writes the store's mode refuses.
+var ErrReadOnly = newError(ErrUnavailable, "store is not accepting writes")
+
+// ParseMode returns the mode called name.
+func ParseMode(name string) (Mode, error) {
+	switch m := Mode(name); m {
+	case ModeReadWrite, ModeMaintenance, ModeReadOnly:
+		return m, nil
+	}
+	return "", fmt.Errorf("unknown mode %q: want %s, %s or %s", name, ModeReadWrite, ModeMaintenance, ModeReadOnly)
+}
+
+// Mode returns the store's current mode.
+func (s *Store) Mode() Mode {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.mode
+}
+
+// SetMode switches the store to m. It waits for in-flight transactions, so
+// once it returns no refused write is still running. Entering or leaving
+// ModeReadOnly reopens the Bolt file; if that fails the store stays in its
+// previous mode.
+func (s *Store) SetMode(m Mode) error {
+	if _, err := ParseMode(string(m)); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	readOnly := m == ModeReadOnly
+	if readOnly != (s.mode == ModeReadOnly) {
+		if err := s.db.Close(); err != nil {
+			return err
+		}
+		db, err := open(s.path, readOnly, s.Options())
+		if err != nil {
+			// Reopen as before so the store stays usable.
+			db, openErr := open(s.path, !readOnly, s.Options())
+			if openErr != nil {
+				return errors.Join(err, openErr)
+			}
+			s.db = db
+			s.configure()
+			return err
+		}
+		s.db = db
+		s.configure()
+	}
+	s.mode = m
+	return nil
+}
+
+// writable returns ErrReadOnly unless the mode accepts writes to the data.
+// The caller must hold s.mu.
+func (s *Store) writable() error {
+	if s.mode != ModeReadWrite {
+		return ErrReadOnly
+	}
+	return nil
+}
+
+// maintainable returns ErrReadOnly unless the mode accepts maintenance
+// operations. The caller must hold s.mu.
+func (s *Store) maintainable() error {
+	if s.mode == ModeReadOnly {
+		return ErrReadOnly
+	}
+	return nil
+}
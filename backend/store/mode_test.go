@@ -0,0 +1,81 @@
+package store_test
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/arkantrust/idempotency-example/backend/models"
+	"github.com/arkantrust/idempotency-example/backend/store"
+)
+
+func TestModesRefuseWritesButServeReads(t *testing.T) {
+	s := newTestStore(t)
+	if _, _, err := s.Create(ctx, &models.Chargeback{ID: "cb-1", Amount: 1, Currency: "USD"}); err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+
+	for _, mode := range []store.Mode{store.ModeMaintenance, store.ModeReadOnly} {
+		if err := s.SetMode(mode); err != nil {
+			t.Fatalf("switching to %s failed: %v", mode, err)
+		}
+		if _, _, err := s.Create(ctx, &models.Chargeback{ID: "cb-2", Amount: 1, Currency: "USD"}); !errors.Is(err, store.ErrReadOnly) {
+			t.Fatalf("%s: expected create to be refused, got %v", mode, err)
+		}
+		if _, err := s.Delete(ctx, "cb-1"); !errors.Is(err, store.ErrReadOnly) {
+			t.Fatalf("%s: expected delete to be refused, got %v", mode, err)
+		}
+		if _, err := s.Get(ctx, "cb-1"); err != nil {
+			t.Fatalf("%s: expected reads to work, got %v", mode, err)
+		}
+	}
+
+	// Maintenance operations run in maintenance mode only.
+	if _, err := s.Compact(ctx); !errors.Is(err, store.ErrReadOnly) {
+		t.Fatalf("expected compaction to be refused in read-only mode, got %v", err)
+	}
+	if err := s.SetMode(store.ModeMaintenance); err != nil {
+		t.Fatalf("leaving read-only mode failed: %v", err)
+	}
+	if _, err := s.Compact(ctx); err != nil {
+		t.Fatalf("expected compaction in maintenance mode, got %v", err)
+	}
+
+	if err := s.SetMode(store.ModeReadWrite); err != nil {
+		t.Fatal(err)
+	}
+	if _, created, err := s.Create(ctx, &models.Chargeback{ID: "cb-2", Amount: 1, Currency: "USD"}); err != nil || !created {
+		t.Fatalf("expected writes to resume, got %v %v", created, err)
+	}
+}
+
+func TestNewReadOnlySharesTheFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "shared.db")
+	s, err := store.New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.Create(ctx, &models.Chargeback{ID: "cb-1", Amount: 1, Currency: "USD"}); err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+	s.Close()
+
+	// Two read-only stores can hold the file at once.
+	a, err := store.NewReadOnly(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	b, err := store.NewReadOnly(path)
+	if err != nil {
+		t.Fatalf("expected a second read-only open to succeed, got %v", err)
+	}
+	defer b.Close()
+
+	if a.Mode() != store.ModeReadOnly {
+		t.Fatalf("expected read-only mode, got %s", a.Mode())
+	}
+	if _, err := b.Get(ctx, "cb-1"); err != nil {
+		t.Fatalf("expected reads to work, got %v", err)
+	}
+}
@@ -0,0 +1,75 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"time"
+
+	bolt "github.com/boltdb/bolt"
+)
+
+// noncesBucketName holds the nonces of signed requests (see
+// middleware.VerifySignature), keyed by nonce, with the time each may be
+// forgotten as big-endian Unix nanoseconds. Nonces are transport-level
+// bookkeeping, shared by every tenant, so they are kept in ModeMaintenance
+// like the request log.
+const noncesBucketName = "nonces"
+
+// ErrNonceReused is returned by UseNonce for a nonce already used.
+var ErrNonceReused = newError(ErrConflict, "nonce already used")
+
+// UseNonce records nonce as used until expires, or returns ErrNonceReused if
+// it was used before and has not expired yet.
+func (s *Store) UseNonce(ctx context.Context, nonce string, expires time.Time) error {
+	at := now(ctx)
+	return s.maintain(ctx, func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(noncesBucketName))
+		if err != nil {
+			return err
+		}
+		if v := b.Get([]byte(nonce)); v != nil && nonceExpiry(v).After(at) {
+			return ErrNonceReused
+		}
+		return b.Put([]byte(nonce), binary.BigEndian.AppendUint64(nil, uint64(expires.UnixNano())))
+	})
+}
+
+// SweepNonces deletes the nonces expired by now, returning how many it
+// deleted. Expired nonces are already reusable; sweeping reclaims their
+// space.
+func (s *Store) SweepNonces(ctx context.Context, now time.Time) (int, error) {
+	n := 0
+	err := s.maintain(ctx, func(tx *bolt.Tx) error {
+		n = 0
+		b := tx.Bucket([]byte(noncesBucketName))
+		if b == nil {
+			return nil
+		}
+		var doomed [][]byte
+		err := b.ForEach(func(k, v []byte) error {
+			if !nonceExpiry(v).After(now) {
+				doomed = append(doomed, bytes.Clone(k))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, k := range doomed {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+		}
+		n = len(doomed)
+		return nil
+	})
+	return n, err
+}
+
+func nonceExpiry(v []byte) time.Time {
+	if len(v) != 8 {
+		return time.Time{}
+	}
+	return time.Unix(0, int64(binary.BigEndian.Uint64(v)))
+}
@@ -0,0 +1,32 @@
+package store_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/arkantrust/idempotency-example/backend/store"
+)
+
+func TestNonces(t *testing.T) {
+	s := newTestStore(t)
+	start := time.Now()
+	at := store.WithTime(ctx, start)
+
+	if err := s.UseNonce(at, "n-1", start.Add(time.Minute)); err != nil {
+		t.Fatalf("first use: %v", err)
+	}
+	if err := s.UseNonce(at, "n-1", start.Add(time.Minute)); !errors.Is(err, store.ErrNonceReused) {
+		t.Fatalf("second use: err = %v, want reused", err)
+	}
+
+	// Once expired, a nonce is forgotten by a sweep, and usable again until
+	// then.
+	later := start.Add(2 * time.Minute)
+	if n, err := s.SweepNonces(ctx, later); err != nil || n != 1 {
+		t.Fatalf("sweep = %d, %v; want 1", n, err)
+	}
+	if err := s.UseNonce(store.WithTime(ctx, later), "n-1", later.Add(time.Minute)); err != nil {
+		t.Fatalf("use after expiry: %v", err)
+	}
+}
@@ -0,0 +1,204 @@
+package store
+
+import (
+	"context"
+
+	bolt "github.com/boltdb/bolt"
+
+	"github.com/arkantrust/idempotency-example/backend/models"
+)
+
+// Buckets of asynchronous creates, per tenant: operations holds them by ID,
+// and operationKeys maps each scoped idempotency key to the operation it
+// started.
+const (
+	operationsBucketName    = "operations"
+	operationKeysBucketName = "operation_keys"
+)
+
+// operationOp namespaces the idempotency keys of asynchronous creates.
+const operationOp = "operation"
+
+// storedOperation is an operation as stored: the client-facing state plus
+// what the worker needs to run it. The request is kept only while the
+// operation is pending.
+type storedOperation struct {
+	Operation   models.Operation  `json:"operation"`
+	Owner       string            `json:"owner,omitempty"`
+	Key         string            `json:"key"`
+	Fingerprint string            `json:"fingerprint"`
+	Request     models.Chargeback `json:"request"`
+}
+
+// SensitiveFields seals the request like the chargeback it becomes.
+func (o *storedOperation) SensitiveFields() []*string { return o.Request.SensitiveFields() }
+
+// PendingOperation is an operation waiting for a worker.
+type PendingOperation struct {
+	ID     string
+	Tenant string
+	Owner  string
+
+	// Key is the idempotency key the operation was started with, and
+	// Request the chargeback to create with it.
+	Key     string
+	Request models.Chargeback
+}
+
+// StartOperation records a pending create of req, deduplicated on key. If
+// key already started an operation, that one is returned with created false
+// – or ErrKeyReused if it was started for another request, as fingerprint
+// tells.
+func (s *Store) StartOperation(ctx context.Context, key, fingerprint string, req *models.Chargeback) (op *models.Operation, created bool, err error) {
+	_, span := startSpan(ctx, "store.StartOperation", "")
+	defer func() { endSpan(span, err) }()
+	err = s.update(ctx, func(tx *bolt.Tx) error {
+		ops, err := createTenantBucket(ctx, tx, operationsBucketName)
+		if err != nil {
+			return err
+		}
+		keys, err := createTenantBucket(ctx, tx, operationKeysBucketName)
+		if err != nil {
+			return err
+		}
+		k := scopedKey(ctx, operationOp, key)
+		if id := keys.Get(k); id != nil {
+			var stored storedOperation
+			if err := s.decode(operationsBucketName, ops.Get(id), &stored); err != nil {
+				return err
+			}
+			if stored.Fingerprint != fingerprint {
+				return ErrKeyReused
+			}
+			op = &stored.Operation
+			return nil
+		}
+
+		t := now(ctx)
+		stored := &storedOperation{
+			Operation: models.Operation{
+				ID:        models.NewID(),
+				Status:    models.OperationPending,
+				CreatedAt: t,
+				UpdatedAt: t,
+			},
+			Owner:       OwnerFrom(ctx),
+			Key:         key,
+			Fingerprint: fingerprint,
+			Request:     *req,
+		}
+		data, err := s.encode(operationsBucketName, stored)
+		if err != nil {
+			return err
+		}
+		if err := ops.Put([]byte(stored.Operation.ID), data); err != nil {
+			return err
+		}
+		op, created = &stored.Operation, true
+		return keys.Put(k, []byte(stored.Operation.ID))
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return op, created, nil
+}
+
+// Operation returns the operation id of the tenant in ctx, or ErrNotFound
+// when there is none visible to the caller.
+func (s *Store) Operation(ctx context.Context, id string) (*models.Operation, error) {
+	var stored storedOperation
+	err := s.view(ctx, func(tx *bolt.Tx) error {
+		b := tenantBucket(ctx, tx, operationsBucketName)
+		if b == nil {
+			return ErrNotFound
+		}
+		v := b.Get([]byte(id))
+		if v == nil {
+			return ErrNotFound
+		}
+		if err := s.decode(operationsBucketName, v, &stored); err != nil {
+			return err
+		}
+		if !visibleTo(ctx, stored.Owner) {
+			return ErrNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &stored.Operation, nil
+}
+
+// UpdateOperation applies fn to the operation id of the tenant in ctx and
+// stores the result. Once fn leaves the operation done, its request is
+// dropped.
+func (s *Store) UpdateOperation(ctx context.Context, id string, fn func(*models.Operation)) error {
+	return s.update(ctx, func(tx *bolt.Tx) error {
+		b := tenantBucket(ctx, tx, operationsBucketName)
+		if b == nil {
+			return ErrNotFound
+		}
+		v := b.Get([]byte(id))
+		if v == nil {
+			return ErrNotFound
+		}
+		var stored storedOperation
+		if err := s.decode(operationsBucketName, v, &stored); err != nil {
+			return err
+		}
+		fn(&stored.Operation)
+		stored.Operation.UpdatedAt = now(ctx)
+		if stored.Operation.Done() {
+			stored.Request = models.Chargeback{}
+		}
+		data, err := s.encode(operationsBucketName, &stored)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(id), data)
+	})
+}
+
+// PendingOperations returns the pending operations of every tenant, for a
+// worker resuming after a restart.
+func (s *Store) PendingOperations(ctx context.Context) ([]PendingOperation, error) {
+	var pending []PendingOperation
+	collect := func(tenant string, b *bolt.Bucket) error {
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			var stored storedOperation
+			if err := s.decode(operationsBucketName, v, &stored); err != nil {
+				return err
+			}
+			if !stored.Operation.Done() {
+				pending = append(pending, PendingOperation{
+					ID:      stored.Operation.ID,
+					Tenant:  tenant,
+					Owner:   stored.Owner,
+					Key:     stored.Key,
+					Request: stored.Request,
+				})
+			}
+			return nil
+		})
+	}
+	err := s.view(ctx, func(tx *bolt.Tx) error {
+		if err := collect("", tx.Bucket([]byte(operationsBucketName))); err != nil {
+			return err
+		}
+		root := tx.Bucket([]byte(tenantsBucketName))
+		if root == nil {
+			return nil
+		}
+		return root.ForEach(func(name, v []byte) error {
+			if v != nil {
+				return nil
+			}
+			return collect(string(name), root.Bucket(name).Bucket([]byte(operationsBucketName)))
+		})
+	})
+	return pending, err
+}
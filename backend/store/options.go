@@ -0,0 +1,112 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+
+	bolt "github.com/boltdb/bolt"
+)
+
+// Durability modes, presets of Options trading durability for speed.
+const (
+	// DurabilitySafe is Bolt's default: every commit and every growth of
+	// the file is fsynced before it returns.
+	DurabilitySafe = "safe"
+
+	// DurabilityFast still fsyncs every commit, so committed writes survive
+	// a crash, but not the growth of the file, which is only safe on
+	// filesystems other than ext3 and ext4. It also maps 256MiB up front, so
+	// that reads do not hold up writes while the file grows that far.
+	DurabilityFast = "fast"
+
+	// DurabilityDemo fsyncs nothing: a crash of the machine, not only of
+	// the process, can lose or corrupt the latest writes. It is for demos
+	// and benchmarks, where the disk should not be what is measured.
+	DurabilityDemo = "demo"
+)
+
+// Options tune how the Bolt file is opened and written; see SetOptions.
+type Options struct {
+	// Durability names the mode the options started from, to report them.
+	Durability string `json:"durability"`
+
+	// NoSync skips the fsync of every commit; NoGrowSync the fsync after
+	// the file grows.
+	NoSync     bool `json:"noSync"`
+	NoGrowSync bool `json:"noGrowSync"`
+
+	// InitialMmapSize is how many bytes of the file are mapped when it is
+	// opened. Read transactions hold up a write that grows the file past
+	// the mapping, so a larger one spares them that wait.
+	InitialMmapSize int `json:"initialMmapSize"`
+
+	// MmapFlags are passed to mmap, e.g. MAP_POPULATE (0x8000) on Linux to
+	// read the whole file into memory when it is opened.
+	MmapFlags int `json:"mmapFlags"`
+}
+
+// DurabilityOptions returns the Options of a durability mode.
+func DurabilityOptions(mode string) (Options, error) {
+	switch mode {
+	case DurabilitySafe:
+		return Options{Durability: mode}, nil
+	case DurabilityFast:
+		return Options{Durability: mode, NoGrowSync: true, InitialMmapSize: 256 << 20}, nil
+	case DurabilityDemo:
+		return Options{Durability: mode, NoSync: true, NoGrowSync: true, InitialMmapSize: 256 << 20}, nil
+	}
+	return Options{}, fmt.Errorf("durability must be %s, %s or %s, got %q", DurabilitySafe, DurabilityFast, DurabilityDemo, mode)
+}
+
+// bolt returns the options to open the file with.
+func (o Options) bolt(readOnly bool) *bolt.Options {
+	return &bolt.Options{
+		Timeout:         openTimeout,
+		ReadOnly:        readOnly,
+		NoGrowSync:      o.NoGrowSync,
+		InitialMmapSize: o.InitialMmapSize,
+		MmapFlags:       o.MmapFlags,
+	}
+}
+
+// SetOptions reopens the database with o. The mapping options only apply
+// when the file is opened, so it is meant for startup, before the store
+// serves anything; the options are kept for every reopening after it.
+func (s *Store) SetOptions(o Options) error {
+	if o.InitialMmapSize < 0 {
+		return errors.New("initial mmap size must not be negative")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	prev := s.Options()
+	if err := s.db.Close(); err != nil {
+		return err
+	}
+	s.options.Store(&o)
+	db, err := open(s.path, s.mode == ModeReadOnly, o)
+	if err != nil {
+		// Reopen as before so the store stays usable.
+		s.options.Store(&prev)
+		db, openErr := open(s.path, s.mode == ModeReadOnly, prev)
+		if openErr != nil {
+			return errors.Join(err, openErr)
+		}
+		s.db = db
+		s.configure()
+		return err
+	}
+	s.db = db
+	s.configure()
+	return nil
+}
+
+// Options returns the options the database was opened with. It does not
+// wait for the store, so a health check can report them while a compaction
+// or restore holds it.
+func (s *Store) Options() Options {
+	if o := s.options.Load(); o != nil {
+		return *o
+	}
+	return Options{Durability: DurabilitySafe}
+}
@@ -0,0 +1,51 @@
+package store_test
+
+import (
+	"testing"
+
+	"github.com/arkantrust/idempotency-example/backend/models"
+	"github.com/arkantrust/idempotency-example/backend/store"
+)
+
+func TestSetOptions(t *testing.T) {
+	s := newTestStore(t)
+	if got := s.Options().Durability; got != store.DurabilitySafe {
+		t.Fatalf("default durability = %q, want safe", got)
+	}
+	if _, _, err := s.Create(ctx, &models.Chargeback{ID: "cb-1", Amount: 100, Currency: "USD", Reason: "fraud"}); err != nil {
+		t.Fatal(err)
+	}
+
+	opts, err := store.DurabilityOptions(store.DurabilityDemo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetOptions(opts); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.Options(); got != opts || !got.NoSync {
+		t.Fatalf("options = %+v, want %+v", got, opts)
+	}
+
+	// The reopened file keeps its records and takes writes, and a
+	// compaction, which reopens it again, keeps the options.
+	if _, err := s.Get(ctx, "cb-1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.Create(ctx, &models.Chargeback{ID: "cb-2", Amount: 100, Currency: "USD", Reason: "fraud"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Compact(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.Options(); got != opts {
+		t.Errorf("options after compaction = %+v, want %+v", got, opts)
+	}
+
+	if _, err := store.DurabilityOptions("reckless"); err == nil {
+		t.Error("expected error for an unknown durability")
+	}
+	if err := s.SetOptions(store.Options{InitialMmapSize: -1}); err == nil {
+		t.Error("expected error for a negative mmap size")
+	}
+}
@@ -0,0 +1,82 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	bolt "github.com/boltdb/bolt"
+
+	"github.com/arkantrust/idempotency-example/backend/models"
+)
+
+// SetPolicy holds every chargeback written from now on to p; nil lifts the
+// rules. Chargebacks already stored are not checked until a write changes
+// the fields a rule checks.
+func (s *Store) SetPolicy(p *models.Policy) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.policy = p
+}
+
+// Policy returns the rules chargeback writes are held to, or nil if there
+// are none.
+func (s *Store) Policy() *models.Policy {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.policy
+}
+
+// checkPolicy returns a *models.PolicyError listing the rules of the store's
+// policy c breaks; old is the stored record c replaces, nil for a create. An
+// update is only held to the rules on the fields it changes, so that a rule
+// added since the record was written blocks no unrelated write to it, such
+// as an erasure. A merchant's velocity limit is only checked as a
+// chargeback joins it, by counting the merchant's chargebacks created in the
+// window before the write's time, c included.
+func (s *Store) checkPolicy(ctx context.Context, tx *bolt.Tx, old, c *models.Chargeback) error {
+	if s.policy == nil {
+		return nil
+	}
+	violations := s.policy.Check(c)
+	if old != nil {
+		violations = slices.DeleteFunc(violations, func(v models.PolicyViolation) bool {
+			return !policedChanged(old, c, v.Field)
+		})
+	}
+	if v := s.policy.MerchantVelocity; v != nil && c.MerchantID != "" && (old == nil || old.MerchantID != c.MerchantID) {
+		since, n := now(ctx).Add(-v.Window()), 1
+		err := s.eachOfMerchant(ctx, tx, c.MerchantID, func(cb *models.Chargeback) error {
+			if cb.ID != c.ID && cb.CreatedAt.After(since) {
+				n++
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if n > v.Max {
+			violations = append(violations, models.PolicyViolation{
+				Rule:    models.RuleMerchantVelocity,
+				Field:   "merchantId",
+				Message: fmt.Sprintf("merchant has had %d chargebacks in the last %s, at most %d are accepted", n-1, v.Window(), v.Max),
+			})
+		}
+	}
+	if len(violations) > 0 {
+		return &models.PolicyError{Violations: violations}
+	}
+	return nil
+}
+
+// policedChanged reports whether an update from old to c changes what the
+// rule on field checks.
+func policedChanged(old, c *models.Chargeback, field string) bool {
+	switch field {
+	case "amount":
+		return old.Amount != c.Amount || old.Currency != c.Currency
+	case "reason":
+		return old.Reason != c.Reason
+	}
+	return true
+}
@@ -0,0 +1,87 @@
+package store_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/arkantrust/idempotency-example/backend/models"
+	"github.com/arkantrust/idempotency-example/backend/store"
+)
+
+func TestPolicy(t *testing.T) {
+	s := newTestStore(t)
+	s.SetPolicy(&models.Policy{
+		MaxAmounts:        []models.AmountLimit{{Currency: "USD", Max: 1000}},
+		DisallowedReasons: []string{"Friendly fraud"},
+	})
+	rules := func(err error) []string {
+		var pe *models.PolicyError
+		if !errors.As(err, &pe) {
+			t.Fatalf("expected a policy error, got %v", err)
+		}
+		var got []string
+		for _, v := range pe.Violations {
+			got = append(got, v.Rule)
+		}
+		return got
+	}
+
+	_, _, err := s.Create(ctx, &models.Chargeback{ID: "cb-1", Amount: 1001, Currency: "USD", Reason: " friendly FRAUD "})
+	if got := rules(err); len(got) != 2 || got[0] != models.RuleMaxAmount || got[1] != models.RuleDisallowedReason {
+		t.Fatalf("expected both rules broken, got %v", got)
+	}
+	if _, err := s.Get(ctx, "cb-1"); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("expected nothing stored, got %v", err)
+	}
+
+	// The cap is per currency, and updates are held to it too.
+	if _, _, err := s.Create(ctx, &models.Chargeback{ID: "cb-1", Amount: 5000, Currency: "EUR", Reason: "fraud"}); err != nil {
+		t.Fatalf("create in another currency: %v", err)
+	}
+	_, _, err = s.Update(ctx, "cb-1", &models.Chargeback{Amount: 5000, Currency: "USD", Reason: "fraud"}, nil)
+	if got := rules(err); len(got) != 1 || got[0] != models.RuleMaxAmount {
+		t.Fatalf("expected the update refused, got %v", got)
+	}
+
+	s.SetPolicy(nil)
+	if _, _, err := s.Update(ctx, "cb-1", &models.Chargeback{Amount: 5000, Currency: "USD", Reason: "fraud"}, nil); err != nil {
+		t.Fatalf("update without a policy: %v", err)
+	}
+}
+
+func TestMerchantVelocity(t *testing.T) {
+	s := newTestStore(t)
+	s.SetPolicy(&models.Policy{MerchantVelocity: &models.VelocityLimit{Max: 2, WindowSeconds: 3600}})
+	for _, id := range []string{"m-1", "m-2"} {
+		if _, _, err := s.Merchants().Create(ctx, &models.Merchant{ID: id, Name: "Shop"}); err != nil {
+			t.Fatalf("create merchant: %v", err)
+		}
+	}
+	start := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	create := func(id, merchant string, at time.Duration) error {
+		_, _, err := s.Create(store.WithTime(ctx, start.Add(at)), &models.Chargeback{ID: id, Amount: 100, Currency: "USD", Reason: "fraud", MerchantID: merchant})
+		return err
+	}
+
+	for i, id := range []string{"cb-1", "cb-2"} {
+		if err := create(id, "m-1", time.Duration(i)*time.Minute); err != nil {
+			t.Fatalf("create %s: %v", id, err)
+		}
+	}
+	var pe *models.PolicyError
+	if err := create("cb-3", "m-1", 30*time.Minute); !errors.As(err, &pe) || pe.Violations[0].Rule != models.RuleMerchantVelocity {
+		t.Fatalf("expected the third in the hour refused, got %v", err)
+	}
+	if err := create("cb-3", "m-2", 30*time.Minute); err != nil {
+		t.Fatalf("another merchant has its own limit: %v", err)
+	}
+	if err := create("cb-4", "m-1", time.Hour+30*time.Second); err != nil {
+		t.Fatalf("expected room once the first left the window: %v", err)
+	}
+
+	// A retry of a create is a replay, not another chargeback.
+	if err := create("cb-4", "m-1", time.Hour+time.Minute); err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+}
@@ -0,0 +1,588 @@
+// Package raft replicates the chargeback store across instances with the
+// Raft consensus protocol (hashicorp/raft), so that a cluster of three keeps
+// accepting writes when any one instance is down.
+//
+// Every instance keeps its own Bolt store. Writes are not made to it
+// directly: the leader appends each one to the replicated Raft log as a
+// command, and every instance applies the committed commands to its store in
+// log order (the FSM). Reads are served from the local store, so a follower
+// may briefly lag the leader; writes sent to a follower fail with
+// ErrNotLeader.
+//
+// Applying a command must have the same outcome on every instance, so the
+// idempotency check runs in the apply function against the replicated state
+// rather than before the command is proposed: two creates of the same ID
+// racing on the leader are ordered by the log, and the second is a replay on
+// every instance. Timestamps are chosen by the leader and carried in the
+// command (see store.WithTime), and updates and conditional deletes – whose
+// merge and precondition are functions the log cannot carry – are decided on
+// the leader and replicated as a compare-and-swap against the record they
+// were decided on, retried if another write got there first.
+//
+// Only chargeback, charge, merchant and refund writes, imports among them,
+// and expiring the idempotency keys that decide them, are replicated. API
+// keys, saved gRPC and GraphQL responses and the admin operations act on the
+// local store of the instance that serves them, and the store's mode is per
+// instance: an instance that refuses to apply a command stops applying the
+// log.
+package raft
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	hraft "github.com/hashicorp/raft"
+	raftboltdb "github.com/hashicorp/raft-boltdb"
+
+	"github.com/arkantrust/idempotency-example/backend/models"
+	"github.com/arkantrust/idempotency-example/backend/service"
+	"github.com/arkantrust/idempotency-example/backend/store"
+)
+
+// ErrNotLeader is returned by writes sent to an instance that is not the
+// leader. It wraps store.ErrReadOnly, which the APIs answer with "retry
+// later": a retry reaching the leader, or this instance once it has been
+// elected, succeeds.
+var ErrNotLeader = fmt.Errorf("%w: this instance is not the raft leader", store.ErrReadOnly)
+
+// Config configures a Node.
+type Config struct {
+	// ID names the instance in the cluster. It must be unique and stable
+	// across restarts.
+	ID string
+
+	// Addr is the host:port the instance serves Raft on, as the other
+	// instances reach it.
+	Addr string
+
+	// Dir holds the Raft log, a Bolt file, and snapshots of the store.
+	Dir string
+
+	// Peers maps the ID of every instance in the cluster, this one
+	// included, to its Addr.
+	Peers map[string]string
+}
+
+// Node is one instance of a replicated store. It implements
+// service.Backend for chargebacks.
+type Node struct {
+	raft  *hraft.Raft
+	store *store.Store
+	local *store.Collection[models.Chargeback, *models.Chargeback]
+
+	// Timeout bounds how long a write waits to be committed.
+	Timeout time.Duration
+
+	closers []io.Closer
+}
+
+// Open starts the instance cfg describes, replicating writes into s. The
+// first start of every instance bootstraps the cluster with cfg.Peers; once
+// an instance has Raft state it rejoins with what it has.
+func Open(cfg Config, s *store.Store) (*Node, error) {
+	if err := os.MkdirAll(cfg.Dir, 0700); err != nil {
+		return nil, err
+	}
+	logger := hclog.New(&hclog.LoggerOptions{Name: "raft", Level: hclog.Info, Output: os.Stderr})
+
+	logs, err := raftboltdb.NewBoltStore(filepath.Join(cfg.Dir, "raft.db"))
+	if err != nil {
+		return nil, err
+	}
+	snaps, err := hraft.NewFileSnapshotStoreWithLogger(cfg.Dir, 2, logger)
+	if err != nil {
+		logs.Close()
+		return nil, err
+	}
+	addr, err := net.ResolveTCPAddr("tcp", cfg.Addr)
+	if err != nil {
+		logs.Close()
+		return nil, err
+	}
+	trans, err := hraft.NewTCPTransportWithLogger(cfg.Addr, addr, 3, 10*time.Second, logger)
+	if err != nil {
+		logs.Close()
+		return nil, err
+	}
+
+	var peers []hraft.Server
+	for id, addr := range cfg.Peers {
+		peers = append(peers, hraft.Server{ID: hraft.ServerID(id), Address: hraft.ServerAddress(addr)})
+	}
+	slices.SortFunc(peers, func(a, b hraft.Server) int { return strings.Compare(string(a.ID), string(b.ID)) })
+
+	conf := hraft.DefaultConfig()
+	conf.LocalID = hraft.ServerID(cfg.ID)
+	conf.Logger = logger
+	n, err := newNode(conf, s, logs, snaps, trans, peers)
+	if err != nil {
+		trans.Close()
+		logs.Close()
+		return nil, err
+	}
+	n.closers = []io.Closer{trans, logs}
+	return n, nil
+}
+
+// newNode starts a node on the given Raft plumbing. logs is also the stable
+// store.
+func newNode(conf *hraft.Config, s *store.Store, logs interface {
+	hraft.LogStore
+	hraft.StableStore
+}, snaps hraft.SnapshotStore, trans hraft.Transport, peers []hraft.Server) (*Node, error) {
+	local := s.Chargebacks()
+	r, err := hraft.NewRaft(conf, &fsm{store: s, chargebacks: local}, logs, logs, snaps, trans)
+	if err != nil {
+		return nil, err
+	}
+	// Every instance bootstraps with the same peers, so it does not matter
+	// which starts first; an instance that already has state refuses.
+	err = r.BootstrapCluster(hraft.Configuration{Servers: peers}).Error()
+	if err != nil && !errors.Is(err, hraft.ErrCantBootstrap) {
+		r.Shutdown()
+		return nil, err
+	}
+	return &Node{raft: r, store: s, local: local, Timeout: 10 * time.Second}, nil
+}
+
+// Close leaves the cluster's traffic and stops replicating. The store is
+// the caller's to close.
+func (n *Node) Close() error {
+	err := n.raft.Shutdown().Error()
+	for _, c := range n.closers {
+		err = errors.Join(err, c.Close())
+	}
+	return err
+}
+
+// Leader returns the Raft address of the current leader, or "" while there
+// is none.
+func (n *Node) Leader() string {
+	addr, _ := n.raft.LeaderWithID()
+	return string(addr)
+}
+
+// IsLeader reports whether this instance is the leader.
+func (n *Node) IsLeader() bool {
+	return n.raft.State() == hraft.Leader
+}
+
+func (n *Node) notLeader() error {
+	if leader := n.Leader(); leader != "" {
+		return fmt.Errorf("%w; the leader is %s", ErrNotLeader, leader)
+	}
+	return fmt.Errorf("%w; no leader is elected", ErrNotLeader)
+}
+
+// apply replicates cmd, made on behalf of ctx, and returns the outcome of
+// applying it. A fencing token the write drew is reported to ctx.
+func (n *Node) apply(ctx context.Context, cmd command) (result, error) {
+	if !n.IsLeader() {
+		return result{}, n.notLeader()
+	}
+	cmd.Tenant, cmd.Owner, cmd.Time = store.TenantFrom(ctx), store.OwnerFrom(ctx), time.Now().UTC()
+	cmd.RequestID, cmd.Unscoped = store.RequestIDFrom(ctx), !store.Scoped(ctx)
+	data, err := json.Marshal(cmd)
+	if err != nil {
+		return result{}, err
+	}
+	f := n.raft.Apply(data, n.Timeout)
+	if err := f.Error(); err != nil {
+		// When leadership is lost mid-write the command may still commit;
+		// the client's retry will find out, as retries are idempotent.
+		if errors.Is(err, hraft.ErrNotLeader) || errors.Is(err, hraft.ErrLeadershipLost) {
+			return result{}, n.notLeader()
+		}
+		return result{}, err
+	}
+	r := f.Response().(result)
+	store.SetFencingToken(ctx, r.token)
+	return r, r.err
+}
+
+// List returns the chargebacks in the local store.
+func (n *Node) List(ctx context.Context) ([]models.Chargeback, error) {
+	return n.local.List(ctx)
+}
+
+// ForEach walks the chargebacks in the local store.
+func (n *Node) ForEach(ctx context.Context, fn func(models.Chargeback) error) error {
+	return n.local.ForEach(ctx, fn)
+}
+
+// ForEachCreated walks a range of creation times in the local store.
+func (n *Node) ForEachCreated(ctx context.Context, after, before time.Time, fn func(models.Chargeback) error) error {
+	return n.local.ForEachCreated(ctx, after, before, fn)
+}
+
+// Get returns a chargeback from the local store.
+func (n *Node) Get(ctx context.Context, id string) (*models.Chargeback, error) {
+	return n.local.Get(ctx, id)
+}
+
+// Stats summarises the chargebacks in the local store.
+func (n *Node) Stats(ctx context.Context) (*models.Stats, error) {
+	return n.store.Stats(ctx)
+}
+
+// DailyTotals reports daily totals from the local store.
+func (n *Node) DailyTotals(ctx context.Context, from, to time.Time) ([]models.PeriodStats, error) {
+	return n.store.DailyTotals(ctx, from, to)
+}
+
+// Create replicates store.Collection.Create.
+func (n *Node) Create(ctx context.Context, c *models.Chargeback) (*models.Chargeback, bool, error) {
+	r, err := n.apply(ctx, command{Op: opCreate, Record: c})
+	return r.record, r.ok, err
+}
+
+// CreateWithKey replicates store.Store.CreateWithKey.
+func (n *Node) CreateWithKey(ctx context.Context, key string, c *models.Chargeback) (*models.Chargeback, bool, error) {
+	r, err := n.apply(ctx, command{Op: opCreateWithKey, Key: key, Record: c})
+	return r.record, r.ok, err
+}
+
+// CreateMany replicates store.Store.CreateMany.
+func (n *Node) CreateMany(ctx context.Context, cs []*models.Chargeback) (*store.Imported, error) {
+	r, err := n.apply(ctx, command{Op: opCreateMany, Records: cs})
+	return r.imported, err
+}
+
+// DeleteMatching replicates store.Store.DeleteMatching.
+func (n *Node) DeleteMatching(ctx context.Context, f store.Filter) ([]models.Chargeback, error) {
+	r, err := n.apply(ctx, command{Op: opDeleteMatching, Filter: &f})
+	return r.records, err
+}
+
+// Erase replicates store.Store.Erase.
+func (n *Node) Erase(ctx context.Context, id string) (*models.Erasure, bool, error) {
+	r, err := n.apply(ctx, command{Op: opErase, ID: id})
+	return r.erasure, r.ok, err
+}
+
+// ExpireKey replicates store.Store.ExpireKey: a key present on some
+// instances only would make the next create with it a replay on those and a
+// new record on the rest.
+func (n *Node) ExpireKey(ctx context.Context, op, key string, anyOwner bool) (int, error) {
+	r, err := n.apply(ctx, command{Op: opExpireKey, Key: key, Operation: op, AnyOwner: anyOwner})
+	return r.n, err
+}
+
+// CreateRefund replicates store.Store.CreateRefund. The refunds already
+// made are summed as the command is applied, so every instance refuses the
+// same refund.
+func (n *Node) CreateRefund(ctx context.Context, id string, r *models.Refund) (*models.Refund, bool, error) {
+	res, err := n.apply(ctx, command{Op: opCreateRefund, ID: id, Refund: r})
+	return res.refund, res.ok, err
+}
+
+// Refunds returns the refunds of the chargeback id in the local store.
+func (n *Node) Refunds(ctx context.Context, id string) ([]models.Refund, error) {
+	return n.store.Refunds(ctx, id)
+}
+
+// Charges returns the charges of the cluster. Creating one is replicated,
+// since every instance checks the charges of the chargebacks it applies;
+// charges are never changed, so that is the only write they have.
+func (n *Node) Charges() service.Collection[models.Charge] {
+	return immutable[models.Charge, *models.Charge]{
+		n: n, local: n.store.Charges(),
+		create: func(c *models.Charge) command { return command{Op: opCreateCharge, Charge: c} },
+		result: func(r result) *models.Charge { return r.charge },
+	}
+}
+
+// Merchants returns the merchants of the cluster, replicated like Charges.
+func (n *Node) Merchants() service.Collection[models.Merchant] {
+	return immutable[models.Merchant, *models.Merchant]{
+		n: n, local: n.store.Merchants(),
+		create: func(m *models.Merchant) command { return command{Op: opCreateMerchant, Merchant: m} },
+		result: func(r result) *models.Merchant { return r.merchant },
+	}
+}
+
+// ForEachOfMerchant walks the chargebacks of a merchant in the local store.
+func (n *Node) ForEachOfMerchant(ctx context.Context, id string, fn func(models.Chargeback) error) error {
+	return n.store.ForEachOfMerchant(ctx, id, fn)
+}
+
+// MerchantStats summarises the chargebacks of a merchant in the local store.
+func (n *Node) MerchantStats(ctx context.Context, id string) (*models.Stats, error) {
+	return n.store.MerchantStats(ctx, id)
+}
+
+// immutable is the service.Collection of records that are created and never
+// changed: reads are served from local, and creates are replicated as the
+// command create returns.
+type immutable[T any, PT store.RecordPtr[T]] struct {
+	n      *Node
+	local  *store.Collection[T, PT]
+	create func(*T) command
+	result func(result) *T
+}
+
+// errImmutable is returned by the writes immutable records do not have.
+var errImmutable = fmt.Errorf("%w: the record cannot be changed", errors.ErrUnsupported)
+
+func (c immutable[T, PT]) List(ctx context.Context) ([]T, error) {
+	return c.local.List(ctx)
+}
+
+func (c immutable[T, PT]) ForEach(ctx context.Context, fn func(T) error) error {
+	return c.local.ForEach(ctx, fn)
+}
+
+func (c immutable[T, PT]) ForEachCreated(ctx context.Context, after, before time.Time, fn func(T) error) error {
+	return c.local.ForEachCreated(ctx, after, before, fn)
+}
+
+func (c immutable[T, PT]) Get(ctx context.Context, id string) (*T, error) {
+	return c.local.Get(ctx, id)
+}
+
+func (c immutable[T, PT]) Create(ctx context.Context, item *T) (*T, bool, error) {
+	r, err := c.n.apply(ctx, c.create(item))
+	return c.result(r), r.ok, err
+}
+
+func (immutable[T, PT]) UpdateIf(context.Context, string, func(*T), func(*T) bool) (*T, bool, error) {
+	return nil, false, errImmutable
+}
+
+func (immutable[T, PT]) Remove(context.Context, string, func(*T) bool) (*T, error) {
+	return nil, errImmutable
+}
+
+// UpdateIf replicates store.Collection.UpdateIf. apply and check run here,
+// on the leader; the resulting record is replicated to replace the one they
+// ran on, and if another write replaced that first they run again on its
+// result.
+func (n *Node) UpdateIf(ctx context.Context, id string, apply func(*models.Chargeback), check func(*models.Chargeback) bool) (*models.Chargeback, bool, error) {
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, false, err
+		}
+		stored, err := n.local.Get(ctx, id)
+		if err != nil {
+			return nil, false, err
+		}
+		merged := *stored
+		apply(&merged)
+		if models.SameContent(stored, &merged) {
+			return stored, false, nil
+		}
+		if check != nil && !check(stored) {
+			return nil, false, store.ErrPreconditionFailed
+		}
+		r, err := n.apply(ctx, command{Op: opReplace, ID: id, Record: &merged, Expect: stored})
+		if errors.Is(err, store.ErrPreconditionFailed) {
+			continue
+		}
+		return r.record, r.ok, err
+	}
+}
+
+// Remove replicates store.Collection.Remove the way UpdateIf replicates
+// updates.
+func (n *Node) Remove(ctx context.Context, id string, check func(*models.Chargeback) bool) (*models.Chargeback, error) {
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		stored, err := n.local.Get(ctx, id)
+		if errors.Is(err, store.ErrNotFound) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if check != nil && !check(stored) {
+			return nil, store.ErrPreconditionFailed
+		}
+		r, err := n.apply(ctx, command{Op: opRemove, ID: id, Expect: stored})
+		if errors.Is(err, store.ErrPreconditionFailed) {
+			continue
+		}
+		return r.record, err
+	}
+}
+
+// op names a replicated operation.
+type op string
+
+const (
+	opCreate         op = "create"
+	opCreateWithKey  op = "createWithKey"
+	opCreateMany     op = "createMany"
+	opReplace        op = "replace"
+	opRemove         op = "remove"
+	opDeleteMatching op = "deleteMatching"
+	opErase          op = "erase"
+	opExpireKey      op = "expireKey"
+	opCreateRefund   op = "createRefund"
+	opCreateCharge   op = "createCharge"
+	opCreateMerchant op = "createMerchant"
+)
+
+// command is a write as the Raft log carries it: the operation, its
+// arguments, and everything the store would otherwise take from the
+// request's context or the clock.
+type command struct {
+	Op        op        `json:"op"`
+	Tenant    string    `json:"tenant,omitempty"`
+	Owner     string    `json:"owner,omitempty"`
+	RequestID string    `json:"requestId,omitempty"`
+	Unscoped  bool      `json:"unscoped,omitempty"` // made with no owner; see store.WithOwner
+	Time      time.Time `json:"time"`
+
+	ID     string             `json:"id,omitempty"`
+	Key    string             `json:"key,omitempty"`
+	Record *models.Chargeback `json:"record,omitempty"`
+	Filter *store.Filter      `json:"filter,omitempty"`
+	Refund *models.Refund     `json:"refund,omitempty"`
+	Charge *models.Charge     `json:"charge,omitempty"`
+
+	Merchant *models.Merchant `json:"merchant,omitempty"`
+
+	// Records are the chargebacks a createMany command imports.
+	Records []*models.Chargeback `json:"records,omitempty"`
+
+	// Operation and AnyOwner select the keys an expireKey command expires.
+	Operation string `json:"operation,omitempty"`
+	AnyOwner  bool   `json:"anyOwner,omitempty"`
+
+	// Expect is the stored record a replace or remove was decided on. The
+	// command only applies if the record is still exactly that.
+	Expect *models.Chargeback `json:"expect,omitempty"`
+}
+
+// result is the outcome of applying a command.
+type result struct {
+	record   *models.Chargeback
+	records  []models.Chargeback
+	imported *store.Imported
+	erasure  *models.Erasure
+	refund   *models.Refund
+	charge   *models.Charge
+	merchant *models.Merchant
+	ok       bool
+	n        int
+	token    uint64
+	err      error
+}
+
+// fsm applies committed commands to the local store.
+type fsm struct {
+	store       *store.Store
+	chargebacks *store.Collection[models.Chargeback, *models.Chargeback]
+}
+
+func (f *fsm) Apply(l *hraft.Log) any {
+	var cmd command
+	if err := json.Unmarshal(l.Data, &cmd); err != nil {
+		return result{err: err}
+	}
+	ctx := store.WithTenant(context.Background(), cmd.Tenant)
+	if !cmd.Unscoped {
+		ctx = store.WithOwner(ctx, cmd.Owner)
+	}
+	ctx = store.WithRequestID(ctx, cmd.RequestID)
+	ctx = store.WithTime(ctx, cmd.Time)
+	ctx = store.WithFencing(ctx)
+	// Every node must apply every command, however long it waits.
+	ctx = store.WithoutTimeout(ctx)
+
+	var r result
+	switch cmd.Op {
+	case opCreate:
+		r.record, r.ok, r.err = f.chargebacks.Create(ctx, cmd.Record)
+	case opCreateWithKey:
+		r.record, r.ok, r.err = f.store.CreateWithKey(ctx, cmd.Key, cmd.Record)
+	case opReplace:
+		r.record, r.ok, r.err = f.chargebacks.UpdateIf(ctx, cmd.ID,
+			func(c *models.Chargeback) { *c = *cmd.Record }, unchanged(cmd.Expect))
+	case opRemove:
+		r.record, r.err = f.chargebacks.Remove(ctx, cmd.ID, unchanged(cmd.Expect))
+	case opCreateMany:
+		r.imported, r.err = f.store.CreateMany(ctx, cmd.Records)
+	case opDeleteMatching:
+		r.records, r.err = f.store.DeleteMatching(ctx, *cmd.Filter)
+	case opErase:
+		r.erasure, r.ok, r.err = f.store.Erase(ctx, cmd.ID)
+	case opExpireKey:
+		r.n, r.err = f.store.ExpireKey(ctx, cmd.Operation, cmd.Key, cmd.AnyOwner)
+	case opCreateRefund:
+		r.refund, r.ok, r.err = f.store.CreateRefund(ctx, cmd.ID, cmd.Refund)
+	case opCreateCharge:
+		r.charge, r.ok, r.err = f.store.Charges().Create(ctx, cmd.Charge)
+	case opCreateMerchant:
+		r.merchant, r.ok, r.err = f.store.Merchants().Create(ctx, cmd.Merchant)
+	default:
+		r.err = fmt.Errorf("unknown command %q", cmd.Op)
+	}
+	r.token = store.FencingTokenFrom(ctx)
+	return r
+}
+
+// unchanged returns a check passing only a record identical to expect. They
+// are compared in their JSON form, which is what the log carried expect in.
+func unchanged(expect *models.Chargeback) func(*models.Chargeback) bool {
+	want, err := json.Marshal(expect)
+	return func(c *models.Chargeback) bool {
+		got, gotErr := json.Marshal(c)
+		return err == nil && gotErr == nil && bytes.Equal(got, want)
+	}
+}
+
+// Snapshot captures the whole store, taken as a backup. It is held in memory
+// until persisted, since applying resumes as soon as Snapshot returns.
+func (f *fsm) Snapshot() (hraft.FSMSnapshot, error) {
+	var buf bytes.Buffer
+	if _, err := f.store.Backup(context.Background(), &buf); err != nil {
+		return nil, err
+	}
+	return snapshot(buf.Bytes()), nil
+}
+
+// Restore replaces the store with a snapshot, as Store.Restore does with a
+// backup.
+func (f *fsm) Restore(rc io.ReadCloser) error {
+	defer rc.Close()
+	tmp, err := os.CreateTemp("", "raft-snapshot-*.db")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, rc); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return f.store.Restore(context.Background(), tmp.Name())
+}
+
+// snapshot is a store backup waiting to be persisted.
+type snapshot []byte
+
+func (s snapshot) Persist(sink hraft.SnapshotSink) error {
+	if _, err := sink.Write(s); err != nil {
+		sink.Cancel()
+		return err
+	}
+	return sink.Close()
+}
+
+func (s snapshot) Release() {}
@@ -0,0 +1,149 @@
+package raft
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	hraft "github.com/hashicorp/raft"
+
+	"github.com/arkantrust/idempotency-example/backend/models"
+	"github.com/arkantrust/idempotency-example/backend/store"
+)
+
+var ctx = context.Background()
+
+// newCluster starts three nodes connected in memory and returns them with
+// the leader first.
+func newCluster(t *testing.T) []*Node {
+	t.Helper()
+	var (
+		nodes  []*Node
+		trans  []*hraft.InmemTransport
+		peers  []hraft.Server
+		stores []*store.Store
+	)
+	for i := range 3 {
+		addr, tr := hraft.NewInmemTransport("")
+		trans = append(trans, tr)
+		peers = append(peers, hraft.Server{ID: hraft.ServerID(fmt.Sprint("node", i)), Address: addr})
+		s, err := store.New(filepath.Join(t.TempDir(), "store.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { s.Close() })
+		stores = append(stores, s)
+	}
+	for _, a := range trans {
+		for _, b := range trans {
+			a.Connect(b.LocalAddr(), b)
+		}
+	}
+	for i := range 3 {
+		conf := hraft.DefaultConfig()
+		conf.LocalID = peers[i].ID
+		conf.Logger = hclog.NewNullLogger()
+		conf.HeartbeatTimeout, conf.ElectionTimeout = 50*time.Millisecond, 50*time.Millisecond
+		conf.LeaderLeaseTimeout, conf.CommitTimeout = 50*time.Millisecond, 5*time.Millisecond
+		logs := hraft.NewInmemStore()
+		n, err := newNode(conf, stores[i], logs, hraft.NewInmemSnapshotStore(), trans[i], peers)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { n.Close() })
+		nodes = append(nodes, n)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		for i, n := range nodes {
+			if n.IsLeader() {
+				nodes[0], nodes[i] = nodes[i], nodes[0]
+				return nodes
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("no leader elected")
+	return nil
+}
+
+// eventually waits for every node to satisfy ok.
+func eventually(t *testing.T, nodes []*Node, ok func(*Node) bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for _, n := range nodes {
+		for !ok(n) {
+			if time.Now().After(deadline) {
+				t.Fatal("replicas did not converge")
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+}
+
+func TestReplicatedWrites(t *testing.T) {
+	nodes := newCluster(t)
+	leader, follower := nodes[0], nodes[1]
+
+	fctx := store.WithFencing(ctx)
+	created, ok, err := leader.Create(fctx, &models.Chargeback{ID: "cb-1", Amount: 100, Currency: "USD", Reason: "fraud"})
+	if err != nil || !ok || store.FencingTokenFrom(fctx) == 0 {
+		t.Fatalf("expected a created record and a fencing token, got %v %v %d", ok, err, store.FencingTokenFrom(fctx))
+	}
+	// The idempotency check runs in the FSM: the retry is a replay.
+	if again, ok, err := leader.Create(ctx, &models.Chargeback{ID: "cb-1", Amount: 100, Currency: "USD", Reason: "fraud"}); err != nil || ok || !again.CreatedAt.Equal(created.CreatedAt) {
+		t.Fatalf("expected a replay of the first create, got %+v %v %v", again, ok, err)
+	}
+	// Every replica stamped the record with the leader's time.
+	eventually(t, nodes, func(n *Node) bool {
+		got, err := n.Get(ctx, "cb-1")
+		return err == nil && got.CreatedAt.Equal(created.CreatedAt)
+	})
+
+	if _, _, err := follower.Create(ctx, &models.Chargeback{ID: "cb-2", Amount: 1, Currency: "USD"}); !errors.Is(err, ErrNotLeader) || !errors.Is(err, store.ErrReadOnly) {
+		t.Fatalf("expected ErrNotLeader from a follower, got %v", err)
+	}
+
+	isVersion := func(v int64) func(*models.Chargeback) bool {
+		return func(c *models.Chargeback) bool { return c.Version == v }
+	}
+	setAmount := func(c *models.Chargeback) { c.Amount = 200 }
+	if _, _, err := leader.UpdateIf(ctx, "cb-1", setAmount, isVersion(2)); !errors.Is(err, store.ErrPreconditionFailed) {
+		t.Fatalf("expected ErrPreconditionFailed for the wrong version, got %v", err)
+	}
+	if updated, written, err := leader.UpdateIf(ctx, "cb-1", setAmount, isVersion(1)); err != nil || !written || updated.Version != 2 {
+		t.Fatalf("expected the update written at version 2, got %+v %v %v", updated, written, err)
+	}
+	eventually(t, nodes, func(n *Node) bool {
+		got, err := n.Get(ctx, "cb-1")
+		return err == nil && got.Amount == 200 && got.Version == 2
+	})
+
+	proof, erased, err := leader.Erase(ctx, "cb-1")
+	if err != nil || !erased {
+		t.Fatalf("expected the record erased, got %v %v", erased, err)
+	}
+	if again, erased, err := leader.Erase(ctx, "cb-1"); err != nil || erased || again.SHA256 != proof.SHA256 {
+		t.Fatalf("expected the first proof again, got %+v %v %v", again, erased, err)
+	}
+	eventually(t, nodes, func(n *Node) bool {
+		got, err := n.Get(ctx, "cb-1")
+		return err == nil && got.Reason == "" && got.Version == 3
+	})
+
+	if removed, err := leader.Remove(ctx, "cb-1", nil); err != nil || removed == nil {
+		t.Fatalf("expected the record removed, got %+v %v", removed, err)
+	}
+	if removed, err := leader.Remove(ctx, "cb-1", nil); err != nil || removed != nil {
+		t.Fatalf("expected a second remove to find nothing, got %+v %v", removed, err)
+	}
+	eventually(t, nodes, func(n *Node) bool {
+		_, err := n.Get(ctx, "cb-1")
+		return errors.Is(err, store.ErrNotFound)
+	})
+}
@@ -0,0 +1,52 @@
+package store
+
+import (
+	"context"
+
+	bolt "github.com/boltdb/bolt"
+
+	"github.com/arkantrust/idempotency-example/backend/models"
+)
+
+// ratesBucketName caches the latest exchange rates, for every tenant, under
+// ratesKey. Refreshing them is bookkeeping, like running the jobs that do
+// it, so it carries on in ModeMaintenance.
+const ratesBucketName = "exchange_rates"
+
+var ratesKey = []byte("latest")
+
+// SaveExchangeRates replaces the cached exchange rates with r.
+func (s *Store) SaveExchangeRates(ctx context.Context, r *models.ExchangeRates) error {
+	return s.maintain(ctx, func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(ratesBucketName))
+		if err != nil {
+			return err
+		}
+		data, err := s.encode(ratesBucketName, r)
+		if err != nil {
+			return err
+		}
+		return b.Put(ratesKey, data)
+	})
+}
+
+// ExchangeRates returns the cached exchange rates, or ErrNotFound if none
+// were saved yet.
+func (s *Store) ExchangeRates(ctx context.Context) (*models.ExchangeRates, error) {
+	var r models.ExchangeRates
+	err := s.view(ctx, func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(ratesBucketName))
+		if b == nil {
+			return ErrNotFound
+		}
+		v := b.Get(ratesKey)
+		if v == nil {
+			return ErrNotFound
+		}
+		return s.decode(ratesBucketName, v, &r)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
@@ -0,0 +1,60 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+
+	bolt "github.com/boltdb/bolt"
+
+	"github.com/arkantrust/idempotency-example/backend/models"
+)
+
+// reconciliationsBucketName holds reconciliation reports by ID, per tenant.
+const reconciliationsBucketName = "reconciliations"
+
+// Reconciliation returns the report saved under id for the tenant in ctx, or
+// ErrNotFound.
+func (s *Store) Reconciliation(ctx context.Context, id string) (*models.Reconciliation, error) {
+	var r models.Reconciliation
+	err := s.view(ctx, func(tx *bolt.Tx) error {
+		b := tenantBucket(ctx, tx, reconciliationsBucketName)
+		if b == nil {
+			return ErrNotFound
+		}
+		v := b.Get([]byte(id))
+		if v == nil {
+			return ErrNotFound
+		}
+		return json.Unmarshal(v, &r)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// SaveReconciliation saves r under its ID for the tenant in ctx, unless a
+// report is already saved there, in which case that one is returned with
+// created false: the first report for a file is the one every re-run sees.
+func (s *Store) SaveReconciliation(ctx context.Context, r *models.Reconciliation) (result *models.Reconciliation, created bool, err error) {
+	err = s.update(ctx, func(tx *bolt.Tx) error {
+		b, err := createTenantBucket(ctx, tx, reconciliationsBucketName)
+		if err != nil {
+			return err
+		}
+		if v := b.Get([]byte(r.ID)); v != nil {
+			result = &models.Reconciliation{}
+			return json.Unmarshal(v, result)
+		}
+		data, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		result, created = r, true
+		return b.Put([]byte(r.ID), data)
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return result, created, nil
+}
@@ -0,0 +1,144 @@
+package store
+
+import (
+	"bytes"
+	"context"
+
+	bolt "github.com/boltdb/bolt"
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/arkantrust/idempotency-example/backend/models"
+)
+
+// refundsBucketName holds the refunds of every chargeback of a tenant, keyed
+// <chargeback id>\x00<refund id> so that a chargeback's refunds are adjacent.
+const refundsBucketName = "refunds"
+
+// ErrRefundExceedsAmount is returned by CreateRefund when the refund would
+// take the chargeback's refunds past its amount.
+var ErrRefundExceedsAmount = newError(ErrConflict, "refunds would exceed the chargeback amount")
+
+// CreateRefund creates the refund r of the chargeback id and returns it with
+// created true. A refund with the same ID already created for the chargeback
+// is returned instead, with created false, when r matches it, and
+// ErrKeyReused when it does not.
+//
+// The chargeback is read, its refunds summed and the refund written in one
+// transaction, so concurrent refunds cannot together exceed its amount. It
+// returns ErrNotFound when there is no active chargeback id visible to the
+// caller, and a *models.ValidationError when r is in another currency.
+func (s *Store) CreateRefund(ctx context.Context, id string, r *models.Refund) (result *models.Refund, created bool, err error) {
+	_, span := startSpan(ctx, "store.CreateRefund", id)
+	err = s.update(ctx, func(tx *bolt.Tx) error {
+		result, created = nil, false
+		cb, err := s.chargebacks.getIn(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		currency := r.Currency
+		if currency == "" {
+			currency = cb.Currency
+		}
+		b, err := createTenantBucket(ctx, tx, refundsBucketName)
+		if err != nil {
+			return err
+		}
+
+		key := refundKey(id, r.ID)
+		if v := b.Get(key); v != nil {
+			result = &models.Refund{}
+			if err := s.decode(refundsBucketName, v, result); err != nil {
+				return err
+			}
+			if result.Amount != r.Amount || result.Currency != currency {
+				result = nil
+				return ErrKeyReused
+			}
+			return nil
+		}
+
+		if currency != cb.Currency {
+			return invalid("currency", "must be the chargeback's, "+cb.Currency)
+		}
+		refunded, err := s.refundedIn(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		if refunded+r.Amount > cb.Amount {
+			return ErrRefundExceedsAmount
+		}
+
+		result = &models.Refund{
+			ID:           r.ID,
+			ChargebackID: id,
+			Amount:       r.Amount,
+			Currency:     currency,
+			CreatedAt:    now(ctx),
+			RequestID:    RequestIDFrom(ctx),
+		}
+		v, err := s.encode(refundsBucketName, result)
+		if err != nil {
+			return err
+		}
+		if err := b.Put(key, v); err != nil {
+			return err
+		}
+		created = true
+		return fence(ctx, tx)
+	})
+	span.SetAttributes(attribute.String("idempotency.outcome", outcome(created, "created", "replayed")))
+	endSpan(span, err)
+	if err != nil {
+		return nil, false, err
+	}
+	return result, created, nil
+}
+
+// Refunds returns the refunds of the chargeback id, in order of their IDs,
+// or ErrNotFound when there is no active chargeback id visible to the
+// caller.
+func (s *Store) Refunds(ctx context.Context, id string) ([]models.Refund, error) {
+	list := []models.Refund{}
+	err := s.view(ctx, func(tx *bolt.Tx) error {
+		if _, err := s.chargebacks.getIn(ctx, tx, id); err != nil {
+			return err
+		}
+		return s.eachRefundIn(ctx, tx, id, func(r models.Refund) {
+			list = append(list, r)
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// refundedIn sums the refunds of the chargeback id.
+func (s *Store) refundedIn(ctx context.Context, tx *bolt.Tx, id string) (int64, error) {
+	var total int64
+	err := s.eachRefundIn(ctx, tx, id, func(r models.Refund) { total += r.Amount })
+	return total, err
+}
+
+// eachRefundIn calls fn with each refund of the chargeback id.
+func (s *Store) eachRefundIn(ctx context.Context, tx *bolt.Tx, id string, fn func(models.Refund)) error {
+	b := tenantBucket(ctx, tx, refundsBucketName)
+	if b == nil {
+		return nil
+	}
+	prefix := refundKey(id, "")
+	c := b.Cursor()
+	for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+		var r models.Refund
+		if err := s.decode(refundsBucketName, v, &r); err != nil {
+			return err
+		}
+		fn(r)
+	}
+	return nil
+}
+
+// refundKey is the key of the refund refundID of the chargeback id.
+func refundKey(id, refundID string) []byte {
+	return []byte(id + "\x00" + refundID)
+}
@@ -0,0 +1,48 @@
+package store_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/arkantrust/idempotency-example/backend/models"
+	"github.com/arkantrust/idempotency-example/backend/store"
+)
+
+func TestCreateRefund(t *testing.T) {
+	s := newTestStore(t)
+	if _, _, err := s.CreateRefund(ctx, "cb-1", &models.Refund{ID: "r-1", Amount: 10}); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound without the chargeback, got %v", err)
+	}
+	if _, _, err := s.Create(ctx, &models.Chargeback{ID: "cb-1", Amount: 100, Currency: "USD", Reason: "fraud"}); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	r, created, err := s.CreateRefund(ctx, "cb-1", &models.Refund{ID: "r-1", Amount: 60})
+	if err != nil || !created || r.Currency != "USD" || r.ChargebackID != "cb-1" {
+		t.Fatalf("refund: created %v, %+v, %v", created, r, err)
+	}
+	// A retry is a replay, however many refunds would otherwise fit.
+	again, created, err := s.CreateRefund(ctx, "cb-1", &models.Refund{ID: "r-1", Amount: 60, Currency: "USD"})
+	if err != nil || created || !again.CreatedAt.Equal(r.CreatedAt) {
+		t.Fatalf("retry: created %v, %+v, %v", created, again, err)
+	}
+	if _, _, err := s.CreateRefund(ctx, "cb-1", &models.Refund{ID: "r-1", Amount: 50}); !errors.Is(err, store.ErrKeyReused) {
+		t.Fatalf("expected ErrKeyReused for another amount, got %v", err)
+	}
+
+	if _, _, err := s.CreateRefund(ctx, "cb-1", &models.Refund{ID: "r-2", Amount: 41}); !errors.Is(err, store.ErrRefundExceedsAmount) {
+		t.Fatalf("expected ErrRefundExceedsAmount, got %v", err)
+	}
+	var ve *models.ValidationError
+	if _, _, err := s.CreateRefund(ctx, "cb-1", &models.Refund{ID: "r-2", Amount: 40, Currency: "EUR"}); !errors.As(err, &ve) {
+		t.Fatalf("expected a validation error for another currency, got %v", err)
+	}
+	if _, _, err := s.CreateRefund(ctx, "cb-1", &models.Refund{ID: "r-2", Amount: 40}); err != nil {
+		t.Fatalf("second refund: %v", err)
+	}
+
+	list, err := s.Refunds(ctx, "cb-1")
+	if err != nil || len(list) != 2 || list[0].ID != "r-1" || list[1].ID != "r-2" {
+		t.Fatalf("refunds: %+v, %v", list, err)
+	}
+}
@@ -0,0 +1,51 @@
+package store
+
+import (
+	"context"
+	"encoding/binary"
+
+	bolt "github.com/boltdb/bolt"
+
+	"github.com/arkantrust/idempotency-example/backend/models"
+)
+
+// requestLogBucketName holds the recorded requests of every tenant, keyed by
+// their big-endian sequence number so that they iterate in order.
+// Recording is bookkeeping, like the job queue, so it carries on in
+// ModeMaintenance.
+const requestLogBucketName = "request_log"
+
+// RecordRequest appends r to the request log, setting r.Seq.
+func (s *Store) RecordRequest(ctx context.Context, r *models.RecordedRequest) error {
+	return s.maintain(ctx, func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(requestLogBucketName))
+		if err != nil {
+			return err
+		}
+		if r.Seq, err = b.NextSequence(); err != nil {
+			return err
+		}
+		data, err := s.encode(requestLogBucketName, r)
+		if err != nil {
+			return err
+		}
+		return b.Put(binary.BigEndian.AppendUint64(nil, r.Seq), data)
+	})
+}
+
+// ForEachRecordedRequest calls fn with every recorded request, in order.
+func (s *Store) ForEachRecordedRequest(ctx context.Context, fn func(models.RecordedRequest) error) error {
+	return s.view(ctx, func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(requestLogBucketName))
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			var r models.RecordedRequest
+			if err := s.decode(requestLogBucketName, v, &r); err != nil {
+				return err
+			}
+			return fn(r)
+		})
+	})
+}
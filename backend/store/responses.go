@@ -0,0 +1,124 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	bolt "github.com/boltdb/bolt"
+)
+
+// responsesBucketName holds responses saved for replay by transports that
+// deduplicate whole calls, such as the gRPC idempotency interceptor.
+const responsesBucketName = "responses"
+
+// Response is a saved response to a call made with an idempotency key.
+type Response struct {
+	// Fingerprint identifies the request the response answered. A later
+	// request with the same key but another fingerprint is a misuse of the
+	// key, not a retry.
+	Fingerprint string `json:"fingerprint"`
+
+	// Type names the encoding of Body, e.g. a protobuf message name.
+	Type string `json:"type"`
+
+	Body      []byte    `json:"body"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// scopedKey namespaces key by the owner in ctx and by op, the operation it
+// was sent to; the tenant is already namespaced by the bucket. A key used for
+// one operation is unknown to every other, so a client reusing a key for an
+// unrelated call gets that call run rather than an error or someone else's
+// response.
+func scopedKey(ctx context.Context, op, key string) []byte {
+	return []byte(OwnerFrom(ctx) + "\x00" + op + "\x00" + key)
+}
+
+// legacyKey is the bucket key of entries written before keys were namespaced
+// by operation, which are still honoured for any operation.
+func legacyKey(ctx context.Context, key string) []byte {
+	return []byte(OwnerFrom(ctx) + "\x00" + key)
+}
+
+// lookup returns the entry of key for op in b, falling back to a legacy
+// entry, or nil.
+func lookup(ctx context.Context, b *bolt.Bucket, op, key string) []byte {
+	if v := b.Get(scopedKey(ctx, op, key)); v != nil {
+		return v
+	}
+	return b.Get(legacyKey(ctx, key))
+}
+
+// splitKey splits a bucket key into its owner, operation and key. The
+// operation of a legacy entry is "".
+func splitKey(k []byte) (owner, op, key string) {
+	parts := strings.SplitN(string(k), "\x00", 3)
+	if len(parts) < 3 {
+		owner, key, _ = strings.Cut(string(k), "\x00")
+		return owner, "", key
+	}
+	return parts[0], parts[1], parts[2]
+}
+
+// LoadResponse returns the response saved under key, for the operation op,
+// for the tenant and owner in ctx, or ErrNotFound, also once the key has
+// expired.
+func (s *Store) LoadResponse(ctx context.Context, op, key string) (*Response, error) {
+	var resp Response
+	err := s.view(ctx, func(tx *bolt.Tx) error {
+		b := tenantBucket(ctx, tx, responsesBucketName)
+		if b == nil {
+			return ErrNotFound
+		}
+		v := lookup(ctx, b, op, key)
+		if v == nil {
+			return ErrNotFound
+		}
+		if err := json.Unmarshal(v, &resp); err != nil {
+			return err
+		}
+		if s.expired(ctx, resp.CreatedAt) {
+			return ErrNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// SaveResponse saves resp under key, for the operation op, for the tenant and
+// owner in ctx, unless a response is already saved there, in which case that
+// one is returned instead: the first response for a key is the one every
+// retry sees, until the key expires.
+func (s *Store) SaveResponse(ctx context.Context, op, key string, resp *Response) (*Response, error) {
+	var result Response
+	err := s.batch(ctx, func(tx *bolt.Tx) error {
+		result = *resp
+		b, err := createTenantBucket(ctx, tx, responsesBucketName)
+		if err != nil {
+			return err
+		}
+		if v := lookup(ctx, b, op, key); v != nil {
+			if err := json.Unmarshal(v, &result); err != nil {
+				return err
+			}
+			if !s.expired(ctx, result.CreatedAt) {
+				return nil
+			}
+			result = *resp
+		}
+		data, err := json.Marshal(resp)
+		if err != nil {
+			return err
+		}
+		return b.Put(scopedKey(ctx, op, key), data)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
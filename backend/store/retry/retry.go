@@ -0,0 +1,103 @@
+// Package retry retries the chargeback operations of a backend that fail
+// on a transient error (see store.IsTransient), such as a transaction that
+// could not start within the store's timeout, so that a moment of contention
+// on the database does not fail requests.
+//
+// Only transient errors are retried: the operation failed before doing
+// anything, so repeating it – a write included – cannot apply it twice.
+// Every other error is returned at once. Retries wait a jittered, growing
+// backoff, are bounded in number and stop when the operation's context is
+// done; each is counted in the store_retries_total metric.
+//
+// A streamed read (ForEach and its variants) is only retried until it has
+// yielded a record, as repeating it after would yield that record twice.
+package retry
+
+import (
+	"context"
+	"math/rand/v2"
+	"time"
+
+	"github.com/arkantrust/idempotency-example/backend/metrics"
+	"github.com/arkantrust/idempotency-example/backend/service"
+	"github.com/arkantrust/idempotency-example/backend/store"
+)
+
+// Policy bounds the retries of an operation.
+type Policy struct {
+	// Attempts is how many times an operation is tried, the first included;
+	// 1 or less never retries.
+	Attempts int
+
+	// MinBackoff and MaxBackoff bound the delay before a retry: the delay
+	// before retry n is uniformly random in [0, min(MaxBackoff,
+	// MinBackoff·2ⁿ)].
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+// backoff returns the full-jitter delay before retry n (counting from 0).
+func (p Policy) backoff(n int) time.Duration {
+	ceiling := p.MaxBackoff
+	if n < 32 {
+		if d := p.MinBackoff << n; d > 0 && d < ceiling {
+			ceiling = d
+		}
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+	return rand.N(ceiling + 1)
+}
+
+// retry reports whether op, which failed with err on attempt n (counting
+// from 0), is to be tried again, after waiting out the backoff if so.
+func (p Policy) retry(ctx context.Context, op string, n int, err error) bool {
+	if !store.IsTransient(err) || n+1 >= p.Attempts {
+		return false
+	}
+	t := time.NewTimer(p.backoff(n))
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+	}
+	metrics.StoreRetries.WithLabelValues(op).Inc()
+	return true
+}
+
+// retrier is the Policy of a Backend retrying the operations of b as p
+// allows.
+type retrier struct {
+	b service.Backend
+	p Policy
+}
+
+// New returns a Backend retrying the operations of b as p allows.
+func New(b service.Backend, p Policy) service.Backend {
+	return service.Decorate(retrier{b: b, p: p})
+}
+
+// Do runs call, and again while it fails on a transient error and r.p
+// allows.
+func (r retrier) Do(ctx context.Context, op service.Op, call func(context.Context, service.Backend) (any, error)) (any, error) {
+	for n := 0; ; n++ {
+		v, err := call(ctx, r.b)
+		if !r.p.retry(ctx, op.Name, n, err) {
+			return v, err
+		}
+	}
+}
+
+// Walk walks as Do runs call, but stops retrying once a record has been
+// yielded.
+func (r retrier) Walk(ctx context.Context, op string, walk func(service.Backend, *service.Walked) error) error {
+	for n := 0; ; n++ {
+		var w service.Walked
+		err := walk(r.b, &w)
+		if w.Yielded || !r.p.retry(ctx, op, n, err) {
+			return err
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/arkantrust/idempotency-example/backend/models"
+	"github.com/arkantrust/idempotency-example/backend/service"
+	"github.com/arkantrust/idempotency-example/backend/store"
+)
+
+var ctx = context.Background()
+
+var policy = Policy{Attempts: 3, MinBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond}
+
+// failing is a backend whose operations fail with errs, one per call, then
+// succeed.
+type failing struct {
+	service.Backend
+	errs  []error
+	calls int
+}
+
+func (f *failing) next() error {
+	f.calls++
+	if len(f.errs) == 0 {
+		return nil
+	}
+	err := f.errs[0]
+	f.errs = f.errs[1:]
+	return err
+}
+
+func (f *failing) Get(_ context.Context, id string) (*models.Chargeback, error) {
+	if err := f.next(); err != nil {
+		return nil, err
+	}
+	return &models.Chargeback{ID: id}, nil
+}
+
+func (f *failing) ForEach(_ context.Context, fn func(models.Chargeback) error) error {
+	f.calls++
+	if err := fn(models.Chargeback{ID: "cb-1"}); err != nil {
+		return err
+	}
+	return store.ErrTimeout
+}
+
+func TestRetriesTransientErrors(t *testing.T) {
+	f := &failing{errs: []error{store.ErrTimeout, store.ErrTimeout}}
+	got, err := New(f, policy).Get(ctx, "cb-1")
+	if err != nil || got.ID != "cb-1" || f.calls != 3 {
+		t.Fatalf("get = %+v, %v after %d calls; want cb-1 after 3", got, err, f.calls)
+	}
+}
+
+func TestBoundsAttempts(t *testing.T) {
+	f := &failing{errs: []error{store.ErrTimeout, store.ErrTimeout, store.ErrTimeout, store.ErrTimeout}}
+	if _, err := New(f, policy).Get(ctx, "cb-1"); !errors.Is(err, store.ErrTimeout) || f.calls != 3 {
+		t.Fatalf("get: err = %v after %d calls; want timeout after 3", err, f.calls)
+	}
+}
+
+func TestReturnsPermanentErrors(t *testing.T) {
+	f := &failing{errs: []error{store.ErrNotFound}}
+	if _, err := New(f, policy).Get(ctx, "cb-1"); !errors.Is(err, store.ErrNotFound) || f.calls != 1 {
+		t.Fatalf("get: err = %v after %d calls; want not found after 1", err, f.calls)
+	}
+}
+
+func TestStopsWithContext(t *testing.T) {
+	f := &failing{errs: []error{store.ErrTimeout, store.ErrTimeout}}
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := New(f, Policy{Attempts: 3, MinBackoff: time.Hour, MaxBackoff: time.Hour}).Get(cancelled, "cb-1"); !errors.Is(err, store.ErrTimeout) || f.calls != 1 {
+		t.Fatalf("get: err = %v after %d calls; want timeout after 1", err, f.calls)
+	}
+}
+
+func TestDoesNotRepeatYieldedRecords(t *testing.T) {
+	f := &failing{}
+	n := 0
+	err := New(f, policy).ForEach(ctx, func(models.Chargeback) error {
+		n++
+		return nil
+	})
+	if !errors.Is(err, store.ErrTimeout) || n != 1 || f.calls != 1 {
+		t.Fatalf("for each: err = %v, %d records in %d calls; want timeout, 1 record in 1 call", err, n, f.calls)
+	}
+}
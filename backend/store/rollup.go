@@ -0,0 +1,197 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"sort"
+	"time"
+
+	bolt "github.com/boltdb/bolt"
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/arkantrust/idempotency-example/backend/models"
+)
+
+// rollupBucketName holds running totals of the chargebacks created each day,
+// per currency and owner, so that a report over a date range reads one
+// entry per day and currency instead of every record:
+//
+//	rollups_daily/<YYYY-MM-DD>\x00<currency>\x00<owner> = count, amount
+//
+// Days are UTC creation dates. Both figures are big-endian int64s. The totals
+// change with every write that changes a record, in the same transaction, and
+// only then: a replayed create or a skipped update leaves them alone, which is
+// what keeps them equal to a recount. Entries that reach zero are deleted.
+const rollupBucketName = "rollups_daily"
+
+// rollupDay is the date layout of rollup keys.
+const rollupDay = time.DateOnly
+
+// rollupKey returns the key c is counted under.
+func rollupKey(c *models.Chargeback) []byte {
+	key := []byte(c.CreatedAt.UTC().Format(rollupDay))
+	key = append(append(key, 0), c.Currency...)
+	return append(append(key, 0), c.Owner...)
+}
+
+// rollup moves c's contribution to the daily totals in tx from old to new:
+// nil old for a create, nil new for a delete.
+func rollup(ctx context.Context, tx *bolt.Tx, old, new *models.Chargeback) error {
+	if old != nil && new != nil && bytes.Equal(rollupKey(old), rollupKey(new)) && old.Amount == new.Amount {
+		return nil
+	}
+	b, err := createTenantBucket(ctx, tx, rollupBucketName)
+	if err != nil {
+		return err
+	}
+	if old != nil {
+		if err := addRollup(b, rollupKey(old), -1, -old.Amount); err != nil {
+			return err
+		}
+	}
+	if new != nil {
+		return addRollup(b, rollupKey(new), 1, new.Amount)
+	}
+	return nil
+}
+
+// addRollup adds count and amount to the totals under key.
+func addRollup(b *bolt.Bucket, key []byte, count, amount int64) error {
+	if v := b.Get(key); len(v) == 16 {
+		count += int64(binary.BigEndian.Uint64(v))
+		amount += int64(binary.BigEndian.Uint64(v[8:]))
+	}
+	if count <= 0 {
+		return b.Delete(key)
+	}
+	v := binary.BigEndian.AppendUint64(nil, uint64(count))
+	return b.Put(key, binary.BigEndian.AppendUint64(v, uint64(amount)))
+}
+
+// buildRollups computes the totals of every tenant that has chargebacks but
+// no totals yet, which is only the case for databases written before they
+// existed.
+func (s *Store) buildRollups(tx *bolt.Tx) error {
+	parents, err := tenantParents(tx)
+	if err != nil {
+		return err
+	}
+	for _, p := range parents {
+		records := p.Bucket([]byte(bucketName))
+		if records == nil || p.Bucket([]byte(rollupBucketName)) != nil {
+			continue
+		}
+		b, err := p.CreateBucket([]byte(rollupBucketName))
+		if err != nil {
+			return err
+		}
+		err = records.ForEach(func(k, v []byte) error {
+			var c models.Chargeback
+			if err := s.decode(bucketName, v, &c); err != nil {
+				return err
+			}
+			return addRollup(b, rollupKey(&c), 1, c.Amount)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DailyTotals returns, for each UTC day from from to to inclusive on which
+// chargebacks visible to the caller were created, their count and summed
+// amount per currency. Days come in order and days without chargebacks are
+// left out. A zero from or to leaves that end of the range open.
+//
+// The figures come from the daily totals, so the cost depends on the number
+// of days and currencies in the range, not of chargebacks.
+func (s *Store) DailyTotals(ctx context.Context, from, to time.Time) ([]models.PeriodStats, error) {
+	_, span := startSpan(ctx, "store.DailyTotals", "")
+	var days []models.PeriodStats
+	var first, last string
+	if !from.IsZero() {
+		first = from.UTC().Format(rollupDay)
+	}
+	if !to.IsZero() {
+		last = to.UTC().Format(rollupDay)
+	}
+
+	add := func(day, currency, owner string, count, amount int64) {
+		if (first != "" && day < first) || (last != "" && day > last) || !visibleTo(ctx, owner) {
+			return
+		}
+		if len(days) == 0 || days[len(days)-1].Start != day {
+			days = append(days, models.PeriodStats{Start: day, ByCurrency: []models.CurrencyStats{}})
+		}
+		d := &days[len(days)-1]
+		d.Count += int(count)
+		if n := len(d.ByCurrency); n > 0 && d.ByCurrency[n-1].Currency == currency {
+			d.ByCurrency[n-1].Count += int(count)
+			d.ByCurrency[n-1].Amount += amount
+			return
+		}
+		d.ByCurrency = append(d.ByCurrency, models.CurrencyStats{Currency: currency, Count: int(count), Amount: amount})
+	}
+
+	err := s.view(ctx, func(tx *bolt.Tx) error {
+		b := tenantBucket(ctx, tx, rollupBucketName)
+		if b == nil {
+			// A database opened read-only before its totals were built.
+			return s.countDaily(ctx, tx, add)
+		}
+		cur := b.Cursor()
+		k, v := cur.First()
+		if first != "" {
+			k, v = cur.Seek([]byte(first))
+		}
+		for ; k != nil; k, v = cur.Next() {
+			parts := bytes.SplitN(k, []byte{0}, 3)
+			if len(parts) != 3 || len(v) != 16 {
+				continue
+			}
+			if last != "" && string(parts[0]) > last {
+				break
+			}
+			add(string(parts[0]), string(parts[1]), string(parts[2]),
+				int64(binary.BigEndian.Uint64(v)), int64(binary.BigEndian.Uint64(v[8:])))
+		}
+		return nil
+	})
+	span.SetAttributes(attribute.Int("report.days", len(days)))
+	endSpan(span, err)
+	if err != nil {
+		return nil, err
+	}
+	for i := range days {
+		days[i].Derive()
+	}
+	return days, nil
+}
+
+// countDaily feeds add from the chargebacks themselves, sorted as the daily
+// totals would be.
+func (s *Store) countDaily(ctx context.Context, tx *bolt.Tx, add func(day, currency, owner string, count, amount int64)) error {
+	records := tenantBucket(ctx, tx, bucketName)
+	if records == nil {
+		return nil
+	}
+	var cs []models.Chargeback
+	err := records.ForEach(func(k, v []byte) error {
+		var c models.Chargeback
+		if err := s.decode(bucketName, v, &c); err != nil {
+			return err
+		}
+		cs = append(cs, c)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	sort.Slice(cs, func(i, j int) bool { return bytes.Compare(rollupKey(&cs[i]), rollupKey(&cs[j])) < 0 })
+	for _, c := range cs {
+		add(c.CreatedAt.UTC().Format(rollupDay), c.Currency, c.Owner, 1, c.Amount)
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package store_test
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	bolt "github.com/boltdb/bolt"
+
+	"github.com/arkantrust/idempotency-example/backend/models"
+	"github.com/arkantrust/idempotency-example/backend/store"
+)
+
+// TestDailyTotalsFollowWrites makes every kind of write and checks the daily
+// totals against what a recount would give.
+func TestDailyTotalsFollowWrites(t *testing.T) {
+	s := newTestStore(t)
+	day1, day2 := store.WithTime(ctx, day), store.WithTime(ctx, day.Add(26*time.Hour))
+
+	create := func(ctx context.Context, id string, amount int64, currency string) {
+		t.Helper()
+		if _, _, err := s.Create(ctx, &models.Chargeback{ID: id, Amount: amount, Currency: currency, Reason: "fraud"}); err != nil {
+			t.Fatalf("create %s: %v", id, err)
+		}
+	}
+	create(day1, "a", 100, "USD")
+	create(day1, "b", 50, "EUR")
+	create(day2, "a", 100, "USD") // replay: no change
+	create(day2, "c", 10, "USD")
+	if _, _, err := s.CreateWithKey(day1, "key-1", &models.Chargeback{ID: "d", Amount: 7, Currency: "USD", Reason: "fraud"}); err != nil {
+		t.Fatalf("create with key: %v", err)
+	}
+	if _, err := s.CreateMany(day2, []*models.Chargeback{{ID: "e", Amount: 5, Currency: "GBP", Reason: "fraud"}}); err != nil {
+		t.Fatalf("create many: %v", err)
+	}
+	// Moving "a" to EUR moves it within its creation day.
+	if _, _, err := s.Update(ctx, "a", &models.Chargeback{Amount: 120, Currency: "EUR", Reason: "fraud"}, nil); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if _, err := s.Delete(ctx, "b"); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if _, err := s.DeleteMatching(ctx, store.Filter{Currency: "GBP"}); err != nil {
+		t.Fatalf("delete matching: %v", err)
+	}
+
+	want := []models.PeriodStats{
+		{Start: "2026-03-01", Count: 2, ByCurrency: []models.CurrencyStats{
+			{Currency: "EUR", Count: 1, Amount: 120, DisplayAmount: "1.20"},
+			{Currency: "USD", Count: 1, Amount: 7, DisplayAmount: "0.07"},
+		}},
+		{Start: "2026-03-02", Count: 1, ByCurrency: []models.CurrencyStats{
+			{Currency: "USD", Count: 1, Amount: 10, DisplayAmount: "0.10"},
+		}},
+	}
+	got, err := s.DailyTotals(ctx, time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatalf("daily totals: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v\nwant %+v", got, want)
+	}
+
+	got, err = s.DailyTotals(ctx, day.AddDate(0, 0, 1), time.Time{})
+	if err != nil {
+		t.Fatalf("daily totals: %v", err)
+	}
+	if !reflect.DeepEqual(got, want[1:]) {
+		t.Fatalf("from the second day: got %+v", got)
+	}
+}
+
+// TestDailyTotalsAreBuilt drops the totals, as in a database written before
+// they existed, and checks that they are computed again on open.
+func TestDailyTotalsAreBuilt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	s, err := store.New(path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	createAt(t, s, "a", "b", "c")
+	want, err := s.DailyTotals(ctx, time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatalf("daily totals: %v", err)
+	}
+	s.Close()
+
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		t.Fatalf("bolt open: %v", err)
+	}
+	if err := db.Update(func(tx *bolt.Tx) error { return tx.DeleteBucket([]byte("rollups_daily")) }); err != nil {
+		t.Fatalf("drop totals: %v", err)
+	}
+	db.Close()
+
+	for _, open := range []func(string) (*store.Store, error){store.NewReadOnly, store.New} {
+		s, err := open(path)
+		if err != nil {
+			t.Fatalf("reopen: %v", err)
+		}
+		got, err := s.DailyTotals(ctx, time.Time{}, time.Time{})
+		s.Close()
+		if err != nil {
+			t.Fatalf("daily totals: %v", err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("got %+v\nwant %+v", got, want)
+		}
+	}
+}
@@ -0,0 +1,262 @@
+package store
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+
+	"github.com/vmihailenco/msgpack/v5"
+
+	"github.com/arkantrust/idempotency-example/backend/models"
+)
+
+// Every stored record carries the schema version it was written with, so a
+// model change – a new field with a non-zero default, a renamed or reshaped
+// one – can be made without breaking existing databases: the change comes
+// with a Migration that upgrades records of the previous version, and records
+// are upgraded lazily as they are read (and persisted at the new version the
+// next time they are written) or all at once by Reencode.
+//
+// The version is part of the stored value. JSON values start with a
+// "schemaVersion" key; binary values set the high bit of their tag byte and
+// follow it with the version as a uvarint. Values with neither – everything
+// written before versioning – are version 1. The whole value is then wrapped
+// in a checksummed envelope; see checksum.go.
+
+// Migration upgrades a record from one schema version to the next.
+type Migration struct {
+	// Description says what changed, for the log and for reviewers.
+	Description string
+
+	// Up rewrites a record's fields in place. fields holds the record as
+	// its JSON object would – keys are the json tag names, values are
+	// whatever encoding/json produces for them – whichever codec stored it.
+	Up func(fields map[string]any) error
+}
+
+// chargebackMigrations upgrade chargeback records. The first upgrades
+// version 1 to 2, the next 2 to 3, and so on; append to change the schema,
+// and never edit or remove an entry once released.
+var chargebackMigrations = []Migration{
+	{
+		// Records written before versions were counted have had at
+		// least one write; their history before it is unknown.
+		Description: "add version, starting at 1",
+		Up: func(fields map[string]any) error {
+			fields["version"] = 1
+			return nil
+		},
+	},
+}
+
+// ErrNewerSchema is returned when reading a record written by a newer
+// version of the service, which this one cannot safely interpret.
+var ErrNewerSchema = errors.New("record has a newer schema version than this build understands")
+
+// versionedTag marks a binary value that carries a schema version.
+const versionedTag = 0x80
+
+// jsonVersionKey is the key that opens a versioned JSON value.
+const jsonVersionKey = `{"schemaVersion":`
+
+// AddMigration appends m to the migrations of the records stored in bucket,
+// raising their schema version by one. Migrations must be added before the
+// store is used.
+func (s *Store) AddMigration(bucket string, m Migration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.migrations[bucket] = append(s.migrations[bucket], m)
+}
+
+// SchemaVersion returns the version records in bucket are written with.
+func (s *Store) SchemaVersion(bucket string) int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.schemaVersion(bucket)
+}
+
+// schemaVersion is SchemaVersion for callers holding s.mu.
+func (s *Store) schemaVersion(bucket string) int {
+	return 1 + len(s.migrations[bucket])
+}
+
+// encode encodes v, a record stored in bucket, with the store's codec and
+// the bucket's schema version, sealing its sensitive fields if field
+// encryption is on, in a checksummed envelope. v's derived fields are set
+// first, so that the record a write returns has them.
+func (s *Store) encode(bucket string, v any) ([]byte, error) {
+	if d, ok := v.(models.Derived); ok {
+		d.Derive()
+	}
+	v, err := s.sealed(v)
+	if err != nil {
+		return nil, err
+	}
+	data, err := s.codec.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	version := s.schemaVersion(bucket)
+	var out []byte
+	if data[0] == JSON.tag() {
+		out = strconv.AppendInt([]byte(jsonVersionKey), int64(version), 10)
+		if !bytes.Equal(data, []byte("{}")) {
+			out = append(out, ',')
+		}
+	} else {
+		out = []byte{data[0] | versionedTag}
+		out = binary.AppendUvarint(out, uint64(version))
+	}
+	return checksummed(append(out, data[1:]...)), nil
+}
+
+// decode decodes a value stored in bucket into v, upgrading it through the
+// bucket's migrations if it was written with an older schema and opening its
+// sealed fields. v's derived fields are set from what was stored, whatever
+// the stored record held for them.
+func (s *Store) decode(bucket string, data []byte, v any) error {
+	if err := s.decodeSealed(bucket, data, v); err != nil {
+		return err
+	}
+	if d, ok := v.(models.Derived); ok {
+		d.Derive()
+	}
+	return s.open(v)
+}
+
+// decodeSealed is decode leaving sealed fields sealed.
+func (s *Store) decodeSealed(bucket string, data []byte, v any) error {
+	c, version, payload, err := header(data)
+	if err != nil {
+		return err
+	}
+	current := s.schemaVersion(bucket)
+	switch {
+	case version == current:
+		return c.unmarshal(payload, v)
+	case version > current:
+		return fmt.Errorf("%w: %d > %d", ErrNewerSchema, version, current)
+	}
+
+	fields, err := fieldsOf(c, payload, reflect.TypeOf(v))
+	if err != nil {
+		return err
+	}
+	for i, m := range s.migrations[bucket][version-1:] {
+		if err := m.Up(fields); err != nil {
+			return fmt.Errorf("migrating record to schema version %d (%s): %w", version+i+1, m.Description, err)
+		}
+	}
+	raw, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(raw, v); err != nil {
+		return err
+	}
+	utcTimes(reflect.ValueOf(v))
+	return nil
+}
+
+// stale reports whether data is not stored with the store's codec and the
+// bucket's current schema version, or without a checksum.
+func (s *Store) stale(bucket string, data []byte) bool {
+	c, version, _, err := header(data)
+	return err != nil || c != s.codec || version != s.schemaVersion(bucket) || data[0] != checksumTag
+}
+
+// header splits a stored value into the codec that wrote it, its schema
+// version and the payload that codec decodes, after verifying its checksum.
+// A JSON payload is the whole value; the version key is ignored when it is
+// decoded into a struct.
+func header(data []byte) (Codec, int, []byte, error) {
+	if len(data) == 0 {
+		return nil, 0, nil, errors.New("empty record")
+	}
+	if data[0] == checksumTag {
+		var err error
+		if data, err = verified(data); err != nil {
+			return nil, 0, nil, err
+		}
+	}
+	if data[0] == JSON.tag() {
+		version := 1
+		if rest, ok := bytes.CutPrefix(data, []byte(jsonVersionKey)); ok {
+			end := 0
+			for end < len(rest) && rest[end] >= '0' && rest[end] <= '9' {
+				end++
+			}
+			n, err := strconv.Atoi(string(rest[:end]))
+			if err != nil || n < 1 {
+				return nil, 0, nil, fmt.Errorf("invalid record schema version %q", rest[:end])
+			}
+			version = n
+		}
+		return JSON, version, data, nil
+	}
+
+	tag, rest, version := data[0], data[1:], uint64(1)
+	if tag&versionedTag != 0 {
+		tag &^= versionedTag
+		var n int
+		version, n = binary.Uvarint(rest)
+		if n <= 0 || version < 1 {
+			return nil, 0, nil, errors.New("invalid record schema version")
+		}
+		rest = rest[n:]
+	}
+	for _, c := range codecs {
+		if c.tag() == tag {
+			return c, int(version), rest, nil
+		}
+	}
+	return nil, 0, nil, fmt.Errorf("unknown record encoding tag %#x", data[0])
+}
+
+// fieldsOf decodes payload, written by c, into the JSON object form
+// migrations work on. typ is the type of the record it holds, needed for
+// codecs that are not self-describing.
+func fieldsOf(c Codec, payload []byte, typ reflect.Type) (map[string]any, error) {
+	fields := map[string]any{}
+	switch c {
+	case JSON:
+		if err := json.Unmarshal(payload, &fields); err != nil {
+			return nil, err
+		}
+		delete(fields, "schemaVersion")
+		return fields, nil
+	case MessagePack:
+		if err := msgpack.Unmarshal(payload, &fields); err != nil {
+			return nil, err
+		}
+	default:
+		v := reflect.New(typ.Elem())
+		if err := c.unmarshal(payload, v.Interface()); err != nil {
+			return nil, err
+		}
+		fields = nil
+		raw, err := json.Marshal(v.Interface())
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(raw, &fields); err != nil {
+			return nil, err
+		}
+		return fields, nil
+	}
+	// Normalise MessagePack's values (sized integers, time.Time) to what
+	// encoding/json would have produced.
+	raw, err := json.Marshal(fields)
+	if err != nil {
+		return nil, err
+	}
+	fields = nil
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
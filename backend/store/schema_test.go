@@ -0,0 +1,119 @@
+package store_test
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	bolt "github.com/boltdb/bolt"
+
+	"github.com/arkantrust/idempotency-example/backend/models"
+	"github.com/arkantrust/idempotency-example/backend/store"
+)
+
+// prefixReason is a stand-in schema change: version 2 reasons are prefixed.
+var prefixReason = store.Migration{
+	Description: "prefix reasons",
+	Up: func(fields map[string]any) error {
+		fields["reason"] = "legacy: " + fields["reason"].(string)
+		return nil
+	},
+}
+
+func TestMigrationsUpgradeOldRecords(t *testing.T) {
+	for _, codec := range []store.Codec{store.JSON, store.MessagePack, store.Protobuf} {
+		t.Run(codec.Name(), func(t *testing.T) {
+			s := newTestStore(t)
+			s.SetCodec(codec)
+			cb := &models.Chargeback{ID: "cb-1", Amount: 100, Currency: "USD", Reason: "fraud"}
+			if _, _, err := s.Create(store.WithTenant(ctx, "acme"), cb); err != nil {
+				t.Fatalf("create failed: %v", err)
+			}
+
+			before := s.SchemaVersion("chargebacks")
+			s.AddMigration("chargebacks", prefixReason)
+			if v := s.SchemaVersion("chargebacks"); v != before+1 {
+				t.Fatalf("expected schema version %d, got %d", before+1, v)
+			}
+
+			// Reads upgrade lazily...
+			got, err := s.Get(store.WithTenant(ctx, "acme"), "cb-1")
+			if err != nil {
+				t.Fatalf("get failed: %v", err)
+			}
+			if got.Reason != "legacy: fraud" || got.Amount != 100 || got.CreatedAt.IsZero() {
+				t.Fatalf("expected the record upgraded on read, got %+v", got)
+			}
+
+			// ...and Reencode persists the upgrade, once.
+			st, err := s.Reencode(ctx)
+			if err != nil || st.Rewritten != 1 || st.SchemaVersion != before+1 {
+				t.Fatalf("expected one record rewritten at version %d, got %+v %v", before+1, st, err)
+			}
+			if st, _ := s.Reencode(ctx); st.Rewritten != 0 {
+				t.Fatalf("expected a second run to rewrite nothing, got %+v", st)
+			}
+			got, _ = s.Get(store.WithTenant(ctx, "acme"), "cb-1")
+			if got.Reason != "legacy: fraud" {
+				t.Fatalf("expected the migration applied exactly once, got %q", got.Reason)
+			}
+		})
+	}
+}
+
+func TestUnversionedRecordsAreVersionOne(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "legacy.db")
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte("chargebacks"))
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte("old"), []byte(`{"id":"old","amount":5,"currency":"USD","reason":"fraud","createdAt":"2024-01-02T03:04:05Z"}`))
+	})
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := store.New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	s.AddMigration("chargebacks", prefixReason)
+
+	got, err := s.Get(ctx, "old")
+	if err != nil {
+		t.Fatalf("get failed: %v", err)
+	}
+	if got.Reason != "legacy: fraud" || got.CreatedAt.Year() != 2024 || got.Version != 1 {
+		t.Fatalf("expected the pre-versioning record upgraded from version 1, got %+v", got)
+	}
+}
+
+func TestNewerSchemaIsRejected(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "newer.db")
+	s, err := store.New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.AddMigration("chargebacks", prefixReason)
+	if _, _, err := s.Create(ctx, &models.Chargeback{ID: "cb-1", Amount: 1, Currency: "USD"}); err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+	s.Close()
+
+	// An older build opening the same file must not misread the record.
+	s, err = store.New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if _, err := s.Get(ctx, "cb-1"); !errors.Is(err, store.ErrNewerSchema) {
+		t.Fatalf("expected ErrNewerSchema, got %v", err)
+	}
+}
@@ -0,0 +1,119 @@
+// Package shadow mirrors the chargeback writes made to one backend onto
+// another, to migrate a live deployment between store implementations – or
+// between encodings or machines of the same one – without stopping it.
+//
+// The primary stays the source of truth: every read is answered from it and
+// every write is decided by it. A write the primary made is then repeated on
+// the shadow with the same time, tenant, owner and request ID, so that both
+// stamp the record alike, and the shadow's outcome is compared with the
+// primary's. Reads are made on both and compared too. A divergence is
+// logged and counted in the shadow_divergences_total metric, never returned:
+// a failing shadow does not fail requests.
+//
+// The shadow must start as a copy of the primary, such as a restored
+// snapshot; otherwise every write to an older record diverges. Once it has
+// served a while without divergences it can be promoted to primary.
+//
+// Writes the primary refused are not mirrored, nor are streamed reads
+// (ForEach and its variants), which are answered from the primary alone.
+// Timestamps are compared too, so the primary must honour store.WithTime:
+// a Raft node does not, and cannot be shadowed.
+package shadow
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+
+	"github.com/arkantrust/idempotency-example/backend/metrics"
+	"github.com/arkantrust/idempotency-example/backend/service"
+	"github.com/arkantrust/idempotency-example/backend/store"
+)
+
+// mirror is the Policy of a Backend serving from primary and mirroring to
+// shadow.
+type mirror struct {
+	primary, shadow service.Backend
+}
+
+// New returns a Backend serving from primary and mirroring to shadow.
+func New(primary, shadow service.Backend) service.Backend {
+	return service.Decorate(mirror{primary: primary, shadow: shadow})
+}
+
+// Do makes a write on the primary, then on the shadow, or answers a read
+// from the primary, comparing the shadow's answer.
+func (m mirror) Do(ctx context.Context, op service.Op, call func(context.Context, service.Backend) (any, error)) (any, error) {
+	if op.Write {
+		return write(ctx, op.Name, func(ctx context.Context) (any, error) { return call(ctx, m.primary) },
+			func(ctx context.Context) (any, error) { return call(ctx, m.shadow) })
+	}
+	return read(ctx, op.Name, func() (any, error) { return call(ctx, m.primary) },
+		func() (any, error) { return call(ctx, m.shadow) })
+}
+
+// Walk walks the primary alone.
+func (m mirror) Walk(ctx context.Context, op string, walk func(service.Backend, *service.Walked) error) error {
+	return walk(m.primary, &service.Walked{})
+}
+
+// outcomes are the errors compared by what they mean rather than by their
+// message, which another implementation may word differently.
+var outcomes = []error{
+	store.ErrNotFound,
+	store.ErrKeyConflict,
+	store.ErrKeyReused,
+	store.ErrPreconditionFailed,
+	store.ErrRefundExceedsAmount,
+}
+
+// outcome describes err for comparison: empty for success, the sentinel
+// error it wraps, or its message.
+func outcome(err error) string {
+	if err == nil {
+		return ""
+	}
+	for _, o := range outcomes {
+		if errors.Is(err, o) {
+			return o.Error()
+		}
+	}
+	return err.Error()
+}
+
+// compare logs and counts a divergence between the primary's outcome of op
+// and the shadow's.
+func compare(ctx context.Context, op string, got any, err error, shadowed any, shadowErr error) {
+	p, _ := json.Marshal(got)
+	s, _ := json.Marshal(shadowed)
+	if outcome(err) == outcome(shadowErr) && (err != nil || string(p) == string(s)) {
+		return
+	}
+	metrics.ShadowDivergences.WithLabelValues(op).Inc()
+	slog.WarnContext(ctx, "shadow store diverged", "op", op,
+		"primary", string(p), "primaryErr", outcome(err),
+		"shadow", string(s), "shadowErr", outcome(shadowErr))
+}
+
+// read answers a read from primary, and compares it with shadow's answer.
+func read(ctx context.Context, op string, primary, shadow func() (any, error)) (any, error) {
+	got, err := primary()
+	shadowed, shadowErr := shadow()
+	compare(ctx, op, got, err, shadowed, shadowErr)
+	return got, err
+}
+
+// write makes a write on primary and, if it succeeded, repeats it on shadow
+// and compares the outcomes. The shadow's write is not cancelled with ctx,
+// as the primary's is already made, and its fencing token is not reported.
+func write(ctx context.Context, op string, primary, shadow func(context.Context) (any, error)) (any, error) {
+	ctx = store.WithTime(ctx, store.TimeFrom(ctx))
+	got, err := primary(ctx)
+	if err != nil {
+		return got, err
+	}
+	shadowed, shadowErr := shadow(store.WithFencing(context.WithoutCancel(ctx)))
+	compare(ctx, op, got, err, shadowed, shadowErr)
+	return got, err
+}
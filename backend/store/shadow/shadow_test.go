@@ -0,0 +1,117 @@
+package shadow
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/arkantrust/idempotency-example/backend/models"
+	"github.com/arkantrust/idempotency-example/backend/service"
+	"github.com/arkantrust/idempotency-example/backend/store"
+)
+
+var ctx = context.Background()
+
+func newStore(t *testing.T, codec store.Codec) *store.Store {
+	t.Helper()
+	s, err := store.New(filepath.Join(t.TempDir(), "store.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	s.SetCodec(codec)
+	return s
+}
+
+// logs captures what the package logs during the test.
+func logs(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&buf, nil)))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+	return &buf
+}
+
+func TestMirrorsWrites(t *testing.T) {
+	primary, secondary := newStore(t, store.JSON), newStore(t, store.Protobuf)
+	svc := service.NewChargebacksOn(New(service.Local(primary), service.Local(secondary)))
+	out := logs(t)
+
+	cb := &models.Chargeback{ID: "cb-1", Amount: 500, Currency: "USD", Reason: "fraud"}
+	if _, _, err := svc.Create(ctx, cb); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := svc.CreateWithKey(ctx, "k-1", &models.Chargeback{Amount: 700, Currency: "EUR", Reason: "duplicate"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := svc.CreateWithKey(ctx, "k-1", &models.Chargeback{Amount: 700, Currency: "EUR", Reason: "duplicate"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := svc.Update(ctx, "cb-1", &models.Chargeback{Amount: 600, Currency: "USD", Reason: "fraud"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := svc.Charges.Create(ctx, &models.Charge{ID: "ch-1", Amount: 500, Currency: "USD"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.Get(ctx, "cb-1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.List(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.Delete(ctx, "cb-1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.Get(ctx, "cb-1"); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("get after delete: err = %v, want not found", err)
+	}
+
+	if out.Len() > 0 {
+		t.Errorf("unexpected divergences:\n%s", out)
+	}
+	for _, s := range []*store.Store{primary, secondary} {
+		list, err := s.List(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(list) != 1 || list[0].Amount != 700 {
+			t.Errorf("chargebacks = %+v, want the keyed one", list)
+		}
+	}
+	a, _ := primary.Charges().Get(ctx, "ch-1")
+	b, _ := secondary.Charges().Get(ctx, "ch-1")
+	ja, _ := json.Marshal(a)
+	jb, _ := json.Marshal(b)
+	if a == nil || string(ja) != string(jb) {
+		t.Errorf("charges = %s and %s, want the same", ja, jb)
+	}
+}
+
+func TestReportsDivergence(t *testing.T) {
+	primary, secondary := newStore(t, store.JSON), newStore(t, store.JSON)
+	// A record written before shadowing began, and never copied.
+	if _, _, err := primary.Create(ctx, &models.Chargeback{ID: "cb-1", Amount: 500, Currency: "USD", Reason: "fraud"}); err != nil {
+		t.Fatal(err)
+	}
+	svc := service.NewChargebacksOn(New(service.Local(primary), service.Local(secondary)))
+	out := logs(t)
+
+	got, err := svc.Get(ctx, "cb-1")
+	if err != nil || got.Amount != 500 {
+		t.Fatalf("get = %+v, %v; want the primary's record", got, err)
+	}
+	if _, _, err := svc.Update(ctx, "cb-1", &models.Chargeback{Amount: 600, Currency: "USD", Reason: "fraud"}, nil); err != nil {
+		t.Fatalf("update failed with the shadow failing: %v", err)
+	}
+	for _, op := range []string{"op=get", "op=update"} {
+		if !strings.Contains(out.String(), op) {
+			t.Errorf("no divergence logged for %s:\n%s", op, out)
+		}
+	}
+}
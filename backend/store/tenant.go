@@ -0,0 +1,166 @@
+package store
+
+import (
+	"context"
+	"regexp"
+	"sort"
+
+	bolt "github.com/boltdb/bolt"
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/arkantrust/idempotency-example/backend/models"
+)
+
+// tenantsBucketName holds one nested bucket per tenant, each containing its
+// own chargebacks and idempotency buckets:
+//
+//	tenants/<tenant>/chargebacks/<id>
+//	tenants/<tenant>/idempotency/<owner>\x00<key>
+//
+// The default tenant ("") keeps using the top-level buckets, so databases
+// written before tenants existed are read unchanged.
+const tenantsBucketName = "tenants"
+
+var tenantPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]{0,63}$`)
+
+// ValidTenant reports whether t is usable as a tenant ID: 1–64 letters,
+// digits, underscores or hyphens, starting with a letter or digit.
+func ValidTenant(t string) bool {
+	return tenantPattern.MatchString(t)
+}
+
+type tenantKey struct{}
+
+// WithTenant returns a copy of ctx scoping store operations to tenant.
+//
+// Tenants are a harder boundary than owners: each tenant has its own buckets,
+// so record IDs and idempotency keys are namespaced per tenant. Two tenants
+// that both create chargeback "cb_1" get two independent records, where two
+// owners in the same tenant would get a 409.
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// TenantFrom returns the tenant set by WithTenant, or "" for the default
+// tenant.
+func TenantFrom(ctx context.Context) string {
+	tenant, _ := ctx.Value(tenantKey{}).(string)
+	return tenant
+}
+
+// tenantBucket returns the bucket called name for the tenant in ctx, or nil
+// if the tenant has never written to it.
+func tenantBucket(ctx context.Context, tx *bolt.Tx, name string) *bolt.Bucket {
+	tenant := TenantFrom(ctx)
+	if tenant == "" {
+		return tx.Bucket([]byte(name))
+	}
+	root := tx.Bucket([]byte(tenantsBucketName))
+	if root == nil {
+		return nil
+	}
+	tb := root.Bucket([]byte(tenant))
+	if tb == nil {
+		return nil
+	}
+	return tb.Bucket([]byte(name))
+}
+
+// createTenantBucket is tenantBucket for writers: missing buckets are
+// created, so a tenant comes into existence with its first write.
+func createTenantBucket(ctx context.Context, tx *bolt.Tx, name string) (*bolt.Bucket, error) {
+	tenant := TenantFrom(ctx)
+	if tenant == "" {
+		return tx.CreateBucketIfNotExists([]byte(name))
+	}
+	root, err := tx.CreateBucketIfNotExists([]byte(tenantsBucketName))
+	if err != nil {
+		return nil, err
+	}
+	tb, err := root.CreateBucketIfNotExists([]byte(tenant))
+	if err != nil {
+		return nil, err
+	}
+	return tb.CreateBucketIfNotExists([]byte(name))
+}
+
+// bucketParent holds a tenant's buckets: the transaction itself for the
+// default tenant, the tenant's bucket under tenants for the others.
+type bucketParent interface {
+	Bucket(name []byte) *bolt.Bucket
+	CreateBucket(name []byte) (*bolt.Bucket, error)
+}
+
+// tenantParents returns the bucket parents of every tenant in tx, the
+// default tenant first.
+func tenantParents(tx *bolt.Tx) ([]bucketParent, error) {
+	parents := []bucketParent{tx}
+	root := tx.Bucket([]byte(tenantsBucketName))
+	if root == nil {
+		return parents, nil
+	}
+	err := root.ForEach(func(k, v []byte) error {
+		if v == nil {
+			parents = append(parents, root.Bucket(k))
+		}
+		return nil
+	})
+	return parents, err
+}
+
+// Stats summarises the chargebacks visible to the caller in ctx: the tenant
+// and, if set, the owner.
+func (s *Store) Stats(ctx context.Context) (*models.Stats, error) {
+	return s.stats(ctx, "store.Stats", func(tx *bolt.Tx, fn func(*models.Chargeback) error) error {
+		b := tenantBucket(ctx, tx, bucketName)
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			var c models.Chargeback
+			if err := s.decode(bucketName, v, &c); err != nil {
+				return err
+			}
+			return fn(&c)
+		})
+	})
+}
+
+// stats summarises the chargebacks each walks that are visible to the
+// caller, in a span named name.
+func (s *Store) stats(ctx context.Context, name string, each func(tx *bolt.Tx, fn func(*models.Chargeback) error) error) (*models.Stats, error) {
+	_, span := startSpan(ctx, name, "")
+	stats := models.Stats{Tenant: TenantFrom(ctx), ByCurrency: []models.CurrencyStats{}}
+	totals := map[string]*models.CurrencyStats{}
+
+	err := s.view(ctx, func(tx *bolt.Tx) error {
+		return each(tx, func(c *models.Chargeback) error {
+			if !visible(ctx, c) {
+				return nil
+			}
+			t := totals[c.Currency]
+			if t == nil {
+				t = &models.CurrencyStats{Currency: c.Currency}
+				totals[c.Currency] = t
+			}
+			t.Count++
+			t.Amount += c.Amount
+			stats.Count++
+			return nil
+		})
+	})
+	span.SetAttributes(attribute.Int("chargeback.count", stats.Count))
+	endSpan(span, err)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, t := range totals {
+		t.Derive()
+		stats.ByCurrency = append(stats.ByCurrency, *t)
+	}
+	sort.Slice(stats.ByCurrency, func(i, j int) bool {
+		return stats.ByCurrency[i].Currency < stats.ByCurrency[j].Currency
+	})
+	return &stats, nil
+}
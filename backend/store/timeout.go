@@ -0,0 +1,94 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	bolt "github.com/boltdb/bolt"
+)
+
+// ErrTimeout is returned by an operation whose transaction could not start
+// within the store's timeout or before its context's deadline, because
+// other transactions held the database – behind a slow disk, a compaction
+// or a restore. Nothing was read or written: it is transient, and the
+// operation can be retried.
+var ErrTimeout = Transient(newError(ErrUnavailable, "store operation timed out"))
+
+// SetTimeout bounds how long an operation waits for its transaction to
+// start, so that a slow disk cannot hang callers indefinitely. A transaction
+// that has started runs to the end, however long that takes: a write is
+// never reported failed after it committed. 0, the default, waits as long as
+// the operation's context allows.
+func (s *Store) SetTimeout(d time.Duration) {
+	s.timeout.Store(int64(d))
+}
+
+type noTimeoutKey struct{}
+
+// WithoutTimeout returns a copy of ctx whose operations wait for their
+// transactions as long as ctx allows, whatever the store's timeout: for
+// writes that must not be skipped, like the commands a Raft node applies.
+func WithoutTimeout(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noTimeoutKey{}, true)
+}
+
+// States of a transaction begin starts.
+const (
+	txPending int32 = iota
+	txStarted
+	txAbandoned
+)
+
+// errAbandoned rolls back a transaction whose caller stopped waiting for it
+// to start.
+var errAbandoned = errors.New("transaction abandoned")
+
+// begin runs fn in the transaction run starts, unless ctx is done before
+// the transaction starts, or the store's timeout passes: then it returns
+// ctx's error or ErrTimeout, and the transaction, if it starts later, rolls
+// back without calling fn. The errors Bolt refuses writes with are given
+// their kinds.
+func (s *Store) begin(ctx context.Context, run func(func(*bolt.Tx) error) error, fn func(*bolt.Tx) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	tx := run
+	run = func(fn func(*bolt.Tx) error) error { return classify(tx(fn)) }
+	if timeout := time.Duration(s.timeout.Load()); timeout > 0 && ctx.Value(noTimeoutKey{}) == nil {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, timeout, ErrTimeout)
+		defer cancel()
+	}
+	if ctx.Done() == nil {
+		return run(fn)
+	}
+
+	// The transaction and the wait race to move state out of txPending;
+	// whichever does decides. A batched fn may run again once started.
+	var state atomic.Int32
+	done := make(chan error, 1)
+	go func() {
+		done <- run(func(tx *bolt.Tx) error {
+			if !state.CompareAndSwap(txPending, txStarted) && state.Load() != txStarted {
+				return errAbandoned
+			}
+			return fn(tx)
+		})
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		if !state.CompareAndSwap(txPending, txAbandoned) {
+			return <-done
+		}
+		err := context.Cause(ctx)
+		if errors.Is(err, context.DeadlineExceeded) {
+			err = fmt.Errorf("%w: %w", ErrTimeout, err)
+		}
+		return err
+	}
+}
@@ -0,0 +1,61 @@
+package store_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/arkantrust/idempotency-example/backend/models"
+	"github.com/arkantrust/idempotency-example/backend/store"
+)
+
+func TestCancelledContextStartsNoTransaction(t *testing.T) {
+	s := newTestStore(t)
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+
+	if _, _, err := s.Create(cancelled, &models.Chargeback{ID: "cb-1", Amount: 100, Currency: "USD", Reason: "fraud"}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("create: err = %v, want canceled", err)
+	}
+	if _, err := s.Get(ctx, "cb-1"); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("get: err = %v, want not found", err)
+	}
+}
+
+func TestTimeoutWaitingForTransaction(t *testing.T) {
+	s := newTestStore(t)
+	s.SetTimeout(50 * time.Millisecond)
+
+	// A transaction holding the writer longer than the timeout.
+	started, release := make(chan struct{}), make(chan struct{})
+	held := make(chan error, 1)
+	go func() {
+		held <- s.WithTx(ctx, func(tx store.Tx) error {
+			close(started)
+			<-release
+			_, _, err := tx.Create(&models.Chargeback{ID: "held", Amount: 100, Currency: "USD", Reason: "fraud"})
+			return err
+		})
+	}()
+	<-started
+
+	_, _, err := s.Create(ctx, &models.Chargeback{ID: "waiting", Amount: 100, Currency: "USD", Reason: "fraud"})
+	if !errors.Is(err, store.ErrTimeout) || !store.IsTransient(err) {
+		t.Fatalf("create: err = %v, want a transient timeout", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+
+	// The transaction that had started still commits.
+	if err := <-held; err != nil {
+		t.Fatalf("held transaction: %v", err)
+	}
+	if _, err := s.Get(ctx, "held"); err != nil {
+		t.Errorf("get held: %v", err)
+	}
+	// The one that timed out never writes, even once the writer is free.
+	if _, err := s.Get(ctx, "waiting"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("get waiting: err = %v, want not found", err)
+	}
+}
@@ -0,0 +1,32 @@
+package store
+
+import (
+	"errors"
+
+	bolt "github.com/boltdb/bolt"
+)
+
+// Errors are transient or permanent. A transient error failed an operation
+// on the database being busy, before the operation did anything, so the same
+// operation can be retried as it is and may succeed. Every other error is
+// permanent: retrying would fail again – on the input, on the records, on
+// the store's mode – or could apply the operation twice.
+
+// transientError marks a failure retrying may fix.
+type transientError struct{ err error }
+
+func (e *transientError) Error() string { return e.err.Error() }
+func (e *transientError) Unwrap() error { return e.err }
+
+// Transient marks err as transient. Only an error returned before anything
+// was read or written may be marked.
+func Transient(err error) error {
+	return &transientError{err: err}
+}
+
+// IsTransient reports whether err is transient: marked by Transient, such as
+// ErrTimeout, or Bolt's timeout waiting for the file lock.
+func IsTransient(err error) bool {
+	var t *transientError
+	return errors.As(err, &t) || errors.Is(err, bolt.ErrTimeout)
+}
@@ -0,0 +1,60 @@
+package store
+
+import (
+	"context"
+
+	bolt "github.com/boltdb/bolt"
+
+	"github.com/arkantrust/idempotency-example/backend/models"
+)
+
+// Tx is a read-write transaction spanning several chargeback operations. Its
+// methods behave like the Store methods of the same name – same idempotency
+// checks, tenant and owner scoping – but nothing they write is visible to
+// others until the transaction commits, and all of it is discarded if it
+// does not.
+//
+// The results they report (created, written, existed) describe the
+// transaction's view: after a rollback, nothing was created or written.
+type Tx struct {
+	ctx context.Context
+	tx  *bolt.Tx
+	s   *Store
+}
+
+// WithTx runs fn in a single Bolt transaction scoped by ctx. If fn returns
+// nil the transaction commits and every operation in it takes effect;
+// otherwise none does, and fn's error is returned.
+//
+// Bolt allows one writer at a time, so fn must not call other Store methods
+// that write – they would wait for this transaction forever – and should not
+// do slow work such as network calls. tx must not be used after fn returns.
+func (s *Store) WithTx(ctx context.Context, fn func(tx Tx) error) error {
+	_, span := startSpan(ctx, "store.WithTx", "")
+	err := s.update(ctx, func(btx *bolt.Tx) error {
+		return fn(Tx{ctx: ctx, tx: btx, s: s})
+	})
+	endSpan(span, err)
+	return err
+}
+
+// Get returns the chargeback id as this transaction sees it, including its
+// own uncommitted writes.
+func (t Tx) Get(id string) (*models.Chargeback, error) {
+	return t.s.chargebacks.getIn(t.ctx, t.tx, id)
+}
+
+// Create is Store.Create inside the transaction.
+func (t Tx) Create(c *models.Chargeback) (*models.Chargeback, bool, error) {
+	return t.s.chargebacks.createIn(t.ctx, t.tx, c)
+}
+
+// Update is Store.Update inside the transaction.
+func (t Tx) Update(id string, incoming *models.Chargeback, mask models.FieldMask) (*models.Chargeback, bool, error) {
+	return t.s.chargebacks.updateIn(t.ctx, t.tx, id, func(c *models.Chargeback) { mask.Merge(c, incoming) }, nil)
+}
+
+// Delete is Store.Delete inside the transaction.
+func (t Tx) Delete(id string) (bool, error) {
+	return t.s.chargebacks.deleteIn(t.ctx, t.tx, id)
+}
@@ -0,0 +1,180 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"strings"
+	"time"
+
+	bolt "github.com/boltdb/bolt"
+
+	"github.com/arkantrust/idempotency-example/backend/models"
+)
+
+// usageBucketName holds the usage of every client, shared by every tenant,
+// keyed by period and owner ("2006-01-02/key:k1" for a day, "2006-01/key:k1"
+// for a month) with the request and write counts as two big-endian uint64s.
+// Counting is bookkeeping, so it carries on in ModeMaintenance.
+const usageBucketName = "usage"
+
+// UsageDays is how many days the counts of a day are kept for, by
+// SweepUsage. Those of a month are kept for good.
+const UsageDays = 90
+
+// Layouts of the periods usage is counted over.
+const (
+	DayPeriod   = "2006-01-02"
+	MonthPeriod = "2006-01"
+)
+
+// Quota bounds the requests a client may make per UTC day and month. Zero
+// leaves a period unbounded.
+type Quota struct {
+	Daily   int64
+	Monthly int64
+}
+
+// QuotaError is returned by CountUsage for a request over a quota.
+type QuotaError struct {
+	// Period is the layout of the exhausted period: DayPeriod or
+	// MonthPeriod.
+	Period string
+
+	// Reset is when the period ends and the quota is available again.
+	Reset time.Time
+}
+
+func (e *QuotaError) Error() string {
+	if e.Period == DayPeriod {
+		return "daily quota exceeded"
+	}
+	return "monthly quota exceeded"
+}
+
+// CountUsage counts a request by owner at at, a write if write is set, in
+// its day and month, unless either already holds as many requests as q
+// allows, in which case it counts nothing and returns a *QuotaError.
+//
+// Requests counted at once share a transaction: counting every request
+// would otherwise be a write, with its fsync, of its own.
+func (s *Store) CountUsage(ctx context.Context, owner string, at time.Time, write bool, q Quota) error {
+	at = at.UTC()
+	day, month := at.Format(DayPeriod), at.Format(MonthPeriod)
+	var over *QuotaError
+	err := s.tally(ctx, func(tx *bolt.Tx) error {
+		// A refusal is not an error of the transaction, which would have it
+		// rolled back and run again alone, but its outcome.
+		over = nil
+		b, err := tx.CreateBucketIfNotExists([]byte(usageBucketName))
+		if err != nil {
+			return err
+		}
+		dayKey, monthKey := []byte(day+"/"+owner), []byte(month+"/"+owner)
+		d, m := usageCounts(b.Get(dayKey)), usageCounts(b.Get(monthKey))
+		switch {
+		case q.Daily > 0 && d.Requests >= q.Daily:
+			over = &QuotaError{Period: DayPeriod, Reset: time.Date(at.Year(), at.Month(), at.Day()+1, 0, 0, 0, 0, time.UTC)}
+			return nil
+		case q.Monthly > 0 && m.Requests >= q.Monthly:
+			over = &QuotaError{Period: MonthPeriod, Reset: time.Date(at.Year(), at.Month()+1, 1, 0, 0, 0, 0, time.UTC)}
+			return nil
+		}
+		for _, u := range []struct {
+			key []byte
+			c   models.Usage
+		}{{dayKey, d}, {monthKey, m}} {
+			u.c.Requests++
+			if write {
+				u.c.Writes++
+			}
+			v := binary.BigEndian.AppendUint64(nil, uint64(u.c.Requests))
+			if err := b.Put(u.key, binary.BigEndian.AppendUint64(v, uint64(u.c.Writes))); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if over != nil {
+		return over
+	}
+	return nil
+}
+
+// SweepUsage deletes the counts of the days more than UsageDays before now,
+// returning how many it deleted; those of their months are kept.
+func (s *Store) SweepUsage(ctx context.Context, now time.Time) (int, error) {
+	cutoff := []byte(now.UTC().AddDate(0, 0, -UsageDays).Format(DayPeriod))
+	n := 0
+	err := s.maintain(ctx, func(tx *bolt.Tx) error {
+		n = 0
+		b := tx.Bucket([]byte(usageBucketName))
+		if b == nil {
+			return nil
+		}
+		// Keys sort by period, so every day before the cutoff sorts before
+		// it. A month's keys among them have "/" where a day has "-".
+		var doomed [][]byte
+		c := b.Cursor()
+		for k, _ := c.First(); k != nil && bytes.Compare(k, cutoff) < 0; k, _ = c.Next() {
+			if len(k) > len(MonthPeriod) && k[len(MonthPeriod)] == '-' {
+				doomed = append(doomed, bytes.Clone(k))
+			}
+		}
+		for _, k := range doomed {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+		}
+		n = len(doomed)
+		return nil
+	})
+	return n, err
+}
+
+// Usage returns the usage of every client in period, a day or a month
+// formatted as DayPeriod or MonthPeriod, ordered by owner.
+func (s *Store) Usage(ctx context.Context, period string) ([]models.Usage, error) {
+	if !validPeriod(period) {
+		return nil, ErrInvalidPeriod
+	}
+	usage := []models.Usage{}
+	err := s.view(ctx, func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(usageBucketName))
+		if b == nil {
+			return nil
+		}
+		prefix := []byte(period + "/")
+		c := b.Cursor()
+		for k, v := c.Seek(prefix); k != nil && strings.HasPrefix(string(k), string(prefix)); k, v = c.Next() {
+			u := usageCounts(v)
+			u.Owner, u.Period = string(k[len(prefix):]), period
+			usage = append(usage, u)
+		}
+		return nil
+	})
+	return usage, err
+}
+
+// ErrInvalidPeriod is returned by Usage for a period that is neither a day
+// nor a month.
+var ErrInvalidPeriod = newError(ErrValidation, "period must be a day (YYYY-MM-DD) or a month (YYYY-MM)")
+
+func validPeriod(period string) bool {
+	_, dayErr := time.Parse(DayPeriod, period)
+	_, monthErr := time.Parse(MonthPeriod, period)
+	return dayErr == nil || monthErr == nil
+}
+
+func usageCounts(v []byte) models.Usage {
+	if len(v) != 16 {
+		return models.Usage{}
+	}
+	return models.Usage{
+		Requests: int64(binary.BigEndian.Uint64(v)),
+		Writes:   int64(binary.BigEndian.Uint64(v[8:])),
+	}
+}
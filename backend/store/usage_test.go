@@ -0,0 +1,95 @@
+package store_test
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/arkantrust/idempotency-example/backend/models"
+	"github.com/arkantrust/idempotency-example/backend/store"
+)
+
+func TestCountUsage(t *testing.T) {
+	s := newTestStore(t)
+	at := time.Date(2026, 10, 17, 23, 0, 0, 0, time.UTC)
+	q := store.Quota{Daily: 2, Monthly: 3}
+
+	for _, write := range []bool{false, true} {
+		if err := s.CountUsage(ctx, "key:k1", at, write, q); err != nil {
+			t.Fatalf("count: %v", err)
+		}
+	}
+	var qe *store.QuotaError
+	if err := s.CountUsage(ctx, "key:k1", at, false, q); !errors.As(err, &qe) || qe.Period != store.DayPeriod || !qe.Reset.Equal(at.Add(time.Hour)) {
+		t.Fatalf("over the daily quota: err = %v, want it to reset at midnight", err)
+	}
+	// Another client has its own quota, and the next day the month's.
+	if err := s.CountUsage(ctx, "key:k2", at, false, q); err != nil {
+		t.Fatalf("count for another client: %v", err)
+	}
+	if err := s.CountUsage(ctx, "key:k1", at.Add(2*time.Hour), false, q); err != nil {
+		t.Fatalf("count the next day: %v", err)
+	}
+	if err := s.CountUsage(ctx, "key:k1", at.Add(2*time.Hour), false, q); !errors.As(err, &qe) || qe.Period != store.MonthPeriod {
+		t.Fatalf("over the monthly quota: err = %v", err)
+	}
+
+	usage, err := s.Usage(ctx, "2026-10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []models.Usage{
+		{Owner: "key:k1", Period: "2026-10", Requests: 3, Writes: 1},
+		{Owner: "key:k2", Period: "2026-10", Requests: 1},
+	}
+	if len(usage) != len(want) || usage[0] != want[0] || usage[1] != want[1] {
+		t.Errorf("usage = %+v, want %+v", usage, want)
+	}
+	if _, err := s.Usage(ctx, "October"); !errors.Is(err, store.ErrValidation) {
+		t.Errorf("usage of a malformed period: err = %v, want a validation error", err)
+	}
+
+	// Sweeping keeps the days of the last UsageDays, and every month.
+	later := at.AddDate(0, 0, store.UsageDays+1).Add(time.Hour)
+	if err := s.CountUsage(ctx, "key:k1", later, false, store.Quota{}); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := s.SweepUsage(ctx, later); err != nil || n != 3 {
+		t.Fatalf("sweep: %d, %v; want the 3 counts of the first two days", n, err)
+	}
+	for period, want := range map[string]int{"2026-10-17": 0, "2026-10-18": 0, later.Format(store.DayPeriod): 1, "2026-10": 2} {
+		if usage, err := s.Usage(ctx, period); err != nil || len(usage) != want {
+			t.Errorf("usage of %s after sweeping: %+v, %v; want %d clients", period, usage, err, want)
+		}
+	}
+}
+
+func TestCountUsageConcurrently(t *testing.T) {
+	s := newTestStore(t)
+	at := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+	q := store.Quota{Daily: 50}
+
+	// Requests counted at once share transactions, and still each see the
+	// counts of the others: exactly the quota gets through.
+	var wg sync.WaitGroup
+	var refused atomic.Int64
+	for range 60 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var qe *store.QuotaError
+			if err := s.CountUsage(ctx, "key:k1", at, false, q); errors.As(err, &qe) {
+				refused.Add(1)
+			} else if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	usage, err := s.Usage(ctx, "2026-10-17")
+	if err != nil || len(usage) != 1 || usage[0].Requests != 50 || refused.Load() != 10 {
+		t.Fatalf("usage %+v, %v, %d refused; want 50 counted and 10 refused", usage, err, refused.Load())
+	}
+}
@@ -0,0 +1,67 @@
+package store
+
+import (
+	"bytes"
+	"context"
+
+	bolt "github.com/boltdb/bolt"
+
+	"github.com/arkantrust/idempotency-example/backend/models"
+)
+
+// webhookDeliveriesBucketName holds the attempts at delivering each event,
+// per tenant, in the order they were made:
+//
+//	webhook_deliveries/<event id>\x00<at><id>
+//
+// Recording them is bookkeeping, like the jobs making them, so it carries on
+// in ModeMaintenance.
+const webhookDeliveriesBucketName = "webhook_deliveries"
+
+// RecordWebhookDelivery saves d, minting its ID, for the tenant in ctx.
+func (s *Store) RecordWebhookDelivery(ctx context.Context, d *models.WebhookDelivery) error {
+	return s.maintain(ctx, func(tx *bolt.Tx) error {
+		b, err := createTenantBucket(ctx, tx, webhookDeliveriesBucketName)
+		if err != nil {
+			return err
+		}
+		d.ID = models.NewID()
+		data, err := s.encode(webhookDeliveriesBucketName, d)
+		if err != nil {
+			return err
+		}
+		return b.Put(append(deliveryPrefix(d.EventID), createdKey(d.At, d.ID)...), data)
+	})
+}
+
+// WebhookDeliveries returns the attempts at delivering the event eventID of
+// the tenant in ctx, oldest first, to every URL; none when the event is
+// unknown or no attempt was made yet.
+func (s *Store) WebhookDeliveries(ctx context.Context, eventID string) ([]models.WebhookDelivery, error) {
+	deliveries := []models.WebhookDelivery{}
+	err := s.view(ctx, func(tx *bolt.Tx) error {
+		b := tenantBucket(ctx, tx, webhookDeliveriesBucketName)
+		if b == nil {
+			return nil
+		}
+		prefix := deliveryPrefix(eventID)
+		c := b.Cursor()
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			var d models.WebhookDelivery
+			if err := s.decode(webhookDeliveriesBucketName, v, &d); err != nil {
+				return err
+			}
+			deliveries = append(deliveries, d)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+// deliveryPrefix is the key prefix of the deliveries of the event id.
+func deliveryPrefix(id string) []byte {
+	return append([]byte(id), 0)
+}
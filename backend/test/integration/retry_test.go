@@ -0,0 +1,231 @@
+// Package integration runs the API over real HTTP connections with many
+// clients retrying the same operations at once, some of them abandoning
+// their requests midway, and checks the state they leave behind.
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/arkantrust/idempotency-example/backend/handlers"
+	"github.com/arkantrust/idempotency-example/backend/models"
+	"github.com/arkantrust/idempotency-example/backend/service"
+	"github.com/arkantrust/idempotency-example/backend/store"
+)
+
+// clients is how many clients send each operation at once.
+const clients = 32
+
+const body = `{"amount":100,"currency":"USD","reason":"fraud"}`
+
+type server struct {
+	*httptest.Server
+	t *testing.T
+}
+
+func newServer(t *testing.T) *server {
+	t.Helper()
+	s, err := store.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to open test store: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	srv := httptest.NewServer(handlers.New(s, service.NewChargebacks(s)))
+	t.Cleanup(srv.Close)
+	return &server{Server: srv, t: t}
+}
+
+// response is what a client saw of one request.
+type response struct {
+	status int
+	header http.Header
+	body   []byte
+}
+
+// send sends one request. With abandon set the client gives up on it after
+// a random delay of up to 5ms, before or after the server has acted on it;
+// a request given up on returns nil.
+func (s *server) send(method, path, key, payload string, abandon bool) *response {
+	ctx := context.Background()
+	if abandon {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, rand.N(5*time.Millisecond))
+		defer cancel()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, s.URL+path, strings.NewReader(payload))
+	if err != nil {
+		s.t.Error(err)
+		return nil
+	}
+	if key != "" {
+		req.Header.Set(handlers.IdempotencyKeyHeader, key)
+	}
+	resp, err := s.Client().Do(req)
+	if err != nil {
+		if !errors.Is(err, context.DeadlineExceeded) {
+			s.t.Errorf("%s %s: %v", method, path, err)
+		}
+		return nil
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		if !errors.Is(err, context.DeadlineExceeded) {
+			s.t.Errorf("%s %s: %v", method, path, err)
+		}
+		return nil
+	}
+	return &response{status: resp.StatusCode, header: resp.Header, body: data}
+}
+
+// race sends the request from every client at once, half of which abandon
+// it, and then retries it until it succeeds, as a client recovering from an
+// ambiguous failure would. It returns the responses the clients saw.
+func (s *server) race(method, path, key, payload string) []*response {
+	var (
+		mu        sync.Mutex
+		responses []*response
+		wg        sync.WaitGroup
+	)
+	for i := range clients {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if r := s.send(method, path, key, payload, i%2 == 1); r != nil {
+				mu.Lock()
+				responses = append(responses, r)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	for {
+		r := s.send(method, path, key, payload, false)
+		if r == nil || r.status < 300 {
+			return append(responses, r)
+		}
+		if r.status != http.StatusConflict { // 409: a request with the key is still running
+			s.t.Fatalf("%s %s: retry answered %d: %s", method, path, r.status, r.body)
+		}
+	}
+}
+
+func (s *server) list() []models.Chargeback {
+	r := s.send(http.MethodGet, "/chargebacks", "", "", false)
+	var cbs []models.Chargeback
+	if err := json.Unmarshal(r.body, &cbs); err != nil {
+		s.t.Fatalf("failed to decode list: %v: %s", err, r.body)
+	}
+	return cbs
+}
+
+func count(responses []*response, fn func(*response) bool) int {
+	n := 0
+	for _, r := range responses {
+		if r != nil && fn(r) {
+			n++
+		}
+	}
+	return n
+}
+
+func TestConcurrentCreatesByID(t *testing.T) {
+	s := newServer(t)
+	responses := s.race(http.MethodPost, "/chargebacks/cb-1", "", body)
+
+	if n := count(responses, func(r *response) bool { return r.status == http.StatusCreated }); n > 1 {
+		t.Fatalf("expected at most one 201, got %d", n)
+	}
+	if n := count(responses, func(r *response) bool { return r.status != http.StatusCreated && r.status != http.StatusOK }); n > 0 {
+		t.Fatalf("expected only 201 and 200, got %d others", n)
+	}
+	if cbs := s.list(); len(cbs) != 1 || cbs[0].ID != "cb-1" || cbs[0].Amount != 100 {
+		t.Fatalf("expected exactly one record, got %+v", cbs)
+	}
+}
+
+func TestConcurrentCreatesByKey(t *testing.T) {
+	s := newServer(t)
+	responses := s.race(http.MethodPost, "/chargebacks", "key-1", body)
+
+	locations := map[string]bool{}
+	for _, r := range responses {
+		if r != nil && r.status < 300 {
+			locations[r.header.Get("Location")] = true
+		}
+	}
+	if len(locations) != 1 {
+		t.Fatalf("expected every response to name one record, got %v", locations)
+	}
+	if cbs := s.list(); len(cbs) != 1 || !locations["/chargebacks/"+cbs[0].ID] {
+		t.Fatalf("expected exactly the one record named, got %+v", cbs)
+	}
+}
+
+func TestConcurrentUpdatesAndDeletes(t *testing.T) {
+	s := newServer(t)
+	if r := s.send(http.MethodPost, "/chargebacks/cb-1", "", body, false); r.status != http.StatusCreated {
+		t.Fatalf("create: %d", r.status)
+	}
+
+	update := `{"amount":250,"currency":"EUR","reason":"duplicate"}`
+	responses := s.race(http.MethodPut, "/chargebacks/cb-1", "", update)
+	if n := count(responses, func(r *response) bool { return r.header.Get("X-Idempotency-Write") == "true" }); n > 1 {
+		t.Fatalf("expected at most one update written, got %d", n)
+	}
+	cbs := s.list()
+	if len(cbs) != 1 || cbs[0].Amount != 250 || cbs[0].Currency != "EUR" || cbs[0].Reason != "duplicate" {
+		t.Fatalf("expected the updated record, got %+v", cbs)
+	}
+	// Every write of the record bumps its version; the retries wrote none.
+	if cbs[0].Version > 2 {
+		t.Fatalf("expected one write after the create, got version %d", cbs[0].Version)
+	}
+
+	responses = s.race(http.MethodDelete, "/chargebacks/cb-1", "", "")
+	if n := count(responses, func(r *response) bool { return r.header.Get(handlers.ReplayedHeader) == "false" }); n > 1 {
+		t.Fatalf("expected at most one delete to remove the record, got %d", n)
+	}
+	if n := count(responses, func(r *response) bool { return r.status != http.StatusOK }); n > 0 {
+		t.Fatalf("expected every delete to succeed, got %d failures", n)
+	}
+	if cbs := s.list(); len(cbs) != 0 {
+		t.Fatalf("expected no records, got %+v", cbs)
+	}
+}
+
+// TestConcurrentMixedWrites creates, updates and deletes the same record at
+// once. Which wins is up to the scheduler, but there is never more than one
+// record, and what there is holds what a client sent.
+func TestConcurrentMixedWrites(t *testing.T) {
+	s := newServer(t)
+	var wg sync.WaitGroup
+	for i := range clients * 3 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			method := []string{http.MethodPost, http.MethodPut, http.MethodDelete}[i%3]
+			if r := s.send(method, "/chargebacks/cb-1", "", body, rand.N(2) == 0); r != nil && r.status >= 500 {
+				t.Errorf("%s: %d: %s", method, r.status, r.body)
+			}
+		}()
+	}
+	wg.Wait()
+
+	switch cbs := s.list(); {
+	case len(cbs) > 1:
+		t.Fatalf("expected at most one record, got %+v", cbs)
+	case len(cbs) == 1 && (cbs[0].ID != "cb-1" || cbs[0].Amount != 100 || cbs[0].Reason != "fraud"):
+		t.Fatalf("expected the record sent, got %+v", cbs[0])
+	}
+}
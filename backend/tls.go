@@ -0,0 +1,83 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+
+	"github.com/arkantrust/idempotency-example/backend/config"
+)
+
+// newTLSConfig builds the server's TLS configuration, or returns nil when
+// cfg leaves TLS disabled.
+//
+// Static certificates are loaded once at startup; restart the server to pick
+// up a renewed certificate. Autocert certificates are obtained on the first
+// handshake for the configured host and renewed automatically.
+func newTLSConfig(cfg config.TLSConfig) (*tls.Config, error) {
+	if !cfg.Enabled() {
+		return nil, nil
+	}
+
+	var tc *tls.Config
+	if cfg.AutocertHost != "" {
+		m := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(cfg.AutocertHost),
+			Cache:      autocert.DirCache(cfg.AutocertDir),
+		}
+		tc = m.TLSConfig()
+	} else {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load certificate: %w", err)
+		}
+		tc = &tls.Config{Certificates: []tls.Certificate{cert}}
+	}
+	tc.MinVersion = tls.VersionTLS12
+
+	if cfg.ClientCAFile != "" {
+		pem, err := os.ReadFile(cfg.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read client CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("client CA file contains no certificates")
+		}
+		tc.ClientCAs = pool
+		tc.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return tc, nil
+}
+
+// httpsConfig returns the configuration of the HTTPS server from tc, built
+// by newTLSConfig from cfg. Let's Encrypt validates an autocert host with a
+// TLS-ALPN-01 handshake on it presenting no client certificate, which tc
+// refuses when it requires one: a handshake offering acme-tls/1 then gets a
+// copy of tc negotiating only that protocol, and not asking for one. The
+// server closes a connection that negotiated it without serving a request
+// on it, so no request skips the client certificate this way.
+func httpsConfig(cfg config.TLSConfig, tc *tls.Config) *tls.Config {
+	if cfg.AutocertHost == "" || tc.ClientAuth != tls.RequireAndVerifyClientCert {
+		return tc
+	}
+	challenge := tc.Clone()
+	challenge.NextProtos = []string{acme.ALPNProto}
+	challenge.ClientCAs, challenge.ClientAuth = nil, tls.NoClientCert
+
+	tc = tc.Clone()
+	tc.GetConfigForClient = func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+		if slices.Contains(hello.SupportedProtos, acme.ALPNProto) {
+			return challenge, nil
+		}
+		return nil, nil
+	}
+	return tc
+}
@@ -0,0 +1,91 @@
+// Package tracing configures OpenTelemetry for the server.
+//
+// Spans are created by the HTTP middleware (one server span per request) and
+// by every store operation. Store spans carry an "idempotency.outcome"
+// attribute, so in a trace viewer a retried POST shows up as a short
+// "replayed" span with no write, next to the original "created" span that
+// paid for the transaction commit.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+// Options selects and configures the span exporter.
+type Options struct {
+	// Exporter is "none", "stdout" or "otlp".
+	Exporter string
+
+	// Endpoint is the OTLP/HTTP collector address (host:port). When empty
+	// the exporter falls back to the standard OTEL_EXPORTER_OTLP_* variables
+	// and finally to localhost:4318.
+	Endpoint string
+
+	// Insecure disables TLS towards the collector.
+	Insecure bool
+
+	// SampleRatio is the fraction of new traces to sample (0–1). Traces
+	// started by an upstream service follow the parent's decision.
+	SampleRatio float64
+
+	ServiceName string
+}
+
+// Setup installs the global tracer provider and W3C trace-context
+// propagator. The returned function flushes buffered spans and must be
+// called on shutdown. With Exporter "none" only the propagator is installed,
+// so incoming trace context is still honoured while nothing is exported.
+func Setup(ctx context.Context, opts Options) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	var exp sdktrace.SpanExporter
+	var err error
+	switch opts.Exporter {
+	case "", "none":
+		return func(context.Context) error { return nil }, nil
+	case "stdout":
+		exp, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case "otlp":
+		var o []otlptracehttp.Option
+		if opts.Endpoint != "" {
+			o = append(o, otlptracehttp.WithEndpoint(opts.Endpoint))
+		}
+		if opts.Insecure {
+			o = append(o, otlptracehttp.WithInsecure())
+		}
+		exp, err = otlptracehttp.New(ctx, o...)
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q", opts.Exporter)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(
+		semconv.ServiceName(opts.ServiceName),
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exp),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(opts.SampleRatio))),
+	)
+	otel.SetTracerProvider(tp)
+	return tp.Shutdown, nil
+}
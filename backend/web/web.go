@@ -0,0 +1,65 @@
+// Package web serves the React frontend from the binary.
+//
+// `npm run build` in ../frontend writes the bundle to dist/app, which is
+// embedded at compile time. A binary built without it still works; it just
+// serves no frontend.
+package web
+
+import (
+	"embed"
+	"errors"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+)
+
+//go:embed all:dist
+var dist embed.FS
+
+// Frontend returns the embedded bundle, or false if the binary was built
+// before the frontend.
+func Frontend() (fs.FS, bool) {
+	app, err := fs.Sub(dist, "dist/app")
+	if err != nil {
+		return nil, false
+	}
+	if _, err := fs.Stat(app, "index.html"); err != nil {
+		return nil, false
+	}
+	return app, true
+}
+
+// Handler serves the single-page app in fsys. Paths naming a file serve it;
+// other extensionless paths serve index.html, so client-side routes survive
+// a reload. Missing assets are 404s rather than HTML a script tag cannot use.
+func Handler(fsys fs.FS) http.Handler {
+	files := http.FileServerFS(fsys)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(path.Clean(r.URL.Path), "/")
+		if name == "" {
+			name = "index.html"
+		}
+		info, err := fs.Stat(fsys, name)
+		if err == nil && info.IsDir() {
+			// No directory listings.
+			err = fs.ErrNotExist
+		}
+		switch {
+		case err == nil && strings.HasPrefix(name, "assets/"):
+			// Vite fingerprints everything under assets/, so a name never
+			// changes content.
+			w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+			files.ServeHTTP(w, r)
+		case err == nil && name != "index.html":
+			files.ServeHTTP(w, r)
+		case err == nil || errors.Is(err, fs.ErrNotExist) && path.Ext(name) == "":
+			// index.html names the current asset fingerprints, so it must
+			// be revalidated on every load.
+			w.Header().Set("Cache-Control", "no-cache")
+			http.ServeFileFS(w, r, fsys, "index.html")
+		default:
+			http.NotFound(w, r)
+		}
+	})
+}
@@ -0,0 +1,45 @@
+package web_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/arkantrust/idempotency-example/backend/web"
+)
+
+func TestHandlerFallsBackToIndex(t *testing.T) {
+	h := web.Handler(fstest.MapFS{
+		"index.html":         {Data: []byte("<html>app</html>")},
+		"favicon.svg":        {Data: []byte("<svg/>")},
+		"assets/index-ab.js": {Data: []byte("console.log(1)")},
+	})
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+
+	for _, path := range []string{"/", "/chargebacks/cb-1", "/assets"} {
+		rec := get(path)
+		if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "app") {
+			t.Fatalf("%s: expected index.html, got %d %q", path, rec.Code, rec.Body.String())
+		}
+		if rec.Header().Get("Cache-Control") != "no-cache" {
+			t.Fatalf("%s: expected index.html to be revalidated, got %q", path, rec.Header().Get("Cache-Control"))
+		}
+	}
+
+	rec := get("/assets/index-ab.js")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Header().Get("Cache-Control"), "immutable") {
+		t.Fatalf("expected a cacheable asset, got %d %q", rec.Code, rec.Header().Get("Cache-Control"))
+	}
+	if rec := get("/favicon.svg"); rec.Code != http.StatusOK || rec.Body.String() != "<svg/>" {
+		t.Fatalf("expected the file, got %d %q", rec.Code, rec.Body.String())
+	}
+	if rec := get("/assets/missing.js"); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected a missing asset to be 404, got %d", rec.Code)
+	}
+}
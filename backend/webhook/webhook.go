@@ -0,0 +1,155 @@
+// Package webhook announces changes to chargebacks to HTTP endpoints.
+//
+// Publisher turns every event into one job per endpoint, and Deliver is the
+// job handler POSTing it, so a delivery is stored before it is attempted,
+// retried with backoff while the endpoint fails and resumed after a restart.
+// That makes delivery at-least-once: the same event can arrive more than
+// once, always with the same Webhook-Id, which receivers deduplicate on.
+//
+// Events are sent as CloudEvents 1.0 in structured JSON mode, so that
+// receivers can use any CloudEvents SDK; the envelope's id is the
+// Webhook-Id.
+//
+// Every attempt is recorded in a Log, with the receiver's answer, so that a
+// receiver missing an event can find out what happened to it.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/arkantrust/idempotency-example/backend/jobs"
+	"github.com/arkantrust/idempotency-example/backend/models"
+	"github.com/arkantrust/idempotency-example/backend/store"
+)
+
+// JobKind is the kind of the delivery jobs.
+const JobKind = "webhook"
+
+// Headers sent with every delivery, after the Standard Webhooks
+// specification: the event's ID and its time in Unix seconds.
+const (
+	IDHeader        = "Webhook-Id"
+	TimestampHeader = "Webhook-Timestamp"
+)
+
+// ContentType is the media type of a delivery's body.
+const ContentType = "application/cloudevents+json"
+
+// DefaultSource is the CloudEvents source of the events of a Publisher
+// without one.
+const DefaultSource = "/idempotency-example"
+
+// Delivery is the payload of a delivery job: an event and where to send it.
+type Delivery struct {
+	URL   string            `json:"url"`
+	Event models.CloudEvent `json:"event"`
+}
+
+// snippetBytes bounds the part of a receiver's answer a Log keeps.
+const snippetBytes = 1 << 10
+
+// Log keeps the record of the delivery attempts; *store.Store is one. The
+// context of a record is scoped to the event's tenant.
+type Log interface {
+	RecordWebhookDelivery(ctx context.Context, d *models.WebhookDelivery) error
+}
+
+// Publisher enqueues the delivery of events to every one of URLs.
+type Publisher struct {
+	Queue *jobs.Queue
+	URLs  []string
+
+	// Source is the CloudEvents source of the events, a URI reference
+	// identifying this server; empty means DefaultSource.
+	Source string
+}
+
+// Publish enqueues a delivery of e per URL. The jobs are keyed by the event
+// and the URL, so publishing an event again enqueues nothing.
+func (p *Publisher) Publish(ctx context.Context, e models.Event) error {
+	source := p.Source
+	if source == "" {
+		source = DefaultSource
+	}
+	ce := e.CloudEvent(source)
+	for _, url := range p.URLs {
+		if _, _, err := p.Queue.Enqueue(ctx, JobKind, e.ID+" "+url, Delivery{URL: url, Event: ce}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Deliver returns the handler of delivery jobs, which POSTs the event as
+// JSON with client and records the attempt in log, unless it is nil. Any 2xx
+// answer delivers it. Other 4xx answers than 408 and 429 fail the delivery
+// at once: the receiver refuses the event, and sending it again would not
+// change that. Other failures are retried.
+func Deliver(client *http.Client, log Log) jobs.Handler {
+	return func(ctx context.Context, job *models.Job) error {
+		var d Delivery
+		if err := json.Unmarshal(job.Payload, &d); err != nil {
+			return jobs.Permanent(fmt.Errorf("malformed delivery: %w", err))
+		}
+		attempt := &models.WebhookDelivery{
+			EventID:   d.Event.ID,
+			EventType: d.Event.Type,
+			URL:       d.URL,
+			Attempt:   job.Attempts,
+			At:        time.Now().UTC(),
+		}
+		err := post(ctx, client, d, attempt)
+		attempt.DurationMS = time.Since(attempt.At).Milliseconds()
+		attempt.Delivered = err == nil
+		if err != nil && attempt.Error == "" {
+			attempt.Error = err.Error()
+		}
+		if log != nil && ctx.Err() == nil {
+			if err := log.RecordWebhookDelivery(store.WithTenant(ctx, d.Event.Tenant), attempt); err != nil {
+				slog.Error("recording a webhook delivery failed", "event", d.Event.ID, "url", d.URL, "err", err)
+			}
+		}
+		return err
+	}
+}
+
+// post sends d.Event to d.URL, noting the answer in attempt.
+func post(ctx context.Context, client *http.Client, d Delivery, attempt *models.WebhookDelivery) error {
+	body, err := json.Marshal(d.Event)
+	if err != nil {
+		return jobs.Permanent(err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.URL, bytes.NewReader(body))
+	if err != nil {
+		return jobs.Permanent(err)
+	}
+	req.Header.Set("Content-Type", ContentType)
+	req.Header.Set(IDHeader, d.Event.ID)
+	req.Header.Set(TimestampHeader, strconv.FormatInt(d.Event.Time.Unix(), 10))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	snippet, _ := io.ReadAll(io.LimitReader(resp.Body, snippetBytes))
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10)) //nolint:errcheck // drained for connection reuse
+	resp.Body.Close()
+	attempt.StatusCode, attempt.Response = resp.StatusCode, string(snippet)
+
+	switch code := resp.StatusCode; {
+	case code >= 200 && code < 300:
+		return nil
+	case code >= 400 && code < 500 && code != http.StatusRequestTimeout && code != http.StatusTooManyRequests:
+		return jobs.Permanent(fmt.Errorf("%s answered %s", d.URL, resp.Status))
+	default:
+		return fmt.Errorf("%s answered %s", d.URL, resp.Status)
+	}
+}
@@ -0,0 +1,108 @@
+package webhook_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/arkantrust/idempotency-example/backend/jobs"
+	"github.com/arkantrust/idempotency-example/backend/models"
+	"github.com/arkantrust/idempotency-example/backend/store"
+	"github.com/arkantrust/idempotency-example/backend/webhook"
+)
+
+func delivery(t *testing.T, url string) *models.Job {
+	t.Helper()
+	payload, err := json.Marshal(webhook.Delivery{URL: url, Event: models.Event{
+		ID:      "evt-1",
+		Type:    "chargeback.created",
+		Subject: "cb-1",
+		Time:    time.Unix(1700000000, 0),
+		Data:    json.RawMessage(`{"id":"cb-1"}`),
+	}.CloudEvent(webhook.DefaultSource)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &models.Job{Kind: webhook.JobKind, Payload: payload}
+}
+
+func TestDeliverSendsTheEventWithItsID(t *testing.T) {
+	var got models.CloudEvent
+	var id, ts, ct string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, ts, ct = r.Header.Get(webhook.IDHeader), r.Header.Get(webhook.TimestampHeader), r.Header.Get("Content-Type")
+		json.NewDecoder(r.Body).Decode(&got) //nolint:errcheck
+	}))
+	defer srv.Close()
+
+	if err := webhook.Deliver(srv.Client(), nil)(context.Background(), delivery(t, srv.URL)); err != nil {
+		t.Fatalf("deliver: %v", err)
+	}
+	if id != "evt-1" || ts != "1700000000" || ct != webhook.ContentType || got.ID != "evt-1" || string(got.Data) != `{"id":"cb-1"}` {
+		t.Fatalf("unexpected delivery: %s %s %s %+v", id, ts, ct, got)
+	}
+	if got.SpecVersion != "1.0" || got.Source != webhook.DefaultSource || got.Subject != "cb-1" || got.DataContentType != "application/json" {
+		t.Fatalf("expected a CloudEvents envelope, got %+v", got)
+	}
+}
+
+func TestDeliverRetriesOnlyWhatRetryingCanFix(t *testing.T) {
+	for status, permanent := range map[int]bool{
+		http.StatusBadRequest:          true,
+		http.StatusGone:                true,
+		http.StatusTooManyRequests:     false,
+		http.StatusRequestTimeout:      false,
+		http.StatusInternalServerError: false,
+		http.StatusBadGateway:          false,
+	} {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(status)
+		}))
+		err := webhook.Deliver(srv.Client(), nil)(context.Background(), delivery(t, srv.URL))
+		srv.Close()
+		if err == nil || jobs.IsPermanent(err) != permanent {
+			t.Errorf("status %d: expected permanent=%v, got %v", status, permanent, err)
+		}
+	}
+}
+
+func TestDeliverRecordsEveryAttempt(t *testing.T) {
+	s, err := store.New(filepath.Join(t.TempDir(), "webhook.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	ctx := context.Background()
+
+	status := http.StatusServiceUnavailable
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		w.Write([]byte("try later")) //nolint:errcheck
+	}))
+	defer srv.Close()
+
+	job := delivery(t, srv.URL)
+	deliver := webhook.Deliver(srv.Client(), s)
+	for attempt := 1; attempt <= 2; attempt++ {
+		job.Attempts = attempt
+		deliver(ctx, job) //nolint:errcheck
+		status = http.StatusOK
+	}
+
+	got, err := s.WebhookDeliveries(ctx, "evt-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].Attempt != 1 || got[0].StatusCode != 503 || got[0].Response != "try later" || got[0].Delivered ||
+		got[1].StatusCode != 200 || !got[1].Delivered || got[1].URL != srv.URL {
+		t.Fatalf("unexpected deliveries: %+v", got)
+	}
+	// Another tenant does not see them.
+	if other, err := s.WebhookDeliveries(store.WithTenant(ctx, "acme"), "evt-1"); err != nil || len(other) != 0 {
+		t.Fatalf("expected no deliveries for another tenant, got %+v %v", other, err)
+	}
+}
@@ -36,8 +36,15 @@ export function AddChargebackDialog() {
   const mutation = useMutation({
     mutationFn: ({ id, input }: { id: string; input: ChargebackInput }) =>
       createChargeback(id, input),
-    onSuccess: () => {
-      toast.success('Chargeback created successfully.')
+    onSuccess: (res) => {
+      if (res.replayed) {
+        const when = res.originalCreatedAt
+          ? new Date(res.originalCreatedAt).toLocaleString()
+          : 'earlier'
+        toast.info(`Replayed: chargeback ${res.data.id} was already created ${when}.`)
+      } else {
+        toast.success('Chargeback created successfully.')
+      }
       qc.invalidateQueries({ queryKey: ['chargebacks'] })
       setOpen(false)
     },
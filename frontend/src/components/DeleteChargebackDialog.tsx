@@ -29,8 +29,12 @@ export function DeleteChargebackDialog({ chargeback }: DeleteChargebackDialogPro
 
   const mutation = useMutation({
     mutationFn: () => deleteChargeback(chargeback.id),
-    onSuccess: () => {
-      toast.success(`Chargeback ${chargeback.id} deleted.`)
+    onSuccess: (res) => {
+      if (res.replayed) {
+        toast.info(`Chargeback ${chargeback.id} was already deleted.`)
+      } else {
+        toast.success(`Chargeback ${chargeback.id} deleted.`)
+      }
       qc.invalidateQueries({ queryKey: ['chargebacks'] })
       setOpen(false)
     },
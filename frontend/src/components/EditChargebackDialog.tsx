@@ -31,8 +31,12 @@ export function EditChargebackDialog({ chargeback }: EditChargebackDialogProps)
 
   const mutation = useMutation({
     mutationFn: (input: ChargebackInput) => updateChargeback(chargeback.id, input),
-    onSuccess: (_data) => {
-      toast.success('Chargeback updated.')
+    onSuccess: (res) => {
+      if (res.replayed) {
+        toast.info('No changes detected – nothing was written.')
+      } else {
+        toast.success('Chargeback updated.')
+      }
       qc.invalidateQueries({ queryKey: ['chargebacks'] })
       setOpen(false)
     },
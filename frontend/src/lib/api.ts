@@ -16,9 +16,38 @@ async function handleResponse<T>(res: Response): Promise<T> {
     const body = await res.text()
     throw new Error(body || `HTTP ${res.status}`)
   }
+  // A server configured with deleteStatus 204 answers deletes without a body.
+  if (res.status === 204) return undefined as T
   return res.json() as Promise<T>
 }
 
+/**
+ * The outcome of a write, read from the idempotency headers the backend sets
+ * on every mutating verb.
+ */
+export interface WriteResult<T> {
+  data: T
+  /**
+   * True when the server wrote nothing: a create that found the record an
+   * earlier request made, an update matching the stored record, or a delete
+   * of a record that was already gone.
+   */
+  replayed: boolean
+  /** For a replayed create, when the record was originally created. */
+  originalCreatedAt?: string
+}
+
+async function handleWrite<T>(res: Response): Promise<WriteResult<T>> {
+  const data = await handleResponse<T>(res)
+  return {
+    data,
+    replayed:
+      res.headers.get('X-Idempotency-Replayed') === 'true' ||
+      res.headers.get('X-Idempotency-Write') === 'false',
+    originalCreatedAt: res.headers.get('X-Idempotency-Original-Created-At') ?? undefined,
+  }
+}
+
 /** Fetch all chargebacks. */
 export async function listChargebacks(): Promise<Chargeback[]> {
   const res = await fetch(BASE)
@@ -29,18 +58,19 @@ export async function listChargebacks(): Promise<Chargeback[]> {
  * Create a chargeback using `id` as the idempotency key.
  *
  * If the server already has a record with this ID it returns the existing
- * record without creating a duplicate. This makes retries unconditionally safe.
+ * record without creating a duplicate, reporting it as replayed along with
+ * the original creation time. This makes retries unconditionally safe.
  */
 export async function createChargeback(
   id: string,
   input: ChargebackInput,
-): Promise<Chargeback> {
+): Promise<WriteResult<Chargeback>> {
   const res = await fetch(`${BASE}/${id}`, {
     method: 'POST',
     headers: { 'Content-Type': 'application/json' },
     body: JSON.stringify(input),
   })
-  return handleResponse<Chargeback>(res)
+  return handleWrite<Chargeback>(res)
 }
 
 /**
@@ -53,22 +83,23 @@ export async function createChargeback(
 export async function updateChargeback(
   id: string,
   input: ChargebackInput,
-): Promise<Chargeback> {
+): Promise<WriteResult<Chargeback>> {
   const res = await fetch(`${BASE}/${id}`, {
     method: 'PUT',
     headers: { 'Content-Type': 'application/json' },
     body: JSON.stringify(input),
   })
-  return handleResponse<Chargeback>(res)
+  return handleWrite<Chargeback>(res)
 }
 
 /**
  * Delete a chargeback.
  *
- * The backend returns 200 OK even when the record does not exist, so retrying
- * a delete is always safe.
+ * The backend returns 200 OK (or 204, if so configured) even when the record
+ * does not exist, so retrying a delete is always safe; X-Idempotency-Replayed
+ * tells the two cases apart.
  */
-export async function deleteChargeback(id: string): Promise<void> {
+export async function deleteChargeback(id: string): Promise<WriteResult<unknown>> {
   const res = await fetch(`${BASE}/${id}`, { method: 'DELETE' })
-  await handleResponse<unknown>(res)
+  return handleWrite<unknown>(res)
 }
@@ -8,6 +8,8 @@ export interface Chargeback {
   reason: string
   createdAt: string
   updatedAt: string
+  /** 1 when created, incremented by every write that changed the record. */
+  version: number
 }
 
 /** ChargebackInput is the payload sent when creating or updating a chargeback. */
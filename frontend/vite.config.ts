@@ -11,6 +11,11 @@ export default defineConfig({
       '@': path.resolve(__dirname, './src'),
     },
   },
+  // The bundle is embedded in the Go binary, which serves it at /.
+  build: {
+    outDir: '../backend/web/dist/app',
+    emptyOutDir: true,
+  },
   server: {
     proxy: {
       '/chargebacks': 'http://localhost:8080',